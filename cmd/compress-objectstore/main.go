@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Cloud-Foundations/Dominator/lib/flags/loadflags"
+	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
+	"github.com/Cloud-Foundations/Dominator/lib/log/cmdlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+)
+
+var (
+	compression = flag.String("compression", "zstd",
+		"Compression method (gzip, zstd or none)")
+	maximumRatio = flag.Float64("maximumRatio", 0.9,
+		"Store objects raw if compressed/uncompressed size is above this")
+	minimumSize = flagutil.Size(4 << 10)
+	objectDir   = flag.String("objectDir", "/var/lib/objectserver",
+		"Name of object server data directory")
+)
+
+func init() {
+	flag.Var(&minimumSize, "minimumSize", "Store objects smaller than this raw")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			"Usage: compress-objectstore [flags...]")
+		fmt.Fprintln(os.Stderr, "Common flags:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr,
+			"This tool will convert an object store in place to use the")
+		fmt.Fprintln(os.Stderr,
+			"specified compression. The object server must be stopped first.")
+	}
+}
+
+func main() {
+	if err := loadflags.LoadForCli("compress-objectstore"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cmdlogger.SetDatestampsDefault(true)
+	flag.Parse()
+	logger := cmdlogger.New()
+	err := filesystem.ConvertStore(*objectDir,
+		filesystem.CompressionConfig{
+			Method:       *compression,
+			MaximumRatio: *maximumRatio,
+			MinimumSize:  uint64(minimumSize),
+		},
+		logger)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/mdb"
+)
+
+const (
+	tagPostDisruptionHook = "DisruptionManagerPostDisruptionHook"
+	tagPreDisruptionHook  = "DisruptionManagerPreDisruptionHook"
+
+	hookNamePost = "post-disruption"
+	hookNamePre  = "pre-disruption"
+)
+
+var (
+	hookTimeout = flag.Duration("hookTimeout", 15*time.Minute,
+		"Maximum time to wait for a pre-disruption or post-disruption hook")
+)
+
+type hookFailureType struct {
+	Error string
+	Hook  string
+	Time  time.Time
+}
+
+type hookFailureInfoType struct {
+	Hostname string
+	hookFailureType
+}
+
+// expandHook returns the hook specified by the MDB tag, with template
+// expansion applied. The empty string is returned if there is no hook.
+func expandHook(machine mdb.Machine, tagName string, logger log.Logger) string {
+	value := machine.Tags[tagName]
+	if value == "" {
+		return ""
+	}
+	tmpl, err := template.New("").Parse(value)
+	if err != nil {
+		logger.Printf("%s: error parsing [%s]=%s\n",
+			machine.Hostname, tagName, value)
+		return ""
+	}
+	builder := &strings.Builder{}
+	if err := tmpl.Execute(builder, machine); err != nil {
+		logger.Printf("%s: error executing [%s]=%s\n",
+			machine.Hostname, tagName, value)
+		return ""
+	}
+	return builder.String()
+}
+
+func hasHooks(machine mdb.Machine) bool {
+	return machine.Tags[tagPreDisruptionHook] != "" ||
+		machine.Tags[tagPostDisruptionHook] != ""
+}
+
+// runHook runs the hook. If the hook is a HTTP or HTTPS URL, the MDB data for
+// the machine are POSTed to it and a 2xx status code must be returned,
+// otherwise the hook is run as a shell command which must exit with status 0.
+func runHook(hook string, machine mdb.Machine, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if strings.HasPrefix(hook, "http://") ||
+		strings.HasPrefix(hook, "https://") {
+		body := &bytes.Buffer{}
+		if err := json.WriteWithIndent(body, "    ", machine); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", hook, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			message := &strings.Builder{}
+			io.Copy(message, io.LimitReader(resp.Body, 256))
+			return fmt.Errorf("%s: %s",
+				resp.Status, strings.TrimSpace(message.String()))
+		}
+		return nil
+	}
+	output, err := exec.CommandContext(ctx, "/bin/sh", "-c",
+		hook).CombinedOutput()
+	if err != nil {
+		if output = bytes.TrimSpace(output); len(output) > 0 {
+			return fmt.Errorf("%s: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
+
+// runPostDisruptionHook runs the post-disruption hook for the machine, if
+// there is one, and records any failure.
+func (dm *disruptionManager) runPostDisruptionHook(group *groupInfoType,
+	machine mdb.Machine, groupText string) {
+	hook := expandHook(machine, tagPostDisruptionHook, dm.logger)
+	if hook == "" {
+		return
+	}
+	dm.logger.Printf("%s: running %s hook (%s)\n",
+		machine.Hostname, hookNamePost, groupText)
+	err := runHook(hook, machine, *hookTimeout)
+	dm.mutex.Lock()
+	defer dm.unlockAndInvalidate(true)
+	if err != nil {
+		dm.logger.Printf("%s: %s hook failed: %s (%s)\n",
+			machine.Hostname, hookNamePost, err, groupText)
+		group.hookFailures[machine.Hostname] = hookFailureType{
+			Error: err.Error(),
+			Hook:  hookNamePost,
+			Time:  time.Now(),
+		}
+		return
+	}
+	if failure, ok := group.hookFailures[machine.Hostname]; ok &&
+		failure.Hook == hookNamePost {
+		delete(group.hookFailures, machine.Hostname)
+	}
+}
+
+// runPreDisruptionHook runs the pre-disruption hook for the machine. If the
+// hook succeeds the machine moves from preparing to permitted. If it fails the
+// failure is recorded and the machine moves to denied.
+func (dm *disruptionManager) runPreDisruptionHook(group *groupInfoType,
+	machine mdb.Machine, groupText, hook string) {
+	dm.logger.Printf("%s: running %s hook (%s)\n",
+		machine.Hostname, hookNamePre, groupText)
+	err := runHook(hook, machine, *hookTimeout)
+	dm.mutex.Lock()
+	defer func() {
+		dm.unlockAndInvalidate(true)
+		sendNotification(dm.recalculateNotifier)
+	}()
+	lastRequest, ok := group.preparing[machine.Hostname]
+	if !ok {
+		// Cancelled while preparing: undo the preparation.
+		if err == nil {
+			go dm.runPostDisruptionHook(group, machine, groupText)
+		}
+		return
+	}
+	delete(group.preparing, machine.Hostname)
+	if err != nil {
+		dm.logger.Printf("%s: preparing->denied, %s hook failed: %s (%s)\n",
+			machine.Hostname, hookNamePre, err, groupText)
+		group.hookFailures[machine.Hostname] = hookFailureType{
+			Error: err.Error(),
+			Hook:  hookNamePre,
+			Time:  time.Now(),
+		}
+		return
+	}
+	delete(group.hookFailures, machine.Hostname)
+	group.permitted[machine.Hostname] = lastRequest
+	dm.logger.Printf("%s: preparing->permitted (%s)\n",
+		machine.Hostname, groupText)
+}
+
+// permit moves the machine to permitted, or to preparing if it has a
+// pre-disruption hook, which is run in the background. The new state is
+// returned.
+// This must be called with the lock held.
+func (dm *disruptionManager) permit(group *groupInfoType, machine mdb.Machine,
+	groupText string, lastRequest time.Time) string {
+	hook := expandHook(machine, tagPreDisruptionHook, dm.logger)
+	if hook == "" {
+		group.permitted[machine.Hostname] = lastRequest
+		return "permitted"
+	}
+	group.preparing[machine.Hostname] = lastRequest
+	go dm.runPreDisruptionHook(group, machine, groupText, hook)
+	return "preparing"
+}
@@ -87,6 +87,9 @@ func (s *httpServer) requestHandler(w http.ResponseWriter, req *http.Request) {
 		writer := bufio.NewWriter(w)
 		defer writer.Flush()
 		reply := dm_proto.DisruptionResponse{Response: state}
+		if state == sub_proto.DisruptionStateDenied {
+			reply.NextWindow = s.disruptionManager.getNextWindow(request.MDB)
+		}
 		if err := libjson.WriteWithIndent(writer, "    ", reply); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -122,6 +125,7 @@ func (s *httpServer) showStateHandler(w http.ResponseWriter,
 	now := time.Now()
 	for _, groupInfo := range groupList.groups {
 		if len(groupInfo.Permitted) < 1 &&
+			len(groupInfo.Preparing) < 1 &&
 			len(groupInfo.Requested) < 1 &&
 			len(groupInfo.Waiting) < 1 {
 			continue
@@ -134,6 +138,14 @@ func (s *httpServer) showStateHandler(w http.ResponseWriter,
 						s.disruptionManager.maxDuration).Sub(now)),
 				"", "")
 		}
+		for _, hostInfo := range groupInfo.Preparing {
+			tw.WriteRow("", "",
+				hostInfo.Hostname, "preparing", groupInfo.Identifier,
+				format.Duration(now.Sub(hostInfo.LastRequest))+"/"+
+					format.Duration(hostInfo.LastRequest.Add(
+						s.disruptionManager.maxDuration).Sub(now)),
+				"", "")
+		}
 		for _, hostInfo := range groupInfo.Requested {
 			tw.WriteRow("", "",
 				hostInfo.Hostname, "requested", groupInfo.Identifier,
@@ -150,6 +162,20 @@ func (s *httpServer) showStateHandler(w http.ResponseWriter,
 		}
 	}
 	tw.Close()
+	if groupList.totalHookFailures > 0 {
+		fmt.Fprintln(writer, "<h3>Hook failures</h3>")
+		fmt.Fprintln(writer, `<table border="1" style="width:100%">`)
+		tw, _ := html.NewTableWriter(writer, true,
+			"Hostname", "Group", "Hook", "Age", "Error")
+		for _, groupInfo := range groupList.groups {
+			for _, failure := range groupInfo.HookFailures {
+				tw.WriteRow("", "",
+					failure.Hostname, groupInfo.Identifier, failure.Hook,
+					format.Duration(now.Sub(failure.Time)), failure.Error)
+			}
+		}
+		tw.Close()
+	}
 	fmt.Fprintln(writer, "</center>")
 	fmt.Fprintln(writer, "</body>")
 }
@@ -176,13 +202,19 @@ func (s *httpServer) statusHandler(w http.ResponseWriter, req *http.Request) {
 	groupList := s.disruptionManager.getGroupList()
 	if len(groupList.groups) < 1 {
 		fmt.Fprintln(writer,
-			"No disruptions permitted, requested or waiting<br>")
+			"No disruptions permitted, preparing, requested or waiting<br>")
 	} else {
 		fmt.Fprintf(writer,
-			"%d disruptions permitted, %d requested and %d waiting: ",
-			groupList.totalPermitted, groupList.totalRequested,
-			groupList.totalWaiting)
+			"%d disruptions permitted, %d preparing, %d requested and "+
+				"%d waiting: ",
+			groupList.totalPermitted, groupList.totalPreparing,
+			groupList.totalRequested, groupList.totalWaiting)
 		fmt.Fprintln(writer, `<a href="showState">dashboard</a><br>`)
+		if groupList.totalHookFailures > 0 {
+			fmt.Fprintf(writer,
+				"<font color=\"red\">%d hook failures</font><br>\n",
+				groupList.totalHookFailures)
+		}
 	}
 	for _, htmlWriter := range s.htmlWriters {
 		htmlWriter.WriteHtml(writer)
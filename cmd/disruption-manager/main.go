@@ -18,6 +18,8 @@ var (
 	maximumPermittedDuration = flag.Duration("maximumPermittedDuration",
 		time.Hour,
 		"Maximum time disruption will be permitted after last request")
+	scheduleUrl = flag.String("scheduleUrl", "",
+		"URL or filename of JSON maintenance windows and blackouts for groups")
 	portNum = flag.Uint("portNum", constants.DisruptionManagerPortNumber,
 		"Port number to allocate and listen on for HTTP/RPC")
 	stateDir = flag.String("stateDir", "/var/lib/disruption-manager",
@@ -46,6 +48,11 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Unable to create Disruption Manager: %s\n", err)
 	}
+	if *scheduleUrl != "" {
+		if err := dm.watchSchedules(*scheduleUrl); err != nil {
+			logger.Fatalf("Unable to watch schedules: %s\n", err)
+		}
+	}
 	err = setupserver.SetupTlsWithParams(setupserver.Params{Logger: logger})
 	if err != nil {
 		logger.Fatalln(err)
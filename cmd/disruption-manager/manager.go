@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/backoffdelay"
+	"github.com/Cloud-Foundations/Dominator/lib/configwatch"
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
 	"github.com/Cloud-Foundations/Dominator/lib/json"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
@@ -38,33 +39,43 @@ type disruptionManager struct {
 	mutex               sync.Mutex                // Protect everything below.
 	exportable          *groupListType            // nil if invalid.
 	groups              map[string]*groupInfoType // Key: group identifier.
+	schedules           map[string]*scheduleType  // Key: group identifier.
 }
 
 type groupInfoType struct {
+	hookFailures map[string]hookFailureType // K: hostname.
+	machines     map[string]mdb.Machine     // K: hostname, if it has hooks.
 	maxPermitted uint64
+	schedule     *scheduleType            // nil: always open.
 	permitted    map[string]time.Time     // K: hostname, V: last request time.
+	preparing    map[string]time.Time     // K: hostname, V: last request time.
 	requested    map[string]time.Time     // K: hostname, V: last request time.
 	waiting      map[string]*waitDataType // K: hostname.
 }
 
 type groupStatsType struct {
-	Identifier string
-	Permitted  []hostInfoType `json:",omitempty"`
-	Requested  []hostInfoType `json:",omitempty"`
-	Waiting    []waitInfoType `json:",omitempty"`
+	Identifier   string
+	HookFailures []hookFailureInfoType `json:",omitempty"`
+	Permitted    []hostInfoType        `json:",omitempty"`
+	Preparing    []hostInfoType        `json:",omitempty"`
+	Requested    []hostInfoType        `json:",omitempty"`
+	Waiting      []waitInfoType        `json:",omitempty"`
 }
 
 type hostInfoType struct {
 	Hostname    string
-	LastRequest time.Time `json:",omitempty"`
+	LastRequest time.Time    `json:",omitempty"`
+	MDB         *mdb.Machine `json:",omitempty"` // If it has hooks.
 	waitInfoType
 }
 
 type groupListType struct {
-	groups         []groupStatsType
-	totalPermitted uint
-	totalRequested uint
-	totalWaiting   uint
+	groups            []groupStatsType
+	totalHookFailures uint
+	totalPermitted    uint
+	totalPreparing    uint
+	totalRequested    uint
+	totalWaiting      uint
 }
 
 type waitDataType struct {
@@ -114,6 +125,14 @@ func sendNotification(notifier chan<- struct{}) {
 	}
 }
 
+// stateFromName returns the state reported for the name returned by permit.
+func stateFromName(name string) sub_proto.DisruptionState {
+	if name == "preparing" {
+		return sub_proto.DisruptionStateRequested
+	}
+	return sub_proto.DisruptionStatePermitted
+}
+
 func sortHostInfos(list []hostInfoType) {
 	sort.SliceStable(list, func(left, right int) bool {
 		return list[left].Hostname < list[right].Hostname
@@ -151,13 +170,23 @@ func newDisruptionManager(stateFilename string,
 			for _, groupStats := range groupList.groups {
 				group := newGroup()
 				dm.groups[groupStats.Identifier] = group
+				for _, hosts := range [][]hostInfoType{groupStats.Permitted,
+					groupStats.Preparing, groupStats.Requested} {
+					for _, host := range hosts {
+						if host.MDB != nil {
+							group.machines[host.Hostname] = *host.MDB
+						}
+					}
+				}
 				for _, host := range groupStats.Permitted {
 					if _, ok := group.permitted[host.Hostname]; !ok {
 						group.permitted[host.Hostname] = host.LastRequest
 						groupList.totalPermitted++
 					}
 				}
-				for _, host := range groupStats.Requested {
+				// Hooks which were running are run again when next requested.
+				for _, host := range append(groupStats.Requested,
+					groupStats.Preparing...) {
 					if _, ok := group.permitted[host.Hostname]; !ok {
 						group.requested[host.Hostname] = host.LastRequest
 						groupList.totalRequested++
@@ -193,8 +222,16 @@ func (dm *disruptionManager) cancel(machine mdb.Machine) (
 	}()
 	group, groupText := dm.getGroup(machine)
 	var logMessage string
+	if _, ok := group.preparing[machine.Hostname]; ok {
+		// The pre-disruption hook will be undone when it completes.
+		invalidate = true
+		delete(group.preparing, machine.Hostname)
+		logMessage = fmt.Sprintf("%s: preparing->denied (%s)",
+			machine.Hostname, groupText)
+	}
 	if _, ok := group.permitted[machine.Hostname]; ok {
 		invalidate = true
+		go dm.runPostDisruptionHook(group, machine, groupText)
 		if waitData != nil {
 			group.waiting[machine.Hostname] = waitData
 			go waitData.wait(dm.recalculateNotifier, machine.Hostname,
@@ -204,11 +241,12 @@ func (dm *disruptionManager) cancel(machine mdb.Machine) (
 		} else {
 			// Move one host from Requested -> Permitted if possible.
 			for hostname, lastRequest := range group.requested {
-				group.permitted[hostname] = lastRequest
 				delete(group.requested, hostname)
+				newState := dm.permit(group, group.getMachine(hostname),
+					groupText, lastRequest)
 				logMessage = fmt.Sprintf(
-					"%s: permitted->denied and %s: requested->permitted (%s)",
-					machine.Hostname, hostname, groupText)
+					"%s: permitted->denied and %s: requested->%s (%s)",
+					machine.Hostname, hostname, newState, groupText)
 				break
 			}
 			if logMessage == "" {
@@ -240,20 +278,31 @@ func (dm *disruptionManager) check(machine mdb.Machine) (
 	if _, ok := group.permitted[machine.Hostname]; ok {
 		return sub_proto.DisruptionStatePermitted, "", nil
 	}
+	if _, ok := group.preparing[machine.Hostname]; ok {
+		return sub_proto.DisruptionStateRequested, "", nil
+	}
 	lastRequestTime, previouslyRequested := group.requested[machine.Hostname]
 	if !previouslyRequested {
 		return sub_proto.DisruptionStateDenied, "", nil
 	}
+	if !group.schedule.isOpen(time.Now()) {
+		invalidate = true
+		delete(group.requested, machine.Hostname)
+		return sub_proto.DisruptionStateDenied,
+			fmt.Sprintf("%s: requested->denied/outside window (%s)",
+				machine.Hostname, groupText),
+			nil
+	}
 	if !group.canPermit(machine.Tags) {
 		return sub_proto.DisruptionStateRequested, "", nil
 	}
 	// Previously requested and now there is room. W00t!
 	invalidate = true
-	group.permitted[machine.Hostname] = lastRequestTime
 	delete(group.requested, machine.Hostname)
-	return sub_proto.DisruptionStatePermitted,
-		fmt.Sprintf("%s: requested->permitted (%s)",
-			machine.Hostname, groupText),
+	newState := dm.permit(group, machine, groupText, lastRequestTime)
+	return stateFromName(newState),
+		fmt.Sprintf("%s: requested->%s (%s)",
+			machine.Hostname, newState, groupText),
 		nil
 }
 
@@ -270,6 +319,20 @@ func (dm *disruptionManager) getGroup(machine mdb.Machine) (
 		group = newGroup()
 		dm.groups[groupIdentifier] = group
 	}
+	if hasHooks(machine) {
+		group.machines[machine.Hostname] = machine
+	} else {
+		delete(group.machines, machine.Hostname)
+	}
+	if schedule, err := makeScheduleFromTags(machine.Tags); err != nil {
+		dm.logger.Printf("%s: error parsing schedule tags: %s\n",
+			machine.Hostname, err)
+		group.schedule = dm.schedules[groupIdentifier]
+	} else if schedule != nil {
+		group.schedule = schedule
+	} else {
+		group.schedule = dm.schedules[groupIdentifier]
+	}
 	return group, makeGroupText(groupIdentifier)
 }
 
@@ -281,7 +344,9 @@ func (dm *disruptionManager) getGroupList() *groupListType {
 	}
 	var groupList groupListType
 	for groupIdentifier, group := range dm.groups {
-		if len(group.permitted) < 1 &&
+		if len(group.hookFailures) < 1 &&
+			len(group.permitted) < 1 &&
+			len(group.preparing) < 1 &&
 			len(group.requested) < 1 &&
 			len(group.waiting) < 1 {
 			continue
@@ -289,18 +354,41 @@ func (dm *disruptionManager) getGroupList() *groupListType {
 		groupStats := groupStatsType{
 			Identifier: groupIdentifier,
 		}
+		for hostname, failure := range group.hookFailures {
+			groupStats.HookFailures = append(groupStats.HookFailures,
+				hookFailureInfoType{
+					Hostname:        hostname,
+					hookFailureType: failure,
+				})
+		}
+		sort.SliceStable(groupStats.HookFailures, func(left, right int) bool {
+			return groupStats.HookFailures[left].Hostname <
+				groupStats.HookFailures[right].Hostname
+		})
+		groupList.totalHookFailures += uint(len(groupStats.HookFailures))
 		for hostname, lastRequest := range group.permitted {
 			groupStats.Permitted = append(groupStats.Permitted, hostInfoType{
 				Hostname:    hostname,
 				LastRequest: lastRequest,
+				MDB:         group.getSavedMachine(hostname),
 			})
 		}
 		sortHostInfos(groupStats.Permitted)
 		groupList.totalPermitted += uint(len(groupStats.Permitted))
+		for hostname, lastRequest := range group.preparing {
+			groupStats.Preparing = append(groupStats.Preparing, hostInfoType{
+				Hostname:    hostname,
+				LastRequest: lastRequest,
+				MDB:         group.getSavedMachine(hostname),
+			})
+		}
+		sortHostInfos(groupStats.Preparing)
+		groupList.totalPreparing += uint(len(groupStats.Preparing))
 		for hostname, lastRequest := range group.requested {
 			groupStats.Requested = append(groupStats.Requested, hostInfoType{
 				Hostname:    hostname,
 				LastRequest: lastRequest,
+				MDB:         group.getSavedMachine(hostname),
 			})
 		}
 		sortHostInfos(groupStats.Requested)
@@ -320,6 +408,20 @@ func (dm *disruptionManager) getGroupList() *groupListType {
 	return &groupList
 }
 
+// getNextWindow returns the start of the next maintenance window for the
+// machine if disruption is not currently permitted by its schedule, else the
+// zero time.
+func (dm *disruptionManager) getNextWindow(machine mdb.Machine) time.Time {
+	dm.mutex.Lock()
+	defer dm.mutex.Unlock()
+	group, _ := dm.getGroup(machine)
+	now := time.Now()
+	if nextWindow := group.schedule.nextWindow(now); !nextWindow.Equal(now) {
+		return nextWindow
+	}
+	return time.Time{}
+}
+
 func (dm *disruptionManager) recalculateLoop(notifier <-chan struct{}) {
 	for {
 		for _, logLine := range dm.recalculateOnce() {
@@ -345,7 +447,8 @@ func (dm *disruptionManager) recalculateOnce() []string {
 	defer func() {
 		dm.unlockAndInvalidate(invalidate)
 	}()
-	expireBefore := time.Now().Add(-dm.maxDuration)
+	now := time.Now()
+	expireBefore := now.Add(-dm.maxDuration)
 	var logLines []string
 	for groupIdentifier, group := range dm.groups {
 		groupText := makeGroupText(groupIdentifier)
@@ -359,6 +462,8 @@ func (dm *disruptionManager) recalculateOnce() []string {
 			if lastRequestTime.Before(expireBefore) {
 				invalidate = true
 				delete(group.permitted, hostname)
+				go dm.runPostDisruptionHook(group, group.getMachine(hostname),
+					groupText)
 				logLines = append(logLines,
 					fmt.Sprintf("%s: permitted/expired->denied (%s)",
 						hostname, groupText))
@@ -370,13 +475,14 @@ func (dm *disruptionManager) recalculateOnce() []string {
 				delete(group.requested, hostname)
 				dm.logger.Printf("%s: requested/expired->denied (%s)\n",
 					hostname, groupText)
-			} else if group.canPermit(nil) {
+			} else if group.canPermit(nil) && group.schedule.isOpen(now) {
 				invalidate = true
-				group.permitted[hostname] = lastRequestTime
 				delete(group.requested, hostname)
+				newState := dm.permit(group, group.getMachine(hostname),
+					groupText, lastRequestTime)
 				logLines = append(logLines,
-					fmt.Sprintf("%s: requested->permitted (%s)",
-						hostname, groupText))
+					fmt.Sprintf("%s: requested->%s (%s)",
+						hostname, newState, groupText))
 			}
 		}
 	}
@@ -392,18 +498,30 @@ func (dm *disruptionManager) request(machine mdb.Machine) (
 		group.permitted[machine.Hostname] = time.Now()
 		return sub_proto.DisruptionStatePermitted, "", nil
 	}
+	if _, ok := group.preparing[machine.Hostname]; ok {
+		group.preparing[machine.Hostname] = time.Now()
+		return sub_proto.DisruptionStateRequested, "", nil
+	}
 	var logMessage string
-	if group.canPermit(machine.Tags) {
-		group.permitted[machine.Hostname] = time.Now()
+	if !group.schedule.isOpen(time.Now()) {
 		if _, ok := group.requested[machine.Hostname]; ok {
-			logMessage = fmt.Sprintf("%s: requested->permitted (%s)",
+			logMessage = fmt.Sprintf("%s: requested->denied/outside window (%s)",
 				machine.Hostname, groupText)
 			delete(group.requested, machine.Hostname)
+		}
+		return sub_proto.DisruptionStateDenied, logMessage, nil
+	}
+	if group.canPermit(machine.Tags) {
+		newState := dm.permit(group, machine, groupText, time.Now())
+		if _, ok := group.requested[machine.Hostname]; ok {
+			logMessage = fmt.Sprintf("%s: requested->%s (%s)",
+				machine.Hostname, newState, groupText)
+			delete(group.requested, machine.Hostname)
 		} else {
-			logMessage = fmt.Sprintf("%s: denied->permitted (%s)",
-				machine.Hostname, groupText)
+			logMessage = fmt.Sprintf("%s: denied->%s (%s)",
+				machine.Hostname, newState, groupText)
 		}
-		return sub_proto.DisruptionStatePermitted, logMessage, nil
+		return stateFromName(newState), logMessage, nil
 	}
 	if _, ok := group.requested[machine.Hostname]; !ok {
 		logMessage = fmt.Sprintf("%s: denied->requested (%s)",
@@ -413,6 +531,17 @@ func (dm *disruptionManager) request(machine mdb.Machine) (
 	return sub_proto.DisruptionStateRequested, logMessage, nil
 }
 
+func (dm *disruptionManager) scheduleLoop(channel <-chan interface{}) {
+	for schedules := range channel {
+		dm.mutex.Lock()
+		dm.schedules = schedules.(map[string]*scheduleType)
+		dm.mutex.Unlock()
+		dm.logger.Printf("Loaded schedules for %d groups\n",
+			len(dm.schedules))
+		sendNotification(dm.recalculateNotifier)
+	}
+}
+
 func (dm *disruptionManager) unlockAndInvalidate(invalidate bool) {
 	if invalidate {
 		dm.exportable = nil
@@ -424,6 +553,18 @@ func (dm *disruptionManager) unlockAndInvalidate(invalidate bool) {
 	sendNotification(dm.writeNotifier)
 }
 
+// watchSchedules loads the maintenance windows and blackout periods for groups
+// from the specified URL or file and watches for changes.
+func (dm *disruptionManager) watchSchedules(url string) error {
+	channel, err := configwatch.Watch(url, time.Minute, decodeSchedules,
+		dm.logger)
+	if err != nil {
+		return err
+	}
+	go dm.scheduleLoop(channel)
+	return nil
+}
+
 func (dm *disruptionManager) writeLoop(notifier <-chan struct{}) {
 	for range notifier {
 		if err := dm.writeOnce(); err != nil {
@@ -450,13 +591,35 @@ func (group *groupInfoType) canPermit(tgs tags.Tags) bool {
 		maximum = 1
 	}
 	group.maxPermitted = maximum
-	return uint64(len(group.permitted)+len(group.waiting)) < maximum
+	return uint64(len(group.permitted)+len(group.preparing)+
+		len(group.waiting)) < maximum
+}
+
+// getMachine returns the MDB data for the host if it has hooks, else minimal
+// MDB data.
+func (group *groupInfoType) getMachine(hostname string) mdb.Machine {
+	if machine, ok := group.machines[hostname]; ok {
+		return machine
+	}
+	return mdb.Machine{Hostname: hostname}
+}
+
+// getSavedMachine returns a copy of the MDB data for the host if it has hooks,
+// else nil.
+func (group *groupInfoType) getSavedMachine(hostname string) *mdb.Machine {
+	if machine, ok := group.machines[hostname]; ok {
+		return &machine
+	}
+	return nil
 }
 
 func newGroup() *groupInfoType {
 	return &groupInfoType{
+		hookFailures: make(map[string]hookFailureType),
+		machines:     make(map[string]mdb.Machine),
 		maxPermitted: 1,
 		permitted:    make(map[string]time.Time),
+		preparing:    make(map[string]time.Time),
 		requested:    make(map[string]time.Time),
 		waiting:      make(map[string]*waitDataType),
 	}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -230,3 +232,90 @@ func TestReadinessTimeout(t *testing.T) {
 			format.Duration(timeTaken))
 	}
 }
+
+func TestPreDisruptionHook(t *testing.T) {
+	logger := testlogger.New(t)
+	dm, err := newDisruptionManager("", time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := mdb.Machine{
+		Hostname: "testhost-5",
+		Tags:     tags.Tags{tagPreDisruptionHook: "exit 1"},
+	}
+	state, _, err := dm.request(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != proto.DisruptionStateRequested {
+		t.Fatalf("initial state: %s != %s",
+			state, proto.DisruptionStateRequested)
+	}
+	waitForState := func(expected proto.DisruptionState) {
+		stopTime := time.Now().Add(time.Second)
+		for ; time.Until(stopTime) > 0; time.Sleep(10 * time.Millisecond) {
+			if state, _, err = dm.check(machine); err != nil {
+				t.Fatal(err)
+			}
+			if state == expected {
+				return
+			}
+		}
+		t.Fatalf("state: %s != %s", state, expected)
+	}
+	waitForState(proto.DisruptionStateDenied)
+	if groupList := dm.getGroupList(); groupList.totalHookFailures != 1 {
+		t.Fatalf("hook failures: %d != 1", groupList.totalHookFailures)
+	}
+	machine.Tags[tagPreDisruptionHook] = "true"
+	if _, _, err := dm.request(machine); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(proto.DisruptionStatePermitted)
+	if groupList := dm.getGroupList(); groupList.totalHookFailures != 0 {
+		t.Fatalf("hook failures: %d != 0", groupList.totalHookFailures)
+	}
+}
+
+func TestRestoreMachines(t *testing.T) {
+	logger := testlogger.New(t)
+	stateFilename := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(stateFilename, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dm, err := newDisruptionManager(stateFilename, time.Minute, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := mdb.Machine{
+		Hostname: "testhost-6",
+		Tags:     tags.Tags{tagPostDisruptionHook: "true"},
+	}
+	state, _, err := dm.request(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != proto.DisruptionStatePermitted {
+		t.Fatalf("initial state: %s != %s",
+			state, proto.DisruptionStatePermitted)
+	}
+	if err := dm.writeOnce(); err != nil {
+		t.Fatal(err)
+	}
+	dm, err = newDisruptionManager(stateFilename, time.Minute, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dm.groups) != 1 {
+		t.Fatalf("number of groups: %d != 1", len(dm.groups))
+	}
+	for _, group := range dm.groups {
+		if _, ok := group.permitted[machine.Hostname]; !ok {
+			t.Fatalf("%s not permitted after restore", machine.Hostname)
+		}
+		restored := group.getMachine(machine.Hostname)
+		if restored.Tags[tagPostDisruptionHook] != "true" {
+			t.Fatalf("post-disruption hook not restored: %v", restored)
+		}
+	}
+}
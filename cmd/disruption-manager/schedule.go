@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+)
+
+const (
+	tagBlackouts          = "DisruptionManagerBlackouts"
+	tagMaintenanceWindows = "DisruptionManagerMaintenanceWindows"
+	tagTimezone           = "DisruptionManagerTimezone"
+
+	dateFormat       = "2006-01-02"
+	maxLookaheadDays = 400
+	minutesPerDay    = 24 * 60
+)
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// scheduleConfigType is the configuration of the maintenance windows and
+// blackout periods for a group. Windows and blackouts use the same syntax as
+// the MDB tags.
+type scheduleConfigType struct {
+	Blackouts []string `json:",omitempty"`
+	Timezone  string   `json:",omitempty"`
+	Windows   []string `json:",omitempty"`
+}
+
+type schedulesConfigType struct {
+	Groups map[string]scheduleConfigType // Key: group identifier.
+}
+
+type blackoutType struct {
+	start time.Time
+	end   time.Time // Exclusive.
+}
+
+type scheduleType struct {
+	blackouts []blackoutType
+	location  *time.Location
+	windows   []windowType
+}
+
+type windowType struct {
+	days  [7]bool
+	start int // Minutes after midnight.
+	end   int // Minutes after midnight, may be on the next day.
+}
+
+func decodeSchedules(reader io.Reader) (interface{}, error) {
+	var config schedulesConfigType
+	if err := json.Read(reader, &config); err != nil {
+		return nil, err
+	}
+	schedules := make(map[string]*scheduleType, len(config.Groups))
+	for groupIdentifier, groupConfig := range config.Groups {
+		schedule, err := newSchedule(groupConfig.Windows, groupConfig.Blackouts,
+			groupConfig.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s",
+				makeGroupText(groupIdentifier), err)
+		}
+		schedules[groupIdentifier] = schedule
+	}
+	return schedules, nil
+}
+
+// makeScheduleFromTags returns the schedule specified by the MDB tags, or nil
+// if none is specified.
+func makeScheduleFromTags(tgs tags.Tags) (*scheduleType, error) {
+	windows := splitList(tgs[tagMaintenanceWindows])
+	blackouts := splitList(tgs[tagBlackouts])
+	if len(windows) < 1 && len(blackouts) < 1 {
+		return nil, nil
+	}
+	return newSchedule(windows, blackouts, tgs[tagTimezone])
+}
+
+func newSchedule(windows, blackouts []string,
+	timezone string) (*scheduleType, error) {
+	schedule := &scheduleType{location: time.Local}
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, err
+		}
+		schedule.location = location
+	}
+	for _, value := range windows {
+		window, err := parseWindow(value)
+		if err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	if len(schedule.windows) < 1 {
+		window := windowType{end: minutesPerDay}
+		for day := range window.days {
+			window.days[day] = true
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	for _, value := range blackouts {
+		blackout, err := parseBlackout(value, schedule.location)
+		if err != nil {
+			return nil, err
+		}
+		schedule.blackouts = append(schedule.blackouts, blackout)
+	}
+	return schedule, nil
+}
+
+// parseBlackout parses a date or an inclusive range of dates, such as
+// 2025-12-20/2026-01-04.
+func parseBlackout(value string,
+	location *time.Location) (blackoutType, error) {
+	startDate, endDate := value, value
+	if index := strings.IndexByte(value, '/'); index >= 0 {
+		startDate, endDate = value[:index], value[index+1:]
+	}
+	start, err := time.ParseInLocation(dateFormat, startDate, location)
+	if err != nil {
+		return blackoutType{}, err
+	}
+	end, err := time.ParseInLocation(dateFormat, endDate, location)
+	if err != nil {
+		return blackoutType{}, err
+	}
+	end = end.AddDate(0, 0, 1)
+	if !end.After(start) {
+		return blackoutType{}, errors.New("blackout ends before start: " +
+			value)
+	}
+	return blackoutType{start: start, end: end}, nil
+}
+
+func parseDay(value string) (time.Weekday, error) {
+	if len(value) >= 3 {
+		if day, ok := dayNames[strings.ToLower(value[:3])]; ok {
+			return day, nil
+		}
+	}
+	return 0, errors.New("unknown day: " + value)
+}
+
+// parseDays parses a comma separated list of days or ranges of days, such as
+// Mon-Fri,Sun.
+func parseDays(value string) ([7]bool, error) {
+	var days [7]bool
+	for _, field := range strings.Split(value, ",") {
+		firstDay, lastDay := field, field
+		if index := strings.IndexByte(field, '-'); index >= 0 {
+			firstDay, lastDay = field[:index], field[index+1:]
+		}
+		first, err := parseDay(firstDay)
+		if err != nil {
+			return days, err
+		}
+		last, err := parseDay(lastDay)
+		if err != nil {
+			return days, err
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTime parses a time of day such as 02:30 and returns the number of
+// minutes after midnight.
+func parseTime(value string) (int, error) {
+	index := strings.IndexByte(value, ':')
+	if index < 0 {
+		return 0, errors.New("bad time: " + value)
+	}
+	hours, err := strconv.ParseUint(value[:index], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseUint(value[index+1:], 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	result := int(hours*60 + minutes)
+	if minutes >= 60 || result > minutesPerDay {
+		return 0, errors.New("bad time: " + value)
+	}
+	return result, nil
+}
+
+// parseWindow parses a window such as "Mon-Fri 02:00-05:00". If the days are
+// omitted the window is open every day. A window which ends before it starts
+// ends on the next day.
+func parseWindow(value string) (windowType, error) {
+	var window windowType
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		for day := range window.days {
+			window.days[day] = true
+		}
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return window, err
+		}
+		window.days = days
+		fields = fields[1:]
+	default:
+		return window, errors.New("bad window: " + value)
+	}
+	index := strings.IndexByte(fields[0], '-')
+	if index < 0 {
+		return window, errors.New("bad window: " + value)
+	}
+	var err error
+	if window.start, err = parseTime(fields[0][:index]); err != nil {
+		return window, err
+	}
+	if window.end, err = parseTime(fields[0][index+1:]); err != nil {
+		return window, err
+	}
+	if window.end <= window.start {
+		window.end += minutesPerDay
+	}
+	return window, nil
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// isOpen returns true if disruption is permitted at time t. A nil schedule is
+// always open.
+func (schedule *scheduleType) isOpen(t time.Time) bool {
+	return schedule.nextWindow(t).Equal(t)
+}
+
+// nextWindow returns the earliest time from t when disruption is permitted,
+// which is t if the schedule is open. The zero time is returned if the schedule
+// does not open within the lookahead period.
+func (schedule *scheduleType) nextWindow(t time.Time) time.Time {
+	if schedule == nil {
+		return t
+	}
+	localTime := t.In(schedule.location)
+	year, month, day := localTime.Date()
+	var earliest time.Time
+	// Start from the previous day, since a window may cross midnight.
+	for offset := -1; offset <= maxLookaheadDays; offset++ {
+		dayStart := time.Date(year, month, day+offset, 0, 0, 0, 0,
+			schedule.location)
+		if !earliest.IsZero() && dayStart.After(earliest) {
+			break
+		}
+		for _, window := range schedule.windows {
+			if !window.days[dayStart.Weekday()] {
+				continue
+			}
+			start := time.Date(year, month, day+offset, 0, window.start, 0, 0,
+				schedule.location)
+			end := time.Date(year, month, day+offset, 0, window.end, 0, 0,
+				schedule.location)
+			if start.Before(t) {
+				start = t
+			}
+			start = schedule.skipBlackouts(start)
+			if !start.Before(end) {
+				continue
+			}
+			if earliest.IsZero() || start.Before(earliest) {
+				earliest = start
+			}
+		}
+	}
+	if earliest.IsZero() {
+		return earliest
+	}
+	return earliest.In(t.Location())
+}
+
+// skipBlackouts returns the earliest time from t which is not in a blackout.
+func (schedule *scheduleType) skipBlackouts(t time.Time) time.Time {
+	for moved := true; moved; {
+		moved = false
+		for _, blackout := range schedule.blackouts {
+			if !t.Before(blackout.start) && t.Before(blackout.end) {
+				t = blackout.end
+				moved = true
+			}
+		}
+	}
+	return t
+}
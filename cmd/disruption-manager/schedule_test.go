@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	result, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestScheduleWindows(t *testing.T) {
+	schedule, err := makeScheduleFromTags(tags.Tags{
+		tagMaintenanceWindows: "Mon-Fri 02:00-05:00; Sat 23:00-01:00",
+		tagTimezone:           "UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ now, nextWindow string }{
+		{"2026-10-19T03:00:00Z", "2026-10-19T03:00:00Z"}, // Monday, open.
+		{"2026-10-19T05:00:00Z", "2026-10-20T02:00:00Z"}, // Monday, closed.
+		{"2026-10-23T06:00:00Z", "2026-10-24T23:00:00Z"}, // Friday.
+		{"2026-10-25T00:30:00Z", "2026-10-25T00:30:00Z"}, // Sunday, open.
+		{"2026-10-25T01:00:00Z", "2026-10-26T02:00:00Z"}, // Sunday, closed.
+	}
+	for _, test := range tests {
+		now := mustParseTime(t, test.now)
+		expected := mustParseTime(t, test.nextWindow)
+		if nextWindow := schedule.nextWindow(now); !nextWindow.Equal(expected) {
+			t.Errorf("nextWindow(%s): %s != %s", test.now, nextWindow, expected)
+		}
+	}
+}
+
+func TestScheduleBlackouts(t *testing.T) {
+	schedule, err := makeScheduleFromTags(tags.Tags{
+		tagBlackouts: "2026-12-20/2027-01-03; 2027-01-04",
+		tagTimezone:  "UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := mustParseTime(t, "2026-12-24T12:00:00Z")
+	expected := mustParseTime(t, "2027-01-05T00:00:00Z")
+	if nextWindow := schedule.nextWindow(now); !nextWindow.Equal(expected) {
+		t.Errorf("nextWindow: %s != %s", nextWindow, expected)
+	}
+	if now := expected.Add(time.Hour); !schedule.isOpen(now) {
+		t.Errorf("not open at: %s", now)
+	}
+	var nilSchedule *scheduleType
+	if !nilSchedule.isOpen(now) {
+		t.Error("nil schedule not open")
+	}
+}
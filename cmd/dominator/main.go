@@ -133,6 +133,10 @@ func main() {
 	}
 	herd := herd.NewHerd(fmt.Sprintf("%s:%d", *imageServerHostname,
 		*imageServerPortNum), objectServer, metricsDir, logger)
+	if err := herd.SetStateDirectory(*stateDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot load herd state: %s\n", err)
+		os.Exit(1)
+	}
 	herd.AddHtmlWriter(logger)
 	rpcd.Setup(herd, logger)
 	if err = herd.StartServer(*portNum, true); err != nil {
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+
+	domclient "github.com/Cloud-Foundations/Dominator/dom/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+)
+
+func clearBadImageSubcommand(args []string, logger log.DebugLogger) error {
+	if err := domclient.ClearBadImage(getClient(), args[0]); err != nil {
+		return fmt.Errorf("error clearing bad image: %s", err)
+	}
+	return nil
+}
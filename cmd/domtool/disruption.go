@@ -6,7 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/errors"
 	"github.com/Cloud-Foundations/Dominator/lib/json"
@@ -16,39 +18,54 @@ import (
 	sub_proto "github.com/Cloud-Foundations/Dominator/proto/sub"
 )
 
+// Exit code for errors, distinct from the DisruptionManager exit codes.
+const disruptionErrorExitCode = 3
+
 func disruptionCancelSubcommand(args []string, logger log.DebugLogger) error {
-	err := disruptionOperation(sub_proto.DisruptionRequestCancel, args[0])
-	if err != nil {
-		return fmt.Errorf("error cancelling disruption: %s", err)
-	}
+	disruptionSubcommand(sub_proto.DisruptionRequestCancel, args[0],
+		"cancelling disruption")
 	return nil
 }
 
 func disruptionCheckSubcommand(args []string, logger log.DebugLogger) error {
-	err := disruptionOperation(sub_proto.DisruptionRequestCheck, args[0])
-	if err != nil {
-		return fmt.Errorf("error checking disruption state: %s", err)
-	}
+	disruptionSubcommand(sub_proto.DisruptionRequestCheck, args[0],
+		"checking disruption state")
 	return nil
 }
 
 func disruptionRequestSubcommand(args []string, logger log.DebugLogger) error {
-	err := disruptionOperation(sub_proto.DisruptionRequestRequest, args[0])
+	disruptionSubcommand(sub_proto.DisruptionRequestRequest, args[0],
+		"requesting disruption")
+	return nil
+}
+
+// disruptionSubcommand exits with the DisruptionManager exit code for the
+// disruption state, so that it may be used by a DisruptionManager for subd.
+func disruptionSubcommand(requestType sub_proto.DisruptionRequest,
+	subHostname, action string) {
+	state, nextWindow, err := disruptionOperation(requestType, subHostname)
 	if err != nil {
-		return fmt.Errorf("error requesting disruption: %s", err)
+		fmt.Fprintf(os.Stderr, "error %s: %s\n", action, err)
+		os.Exit(disruptionErrorExitCode)
 	}
-	return nil
+	exitCode, err := state.DisruptionManagerExitCode()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error %s: %s\n", action, err)
+		os.Exit(disruptionErrorExitCode)
+	}
+	sub_proto.WriteDisruptionManagerOutput(os.Stdout, state, nextWindow)
+	os.Exit(exitCode)
 }
 
 func disruptionOperation(requestType sub_proto.DisruptionRequest,
-	subHostname string) error {
+	subHostname string) (sub_proto.DisruptionState, time.Time, error) {
 	machine, err := getMachineMdb(subHostname)
 	if err != nil {
-		return err
+		return 0, time.Time{}, err
 	}
 	parsedUrl, err := url.Parse(*disruptionManagerUrl)
 	if err != nil {
-		return err
+		return 0, time.Time{}, err
 	}
 	switch parsedUrl.Scheme {
 	case "http", "https":
@@ -56,29 +73,29 @@ func disruptionOperation(requestType sub_proto.DisruptionRequest,
 		err := json.WriteWithIndent(data, "    ",
 			dm_proto.DisruptionRequest{MDB: machine, Request: requestType})
 		if err != nil {
-			return err
+			return 0, time.Time{}, err
 		}
 		resp, err := http.Post(*disruptionManagerUrl, "application/json", data)
 		if err != nil {
-			return fmt.Errorf("POST error: %s", err)
+			return 0, time.Time{}, fmt.Errorf("POST error: %s", err)
 		}
 		defer resp.Body.Close()
 		var reply dm_proto.DisruptionResponse
 		if resp.StatusCode != http.StatusOK {
 			body := &strings.Builder{}
 			io.Copy(body, resp.Body)
-			return fmt.Errorf("%s: %s",
+			return 0, time.Time{}, fmt.Errorf("%s: %s",
 				resp.Status, strings.TrimSpace(body.String()))
 		}
 		if err := json.Read(resp.Body, &reply); err != nil {
-			return fmt.Errorf("error decoding response: %s", err)
+			return 0, time.Time{},
+				fmt.Errorf("error decoding response: %s", err)
 		}
-		fmt.Println(reply.Response)
-		return nil
+		return reply.Response, reply.NextWindow, nil
 	case "srpc":
 		client, err := srpc.DialHTTP("tcp", parsedUrl.Host, 0)
 		if err != nil {
-			return fmt.Errorf("error dialing: %s", err)
+			return 0, time.Time{}, fmt.Errorf("error dialing: %s", err)
 		}
 		defer client.Close()
 		switch requestType {
@@ -88,39 +105,40 @@ func disruptionOperation(requestType sub_proto.DisruptionRequest,
 			err := client.RequestReply("DisruptionManager.Cancel",
 				request, &reply)
 			if err != nil {
-				return err
+				return 0, time.Time{}, err
 			}
 			if err := errors.New(reply.Error); err != nil {
-				return err
+				return 0, time.Time{}, err
 			}
-			fmt.Println(reply.Response)
+			return reply.Response, time.Time{}, nil
 		case sub_proto.DisruptionRequestCheck:
 			request := dm_proto.DisruptionCheckRequest{MDB: machine}
 			var reply dm_proto.DisruptionCheckResponse
 			err := client.RequestReply("DisruptionManager.Check",
 				request, &reply)
 			if err != nil {
-				return err
+				return 0, time.Time{}, err
 			}
 			if err := errors.New(reply.Error); err != nil {
-				return err
+				return 0, time.Time{}, err
 			}
-			fmt.Println(reply.Response)
+			return reply.Response, reply.NextWindow, nil
 		case sub_proto.DisruptionRequestRequest:
 			request := dm_proto.DisruptionRequestRequest{MDB: machine}
 			var reply dm_proto.DisruptionRequestResponse
 			err := client.RequestReply("DisruptionManager.Request",
 				request, &reply)
 			if err != nil {
-				return err
+				return 0, time.Time{}, err
 			}
 			if err := errors.New(reply.Error); err != nil {
-				return err
+				return 0, time.Time{}, err
 			}
-			fmt.Println(reply.Response)
+			return reply.Response, reply.NextWindow, nil
 		}
-	default:
-		return fmt.Errorf("unsupported scheme: %s", *disruptionManagerUrl)
+		return 0, time.Time{},
+			fmt.Errorf("unsupported request: %s", requestType)
 	}
-	return nil
+	return 0, time.Time{},
+		fmt.Errorf("unsupported scheme: %s", *disruptionManagerUrl)
 }
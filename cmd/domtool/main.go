@@ -17,7 +17,8 @@ import (
 )
 
 var (
-	cpuPercent = flag.Uint("cpuPercent", 0,
+	canaryHosts flagutil.StringList
+	cpuPercent  = flag.Uint("cpuPercent", 0,
 		"CPU speed as percentage of capacity (default 50)")
 	disableSafetyCheck = flag.Bool("disableSafetyCheck", false,
 		"If true, disable the safety check during a fast-update")
@@ -31,6 +32,8 @@ var (
 		"If true, fail a fast-update if it would reboot the sub")
 	forceDisruptiveUpdate = flag.Bool("forceDisruptiveUpdate", false,
 		"If true, force a disruptive update during a fast-update")
+	imageName = flag.String("image", "",
+		"Image to plan an update to (default RequiredImage for each sub)")
 	locationsToMatch  flagutil.StringList
 	mdbServerHostname = flag.String("mdbServerHostname", "",
 		"Hostname of MDB server (default same as domHostname)")
@@ -54,11 +57,16 @@ var (
 		"Timeout for long operations")
 	usePlannedImage = flag.Bool("usePlannedImage", false,
 		"If true, use the PlannedImage during a fast-update")
+	wavePause = flag.Duration("wavePause", time.Hour,
+		"Time to pause between rollout waves")
+	wavePercentages flagutil.UintList
 
 	dominatorSrpcClient *srpc.Client
 )
 
 func init() {
+	flag.Var(&canaryHosts, "canaryHosts",
+		"Comma separated list of subs to update first in a rollout")
 	flag.Var(&locationsToMatch, "locationsToMatch",
 		"Sub locations to match when listing")
 	flag.Var(&scanExcludeList, "scanExcludeList",
@@ -66,6 +74,8 @@ func init() {
 	flag.Var(&statusesToMatch, "statusesToMatch",
 		"Sub statuses to match when listing")
 	flag.Var(&tagsToMatch, "tagsToMatch", "Tags to match when listing")
+	flag.Var(&wavePercentages, "wavePercentages",
+		"Cumulative percentages of subs to admit in each rollout wave")
 }
 
 func printUsage() {
@@ -78,6 +88,8 @@ func printUsage() {
 }
 
 var subcommands = []commands.Command{
+	{"abort-rollout", "image", 1, 1, abortRolloutSubcommand},
+	{"clear-bad-image", "image", 1, 1, clearBadImageSubcommand},
 	{"clear-safety-shutoff", "sub", 1, 1, clearSafetyShutoffSubcommand},
 	{"configure-subs", "", 0, 0, configureSubsSubcommand},
 	{"disable-updates", "reason", 1, 1, disableUpdatesSubcommand},
@@ -93,10 +105,15 @@ var subcommands = []commands.Command{
 	{"get-mdb", "", 0, 0, getMdbSubcommand},
 	{"get-mdb-updates", "", 0, 0, getMdbUpdatesSubcommand},
 	{"get-subs-configuration", "", 0, 0, getSubsConfigurationSubcommand},
+	{"list-rollouts", "", 0, 0, listRolloutsSubcommand},
 	{"list-subs", "", 0, 0, listSubsSubcommand},
+	{"pause-rollout", "image", 1, 1, pauseRolloutSubcommand},
 	{"pause-sub-updates", "sub reason", 2, 2, pauseSubUpdatesSubcommand},
+	{"plan-update", "[sub...]", 0, -1, planUpdateSubcommand},
+	{"resume-rollout", "image", 1, 1, resumeRolloutSubcommand},
 	{"resume-sub-updates", "sub", 1, 1, resumeSubUpdatesSubcommand},
 	{"set-default-image", "", 1, 1, setDefaultImageSubcommand},
+	{"start-rollout", "from-image to-image", 2, 2, startRolloutSubcommand},
 }
 
 func getClient() *srpc.Client {
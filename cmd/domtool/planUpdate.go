@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	domclient "github.com/Cloud-Foundations/Dominator/dom/client"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func planUpdateSubcommand(args []string, logger log.DebugLogger) error {
+	if err := planUpdate(getClient(), args); err != nil {
+		return fmt.Errorf("error planning update: %s", err)
+	}
+	return nil
+}
+
+func planUpdate(client *srpc.Client, hostnames []string) error {
+	fileHostnames, err := getSubsFromFile()
+	if err != nil {
+		return err
+	}
+	hostnames = append(hostnames, fileHostnames...)
+	request := dominator.PlanUpdateRequest{
+		Hostnames:        hostnames,
+		ImageName:        *imageName,
+		LocationsToMatch: locationsToMatch,
+		StatusesToMatch:  statusesToMatch,
+		TagsToMatch:      tagsToMatch,
+	}
+	plans, err := domclient.PlanUpdate(client, request)
+	if err != nil {
+		return err
+	}
+	json.WriteWithIndent(os.Stdout, "    ", plans)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	domclient "github.com/Cloud-Foundations/Dominator/dom/client"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func abortRolloutSubcommand(args []string, logger log.DebugLogger) error {
+	if err := domclient.AbortRollout(getClient(), args[0]); err != nil {
+		return fmt.Errorf("error aborting rollout: %s", err)
+	}
+	return nil
+}
+
+func listRolloutsSubcommand(args []string, logger log.DebugLogger) error {
+	rollouts, err := domclient.ListRollouts(getClient())
+	if err != nil {
+		return fmt.Errorf("error listing rollouts: %s", err)
+	}
+	json.WriteWithIndent(os.Stdout, "    ", rollouts)
+	return nil
+}
+
+func pauseRolloutSubcommand(args []string, logger log.DebugLogger) error {
+	if err := domclient.PauseRollout(getClient(), args[0]); err != nil {
+		return fmt.Errorf("error pausing rollout: %s", err)
+	}
+	return nil
+}
+
+func resumeRolloutSubcommand(args []string, logger log.DebugLogger) error {
+	if err := domclient.ResumeRollout(getClient(), args[0]); err != nil {
+		return fmt.Errorf("error resuming rollout: %s", err)
+	}
+	return nil
+}
+
+func startRolloutSubcommand(args []string, logger log.DebugLogger) error {
+	policy := dominator.RolloutPolicy{
+		CanaryHosts:     canaryHosts,
+		FromImage:       args[0],
+		ToImage:         args[1],
+		WavePause:       *wavePause,
+		WavePercentages: wavePercentages,
+	}
+	if err := domclient.StartRollout(getClient(), policy); err != nil {
+		return fmt.Errorf("error starting rollout: %s", err)
+	}
+	return nil
+}
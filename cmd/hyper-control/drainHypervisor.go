@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	fmclient "github.com/Cloud-Foundations/Dominator/fleetmanager/client"
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func drainHypervisorSubcommand(args []string, logger log.DebugLogger) error {
+	err := drainHypervisor(logger)
+	if err != nil {
+		return fmt.Errorf("error draining Hypervisor: %s", err)
+	}
+	return nil
+}
+
+func drainHypervisor(logger log.DebugLogger) error {
+	if *hypervisorHostname == "" {
+		return errors.New("hypervisorHostname no specified")
+	}
+	client, err := dialFleetManager()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	request := proto.DrainHypervisorRequest{
+		Hostname:                *hypervisorHostname,
+		Live:                    *liveMigration,
+		Location:                *location,
+		MaxConcurrentMigrations: *maxConcurrentMigrations,
+		MigrateProtectedVMs:     *migrateProtectedVMs,
+		Timeout:                 *drainTimeout,
+	}
+	return fmclient.DrainHypervisor(client, request, logger)
+}
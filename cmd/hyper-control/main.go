@@ -23,6 +23,8 @@ import (
 var (
 	connectTimeout = flag.Duration("connectTimeout", 15*time.Second,
 		"connection timeout")
+	drainTimeout = flag.Duration("drainTimeout", 24*time.Hour,
+		"Time after which an incomplete drain is abandoned")
 	externalLeaseHostnames flagutil.StringList
 	externalLeaseAddresses proto.AddressList
 	emailBodyFilename      = flag.String("emailBodyFilename", "",
@@ -54,10 +56,16 @@ var (
 		"Name of default image stream for building bootable installer ISO")
 	installerPortNum = flag.Uint("installerPortNum",
 		constants.InstallerPortNumber, "Port number of installer")
+	liveMigration = flag.Bool("liveMigration", false,
+		"If true, try live migration when draining")
 	location = flag.String("location", "",
 		"Location to search for hypervisors")
 	lockTimeout = flag.Duration("lockTimeout", 15*time.Second,
 		"Time to hold the lock")
+	maxConcurrentMigrations = flag.Uint("maxConcurrentMigrations", 1,
+		"Maximum number of concurrent VM migrations when draining")
+	migrateProtectedVMs = flag.Bool("migrateProtectedVMs", false,
+		"If true, migrate VMs with DestroyProtection when draining")
 	offerTimeout = flag.Duration("offerTimeout", time.Minute+time.Second,
 		"How long to offer DHCP OFFERs and ACKs")
 	maxUpdates = flag.Uint64("maxUpdates", 0,
@@ -120,6 +128,7 @@ var subcommands = []commands.Command{
 	{"change-tags", "", 0, 0, changeTagsSubcommand},
 	{"connect-to-vm-manager", "IPaddr", 1, 1, connectToVmManagerSubcommand},
 	{"disable-hypervisor", "", 0, 0, disableHypervisorSubcommand},
+	{"drain-hypervisor", "", 0, 0, drainHypervisorSubcommand},
 	{"enable-hypervisor", "", 0, 0, enableHypervisorSubcommand},
 	{"get-capacity", "", 0, 0, getCapacitySubcommand},
 	{"get-identity-provider", "", 0, 0, getIdentityProviderSubcommand},
@@ -31,6 +31,9 @@ func checkVms(repair bool) error {
 			return err
 		}
 		for index, volume := range vmInfo.VolumeLocations {
+			if volume.BackingFile != "" {
+				continue // Layered volumes are thin by design.
+			}
 			var statbuf wsyscall.Stat_t
 			if err := wsyscall.Stat(volume.Filename, &statbuf); err != nil {
 				return err
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"os"
@@ -20,6 +21,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/flags/commands"
 	"github.com/Cloud-Foundations/Dominator/lib/flags/loadflags"
 	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/log/serverlogger"
 	"github.com/Cloud-Foundations/Dominator/lib/net"
@@ -70,6 +72,9 @@ var (
 		"test if memory is allocatable and exit (units of MiB)")
 	tftpbootImageStream = flag.String("tftpbootImageStream", "",
 		"Name of default image stream for network booting")
+	trustedImageSignersFile = flag.String("trustedImageSignersFile", "",
+		"Name of file containing PEM encoded certificates of trusted image "+
+			"signers. If specified, VMs may only be created from signed images")
 	username = flag.String("username", "nobody",
 		"Name of user to run VMs")
 	volumeDirectories flagutil.StringList
@@ -205,6 +210,14 @@ func run() {
 	if err != nil {
 		logger.Fatalf("Cannot start tftpboot server: %s\n", err)
 	}
+	var trustedImageSigners *x509.CertPool
+	if *trustedImageSignersFile != "" {
+		trustedImageSigners, err = image.LoadTrustedSigners(
+			*trustedImageSignersFile)
+		if err != nil {
+			logger.Fatalf("Cannot load trusted image signers: %s\n", err)
+		}
+	}
 	managerObj, err := manager.New(manager.StartOptions{
 		BridgeMap:            bridgeMap,
 		DhcpServer:           dhcpServer,
@@ -217,6 +230,7 @@ func run() {
 		ObjectCacheBytes:     uint64(objectCacheSize),
 		ShowVgaConsole:       *showVGA,
 		StateDir:             *stateDir,
+		TrustedImageSigners:  trustedImageSigners,
 		Username:             *username,
 		VlanIdToBridge:       vlanIdToBridge,
 		VolumeDirectories:    volumeDirectories,
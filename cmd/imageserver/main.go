@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -11,8 +12,12 @@ import (
 	"github.com/Cloud-Foundations/Dominator/imageserver/scanner"
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/flags/loadflags"
+	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/log/serverlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/s3"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc/setupserver"
 	objectserverRpcd "github.com/Cloud-Foundations/Dominator/objectserver/rpcd"
@@ -28,11 +33,14 @@ var (
 		"If true, allow all users to call CheckObjects method")
 	allowPublicGetObjects = flag.Bool("allowPublicGetObjects", false,
 		"If true, allow all users to call GetObjects method")
+	compressGetObjects = flag.Bool("compressGetObjects", false,
+		"If true, compress objects on the fly for GetObjects clients")
 	debug    = flag.Bool("debug", false, "If true, show debugging output")
 	imageDir = flag.String("imageDir", "/var/lib/imageserver",
 		"Name of image server data directory.")
 	imageServerHostname = flag.String("imageServerHostname", "",
 		"Hostname of image server to receive updates from")
+	imageServerPeers   flagutil.StringList
 	imageServerPortNum = flag.Uint("imageServerPortNum",
 		constants.ImageServerPortNumber,
 		"Port number of image server")
@@ -46,14 +54,47 @@ var (
 	maximumExpirationDurationPrivileged = flag.Duration(
 		"maximumExpirationDurationPrivileged", 730*time.Hour,
 		"Maximum expiration time for privileged users")
-	objectDir = flag.String("objectDir", "/var/lib/objectserver",
-		"Name of image server data directory.")
+	objectCacheSize   = flagutil.Size(1 << 30)
+	objectCompression = flag.String("objectCompression", "",
+		"Compression method for new objects (gzip, zstd or none)")
+	objectCompressionMaximumRatio = flag.Float64(
+		"objectCompressionMaximumRatio", 0.9,
+		"Store objects raw if compressed/uncompressed size is above this")
+	objectCompressionMinimumSize = flagutil.Size(4 << 10)
+	objectDir                    = flag.String("objectDir",
+		"/var/lib/objectserver", "Name of image server data directory.")
+	objectS3Bucket = flag.String("objectS3Bucket", "",
+		"If specified, store objects in this S3 bucket and cache in objectDir")
+	objectS3Endpoint = flag.String("objectS3Endpoint", "",
+		"Optional endpoint URL for an S3-compatible object store")
+	objectS3ForcePathStyle = flag.Bool("objectS3ForcePathStyle", false,
+		"If true, use path-style S3 URLs (needed by some S3-compatible stores)")
+	objectS3Prefix = flag.String("objectS3Prefix", "",
+		"Optional key prefix for objects in the S3 bucket")
+	objectS3Region = flag.String("objectS3Region", "",
+		"Optional region for the S3 bucket")
 	permitInsecureMode = flag.Bool("permitInsecureMode", false,
 		"If true, run in insecure mode. This gives remote access to all")
 	portNum = flag.Uint("portNum", constants.ImageServerPortNumber,
 		"Port number to allocate and listen on for HTTP/RPC")
 )
 
+type objectServer interface {
+	objectserver.FullObjectServer
+	objectserver.StashingObjectServer
+	WriteHtml(writer io.Writer)
+}
+
+func init() {
+	flag.Var(&imageServerPeers, "imageServerPeers",
+		"Comma separated list of peer image servers (hostname:port) to "+
+			"replicate with. This server may be included")
+	flag.Var(&objectCacheSize, "objectCacheSize",
+		"Maximum size of the local object cache when using S3")
+	flag.Var(&objectCompressionMinimumSize, "objectCompressionMinimumSize",
+		"Store objects smaller than this raw")
+}
+
 func main() {
 	if os.Geteuid() == 0 {
 		fmt.Fprintln(os.Stderr, "Do not run the Image Server as root")
@@ -74,15 +115,7 @@ func main() {
 	if err := setupserver.SetupTlsWithParams(params); err != nil {
 		logger.Fatalln(err)
 	}
-	objSrv, err := filesystem.NewObjectServerWithConfigAndParams(
-		filesystem.Config{
-			BaseDirectory:     *objectDir,
-			LockCheckInterval: *lockCheckInterval,
-			LockLogTimeout:    *lockLogTimeout,
-		},
-		filesystem.Params{
-			Logger: logger,
-		})
+	objSrv, err := newObjectServer(logger)
 	if err != nil {
 		logger.Fatalf("Cannot create ObjectServer: %s\n", err)
 	}
@@ -99,6 +132,7 @@ func main() {
 			MaximumExpirationDuration:           *maximumExpirationDuration,
 			MaximumExpirationDurationPrivileged: *maximumExpirationDurationPrivileged,
 			ReplicationMaster:                   imageServerAddress,
+			ReplicationPeers:                    imageServerPeers,
 		},
 		scanner.Params{
 			Logger:       logger,
@@ -110,8 +144,17 @@ func main() {
 	tricorder.RegisterMetric("/image-count",
 		func() uint { return imdb.CountImages() },
 		units.None, "number of images")
-	imgSrvRpcHtmlWriter, err := imageserverRpcd.Setup(imdb, imageServerAddress,
-		objSrv, logger)
+	imgSrvRpcHtmlWriter, err := imageserverRpcd.SetupWithConfigAndParams(
+		imageserverRpcd.Config{
+			ReplicationMaster: imageServerAddress,
+			ReplicationPeers:  imageServerPeers,
+			ReplicationSelf:   getSelfAddress(),
+		},
+		imageserverRpcd.Params{
+			ImageDataBase: imdb,
+			Logger:        logger,
+			ObjectServer:  objSrv,
+		})
 	if err != nil {
 		logger.Fatalln(err)
 	}
@@ -120,6 +163,7 @@ func main() {
 			AllowPublicAddObjects:   *allowPublicAddObjects,
 			AllowPublicCheckObjects: *allowPublicCheckObjects,
 			AllowPublicGetObjects:   *allowPublicGetObjects,
+			CompressGetObjects:      *compressGetObjects,
 			ReplicationMaster:       imageServerAddress,
 		},
 		objectserverRpcd.Params{
@@ -137,3 +181,45 @@ func main() {
 		logger.Fatalf("Unable to create http server: %s\n", err)
 	}
 }
+
+func getSelfAddress() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", hostname, *portNum)
+}
+
+func newObjectServer(logger log.DebugLogger) (objectServer, error) {
+	if *objectS3Bucket != "" {
+		return s3.New(
+			s3.Config{
+				Bucket:             *objectS3Bucket,
+				CacheDirectory:     *objectDir,
+				Endpoint:           *objectS3Endpoint,
+				ForcePathStyle:     *objectS3ForcePathStyle,
+				LockCheckInterval:  *lockCheckInterval,
+				LockLogTimeout:     *lockLogTimeout,
+				MaximumCachedBytes: uint64(objectCacheSize),
+				Prefix:             *objectS3Prefix,
+				Region:             *objectS3Region,
+			},
+			s3.Params{
+				Logger: logger,
+			})
+	}
+	return filesystem.NewObjectServerWithConfigAndParams(
+		filesystem.Config{
+			BaseDirectory: *objectDir,
+			Compression: filesystem.CompressionConfig{
+				Method:       *objectCompression,
+				MaximumRatio: *objectCompressionMaximumRatio,
+				MinimumSize:  uint64(objectCompressionMinimumSize),
+			},
+			LockCheckInterval: *lockCheckInterval,
+			LockLogTimeout:    *lockLogTimeout,
+		},
+		filesystem.Params{
+			Logger: logger,
+		})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	"github.com/Cloud-Foundations/Dominator/lib/oci"
+)
+
+func exportOciSubcommand(args []string, logger log.DebugLogger) error {
+	objectsGetter := getObjectsGetter(logger)
+	if err := exportOci(objectsGetter, args[0], args[1]); err != nil {
+		return fmt.Errorf("error exporting OCI image: %s", err)
+	}
+	return nil
+}
+
+func exportOci(objectsGetter objectserver.ObjectsGetter, imageName,
+	destination string) error {
+	fs, objectsGetter, name, err := getImageForUnpack(objectsGetter, imageName)
+	if err != nil {
+		return err
+	}
+	reference := *ociReference
+	if reference == "" {
+		reference = name
+	}
+	return oci.Write(destination, fs, objectsGetter,
+		oci.WriteOptions{Reference: reference})
+}
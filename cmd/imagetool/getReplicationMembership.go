@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func getReplicationMembershipSubcommand(args []string,
+	logger log.DebugLogger) error {
+	imageSClient, _ := getClients()
+	if err := getReplicationMembership(imageSClient); err != nil {
+		return fmt.Errorf("error getting replication membership: %s", err)
+	}
+	return nil
+}
+
+func getReplicationMembership(imageSClient *srpc.Client) error {
+	membership, err := client.GetReplicationMembership(imageSClient)
+	if err != nil {
+		return err
+	}
+	for _, member := range membership.Members {
+		var attributes []string
+		if member.Self {
+			attributes = append(attributes, "self")
+		}
+		if member.Address == membership.Master {
+			attributes = append(attributes, "master")
+		}
+		if member.Writable {
+			attributes = append(attributes, "writable")
+		}
+		if member.Connected {
+			attributes = append(attributes, "connected")
+		}
+		address := member.Address
+		if address == "" {
+			address = "(unknown)"
+		}
+		fmt.Printf("%s %s\n", address, strings.Join(attributes, ","))
+	}
+	return nil
+}
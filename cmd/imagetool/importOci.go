@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	objectclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/oci"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func importOciSubcommand(args []string, logger log.DebugLogger) error {
+	imageSClient, objectClient := getClients()
+	var filterFilename, triggersFilename string
+	if len(args) > 2 {
+		filterFilename = args[2]
+	}
+	if len(args) > 3 {
+		triggersFilename = args[3]
+	}
+	err := importOci(imageSClient, objectClient, args[0], args[1],
+		filterFilename, triggersFilename, logger)
+	if err != nil {
+		return fmt.Errorf("error importing OCI image: \"%s\": %s", args[1], err)
+	}
+	return nil
+}
+
+func importOci(imageSClient *srpc.Client,
+	objectClient *objectclient.ObjectClient,
+	source, name, filterFilename, triggersFilename string,
+	logger log.DebugLogger) error {
+	imageExists, err := client.CheckImage(imageSClient, name)
+	if err != nil {
+		return errors.New("error checking for image existence: " + err.Error())
+	}
+	if imageExists {
+		return errors.New("image exists")
+	}
+	newImage := new(image.Image)
+	if err := loadImageFiles(newImage, objectClient, filterFilename,
+		triggersFilename); err != nil {
+		return err
+	}
+	ociImage, err := oci.Open(source, oci.OpenOptions{
+		Platform:  *ociPlatform,
+		Reference: *ociReference,
+	})
+	if err != nil {
+		return err
+	}
+	defer ociImage.Close()
+	var h hasher
+	h.objQ, err = objectclient.NewObjectAdderQueue(imageSClient)
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	newImage.FileSystem, err = ociImage.Decode(&h, newImage.Filter)
+	if err != nil {
+		h.objQ.Close()
+		return errors.New("error decoding layers: " + err.Error())
+	}
+	if err := h.objQ.Close(); err != nil {
+		return err
+	}
+	fs := newImage.FileSystem
+	logger.Debugf(0, "Flattened %d layers and uploaded %d objects (%s) in %s\n",
+		len(ociImage.Manifest.Layers), fs.NumRegularInodes,
+		format.FormatBytes(fs.TotalDataBytes),
+		format.Duration(time.Since(startTime)))
+	if err := spliceComputedFiles(fs); err != nil {
+		return err
+	}
+	if err := copyMtimes(imageSClient, newImage, *copyMtimesFrom); err != nil {
+		return err
+	}
+	return addImage(imageSClient, name, newImage, logger)
+}
@@ -84,7 +84,11 @@ var (
 		"Interval between object uploads (for debugging)")
 	objectCacheDirectory = flag.String("objectCacheDirectory", "",
 		"Directory to store object cache")
-	objectCacheSize  = flagutil.Size(10 << 30)
+	objectCacheSize = flagutil.Size(10 << 30)
+	ociPlatform     = flag.String("ociPlatform", "",
+		"Platform (os/architecture) to select when importing OCI images")
+	ociReference = flag.String("ociReference", "",
+		"Reference (tag) to select when importing or to set when exporting OCI images")
 	overlayDirectory = flag.String("overlayDirectory", "",
 		"Directory tree of files to overlay on top of the image when making raw image")
 	releaseNotes = flag.String("releaseNotes", "",
@@ -186,6 +190,7 @@ var subcommands = []commands.Command{
 	{"diff-triggers", "          tool left right", 3, 3,
 		diffTriggersInImagesSubcommand},
 	{"estimate-usage", "         name", 1, 1, estimateImageUsageSubcommand},
+	{"export-oci", "             name layout", 2, 2, exportOciSubcommand},
 	{"find-latest-image", "      directory", 1, 1, findLatestImageSubcommand},
 	{"get", "                    name directory", 2, 2, getImageSubcommand},
 	{"get-archive-data", "       name outfile", 2, 2,
@@ -199,6 +204,10 @@ var subcommands = []commands.Command{
 	{"get-package-list", "       name [outfile]", 1, 2,
 		getImagePackageListSubcommand},
 	{"get-replication-master", "", 0, 0, getReplicationMasterSubcommand},
+	{"get-replication-membership", "", 0, 0,
+		getReplicationMembershipSubcommand},
+	{"import-oci", "             layout name [filterfile [triggerfile]]", 2, 4,
+		importOciSubcommand},
 	{"list", "", 0, 0, listImagesSubcommand},
 	{"list-mdb", "", 0, 0, listMdbImagesSubcommand},
 	{"list-not-in-mdb", "", 0, 0, listImagesNotInMdbSubcommand},
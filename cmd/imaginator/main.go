@@ -38,6 +38,10 @@ var (
 	imageServerPortNum = flag.Uint("imageServerPortNum",
 		constants.ImageServerPortNumber,
 		"Port number of image server")
+	imageSigningCertFile = flag.String("imageSigningCertFile", "",
+		"Name of file containing the certificate used to sign images")
+	imageSigningKeyFile = flag.String("imageSigningKeyFile", "",
+		"Name of file containing the key used to sign images")
 	imageRebuildInterval = flag.Duration("imageRebuildInterval", time.Hour,
 		"time between automatic rebuilds of images")
 	maximumBuildDuration = flag.Duration("maximumBuildDuration", 24*time.Hour,
@@ -123,6 +127,8 @@ func main() {
 			ImageRebuildInterval: *imageRebuildInterval,
 			ImageServerAddress: fmt.Sprintf("%s:%d",
 				*imageServerHostname, *imageServerPortNum),
+			ImageSigningCertFile:                *imageSigningCertFile,
+			ImageSigningKeyFile:                 *imageSigningKeyFile,
 			MaximumExpirationDuration:           *maximumExpirationDuration,
 			MaximumExpirationDurationPrivileged: *maximumExpirationDurationPrivileged,
 			MaximumBuildDuration:                *maximumBuildDuration,
@@ -40,6 +40,7 @@ type dhcpResponse struct {
 var (
 	tftpFiles = map[string]bool{ // If true, file is required.
 		"config.json":         true,
+		"encryption-key":      false,
 		"imagename":           true,
 		"imageserver":         true,
 		"storage-layout.json": true,
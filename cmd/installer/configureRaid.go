@@ -0,0 +1,134 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	installer_proto "github.com/Cloud-Foundations/Dominator/proto/installer"
+)
+
+const mdDirectory = "/dev/md"
+
+type raidArrayType struct {
+	devpath  string
+	level    installer_proto.RaidLevel
+	members  []string
+	metadata string
+	name     string
+}
+
+// assembleRaidArrays will attempt to assemble existing RAID arrays for the
+// boot drive layout. Failures are logged and ignored.
+func assembleRaidArrays(drives []*driveType,
+	layout installer_proto.StorageLayout, logger log.DebugLogger) {
+	for _, array := range makeRaidArrays(drives, layout) {
+		if array.exists() {
+			continue
+		}
+		args := append([]string{"--assemble", array.devpath}, array.members...)
+		if err := run("mdadm", *tmpRoot, logger, args...); err != nil {
+			logger.Printf("unable to assemble %s: %s\n", array.devpath, err)
+		}
+	}
+}
+
+// getNumRaidDrives returns the number of drives which should be configured
+// with the boot drive layout.
+func getNumRaidDrives(layout installer_proto.StorageLayout,
+	numDrives int) int {
+	if layout.RaidLevel == installer_proto.RaidLevelNone {
+		return 1
+	}
+	if layout.NumRaidDrives < 1 {
+		return numDrives
+	}
+	return int(layout.NumRaidDrives)
+}
+
+// makeRaidArrays returns the RAID arrays for the partitions in the boot drive
+// layout, one array per partition, with a member on each drive. The EFI system
+// and /boot partitions are always RAID1. RAID1 arrays have the superblock at
+// the end so that the firmware, bootloader and installer can read a member as
+// a plain partition.
+func makeRaidArrays(drives []*driveType,
+	layout installer_proto.StorageLayout) []raidArrayType {
+	arrays := make([]raidArrayType, 0, len(layout.BootDriveLayout))
+	for index, partition := range layout.BootDriveLayout {
+		array := raidArrayType{
+			level:    layout.RaidLevel,
+			metadata: "1.2",
+			name:     raidArrayName(partition.FileSystemLabel),
+		}
+		switch partition.MountPoint {
+		case bootMountPoint, efiMountPoint:
+			array.level = installer_proto.RaidLevel1
+		}
+		if array.level == installer_proto.RaidLevel1 {
+			array.metadata = "1.0"
+		}
+		array.devpath = filepath.Join(mdDirectory, array.name)
+		for _, drive := range drives {
+			array.members = append(array.members,
+				partitionName(drive.devpath, index+1))
+		}
+		arrays = append(arrays, array)
+	}
+	return arrays
+}
+
+func raidArrayName(label string) string {
+	return strings.ReplaceAll(strings.Trim(label, "/"), "/", "-")
+}
+
+// stopRaidArrays will stop all RAID arrays so that the drives may be
+// repartitioned. Failures are ignored.
+func stopRaidArrays(logger log.DebugLogger) {
+	run("mdadm", *tmpRoot, logger, "--stop", "--scan")
+}
+
+// writeMdadmConf will write the mdadm configuration file for the new OS so
+// that the arrays are assembled with the same names at boot.
+func writeMdadmConf(logger log.DebugLogger) error {
+	output, err := runOutput("mdadm", *tmpRoot, logger, "--detail", "--scan")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(*mountPoint, "etc", "mdadm.conf")
+	dirname := filepath.Join(*mountPoint, "etc", "mdadm")
+	if fi, err := os.Stat(dirname); err == nil && fi.IsDir() {
+		filename = filepath.Join(dirname, "mdadm.conf")
+	}
+	logger.Printf("Writing %s:\n%s", filename, output)
+	return os.WriteFile(filename, []byte(output), fsutil.PublicFilePerms)
+}
+
+func (array raidArrayType) create(logger log.DebugLogger) error {
+	for _, member := range array.members {
+		run("mdadm", *tmpRoot, logger, "--zero-superblock", member)
+	}
+	args := []string{"--create", array.devpath, "--run",
+		"--level=" + strconv.FormatUint(uint64(array.level), 10),
+		"--metadata=" + array.metadata,
+		"--name=" + array.name,
+		"--raid-devices=" + strconv.Itoa(len(array.members)),
+	}
+	if err := run("mdadm", *tmpRoot, logger,
+		append(args, array.members...)...); err != nil {
+		return err
+	}
+	logger.Printf("created %s array %s from: %s\n", array.level, array.devpath,
+		strings.Join(array.members, " "))
+	return nil
+}
+
+func (array raidArrayType) exists() bool {
+	_, err := os.Stat(array.devpath)
+	return err == nil
+}
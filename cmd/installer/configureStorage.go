@@ -87,6 +87,33 @@ func checkIsEfi() bool {
 	return false
 }
 
+// checkPreserveBootDrives returns true if data on the boot drives should be
+// preserved, which requires the existing partition tables to match the layout.
+func checkPreserveBootDrives(drives []*driveType,
+	layout installer_proto.StorageLayout, logger log.DebugLogger) (
+	bool, error) {
+	if !layout.PreserveData {
+		return false, nil
+	}
+	var numMatching int
+	for _, drive := range drives {
+		if drive.countPartitions() == len(layout.BootDriveLayout) {
+			numMatching++
+		}
+	}
+	if numMatching == len(drives) {
+		logger.Println("preserving partition tables on boot drives")
+		return true, nil
+	}
+	if numMatching > 0 {
+		return false, fmt.Errorf(
+			"%d/%d boot drives match layout, not destroying data",
+			numMatching, len(drives))
+	}
+	logger.Println("no partition tables match layout, nothing to preserve")
+	return false, nil
+}
+
 func closeEncryptedVolumes(logger log.DebugLogger) error {
 	if file, err := os.Open("/dev/mapper"); err != nil {
 		return err
@@ -109,90 +136,68 @@ func closeEncryptedVolumes(logger log.DebugLogger) error {
 	}
 }
 
-func configureBootDrive(cpuSharer cpusharer.CpuSharer, drive *driveType,
+func configureBootDrives(cpuSharer cpusharer.CpuSharer, drives []*driveType,
 	layout installer_proto.StorageLayout, partitionIndices partitionIndicesType,
 	img *image.Image, objGetter objectserver.ObjectsGetter,
 	bootInfo *util.BootInfoType, logger log.DebugLogger) error {
-	startTime := time.Now()
-	if run("blkdiscard", "", logger, drive.devpath) == nil {
-		drive.discarded = true
-		logger.Printf("discarded %s in %s\n",
-			drive.devpath, format.Duration(time.Since(startTime)))
-	} else { // Erase old partition.
-		if err := eraseStart(drive.devpath, logger); err != nil {
-			return err
-		}
-	}
-	isEfi := checkIsEfi()
-	args := []string{"-s", "-a", "optimal", drive.devpath}
-	if isEfi {
-		args = append(args, "mklabel", "gpt")
-	} else {
-		args = append(args, "mklabel", "msdos")
+	preserve, err := checkPreserveBootDrives(drives, layout, logger)
+	if err != nil {
+		return err
 	}
-	unitSize := uint64(1 << 20)
-	unitSuffix := "MiB"
-	offsetInUnits := uint64(1)
-	for _, partition := range layout.BootDriveLayout {
-		minimumSize := partition.MinimumFreeBytes
-		if partition.MinimumBytes > minimumSize {
-			minimumSize = partition.MinimumBytes
+	if !preserve {
+		if layout.RaidLevel != installer_proto.RaidLevelNone {
+			stopRaidArrays(logger)
 		}
-		sizeInUnits := minimumSize / unitSize
-		if sizeInUnits*unitSize < minimumSize {
-			sizeInUnits++
+		for _, drive := range drives {
+			err := partitionBootDrive(drive, layout, partitionIndices, logger)
+			if err != nil {
+				return err
+			}
 		}
-		var partType string
-		switch partition.FileSystemType {
-		case installer_proto.FileSystemTypeVfat:
-			partType = "fat32"
-		default:
-			partType = partition.FileSystemType.String()
+	}
+	bootDrive := *drives[0]
+	devices := getBootDevices(drives, layout)
+	if layout.RaidLevel != installer_proto.RaidLevelNone {
+		for _, array := range makeRaidArrays(drives, layout) {
+			if preserve {
+				if !array.exists() {
+					return fmt.Errorf("cannot assemble: %s, not destroying data",
+						array.devpath)
+				}
+				logger.Printf("preserving array: %s\n", array.devpath)
+				continue
+			}
+			if err := array.create(logger); err != nil {
+				return err
+			}
 		}
-		args = append(args, "mkpart", "primary", partType)
-		if minimumSize > 0 {
-			args = append(args,
-				strconv.FormatUint(offsetInUnits, 10)+unitSuffix,
-				strconv.FormatUint(offsetInUnits+sizeInUnits, 10)+unitSuffix)
-			offsetInUnits += sizeInUnits
-		} else {
-			args = append(args,
-				strconv.FormatUint(offsetInUnits, 10)+unitSuffix, "100%")
+		for _, drive := range drives[1:] {
+			if !drive.discarded {
+				bootDrive.discarded = false
+			}
 		}
 	}
-	if isEfi { // EFI System Partition is always the first partition.
-		args = append(args, "set", "1", "esp", "on")
-	} else {
-		args = append(args,
-			"set", strconv.FormatInt(int64(partitionIndices.boot), 10), "boot",
-			"on")
-	}
-	if err := run("parted", *tmpRoot, logger, args...); err != nil {
-		return err
-	}
 	// Prepare all file-systems concurrently, make them serially.
 	concurrentState := concurrent.NewState(uint(
 		len(layout.BootDriveLayout) + 1))
 	var mkfsMutex sync.Mutex
 	for index, partition := range layout.BootDriveLayout {
-		device := partitionName(drive.devpath, index+1)
+		device := devices[index]
 		partition := partition
-		var encrypt bool
+		encrypt := isEncrypted(layout, partition)
+		preserveFs := preserve
 		switch partition.MountPoint {
-		case bootMountPoint:
-		case efiMountPoint:
-		case rootMountPoint:
-		default:
-			encrypt = layout.Encrypt
+		case bootMountPoint, efiMountPoint, rootMountPoint:
+			preserveFs = false
 		}
 		var bytesPerInode uint
 		if partition.MinimumBytes < 1 && partition.MinimumFreeBytes < 1 {
 			bytesPerInode = 65536
 		}
 		err := concurrentState.GoRun(func() error {
-			return drive.makeFileSystem(cpuSharer, device,
+			return bootDrive.makeFileSystem(cpuSharer, device,
 				partition.FileSystemLabel, partition.FileSystemType, encrypt,
-				&mkfsMutex, bytesPerInode, logger)
+				preserveFs, &mkfsMutex, bytesPerInode, logger)
 		})
 		if err != nil {
 			return err
@@ -204,8 +209,7 @@ func configureBootDrive(cpuSharer cpusharer.CpuSharer, drive *driveType,
 	// Mount all file-systems, except the /boot and data file-systems, so that
 	// the image can create directories in them. First do the root partition,
 	// which might not be first in the list.
-	err := mount(partitionName(drive.devpath, partitionIndices.root),
-		*mountPoint,
+	err = mount(devices[partitionIndices.root-1], *mountPoint,
 		layout.BootDriveLayout[partitionIndices.root-1].FileSystemType.String(),
 		logger)
 	if err != nil {
@@ -218,8 +222,8 @@ func configureBootDrive(cpuSharer cpusharer.CpuSharer, drive *driveType,
 			partitionIndices.root:
 			continue
 		}
-		device := partitionName(drive.devpath, index+1)
-		err := mount(remapDevice(device, partition.MountPoint, layout.Encrypt),
+		err := mount(
+			remapDevice(devices[index], isEncrypted(layout, partition)),
 			filepath.Join(*mountPoint, partition.MountPoint),
 			partition.FileSystemType.String(), logger)
 		if err != nil {
@@ -230,15 +234,18 @@ func configureBootDrive(cpuSharer cpusharer.CpuSharer, drive *driveType,
 	if partitionIndices.boot != partitionIndices.root {
 		bootP = partitionIndices.boot
 	}
-	return installRoot(drive.devpath, layout, img.FileSystem, objGetter,
+	return installRoot(drives, devices, layout, img.FileSystem, objGetter,
 		bootInfo, bootP, partitionIndices.root, logger)
 }
 
 func configureDataDrive(cpuSharer cpusharer.CpuSharer, drive *driveType,
 	index int, layout installer_proto.StorageLayout,
 	logger log.DebugLogger) error {
+	preserve := layout.PreserveData && hasData(drive.devpath, logger)
 	startTime := time.Now()
-	if run("blkdiscard", "", logger, drive.devpath) == nil {
+	if preserve {
+		logger.Printf("preserving data on %s\n", drive.devpath)
+	} else if run("blkdiscard", "", logger, drive.devpath) == nil {
 		drive.discarded = true
 		logger.Printf("discarded %s in %s\n",
 			drive.devpath, format.Duration(time.Since(startTime)))
@@ -246,7 +253,7 @@ func configureDataDrive(cpuSharer cpusharer.CpuSharer, drive *driveType,
 	dataMountPoint := layout.ExtraMountPointsBasename + strconv.FormatInt(
 		int64(index), 10)
 	return drive.makeFileSystem(cpuSharer, drive.devpath, dataMountPoint,
-		installer_proto.FileSystemTypeExt4, layout.Encrypt, nil, 1048576,
+		layout.ExtraFileSystemType, layout.Encrypt, preserve, nil, 1048576,
 		logger)
 }
 
@@ -260,6 +267,9 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	if err != nil {
 		return nil, err
 	}
+	if err := layout.Check(); err != nil {
+		return nil, err
+	}
 	// Add an EFI partition if needed and not already defined.
 	isEfi := checkIsEfi()
 	if isEfi {
@@ -309,9 +319,9 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 				partition.FileSystemLabel = partition.MountPoint
 			}
 		}
-	}
-	if partitionIndices.root < 1 {
-		return nil, fmt.Errorf("no root partition specified in layout")
+		if partition.Encrypt && !isEncrypted(layout, *partition) {
+			return nil, fmt.Errorf("cannot encrypt: %s", partition.MountPoint)
+		}
 	}
 	if partitionIndices.boot < 1 {
 		partitionIndices.boot = partitionIndices.root
@@ -347,12 +357,22 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	if err != nil {
 		return nil, err
 	}
+	numRaidDrives := getNumRaidDrives(layout, len(drives))
+	if numRaidDrives > len(drives) {
+		return nil, fmt.Errorf("%s needs %d drives, have %d",
+			layout.RaidLevel, numRaidDrives, len(drives))
+	}
+	if layout.RaidLevel != installer_proto.RaidLevelNone && numRaidDrives < 2 {
+		return nil, fmt.Errorf("%s needs at least 2 drives", layout.RaidLevel)
+	}
+	bootDrives := drives[:numRaidDrives]
+	rootFsType :=
+		layout.BootDriveLayout[partitionIndices.root-1].FileSystemType.String()
 	rootDevice := partitionName(drives[0].devpath, partitionIndices.root)
-	var randomKey []byte
-	if layout.Encrypt {
-		randomKey, err = getRandomKey(16, logger)
-		if err != nil {
-			return nil, err
+	needKey := layout.Encrypt
+	for _, partition := range layout.BootDriveLayout {
+		if isEncrypted(layout, partition) {
+			needKey = true
 		}
 	}
 	imageName, err := readString(filepath.Join(*tftpDirectory, "imagename"),
@@ -394,7 +414,7 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	objClient := objectclient.AttachObjectClient(client)
 	defer objClient.Close()
 	objGetter, err := createObjectsCache(img.FileSystem.GetObjects(), objClient,
-		rootDevice, logger)
+		rootDevice, rootFsType, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -424,14 +444,25 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	if err := installTmpRoot(toolsFileSystem, objGetter, logger); err != nil {
 		return nil, err
 	}
-	if len(randomKey) > 0 {
-		err = ioutil.WriteFile(filepath.Join(*tmpRoot, keyFile), randomKey,
+	if layout.PreserveData && layout.RaidLevel != installer_proto.RaidLevelNone {
+		assembleRaidArrays(bootDrives, layout, logger)
+		rootDevice = getBootDevices(bootDrives,
+			layout)[partitionIndices.root-1]
+	}
+	var encryptionKey []byte
+	if needKey {
+		encryptionKey, err = getEncryptionKey(config.Machine.Hostname, layout,
+			rootDevice, rootFsType, logger)
+		if err != nil {
+			return nil, err
+		}
+		err = ioutil.WriteFile(filepath.Join(*tmpRoot, keyFile), encryptionKey,
 			fsutil.PrivateFilePerms)
 		if err != nil {
 			return nil, err
 		}
-		for index := range randomKey { // Scrub key.
-			randomKey[index] = 0
+		for index := range encryptionKey { // Scrub key.
+			encryptionKey[index] = 0
 		}
 	}
 	// Configure all drives concurrently, making file-systems.
@@ -440,13 +471,13 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	concurrentState := concurrent.NewState(uint(len(drives)))
 	cpuSharer := cpusharer.NewFifoCpuSharer()
 	err = concurrentState.GoRun(func() error {
-		return configureBootDrive(cpuSharer, drives[0], layout,
+		return configureBootDrives(cpuSharer, bootDrives, layout,
 			partitionIndices, img, objGetter, bootInfo, logger)
 	})
 	if err != nil {
 		return nil, concurrentState.Reap()
 	}
-	for index, drive := range drives[1:] {
+	for index, drive := range drives[numRaidDrives:] {
 		drive := drive
 		index := index + 1
 		err := concurrentState.GoRun(func() error {
@@ -464,11 +495,12 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	cryptTab := &bytes.Buffer{}
 	// Write the root file-system entry first.
 	bootCheckCount := uint(1)
+	bootDevices := getBootDevices(bootDrives, layout)
 	{
-		device := partitionName(drives[0].devpath, partitionIndices.root)
+		device := bootDevices[partitionIndices.root-1]
 		partition := layout.BootDriveLayout[partitionIndices.root-1]
-		err = drives[0].writeDeviceEntries(device, partition, fsTab, cryptTab,
-			bootCheckCount)
+		err = drives[0].writeDeviceEntries(device, partition, false, fsTab,
+			cryptTab, bootCheckCount)
 		if err != nil {
 			return nil, err
 		}
@@ -478,25 +510,22 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 			continue
 		}
 		bootCheckCount++
-		device := partitionName(drives[0].devpath, index+1)
-		err = drives[0].writeDeviceEntries(device, partition, fsTab, cryptTab,
-			bootCheckCount)
+		err = drives[0].writeDeviceEntries(bootDevices[index], partition,
+			isEncrypted(layout, partition), fsTab, cryptTab, bootCheckCount)
 		if err != nil {
 			return nil, err
 		}
 	}
 	// Make table entries for data file-systems on secondary drives.
-	for index, drive := range drives {
-		if index == 0 { // The boot device is partitioned.
-			continue
-		}
+	for index, drive := range drives[numRaidDrives:] {
 		dataMountPoint := layout.ExtraMountPointsBasename + strconv.FormatInt(
-			int64(index), 10)
+			int64(index+1), 10)
 		err = drive.writeDeviceEntries(drive.devpath, installer_proto.Partition{
 			FileSystemLabel: dataMountPoint,
+			FileSystemType:  layout.ExtraFileSystemType,
 			MountPoint:      dataMountPoint,
 		},
-			fsTab, cryptTab, 2)
+			layout.Encrypt, fsTab, cryptTab, 2)
 		if err != nil {
 			return nil, err
 		}
@@ -507,7 +536,12 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 	if err != nil {
 		return nil, err
 	}
-	if len(randomKey) > 0 {
+	if layout.RaidLevel != installer_proto.RaidLevelNone {
+		if err := writeMdadmConf(logger); err != nil {
+			return nil, err
+		}
+	}
+	if len(encryptionKey) > 0 {
 		logger.Printf("Writing /etc/crypttab:\n%s", string(cryptTab.Bytes()))
 		err = ioutil.WriteFile(filepath.Join(*mountPoint, "/etc", "crypttab"),
 			cryptTab.Bytes(), fsutil.PublicFilePerms)
@@ -525,7 +559,7 @@ func configureStorage(config fm_proto.GetMachineInfoResponse,
 			return nil, err
 		} else {
 			defer file.Close()
-			if _, err := file.Write(randomKey); err != nil {
+			if _, err := file.Write(encryptionKey); err != nil {
 				return nil, err
 			}
 		}
@@ -581,6 +615,23 @@ func eraseStart(device string, logger log.DebugLogger) error {
 	return nil
 }
 
+// getBootDevices returns the devices (partitions or RAID arrays) for the boot
+// drive layout.
+func getBootDevices(drives []*driveType,
+	layout installer_proto.StorageLayout) []string {
+	devices := make([]string, 0, len(layout.BootDriveLayout))
+	if layout.RaidLevel == installer_proto.RaidLevelNone {
+		for index := range layout.BootDriveLayout {
+			devices = append(devices, partitionName(drives[0].devpath, index+1))
+		}
+	} else {
+		for _, array := range makeRaidArrays(drives, layout) {
+			devices = append(devices, array.devpath)
+		}
+	}
+	return devices
+}
+
 func getImageserverAddress() (string, error) {
 	if *imageServerHostname != "" {
 		return fmt.Sprintf("%s:%d", *imageServerHostname, *imageServerPortNum),
@@ -589,6 +640,17 @@ func getImageserverAddress() (string, error) {
 	return readString(filepath.Join(*tftpDirectory, "imageserver"), false)
 }
 
+// getFileSystemType returns the type of the file-system on the device, or the
+// empty string if there is no recognisable file-system.
+func getFileSystemType(device string, logger log.DebugLogger) string {
+	output, err := runOutput("blkid", *tmpRoot, logger, "-o", "value",
+		"-s", "TYPE", device)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(output)
+}
+
 func getImage(imageName string, logger log.DebugLogger) (
 	string, *image.Image, *srpc.Client, error) {
 	if imageName == "" {
@@ -683,7 +745,17 @@ func getRandomKey(numBytes uint, logger log.DebugLogger) ([]byte, error) {
 	}
 }
 
-func installRoot(device string, layout installer_proto.StorageLayout,
+// hasData returns true if the device contains an encrypted volume or a
+// file-system.
+func hasData(device string, logger log.DebugLogger) bool {
+	if isLuks(device, logger) {
+		return true
+	}
+	return getFileSystemType(device, logger) != ""
+}
+
+func installRoot(drives []*driveType, devices []string,
+	layout installer_proto.StorageLayout,
 	fileSystem *filesystem.FileSystem, objGetter objectserver.ObjectsGetter,
 	bootInfo *util.BootInfoType, bootPartition, rootPartition int,
 	logger log.DebugLogger) error {
@@ -709,7 +781,7 @@ func installRoot(device string, layout installer_proto.StorageLayout,
 		// This ensures that the bootloader has the files it needs and that the
 		// root file-system is fully up-to-date with the image.
 		partition := layout.BootDriveLayout[bootPartition-1]
-		err := mount(partitionName(device, bootPartition), "/tmpboot",
+		err := mount(devices[bootPartition-1], "/tmpboot",
 			partition.FileSystemType.String(), logger)
 		if err != nil {
 			return err
@@ -730,7 +802,7 @@ func installRoot(device string, layout installer_proto.StorageLayout,
 			return fmt.Errorf("error unmounting: %s: %s", "/tmpboot", err)
 		}
 		logger.Debugln(0, "unmounted /tmpboot")
-		err = mount(partitionName(device, bootPartition),
+		err = mount(devices[bootPartition-1],
 			filepath.Join(*mountPoint, partition.MountPoint),
 			partition.FileSystemType.String(), logger)
 		if err != nil {
@@ -759,9 +831,16 @@ func installRoot(device string, layout installer_proto.StorageLayout,
 		waiter.Lock()
 		waiter.Unlock()
 	}()
-	return util.MakeBootable(fileSystem, device,
-		layout.BootDriveLayout[rootPartition-1].FileSystemLabel, *mountPoint,
-		"", true, logger)
+	// Install the bootloader on each drive, so that any RAID member can boot.
+	for _, drive := range drives {
+		err := util.MakeBootable(fileSystem, drive.devpath,
+			layout.BootDriveLayout[rootPartition-1].FileSystemLabel,
+			*mountPoint, "", true, logger)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func installTmpRoot(fileSystem *filesystem.FileSystem,
@@ -789,6 +868,22 @@ func installTmpRoot(fileSystem *filesystem.FileSystem,
 	return nil
 }
 
+// isEncrypted returns true if the partition should be encrypted.
+func isEncrypted(layout installer_proto.StorageLayout,
+	partition installer_proto.Partition) bool {
+	switch partition.MountPoint {
+	case bootMountPoint, efiMountPoint, rootMountPoint:
+		return false
+	}
+	return layout.Encrypt || partition.Encrypt
+}
+
+// isLuks returns true if the device contains a LUKS encrypted volume.
+func isLuks(device string, logger log.DebugLogger) bool {
+	_, err := runOutput("cryptsetup", *tmpRoot, logger, "isLuks", device)
+	return err == nil && !*dryRun
+}
+
 func listDrives(logger log.DebugLogger) ([]*driveType, error) {
 	basedir := filepath.Join(*sysfsDirectory, "class", "block")
 	file, err := os.Open(basedir)
@@ -892,6 +987,66 @@ func mount(source string, target string, fstype string,
 	return syscall.Mount(source, target, fstype, 0, "")
 }
 
+func partitionBootDrive(drive *driveType,
+	layout installer_proto.StorageLayout, partitionIndices partitionIndicesType,
+	logger log.DebugLogger) error {
+	startTime := time.Now()
+	if run("blkdiscard", "", logger, drive.devpath) == nil {
+		drive.discarded = true
+		logger.Printf("discarded %s in %s\n",
+			drive.devpath, format.Duration(time.Since(startTime)))
+	} else { // Erase old partition.
+		if err := eraseStart(drive.devpath, logger); err != nil {
+			return err
+		}
+	}
+	isEfi := checkIsEfi()
+	args := []string{"-s", "-a", "optimal", drive.devpath}
+	if isEfi {
+		args = append(args, "mklabel", "gpt")
+	} else {
+		args = append(args, "mklabel", "msdos")
+	}
+	unitSize := uint64(1 << 20)
+	unitSuffix := "MiB"
+	offsetInUnits := uint64(1)
+	for _, partition := range layout.BootDriveLayout {
+		minimumSize := partition.MinimumFreeBytes
+		if partition.MinimumBytes > minimumSize {
+			minimumSize = partition.MinimumBytes
+		}
+		sizeInUnits := minimumSize / unitSize
+		if sizeInUnits*unitSize < minimumSize {
+			sizeInUnits++
+		}
+		var partType string
+		switch partition.FileSystemType {
+		case installer_proto.FileSystemTypeVfat:
+			partType = "fat32"
+		default:
+			partType = partition.FileSystemType.String()
+		}
+		args = append(args, "mkpart", "primary", partType)
+		if minimumSize > 0 {
+			args = append(args,
+				strconv.FormatUint(offsetInUnits, 10)+unitSuffix,
+				strconv.FormatUint(offsetInUnits+sizeInUnits, 10)+unitSuffix)
+			offsetInUnits += sizeInUnits
+		} else {
+			args = append(args,
+				strconv.FormatUint(offsetInUnits, 10)+unitSuffix, "100%")
+		}
+	}
+	if isEfi { // EFI System Partition is always the first partition.
+		args = append(args, "set", "1", "esp", "on")
+	} else {
+		args = append(args,
+			"set", strconv.FormatInt(int64(partitionIndices.boot), 10), "boot",
+			"on")
+	}
+	return run("parted", *tmpRoot, logger, args...)
+}
+
 func partitionName(devpath string, partitionNumber int) string {
 	devLeafName := filepath.Base(devpath)
 	partitionName := "p" + strconv.FormatInt(int64(partitionNumber), 10)
@@ -919,8 +1074,8 @@ func readInt(filename string) (uint64, error) {
 	}
 }
 
-func remapDevice(device, target string, encrypt bool) string {
-	if !encrypt || target == rootMountPoint || target == bootMountPoint {
+func remapDevice(device string, encrypt bool) string {
+	if !encrypt {
 		return device
 	} else {
 		return filepath.Join("/dev/mapper", filepath.Base(device))
@@ -1026,6 +1181,14 @@ func (drive driveType) String() string {
 	return drive.name
 }
 
+// countPartitions returns the number of partitions on the drive.
+func (drive driveType) countPartitions() int {
+	pattern := filepath.Join(*sysfsDirectory, "class", "block", drive.name,
+		drive.name+"*", "partition")
+	matches, _ := filepath.Glob(pattern)
+	return len(matches)
+}
+
 func (drive driveType) cryptSetup(cpuSharer cpusharer.CpuSharer, device string,
 	logger log.DebugLogger) error {
 	cpuSharer.GrabCpu()
@@ -1041,7 +1204,12 @@ func (drive driveType) cryptSetup(cpuSharer cpusharer.CpuSharer, device string,
 	}
 	logger.Printf("formatted encrypted device %s in %s\n",
 		device, time.Since(startTime))
-	startTime = time.Now()
+	return drive.cryptOpen(device, logger)
+}
+
+func (drive driveType) cryptOpen(device string, logger log.DebugLogger) error {
+	startTime := time.Now()
+	var err error
 	if drive.discarded {
 		err = run("cryptsetup", *tmpRoot, logger, "open", "--type", "luks",
 			"--allow-discards",
@@ -1059,8 +1227,9 @@ func (drive driveType) cryptSetup(cpuSharer cpusharer.CpuSharer, device string,
 }
 
 func (drive driveType) makeFileSystem(cpuSharer cpusharer.CpuSharer,
-	device, label string, fstype installer_proto.FileSystemType, encrypt bool,
-	mkfsMutex *sync.Mutex, bytesPerInode uint, logger log.DebugLogger) error {
+	device, label string, fstype installer_proto.FileSystemType,
+	encrypt, preserve bool, mkfsMutex *sync.Mutex, bytesPerInode uint,
+	logger log.DebugLogger) error {
 	startTime := time.Now()
 	numIterations, numOpened, err := fsutil.WaitForBlockAvailable(device,
 		5*time.Second)
@@ -1074,12 +1243,26 @@ func (drive driveType) makeFileSystem(cpuSharer cpusharer.CpuSharer,
 	}
 	erase := !drive.discarded
 	if encrypt {
-		if err := drive.cryptSetup(cpuSharer, device, logger); err != nil {
-			return err
+		if preserve && isLuks(device, logger) {
+			if err := drive.cryptOpen(device, logger); err != nil {
+				return err
+			}
+		} else {
+			err := drive.cryptSetup(cpuSharer, device, logger)
+			if err != nil {
+				return err
+			}
 		}
 		device = filepath.Join("/dev/mapper", filepath.Base(device))
 		erase = true
 	}
+	if preserve {
+		if fsType := getFileSystemType(device, logger); fsType != "" &&
+			fsType == fstype.String() {
+			logger.Printf("preserving %s file-system on %s\n", fsType, device)
+			return nil
+		}
+	}
 	if erase {
 		if err := eraseStart(device, logger); err != nil {
 			return err
@@ -1102,6 +1285,8 @@ func (drive driveType) makeFileSystem(cpuSharer cpusharer.CpuSharer,
 	case installer_proto.FileSystemTypeVfat:
 		err = run("mkfs.vfat", *tmpRoot, logger, "--codepage=437",
 			"-n", label, device)
+	case installer_proto.FileSystemTypeXfs:
+		err = run("mkfs.xfs", *tmpRoot, logger, "-f", "-L", label, device)
 	default:
 		return fmt.Errorf("unsupported file-system type: %d (%s)",
 			fstype, fstype)
@@ -1118,13 +1303,9 @@ func (drive driveType) makeFileSystem(cpuSharer cpusharer.CpuSharer,
 }
 
 func (drive driveType) writeDeviceEntries(device string,
-	partition installer_proto.Partition,
+	partition installer_proto.Partition, encrypt bool,
 	fsTab, cryptTab io.Writer, checkOrder uint) error {
-	switch partition.MountPoint {
-	case bootMountPoint:
-	case efiMountPoint:
-	case rootMountPoint:
-	default:
+	if encrypt {
 		var options string
 		if drive.discarded {
 			options = "discard"
@@ -0,0 +1,163 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/x509util"
+	installer_proto "github.com/Cloud-Foundations/Dominator/proto/installer"
+)
+
+const (
+	maximumKeyBytes = 4096
+	minimumKeyBytes = 16
+)
+
+// checkKey returns an error if the key is too short.
+func checkKey(key []byte, source string) error {
+	if len(key) < minimumKeyBytes {
+		return fmt.Errorf("key from: %s has %d bytes, minimum: %d",
+			source, len(key), minimumKeyBytes)
+	}
+	return nil
+}
+
+// fetchKey will fetch the encryption key for the host from a key server. The
+// hostname is added to the URL as the "hostname" query parameter. The key
+// server must use HTTPS: it is authenticated with the -keyServerCaFile and the
+// installer authenticates with its certificate.
+func fetchKey(keyServerUrl, hostname string,
+	logger log.DebugLogger) ([]byte, error) {
+	parsedUrl, err := url.Parse(keyServerUrl)
+	if err != nil {
+		return nil, err
+	}
+	if parsedUrl.Scheme != "https" {
+		return nil, fmt.Errorf("key server: %s does not use https",
+			parsedUrl.Host)
+	}
+	tlsConfig, err := makeKeyServerTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	query := parsedUrl.Query()
+	query.Set("hostname", hostname)
+	parsedUrl.RawQuery = query.Encode()
+	logger.Printf("fetching encryption key from: %s\n", parsedUrl.Host)
+	client := http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	resp, err := client.Get(parsedUrl.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching key from: %s: %s",
+			parsedUrl.Host, resp.Status)
+	}
+	key, err := io.ReadAll(io.LimitReader(resp.Body, maximumKeyBytes))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKey(key, parsedUrl.Host); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// getEncryptionKey returns the key for the encrypted file-systems. The key is
+// fetched from the key server if one is specified, else the key provided by
+// the Hypervisor (in the TFTP data) is used if present, else the key from the
+// old root file-system is used if data are to be preserved, else a random key
+// is generated.
+func getEncryptionKey(hostname string, layout installer_proto.StorageLayout,
+	rootDevice, rootFsType string, logger log.DebugLogger) ([]byte, error) {
+	if layout.KeyServerUrl != "" {
+		return fetchKey(layout.KeyServerUrl, hostname, logger)
+	}
+	if key, err := readHypervisorKey(logger); err != nil {
+		return nil, err
+	} else if len(key) > 0 {
+		return key, nil
+	}
+	if layout.PreserveData {
+		if key := readOldKey(rootDevice, rootFsType, logger); len(key) > 0 {
+			return key, nil
+		}
+	}
+	return getRandomKey(minimumKeyBytes, logger)
+}
+
+// makeKeyServerTlsConfig returns a TLS configuration which authenticates the
+// key server and presents the installer certificate.
+func makeKeyServerTlsConfig() (*tls.Config, error) {
+	tlsConfig := srpc.GetClientTlsConfig()
+	if tlsConfig == nil || len(tlsConfig.Certificates) < 1 {
+		return nil, errors.New("no certificate to authenticate to key server")
+	}
+	certs, _, err := x509util.LoadCertificatePEMs(*keyServerCaFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading key server CA: %s", err)
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	for _, cert := range certs {
+		tlsConfig.RootCAs.AddCert(cert)
+	}
+	tlsConfig.InsecureSkipVerify = false
+	return tlsConfig, nil
+}
+
+// readHypervisorKey returns the key provided by the Hypervisor which served
+// the TFTP data, if present.
+func readHypervisorKey(logger log.DebugLogger) ([]byte, error) {
+	key, err := os.ReadFile(filepath.Join(*tftpDirectory, "encryption-key"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := checkKey(key, "Hypervisor"); err != nil {
+		return nil, err
+	}
+	logger.Println("using encryption key from Hypervisor")
+	return key, nil
+}
+
+// readOldKey will read the key file from the old root file-system, if present.
+func readOldKey(rootDevice, rootFsType string, logger log.DebugLogger) []byte {
+	if *dryRun {
+		logger.Debugln(0, "dry run: skipping reading old key")
+		return nil
+	}
+	err := syscall.Mount(rootDevice, *mountPoint, rootFsType,
+		syscall.MS_RDONLY, "")
+	if err != nil {
+		logger.Printf("unable to mount old root: %s: %s\n", rootDevice, err)
+		return nil
+	}
+	defer syscall.Unmount(*mountPoint, 0)
+	key, err := os.ReadFile(filepath.Join(*mountPoint, keyFile))
+	if err != nil {
+		logger.Printf("unable to read old key: %s\n", err)
+		return nil
+	}
+	logger.Println("using key from old root file-system")
+	return key
+}
@@ -271,6 +271,38 @@ func runAlways(name, chroot string, logger log.DebugLogger,
 	return nil
 }
 
+// runOutput is like run, except that standard output is returned rather than
+// logged.
+func runOutput(name, chroot string, logger log.DebugLogger,
+	args ...string) (string, error) {
+	if *dryRun {
+		logger.Debugf(0, "dry run: skipping: %s %s\n",
+			name, strings.Join(args, " "))
+		return "", nil
+	}
+	path, err := lookPath(chroot, name)
+	if err != nil {
+		return "", err
+	}
+	stdout := &strings.Builder{}
+	stderr := &strings.Builder{}
+	cmd := exec.Command(path, args...)
+	cmd.Env = make([]string, 0)
+	cmd.Stderr = stderr
+	cmd.Stdout = stdout
+	if chroot != "" {
+		cmd.Dir = "/"
+		cmd.SysProcAttr = &syscall.SysProcAttr{Chroot: chroot}
+	}
+	logger.Debugf(0, "running(chroot=%s): %s %s\n",
+		chroot, name, strings.Join(args, " "))
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("error running: %s: %s, stderr: %s",
+			name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
 func unpackAndMount(rootDir string, fileSystem *filesystem.FileSystem,
 	objGetter objectserver.ObjectsGetter, doInTmpfs bool,
 	logger log.DebugLogger) error {
@@ -64,6 +64,8 @@ var (
 	imageServerPortNum = flag.Uint("imageServerPortNum",
 		constants.ImageServerPortNumber,
 		"Port number of image server (overrides TFTP data)")
+	keyServerCaFile = flag.String("keyServerCaFile", "/etc/ssl/CA.pem",
+		"Name of file containing the root of trust for the key server")
 	logDebugLevel = flag.Int("logDebugLevel", -1, "Debug log level")
 	mountPoint    = flag.String("mountPoint", "/mnt",
 		"Mount point for new root file-system")
@@ -82,7 +82,7 @@ func saveOldEtc(logger log.DebugLogger) error {
 }
 
 func createObjectsCache(requiredObjects map[hash.Hash]uint64,
-	objGetter objectserver.ObjectsGetter, rootDevice string,
+	objGetter objectserver.ObjectsGetter, rootDevice, rootFsType string,
 	logger log.DebugLogger) (*objectsCache, error) {
 	cache := &objectsCache{objects: make(map[hash.Hash][]byte)}
 	if err := cache.scanRoot(requiredObjects, logger); err != nil {
@@ -97,7 +97,8 @@ func createObjectsCache(requiredObjects map[hash.Hash]uint64,
 	logger.Debugf(0, "object cache already has %d/%d objects (%s/%s)\n",
 		len(cache.objects), len(requiredObjects),
 		format.FormatBytes(presentBytes), format.FormatBytes(requiredBytes))
-	err := cache.findAndScanUntrusted(missingObjects, rootDevice, logger)
+	err := cache.findAndScanUntrusted(missingObjects, rootDevice, rootFsType,
+		logger)
 	if err != nil {
 		return nil, err
 	}
@@ -156,9 +157,9 @@ func (cache *objectsCache) downloadMissing(requiredObjects map[hash.Hash]uint64,
 }
 
 func (cache *objectsCache) findAndScanUntrusted(
-	requiredObjects map[hash.Hash]uint64, rootDevice string,
+	requiredObjects map[hash.Hash]uint64, rootDevice, rootFsType string,
 	logger log.DebugLogger) error {
-	if err := mount(rootDevice, *mountPoint, "ext4", logger); err != nil {
+	if err := mount(rootDevice, *mountPoint, rootFsType, logger); err != nil {
 		return nil
 	}
 	defer syscall.Unmount(*mountPoint, 0)
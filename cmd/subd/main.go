@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/x509"
 	"flag"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/cpulimiter"
@@ -22,6 +24,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/fsrateio"
 	"github.com/Cloud-Foundations/Dominator/lib/goroutine"
 	"github.com/Cloud-Foundations/Dominator/lib/html"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/log/serverlogger"
 	"github.com/Cloud-Foundations/Dominator/lib/memstats"
 	"github.com/Cloud-Foundations/Dominator/lib/netspeed"
@@ -48,6 +51,13 @@ var (
 		"Scan speed as percentage of capacity (default 2)")
 	disruptionManager = flag.String("disruptionManager", "",
 		"Path to DisruptionManager tool")
+	fullScanInterval = flag.Duration("fullScanInterval", time.Hour,
+		"Interval between full scans if -watchFileSystem is true")
+	imageServerHostname = flag.String("imageServerHostname", "",
+		"Hostname of image server used to verify image signatures")
+	imageServerPortNum = flag.Uint("imageServerPortNum",
+		constants.ImageServerPortNumber,
+		"Port number of image server")
 	maxThreads = flag.Uint("maxThreads", 1,
 		"Maximum number of parallel OS threads to use")
 	noteGenerator = flag.String("noteGenerator", "",
@@ -68,6 +78,11 @@ var (
 		"Name of subd private directory, relative to rootDir. This must be on the same file-system as rootDir")
 	testExternallyPatchable = flag.Bool("testExternallyPatchable", false,
 		"If true, test if externally patchable and exit=0 if so or exit=1 if not")
+	trustedImageSignersFile = flag.String("trustedImageSignersFile", "",
+		"Name of file containing PEM encoded certificates of trusted image "+
+			"signers. If specified, updates to unsigned images are refused")
+	watchFileSystem = flag.Bool("watchFileSystem", false,
+		"If true, watch for changes and only rescan changed paths between full scans")
 )
 
 func init() {
@@ -289,6 +304,18 @@ func main() {
 	if err := setupserver.SetupTlsWithParams(params); err != nil {
 		logger.Fatalln(err)
 	}
+	var trustedImageSigners *x509.CertPool
+	if *trustedImageSignersFile != "" {
+		if *imageServerHostname == "" {
+			logger.Fatalln(
+				"-imageServerHostname required with -trustedImageSignersFile")
+		}
+		trustedImageSigners, err = image.LoadTrustedSigners(
+			*trustedImageSignersFile)
+		if err != nil {
+			logger.Fatalf("Cannot load trusted image signers: %s\n", err)
+		}
+	}
 	bytesPerSecond, blocksPerSecond, firstScan, ok := getCachedFsSpeed(
 		workingRootDir, tmpDir)
 	if !ok {
@@ -332,6 +359,8 @@ func main() {
 	var configuration scanner.Configuration
 	configuration.CpuLimiter = cpulimiter.New(100)
 	configuration.DefaultCpuPercent = configParams.CpuPercent
+	configuration.FullScanInterval = *fullScanInterval
+	configuration.WatchFileSystem = *watchFileSystem
 	// Apply built-in defaults if nothing specified.
 	if configuration.DefaultCpuPercent < 1 {
 		configuration.DefaultCpuPercent = constants.DefaultCpuPercent
@@ -381,13 +410,16 @@ func main() {
 		}
 		rpcdHtmlWriter := rpcd.Setup(
 			rpcd.Config{
-				DisruptionManager:        *disruptionManager,
+				DisruptionManager: *disruptionManager,
+				ImageServerAddress: fmt.Sprintf("%s:%d",
+					*imageServerHostname, *imageServerPortNum),
 				NetworkBenchmarkFilename: netbenchFilename,
 				NoteGeneratorCommand:     *noteGenerator,
 				ObjectsDirectoryName:     objectsDir,
 				OldTriggersFilename:      oldTriggersFilename,
 				RootDirectoryName:        workingRootDir,
 				SubConfiguration:         configParams,
+				TrustedImageSigners:      trustedImageSigners,
 			},
 			rpcd.Params{
 				DisableScannerFunction:    disableScanner,
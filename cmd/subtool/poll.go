@@ -96,6 +96,12 @@ func pollSubcommand(args []string, logger log.DebugLogger) error {
 		if reply.DisruptionState != sub.DisruptionStateAnytime {
 			fmt.Printf("Disruption state: %s\n", reply.DisruptionState)
 		}
+		if !reply.DisruptionNextWindow.IsZero() {
+			fmt.Printf("Next maintenance window: %s (in %s)\n",
+				reply.DisruptionNextWindow.Local().Format(
+					format.TimeFormatSeconds),
+				format.Duration(time.Until(reply.DisruptionNextWindow)))
+		}
 		if reply.LockedByAnotherClient {
 			fmt.Printf("Locked by another client\n")
 		}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	imgclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	objclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/wsyscall"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func backupVmSubcommand(args []string, logger log.DebugLogger) error {
+	if err := backupVm(args[0], logger); err != nil {
+		return fmt.Errorf("error backing up VM: %s", err)
+	}
+	return nil
+}
+
+func backupVm(vmHostname string, logger log.DebugLogger) error {
+	if *backupObjectServer == "" {
+		return errors.New("no -backupObjectServer specified")
+	}
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return backupVmOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func backupVmOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	request := proto.BackupVmRequest{
+		ForceIfNotStopped:   *forceIfNotStopped,
+		IpAddress:           ipAddr,
+		ObjectServerAddress: *backupObjectServer,
+	}
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	manifestHash, err := hyperclient.BackupVm(client, request, logger)
+	if err != nil {
+		return err
+	}
+	if *backupImageName != "" {
+		if err := addBackupImage(*backupImageName, manifestHash); err != nil {
+			return fmt.Errorf("error adding backup image: %s", err)
+		}
+	}
+	fmt.Printf("%x\n", manifestHash)
+	return nil
+}
+
+// addBackupImage adds an image to the object server (which must be an
+// imageserver) which references all the objects in the backup, so that they
+// are not garbage collected. Deleting the image releases the backup.
+func addBackupImage(imageName string, manifestHash hash.Hash) error {
+	client, err := dialImageServer(*backupObjectServer)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	objClient := objclient.AttachObjectClient(client)
+	defer objClient.Close()
+	_, reader, err := objClient.GetObject(manifestHash)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	var manifest proto.VmBackupManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return err
+	}
+	hashes := listBackupObjects(manifestHash, manifest)
+	sizes, err := objClient.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	fs, err := makeBackupFileSystem(hashes, sizes)
+	if err != nil {
+		return err
+	}
+	return imgclient.AddImage(client, imageName, &image.Image{FileSystem: fs})
+}
+
+// listBackupObjects returns the unique objects in a backup, including the
+// manifest.
+func listBackupObjects(manifestHash hash.Hash,
+	manifest proto.VmBackupManifest) []hash.Hash {
+	hashes := []hash.Hash{manifestHash}
+	found := map[hash.Hash]struct{}{manifestHash: {}}
+	add := func(hashVal hash.Hash) {
+		if _, ok := found[hashVal]; !ok {
+			found[hashVal] = struct{}{}
+			hashes = append(hashes, hashVal)
+		}
+	}
+	if manifest.UserData != nil {
+		add(*manifest.UserData)
+	}
+	for _, volume := range manifest.Volumes {
+		for _, chunk := range volume.Chunks {
+			if chunk != nil {
+				add(chunk.CompressedHash)
+			}
+		}
+	}
+	return hashes
+}
+
+// makeBackupFileSystem returns a file-system with a file for each object.
+func makeBackupFileSystem(hashes []hash.Hash,
+	sizes []uint64) (*filesystem.FileSystem, error) {
+	fs := &filesystem.FileSystem{
+		InodeTable: make(filesystem.InodeTable, len(hashes)),
+	}
+	fs.DirectoryInode.Mode = wsyscall.S_IFDIR | 0755
+	for index, hashVal := range hashes {
+		if sizes[index] < 1 {
+			return nil, fmt.Errorf("object: %x is not available", hashVal)
+		}
+		inodeNumber := uint64(index + 1)
+		fs.InodeTable[inodeNumber] = &filesystem.RegularInode{
+			Mode: wsyscall.S_IFREG | 0444,
+			Size: sizes[index],
+			Hash: hashVal,
+		}
+		fs.EntryList = append(fs.EntryList, &filesystem.DirectoryEntry{
+			Name:        fmt.Sprintf("%x", hashVal),
+			InodeNumber: inodeNumber,
+		})
+	}
+	sort.Slice(fs.EntryList, func(i, j int) bool {
+		return fs.EntryList[i].Name < fs.EntryList[j].Name
+	})
+	if err := fs.RebuildInodePointers(); err != nil {
+		return nil, err
+	}
+	fs.ComputeTotalDataBytes()
+	return fs, nil
+}
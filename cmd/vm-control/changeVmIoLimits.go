@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func changeVmIoLimitsSubcommand(args []string, logger log.DebugLogger) error {
+	if err := changeVmIoLimits(args[0], logger); err != nil {
+		return fmt.Errorf("error changing VM I/O limits: %s", err)
+	}
+	return nil
+}
+
+// getVolumeIoLimits returns the I/O limits specified on the command line for
+// the volume with the specified index, or nil if there are no limits.
+func getVolumeIoLimits(index int) *proto.IoLimits {
+	var limits proto.IoLimits
+	if index < len(volumeBytesPerSecond) {
+		limits.BytesPerSecond = uint64(volumeBytesPerSecond[index])
+	}
+	if index < len(volumeOpsPerSecond) {
+		limits.OperationsPerSecond = uint64(volumeOpsPerSecond[index])
+	}
+	if limits == (proto.IoLimits{}) {
+		return nil
+	}
+	return &limits
+}
+
+func changeVmIoLimits(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return changeVmIoLimitsOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func changeVmIoLimitsOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	vmInfo, err := hyperclient.GetVmInfo(client, ipAddr)
+	if err != nil {
+		return err
+	}
+	request := makeChangeVmIoLimitsRequest(ipAddr, vmInfo)
+	return hyperclient.ChangeVmIoLimits(client, request)
+}
+
+// makeChangeVmIoLimitsRequest returns a request which changes the limits
+// specified on the command line and keeps the other limits of the VM.
+func makeChangeVmIoLimitsRequest(ipAddr net.IP,
+	vmInfo proto.VmInfo) proto.ChangeVmIoLimitsRequest {
+	request := proto.ChangeVmIoLimitsRequest{
+		IpAddress:             ipAddr,
+		NetworkBytesPerSecond: vmInfo.NetworkBytesPerSecond,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "networkBytesPerSecond" {
+			request.NetworkBytesPerSecond = uint64(networkBytesPerSecond)
+		}
+	})
+	for index, volume := range vmInfo.Volumes {
+		var limits proto.IoLimits
+		if volume.IoLimits != nil {
+			limits = *volume.IoLimits
+		}
+		if index < len(volumeBytesPerSecond) {
+			limits.BytesPerSecond = uint64(volumeBytesPerSecond[index])
+		}
+		if index < len(volumeOpsPerSecond) {
+			limits.OperationsPerSecond = uint64(volumeOpsPerSecond[index])
+		}
+		request.VolumeIoLimits = append(request.VolumeIoLimits, limits)
+	}
+	return request
+}
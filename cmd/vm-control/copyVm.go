@@ -71,10 +71,11 @@ func copyVmFromHypervisor(sourceHypervisorAddress string, vmIP net.IP,
 		return err
 	}
 	defer hyperclient.DiscardVmAccessToken(sourceHypervisor, vmIP, nil)
-	destHypervisorAddress, err := getHypervisorAddress(*vmInfo, logger)
+	destHypervisorAddress, release, err := getHypervisorAddress(*vmInfo, logger)
 	if err != nil {
 		return err
 	}
+	defer release()
 	destHypervisor, err := dialHypervisor(destHypervisorAddress)
 	if err != nil {
 		return err
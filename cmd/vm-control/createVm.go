@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -13,9 +14,11 @@ import (
 	"strings"
 	"time"
 
+	fm_client "github.com/Cloud-Foundations/Dominator/fleetmanager/client"
 	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
 	imgclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem/util"
+	"github.com/Cloud-Foundations/Dominator/lib/flagutil"
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
 	"github.com/Cloud-Foundations/Dominator/lib/images/virtualbox"
@@ -61,6 +64,49 @@ func createVmSubcommand(args []string, logger log.DebugLogger) error {
 	return nil
 }
 
+// applyFlavour fetches the flavour from the Fleet Manager and applies it to
+// the request. Values specified on the command line take precedence.
+func applyFlavour(request *hyper_proto.CreateVmRequest) error {
+	if *flavourName == "" {
+		return nil
+	}
+	if *fleetManagerHostname == "" {
+		return errors.New("no Fleet Manager specified to get flavour from")
+	}
+	client, err := dialFleetManager(fmt.Sprintf("%s:%d",
+		*fleetManagerHostname, *fleetManagerPortNum))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	flavour, err := fm_client.GetFlavour(client, *location, *flavourName)
+	if err != nil {
+		return err
+	}
+	minFreeBytesSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "minFreeBytes" {
+			minFreeBytesSet = true
+		}
+	})
+	if !minFreeBytesSet {
+		request.MinimumFreeBytes = 0
+	}
+	flavour.Apply(request, *flavourName)
+	if request.MinimumFreeBytes < 1 {
+		request.MinimumFreeBytes = uint64(minFreeBytes)
+	}
+	minFreeBytes = flagutil.Size(request.MinimumFreeBytes)
+	if len(secondaryVolumeSizes) < 1 {
+		for _, volume := range request.SecondaryVolumes {
+			secondaryVolumeSizes = append(secondaryVolumeSizes,
+				flagutil.Size(volume.Size))
+		}
+	}
+	request.SecondaryVolumes = nil // Added from secondaryVolumeSizes later.
+	return nil
+}
+
 func callCreateVm(client *srpc.Client, request hyper_proto.CreateVmRequest,
 	reply *hyper_proto.CreateVmResponse, imageReader, userDataReader io.Reader,
 	imageSize, userDataSize int64, logger log.DebugLogger) error {
@@ -166,6 +212,9 @@ func createVm(logger log.DebugLogger) error {
 		StorageIndices:   storageIndices,
 		VmInfo:           *vmInfo,
 	}
+	if err := applyFlavour(&request); err != nil {
+		return err
+	}
 	if request.VmInfo.MemoryInMiB < 1 {
 		request.VmInfo.MemoryInMiB = 1024
 	}
@@ -178,12 +227,13 @@ func createVm(logger log.DebugLogger) error {
 		return fmt.Errorf("vCPUs must be at least %d", minimumCPUs)
 	}
 	tmpVmInfo := approximateVolumesForCreateRequest(request.VmInfo)
-	if hypervisor, err := getHypervisorAddress(tmpVmInfo, logger); err != nil {
+	hypervisor, release, err := getHypervisorAddress(tmpVmInfo, logger)
+	if err != nil {
 		return err
-	} else {
-		logger.Debugf(0, "creating VM on %s\n", hypervisor)
-		return createVmOnHypervisor(hypervisor, request, logger)
 	}
+	defer release()
+	logger.Debugf(0, "creating VM on %s\n", hypervisor)
+	return createVmOnHypervisor(hypervisor, request, logger)
 }
 
 func createVmInfoFromFlags() (*hyper_proto.VmInfo, error) {
@@ -196,38 +246,43 @@ func createVmInfoFromFlags() (*hyper_proto.VmInfo, error) {
 	if len(volumeTypes) > 0 {
 		volumeType = volumeTypes[0]
 	}
+	rootIoLimits := getVolumeIoLimits(0)
 	if volumeFormat != hyper_proto.VolumeFormatRaw ||
 		volumeInterface != hyper_proto.VolumeInterfaceVirtIO ||
-		volumeType != hyper_proto.VolumeTypePersistent {
+		volumeType != hyper_proto.VolumeTypePersistent ||
+		rootIoLimits != nil {
 		// If any provided, set for root volume. Secondaries are done later.
 		volumes = append(volumes, hyper_proto.Volume{
 			Format:    volumeFormat,
 			Interface: volumeInterface,
+			IoLimits:  rootIoLimits,
 			Type:      volumeType,
 		})
 	}
 	vmInfo := hyper_proto.VmInfo{
-		ConsoleType:        consoleType,
-		CpuPriority:        *cpuPriority,
-		DestroyOnPowerdown: *destroyOnPowerdown,
-		DestroyProtection:  *destroyProtection,
-		DisableVirtIO:      *disableVirtIO,
-		ExtraKernelOptions: *extraKernelOptions,
-		FirmwareType:       firmwareType,
-		Hostname:           *vmHostname,
-		MachineType:        machineType,
-		MemoryInMiB:        uint64(memory >> 20),
-		MilliCPUs:          *milliCPUs,
-		OwnerGroups:        ownerGroups,
-		OwnerUsers:         ownerUsers,
-		Tags:               vmTags,
-		SecondarySubnetIDs: secondarySubnetIDs,
-		SpreadVolumes:      *spreadVolumes,
-		SubnetId:           *subnetId,
-		VirtualCPUs:        *virtualCPUs,
-		Volumes:            volumes,
-		WatchdogAction:     watchdogAction,
-		WatchdogModel:      watchdogModel,
+		ConsoleType:           consoleType,
+		CpuPriority:           *cpuPriority,
+		DestroyOnPowerdown:    *destroyOnPowerdown,
+		DestroyProtection:     *destroyProtection,
+		DisableVirtIO:         *disableVirtIO,
+		ExtraKernelOptions:    *extraKernelOptions,
+		FirmwareType:          firmwareType,
+		Hostname:              *vmHostname,
+		MachineType:           machineType,
+		MemoryInMiB:           uint64(memory >> 20),
+		MilliCPUs:             *milliCPUs,
+		NetworkBytesPerSecond: uint64(networkBytesPerSecond),
+		OwnerGroups:           ownerGroups,
+		OwnerUsers:            ownerUsers,
+		Tags:                  vmTags,
+		SecondarySubnetIDs:    secondarySubnetIDs,
+		SnapshotPolicy:        makeSnapshotPolicy(),
+		SpreadVolumes:         *spreadVolumes,
+		SubnetId:              *subnetId,
+		VirtualCPUs:           *virtualCPUs,
+		Volumes:               volumes,
+		WatchdogAction:        watchdogAction,
+		WatchdogModel:         watchdogModel,
 	}
 	if len(requestIPs) > 0 && requestIPs[0] != "" {
 		ipAddr := net.ParseIP(requestIPs[0])
@@ -267,7 +322,10 @@ func createVmOnHypervisor(hypervisor string,
 		}
 	}
 	for index, size := range secondaryVolumeSizes {
-		volume := hyper_proto.Volume{Size: uint64(size)}
+		volume := hyper_proto.Volume{
+			IoLimits: getVolumeIoLimits(index + 1),
+			Size:     uint64(size),
+		}
 		if index+1 < len(volumeInterfaces) {
 			volume.Interface = volumeInterfaces[index+1]
 		}
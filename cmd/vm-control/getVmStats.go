@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func getVmStatsSubcommand(args []string, logger log.DebugLogger) error {
+	if err := getVmStats(args[0], logger); err != nil {
+		return fmt.Errorf("error getting VM stats: %s", err)
+	}
+	return nil
+}
+
+func getVmStats(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return getVmStatsOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func getVmStatsOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	vmStats, err := hyperclient.GetVmStats(client,
+		proto.GetVmStatsRequest{IpAddresses: []net.IP{ipAddr}})
+	if err != nil {
+		return err
+	}
+	return json.WriteWithIndent(os.Stdout, "    ", vmStats[0])
+}
@@ -23,6 +23,10 @@ import (
 var (
 	adjacentVM = flag.String("adjacentVM", "",
 		"IP address of VM adjacent (same Hypervisor) to VM being created")
+	backupImageName = flag.String("backupImageName", "",
+		"Name of image to add to the backup imageserver to retain the backup")
+	backupObjectServer = flag.String("backupObjectServer", "",
+		"Address (host:port) of object server to store VM backups in")
 	consoleType hyper_proto.ConsoleType
 	cpuPriority = flag.Int("cpuPriority", 0,
 		"CPU priority (-20:+19) for VM process on Hypervisor")
@@ -40,7 +44,9 @@ var (
 		"If true, enable boot from network for first boot")
 	extraKernelOptions = flag.String("extraKernelOptions", "",
 		"Extra options to pass to kernel")
-	firmwareType         hyper_proto.FirmwareType
+	firmwareType hyper_proto.FirmwareType
+	flavourName  = flag.String("flavour", "",
+		"Name of flavour from the Fleet Manager topology to create VM with")
 	fleetManagerHostname = flag.String("fleetManagerHostname", "",
 		"Hostname of Fleet Manager")
 	fleetManagerPortNum = flag.Uint("fleetManagerPortNum",
@@ -80,13 +86,22 @@ var (
 		"Command to make local VM when exporting. The VM name is given as the argument. The VM JSON is available on stdin")
 	localVmDestroy = flag.String("localVmDestroy", "",
 		"Command to destroy local VM when exporting. The VM name is given as the argument")
+	liveMigration = flag.Bool("liveMigration", false,
+		"If true, migrate running VMs without stopping them (falls back to a cold migration)")
+	liveMigrationMaxDowntime = flag.Duration("liveMigrationMaxDowntime",
+		300*time.Millisecond,
+		"Maximum pause of VM when switching over a live migration")
+	liveMigrationTimeout = flag.Duration("liveMigrationTimeout",
+		10*time.Minute,
+		"Time to wait for a live migration to converge")
 	location = flag.String("location", "",
 		"Location to search for hypervisors")
-	machineType      hyper_proto.MachineType
-	memory           flagutil.Size
-	milliCPUs        = flag.Uint("milliCPUs", 0, "milli CPUs (default 250)")
-	placement        placementType
-	placementCommand = flag.String("placementCommand", "",
+	machineType           hyper_proto.MachineType
+	memory                flagutil.Size
+	milliCPUs             = flag.Uint("milliCPUs", 0, "milli CPUs (default 250)")
+	networkBytesPerSecond flagutil.Size
+	placement             placementType
+	placementCommand      = flag.String("placementCommand", "",
 		"Command to make placement decisions when creating/copying/moving VM")
 	minFreeBytes     = flagutil.Size(256 << 20)
 	overlayDirectory = flag.String("overlayDirectory", "",
@@ -124,9 +139,13 @@ var (
 		"power of 2 to round up root volume size")
 	scanFilename = flag.String("scanFilename", "",
 		"Name of file to write scanned VM root to")
+	snapshotInterval = flag.Duration("snapshotInterval", 0,
+		"Interval between scheduled snapshots (default none)")
 	snapshotName     = flag.String("snapshotName", "", "Optional snapshot name")
 	snapshotRootOnly = flag.Bool("snapshotRootOnly", false,
 		"If true, snapshot only the root volume")
+	snapshotsToKeep = flag.Uint("snapshotsToKeep", 7,
+		"Number of scheduled snapshots to keep")
 	traceMetadata = flag.Bool("traceMetadata", false,
 		"If true, trace metadata calls until interrupted")
 	userDataFile = flag.String("userDataFile", "",
@@ -143,12 +162,14 @@ var (
 	volumeFormat hyper_proto.VolumeFormat
 	volumeIndex  = flag.Uint("volumeIndex", 0,
 		"Index of volume to get or delete")
-	volumeIndices    flagutil.UintList
-	volumeInterfaces volumeInterfaceList
-	volumeSize       flagutil.Size
-	volumeTypes      volumeTypeList
-	watchdogAction   hyper_proto.WatchdogAction
-	watchdogModel    hyper_proto.WatchdogModel
+	volumeIndices        flagutil.UintList
+	volumeInterfaces     volumeInterfaceList
+	volumeBytesPerSecond flagutil.SizeList
+	volumeOpsPerSecond   flagutil.UintList
+	volumeSize           flagutil.Size
+	volumeTypes          volumeTypeList
+	watchdogAction       hyper_proto.WatchdogAction
+	watchdogModel        hyper_proto.WatchdogModel
 
 	logger   log.DebugLogger
 	rrDialer *rrdialer.Dialer
@@ -166,6 +187,8 @@ func init() {
 	flag.Var(&memory, "memory", "memory (default 1GiB)")
 	flag.Var(&minFreeBytes, "minFreeBytes",
 		"minimum number of free bytes in root volume")
+	flag.Var(&networkBytesPerSecond, "networkBytesPerSecond",
+		"Network bandwidth limit in each direction (default unlimited)")
 	flag.Var(&placement, "placement",
 		"Placement choice when selecting Hypervisor to create/copy/move VM")
 	flag.Var(&ownerGroups, "ownerGroups", "Groups who own the VM")
@@ -178,11 +201,15 @@ func init() {
 		"Indices for volume backing stores")
 	flag.Var(&vmTags, "vmTags", "Tags to apply to VM")
 	flag.Var(&vmTagsToMatch, "vmTagsToMatch", "Tags to match when listing")
+	flag.Var(&volumeBytesPerSecond, "volumeBytesPerSecond",
+		"I/O bandwidth limits for volumes (default unlimited)")
 	flag.Var(&volumeFormat, "volumeFormat",
-		"Format of image provided by file or URL (default raw)")
+		"Format of image provided by file or URL (default raw). If qcow2 with imageName, create root as overlay on shared image base")
 	flag.Var(&volumeIndices, "volumeIndices", "Index of volumes")
 	flag.Var(&volumeInterfaces, "volumeInterfaces",
 		"Interfaces (device type presented to VM) for volumes (default virtio)")
+	flag.Var(&volumeOpsPerSecond, "volumeOpsPerSecond",
+		"I/O operation rate limits for volumes (default unlimited)")
 	flag.Var(&volumeSize, "volumeSize", "New size of specified volume")
 	flag.Var(&volumeTypes, "volumeTypes",
 		"Types for volumes (default persistent)")
@@ -203,6 +230,7 @@ func printUsage() {
 
 var subcommands = []commands.Command{
 	{"add-vm-volumes", "IPaddr", 1, 1, addVmVolumesSubcommand},
+	{"backup-vm", "IPaddr", 1, 1, backupVmSubcommand},
 	{"become-primary-vm-owner", "IPaddr", 1, 1, becomePrimaryVmOwnerSubcommand},
 	{"change-vm-console-type", "IPaddr", 1, 1, changeVmConsoleTypeSubcommand},
 	{"change-vm-cpu-priority", "IPaddr", 1, 1, changeVmCpuPrioritySubcommand},
@@ -210,6 +238,7 @@ var subcommands = []commands.Command{
 	{"change-vm-destroy-protection", "IPaddr", 1, 1,
 		changeVmDestroyProtectionSubcommand},
 	{"change-vm-hostname", "IPaddr", 1, 1, changeVmHostnameSubcommand},
+	{"change-vm-io-limits", "IPaddr", 1, 1, changeVmIoLimitsSubcommand},
 	{"change-vm-machine-type", "IPaddr", 1, 1, changeVmMachineTypeSubcommand},
 	{"change-vm-memory", "IPaddr", 1, 1, changeVmMemorySubcommand},
 	{"change-vm-owner-groups", "IPaddr", 1, 1, changeVmOwnerGroupsSubcommand},
@@ -240,6 +269,7 @@ var subcommands = []commands.Command{
 	{"get-vm-hypervisor", "IPaddr", 1, 1, getVmHypervisorSubcommand},
 	{"get-vm-info", "IPaddr", 1, 1, getVmInfoSubcommand},
 	{"get-vm-infos", "", 0, 0, getVmInfosSubcommand},
+	{"get-vm-stats", "IPaddr", 1, 1, getVmStatsSubcommand},
 	{"get-vm-user-data", "IPaddr", 1, 1, getVmUserDataSubcommand},
 	{"get-vm-volume", "IPaddr", 1, 1, getVmVolumeSubcommand},
 	{"import-local-vm", "info-file root-volume", 2, 2, importLocalVmSubcommand},
@@ -260,6 +290,8 @@ var subcommands = []commands.Command{
 	{"replace-vm-image", "IPaddr", 1, 1, replaceVmImageSubcommand},
 	{"replace-vm-user-data", "IPaddr", 1, 1, replaceVmUserDataSubcommand},
 	{"restore-vm", "source", 1, 1, restoreVmSubcommand},
+	{"restore-vm-from-backup", "manifestHash", 1, 1,
+		restoreVmFromBackupSubcommand},
 	{"restore-vm-from-snapshot", "IPaddr", 1, 1,
 		restoreVmFromSnapshotSubcommand},
 	{"restore-vm-image", "IPaddr", 1, 1, restoreVmImageSubcommand},
@@ -267,6 +299,7 @@ var subcommands = []commands.Command{
 	{"save-vm", "IPaddr destination", 2, 2, saveVmSubcommand},
 	{"scan-vm-root", "IPaddr", 1, 1, scanVmRootSubcommand},
 	{"set-vm-migrating", "IPaddr", 1, 1, setVmMigratingSubcommand},
+	{"set-vm-snapshot-policy", "IPaddr", 1, 1, setVmSnapshotPolicySubcommand},
 	{"snapshot-vm", "IPaddr", 1, 1, snapshotVmSubcommand},
 	{"start-vm", "IPaddr", 1, 1, startVmSubcommand},
 	{"stop-vm", "IPaddr", 1, 1, stopVmSubcommand},
@@ -50,10 +50,11 @@ func migrateVmFromHypervisor(sourceHypervisorAddress string, vmIP net.IP,
 		return err
 	}
 	defer hyperclient.DiscardVmAccessToken(sourceHypervisor, vmIP, nil)
-	destHypervisorAddress, err := getHypervisorAddress(vmInfo, logger)
+	destHypervisorAddress, release, err := getHypervisorAddress(vmInfo, logger)
 	if err != nil {
 		return err
 	}
+	defer release()
 	destHypervisor, err := dialHypervisor(destHypervisorAddress)
 	if err != nil {
 		return err
@@ -61,10 +62,13 @@ func migrateVmFromHypervisor(sourceHypervisorAddress string, vmIP net.IP,
 	defer destHypervisor.Close()
 	logger.Debugf(0, "migrating VM to %s\n", destHypervisorAddress)
 	request := hyper_proto.MigrateVmRequest{
-		AccessToken:      accessToken,
-		IpAddress:        vmIP,
-		SkipMemoryCheck:  *skipMemoryCheck,
-		SourceHypervisor: sourceHypervisorAddress,
+		AccessToken:            accessToken,
+		IpAddress:              vmIP,
+		Live:                   *liveMigration,
+		LiveConvergenceTimeout: *liveMigrationTimeout,
+		LiveMaxDowntime:        *liveMigrationMaxDowntime,
+		SkipMemoryCheck:        *skipMemoryCheck,
+		SourceHypervisor:       sourceHypervisorAddress,
 	}
 	return hyperclient.MigrateVm(destHypervisor, request, func() bool {
 		return requestCommit(logger)
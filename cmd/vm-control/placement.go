@@ -10,6 +10,7 @@ import (
 	"sort"
 	"time"
 
+	fm_client "github.com/Cloud-Foundations/Dominator/fleetmanager/client"
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/json"
@@ -32,17 +33,19 @@ const (
 	placementChoiceEmptiest
 	placmentChoiceFullest
 	placementChoiceRandom
+	placementChoiceFleetManager
 
 	placementTypeUnknown = "UNKNOWN placementType"
 )
 
 var (
 	placementTypeToText = map[placementType]string{
-		placementChoiceAny:      "any",
-		placementChoiceCommand:  "command",
-		placementChoiceEmptiest: "emptiest",
-		placmentChoiceFullest:   "fullest",
-		placementChoiceRandom:   "random",
+		placementChoiceAny:          "any",
+		placementChoiceCommand:      "command",
+		placementChoiceEmptiest:     "emptiest",
+		placmentChoiceFullest:       "fullest",
+		placementChoiceRandom:       "random",
+		placementChoiceFleetManager: "fleet-manager",
 	}
 	textToPlacementType map[string]placementType
 )
@@ -109,27 +112,53 @@ func freeStorage(hypervisor fm_proto.Hypervisor) uint64 {
 	return hypervisor.TotalVolumeBytes - hypervisor.AllocatedVolumeBytes
 }
 
+// getHypervisorAddress will select a Hypervisor for the VM. The returned
+// function must be called once the VM has been created (or the creation
+// failed) to release any resources reserved by the Fleet Manager.
 func getHypervisorAddress(vmInfo hyper_proto.VmInfo,
-	logger log.DebugLogger) (string, error) {
+	logger log.DebugLogger) (string, func(), error) {
 	if *hypervisorHostname != "" {
 		return fmt.Sprintf("%s:%d", *hypervisorHostname, *hypervisorPortNum),
-			nil
+			func() {}, nil
 	}
-	client, err := dialFleetManager(fmt.Sprintf("%s:%d",
-		*fleetManagerHostname, *fleetManagerPortNum))
+	fleetManagerAddress := fmt.Sprintf("%s:%d",
+		*fleetManagerHostname, *fleetManagerPortNum)
+	client, err := dialFleetManager(fleetManagerAddress)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer client.Close()
 	if *adjacentVM != "" {
 		if adjacentVmIpAddr, err := lookupIP(*adjacentVM); err != nil {
-			return "", err
+			return "", nil, err
 		} else {
-			return findHypervisorClient(client, adjacentVmIpAddr)
+			address, err := findHypervisorClient(client, adjacentVmIpAddr)
+			return address, func() {}, err
 		}
 	}
+	if placement == placementChoiceFleetManager {
+		if vmInfo.SubnetId == "" {
+			vmInfo.SubnetId = *subnetId
+		}
+		reply, err := fm_client.PlaceVm(client, fm_proto.PlaceVmRequest{
+			HypervisorTagsToMatch: hypervisorTagsToMatch,
+			Location:              *location,
+			VmInfo:                vmInfo,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		release := func() {
+			err := releaseVmPlacement(fleetManagerAddress, reply.ReservationId)
+			if err != nil {
+				logger.Printf("error releasing placement: %s\n", err)
+			}
+		}
+		return reply.HypervisorAddress, release, nil
+	}
 	if placement == placementChoiceAny { // Really dumb placement.
-		return selectAnyHypervisor(client)
+		address, err := selectAnyHypervisor(client)
+		return address, func() {}, err
 	}
 	request := fm_proto.GetHypervisorsInLocationRequest{
 		HypervisorTagsToMatch: hypervisorTagsToMatch,
@@ -141,18 +170,29 @@ func getHypervisorAddress(vmInfo hyper_proto.VmInfo,
 	err = client.RequestReply("FleetManager.GetHypervisorsInLocation",
 		request, &reply)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	if reply.Error != "" {
-		return "", errors.New(reply.Error)
+		return "", nil, errors.New(reply.Error)
 	}
 	hypervisors := findHypervisorsWithCapacity(reply.Hypervisors, vmInfo)
 	hypervisor, err := selectHypervisor(client, hypervisors, vmInfo, logger)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	address := fmt.Sprintf("%s:%d",
+		hypervisor.Hostname, constants.HypervisorPortNumber)
+	return address, func() {}, nil
+}
+
+func releaseVmPlacement(fleetManagerAddress string,
+	reservationId uint64) error {
+	client, err := dialFleetManager(fleetManagerAddress)
+	if err != nil {
+		return err
 	}
-	return fmt.Sprintf("%s:%d",
-		hypervisor.Hostname, constants.HypervisorPortNumber), nil
+	defer client.Close()
+	return fm_client.ReleaseVmPlacement(client, reservationId)
 }
 
 func selectAnyHypervisor(client *srpc.Client) (string, error) {
@@ -129,9 +129,14 @@ func restoreVm(source string, logger log.DebugLogger) error {
 		return fmt.Errorf("unknown scheme: %s", u.Scheme)
 	}
 	defer restorer.Close()
+	return restoreVmFromRestorer(restorer, source, logger)
+}
+
+func restoreVmFromRestorer(restorer vmRestorer, source string,
+	logger log.DebugLogger) error {
 	logger.Debugln(0, "reading metadata")
 	var vmInfo proto.VmInfo
-	err = decodeJsonFromVmRestorer(restorer, "info.json", &vmInfo)
+	err := decodeJsonFromVmRestorer(restorer, "info.json", &vmInfo)
 	if err != nil {
 		return err
 	}
@@ -151,10 +156,11 @@ func restoreVm(source string, logger log.DebugLogger) error {
 		UserDataSize:         uint64(len(userData)),
 		VmInfo:               vmInfo,
 	}
-	hypervisor, err := getHypervisorAddress(request.VmInfo, logger)
+	hypervisor, release, err := getHypervisorAddress(request.VmInfo, logger)
 	if err != nil {
 		return err
 	}
+	defer release()
 	logger.Debugf(0, "restoring VM on %s\n", hypervisor)
 	return restoreVmOnHypervisor(hypervisor, request, restorer, userData,
 		source, logger)
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	objclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type backupRestorer struct {
+	manifest  proto.VmBackupManifest
+	objClient *objclient.ObjectClient
+}
+
+type backupVolumeReader struct {
+	buffer        []byte
+	chunks        []*proto.VmBackupChunk
+	chunkSize     uint64
+	objectsReader objectserver.ObjectsReader
+	remaining     uint64
+}
+
+func restoreVmFromBackupSubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := restoreVmFromBackup(args[0], logger); err != nil {
+		return fmt.Errorf("error restoring VM from backup: %s", err)
+	}
+	return nil
+}
+
+func restoreVmFromBackup(manifestHashText string,
+	logger log.DebugLogger) error {
+	if *backupObjectServer == "" {
+		return errors.New("no -backupObjectServer specified")
+	}
+	var manifestHash hash.Hash
+	if err := manifestHash.UnmarshalText([]byte(manifestHashText)); err != nil {
+		return err
+	}
+	restorer, err := newBackupRestorer(*backupObjectServer, manifestHash)
+	if err != nil {
+		return err
+	}
+	defer restorer.Close()
+	return restoreVmFromRestorer(restorer, "backup:"+manifestHashText,
+		logger)
+}
+
+func newBackupRestorer(objectServer string,
+	manifestHash hash.Hash) (*backupRestorer, error) {
+	objClient := objclient.NewObjectClient(objectServer)
+	_, reader, err := objClient.GetObject(manifestHash)
+	if err != nil {
+		objClient.Close()
+		return nil, err
+	}
+	defer reader.Close()
+	restorer := &backupRestorer{objClient: objClient}
+	if err := json.NewDecoder(reader).Decode(&restorer.manifest); err != nil {
+		objClient.Close()
+		return nil, err
+	}
+	if len(restorer.manifest.Volumes) != len(restorer.manifest.VmInfo.Volumes) {
+		objClient.Close()
+		return nil, errors.New("manifest volume count mismatch")
+	}
+	return restorer, nil
+}
+
+func (restorer *backupRestorer) Close() error {
+	return restorer.objClient.Close()
+}
+
+func (restorer *backupRestorer) OpenReader(filename string) (
+	io.ReadCloser, uint64, error) {
+	switch filename {
+	case "info.json":
+		data, err := json.Marshal(restorer.manifest.VmInfo)
+		if err != nil {
+			return nil, 0, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(data)), uint64(len(data)), nil
+	case "user-data.raw":
+		if restorer.manifest.UserData == nil {
+			return nil, 0, &os.PathError{
+				Op:   "open",
+				Path: filename,
+				Err:  os.ErrNotExist,
+			}
+		}
+		size, reader, err := restorer.objClient.GetObject(
+			*restorer.manifest.UserData)
+		return reader, size, err
+	case "root":
+		return restorer.openVolume(0)
+	}
+	if strings.HasPrefix(filename, "secondary-volume.") {
+		index, err := strconv.ParseUint(
+			filename[len("secondary-volume."):], 10, 32)
+		if err != nil {
+			return nil, 0, err
+		}
+		return restorer.openVolume(int(index) + 1)
+	}
+	return nil, 0, &os.PathError{Op: "open", Path: filename,
+		Err: os.ErrNotExist}
+}
+
+func (restorer *backupRestorer) openVolume(index int) (
+	io.ReadCloser, uint64, error) {
+	if index >= len(restorer.manifest.Volumes) {
+		return nil, 0, fmt.Errorf("volume: %d not in backup", index)
+	}
+	volume := restorer.manifest.Volumes[index]
+	hashes := make([]hash.Hash, 0, len(volume.Chunks))
+	for _, chunk := range volume.Chunks {
+		if chunk != nil {
+			hashes = append(hashes, chunk.CompressedHash)
+		}
+	}
+	var objectsReader objectserver.ObjectsReader
+	if len(hashes) > 0 {
+		var err error
+		objectsReader, err = restorer.objClient.GetObjects(hashes)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return &backupVolumeReader{
+		chunks:        volume.Chunks,
+		chunkSize:     restorer.manifest.ChunkSize,
+		objectsReader: objectsReader,
+		remaining:     volume.Size,
+	}, volume.Size, nil
+}
+
+func (r *backupVolumeReader) Close() error {
+	if r.objectsReader == nil {
+		return nil
+	}
+	return r.objectsReader.Close()
+}
+
+func (r *backupVolumeReader) Read(p []byte) (int, error) {
+	if len(r.buffer) < 1 {
+		if r.remaining < 1 {
+			return 0, io.EOF
+		}
+		if err := r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	nCopied := copy(p, r.buffer)
+	r.buffer = r.buffer[nCopied:]
+	return nCopied, nil
+}
+
+// nextChunk loads the next chunk into the buffer, decompressing and verifying
+// the data.
+func (r *backupVolumeReader) nextChunk() error {
+	if len(r.chunks) < 1 {
+		return errors.New("ran out of chunks")
+	}
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	length := r.chunkSize
+	if length > r.remaining {
+		length = r.remaining
+	}
+	r.remaining -= length
+	if chunk == nil {
+		r.buffer = make([]byte, length)
+		return nil
+	}
+	_, reader, err := r.objectsReader.NextObject()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decompressor, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(decompressor)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+		return err
+	}
+	if uint64(len(data)) != length {
+		return fmt.Errorf("chunk length: %d != expected: %d",
+			len(data), length)
+	}
+	var hashVal hash.Hash
+	hasher := sha512.New()
+	hasher.Write(data)
+	copy(hashVal[:], hasher.Sum(nil))
+	if hashVal != chunk.Hash {
+		return fmt.Errorf("chunk hash mismatch: %x != %x", hashVal, chunk.Hash)
+	}
+	r.buffer = data
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func setVmSnapshotPolicySubcommand(args []string,
+	logger log.DebugLogger) error {
+	if err := setVmSnapshotPolicy(args[0], logger); err != nil {
+		return fmt.Errorf("error setting VM snapshot policy: %s", err)
+	}
+	return nil
+}
+
+// makeSnapshotPolicy returns the snapshot policy specified on the command
+// line, or nil if no snapshot interval was specified.
+func makeSnapshotPolicy() *proto.SnapshotPolicy {
+	if *snapshotInterval <= 0 {
+		return nil
+	}
+	return &proto.SnapshotPolicy{
+		Interval:        *snapshotInterval,
+		NumToKeep:       *snapshotsToKeep,
+		RootOnly:        *snapshotRootOnly,
+		SnapshotRunning: *forceIfNotStopped,
+	}
+}
+
+func setVmSnapshotPolicy(vmHostname string, logger log.DebugLogger) error {
+	if vmIP, hypervisor, err := lookupVmAndHypervisor(vmHostname); err != nil {
+		return err
+	} else {
+		return setVmSnapshotPolicyOnHypervisor(hypervisor, vmIP, logger)
+	}
+}
+
+func setVmSnapshotPolicyOnHypervisor(hypervisor string, ipAddr net.IP,
+	logger log.DebugLogger) error {
+	request := proto.SetVmSnapshotPolicyRequest{
+		IpAddress:      ipAddr,
+		SnapshotPolicy: makeSnapshotPolicy(),
+	}
+	client, err := dialHypervisor(hypervisor)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return hyperclient.SetVmSnapshotPolicy(client, request)
+}
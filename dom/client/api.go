@@ -7,6 +7,14 @@ import (
 	subproto "github.com/Cloud-Foundations/Dominator/proto/sub"
 )
 
+func AbortRollout(client srpc.ClientI, imageName string) error {
+	return abortRollout(client, imageName)
+}
+
+func ClearBadImage(client srpc.ClientI, imageName string) error {
+	return clearBadImage(client, imageName)
+}
+
 func ClearSafetyShutoff(client srpc.ClientI, subHostname string) error {
 	return clearSafetyShutoff(client, subHostname)
 }
@@ -46,11 +54,32 @@ func GetSubsConfiguration(client srpc.ClientI) (subproto.Configuration, error) {
 	return getSubsConfiguration(client)
 }
 
+func ListRollouts(client srpc.ClientI) ([]proto.RolloutState, error) {
+	return listRollouts(client)
+}
+
 func ListSubs(client srpc.ClientI, request proto.ListSubsRequest) (
 	[]string, error) {
 	return listSubs(client, request)
 }
 
+func PauseRollout(client srpc.ClientI, imageName string) error {
+	return pauseRollout(client, imageName)
+}
+
+func PlanUpdate(client srpc.ClientI, request proto.PlanUpdateRequest) (
+	[]proto.UpdatePlan, error) {
+	return planUpdate(client, request)
+}
+
+func ResumeRollout(client srpc.ClientI, imageName string) error {
+	return resumeRollout(client, imageName)
+}
+
 func SetDefaultImage(client srpc.ClientI, imageName string) error {
 	return setDefaultImage(client, imageName)
 }
+
+func StartRollout(client srpc.ClientI, policy proto.RolloutPolicy) error {
+	return startRollout(client, policy)
+}
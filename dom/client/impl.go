@@ -10,6 +10,18 @@ import (
 	subproto "github.com/Cloud-Foundations/Dominator/proto/sub"
 )
 
+func abortRollout(client srpc.ClientI, imageName string) error {
+	request := proto.AbortRolloutRequest{ImageName: imageName}
+	var reply proto.AbortRolloutResponse
+	return client.RequestReply("Dominator.AbortRollout", request, &reply)
+}
+
+func clearBadImage(client srpc.ClientI, imageName string) error {
+	request := proto.ClearBadImageRequest{ImageName: imageName}
+	var reply proto.ClearBadImageResponse
+	return client.RequestReply("Dominator.ClearBadImage", request, &reply)
+}
+
 func clearSafetyShutoff(client srpc.ClientI, subHostname string) error {
 	request := proto.ClearSafetyShutoffRequest{Hostname: subHostname}
 	var reply proto.ClearSafetyShutoffResponse
@@ -112,6 +124,16 @@ func getSubsConfiguration(client srpc.ClientI) (subproto.Configuration, error) {
 	return subproto.Configuration(reply), nil
 }
 
+func listRollouts(client srpc.ClientI) ([]proto.RolloutState, error) {
+	var request proto.ListRolloutsRequest
+	var reply proto.ListRolloutsResponse
+	err := client.RequestReply("Dominator.ListRollouts", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Rollouts, nil
+}
+
 func listSubs(client srpc.ClientI, request proto.ListSubsRequest) (
 	[]string, error) {
 	var reply proto.ListSubsResponse
@@ -125,9 +147,40 @@ func listSubs(client srpc.ClientI, request proto.ListSubsRequest) (
 	return reply.Hostnames, nil
 }
 
+func pauseRollout(client srpc.ClientI, imageName string) error {
+	request := proto.PauseRolloutRequest{ImageName: imageName}
+	var reply proto.PauseRolloutResponse
+	return client.RequestReply("Dominator.PauseRollout", request, &reply)
+}
+
+func planUpdate(client srpc.ClientI, request proto.PlanUpdateRequest) (
+	[]proto.UpdatePlan, error) {
+	var reply proto.PlanUpdateResponse
+	err := client.RequestReply("Dominator.PlanUpdate", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.Plans, nil
+}
+
+func resumeRollout(client srpc.ClientI, imageName string) error {
+	request := proto.ResumeRolloutRequest{ImageName: imageName}
+	var reply proto.ResumeRolloutResponse
+	return client.RequestReply("Dominator.ResumeRollout", request, &reply)
+}
+
 func setDefaultImage(client srpc.ClientI, imageName string) error {
 	request := proto.SetDefaultImageRequest{ImageName: imageName}
 	var reply proto.SetDefaultImageResponse
 	err := client.RequestReply("Dominator.SetDefaultImage", request, &reply)
 	return err
 }
+
+func startRollout(client srpc.ClientI, policy proto.RolloutPolicy) error {
+	request := proto.StartRolloutRequest{RolloutPolicy: policy}
+	var reply proto.StartRolloutResponse
+	return client.RequestReply("Dominator.StartRollout", request, &reply)
+}
@@ -74,6 +74,7 @@ const (
 	statusRebootBlocked
 	statusWaitingForNextFullPoll
 	statusSynced
+	statusHealthCheckFailed
 )
 
 type HtmlWriter interface {
@@ -110,6 +111,7 @@ type Sub struct {
 	isInsecure                   bool
 	status                       subStatus
 	publishedStatus              subStatus
+	imageMarkedBad               bool // Updated only by sub goroutine.
 	pendingForceDisruptiveUpdate bool
 	pendingSafetyClear           bool
 	lastAddress                  string
@@ -125,6 +127,7 @@ type Sub struct {
 	lastPollWasFull              bool
 	lastScanDuration             time.Duration
 	lastComputeUpdateCpuDuration time.Duration
+	lastUpdateHadTriggerFailures bool
 	lastUpdateTime               time.Time
 	lastSyncTime                 time.Time
 	lastSuccessfulImageName      string
@@ -154,13 +157,19 @@ type Herd struct {
 	subsByName               map[string]*Sub
 	subsByIndex              []*Sub // Sorted by Sub.hostname.
 	pollSemaphore            chan struct{}
+	planSemaphore            chan struct{}
 	fastUpdateSemaphore      chan struct{}
 	pushSemaphore            chan struct{}
+	badImagesMutex           sync.RWMutex // Protect badImages.
+	badImages                map[string]map[string]badImageType
+	rolloutsMutex            sync.RWMutex            // Protect rollouts.
+	rollouts                 map[string]*rolloutType // Key: ToImage.
 	cpuSharer                *cpusharer.FifoCpuSharer
 	dialer                   net.Dialer
 	currentScanStartTime     time.Time
 	previousScanDuration     time.Duration
 	scanCounter              uint64
+	stateDir                 string
 	subdInstallerQueueAdd    chan<- string
 	subdInstallerQueueDelete chan<- string
 	subdInstallerQueueErase  chan<- string
@@ -177,10 +186,18 @@ func NewHerd(imageServerAddress string, objectServer objectserver.ObjectServer,
 	return newHerd(imageServerAddress, objectServer, metricsDir, logger)
 }
 
+func (herd *Herd) AbortRollout(imageName, username string) error {
+	return herd.abortRollout(imageName, username)
+}
+
 func (herd *Herd) AddHtmlWriter(htmlWriter HtmlWriter) {
 	herd.addHtmlWriter(htmlWriter)
 }
 
+func (herd *Herd) ClearBadImage(imageName string) error {
+	return herd.clearBadImage(imageName)
+}
+
 func (herd *Herd) ClearSafetyShutoff(hostname string,
 	authInfo *srpc.AuthInformation) error {
 	return herd.clearSafetyShutoff(hostname, authInfo)
@@ -221,6 +238,10 @@ func (herd *Herd) GetInfoForSubs(request domproto.GetInfoForSubsRequest) (
 	return herd.getInfoForSubs(request)
 }
 
+func (herd *Herd) ListRollouts() []domproto.RolloutState {
+	return herd.listRollouts()
+}
+
 func (herd *Herd) ListSubs(request domproto.ListSubsRequest) ([]string, error) {
 	return herd.listSubs(request)
 }
@@ -233,10 +254,23 @@ func (herd *Herd) MdbUpdate(mdb *mdb.Mdb) {
 	herd.mdbUpdate(mdb)
 }
 
+func (herd *Herd) PauseRollout(imageName, username string) error {
+	return herd.pauseRollout(imageName, username)
+}
+
+func (herd *Herd) PlanUpdate(request domproto.PlanUpdateRequest) (
+	[]domproto.UpdatePlan, error) {
+	return herd.planUpdate(request)
+}
+
 func (herd *Herd) PollNextSub() bool {
 	return herd.pollNextSub()
 }
 
+func (herd *Herd) ResumeRollout(imageName string) error {
+	return herd.resumeRollout(imageName)
+}
+
 func (herd *Herd) RLockWithTimeout(timeout time.Duration) {
 	herd.rLockWithTimeout(timeout)
 }
@@ -245,6 +279,17 @@ func (herd *Herd) SetDefaultImage(imageName string) error {
 	return herd.setDefaultImage(imageName)
 }
 
+// SetStateDirectory sets the directory where the herd state is saved and
+// loads the saved state.
+func (herd *Herd) SetStateDirectory(dirname string) error {
+	return herd.setStateDirectory(dirname)
+}
+
+func (herd *Herd) StartRollout(policy domproto.RolloutPolicy,
+	username string) error {
+	return herd.startRollout(policy, username)
+}
+
 func (herd *Herd) StartServer(portNum uint, daemon bool) error {
 	return herd.startServer(portNum, daemon)
 }
@@ -0,0 +1,134 @@
+package herd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+)
+
+const (
+	badImagesFilename = "badImages.json"
+)
+
+var (
+	badImageGroupTag = flag.String("badImageGroupTag", "HostGroup",
+		"MDB tag grouping subs which share images marked bad by health checks")
+)
+
+// badImageType records why an image was marked bad for a group of subs. The
+// herd keeps these in a map keyed by image name and then by group.
+type badImageType struct {
+	Hostname string
+	Reason   string
+	Time     time.Time
+}
+
+func (herd *Herd) clearBadImage(imageName string) error {
+	herd.badImagesMutex.Lock()
+	defer herd.badImagesMutex.Unlock()
+	if _, ok := herd.badImages[imageName]; !ok {
+		return errors.New("image not marked bad: " + imageName)
+	}
+	delete(herd.badImages, imageName)
+	herd.writeBadImagesWithLock()
+	herd.logger.Printf("Cleared bad image: %s\n", imageName)
+	return nil
+}
+
+func (herd *Herd) isImageBad(group, imageName string) bool {
+	herd.badImagesMutex.RLock()
+	defer herd.badImagesMutex.RUnlock()
+	_, ok := herd.badImages[imageName][group]
+	return ok
+}
+
+func (herd *Herd) loadBadImages() error {
+	var badImages map[string]map[string]badImageType
+	filename := filepath.Join(herd.stateDir, badImagesFilename)
+	if err := json.ReadFromFile(filename, &badImages); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	herd.badImagesMutex.Lock()
+	defer herd.badImagesMutex.Unlock()
+	for imageName, groups := range badImages {
+		herd.badImages[imageName] = groups
+	}
+	return nil
+}
+
+func (herd *Herd) markImageBad(group, imageName, hostname, reason string) {
+	herd.badImagesMutex.Lock()
+	defer herd.badImagesMutex.Unlock()
+	groups := herd.badImages[imageName]
+	if groups == nil {
+		groups = make(map[string]badImageType)
+		herd.badImages[imageName] = groups
+	}
+	if _, ok := groups[group]; ok {
+		return
+	}
+	groups[group] = badImageType{
+		Hostname: hostname,
+		Reason:   reason,
+		Time:     time.Now(),
+	}
+	herd.writeBadImagesWithLock()
+	herd.logger.Printf("Marked image: %s bad for group: %s\n", imageName, group)
+}
+
+// This must be called with the lock held.
+func (herd *Herd) writeBadImagesWithLock() {
+	if herd.stateDir == "" {
+		return
+	}
+	filename := filepath.Join(herd.stateDir, badImagesFilename)
+	err := json.WriteToFile(filename, 0644, "    ", herd.badImages)
+	if err != nil {
+		herd.logger.Printf("Error writing bad images: %s\n", err)
+	}
+}
+
+func (herd *Herd) writeBadImagesHtml(writer io.Writer) {
+	herd.badImagesMutex.RLock()
+	defer herd.badImagesMutex.RUnlock()
+	imageNames := make([]string, 0, len(herd.badImages))
+	for imageName := range herd.badImages {
+		imageNames = append(imageNames, imageName)
+	}
+	sort.Strings(imageNames)
+	for _, imageName := range imageNames {
+		groups := herd.badImages[imageName]
+		groupNames := make([]string, 0, len(groups))
+		for group := range groups {
+			groupNames = append(groupNames, group)
+		}
+		sort.Strings(groupNames)
+		fmt.Fprintf(writer,
+			"<font color=\"red\">Bad image</font>: "+
+				"<a href=\"http://%s/showImage?%s\">%s</a>",
+			herd.imageManager, imageName, imageName)
+		fmt.Fprintf(writer, " for groups: %s<br>\n",
+			strings.Join(groupNames, ", "))
+	}
+}
+
+// getBadImageGroup returns the group of subs which share images marked bad
+// when the health check for this sub fails. If the MDB tag for the group is
+// not defined for the sub, the group is the sub alone.
+func (sub *Sub) getBadImageGroup() string {
+	if group := sub.mdb.Tags[*badImageGroupTag]; group != "" {
+		return group
+	}
+	return sub.mdb.Hostname
+}
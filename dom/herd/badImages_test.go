@@ -0,0 +1,60 @@
+package herd
+
+import (
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/mdb"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+)
+
+func TestMarkImageBad(t *testing.T) {
+	herd := &Herd{
+		badImages: make(map[string]map[string]badImageType),
+		logger:    testlogger.New(t),
+	}
+	subA := &Sub{herd: herd, mdb: mdb.Machine{
+		Hostname: "a",
+		Tags:     tags.Tags{*badImageGroupTag: "web"},
+	}}
+	subB := &Sub{herd: herd, mdb: mdb.Machine{
+		Hostname: "b",
+		Tags:     tags.Tags{*badImageGroupTag: "web"},
+	}}
+	subC := &Sub{herd: herd, mdb: mdb.Machine{Hostname: "c"}}
+	if group := subC.getBadImageGroup(); group != "c" {
+		t.Errorf("group: %s, expected: c", group)
+	}
+	herd.markImageBad(subA.getBadImageGroup(), "image", "a", "failed")
+	if !herd.isImageBad(subB.getBadImageGroup(), "image") {
+		t.Error("image not bad for sub in same group")
+	}
+	if herd.isImageBad(subC.getBadImageGroup(), "image") {
+		t.Error("image bad for sub in other group")
+	}
+	if herd.isImageBad(subA.getBadImageGroup(), "other") {
+		t.Error("other image bad")
+	}
+	// The first failure is kept.
+	herd.markImageBad(subB.getBadImageGroup(), "image", "b", "failed again")
+	if hostname := herd.badImages["image"]["web"].Hostname; hostname != "a" {
+		t.Errorf("hostname: %s, expected: a", hostname)
+	}
+	if err := herd.clearBadImage("image"); err != nil {
+		t.Fatal(err)
+	}
+	if herd.isImageBad(subA.getBadImageGroup(), "image") {
+		t.Error("image bad after clearing")
+	}
+	if err := herd.clearBadImage("image"); err == nil {
+		t.Error("clearing image not marked bad did not fail")
+	}
+}
+
+func TestSubStatusStrings(t *testing.T) {
+	for status := statusUnknown; status <= statusHealthCheckFailed; status++ {
+		if subStatus(status).String() == "" {
+			t.Errorf("no string for status: %d", status)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/cpusharer"
 	filegenclient "github.com/Cloud-Foundations/Dominator/lib/filegen/client"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	libnet "github.com/Cloud-Foundations/Dominator/lib/net"
 	"github.com/Cloud-Foundations/Dominator/lib/net/reverseconnection"
@@ -36,12 +37,25 @@ var (
 		"Time to wait before reattempting to install subd")
 	subdInstaller = flag.String("subdInstaller", "",
 		"Path to programme used to install subd if connections fail")
+	trustedImageSignersFile = flag.String("trustedImageSignersFile", "",
+		"Name of file containing PEM encoded certificates of trusted image "+
+			"signers. If specified, unsigned images are not pushed to subs")
 )
 
 func newHerd(imageServerAddress string, objectServer objectserver.ObjectServer,
 	metricsDir *tricorder.DirectorySpec, logger log.DebugLogger) *Herd {
 	var herd Herd
-	herd.imageManager = images.New(imageServerAddress, logger)
+	if *trustedImageSignersFile == "" {
+		herd.imageManager = images.New(imageServerAddress, logger)
+	} else {
+		trustedSigners, err := image.LoadTrustedSigners(
+			*trustedImageSignersFile)
+		if err != nil {
+			logger.Fatalf("Cannot load trusted image signers: %s\n", err)
+		}
+		herd.imageManager = images.NewWithTrustedSigners(imageServerAddress,
+			trustedSigners, logger)
+	}
 	herd.objectServer = objectServer
 	herd.computedFilesManager = filegenclient.New(objectServer, logger)
 	herd.logger = logger
@@ -50,9 +64,12 @@ func newHerd(imageServerAddress string, objectServer objectserver.ObjectServer,
 	}
 	herd.configurationForSubs.ScanExclusionList =
 		constants.ScanExcludeList
+	herd.rollouts = make(map[string]*rolloutType)
+	herd.badImages = make(map[string]map[string]badImageType)
 	herd.subsByName = make(map[string]*Sub)
 	numPollSlots := uint(runtime.NumCPU()) * *pollSlotsPerCPU
 	herd.pollSemaphore = make(chan struct{}, numPollSlots)
+	herd.planSemaphore = make(chan struct{}, runtime.NumCPU())
 	herd.pushSemaphore = make(chan struct{}, runtime.NumCPU())
 	herd.fastUpdateSemaphore = make(chan struct{}, runtime.NumCPU())
 	herd.cpuSharer = cpusharer.NewFifoCpuSharer()
@@ -63,6 +80,7 @@ func newHerd(imageServerAddress string, objectServer objectserver.ObjectServer,
 		herd.cpuSharer)
 	herd.currentScanStartTime = time.Now()
 	herd.setupMetrics(metricsDir)
+	go herd.rolloutLoop()
 	go herd.subdInstallerLoop()
 	return &herd
 }
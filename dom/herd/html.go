@@ -84,6 +84,8 @@ func (herd *Herd) writeHtml(writer io.Writer) {
 			"Default image: <a href=\"http://%s/showImage?%s\">%s</a><br>\n",
 			herd.imageManager, herd.defaultImageName, herd.defaultImageName)
 	}
+	herd.writeRolloutsHtml(writer)
+	herd.writeBadImagesHtml(writer)
 	fmt.Fprintf(writer,
 		"Number of <a href=\"listSubs\">subs</a>: <a href=\"showAllSubs\">%d</a>",
 		numSubs)
@@ -164,6 +166,8 @@ func (herd *Herd) writeHtml(writer io.Writer) {
 	//len(herd.connectionSemaphore), cap(herd.connectionSemaphore))
 	fmt.Fprintf(writer, "Poll slots: %d out of %d<br>\n",
 		len(herd.pollSemaphore), cap(herd.pollSemaphore))
+	fmt.Fprintf(writer, "Plan slots: %d out of %d<br>\n",
+		len(herd.planSemaphore), cap(herd.planSemaphore))
 	stats := herd.cpuSharer.GetStatistics()
 	timeSinceLastIdleEvent := time.Since(stats.LastIdleEvent)
 	fmt.Fprintf(writer,
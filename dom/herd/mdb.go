@@ -19,6 +19,9 @@ func (herd *Herd) mdbUpdate(mdb *mdb.Mdb) {
 	wantedImages := make(map[string]struct{})
 	wantedImages[herd.defaultImageName] = struct{}{}
 	wantedImages[herd.nextDefaultImageName] = struct{}{}
+	for _, imageName := range herd.getRolloutImageNames() {
+		wantedImages[imageName] = struct{}{}
+	}
 	for _, machine := range mdb.Machines { // Sorted by Hostname.
 		wantedImages[machine.RequiredImage] = struct{}{}
 		wantedImages[machine.PlannedImage] = struct{}{}
@@ -0,0 +1,213 @@
+package herd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/dom/lib"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/tags/tagmatcher"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+	proto "github.com/Cloud-Foundations/Dominator/proto/dominator"
+	subproto "github.com/Cloud-Foundations/Dominator/proto/sub"
+	"github.com/Cloud-Foundations/Dominator/sub/client"
+	sublib "github.com/Cloud-Foundations/Dominator/sub/lib"
+)
+
+type planSubType struct {
+	address   string
+	hostname  string
+	imageName string
+}
+
+// copyTriggers returns a copy of the triggers which may be matched without
+// disturbing the match state of the triggers shared by the image.
+func copyTriggers(imageTriggers *triggers.Triggers) *triggers.Triggers {
+	if imageTriggers == nil {
+		return nil
+	}
+	newTriggers := triggers.New()
+	newTriggers.Triggers = make([]*triggers.Trigger, 0,
+		len(imageTriggers.Triggers))
+	for _, trigger := range imageTriggers.Triggers {
+		newTrigger := *trigger
+		newTriggers.Triggers = append(newTriggers.Triggers, &newTrigger)
+	}
+	return newTriggers
+}
+
+func makeUpdatePlan(request subproto.UpdateRequest,
+	filenameToInodeTable map[string]uint64, plan *proto.UpdatePlan) {
+	addPath := func(pathname string) {
+		if _, ok := filenameToInodeTable[pathname]; ok {
+			plan.PathsToChange = append(plan.PathsToChange, pathname)
+		} else {
+			plan.PathsToAdd = append(plan.PathsToAdd, pathname)
+		}
+	}
+	for _, inode := range request.DirectoriesToMake {
+		addPath(inode.Name)
+	}
+	for _, inode := range request.InodesToMake {
+		addPath(inode.Name)
+	}
+	for _, hardlink := range request.HardlinksToMake {
+		addPath(hardlink.NewLink)
+	}
+	plan.PathsToDelete = request.PathsToDelete
+	for _, inode := range request.InodesToChange {
+		plan.PathsToChange = append(plan.PathsToChange, inode.Name)
+	}
+	matchedTriggers := sublib.MatchTriggersInUpdate(request)
+	for _, trigger := range matchedTriggers {
+		plan.Triggers = append(plan.Triggers, trigger.Service)
+	}
+	plan.HighImpact, plan.Reboot = sublib.CheckImpact(matchedTriggers)
+}
+
+// planUpdate computes the update which each selected sub would receive. The
+// herd does not retain the file-systems of subs between polls, so each sub is
+// polled again. Neither Fetch nor Update are sent. Computed files are not
+// included in the plans.
+func (herd *Herd) planUpdate(request proto.PlanUpdateRequest) (
+	[]proto.UpdatePlan, error) {
+	selectFunc := makeSelector(request.LocationsToMatch,
+		request.StatusesToMatch, tagmatcher.New(request.TagsToMatch, false))
+	var hostnames map[string]struct{}
+	if len(request.Hostnames) > 0 {
+		hostnames = make(map[string]struct{}, len(request.Hostnames))
+		for _, hostname := range request.Hostnames {
+			hostnames[hostname] = struct{}{}
+		}
+	}
+	var planSubs []planSubType
+	herd.RLock()
+	for _, sub := range herd.subsByIndex {
+		if hostnames != nil {
+			if _, ok := hostnames[sub.mdb.Hostname]; !ok {
+				continue
+			}
+		}
+		if !selectFunc(sub) {
+			continue
+		}
+		imageName := request.ImageName
+		if imageName == "" {
+			imageName = sub.mdb.RequiredImage
+		}
+		if imageName == "" {
+			imageName = herd.defaultImageName
+		}
+		planSubs = append(planSubs, planSubType{
+			address:   sub.address(),
+			hostname:  sub.mdb.Hostname,
+			imageName: imageName,
+		})
+	}
+	herd.RUnlock()
+	images := make(map[string]*image.Image)
+	imageErrors := make(map[string]error)
+	for _, planSub := range planSubs {
+		if _, ok := images[planSub.imageName]; ok {
+			continue
+		}
+		if _, ok := imageErrors[planSub.imageName]; ok {
+			continue
+		}
+		img, err := herd.getImageForPlan(planSub.imageName)
+		if err != nil {
+			if request.ImageName != "" {
+				return nil, err
+			}
+			imageErrors[planSub.imageName] = err
+		} else {
+			images[planSub.imageName] = img
+		}
+	}
+	plans := make([]proto.UpdatePlan, len(planSubs))
+	var wg sync.WaitGroup
+	for index, planSub := range planSubs {
+		plans[index].Hostname = planSub.hostname
+		plans[index].ImageName = planSub.imageName
+		if err := imageErrors[planSub.imageName]; err != nil {
+			plans[index].Error = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(planSub planSubType, plan *proto.UpdatePlan) {
+			defer wg.Done()
+			err := herd.planUpdateForSub(planSub, images[planSub.imageName],
+				plan)
+			if err != nil {
+				plan.Error = err.Error()
+			}
+		}(planSub, &plans[index])
+	}
+	wg.Wait()
+	return plans, nil
+}
+
+func (herd *Herd) getImageForPlan(imageName string) (*image.Image, error) {
+	if imageName == "" {
+		return nil, errors.New("no image specified")
+	}
+	img, err := herd.imageManager.Get(imageName, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image: %s: %s", imageName, err)
+	}
+	if img == nil {
+		return nil, fmt.Errorf("image: %s not available", imageName)
+	}
+	return img, nil
+}
+
+// planUpdateForSub polls the sub for its file-system and computes the update.
+// The plan semaphore limits the load on the dominator, including the number
+// of connections. It is separate from the poll semaphore, so that planning
+// does not delay the regular polling of subs.
+func (herd *Herd) planUpdateForSub(planSub planSubType, img *image.Image,
+	plan *proto.UpdatePlan) error {
+	herd.planSemaphore <- struct{}{}
+	defer func() { <-herd.planSemaphore }()
+	srpcClient, err := srpc.DialHTTPWithDialer("tcp", planSub.address,
+		herd.dialer)
+	if err != nil {
+		return err
+	}
+	defer srpcClient.Close()
+	if err := srpcClient.SetTimeout(5 * time.Minute); err != nil {
+		return err
+	}
+	var reply subproto.PollResponse
+	err = client.CallPoll(srpcClient, subproto.PollRequest{}, &reply)
+	if err != nil {
+		return fmt.Errorf("error polling: %s", err)
+	}
+	fs := reply.FileSystem
+	if fs == nil {
+		return errors.New("sub not ready")
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		return err
+	}
+	fs.BuildEntryMap()
+	subObj := lib.Sub{
+		Hostname:    planSub.hostname,
+		FileSystem:  fs,
+		ObjectCache: reply.ObjectCache,
+	}
+	objectsToFetch, _ := lib.BuildMissingLists(subObj, img, false, true,
+		herd.logger)
+	for _, size := range objectsToFetch {
+		plan.BytesToFetch += size
+	}
+	plan.ObjectsToFetch = uint(len(objectsToFetch))
+	var request subproto.UpdateRequest
+	lib.BuildUpdateRequest(subObj, img, &request, false, true, herd.logger)
+	request.Triggers = copyTriggers(img.Triggers)
+	makeUpdatePlan(request, fs.FilenameToInodeTable(), plan)
+	return nil
+}
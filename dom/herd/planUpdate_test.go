@@ -0,0 +1,52 @@
+package herd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+	proto "github.com/Cloud-Foundations/Dominator/proto/dominator"
+	subproto "github.com/Cloud-Foundations/Dominator/proto/sub"
+)
+
+func TestMakeUpdatePlan(t *testing.T) {
+	imageTriggers := triggers.New()
+	imageTriggers.Triggers = []*triggers.Trigger{
+		{MatchLines: []string{"/etc/ssh/.*"}, Service: "sshd", SortName: "2"},
+		{MatchLines: []string{"/boot/.*"}, Service: "kernel", SortName: "1",
+			DoReboot: true, HighImpact: true},
+		{MatchLines: []string{"/etc/unused"}, Service: "unused"},
+	}
+	request := subproto.UpdateRequest{
+		DirectoriesToMake: []subproto.Inode{{Name: "/etc/ssh"}},
+		HardlinksToMake: []subproto.Hardlink{
+			{NewLink: "/bin/link", Target: "/bin/file"},
+		},
+		InodesToChange: []subproto.Inode{{Name: "/etc/passwd"}},
+		InodesToMake: []subproto.Inode{
+			{Name: "/boot/vmlinuz"},
+			{Name: "/etc/ssh/sshd_config"},
+		},
+		PathsToDelete: []string{"/tmp/junk"},
+		Triggers:      copyTriggers(imageTriggers),
+	}
+	filenameToInodeTable := map[string]uint64{
+		"/boot/vmlinuz": 2,
+		"/etc/passwd":   3,
+		"/tmp/junk":     4,
+	}
+	var plan proto.UpdatePlan
+	makeUpdatePlan(request, filenameToInodeTable, &plan)
+	expectedPlan := proto.UpdatePlan{
+		PathsToAdd: []string{"/etc/ssh", "/etc/ssh/sshd_config",
+			"/bin/link"},
+		PathsToChange: []string{"/boot/vmlinuz", "/etc/passwd"},
+		PathsToDelete: []string{"/tmp/junk"},
+		Triggers:      []string{"kernel", "sshd"},
+		HighImpact:    true,
+		Reboot:        true,
+	}
+	if !reflect.DeepEqual(plan, expectedPlan) {
+		t.Errorf("plan: %+v, expected: %+v", plan, expectedPlan)
+	}
+}
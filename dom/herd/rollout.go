@@ -0,0 +1,525 @@
+package herd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	proto "github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+const (
+	rolloutInterval  = 10 * time.Second
+	rolloutsFilename = "rollouts.json"
+)
+
+var (
+	rolloutUnreachableTimeout = flag.Duration("rolloutUnreachableTimeout",
+		15*time.Minute,
+		"Time an updated sub may be unreachable before a rollout is halted")
+	rolloutUpdateTimeout = flag.Duration("rolloutUpdateTimeout", time.Hour,
+		"Time an admitted sub may take to update before a rollout is halted")
+)
+
+type rolloutType struct {
+	proto.RolloutState
+	admitted map[string]struct{}
+	failed   map[string]struct{} // Hosts which have halted the rollout.
+	updated  map[string]struct{}
+}
+
+type rolloutSubType struct {
+	hostname                     string
+	lastReachableTime            time.Time
+	lastSuccessfulImageName      string
+	lastUpdateHadTriggerFailures bool
+	requiredImageName            string
+	status                       subStatus
+}
+
+func isUnreachable(status subStatus) bool {
+	switch status {
+	case statusConnectionRefused,
+		statusNoRouteToHost,
+		statusConnectTimeout,
+		statusFailedToConnect,
+		statusFailedToPoll:
+		return true
+	}
+	return false
+}
+
+func listToSet(list []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(list))
+	for _, entry := range list {
+		set[entry] = struct{}{}
+	}
+	return set
+}
+
+func newRollout(state proto.RolloutState) *rolloutType {
+	return &rolloutType{
+		RolloutState: state,
+		admitted:     listToSet(state.AdmittedHosts),
+		failed:       listToSet(state.FailedHosts),
+		updated:      listToSet(state.UpdatedHosts),
+	}
+}
+
+func setToList(set map[string]struct{}) []string {
+	if len(set) < 1 {
+		return nil
+	}
+	list := make([]string, 0, len(set))
+	for entry := range set {
+		list = append(list, entry)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (herd *Herd) abortRollout(imageName, username string) error {
+	herd.rolloutsMutex.Lock()
+	defer herd.rolloutsMutex.Unlock()
+	rollout := herd.rollouts[imageName]
+	if rollout == nil {
+		return errors.New("no rollout for image: " + imageName)
+	}
+	rollout.Aborted = true
+	rollout.Paused = true
+	rollout.PausedBy = username
+	herd.writeRolloutsWithLock()
+	return nil
+}
+
+// getRolloutImageName returns the image the sub should have. If the image is
+// being rolled out and the sub has not yet been admitted to the rollout, the
+// image being replaced is returned.
+func (herd *Herd) getRolloutImageName(hostname, imageName string) string {
+	herd.rolloutsMutex.RLock()
+	defer herd.rolloutsMutex.RUnlock()
+	rollout := herd.rollouts[imageName]
+	if rollout == nil {
+		return imageName
+	}
+	if _, ok := rollout.admitted[hostname]; ok {
+		return imageName
+	}
+	return rollout.FromImage
+}
+
+// getRolloutSubs returns the state of the subs needed to manage rollouts.
+func (herd *Herd) getRolloutSubs() []rolloutSubType {
+	herd.RLock()
+	defer herd.RUnlock()
+	subs := make([]rolloutSubType, 0, len(herd.subsByIndex))
+	for _, sub := range herd.subsByIndex { // Sorted by hostname.
+		subs = append(subs, rolloutSubType{
+			hostname:                     sub.mdb.Hostname,
+			lastReachableTime:            sub.lastReachableTime,
+			lastSuccessfulImageName:      sub.lastSuccessfulImageName,
+			lastUpdateHadTriggerFailures: sub.lastUpdateHadTriggerFailures,
+			requiredImageName:            sub.mdb.RequiredImage,
+			status:                       sub.publishedStatus,
+		})
+	}
+	return subs
+}
+
+func (herd *Herd) getRolloutImageNames() []string {
+	herd.rolloutsMutex.RLock()
+	defer herd.rolloutsMutex.RUnlock()
+	imageNames := make([]string, 0, len(herd.rollouts)*2)
+	for _, rollout := range herd.rollouts {
+		imageNames = append(imageNames, rollout.FromImage, rollout.ToImage)
+	}
+	return imageNames
+}
+
+func (herd *Herd) listRollouts() []proto.RolloutState {
+	herd.rolloutsMutex.RLock()
+	defer herd.rolloutsMutex.RUnlock()
+	return herd.listRolloutsWithLock()
+}
+
+// This must be called with the lock held (a read lock is sufficient).
+func (herd *Herd) listRolloutsWithLock() []proto.RolloutState {
+	rollouts := make([]proto.RolloutState, 0, len(herd.rollouts))
+	for _, rollout := range herd.rollouts {
+		state := rollout.RolloutState
+		state.AdmittedHosts = setToList(rollout.admitted)
+		state.FailedHosts = setToList(rollout.failed)
+		state.UpdatedHosts = setToList(rollout.updated)
+		rollouts = append(rollouts, state)
+	}
+	sort.Slice(rollouts, func(left, right int) bool {
+		return rollouts[left].ToImage < rollouts[right].ToImage
+	})
+	return rollouts
+}
+
+func (herd *Herd) loadRollouts() error {
+	var rollouts []proto.RolloutState
+	filename := filepath.Join(herd.stateDir, rolloutsFilename)
+	if err := json.ReadFromFile(filename, &rollouts); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	herd.rolloutsMutex.Lock()
+	defer herd.rolloutsMutex.Unlock()
+	for _, rollout := range rollouts {
+		herd.rollouts[rollout.ToImage] = newRollout(rollout)
+	}
+	return nil
+}
+
+func (herd *Herd) pauseRollout(imageName, username string) error {
+	herd.rolloutsMutex.Lock()
+	defer herd.rolloutsMutex.Unlock()
+	rollout := herd.rollouts[imageName]
+	if rollout == nil {
+		return errors.New("no rollout for image: " + imageName)
+	}
+	if rollout.Paused {
+		return nil
+	}
+	rollout.Paused = true
+	rollout.PausedBy = username
+	herd.writeRolloutsWithLock()
+	return nil
+}
+
+func (herd *Herd) processRollouts() {
+	subs := herd.getRolloutSubs()
+	var imagesToCancel []string
+	herd.rolloutsMutex.Lock()
+	changed := false
+	for imageName, rollout := range herd.rollouts {
+		numAdmitted := len(rollout.admitted)
+		done, rolloutChanged := herd.processRollout(rollout, subs)
+		if done {
+			delete(herd.rollouts, imageName)
+			changed = true
+		} else if rolloutChanged {
+			changed = true
+		}
+		if len(rollout.admitted) > numAdmitted {
+			imagesToCancel = append(imagesToCancel, imageName)
+		}
+	}
+	if changed {
+		herd.writeRolloutsWithLock()
+	}
+	herd.rolloutsMutex.Unlock()
+	for _, imageName := range imagesToCancel {
+		herd.cancelSubs(imageName)
+	}
+}
+
+// processRollout checks the health of the subs in the rollout and admits the
+// next wave of subs if the current wave has completed. It returns whether the
+// rollout is done and whether the rollout changed.
+// This must be called with the lock held.
+func (herd *Herd) processRollout(rollout *rolloutType,
+	subs []rolloutSubType) (bool, bool) {
+	var changed bool
+	var numAdmitted, numFailed, numUpdated int
+	var notUpdated []string
+	inScope := make([]rolloutSubType, 0)
+	for _, sub := range subs {
+		if sub.requiredImageName != rollout.ToImage {
+			continue
+		}
+		inScope = append(inScope, sub)
+		if sub.lastSuccessfulImageName == rollout.ToImage {
+			// Also catches subs which were updated before the rollout started.
+			if _, ok := rollout.admitted[sub.hostname]; !ok {
+				rollout.admitted[sub.hostname] = struct{}{}
+				changed = true
+			}
+			if _, ok := rollout.updated[sub.hostname]; !ok {
+				rollout.updated[sub.hostname] = struct{}{}
+				changed = true
+			}
+		}
+		if _, ok := rollout.admitted[sub.hostname]; !ok {
+			continue
+		}
+		numAdmitted++
+		if _, ok := rollout.updated[sub.hostname]; ok {
+			numUpdated++
+		} else if _, ok := rollout.failed[sub.hostname]; ok {
+			numFailed++
+		} else {
+			notUpdated = append(notUpdated, sub.hostname)
+		}
+	}
+	if rollout.NumSubs != uint(len(inScope)) {
+		rollout.NumSubs = uint(len(inScope))
+		changed = true
+	}
+	if rollout.Aborted {
+		// Keep holding back subs until they no longer want the image.
+		return numAdmitted >= len(inScope), changed
+	}
+	if !rollout.Paused {
+		reason := rollout.checkHealth(inScope)
+		if reason == "" {
+			reason = rollout.checkStalled(notUpdated)
+		}
+		if reason != "" {
+			herd.logger.Printf("Halting rollout of: %s: %s\n",
+				rollout.ToImage, reason)
+			rollout.HaltReason = reason
+			rollout.Paused = true
+			rollout.PausedBy = ""
+			changed = true
+		}
+	}
+	// Subs which halted the rollout before updating no longer hold back the
+	// next wave once the rollout is resumed.
+	if rollout.Paused || numUpdated+numFailed < numAdmitted {
+		return false, changed
+	}
+	if len(inScope) > 0 && numUpdated >= len(inScope) &&
+		rollout.Wave > uint(len(rollout.WavePercentages)) {
+		herd.logger.Printf("Rollout of: %s completed\n", rollout.ToImage)
+		return true, true
+	}
+	if numAdmitted > 0 {
+		if rollout.WaveCompletedTime.IsZero() {
+			rollout.WaveCompletedTime = time.Now()
+			changed = true
+		}
+		if time.Since(rollout.WaveCompletedTime) < rollout.WavePause {
+			return false, changed
+		}
+	}
+	for numAdmitted < len(inScope) &&
+		rollout.Wave <= uint(len(rollout.WavePercentages)) {
+		rollout.Wave++
+		changed = true
+		target := len(inScope)
+		if rollout.Wave <= uint(len(rollout.WavePercentages)) {
+			percent := int(rollout.WavePercentages[rollout.Wave-1])
+			target = (len(inScope)*percent + 99) / 100
+		}
+		var numNew int
+		for _, sub := range inScope {
+			if numAdmitted >= target {
+				break
+			}
+			if _, ok := rollout.admitted[sub.hostname]; !ok {
+				rollout.admitted[sub.hostname] = struct{}{}
+				numAdmitted++
+				numNew++
+			}
+		}
+		if numNew > 0 {
+			herd.logger.Printf("Rollout of: %s: wave %d admitted %d subs\n",
+				rollout.ToImage, rollout.Wave, numNew)
+			rollout.WaveCompletedTime = time.Time{}
+			rollout.WaveStartTime = time.Now()
+			break
+		}
+	}
+	return false, changed
+}
+
+func (herd *Herd) resumeRollout(imageName string) error {
+	herd.rolloutsMutex.Lock()
+	defer herd.rolloutsMutex.Unlock()
+	rollout := herd.rollouts[imageName]
+	if rollout == nil {
+		return errors.New("no rollout for image: " + imageName)
+	}
+	if rollout.Aborted {
+		return errors.New("rollout for image: " + imageName + " was aborted")
+	}
+	rollout.HaltReason = ""
+	rollout.Paused = false
+	rollout.PausedBy = ""
+	rollout.WaveStartTime = time.Now() // Restart the update timeout.
+	herd.writeRolloutsWithLock()
+	return nil
+}
+
+func (herd *Herd) rolloutLoop() {
+	for ; ; time.Sleep(rolloutInterval) {
+		herd.processRollouts()
+	}
+}
+
+func (herd *Herd) setStateDirectory(dirname string) error {
+	herd.badImagesMutex.Lock()
+	herd.rolloutsMutex.Lock()
+	herd.stateDir = dirname
+	herd.rolloutsMutex.Unlock()
+	herd.badImagesMutex.Unlock()
+	if err := herd.loadBadImages(); err != nil {
+		return err
+	}
+	return herd.loadRollouts()
+}
+
+func (herd *Herd) startRollout(policy proto.RolloutPolicy,
+	username string) error {
+	if policy.FromImage == "" || policy.ToImage == "" {
+		return errors.New("from and to images must be specified")
+	}
+	if policy.FromImage == policy.ToImage {
+		return errors.New("from and to images must be different")
+	}
+	var lastPercent uint
+	for _, percent := range policy.WavePercentages {
+		if percent <= lastPercent || percent > 100 {
+			return fmt.Errorf("bad wave percentage: %d", percent)
+		}
+		lastPercent = percent
+	}
+	for _, imageName := range []string{policy.FromImage, policy.ToImage} {
+		if img, err := herd.imageManager.Get(imageName, true); err != nil {
+			return err
+		} else if img == nil {
+			return errors.New("unknown image: " + imageName)
+		}
+	}
+	rollout := newRollout(proto.RolloutState{
+		RolloutPolicy: policy,
+		StartTime:     time.Now(),
+		StartedBy:     username,
+	})
+	for _, hostname := range policy.CanaryHosts {
+		rollout.admitted[hostname] = struct{}{}
+	}
+	// Do not hold back subs which have already been updated.
+	for _, sub := range herd.getRolloutSubs() {
+		if sub.requiredImageName == policy.ToImage &&
+			sub.lastSuccessfulImageName == policy.ToImage {
+			rollout.admitted[sub.hostname] = struct{}{}
+			rollout.updated[sub.hostname] = struct{}{}
+		}
+	}
+	herd.rolloutsMutex.Lock()
+	defer herd.rolloutsMutex.Unlock()
+	if _, ok := herd.rollouts[policy.ToImage]; ok {
+		return errors.New("rollout already exists for: " + policy.ToImage)
+	}
+	herd.rollouts[policy.ToImage] = rollout
+	herd.writeRolloutsWithLock()
+	herd.logger.Printf("Started rollout of: %s replacing: %s\n",
+		policy.ToImage, policy.FromImage)
+	return nil
+}
+
+// This must be called with the lock held.
+func (herd *Herd) writeRolloutsWithLock() {
+	if herd.stateDir == "" {
+		return
+	}
+	filename := filepath.Join(herd.stateDir, rolloutsFilename)
+	err := json.WriteToFile(filename, 0644, "    ",
+		herd.listRolloutsWithLock())
+	if err != nil {
+		herd.logger.Printf("Error writing rollouts: %s\n", err)
+	}
+}
+
+func (herd *Herd) writeRolloutsHtml(writer io.Writer) {
+	for _, rollout := range herd.listRollouts() {
+		fmt.Fprintf(writer,
+			"Rollout of <a href=\"http://%s/showImage?%s\">%s</a>: wave %d, ",
+			herd.imageManager, rollout.ToImage, rollout.ToImage, rollout.Wave)
+		fmt.Fprintf(writer, "%d admitted, %d updated out of %d subs",
+			len(rollout.AdmittedHosts), len(rollout.UpdatedHosts),
+			rollout.NumSubs)
+		if rollout.Aborted {
+			fmt.Fprint(writer, ", <font color=\"red\">aborted</font>")
+		} else if rollout.HaltReason != "" {
+			fmt.Fprintf(writer, ", <font color=\"red\">halted: %s</font>",
+				rollout.HaltReason)
+		} else if rollout.Paused {
+			fmt.Fprintf(writer, ", <font color=\"grey\">paused</font>")
+		} else if !rollout.WaveCompletedTime.IsZero() {
+			fmt.Fprintf(writer, ", next wave in %s",
+				format.Duration(rollout.WavePause-
+					time.Since(rollout.WaveCompletedTime)))
+		}
+		fmt.Fprintln(writer, "<br>")
+	}
+}
+
+// cancelSubs cancels blocking operations for subs which want the image, so
+// that newly admitted subs are updated promptly.
+func (herd *Herd) cancelSubs(imageName string) {
+	herd.RLock()
+	defer herd.RUnlock()
+	for _, sub := range herd.subsByIndex {
+		if sub.mdb.RequiredImage == imageName {
+			sub.sendCancel()
+		}
+	}
+}
+
+// checkStalled returns a non-empty reason if admitted subs have not updated
+// within the timeout, recording them as having halted the rollout.
+func (rollout *rolloutType) checkStalled(notUpdated []string) string {
+	if len(notUpdated) < 1 {
+		return ""
+	}
+	waveStartTime := rollout.WaveStartTime
+	if waveStartTime.IsZero() {
+		waveStartTime = rollout.StartTime
+	}
+	if waveStartTime.IsZero() ||
+		time.Since(waveStartTime) <= *rolloutUpdateTimeout {
+		return ""
+	}
+	for _, hostname := range notUpdated {
+		rollout.failed[hostname] = struct{}{}
+	}
+	reason := fmt.Sprintf("not updated after %s: %s",
+		format.Duration(*rolloutUpdateTimeout), notUpdated[0])
+	if len(notUpdated) > 1 {
+		reason += fmt.Sprintf(" and %d more", len(notUpdated)-1)
+	}
+	return reason
+}
+
+// checkHealth returns a non-empty reason if the rollout should be halted.
+func (rollout *rolloutType) checkHealth(subs []rolloutSubType) string {
+	for _, sub := range subs {
+		if _, ok := rollout.failed[sub.hostname]; ok {
+			continue // Already halted the rollout once.
+		}
+		if _, ok := rollout.admitted[sub.hostname]; !ok {
+			continue
+		}
+		if sub.status == statusHealthCheckFailed {
+			rollout.failed[sub.hostname] = struct{}{}
+			return "health check failed on: " + sub.hostname
+		}
+		if _, ok := rollout.updated[sub.hostname]; !ok {
+			continue
+		}
+		if sub.lastUpdateHadTriggerFailures {
+			rollout.failed[sub.hostname] = struct{}{}
+			return "trigger failures on: " + sub.hostname
+		}
+		if isUnreachable(sub.status) &&
+			time.Since(sub.lastReachableTime) > *rolloutUnreachableTimeout {
+			rollout.failed[sub.hostname] = struct{}{}
+			return "unreachable after update: " + sub.hostname
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package herd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func makeRolloutSubs(numSubs int, prefix, imageName string) []rolloutSubType {
+	subs := make([]rolloutSubType, 0, numSubs)
+	for index := 0; index < numSubs; index++ {
+		subs = append(subs, rolloutSubType{
+			hostname:                prefix + string(rune('a'+index)),
+			lastSuccessfulImageName: "old",
+			requiredImageName:       imageName,
+			status:                  statusSynced,
+		})
+	}
+	return subs
+}
+
+// updateAdmittedSubs marks the admitted subs as updated and returns the
+// number admitted.
+func updateAdmittedSubs(rollout *rolloutType, subs []rolloutSubType) int {
+	var numAdmitted int
+	for index, sub := range subs {
+		if _, ok := rollout.admitted[sub.hostname]; ok {
+			subs[index].lastSuccessfulImageName = rollout.ToImage
+			numAdmitted++
+		}
+	}
+	return numAdmitted
+}
+
+func TestRolloutWaves(t *testing.T) {
+	herd := &Herd{logger: testlogger.New(t)}
+	rollout := newRollout(proto.RolloutState{
+		RolloutPolicy: proto.RolloutPolicy{
+			CanaryHosts:     []string{"c"},
+			FromImage:       "old",
+			ToImage:         "new",
+			WavePercentages: []uint{50},
+		},
+	})
+	rollout.admitted["c"] = struct{}{}
+	subs := makeRolloutSubs(10, "", "new")
+	subs = append(subs, makeRolloutSubs(2, "other-", "other")...)
+	for _, expected := range []int{1, 5, 10} {
+		if done, _ := herd.processRollout(rollout, subs); done {
+			t.Fatal("rollout done too early")
+		}
+		if numAdmitted := updateAdmittedSubs(rollout, subs); numAdmitted !=
+			expected {
+			t.Fatalf("admitted: %d subs, expected: %d",
+				numAdmitted, expected)
+		}
+	}
+	if done, _ := herd.processRollout(rollout, subs); !done {
+		t.Fatal("rollout not done")
+	}
+}
+
+func TestRolloutHalt(t *testing.T) {
+	herd := &Herd{logger: testlogger.New(t)}
+	rollout := newRollout(proto.RolloutState{
+		RolloutPolicy: proto.RolloutPolicy{FromImage: "old", ToImage: "new"},
+	})
+	subs := makeRolloutSubs(4, "", "new")
+	herd.processRollout(rollout, subs)
+	updateAdmittedSubs(rollout, subs)
+	subs[0].lastUpdateHadTriggerFailures = true
+	herd.processRollout(rollout, subs)
+	if !rollout.Paused || rollout.HaltReason == "" {
+		t.Fatal("rollout not halted")
+	}
+	rollout.Paused = false
+	rollout.HaltReason = ""
+	herd.processRollout(rollout, subs)
+	if rollout.Paused {
+		t.Fatal("rollout halted again for the same sub")
+	}
+}
+
+func TestRolloutStalled(t *testing.T) {
+	herd := &Herd{logger: testlogger.New(t)}
+	rollout := newRollout(proto.RolloutState{
+		RolloutPolicy: proto.RolloutPolicy{
+			CanaryHosts:     []string{"a"},
+			FromImage:       "old",
+			ToImage:         "new",
+			WavePercentages: []uint{50},
+		},
+		StartTime: time.Now(),
+	})
+	rollout.admitted["a"] = struct{}{}
+	subs := makeRolloutSubs(4, "", "new")
+	herd.processRollout(rollout, subs)
+	if rollout.Paused {
+		t.Fatal("rollout halted before update timeout")
+	}
+	// The canary never updates.
+	rollout.StartTime = time.Now().Add(-2 * *rolloutUpdateTimeout)
+	herd.processRollout(rollout, subs)
+	if !rollout.Paused || rollout.HaltReason == "" {
+		t.Fatal("stalled rollout not halted")
+	}
+	if err := (&Herd{rollouts: map[string]*rolloutType{
+		"new": rollout}}).resumeRollout("new"); err != nil {
+		t.Fatal(err)
+	}
+	// The stalled canary no longer holds back the next wave.
+	herd.processRollout(rollout, subs)
+	if rollout.Paused {
+		t.Fatal("rollout halted again for the same sub")
+	}
+	if rollout.Wave != 1 || len(rollout.admitted) != 2 {
+		t.Fatalf("wave: %d, admitted: %d", rollout.Wave, len(rollout.admitted))
+	}
+}
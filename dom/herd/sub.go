@@ -363,9 +363,26 @@ func (sub *Sub) loadConfiguration(swapImages bool) bool {
 	requiredImageName, plannedImageName := sub.getImageNames(swapImages)
 	if requiredImageName == "" {
 		requiredImageName = sub.herd.defaultImageName
+	} else {
+		requiredImageName = sub.herd.getRolloutImageName(sub.mdb.Hostname,
+			requiredImageName)
+	}
+	// Hold the sub on its last successful image if the image it should have
+	// failed a health check in the group.
+	group := sub.getBadImageGroup()
+	sub.imageMarkedBad = sub.herd.isImageBad(group, requiredImageName)
+	if sub.imageMarkedBad {
+		requiredImageName = sub.lastSuccessfulImageName
+		if sub.herd.isImageBad(group, requiredImageName) {
+			requiredImageName = ""
+		}
 	}
 	sub.herd.cpuSharer.ReleaseCpu()
 	requiredImage := sub.herd.imageManager.GetNoError(requiredImageName)
+	if requiredImage == nil && sub.imageMarkedBad {
+		// The image being held may not be wanted by any sub in the MDB.
+		requiredImage, _ = sub.herd.imageManager.Get(requiredImageName, true)
+	}
 	plannedImage := sub.herd.imageManager.GetNoError(plannedImageName)
 	sub.herd.cpuSharer.GrabCpu()
 	var changed bool
@@ -512,6 +529,7 @@ func (sub *Sub) poll(srpcClient *srpc.Client, previousStatus subStatus,
 	sub.lastDisruptionState = reply.DisruptionState
 	sub.lastPollSucceededTime = time.Now()
 	sub.lastSuccessfulImageName = reply.LastSuccessfulImageName
+	sub.lastUpdateHadTriggerFailures = reply.LastUpdateHadTriggerFailures
 	sub.lastNote = reply.LastNote
 	sub.lastWriteError = reply.LastWriteError
 	sub.systemUptime = reply.SystemUptime
@@ -592,7 +610,16 @@ func (sub *Sub) poll(srpcClient *srpc.Client, previousStatus subStatus,
 		// Transition from updating to update ended (may be partial/failed).
 		switch reply.LastUpdateError {
 		case "":
-			sub.status = statusWaitingForNextFullPoll
+			if reply.LastHealthCheckError == "" {
+				sub.status = statusWaitingForNextFullPoll
+				break
+			}
+			logger.Printf("Health check failure for: %s: %s\n",
+				sub, reply.LastHealthCheckError)
+			sub.herd.markImageBad(sub.getBadImageGroup(),
+				sub.requiredImageName, sub.mdb.Hostname,
+				reply.LastHealthCheckError)
+			sub.status = statusHealthCheckFailed
 		case subproto.ErrorDisruptionPending:
 			sub.status = statusDisruptionRequested
 		case subproto.ErrorDisruptionDenied:
@@ -612,7 +639,9 @@ func (sub *Sub) poll(srpcClient *srpc.Client, previousStatus subStatus,
 		return false
 	}
 	if !haveImage {
-		if sub.requiredImageName == "" {
+		if sub.imageMarkedBad {
+			sub.status = statusHealthCheckFailed
+		} else if sub.requiredImageName == "" {
 			sub.status = statusImageUndefined
 		} else {
 			sub.status = statusImageNotReady
@@ -687,7 +716,11 @@ func (sub *Sub) poll(srpcClient *srpc.Client, previousStatus subStatus,
 		!sub.lastUpdateTime.IsZero() {
 		sub.lastSyncTime = time.Now()
 	}
-	sub.status = statusSynced
+	if sub.imageMarkedBad {
+		sub.status = statusHealthCheckFailed
+	} else {
+		sub.status = statusSynced
+	}
 	sub.cleanup(srpcClient)
 	sub.reclaim()
 	return false
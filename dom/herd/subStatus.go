@@ -84,6 +84,8 @@ func (status subStatus) string() string {
 		return "waiting for next full poll"
 	case statusSynced:
 		return "synced"
+	case statusHealthCheckFailed:
+		return "health check failed"
 	default:
 		panic(fmt.Sprintf("unknown status: %d", status))
 	}
@@ -91,7 +93,7 @@ func (status subStatus) string() string {
 
 func (status subStatus) html() string {
 	switch status {
-	case statusUnsafeUpdate:
+	case statusUnsafeUpdate, statusHealthCheckFailed:
 		return `<font color="red">` + status.String() + "</font>"
 	default:
 		return status.String()
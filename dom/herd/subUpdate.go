@@ -7,12 +7,14 @@ import (
 	"github.com/Cloud-Foundations/Dominator/dom/lib"
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	subproto "github.com/Cloud-Foundations/Dominator/proto/sub"
+	sublib "github.com/Cloud-Foundations/Dominator/sub/lib"
 )
 
 // Returns (idle, missing), idle=true if no update needs to be performed.
 func (sub *Sub) buildUpdateRequest(request *subproto.UpdateRequest) (
 	bool, bool) {
 	request.ImageName = sub.requiredImageName
+	request.HealthCheck = sublib.GetHealthCheck(sub.requiredImage)
 	request.Triggers = sub.requiredImage.Triggers
 	var rusageStart, rusageStop syscall.Rusage
 	computeStartTime := time.Now()
@@ -1,6 +1,7 @@
 package images
 
 import (
+	"crypto/x509"
 	"sync"
 
 	"github.com/Cloud-Foundations/Dominator/lib/image"
@@ -12,6 +13,8 @@ type Manager struct {
 	imageServerAddress string
 	logger             log.Logger
 	loggedDialFailure  bool
+	rejectedImages     map[string]error // Used by manager goroutine only.
+	trustedSigners     *x509.CertPool
 	sync.RWMutex
 	deduper *stringutil.StringDeduplicator
 	// Protected by lock.
@@ -23,7 +26,14 @@ type Manager struct {
 }
 
 func New(imageServerAddress string, logger log.Logger) *Manager {
-	return newManager(imageServerAddress, logger)
+	return newManager(imageServerAddress, nil, logger)
+}
+
+// NewWithTrustedSigners is similar to New, except that images which were not
+// signed by one of the trustedSigners are rejected.
+func NewWithTrustedSigners(imageServerAddress string,
+	trustedSigners *x509.CertPool, logger log.Logger) *Manager {
+	return newManager(imageServerAddress, trustedSigners, logger)
 }
 
 func (m *Manager) Get(name string, wait bool) (*image.Image, error) {
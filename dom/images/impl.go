@@ -1,6 +1,8 @@
 package images
 
 import (
+	"crypto/x509"
+	"fmt"
 	"time"
 
 	"github.com/Cloud-Foundations/Dominator/imageserver/client"
@@ -10,13 +12,16 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
 )
 
-func newManager(imageServerAddress string, logger log.Logger) *Manager {
+func newManager(imageServerAddress string, trustedSigners *x509.CertPool,
+	logger log.Logger) *Manager {
 	imageInterestChannel := make(chan map[string]struct{})
 	imageRequestChannel := make(chan string)
 	imageExpireChannel := make(chan string, 16)
 	m := &Manager{
 		imageServerAddress:   imageServerAddress,
 		logger:               logger,
+		rejectedImages:       make(map[string]error),
+		trustedSigners:       trustedSigners,
 		deduper:              stringutil.NewStringDeduplicator(false),
 		imageInterestChannel: imageInterestChannel,
 		imageRequestChannel:  imageRequestChannel,
@@ -121,6 +126,11 @@ func (m *Manager) setInterest(imageClient *srpc.Client,
 			m.Unlock()
 		}
 	}
+	for name := range m.rejectedImages {
+		if _, ok := imageList[name]; !ok {
+			delete(m.rejectedImages, name)
+		}
+	}
 	if deletedSome {
 		m.rebuildDeDuper()
 	}
@@ -132,6 +142,12 @@ func (m *Manager) requestImage(imageClient *srpc.Client,
 	if _, ok := m.imagesByName[name]; ok {
 		return imageClient
 	}
+	if err, ok := m.rejectedImages[name]; ok {
+		m.Lock()
+		m.missingImages[name] = err
+		m.Unlock()
+		return imageClient
+	}
 	var img *image.Image
 	var err error
 	imageClient, img, err = m.loadImage(imageClient, name)
@@ -175,6 +191,18 @@ func (m *Manager) loadImage(imageClient *srpc.Client, name string) (
 			name, err)
 		return imageClient, nil, err
 	}
+	if m.trustedSigners != nil {
+		// Verify before applying the filter, since the signature covers the
+		// complete file-system.
+		signer, err := img.VerifySignature(m.trustedSigners)
+		if err != nil {
+			err = fmt.Errorf("image: %s failed verification: %s", name, err)
+			m.logger.Println(err)
+			m.rejectedImages[name] = err
+			return imageClient, nil, err
+		}
+		m.logger.Printf("Image: %s signed by: %s\n", name, signer)
+	}
 	img.ReplaceStrings(m.deduper.DeDuplicate)
 	img.FileSystem = img.FileSystem.Filter(img.Filter) // Apply filter.
 	// Build cache data now to avoid potential concurrent builds later.
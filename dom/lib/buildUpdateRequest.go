@@ -266,6 +266,7 @@ func makeDirectory(request *subproto.UpdateRequest,
 	newDirectoryInode.Mode = requiredInode.Mode
 	newDirectoryInode.Uid = requiredInode.Uid
 	newDirectoryInode.Gid = requiredInode.Gid
+	newDirectoryInode.Xattrs = requiredInode.Xattrs
 	newInode.GenericInode = &newDirectoryInode
 	if create {
 		request.DirectoriesToMake = append(request.DirectoriesToMake, newInode)
@@ -46,6 +46,23 @@ func TestFileToChange(t *testing.T) {
 	}
 }
 
+func TestXattrsToChange(t *testing.T) {
+	xattrs := map[string][]byte{"security.capability": {1, 0, 0, 2}}
+	request := makeUpdateRequest(t, testDataFileXattrs(xattrs),
+		testDataFileXattrs(nil))
+	if len(request.InodesToChange) != 1 {
+		t.Fatal("Inode not being changed")
+	}
+	genericInode := request.InodesToChange[0].GenericInode
+	inode, ok := genericInode.(*filesystem.RegularInode)
+	if !ok {
+		t.Fatal("Changed inode is not a regular inode")
+	}
+	if !reflect.DeepEqual(inode.Xattrs, xattrs) {
+		t.Errorf("xattrs: %v != %v", inode.Xattrs, xattrs)
+	}
+}
+
 func TestSameOnlyDirectory(t *testing.T) {
 	request := makeUpdateRequest(t, testDataDirectory0(), testDataDirectory0())
 	if len(request.PathsToDelete) != 0 {
@@ -380,6 +397,22 @@ func testDataFile1(uid uint32) *filesystem.FileSystem {
 	}
 }
 
+func testDataFileXattrs(xattrs map[string][]byte) *filesystem.FileSystem {
+	return &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			1: &filesystem.RegularInode{Size: 100, Hash: hash0, Xattrs: xattrs},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{
+					Name:        "file0",
+					InodeNumber: 1,
+				},
+			},
+		},
+	}
+}
+
 func testDataDuplicateFiles() *filesystem.FileSystem {
 	return &filesystem.FileSystem{
 		InodeTable: filesystem.InodeTable{
@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) AbortRollout(conn *srpc.Conn,
+	request dominator.AbortRolloutRequest,
+	reply *dominator.AbortRolloutResponse) error {
+	if conn.Username() == "" {
+		t.logger.Printf("AbortRollout(%s)\n", request.ImageName)
+	} else {
+		t.logger.Printf("AbortRollout(%s): by %s\n",
+			request.ImageName, conn.Username())
+	}
+	return t.herd.AbortRollout(request.ImageName, conn.Username())
+}
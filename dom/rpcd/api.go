@@ -23,6 +23,7 @@ func Setup(herd *herd.Herd, logger log.Logger) {
 				"ForceDisruptiveUpdate": 1,
 				"GetInfoForSubs":        1,
 				"ListSubs":              1,
+				"PlanUpdate":            1,
 			}),
 	}
 	srpc.RegisterNameWithOptions("Dominator", rpcObj,
@@ -32,6 +33,7 @@ func Setup(herd *herd.Herd, logger log.Logger) {
 				"FastUpdate",
 				"ForceDisruptiveUpdate",
 				"GetInfoForSubs",
+				"ListRollouts",
 				"ListSubs",
 			}})
 }
@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) ClearBadImage(conn *srpc.Conn,
+	request dominator.ClearBadImageRequest,
+	reply *dominator.ClearBadImageResponse) error {
+	if conn.Username() == "" {
+		t.logger.Printf("ClearBadImage(%s)\n", request.ImageName)
+	} else {
+		t.logger.Printf("ClearBadImage(%s): by %s\n",
+			request.ImageName, conn.Username())
+	}
+	return t.herd.ClearBadImage(request.ImageName)
+}
@@ -0,0 +1,13 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) ListRollouts(conn *srpc.Conn,
+	request dominator.ListRolloutsRequest,
+	reply *dominator.ListRolloutsResponse) error {
+	*reply = dominator.ListRolloutsResponse{Rollouts: t.herd.ListRollouts()}
+	return nil
+}
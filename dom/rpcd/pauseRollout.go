@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) PauseRollout(conn *srpc.Conn,
+	request dominator.PauseRolloutRequest,
+	reply *dominator.PauseRolloutResponse) error {
+	if conn.Username() == "" {
+		t.logger.Printf("PauseRollout(%s)\n", request.ImageName)
+	} else {
+		t.logger.Printf("PauseRollout(%s): by %s\n",
+			request.ImageName, conn.Username())
+	}
+	return t.herd.PauseRollout(request.ImageName, conn.Username())
+}
@@ -0,0 +1,19 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) PlanUpdate(conn *srpc.Conn,
+	request dominator.PlanUpdateRequest,
+	reply *dominator.PlanUpdateResponse) error {
+	plans, err := t.herd.PlanUpdate(request)
+	response := dominator.PlanUpdateResponse{
+		Error: errors.ErrorToString(err),
+		Plans: plans,
+	}
+	*reply = response
+	return nil
+}
@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) ResumeRollout(conn *srpc.Conn,
+	request dominator.ResumeRolloutRequest,
+	reply *dominator.ResumeRolloutResponse) error {
+	if conn.Username() == "" {
+		t.logger.Printf("ResumeRollout(%s)\n", request.ImageName)
+	} else {
+		t.logger.Printf("ResumeRollout(%s): by %s\n",
+			request.ImageName, conn.Username())
+	}
+	return t.herd.ResumeRollout(request.ImageName)
+}
@@ -0,0 +1,19 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/dominator"
+)
+
+func (t *rpcType) StartRollout(conn *srpc.Conn,
+	request dominator.StartRolloutRequest,
+	reply *dominator.StartRolloutResponse) error {
+	if conn.Username() == "" {
+		t.logger.Printf("StartRollout(%s->%s)\n",
+			request.FromImage, request.ToImage)
+	} else {
+		t.logger.Printf("StartRollout(%s->%s): by %s\n",
+			request.FromImage, request.ToImage, conn.Username())
+	}
+	return t.herd.StartRollout(request.RolloutPolicy, conn.Username())
+}
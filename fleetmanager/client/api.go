@@ -1,9 +1,50 @@
 package client
 
 import (
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
 )
 
+// CreateVmInLocation will create a VM on a Hypervisor selected by the Fleet
+// Manager. The image data and user data (if any) are read from dataReader.
+// The final response, including the Hypervisor address, is returned.
+func CreateVmInLocation(client *srpc.Client,
+	request proto.CreateVmInLocationRequest, dataReader io.Reader,
+	logger log.DebugLogger) (proto.CreateVmInLocationResponse, error) {
+	return createVmInLocation(client, request, dataReader, logger)
+}
+
+func DrainHypervisor(client *srpc.Client,
+	request proto.DrainHypervisorRequest, logger log.DebugLogger) error {
+	return drainHypervisor(client, request, logger)
+}
+
+func GetFlavour(client *srpc.Client, location, name string) (
+	proto.Flavour, error) {
+	return getFlavour(client, location, name)
+}
+
+func GetVmStatsInLocation(client *srpc.Client,
+	request proto.GetVmStatsInLocationRequest) (
+	proto.GetVmStatsInLocationResponse, error) {
+	return getVmStatsInLocation(client, request)
+}
+
+// PlaceVm will select a Hypervisor for a VM and reserve resources for it. The
+// reservation should be released with ReleaseVmPlacement once the VM has been
+// created or the creation failed.
+func PlaceVm(client *srpc.Client, request proto.PlaceVmRequest) (
+	proto.PlaceVmResponse, error) {
+	return placeVm(client, request)
+}
+
 func PowerOnMachine(client *srpc.Client, hostname string) error {
 	return powerOnMachine(client, hostname)
 }
+
+func ReleaseVmPlacement(client *srpc.Client, reservationId uint64) error {
+	return releaseVmPlacement(client, reservationId)
+}
@@ -1,11 +1,124 @@
 package client
 
 import (
+	"io"
+
 	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
 )
 
+func createVmInLocation(client *srpc.Client,
+	request proto.CreateVmInLocationRequest, dataReader io.Reader,
+	logger log.DebugLogger) (proto.CreateVmInLocationResponse, error) {
+	conn, err := client.Call("FleetManager.CreateVmInLocation")
+	if err != nil {
+		return proto.CreateVmInLocationResponse{}, err
+	}
+	defer conn.Close()
+	if err := conn.Encode(request); err != nil {
+		return proto.CreateVmInLocationResponse{}, err
+	}
+	numBytes := int64(request.ImageDataSize + request.UserDataSize)
+	if numBytes > 0 {
+		if _, err := io.CopyN(conn, dataReader, numBytes); err != nil {
+			return proto.CreateVmInLocationResponse{}, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return proto.CreateVmInLocationResponse{}, err
+	}
+	for {
+		var reply proto.CreateVmInLocationResponse
+		if err := conn.Decode(&reply); err != nil {
+			return proto.CreateVmInLocationResponse{}, err
+		}
+		if reply.Error != "" {
+			return proto.CreateVmInLocationResponse{},
+				errors.New(reply.Error)
+		}
+		if reply.ProgressMessage != "" {
+			logger.Debugln(0, reply.ProgressMessage)
+		}
+		if reply.Final {
+			return reply, nil
+		}
+	}
+}
+
+func drainHypervisor(client *srpc.Client,
+	request proto.DrainHypervisorRequest, logger log.DebugLogger) error {
+	conn, err := client.Call("FleetManager.DrainHypervisor")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Encode(request); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for {
+		var reply proto.DrainHypervisorResponse
+		if err := conn.Decode(&reply); err != nil {
+			return err
+		}
+		if reply.ProgressMessage != "" {
+			logger.Debugln(0, reply.ProgressMessage)
+		}
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		if reply.Final {
+			return nil
+		}
+	}
+}
+
+func getFlavour(client *srpc.Client, location, name string) (
+	proto.Flavour, error) {
+	request := proto.GetFlavourRequest{Location: location, Name: name}
+	var reply proto.GetFlavourResponse
+	err := client.RequestReply("FleetManager.GetFlavour", request, &reply)
+	if err != nil {
+		return proto.Flavour{}, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return proto.Flavour{}, err
+	}
+	return reply.Flavour, nil
+}
+
+func getVmStatsInLocation(client *srpc.Client,
+	request proto.GetVmStatsInLocationRequest) (
+	proto.GetVmStatsInLocationResponse, error) {
+	var reply proto.GetVmStatsInLocationResponse
+	err := client.RequestReply("FleetManager.GetVmStatsInLocation", request,
+		&reply)
+	if err != nil {
+		return proto.GetVmStatsInLocationResponse{}, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return proto.GetVmStatsInLocationResponse{}, err
+	}
+	return reply, nil
+}
+
+func placeVm(client *srpc.Client, request proto.PlaceVmRequest) (
+	proto.PlaceVmResponse, error) {
+	var reply proto.PlaceVmResponse
+	err := client.RequestReply("FleetManager.PlaceVm", request, &reply)
+	if err != nil {
+		return proto.PlaceVmResponse{}, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return proto.PlaceVmResponse{}, err
+	}
+	return reply, nil
+}
+
 func powerOnMachine(client *srpc.Client, hostname string) error {
 	request := proto.PowerOnMachineRequest{Hostname: hostname}
 	var reply proto.PowerOnMachineResponse
@@ -15,3 +128,14 @@ func powerOnMachine(client *srpc.Client, hostname string) error {
 	}
 	return errors.New(reply.Error)
 }
+
+func releaseVmPlacement(client *srpc.Client, reservationId uint64) error {
+	request := proto.ReleaseVmPlacementRequest{ReservationId: reservationId}
+	var reply proto.ReleaseVmPlacementResponse
+	err := client.RequestReply("FleetManager.ReleaseVmPlacement", request,
+		&reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
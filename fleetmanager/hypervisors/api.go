@@ -38,9 +38,11 @@ type hypervisorType struct {
 	closeClientChannel chan<- struct{}
 	deleteScheduled    bool
 	disabled           bool
+	drain              *drainType // nil: not draining.
 	healthStatus       string
 	lastConnectedTime  time.Time
 	lastIpmiProbe      time.Time
+	lastOwnerQuotas    *hyper_proto.UpdateOwnerQuotasRequest
 	localTags          tags.Tags
 	location           string
 	migratingVms       map[string]*vmInfoType // Key: VM IP address.
@@ -51,6 +53,11 @@ type hypervisorType struct {
 	vms                map[string]*vmInfoType // Key: VM IP address.
 }
 
+type drainStorer interface {
+	ReadDrainState(hypervisor net.IP) (*fm_proto.DrainState, error)
+	WriteDrainState(hypervisor net.IP, state *fm_proto.DrainState) error
+}
+
 type ipStorer interface {
 	AddIPsForHypervisor(hypervisor net.IP, addrs []net.IP) error
 	CheckIpIsRegistered(addr net.IP) (bool, error)
@@ -65,23 +72,25 @@ type locationType struct {
 }
 
 type Manager struct {
-	ipmiLimiter      chan struct{}
-	ipmiPasswordFile string
-	ipmiUsername     string
-	logger           log.DebugLogger
-	storer           Storer
-	mutex            sync.RWMutex               // Protect everything below.
-	allocatingIPs    map[string]struct{}        // Key: VM IP address.
-	hypervisors      map[string]*hypervisorType // Key: hypervisor machine name.
-	hypervisorsByHW  map[string]*hypervisorType // Key: hypervisor HW addr.
-	hypervisorsByIP  map[string]*hypervisorType // Key: hypervisor IP.
-	hypervisorsBySN  map[string]*hypervisorType // Key: serial number, nil: dup
-	locations        map[string]*locationType   // Key: location.
-	migratingIPs     map[string]struct{}        // Key: VM IP address.
-	notifiers        map[<-chan fm_proto.Update]*locationType
-	topology         *topology.Topology
-	subnets          map[string]*subnetType // Key: Gateway IP.
-	vms              map[string]*vmInfoType // Key: VM IP address.
+	ipmiLimiter           chan struct{}
+	ipmiPasswordFile      string
+	ipmiUsername          string
+	logger                log.DebugLogger
+	storer                Storer
+	mutex                 sync.RWMutex               // Protect everything below.
+	allocatingIPs         map[string]struct{}        // Key: VM IP address.
+	hypervisors           map[string]*hypervisorType // Key: hypervisor machine name.
+	hypervisorsByHW       map[string]*hypervisorType // Key: hypervisor HW addr.
+	hypervisorsByIP       map[string]*hypervisorType // Key: hypervisor IP.
+	hypervisorsBySN       map[string]*hypervisorType // Key: serial number, nil: dup
+	lastReservationId     uint64                     // Placement reservations.
+	locations             map[string]*locationType   // Key: location.
+	migratingIPs          map[string]struct{}        // Key: VM IP address.
+	notifiers             map[<-chan fm_proto.Update]*locationType
+	placementReservations map[string][]*placementReservation // Key: hostname.
+	topology              *topology.Topology
+	subnets               map[string]*subnetType // Key: Gateway IP.
+	vms                   map[string]*vmInfoType // Key: VM IP address.
 }
 
 type probeStatus uint
@@ -99,6 +108,7 @@ type StartOptions struct {
 }
 
 type Storer interface {
+	drainStorer
 	ipStorer
 	serialStorer
 	tagsStorer
@@ -136,6 +146,10 @@ func New(startOptions StartOptions) (*Manager, error) {
 	return newManager(startOptions)
 }
 
+func (m *Manager) CreateVmInLocation(conn *srpc.Conn) error {
+	return m.createVmInLocation(conn)
+}
+
 func (m *Manager) ChangeMachineTags(hostname string,
 	authInfo *srpc.AuthInformation, tgs tags.Tags) error {
 	return m.changeMachineTags(hostname, authInfo, tgs)
@@ -145,6 +159,14 @@ func (m *Manager) CloseUpdateChannel(channel <-chan fm_proto.Update) {
 	m.closeUpdateChannel(channel)
 }
 
+func (m *Manager) DrainHypervisor(conn *srpc.Conn) error {
+	return m.drainHypervisor(conn)
+}
+
+func (m *Manager) GetFlavour(location, name string) (fm_proto.Flavour, error) {
+	return m.getFlavour(location, name)
+}
+
 func (m *Manager) GetHypervisorForVm(ipAddr net.IP) (string, error) {
 	return m.getHypervisorForVm(ipAddr)
 }
@@ -164,6 +186,12 @@ func (m *Manager) GetMachineInfo(request fm_proto.GetMachineInfoRequest) (
 	return m.getMachineInfo(request)
 }
 
+func (m *Manager) GetVmStatsInLocation(
+	request fm_proto.GetVmStatsInLocationRequest) (
+	fm_proto.GetVmStatsInLocationResponse, error) {
+	return m.getVmStatsInLocation(request)
+}
+
 func (m *Manager) GetTopology() (*topology.Topology, error) {
 	return m.getTopology()
 }
@@ -192,11 +220,24 @@ func (m *Manager) MoveIpAddresses(hostname string, ipAddresses []net.IP) error {
 	return m.moveIpAddresses(hostname, ipAddresses)
 }
 
+// PlaceVm will select a Hypervisor for a VM and reserve resources for it.
+// The Hypervisor address and a reservation ID are returned. The reservation
+// should be released with ReleaseVmPlacement once the VM is created (or the
+// creation failed), else it expires.
+func (m *Manager) PlaceVm(request fm_proto.PlaceVmRequest) (
+	string, uint64, error) {
+	return m.reserveVmPlacement(request)
+}
+
 func (m *Manager) PowerOnMachine(hostname string,
 	authInfo *srpc.AuthInformation) error {
 	return m.powerOnMachine(hostname, authInfo)
 }
 
+func (m *Manager) ReleaseVmPlacement(reservationId uint64) {
+	m.releaseVmPlacement(reservationId)
+}
+
 func (m *Manager) WriteHtml(writer io.Writer) {
 	m.writeHtml(writer)
 }
@@ -53,6 +53,10 @@ func (m *Manager) writeHtml(writer io.Writer) {
 		"listVMs", numVMs)
 	writeLinksHTJ(writer, "VMs by primary owner",
 		"listVMsByPrimaryOwner", numVMs)
+	if t.Quotas != nil {
+		writeLinksHTJ(writer, "Owner quotas", "listQuotas",
+			uint(len(t.Quotas.OwnerGroups)+len(t.Quotas.OwnerUsers)))
+	}
 	fmt.Fprint(writer,
 		`Hypervisor locations: <a href="listLocations?status=all">all</a>`)
 	fmt.Fprint(writer,
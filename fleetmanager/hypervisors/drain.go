@@ -0,0 +1,438 @@
+package hypervisors
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/constants"
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	defaultDrainTimeout          = time.Hour * 24
+	drainPollInterval            = time.Second * 5
+	maxConcurrentDrainMigrations = 16
+)
+
+type drainType struct {
+	done      chan struct{} // Closed when the drain has finished.
+	err       error         // Valid once done is closed.
+	mutex     sync.Mutex    // Protect everything below.
+	listeners map[chan<- string]struct{}
+	state     fm_proto.DrainState
+}
+
+func newDrain(state fm_proto.DrainState) *drainType {
+	if state.AttemptedVMs == nil {
+		state.AttemptedVMs = make(map[string]struct{})
+	}
+	if state.FailedVMs == nil {
+		state.FailedVMs = make(map[string]string)
+	}
+	return &drainType{
+		done:      make(chan struct{}),
+		listeners: make(map[chan<- string]struct{}),
+		state:     state,
+	}
+}
+
+func (d *drainType) addListener(channel chan<- string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.listeners[channel] = struct{}{}
+}
+
+// deadline returns the time after which the drain is abandoned.
+func (d *drainType) deadline() time.Time {
+	timeout := d.state.Timeout
+	if timeout <= 0 {
+		timeout = defaultDrainTimeout
+	}
+	return d.state.StartTime.Add(timeout)
+}
+
+func (d *drainType) finish(err error) {
+	d.err = err
+	close(d.done)
+}
+
+// getState returns a copy of the drain state, safe to write to the storer.
+func (d *drainType) getState() fm_proto.DrainState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	state := d.state
+	state.AttemptedVMs = make(map[string]struct{}, len(d.state.AttemptedVMs))
+	for ipAddr := range d.state.AttemptedVMs {
+		state.AttemptedVMs[ipAddr] = struct{}{}
+	}
+	state.FailedVMs = make(map[string]string, len(d.state.FailedVMs))
+	for ipAddr, errorString := range d.state.FailedVMs {
+		state.FailedVMs[ipAddr] = errorString
+	}
+	return state
+}
+
+// isAttempted returns true if a migration of the VM has been attempted.
+func (d *drainType) isAttempted(ipAddr string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	_, ok := d.state.AttemptedVMs[ipAddr]
+	return ok
+}
+
+func (d *drainType) recordAttempt(ipAddr string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.state.AttemptedVMs[ipAddr] = struct{}{}
+}
+
+func (d *drainType) recordResult(ipAddr string, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err != nil {
+		d.state.FailedVMs[ipAddr] = err.Error()
+	} else {
+		delete(d.state.FailedVMs, ipAddr)
+		d.state.NumMigrated++
+	}
+}
+
+func (d *drainType) removeListener(channel chan<- string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.listeners, channel)
+}
+
+// sendMessage sends a progress message to all listeners. Slow listeners miss
+// messages rather than block the drain.
+func (d *drainType) sendMessage(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for channel := range d.listeners {
+		select {
+		case channel <- message:
+		default:
+		}
+	}
+}
+
+// acceptsVm returns true if the VM may be placed on the Hypervisor. Hypervisors
+// with owners only accept VMs which are owned by one of those owners. The
+// Hypervisor lock must be held.
+func (h *hypervisorType) acceptsVm(vmInfo hyper_proto.VmInfo) bool {
+	if len(h.Machine.OwnerUsers) < 1 && len(h.Machine.OwnerGroups) < 1 {
+		return true
+	}
+	for _, ownerUser := range vmInfo.OwnerUsers {
+		if _, ok := h.ownerUsers[ownerUser]; ok {
+			return true
+		}
+	}
+	for _, vmGroup := range vmInfo.OwnerGroups {
+		for _, ownerGroup := range h.Machine.OwnerGroups {
+			if vmGroup == ownerGroup {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getVMsToDrain returns the IP addresses of the VMs which have not yet been
+// attempted and the number of VMs skipped because of DestroyProtection.
+func (h *hypervisorType) getVMsToDrain(drain *drainType) ([]string, uint) {
+	migrateProtectedVMs := drain.state.MigrateProtectedVMs
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	ipAddrs := make([]string, 0, len(h.vms))
+	var numProtected uint
+	for ipAddr, vm := range h.vms {
+		if vm.DestroyProtection && !migrateProtectedVMs {
+			numProtected++
+			continue
+		}
+		if drain.isAttempted(ipAddr) {
+			continue
+		}
+		if vm.State == hyper_proto.StateMigrating {
+			continue
+		}
+		ipAddrs = append(ipAddrs, ipAddr)
+	}
+	sort.Strings(ipAddrs)
+	return ipAddrs, numProtected
+}
+
+func (h *hypervisorType) isConnected() bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.probeStatus == probeStatusConnected
+}
+
+func (m *Manager) drainHypervisor(conn *srpc.Conn) error {
+	var request fm_proto.DrainHypervisorRequest
+	if err := conn.Decode(&request); err != nil {
+		return err
+	}
+	drain, err := m.startDrain(conn.GetAuthInformation(), request)
+	if err != nil {
+		return conn.Encode(fm_proto.DrainHypervisorResponse{
+			Error: err.Error(),
+		})
+	}
+	messages := make(chan string, 64)
+	drain.addListener(messages)
+	defer drain.removeListener(messages)
+	for {
+		select {
+		case message := <-messages:
+			err := conn.Encode(fm_proto.DrainHypervisorResponse{
+				ProgressMessage: message,
+			})
+			if err != nil {
+				return err
+			}
+			if err := conn.Flush(); err != nil {
+				return err
+			}
+		case <-drain.done:
+			for len(messages) > 0 {
+				err := conn.Encode(fm_proto.DrainHypervisorResponse{
+					ProgressMessage: <-messages,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return conn.Encode(fm_proto.DrainHypervisorResponse{
+				Error: errors.ErrorToString(drain.err),
+				Final: true,
+			})
+		}
+	}
+}
+
+// drainVm migrates a VM away from the Hypervisor being drained.
+func (m *Manager) drainVm(h *hypervisorType, drain *drainType,
+	ipAddr string) error {
+	vmIP := net.ParseIP(ipAddr)
+	sourceAddress := h.address()
+	sourceClient, err := srpc.DialHTTP("tcp", sourceAddress, time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer sourceClient.Close()
+	vmInfo, err := hyperclient.GetVmInfo(sourceClient, vmIP)
+	if err != nil {
+		return err
+	}
+	if vmInfo.State == hyper_proto.StateMigrating {
+		return errors.New("VM is migrating")
+	}
+	location := drain.state.Location
+	if location == "" {
+		location = h.location
+	}
+	destHostname, reservation, err := m.placeVm(location, nil, vmInfo,
+		func(dest *hypervisorType) bool {
+			return dest != h && dest.acceptsVm(vmInfo)
+		})
+	if err != nil {
+		return err
+	}
+	defer m.releasePlacementReservation(destHostname, reservation)
+	accessToken, err := hyperclient.GetVmAccessToken(sourceClient, vmIP,
+		time.Hour*24)
+	if err != nil {
+		return err
+	}
+	defer hyperclient.DiscardVmAccessToken(sourceClient, vmIP, accessToken)
+	destAddress := fmt.Sprintf("%s:%d",
+		destHostname, constants.HypervisorPortNumber)
+	destClient, err := srpc.DialHTTP("tcp", destAddress, time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer destClient.Close()
+	drain.sendMessage("migrating VM: %s to: %s", ipAddr, destHostname)
+	request := hyper_proto.MigrateVmRequest{
+		AccessToken:      accessToken,
+		IpAddress:        vmIP,
+		Live:             drain.state.Live,
+		SourceHypervisor: sourceAddress,
+	}
+	return hyperclient.MigrateVm(destClient, request,
+		func() bool { return true },
+		prefixlogger.New(ipAddr+": ", h.logger))
+}
+
+// drainVMs migrates VMs away from the Hypervisor until there are no VMs left
+// to attempt. Each VM is attempted once, even if the drain is resumed. It
+// returns an error if any VMs remain or if the drain did not complete before
+// the deadline.
+func (m *Manager) drainVMs(h *hypervisorType, drain *drainType) error {
+	maxConcurrent := drain.state.MaxConcurrentMigrations
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	} else if maxConcurrent > maxConcurrentDrainMigrations {
+		maxConcurrent = maxConcurrentDrainMigrations
+	}
+	deadline := drain.deadline()
+	semaphore := make(chan struct{}, maxConcurrent)
+	var disabled bool
+	var numProtected uint
+	for {
+		if h.isDeleteScheduled() {
+			return errors.New("Hypervisor removed from topology")
+		}
+		if time.Now().After(deadline) {
+			state := drain.getState()
+			return fmt.Errorf(
+				"drain timed out at: %s, %d VMs migrated, %d VMs failed",
+				deadline.Format(time.RFC3339), state.NumMigrated,
+				len(state.FailedVMs))
+		}
+		if !h.isConnected() {
+			time.Sleep(drainPollInterval)
+			continue
+		}
+		if !disabled {
+			if err := m.setDisabledState(h, true); err != nil {
+				h.logger.Printf("error disabling for drain: %s\n", err)
+				time.Sleep(drainPollInterval)
+				continue
+			}
+			disabled = true
+			drain.sendMessage("disabled Hypervisor: %s", h.Machine.Hostname)
+		}
+		var ipAddrs []string
+		ipAddrs, numProtected = h.getVMsToDrain(drain)
+		if len(ipAddrs) < 1 {
+			break
+		}
+		for _, ipAddr := range ipAddrs {
+			drain.recordAttempt(ipAddr)
+		}
+		m.writeDrainState(h, drain)
+		var wg sync.WaitGroup
+		for _, ipAddr := range ipAddrs {
+			semaphore <- struct{}{}
+			wg.Add(1)
+			go func(ipAddr string) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+				err := m.drainVm(h, drain, ipAddr)
+				if err != nil {
+					drain.sendMessage("error migrating VM: %s: %s", ipAddr, err)
+				} else {
+					drain.sendMessage("migrated VM: %s", ipAddr)
+				}
+				drain.recordResult(ipAddr, err)
+				m.writeDrainState(h, drain)
+			}(ipAddr)
+		}
+		wg.Wait()
+		// Give the Hypervisor time to report the migrated VMs as gone.
+		time.Sleep(drainPollInterval)
+	}
+	state := drain.getState()
+	if len(state.FailedVMs) > 0 || numProtected > 0 {
+		return fmt.Errorf(
+			"%d VMs migrated, %d VMs failed to migrate, %d protected VMs skipped",
+			state.NumMigrated, len(state.FailedVMs), numProtected)
+	}
+	drain.sendMessage("drained Hypervisor: %s, %d VMs migrated",
+		h.Machine.Hostname, state.NumMigrated)
+	return nil
+}
+
+// resumeDrain resumes a drain which was in progress when the Fleet Manager
+// was stopped.
+func (m *Manager) resumeDrain(h *hypervisorType, state fm_proto.DrainState) {
+	if !*manageHypervisors {
+		return
+	}
+	h.logger.Printf("resuming drain started by: %s at: %s\n",
+		state.Username, state.StartTime.Format(time.RFC3339))
+	drain := newDrain(state)
+	h.mutex.Lock()
+	h.drain = drain
+	h.mutex.Unlock()
+	go m.runDrain(h, drain)
+}
+
+func (m *Manager) runDrain(h *hypervisorType, drain *drainType) {
+	err := m.drainVMs(h, drain)
+	if err != nil {
+		h.logger.Printf("drain finished: %s\n", err)
+	} else {
+		h.logger.Println("drain finished")
+	}
+	if err := m.storer.WriteDrainState(h.Machine.HostIpAddress,
+		nil); err != nil {
+		h.logger.Printf("error removing drain state: %s\n", err)
+	}
+	h.mutex.Lock()
+	h.drain = nil
+	h.mutex.Unlock()
+	drain.finish(err)
+}
+
+func (m *Manager) setDisabledState(h *hypervisorType, disable bool) error {
+	client, err := srpc.DialHTTP("tcp", h.address(), time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return hyperclient.SetDisabledState(client, disable)
+}
+
+// startDrain starts draining the Hypervisor, or returns the drain already in
+// progress.
+func (m *Manager) startDrain(authInfo *srpc.AuthInformation,
+	request fm_proto.DrainHypervisorRequest) (*drainType, error) {
+	if !*manageHypervisors {
+		return nil, errors.New("this is a read-only Fleet Manager")
+	}
+	h, err := m.getLockedHypervisor(request.Hostname, true)
+	if err != nil {
+		return nil, err
+	}
+	defer h.mutex.Unlock()
+	if err := h.checkAuth(authInfo); err != nil {
+		return nil, err
+	}
+	if h.drain != nil {
+		return h.drain, nil
+	}
+	state := fm_proto.DrainState{
+		DrainHypervisorRequest: request,
+		StartTime:              time.Now(),
+		Username:               authInfo.Username,
+	}
+	err = m.storer.WriteDrainState(h.Machine.HostIpAddress, &state)
+	if err != nil {
+		return nil, err
+	}
+	h.logger.Printf("drain started by: %s\n", authInfo.Username)
+	h.drain = newDrain(state)
+	go m.runDrain(h, h.drain)
+	return h.drain, nil
+}
+
+func (m *Manager) writeDrainState(h *hypervisorType, drain *drainType) {
+	state := drain.getState()
+	err := m.storer.WriteDrainState(h.Machine.HostIpAddress, &state)
+	if err != nil {
+		h.logger.Printf("error writing drain state: %s\n", err)
+	}
+}
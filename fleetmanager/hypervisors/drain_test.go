@@ -0,0 +1,76 @@
+package hypervisors
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestDrainTimesOut(t *testing.T) {
+	h := &hypervisorType{}
+	drain := newDrain(fm_proto.DrainState{
+		DrainHypervisorRequest: fm_proto.DrainHypervisorRequest{
+			Timeout: time.Hour,
+		},
+		StartTime: time.Now().Add(-2 * time.Hour),
+	})
+	// The Hypervisor is not connected, so without a deadline the drain would
+	// wait forever.
+	result := make(chan error, 1)
+	go func() { result <- (&Manager{}).drainVMs(h, drain) }()
+	select {
+	case err := <-result:
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Fatalf("expected timeout error, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drain did not time out")
+	}
+}
+
+func TestDrainDefaultDeadline(t *testing.T) {
+	startTime := time.Now()
+	drain := newDrain(fm_proto.DrainState{StartTime: startTime})
+	if deadline := drain.deadline(); !deadline.Equal(
+		startTime.Add(defaultDrainTimeout)) {
+		t.Fatalf("default deadline: %s", deadline)
+	}
+}
+
+func TestGetVMsToDrainSkipsAttempted(t *testing.T) {
+	h := &hypervisorType{
+		vms: map[string]*vmInfoType{
+			"10.0.0.1": {},
+			"10.0.0.2": {},
+			"10.0.0.3": {
+				VmInfo: hyper_proto.VmInfo{DestroyProtection: true},
+			},
+			"10.0.0.4": {
+				VmInfo: hyper_proto.VmInfo{State: hyper_proto.StateMigrating},
+			},
+		},
+	}
+	// Attempts recorded before a restart are read back from the drain state.
+	drain := newDrain(fm_proto.DrainState{
+		AttemptedVMs: map[string]struct{}{"10.0.0.1": {}},
+	})
+	ipAddrs, numProtected := h.getVMsToDrain(drain)
+	if !reflect.DeepEqual(ipAddrs, []string{"10.0.0.2"}) {
+		t.Errorf("VMs to drain: %v", ipAddrs)
+	}
+	if numProtected != 1 {
+		t.Errorf("numProtected: %d", numProtected)
+	}
+	drain.recordAttempt("10.0.0.2")
+	if ipAddrs, _ := h.getVMsToDrain(drain); len(ipAddrs) > 0 {
+		t.Errorf("attempted VMs drained again: %v", ipAddrs)
+	}
+	state := drain.getState()
+	if len(state.AttemptedVMs) != 2 {
+		t.Errorf("attempted VMs not saved: %v", state.AttemptedVMs)
+	}
+}
@@ -6,25 +6,32 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
 	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
 type IP [4]byte
 
+type IPv6 [16]byte
+
 type Storer struct {
-	topDir          string
-	logger          log.DebugLogger
-	mutex           sync.RWMutex
-	hypervisorToIPs map[IP][]IP // Key: hypervisor IP address.
-	ipToHypervisor  map[IP]IP   // Key: IP address, value: hypervisor.
+	topDir            string
+	logger            log.DebugLogger
+	mutex             sync.RWMutex
+	hypervisorToIPs   map[IP][]IP   // Key: hypervisor IP address.
+	hypervisorToIPv6s map[IP][]IPv6 // Key: hypervisor IP address.
+	ipToHypervisor    map[IP]IP     // Key: IP address, value: hypervisor.
+	ipv6ToHypervisor  map[IPv6]IP   // Key: IP address, value: hypervisor.
 }
 
 func New(topDir string, logger log.DebugLogger) (*Storer, error) {
 	storer := &Storer{
-		topDir:          topDir,
-		logger:          logger,
-		hypervisorToIPs: make(map[IP][]IP),
-		ipToHypervisor:  make(map[IP]IP),
+		topDir:            topDir,
+		logger:            logger,
+		hypervisorToIPs:   make(map[IP][]IP),
+		hypervisorToIPv6s: make(map[IP][]IPv6),
+		ipToHypervisor:    make(map[IP]IP),
+		ipv6ToHypervisor:  make(map[IPv6]IP),
 	}
 	if err := storer.load(); err != nil {
 		return nil, err
@@ -36,6 +43,10 @@ func (ip IP) String() string {
 	return ip.string()
 }
 
+func (ip IPv6) String() string {
+	return net.IP(ip[:]).String()
+}
+
 func (s *Storer) AddIPsForHypervisor(hypervisor net.IP,
 	addrs []net.IP) error {
 	return s.addIPsForHypervisor(hypervisor, addrs)
@@ -61,6 +72,11 @@ func (s *Storer) ListVMs(hypervisor net.IP) ([]string, error) {
 	return s.listVMs(hypervisor)
 }
 
+func (s *Storer) ReadDrainState(hypervisor net.IP) (
+	*fm_proto.DrainState, error) {
+	return s.readDrainState(hypervisor)
+}
+
 func (s *Storer) ReadMachineSerialNumber(hypervisor net.IP) (string, error) {
 	return s.readMachineSerialNumber(hypervisor)
 }
@@ -83,6 +99,13 @@ func (s *Storer) UnregisterHypervisor(hypervisor net.IP) error {
 	return s.unregisterHypervisor(hypervisor)
 }
 
+// WriteDrainState writes the drain state for the Hypervisor. If state is nil,
+// the drain state is removed.
+func (s *Storer) WriteDrainState(hypervisor net.IP,
+	state *fm_proto.DrainState) error {
+	return s.writeDrainState(hypervisor, state)
+}
+
 func (s *Storer) WriteMachineSerialNumber(hypervisor net.IP,
 	serialNumber string) error {
 	return s.writeMachineSerialNumber(hypervisor, serialNumber)
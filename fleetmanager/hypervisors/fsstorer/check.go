@@ -6,6 +6,13 @@ import (
 )
 
 func (s *Storer) checkIpIsRegistered(addr net.IP) (bool, error) {
+	if isIpv6(addr) {
+		ip := netIpToIpv6(addr)
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		_, ok := s.ipv6ToHypervisor[ip]
+		return ok, nil
+	}
 	if ip, err := netIpToIp(addr); err != nil {
 		return false, err
 	} else {
@@ -31,3 +38,29 @@ func netIpToIp(netIP net.IP) (IP, error) {
 	copy(ip[:], netIP)
 	return ip, nil
 }
+
+func isIpv6(netIP net.IP) bool {
+	return len(netIP) == net.IPv6len && netIP.To4() == nil
+}
+
+func netIpToIpv6(netIP net.IP) IPv6 {
+	var ip IPv6
+	copy(ip[:], netIP.To16())
+	return ip
+}
+
+// splitIPs splits the addresses into IPv4 and IPv6 addresses.
+func splitIPs(netAddrs []net.IP) ([]IP, []IPv6, error) {
+	addrs := make([]IP, 0, len(netAddrs))
+	var addrs6 []IPv6
+	for _, addr := range netAddrs {
+		if isIpv6(addr) {
+			addrs6 = append(addrs6, netIpToIpv6(addr))
+		} else if ip, err := netIpToIp(addr); err != nil {
+			return nil, nil, err
+		} else {
+			addrs = append(addrs, ip)
+		}
+	}
+	return addrs, addrs6, nil
+}
@@ -0,0 +1,63 @@
+package fsstorer
+
+import (
+	"encoding/gob"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+const drainStateFilename = "drain.gob"
+
+func (s *Storer) readDrainState(hypervisor net.IP) (
+	*fm_proto.DrainState, error) {
+	hDirname, err := s.getNetHypervisorDirectory(hypervisor)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filepath.Join(hDirname, drainStateFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	var state fm_proto.DrainState
+	if err := gob.NewDecoder(file).Decode(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *Storer) writeDrainState(hypervisor net.IP,
+	state *fm_proto.DrainState) error {
+	hDirname, err := s.getNetHypervisorDirectory(hypervisor)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(hDirname, drainStateFilename)
+	if state == nil {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(hDirname, fsutil.DirPerms); err != nil {
+		return err
+	}
+	writer, err := fsutil.CreateRenamingWriter(filename,
+		fsutil.PublicFilePerms)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	if err := gob.NewEncoder(writer).Encode(state); err != nil {
+		writer.Abort()
+		return err
+	}
+	return writer.Close()
+}
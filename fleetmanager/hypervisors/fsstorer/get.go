@@ -5,6 +5,15 @@ import (
 )
 
 func (s *Storer) getHypervisorForIp(addr net.IP) (net.IP, error) {
+	if isIpv6(addr) {
+		s.mutex.RLock()
+		hypervisor, ok := s.ipv6ToHypervisor[netIpToIpv6(addr)]
+		s.mutex.RUnlock()
+		if !ok {
+			return nil, nil
+		}
+		return hypervisor[:], nil
+	}
 	if ip, err := netIpToIp(addr); err != nil {
 		return nil, err
 	} else {
@@ -24,15 +33,20 @@ func (s *Storer) getIPsForHypervisor(hypervisor net.IP) ([]net.IP, error) {
 	} else {
 		s.mutex.RLock()
 		ipList, ok := s.hypervisorToIPs[hypervisorIP]
+		ipv6List, ok6 := s.hypervisorToIPv6s[hypervisorIP]
 		s.mutex.RUnlock()
-		if !ok {
+		if !ok && !ok6 {
 			return nil, nil
 		}
-		netIpList := make([]net.IP, 0, len(ipList))
+		netIpList := make([]net.IP, 0, len(ipList)+len(ipv6List))
 		for _, ip := range ipList {
 			ip := ip
 			netIpList = append(netIpList, net.IP(ip[:]))
 		}
+		for _, ip := range ipv6List {
+			ip := ip
+			netIpList = append(netIpList, net.IP(ip[:]))
+		}
 		return netIpList, nil
 	}
 }
@@ -0,0 +1,133 @@
+package fsstorer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+)
+
+const ipv6ListFilename = "ip6-list.raw"
+
+func readIpv6List(filename string) ([]IPv6, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var ipList []IPv6
+	for {
+		var ip IPv6
+		if _, err := io.ReadFull(reader, ip[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading: %s: %s", filename, err)
+		}
+		ipList = append(ipList, ip)
+	}
+	return ipList, nil
+}
+
+func writeIpv6List(filename string, ipList []IPv6, flags int) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|flags,
+		fsutil.PublicFilePerms)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	for _, ip := range ipList {
+		if _, err := writer.Write(ip[:]); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// This must be called with the lock held.
+func (s *Storer) addIPv6sForHypervisor(hypervisor IP, addrs []IPv6) error {
+	var newAddrs []IPv6
+	for _, addr := range addrs {
+		if _, ok := s.ipv6ToHypervisor[addr]; !ok {
+			newAddrs = append(newAddrs, addr)
+		}
+	}
+	if len(newAddrs) < 1 {
+		return nil // No changes.
+	}
+	err := s.writeIPv6sForHypervisor(hypervisor, newAddrs, os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	for _, addr := range newAddrs {
+		s.ipv6ToHypervisor[addr] = hypervisor
+	}
+	s.hypervisorToIPv6s[hypervisor] = append(s.hypervisorToIPv6s[hypervisor],
+		newAddrs...)
+	return nil
+}
+
+// This must be called with the lock held.
+func (s *Storer) checkIPv6sForHypervisor(hypervisor IP, addrs []IPv6) error {
+	for _, addr := range addrs {
+		if hIP, ok := s.ipv6ToHypervisor[addr]; ok && hIP != hypervisor {
+			return fmt.Errorf("cannot move IP: %s from: %s", addr, hIP)
+		}
+	}
+	return nil
+}
+
+// This must be called with the lock held.
+func (s *Storer) setIPv6sForHypervisor(hypervisor IP, addrs []IPv6) error {
+	addrsToForget := make(map[IPv6]struct{})
+	for _, addr := range s.hypervisorToIPv6s[hypervisor] {
+		addrsToForget[addr] = struct{}{}
+	}
+	addedSome := false
+	for _, addr := range addrs {
+		delete(addrsToForget, addr)
+		if _, ok := s.ipv6ToHypervisor[addr]; !ok {
+			addedSome = true
+		}
+	}
+	if !addedSome && len(addrsToForget) < 1 {
+		return nil // No changes.
+	}
+	err := s.writeIPv6sForHypervisor(hypervisor, addrs, os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	for addr := range addrsToForget {
+		delete(s.ipv6ToHypervisor, addr)
+	}
+	for _, addr := range addrs {
+		s.ipv6ToHypervisor[addr] = hypervisor
+	}
+	if len(addrs) > 0 {
+		s.hypervisorToIPv6s[hypervisor] = addrs
+	} else {
+		delete(s.hypervisorToIPv6s, hypervisor)
+	}
+	return nil
+}
+
+func (s *Storer) writeIPv6sForHypervisor(hypervisor IP, ipList []IPv6,
+	flags int) error {
+	dirname := s.getHypervisorDirectory(hypervisor)
+	if err := os.MkdirAll(dirname, fsutil.DirPerms); err != nil {
+		return err
+	}
+	return writeIpv6List(filepath.Join(dirname, ipv6ListFilename), ipList,
+		flags)
+}
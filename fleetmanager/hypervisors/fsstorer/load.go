@@ -50,19 +50,31 @@ func (s *Storer) load() error {
 			s.ipToHypervisor[ipAddr] = hypervisor
 		}
 	}
+	for hypervisor, ipAddrs := range s.hypervisorToIPv6s {
+		for _, ipAddr := range ipAddrs {
+			s.ipv6ToHypervisor[ipAddr] = hypervisor
+		}
+	}
 	return nil
 }
 
 func (s *Storer) readDirectory(partialIP []byte, dirname string) error {
 	if len(partialIP) == len(zeroIP) {
 		filename := filepath.Join(dirname, "ip-list.raw")
+		var hyperAddr IP
+		copy(hyperAddr[:], partialIP)
 		if ipList, err := readIpList(filename); err != nil {
 			return err
 		} else {
-			var hyperAddr IP
-			copy(hyperAddr[:], partialIP)
 			s.hypervisorToIPs[hyperAddr] = ipList
 		}
+		ipv6List, err := readIpv6List(filepath.Join(dirname, ipv6ListFilename))
+		if err != nil {
+			return err
+		}
+		if len(ipv6List) > 0 {
+			s.hypervisorToIPv6s[hyperAddr] = ipv6List
+		}
 		return nil
 	}
 	names, err := fsutil.ReadDirnames(dirname, true)
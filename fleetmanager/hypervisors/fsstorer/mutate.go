@@ -20,17 +20,16 @@ func (s *Storer) addIPsForHypervisor(hypervisor net.IP,
 	if err != nil {
 		return err
 	}
-	addrs := make([]IP, 0, len(netAddrs))
-	for _, addr := range netAddrs {
-		if ip, err := netIpToIp(addr); err != nil {
-			return err
-		} else {
-			addrs = append(addrs, ip)
-		}
+	addrs, addrs6, err := splitIPs(netAddrs)
+	if err != nil {
+		return err
 	}
 	newAddrs := make([]IP, 0, len(addrs))
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	if err := s.checkIPv6sForHypervisor(hypervisorIP, addrs6); err != nil {
+		return err
+	}
 	for _, addr := range addrs {
 		if hIP, ok := s.ipToHypervisor[addr]; !ok {
 			s.ipToHypervisor[addr] = hypervisorIP
@@ -41,19 +40,18 @@ func (s *Storer) addIPsForHypervisor(hypervisor net.IP,
 			}
 		}
 	}
-	if len(newAddrs) < 1 {
-		return nil // No changes.
-	}
-	err = s.writeIPsForHypervisor(hypervisorIP, addrs, os.O_APPEND)
-	if err != nil {
-		for _, addr := range newAddrs {
-			delete(s.ipToHypervisor, addr)
+	if len(newAddrs) > 0 {
+		err = s.writeIPsForHypervisor(hypervisorIP, addrs, os.O_APPEND)
+		if err != nil {
+			for _, addr := range newAddrs {
+				delete(s.ipToHypervisor, addr)
+			}
+			return err
 		}
-		return err
+		s.hypervisorToIPs[hypervisorIP] = append(
+			s.hypervisorToIPs[hypervisorIP], newAddrs...)
 	}
-	s.hypervisorToIPs[hypervisorIP] = append(s.hypervisorToIPs[hypervisorIP],
-		newAddrs...)
-	return nil
+	return s.addIPv6sForHypervisor(hypervisorIP, addrs6)
 }
 
 func (s *Storer) getHypervisorDirectory(hypervisor IP) string {
@@ -70,17 +68,16 @@ func (s *Storer) setIPsForHypervisor(hypervisor net.IP,
 	if err != nil {
 		return err
 	}
-	addrs := make([]IP, 0, len(netAddrs))
-	for _, addr := range netAddrs {
-		if ip, err := netIpToIp(addr); err != nil {
-			return err
-		} else {
-			addrs = append(addrs, ip)
-		}
+	addrs, addrs6, err := splitIPs(netAddrs)
+	if err != nil {
+		return err
 	}
 	addrsToForget := make(map[IP]struct{})
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	if err := s.checkIPv6sForHypervisor(hypervisorIP, addrs6); err != nil {
+		return err
+	}
 	for _, addr := range s.hypervisorToIPs[hypervisorIP] {
 		addrsToForget[addr] = struct{}{}
 	}
@@ -96,18 +93,17 @@ func (s *Storer) setIPsForHypervisor(hypervisor net.IP,
 			}
 		}
 	}
-	if !addedSome && len(addrsToForget) < 1 {
-		return nil // No changes.
-	}
-	err = s.writeIPsForHypervisor(hypervisorIP, addrs, os.O_TRUNC)
-	if err != nil {
-		return err
-	}
-	for addr := range addrsToForget {
-		delete(s.ipToHypervisor, addr)
+	if addedSome || len(addrsToForget) > 0 {
+		err = s.writeIPsForHypervisor(hypervisorIP, addrs, os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		for addr := range addrsToForget {
+			delete(s.ipToHypervisor, addr)
+		}
+		s.hypervisorToIPs[hypervisorIP] = addrs
 	}
-	s.hypervisorToIPs[hypervisorIP] = addrs
-	return nil
+	return s.setIPv6sForHypervisor(hypervisorIP, addrs6)
 }
 
 func (s *Storer) unregisterHypervisor(hypervisor net.IP) error {
@@ -125,6 +121,10 @@ func (s *Storer) unregisterHypervisor(hypervisor net.IP) error {
 		delete(s.ipToHypervisor, ip)
 	}
 	delete(s.hypervisorToIPs, hypervisorIP)
+	for _, ip := range s.hypervisorToIPv6s[hypervisorIP] {
+		delete(s.ipv6ToHypervisor, ip)
+	}
+	delete(s.hypervisorToIPv6s, hypervisorIP)
 	return nil
 }
 
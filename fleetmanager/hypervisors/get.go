@@ -174,6 +174,18 @@ func (m *Manager) getMachineInfo(request fm_proto.GetMachineInfoRequest) (
 	}
 }
 
+func (m *Manager) getFlavour(location, name string) (fm_proto.Flavour, error) {
+	topology, err := m.getTopology()
+	if err != nil {
+		return fm_proto.Flavour{}, err
+	}
+	flavour, err := topology.GetFlavour(location, name)
+	if err != nil {
+		return fm_proto.Flavour{}, err
+	}
+	return *flavour, nil
+}
+
 func (m *Manager) getTopology() (*topology.Topology, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -21,12 +21,15 @@ func (m *Manager) addIp(hypervisorIpAddress, ip net.IP) error {
 		return err
 	}
 	defer client.Close()
+	m.mutex.RLock()
+	tSubnet := m.findSubnetForIp(ip)
+	m.mutex.RUnlock()
+	address, err := makePoolAddress(ip, tSubnet)
+	if err != nil {
+		return err
+	}
 	request := hyper_proto.ChangeAddressPoolRequest{
-		AddressesToAdd: []hyper_proto.Address{{
-			IpAddress: ip,
-			MacAddress: fmt.Sprintf("52:54:%02x:%02x:%02x:%02x",
-				ip[0], ip[1], ip[2], ip[3]),
-		}},
+		AddressesToAdd: []hyper_proto.Address{address},
 	}
 	var reply hyper_proto.ChangeAddressPoolResponse
 	err = client.RequestReply("Hypervisor.ChangeAddressPool", request, &reply)
@@ -52,6 +55,23 @@ func (m *Manager) getHealthyHypervisorAddr(hostname string) (net.IP, error) {
 	return hypervisor.Machine.HostIpAddress, nil
 }
 
+// getPairedIpv4 returns the IPv4 address which is paired with the IPv6 address
+// in an address pool entry. Since addresses are moved as pairs, this is the
+// address to move.
+func (m *Manager) getPairedIpv4(ip net.IP) (net.IP, error) {
+	ipv4, err := getIpv4ForIpv6(ip)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.RLock()
+	tSubnet := m.findSubnetForIp(ipv4)
+	m.mutex.RUnlock()
+	if tSubnet == nil || !tSubnet.MatchesIpv6(ip) {
+		return nil, fmt.Errorf("no subnet with IPv6 address: %s", ip)
+	}
+	return ipv4, nil
+}
+
 func (m *Manager) markIPsForMigration(ipAddresses []net.IP) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -77,6 +97,13 @@ func (m *Manager) moveIpAddresses(hostname string, ipAddresses []net.IP) error {
 	sourceHypervisorIPs := make([]net.IP, len(ipAddresses))
 	for index, ip := range ipAddresses {
 		ip = util.ShrinkIP(ip)
+		if ip.To4() == nil {
+			ipv4, err := m.getPairedIpv4(ip)
+			if err != nil {
+				return err
+			}
+			ip = ipv4
+		}
 		ipAddresses[index] = ip
 		sourceHypervisorIp, err := m.storer.GetHypervisorForIp(ip)
 		if err != nil {
@@ -0,0 +1,446 @@
+package hypervisors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/constants"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/tags/tagmatcher"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+// placementReservationTimeout must exceed the time taken to create a VM
+// (including fetching the image) and for the Hypervisor to report it.
+const placementReservationTimeout = 30 * time.Minute
+
+// placementCandidate holds a snapshot of the capacity of a Hypervisor,
+// including resources reserved for VMs which have been placed but which have
+// not yet been reported by the Hypervisor.
+type placementCandidate struct {
+	allocatedMemory      uint64 // MiB.
+	allocatedMilliCPUs   uint64
+	allocatedVolumeBytes uint64
+	antiAffinityConflict bool
+	hostname             string
+	location             string
+	memoryInMiB          uint64
+	milliCPUs            uint64
+	volumeBytes          uint64
+}
+
+type placementReservation struct {
+	antiAffinity string
+	expires      time.Time
+	id           uint64
+	ipAddress    string // Set once the VM has been created.
+	memoryInMiB  uint64
+	milliCPUs    uint64
+	volumeBytes  uint64
+}
+
+// fraction returns the fraction of capacity which would be free after adding
+// the requested resources, or a negative number if there is insufficient
+// capacity.
+func fraction(allocated, requested, total uint64) float64 {
+	if total < 1 || allocated+requested > total {
+		return -1
+	}
+	return float64(total-allocated-requested) / float64(total)
+}
+
+func getVmAntiAffinity(vmInfo hyper_proto.VmInfo) string {
+	return vmInfo.Tags[fm_proto.AntiAffinityTagKey]
+}
+
+// selectPlacement returns the best candidate for the VM, or nil if there is
+// no candidate with sufficient capacity. The numInGroupByLocation map counts
+// the VMs in the same anti-affinity group for each topology directory.
+// Candidates in directories with fewer VMs in the same anti-affinity group are
+// preferred, then candidates with the most free capacity.
+func selectPlacement(candidates []placementCandidate,
+	vmInfo hyper_proto.VmInfo,
+	numInGroupByLocation map[string]uint) *placementCandidate {
+	var best *placementCandidate
+	var bestScore float64
+	for index := range candidates {
+		candidate := &candidates[index]
+		if candidate.antiAffinityConflict {
+			continue
+		}
+		freeCPU := fraction(candidate.allocatedMilliCPUs,
+			uint64(vmInfo.MilliCPUs), candidate.milliCPUs)
+		freeMemory := fraction(candidate.allocatedMemory, vmInfo.MemoryInMiB,
+			candidate.memoryInMiB)
+		freeStorage := fraction(candidate.allocatedVolumeBytes,
+			vmInfo.TotalStorage(), candidate.volumeBytes)
+		if freeCPU < 0 || freeMemory < 0 || freeStorage < 0 {
+			continue
+		}
+		score := (freeCPU+freeMemory+freeStorage)/3 -
+			float64(numInGroupByLocation[candidate.location])
+		if best == nil || score > bestScore ||
+			(score == bestScore && candidate.hostname < best.hostname) {
+			best = candidate
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func (m *Manager) createVmInLocation(conn *srpc.Conn) error {
+	var request fm_proto.CreateVmInLocationRequest
+	if err := conn.Decode(&request); err != nil {
+		return err
+	}
+	dataConsumed := false
+	sendError := func(err error) error {
+		if !dataConsumed {
+			err := maybeDrainCreateVmData(conn, request.CreateVmRequest)
+			if err != nil {
+				return err
+			}
+		}
+		return conn.Encode(fm_proto.CreateVmInLocationResponse{
+			CreateVmResponse: hyper_proto.CreateVmResponse{
+				Error: err.Error(),
+			},
+		})
+	}
+	if !*manageHypervisors {
+		return sendError(errors.New("this is a read-only Fleet Manager"))
+	}
+	if request.SecondaryVolumesData {
+		return sendError(errors.New(
+			"secondary volume data not supported via the Fleet Manager"))
+	}
+	if request.PrimaryOwner != "" {
+		return sendError(errors.New("cannot specify primary owner"))
+	}
+	if request.Flavour != "" {
+		flavour, err := m.getFlavour(request.Location, request.Flavour)
+		if err != nil {
+			return sendError(err)
+		}
+		flavour.Apply(&request.CreateVmRequest, request.Flavour)
+	}
+	vmInfo := request.VmInfo
+	if len(vmInfo.Volumes) < 1 {
+		vmInfo.Volumes = make([]hyper_proto.Volume, 1,
+			len(request.SecondaryVolumes)+1)
+		vmInfo.Volumes[0] = hyper_proto.Volume{
+			Size: request.MinimumFreeBytes + 2<<30,
+		}
+		vmInfo.Volumes = append(vmInfo.Volumes, request.SecondaryVolumes...)
+	}
+	quotaVmInfo := vmInfo
+	quotaVmInfo.OwnerUsers = append([]string{conn.Username()},
+		vmInfo.OwnerUsers...)
+	if err := m.checkQuota(quotaVmInfo); err != nil {
+		return sendError(err)
+	}
+	hostname, reservation, err := m.placeVm(request.Location,
+		request.HypervisorTagsToMatch, vmInfo, nil)
+	if err != nil {
+		return sendError(err)
+	}
+	reservationKept := false
+	defer func() {
+		if !reservationKept {
+			m.releasePlacementReservation(hostname, reservation)
+		}
+	}()
+	hypervisorAddress := fmt.Sprintf("%s:%d",
+		hostname, constants.HypervisorPortNumber)
+	m.logger.Debugf(0, "CreateVmInLocation(%s): placing VM on: %s\n",
+		conn.Username(), hostname)
+	client, err := srpc.DialHTTP("tcp", hypervisorAddress, time.Second*15)
+	if err != nil {
+		return sendError(err)
+	}
+	defer client.Close()
+	hyperConn, err := client.Call("Hypervisor.CreateVm")
+	if err != nil {
+		return sendError(err)
+	}
+	defer hyperConn.Close()
+	createRequest := request.CreateVmRequest
+	createRequest.PrimaryOwner = conn.Username()
+	if err := hyperConn.Encode(createRequest); err != nil {
+		return sendError(err)
+	}
+	numBytes := int64(request.ImageDataSize + request.UserDataSize)
+	if _, err := io.CopyN(hyperConn, conn, numBytes); err != nil {
+		return err
+	}
+	dataConsumed = true
+	if err := hyperConn.Flush(); err != nil {
+		return sendError(err)
+	}
+	for {
+		var reply hyper_proto.CreateVmResponse
+		if err := hyperConn.Decode(&reply); err != nil {
+			return conn.Encode(fm_proto.CreateVmInLocationResponse{
+				HypervisorAddress: hypervisorAddress,
+				CreateVmResponse: hyper_proto.CreateVmResponse{
+					Error: err.Error(),
+				},
+			})
+		}
+		err := conn.Encode(fm_proto.CreateVmInLocationResponse{
+			HypervisorAddress: hypervisorAddress,
+			CreateVmResponse:  reply,
+		})
+		if err != nil {
+			return err
+		}
+		if err := conn.Flush(); err != nil {
+			return err
+		}
+		if reply.Final && reply.Error == "" {
+			// Keep the reservation until the Hypervisor reports the VM.
+			m.setPlacementReservationVm(hostname, reservation,
+				reply.IpAddress.String())
+			reservationKept = true
+		}
+		if reply.Final || reply.Error != "" {
+			return nil
+		}
+	}
+}
+
+func maybeDrainCreateVmData(reader io.Reader,
+	request hyper_proto.CreateVmRequest) error {
+	numBytes := int64(request.ImageDataSize + request.UserDataSize)
+	if numBytes > 0 {
+		_, err := io.CopyN(io.Discard, reader, numBytes)
+		return err
+	}
+	return nil
+}
+
+// getPlacementCandidates returns the candidate Hypervisors in the location,
+// and the number of VMs in the anti-affinity group for each topology
+// directory. If accept is not nil, it is called with the Hypervisor lock held
+// and Hypervisors for which it returns false are excluded. The Manager lock
+// must be held.
+func (m *Manager) getPlacementCandidates(hypervisors []*hypervisorType,
+	vmInfo hyper_proto.VmInfo, accept func(h *hypervisorType) bool) (
+	[]placementCandidate, map[string]uint) {
+	antiAffinity := getVmAntiAffinity(vmInfo)
+	candidates := make([]placementCandidate, 0, len(hypervisors))
+	numInGroupByLocation := make(map[string]uint)
+	now := time.Now()
+	for _, h := range hypervisors {
+		h.mutex.RLock()
+		if accept != nil && !accept(h) {
+			h.mutex.RUnlock()
+			continue
+		}
+		candidate := placementCandidate{
+			allocatedMemory:      h.AllocatedMemory,
+			allocatedMilliCPUs:   h.AllocatedMilliCPUs,
+			allocatedVolumeBytes: h.AllocatedVolumeBytes,
+			hostname:             h.Machine.Hostname,
+			location:             h.location,
+			memoryInMiB:          h.MemoryInMiB,
+			milliCPUs:            uint64(h.NumCPUs) * 1000,
+			volumeBytes:          h.TotalVolumeBytes,
+		}
+		if antiAffinity != "" {
+			for _, vm := range h.vms {
+				if getVmAntiAffinity(vm.VmInfo) == antiAffinity {
+					candidate.antiAffinityConflict = true
+					numInGroupByLocation[h.location]++
+				}
+			}
+		}
+		h.mutex.RUnlock()
+		for _, reservation := range m.placementReservations[h.Machine.Hostname] {
+			if reservation.expires.Before(now) {
+				continue
+			}
+			candidate.allocatedMemory += reservation.memoryInMiB
+			candidate.allocatedMilliCPUs += reservation.milliCPUs
+			candidate.allocatedVolumeBytes += reservation.volumeBytes
+			if antiAffinity != "" && reservation.antiAffinity == antiAffinity {
+				candidate.antiAffinityConflict = true
+				numInGroupByLocation[h.location]++
+			}
+		}
+		if h.disabled {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, numInGroupByLocation
+}
+
+// placeVm selects a Hypervisor for the VM and reserves resources for it. The
+// reservation should be released once the VM has been created, else it
+// expires. See getPlacementCandidates for the semantics of accept.
+func (m *Manager) placeVm(location string, hypervisorTagsToMatch tags.MatchTags,
+	vmInfo hyper_proto.VmInfo, accept func(h *hypervisorType) bool) (
+	string, *placementReservation, error) {
+	hypervisors, err := m.listHypervisors(location, showOK, vmInfo.SubnetId,
+		tagmatcher.New(hypervisorTagsToMatch, false))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(vmInfo.SecondarySubnetIDs) > 0 {
+		hypervisors, err = m.filterHypervisorsBySubnets(hypervisors,
+			vmInfo.SecondarySubnetIDs)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	// Sort so that the tie-breaker is consistent.
+	sort.Sort(hypervisorList(hypervisors))
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.expirePlacementReservations()
+	candidates, numInGroupByLocation := m.getPlacementCandidates(hypervisors,
+		vmInfo, accept)
+	candidate := selectPlacement(candidates, vmInfo, numInGroupByLocation)
+	if candidate == nil {
+		return "", nil, errors.New(
+			"no Hypervisors in location with capacity")
+	}
+	m.lastReservationId++
+	reservation := &placementReservation{
+		antiAffinity: getVmAntiAffinity(vmInfo),
+		expires:      time.Now().Add(placementReservationTimeout),
+		id:           m.lastReservationId,
+		memoryInMiB:  vmInfo.MemoryInMiB,
+		milliCPUs:    uint64(vmInfo.MilliCPUs),
+		volumeBytes:  vmInfo.TotalStorage(),
+	}
+	m.placementReservations[candidate.hostname] = append(
+		m.placementReservations[candidate.hostname], reservation)
+	return candidate.hostname, reservation, nil
+}
+
+// expirePlacementReservations removes expired reservations. The Manager lock
+// must be held.
+func (m *Manager) expirePlacementReservations() {
+	now := time.Now()
+	for hostname, reservations := range m.placementReservations {
+		var keep []*placementReservation
+		for _, reservation := range reservations {
+			if reservation.expires.After(now) {
+				keep = append(keep, reservation)
+			}
+		}
+		if len(keep) < 1 {
+			delete(m.placementReservations, hostname)
+		} else {
+			m.placementReservations[hostname] = keep
+		}
+	}
+}
+
+func (m *Manager) filterHypervisorsBySubnets(hypervisors []*hypervisorType,
+	subnetIds []string) ([]*hypervisorType, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	filtered := make([]*hypervisorType, 0, len(hypervisors))
+	for _, h := range hypervisors {
+		hasAll := true
+		for _, subnetId := range subnetIds {
+			hasSubnet, err := m.topology.CheckIfMachineHasSubnet(
+				h.Machine.Hostname, subnetId)
+			if err != nil {
+				return nil, err
+			}
+			if !hasSubnet {
+				hasAll = false
+				break
+			}
+		}
+		if hasAll {
+			filtered = append(filtered, h)
+		}
+	}
+	return filtered, nil
+}
+
+func (m *Manager) releaseVmPlacement(reservationId uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for hostname, reservations := range m.placementReservations {
+		for _, reservation := range reservations {
+			if reservation.id == reservationId {
+				m.releasePlacementReservationWithLock(hostname, reservation)
+				return
+			}
+		}
+	}
+}
+
+func (m *Manager) reserveVmPlacement(request fm_proto.PlaceVmRequest) (
+	string, uint64, error) {
+	hostname, reservation, err := m.placeVm(request.Location,
+		request.HypervisorTagsToMatch, request.VmInfo, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%s:%d", hostname, constants.HypervisorPortNumber),
+		reservation.id, nil
+}
+
+// releaseReportedPlacementReservationWithLock releases the reservation for a
+// VM which has been reported by a Hypervisor. The Manager lock must be held.
+func (m *Manager) releaseReportedPlacementReservationWithLock(hostname string,
+	ipAddr string) {
+	for _, reservation := range m.placementReservations[hostname] {
+		if reservation.ipAddress == ipAddr {
+			m.releasePlacementReservationWithLock(hostname, reservation)
+			return
+		}
+	}
+}
+
+func (m *Manager) releasePlacementReservation(hostname string,
+	reservation *placementReservation) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.releasePlacementReservationWithLock(hostname, reservation)
+}
+
+func (m *Manager) releasePlacementReservationWithLock(hostname string,
+	reservation *placementReservation) {
+	reservations := m.placementReservations[hostname]
+	for index, r := range reservations {
+		if r == reservation {
+			reservations = append(reservations[:index],
+				reservations[index+1:]...)
+			break
+		}
+	}
+	if len(reservations) < 1 {
+		delete(m.placementReservations, hostname)
+	} else {
+		m.placementReservations[hostname] = reservations
+	}
+}
+
+// setPlacementReservationVm records the IP address of the VM created for a
+// reservation. The reservation is released once the Hypervisor reports the
+// VM, else it expires.
+func (m *Manager) setPlacementReservationVm(hostname string,
+	reservation *placementReservation, ipAddr string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if h, ok := m.hypervisors[hostname]; ok {
+		if _, ok := h.vms[ipAddr]; ok {
+			m.releasePlacementReservationWithLock(hostname, reservation)
+			return
+		}
+	}
+	reservation.ipAddress = ipAddr
+}
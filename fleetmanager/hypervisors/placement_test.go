@@ -0,0 +1,109 @@
+package hypervisors
+
+import (
+	"testing"
+	"time"
+
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+var testVmInfo = hyper_proto.VmInfo{
+	MemoryInMiB: 1024,
+	MilliCPUs:   1000,
+	Volumes:     []hyper_proto.Volume{{Size: 10 << 30}},
+}
+
+func makeTestCandidate(hostname, location string,
+	allocatedMemory uint64) placementCandidate {
+	return placementCandidate{
+		allocatedMemory: allocatedMemory,
+		hostname:        hostname,
+		location:        location,
+		memoryInMiB:     4096,
+		milliCPUs:       4000,
+		volumeBytes:     100 << 30,
+	}
+}
+
+func TestSelectPlacementCapacity(t *testing.T) {
+	candidates := []placementCandidate{
+		makeTestCandidate("full", "a", 4000),
+		makeTestCandidate("busy", "a", 2048),
+		makeTestCandidate("empty", "a", 0),
+	}
+	best := selectPlacement(candidates, testVmInfo, nil)
+	if best == nil || best.hostname != "empty" {
+		t.Fatalf("expected empty, got: %v", best)
+	}
+	best = selectPlacement(candidates[:1], testVmInfo, nil)
+	if best != nil {
+		t.Fatalf("expected no placement, got: %s", best.hostname)
+	}
+}
+
+func TestSelectPlacementAntiAffinity(t *testing.T) {
+	candidates := []placementCandidate{
+		makeTestCandidate("a1", "a", 0),
+		makeTestCandidate("b1", "b", 2048),
+		makeTestCandidate("b2", "b", 1024),
+	}
+	candidates[0].antiAffinityConflict = true
+	best := selectPlacement(candidates, testVmInfo, map[string]uint{"a": 1})
+	if best == nil || best.hostname != "b2" {
+		t.Fatalf("expected b2, got: %v", best)
+	}
+	candidates[0].antiAffinityConflict = false
+	best = selectPlacement(candidates, testVmInfo, map[string]uint{"a": 1})
+	if best == nil || best.location != "b" {
+		t.Fatalf("expected location b, got: %v", best)
+	}
+}
+
+func TestSelectPlacementTieBreak(t *testing.T) {
+	candidates := []placementCandidate{
+		makeTestCandidate("z", "a", 0),
+		makeTestCandidate("m", "a", 0),
+	}
+	best := selectPlacement(candidates, testVmInfo, nil)
+	if best == nil || best.hostname != "m" {
+		t.Fatalf("expected m, got: %v", best)
+	}
+}
+
+func TestPlacementReservationKeptUntilVmReported(t *testing.T) {
+	h := &hypervisorType{vms: make(map[string]*vmInfoType)}
+	m := &Manager{
+		hypervisors:           map[string]*hypervisorType{"h1": h},
+		placementReservations: make(map[string][]*placementReservation),
+	}
+	reserve := func() *placementReservation {
+		m.lastReservationId++
+		reservation := &placementReservation{
+			expires: time.Now().Add(placementReservationTimeout),
+			id:      m.lastReservationId,
+		}
+		m.placementReservations["h1"] = append(m.placementReservations["h1"],
+			reservation)
+		return reservation
+	}
+	// The VM has not been reported yet: keep the reservation.
+	reservation := reserve()
+	m.setPlacementReservationVm("h1", reservation, "10.0.0.1")
+	if len(m.placementReservations["h1"]) != 1 {
+		t.Fatal("reservation released before VM reported")
+	}
+	m.releaseReportedPlacementReservationWithLock("h1", "10.0.0.2")
+	if len(m.placementReservations["h1"]) != 1 {
+		t.Fatal("reservation released when other VM reported")
+	}
+	m.releaseReportedPlacementReservationWithLock("h1", "10.0.0.1")
+	if len(m.placementReservations["h1"]) != 0 {
+		t.Fatal("reservation not released when VM reported")
+	}
+	// The VM was reported before it was created: release immediately.
+	h.vms["10.0.0.3"] = &vmInfoType{}
+	m.setPlacementReservationVm("h1", reserve(), "10.0.0.3")
+	if len(m.placementReservations["h1"]) != 0 {
+		t.Fatal("reservation not released for reported VM")
+	}
+}
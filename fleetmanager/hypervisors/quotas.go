@@ -0,0 +1,337 @@
+package hypervisors
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/html"
+	"github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/url"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const quotaDistributionInterval = 10 * time.Second
+
+type ownerUsageType struct {
+	groups map[string]hyper_proto.OwnerResources // Key: owner group.
+	users  map[string]hyper_proto.OwnerResources // Key: primary owner.
+}
+
+type quotaUsageType struct {
+	Limit hyper_proto.OwnerResources
+	Owner string
+	Type  string
+	Used  hyper_proto.OwnerResources
+}
+
+func formatQuotaBytes(used, limit uint64) string {
+	if limit < 1 {
+		return format.FormatBytes(used)
+	}
+	return format.FormatBytes(used) + " / " + format.FormatBytes(limit)
+}
+
+func formatQuotaCount(used, limit uint64) string {
+	if limit < 1 {
+		return strconv.FormatUint(used, 10)
+	}
+	return strconv.FormatUint(used, 10) + " / " + strconv.FormatUint(limit, 10)
+}
+
+func formatQuotaMilli(used, limit uint64) string {
+	if limit < 1 {
+		return format.FormatMilli(used)
+	}
+	return format.FormatMilli(used) + " / " + format.FormatMilli(limit)
+}
+
+func makeOwnerQuotasRequest(quotas *fm_proto.Quotas,
+	usage, hypervisorUsage *ownerUsageType) hyper_proto.UpdateOwnerQuotasRequest {
+	request := hyper_proto.UpdateOwnerQuotasRequest{
+		OwnerGroups: make(map[string]hyper_proto.OwnerQuota,
+			len(quotas.OwnerGroups)),
+		OwnerUsers: make(map[string]hyper_proto.OwnerQuota,
+			len(quotas.OwnerUsers)),
+	}
+	for group, limit := range quotas.OwnerGroups {
+		usedElsewhere := usage.groups[group]
+		usedElsewhere.Subtract(hypervisorUsage.groups[group])
+		request.OwnerGroups[group] = hyper_proto.OwnerQuota{
+			Limit:         limit,
+			UsedElsewhere: usedElsewhere,
+		}
+	}
+	for user, limit := range quotas.OwnerUsers {
+		usedElsewhere := usage.users[user]
+		usedElsewhere.Subtract(hypervisorUsage.users[user])
+		request.OwnerUsers[user] = hyper_proto.OwnerQuota{
+			Limit:         limit,
+			UsedElsewhere: usedElsewhere,
+		}
+	}
+	return request
+}
+
+func makeOwnerUsage() *ownerUsageType {
+	return &ownerUsageType{
+		groups: make(map[string]hyper_proto.OwnerResources),
+		users:  make(map[string]hyper_proto.OwnerResources),
+	}
+}
+
+func ownerQuotasEqual(left, right map[string]hyper_proto.OwnerQuota) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for owner, leftQuota := range left {
+		if rightQuota, ok := right[owner]; !ok || leftQuota != rightQuota {
+			return false
+		}
+	}
+	return true
+}
+
+func writeQuotaUsages(writer io.Writer, quotaUsages []quotaUsageType) {
+	if len(quotaUsages) < 1 {
+		fmt.Fprintln(writer, "No quotas defined<br>")
+		return
+	}
+	fmt.Fprintln(writer, `<table border="1" style="width:100%">`)
+	tw, _ := html.NewTableWriter(writer, true, "Type", "Owner", "Num VMs",
+		"RAM", "CPU", "Storage")
+	for _, quotaUsage := range quotaUsages {
+		used := quotaUsage.Used
+		limit := quotaUsage.Limit
+		var foreground string
+		if used.CheckLimit(limit, hyper_proto.OwnerResources{}) != nil {
+			foreground = "red"
+		}
+		owner := quotaUsage.Owner
+		if quotaUsage.Type == "user" {
+			owner = fmt.Sprintf("<a href=\"listVMs?primaryOwner=%s\">%s</a>",
+				owner, owner)
+		}
+		tw.WriteRow(foreground, "",
+			quotaUsage.Type,
+			owner,
+			formatQuotaCount(used.NumVMs, limit.NumVMs),
+			formatQuotaBytes(used.MemoryInMiB<<20, limit.MemoryInMiB<<20),
+			formatQuotaMilli(used.MilliCPUs, limit.MilliCPUs),
+			formatQuotaBytes(used.VolumeBytes, limit.VolumeBytes))
+	}
+	tw.Close()
+}
+
+func (usage *ownerUsageType) addVm(vm *hyper_proto.VmInfo) {
+	if len(vm.OwnerUsers) > 0 {
+		resources := usage.users[vm.OwnerUsers[0]]
+		resources.AddVm(vm)
+		usage.users[vm.OwnerUsers[0]] = resources
+	}
+	for _, group := range vm.OwnerGroups {
+		resources := usage.groups[group]
+		resources.AddVm(vm)
+		usage.groups[group] = resources
+	}
+}
+
+// checkQuota checks if adding the VM would exceed the quota of any of its
+// owners. The first entry in OwnerUsers is the primary owner.
+func (m *Manager) checkQuota(vmInfo hyper_proto.VmInfo) error {
+	quotas := m.getQuotas()
+	if quotas == nil {
+		return nil
+	}
+	usage, _ := m.getOwnerUsage()
+	if len(vmInfo.OwnerUsers) > 0 {
+		owner := vmInfo.OwnerUsers[0]
+		if limit, ok := quotas.OwnerUsers[owner]; ok {
+			used := usage.users[owner]
+			previous := used
+			used.AddVm(&vmInfo)
+			if err := used.CheckLimit(limit, previous); err != nil {
+				return fmt.Errorf("quota for user: %s: %s", owner, err)
+			}
+		}
+	}
+	for _, group := range vmInfo.OwnerGroups {
+		if limit, ok := quotas.OwnerGroups[group]; ok {
+			used := usage.groups[group]
+			previous := used
+			used.AddVm(&vmInfo)
+			if err := used.CheckLimit(limit, previous); err != nil {
+				return fmt.Errorf("quota for group: %s: %s", group, err)
+			}
+		}
+	}
+	return nil
+}
+
+// distributeQuotas sends the quotas to each connected Hypervisor, along with
+// the resources used by the owners on the other Hypervisors. Quotas are only
+// sent if they have changed since they were last sent to a Hypervisor.
+func (m *Manager) distributeQuotas() {
+	quotas := m.getQuotas()
+	if quotas == nil {
+		quotas = &fm_proto.Quotas{}
+	}
+	usage, hypervisorUsages := m.getOwnerUsage()
+	var hypervisors []*hypervisorType
+	m.mutex.RLock()
+	for _, hypervisor := range m.hypervisors {
+		hypervisor.mutex.RLock()
+		if hypervisor.probeStatus == probeStatusConnected {
+			hypervisors = append(hypervisors, hypervisor)
+		}
+		hypervisor.mutex.RUnlock()
+	}
+	m.mutex.RUnlock()
+	var wg sync.WaitGroup
+	for _, hypervisor := range hypervisors {
+		hypervisorUsage := hypervisorUsages[hypervisor]
+		if hypervisorUsage == nil {
+			hypervisorUsage = makeOwnerUsage()
+		}
+		request := makeOwnerQuotasRequest(quotas, usage, hypervisorUsage)
+		hypervisor.mutex.RLock()
+		lastRequest := hypervisor.lastOwnerQuotas
+		hypervisor.mutex.RUnlock()
+		if lastRequest != nil &&
+			ownerQuotasEqual(request.OwnerGroups, lastRequest.OwnerGroups) &&
+			ownerQuotasEqual(request.OwnerUsers, lastRequest.OwnerUsers) {
+			continue
+		}
+		wg.Add(1)
+		go func(h *hypervisorType) {
+			defer wg.Done()
+			if err := h.updateOwnerQuotas(request); err != nil {
+				h.logger.Printf("error updating owner quotas: %s\n", err)
+				return
+			}
+			h.mutex.Lock()
+			h.lastOwnerQuotas = &request
+			h.mutex.Unlock()
+		}(hypervisor)
+	}
+	wg.Wait()
+}
+
+// getOwnerUsage returns the resources used by each owner across the fleet and
+// for each Hypervisor.
+func (m *Manager) getOwnerUsage() (*ownerUsageType,
+	map[*hypervisorType]*ownerUsageType) {
+	usage := makeOwnerUsage()
+	hypervisorUsages := make(map[*hypervisorType]*ownerUsageType)
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, vm := range m.vms {
+		usage.addVm(&vm.VmInfo)
+		hypervisorUsage := hypervisorUsages[vm.hypervisor]
+		if hypervisorUsage == nil {
+			hypervisorUsage = makeOwnerUsage()
+			hypervisorUsages[vm.hypervisor] = hypervisorUsage
+		}
+		hypervisorUsage.addVm(&vm.VmInfo)
+	}
+	return usage, hypervisorUsages
+}
+
+// getQuotaUsages returns the usage against each quota, sorted by type and
+// owner.
+func (m *Manager) getQuotaUsages() []quotaUsageType {
+	quotas := m.getQuotas()
+	if quotas == nil {
+		return nil
+	}
+	usage, _ := m.getOwnerUsage()
+	quotaUsages := make([]quotaUsageType, 0,
+		len(quotas.OwnerGroups)+len(quotas.OwnerUsers))
+	for group, limit := range quotas.OwnerGroups {
+		quotaUsages = append(quotaUsages, quotaUsageType{
+			Limit: limit,
+			Owner: group,
+			Type:  "group",
+			Used:  usage.groups[group],
+		})
+	}
+	for user, limit := range quotas.OwnerUsers {
+		quotaUsages = append(quotaUsages, quotaUsageType{
+			Limit: limit,
+			Owner: user,
+			Type:  "user",
+			Used:  usage.users[user],
+		})
+	}
+	sort.Slice(quotaUsages, func(left, right int) bool {
+		if quotaUsages[left].Type != quotaUsages[right].Type {
+			return quotaUsages[left].Type < quotaUsages[right].Type
+		}
+		return quotaUsages[left].Owner < quotaUsages[right].Owner
+	})
+	return quotaUsages
+}
+
+func (m *Manager) getQuotas() *fm_proto.Quotas {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.topology == nil {
+		return nil
+	}
+	return m.topology.Quotas
+}
+
+func (m *Manager) listQuotasHandler(w http.ResponseWriter,
+	req *http.Request) {
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+	parsedQuery := url.ParseQuery(req.URL)
+	quotaUsages := m.getQuotaUsages()
+	switch parsedQuery.OutputType() {
+	case url.OutputTypeHtml:
+		fmt.Fprintf(writer, "<title>Owner quotas</title>\n")
+		writer.WriteString(commonStyleSheet)
+		fmt.Fprintln(writer, "<body>")
+		writeQuotaUsages(writer, quotaUsages)
+		fmt.Fprintln(writer, "</body>")
+	case url.OutputTypeJson:
+		json.WriteWithIndent(writer, "   ", quotaUsages)
+	case url.OutputTypeText:
+		for _, quotaUsage := range quotaUsages {
+			fmt.Fprintf(writer, "%s %s\n", quotaUsage.Type, quotaUsage.Owner)
+		}
+	}
+}
+
+func (m *Manager) loopDistributeQuotas() {
+	if !*manageHypervisors {
+		return
+	}
+	for ; ; time.Sleep(quotaDistributionInterval) {
+		m.distributeQuotas()
+	}
+}
+
+func (h *hypervisorType) updateOwnerQuotas(
+	request hyper_proto.UpdateOwnerQuotasRequest) error {
+	client, err := srpc.DialHTTP("tcp", h.address(), time.Second*15)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	var reply hyper_proto.UpdateOwnerQuotasResponse
+	err = client.RequestReply("Hypervisor.UpdateOwnerQuotas", request, &reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
@@ -95,6 +95,7 @@ func (m *Manager) showHypervisorHandler(w http.ResponseWriter,
 	}
 	fmt.Fprintf(writer, "Status: %s", h.getHealthStatus(true))
 	h.mutex.RLock()
+	drain := h.drain
 	lastConnectedTime := h.lastConnectedTime
 	numVMs := len(h.vms)
 	h.mutex.RUnlock()
@@ -105,6 +106,13 @@ func (m *Manager) showHypervisorHandler(w http.ResponseWriter,
 			lastConnectedTime.Format(format.TimeFormatSeconds),
 			format.Duration(time.Since(lastConnectedTime)))
 	}
+	if drain != nil {
+		state := drain.getState()
+		fmt.Fprintf(writer,
+			"Draining: started by: %s %s ago, %d VMs migrated, %d failed<br>\n",
+			state.Username, format.Duration(time.Since(state.StartTime)),
+			state.NumMigrated, len(state.FailedVMs))
+	}
 	if h.IPMI.Hostname != "" {
 		fmt.Fprintf(writer, "<a href=\"https://%s/\">IPMI</a><br>\n",
 			h.IPMI.Hostname)
@@ -19,22 +19,24 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		file.Close()
 	}
 	manager := &Manager{
-		ipmiLimiter:      make(chan struct{}, runtime.NumCPU()),
-		ipmiPasswordFile: startOptions.IpmiPasswordFile,
-		ipmiUsername:     startOptions.IpmiUsername,
-		logger:           startOptions.Logger,
-		storer:           startOptions.Storer,
-		allocatingIPs:    make(map[string]struct{}),
-		hypervisors:      make(map[string]*hypervisorType),
-		hypervisorsByHW:  make(map[string]*hypervisorType),
-		hypervisorsByIP:  make(map[string]*hypervisorType),
-		hypervisorsBySN:  make(map[string]*hypervisorType),
-		migratingIPs:     make(map[string]struct{}),
-		subnets:          make(map[string]*subnetType),
-		vms:              make(map[string]*vmInfoType),
+		ipmiLimiter:           make(chan struct{}, runtime.NumCPU()),
+		ipmiPasswordFile:      startOptions.IpmiPasswordFile,
+		ipmiUsername:          startOptions.IpmiUsername,
+		logger:                startOptions.Logger,
+		storer:                startOptions.Storer,
+		allocatingIPs:         make(map[string]struct{}),
+		hypervisors:           make(map[string]*hypervisorType),
+		hypervisorsByHW:       make(map[string]*hypervisorType),
+		hypervisorsByIP:       make(map[string]*hypervisorType),
+		hypervisorsBySN:       make(map[string]*hypervisorType),
+		migratingIPs:          make(map[string]struct{}),
+		placementReservations: make(map[string][]*placementReservation),
+		subnets:               make(map[string]*subnetType),
+		vms:                   make(map[string]*vmInfoType),
 	}
 	html.HandleFunc("/listHypervisors", manager.listHypervisorsHandler)
 	html.HandleFunc("/listLocations", manager.listLocationsHandler)
+	html.HandleFunc("/listQuotas", manager.listQuotasHandler)
 	html.HandleFunc("/listVMs", manager.listVMsHandler)
 	html.HandleFunc("/listVMsByPrimaryOwner",
 		manager.listVMsByPrimaryOwnerHandler)
@@ -46,6 +48,7 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 	}
 	html.HandleFunc("/tftpdata/storage-layout.json",
 		manager.tftpdataStorageLayoutHandler)
+	go manager.loopDistributeQuotas()
 	go manager.notifierLoop()
 	return manager, nil
 }
@@ -6,8 +6,40 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/fleetmanager/topology"
 	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
+// getIpv4ForIpv6 returns the IPv4 address which is paired with an IPv6 address
+// in an address pool entry made by makePoolAddress.
+func getIpv4ForIpv6(ip net.IP) (net.IP, error) {
+	macAddr := util.GetEui64MacAddress(ip)
+	if len(macAddr) != 6 || macAddr[0] != 0x52 || macAddr[1] != 0x54 {
+		return nil,
+			fmt.Errorf("IPv6 address: %s not allocated by Fleet Manager", ip)
+	}
+	return net.IPv4(macAddr[2], macAddr[3], macAddr[4], macAddr[5]).To4(), nil
+}
+
+// makePoolAddress makes an address pool entry for an IPv4 address. The MAC
+// address is derived from the IPv4 address and the IPv6 address (if the subnet
+// has an IPv6 prefix) is derived from the MAC address.
+func makePoolAddress(ip net.IP, tSubnet *topology.Subnet) (
+	hyper_proto.Address, error) {
+	address := hyper_proto.Address{
+		IpAddress: ip,
+		MacAddress: fmt.Sprintf("52:54:%02x:%02x:%02x:%02x",
+			ip[0], ip[1], ip[2], ip[3]),
+	}
+	if tSubnet != nil {
+		ipv6Address, err := tSubnet.MakeIpv6Address(address.MacAddress)
+		if err != nil {
+			return hyper_proto.Address{}, err
+		}
+		address.Ipv6Address = ipv6Address
+	}
+	return address, nil
+}
+
 // This must be called with the lock held.
 func (m *Manager) checkIpReserved(tSubnet *topology.Subnet, ip net.IP) bool {
 	if ip.Equal(tSubnet.IpGateway) {
@@ -65,6 +97,17 @@ func (m *Manager) findFreeIPs(tSubnet *topology.Subnet,
 	return freeIPs, nil
 }
 
+// This must be called with the lock held.
+func (m *Manager) findSubnetForIp(ip net.IP) *topology.Subnet {
+	for _, subnet := range m.subnets {
+		subnetMask := net.IPMask(subnet.subnet.IpMask)
+		if ip.Mask(subnetMask).Equal(subnet.subnet.IpGateway.Mask(subnetMask)) {
+			return subnet.subnet
+		}
+	}
+	return nil
+}
+
 func (m *Manager) makeSubnet(tSubnet *topology.Subnet) *subnetType {
 	networkIp := tSubnet.IpGateway.Mask(net.IPMask(tSubnet.IpMask))
 	var startIp, stopIp net.IP
@@ -408,6 +408,10 @@ func (m *Manager) manageHypervisorLoop(h *hypervisorType) {
 		h.logger.Printf("error reading tags, not managing hypervisor: %s", err)
 		return
 	}
+	drainState, err := m.storer.ReadDrainState(h.Machine.HostIpAddress)
+	if err != nil {
+		h.logger.Printf("error reading drain state: %s\n", err)
+	}
 	for _, vmIpAddr := range vmList {
 		pVmInfo, err := m.storer.ReadVm(h.Machine.HostIpAddress, vmIpAddr)
 		if err != nil {
@@ -421,6 +425,9 @@ func (m *Manager) manageHypervisorLoop(h *hypervisorType) {
 		m.vms[vmIpAddr] = vmInfo
 		m.mutex.Unlock()
 	}
+	if drainState != nil {
+		m.resumeDrain(h, *drainState)
+	}
 	for !h.isDeleteScheduled() {
 		sleepTime := m.manageHypervisor(h)
 		time.Sleep(sleepTime)
@@ -470,6 +477,7 @@ func (m *Manager) manageHypervisor(h *hypervisorType) time.Duration {
 		return time.Second
 	}
 	h.mutex.Lock()
+	h.lastOwnerQuotas = nil // Hypervisor may have restarted, so resend quotas.
 	h.probeStatus = probeStatusConnected
 	if h.deleteScheduled {
 		h.mutex.Unlock()
@@ -524,6 +532,9 @@ func (m *Manager) processAddressPoolUpdates(h *hypervisorType,
 		addresses := make([]net.IP, 0, len(update.AddressPool))
 		for _, address := range update.AddressPool {
 			addresses = append(addresses, address.IpAddress)
+			if len(address.Ipv6Address) > 0 {
+				addresses = append(addresses, address.Ipv6Address)
+			}
 		}
 		err := m.storer.SetIPsForHypervisor(h.Machine.HostIpAddress,
 			addresses)
@@ -577,12 +588,16 @@ func (m *Manager) processAddressPoolUpdates(h *hypervisorType,
 				continue
 			}
 			for _, ip := range freeIPs {
+				address, err := makePoolAddress(ip, tSubnet)
+				if err != nil {
+					h.logger.Println(err)
+					return
+				}
 				ipsToAdd = append(ipsToAdd, ip)
-				addressesToAdd = append(addressesToAdd, hyper_proto.Address{
-					IpAddress: ip,
-					MacAddress: fmt.Sprintf("52:54:%02x:%02x:%02x:%02x",
-						ip[0], ip[1], ip[2], ip[3]),
-				})
+				if len(address.Ipv6Address) > 0 {
+					ipsToAdd = append(ipsToAdd, address.Ipv6Address)
+				}
+				addressesToAdd = append(addressesToAdd, address)
 			}
 			h.logger.Debugf(0, "Adding %d addresses to subnet: %s\n",
 				len(freeIPs), subnetId)
@@ -823,6 +838,8 @@ func (m *Manager) processVmUpdatesWithLock(h *hypervisorType,
 					h.Machine.Hostname}
 				h.vms[ipAddr] = vm
 				m.vms[ipAddr] = vm
+				m.releaseReportedPlacementReservationWithLock(
+					h.Machine.Hostname, ipAddr)
 				err := m.storer.WriteVm(h.Machine.HostIpAddress, ipAddr,
 					*protoVm)
 				if err != nil {
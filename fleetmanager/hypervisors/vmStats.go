@@ -0,0 +1,123 @@
+package hypervisors
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/stringutil"
+	"github.com/Cloud-Foundations/Dominator/lib/tags/tagmatcher"
+	fm_proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+	hyper_proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type hypervisorVmStats struct {
+	err      error
+	hostname string
+	vmStats  []hyper_proto.VmStats
+}
+
+type vmOwners struct {
+	flavour     string
+	ownerGroups []string
+	ownerUsers  []string
+}
+
+// getVmStats gets the stats for all the running VMs on the Hypervisor.
+func (h *hypervisorType) getVmStats() ([]hyper_proto.VmStats, error) {
+	client, err := srpc.DialHTTP("tcp", h.address(), time.Second*15)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return hyperclient.GetVmStats(client, hyper_proto.GetVmStatsRequest{})
+}
+
+// getVmStatsInLocation collects the VM stats from the connected Hypervisors
+// in parallel. Hypervisors which fail to respond are listed in the response
+// and are otherwise ignored.
+func (m *Manager) getVmStatsInLocation(
+	request fm_proto.GetVmStatsInLocationRequest) (
+	fm_proto.GetVmStatsInLocationResponse, error) {
+	hypervisors, err := m.listHypervisors(request.Location, showConnected, "",
+		tagmatcher.New(request.HypervisorTagsToMatch, false))
+	if err != nil {
+		return fm_proto.GetVmStatsInLocationResponse{}, err
+	}
+	ownerGroups := stringutil.ConvertListToMap(request.OwnerGroups, false)
+	ownerUsers := stringutil.ConvertListToMap(request.OwnerUsers, false)
+	vmTagMatcher := tagmatcher.New(request.VmTagsToMatch, false)
+	vmsToReport := make(map[string]vmOwners)
+	for _, hypervisor := range hypervisors {
+		hypervisor.mutex.RLock()
+		for ipAddr, vm := range hypervisor.vms {
+			if vm.checkOwnerGroups(ownerGroups) &&
+				vm.checkOwnerUsers(ownerUsers) &&
+				vmTagMatcher.MatchEach(vm.Tags) {
+				vmsToReport[ipAddr] = vmOwners{
+					flavour:     vm.Flavour,
+					ownerGroups: vm.OwnerGroups,
+					ownerUsers:  vm.OwnerUsers,
+				}
+			}
+		}
+		hypervisor.mutex.RUnlock()
+	}
+	resultsChannel := make(chan hypervisorVmStats, len(hypervisors))
+	for _, hypervisor := range hypervisors {
+		go func(h *hypervisorType) {
+			vmStats, err := h.getVmStats()
+			resultsChannel <- hypervisorVmStats{
+				err:      err,
+				hostname: h.Machine.Hostname,
+				vmStats:  vmStats,
+			}
+		}(hypervisor)
+	}
+	response := fm_proto.GetVmStatsInLocationResponse{
+		FlavourTotals:      make(map[string]fm_proto.ResourceUsage),
+		PrimaryOwnerTotals: make(map[string]fm_proto.ResourceUsage),
+	}
+	for range hypervisors {
+		result := <-resultsChannel
+		if result.err != nil {
+			m.logger.Printf("error getting VM stats from: %s: %s\n",
+				result.hostname, result.err)
+			response.FailedHypervisors = append(response.FailedHypervisors,
+				result.hostname)
+			continue
+		}
+		for _, vmStats := range result.vmStats {
+			owners, ok := vmsToReport[vmStats.IpAddress.String()]
+			if !ok {
+				continue
+			}
+			response.VmStats = append(response.VmStats, fm_proto.VmStats{
+				HypervisorHostname: result.hostname,
+				OwnerGroups:        owners.ownerGroups,
+				OwnerUsers:         owners.ownerUsers,
+				VmStats:            vmStats,
+			})
+			response.Totals.Add(vmStats)
+			if owners.flavour != "" {
+				usage := response.FlavourTotals[owners.flavour]
+				usage.Add(vmStats)
+				response.FlavourTotals[owners.flavour] = usage
+			}
+			if len(owners.ownerUsers) > 0 {
+				primaryOwner := owners.ownerUsers[0]
+				usage := response.PrimaryOwnerTotals[primaryOwner]
+				usage.Add(vmStats)
+				response.PrimaryOwnerTotals[primaryOwner] = usage
+			}
+		}
+	}
+	sort.Strings(response.FailedHypervisors)
+	sort.Slice(response.VmStats, func(left, right int) bool {
+		return bytes.Compare(response.VmStats[left].IpAddress.To16(),
+			response.VmStats[right].IpAddress.To16()) < 0
+	})
+	return response, nil
+}
@@ -28,23 +28,30 @@ func Setup(hypervisorsManager *hypervisors.Manager, logger log.DebugLogger) (
 		logger:             logger,
 		PerUserMethodLimiter: serverutil.NewPerUserMethodLimiter(
 			map[string]uint{
-				"GetMachineInfo": 1,
-				"GetUpdates":     1,
+				"GetMachineInfo":       1,
+				"GetUpdates":           1,
+				"GetVmStatsInLocation": 1,
 			}),
 	}
 	srpc.RegisterNameWithOptions("FleetManager", srpcObj,
 		srpc.ReceiverOptions{
 			PublicMethods: []string{
 				"ChangeMachineTags",
+				"CreateVmInLocation",
+				"DrainHypervisor",
+				"GetFlavour",
 				"GetHypervisorForVM",
 				"GetHypervisorsInLocation",
 				"GetIpInfo",
 				"GetMachineInfo",
 				"GetUpdates",
+				"GetVmStatsInLocation",
 				"ListHypervisorLocations",
 				"ListHypervisorsInLocation",
 				"ListVMsInLocation",
+				"PlaceVm",
 				"PowerOnMachine",
+				"ReleaseVmPlacement",
 			}})
 	return (*htmlWriter)(srpcObj), nil
 }
@@ -0,0 +1,9 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func (t *srpcType) DrainHypervisor(conn *srpc.Conn) error {
+	return t.hypervisorsManager.DrainHypervisor(conn)
+}
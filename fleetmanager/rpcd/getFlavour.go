@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func (t *srpcType) GetFlavour(conn *srpc.Conn,
+	request proto.GetFlavourRequest, reply *proto.GetFlavourResponse) error {
+	flavour, err := t.hypervisorsManager.GetFlavour(request.Location,
+		request.Name)
+	*reply = proto.GetFlavourResponse{
+		Error:   errors.ErrorToString(err),
+		Flavour: flavour,
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func (t *srpcType) GetVmStatsInLocation(conn *srpc.Conn,
+	request proto.GetVmStatsInLocationRequest,
+	reply *proto.GetVmStatsInLocationResponse) error {
+	response, err := t.hypervisorsManager.GetVmStatsInLocation(request)
+	if err == nil {
+		*reply = response
+	} else {
+		*reply = proto.GetVmStatsInLocationResponse{
+			Error: errors.ErrorToString(err),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func (t *srpcType) PlaceVm(conn *srpc.Conn, request proto.PlaceVmRequest,
+	reply *proto.PlaceVmResponse) error {
+	address, reservationId, err := t.hypervisorsManager.PlaceVm(request)
+	*reply = proto.PlaceVmResponse{
+		Error:             errors.ErrorToString(err),
+		HypervisorAddress: address,
+		ReservationId:     reservationId,
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
+)
+
+func (t *srpcType) ReleaseVmPlacement(conn *srpc.Conn,
+	request proto.ReleaseVmPlacementRequest,
+	reply *proto.ReleaseVmPlacementResponse) error {
+	t.hypervisorsManager.ReleaseVmPlacement(request.ReservationId)
+	return nil
+}
@@ -13,11 +13,12 @@ import (
 
 type Directory struct {
 	Name             string
-	Directories      []*Directory        `json:",omitempty"`
-	InstallConfig    *InstallConfig      `json:",omitempty"`
-	Machines         []*fm_proto.Machine `json:",omitempty"`
-	Subnets          []*Subnet           `json:",omitempty"`
-	Tags             tags.Tags           `json:",omitempty"`
+	Directories      []*Directory                 `json:",omitempty"`
+	Flavours         map[string]*fm_proto.Flavour `json:",omitempty"`
+	InstallConfig    *InstallConfig               `json:",omitempty"`
+	Machines         []*fm_proto.Machine          `json:",omitempty"`
+	Subnets          []*Subnet                    `json:",omitempty"`
+	Tags             tags.Tags                    `json:",omitempty"`
 	logger           log.DebugLogger
 	nameToDirectory  map[string]*Directory // Key: directory name.
 	owners           *ownersType
@@ -75,6 +76,7 @@ func (subnet *Subnet) Shrink() {
 }
 
 type Topology struct {
+	Quotas          *fm_proto.Quotas
 	Root            *Directory
 	Variables       map[string]string
 	hostIpAddresses map[string]struct{}
@@ -128,6 +130,12 @@ func (t *Topology) FindDirectory(dirname string) (*Directory, error) {
 	return t.findDirectory(dirname)
 }
 
+// GetFlavour returns the named flavour which is visible in the specified
+// directory. Flavours are inherited from parent directories.
+func (t *Topology) GetFlavour(dirname, name string) (*fm_proto.Flavour, error) {
+	return t.getFlavour(dirname, name)
+}
+
 func (t *Topology) GetInstallConfigForMachine(name string) (
 	*InstallConfig, error) {
 	return t.getInstallConfigForMachine(name)
@@ -20,6 +20,14 @@ func (left *Directory) equal(right *Directory) bool {
 	if len(left.Directories) != len(right.Directories) {
 		return false
 	}
+	if len(left.Flavours) != len(right.Flavours) {
+		return false
+	}
+	for name, leftFlavour := range left.Flavours {
+		if !leftFlavour.Equal(right.Flavours[name]) {
+			return false
+		}
+	}
 	if !left.InstallConfig.equal(right.InstallConfig) {
 		return false
 	}
@@ -86,6 +94,9 @@ func (left *Topology) equal(right *Topology) bool {
 	if len(left.Variables) != len(right.Variables) {
 		return false
 	}
+	if !left.Quotas.Equal(right.Quotas) {
+		return false
+	}
 	if !left.Root.equal(right.Root) {
 		return false
 	}
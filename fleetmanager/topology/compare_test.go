@@ -33,8 +33,14 @@ func testNonzero(t *testing.T, valueValue reflect.Value, equalTest func(),
 			equalTest()
 			mapValue := reflect.MakeMap(fieldValue.Type())
 			fieldValue.Set(mapValue)
-			mapValue.SetMapIndex(reflect.ValueOf("key"),
-				reflect.ValueOf("value"))
+			if elemType := fieldValue.Type().Elem(); elemType.Kind() ==
+				reflect.Ptr {
+				mapValue.SetMapIndex(reflect.ValueOf("key"),
+					reflect.New(elemType.Elem()))
+			} else {
+				mapValue.SetMapIndex(reflect.ValueOf("key"),
+					reflect.ValueOf("value"))
+			}
 			notEqualTest()
 			fieldValue.Set(reflect.MakeMap(fieldValue.Type()))
 			equalTest()
@@ -2,8 +2,22 @@ package topology
 
 import (
 	"fmt"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/fleetmanager"
 )
 
+func (t *Topology) getFlavour(dirname, name string) (*proto.Flavour, error) {
+	directory, err := t.findDirectory(dirname)
+	if err != nil {
+		return nil, err
+	}
+	if flavour, ok := directory.Flavours[name]; !ok {
+		return nil, fmt.Errorf("unknown flavour: %s in: %s", name, dirname)
+	} else {
+		return flavour, nil
+	}
+}
+
 func (t *Topology) getInstallConfigForMachine(name string) (
 	*InstallConfig, error) {
 	if directory, ok := t.machineParents[name]; !ok {
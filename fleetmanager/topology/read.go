@@ -24,10 +24,11 @@ type commonStateType struct {
 }
 
 type inheritingState struct {
-	installConfig *InstallConfig      // Replace semantics.
-	owners        *ownersType         // Merge semantics.
-	subnetIds     map[string]struct{} // Merge semantics.
-	tags          tags.Tags           // Merge semantics.
+	flavours      map[string]*proto.Flavour // Merge semantics.
+	installConfig *InstallConfig            // Replace semantics.
+	owners        *ownersType               // Merge semantics.
+	subnetIds     map[string]struct{}       // Merge semantics.
+	tags          tags.Tags                 // Merge semantics.
 }
 
 func checkMacAddressIsZero(macAddr proto.HardwareAddr) bool {
@@ -68,6 +69,11 @@ func load(params Params) (*Topology, error) {
 		return nil, err
 	}
 	topology.Root = directory
+	topology.Quotas, err = loadQuotas(filepath.Join(params.TopologyDir,
+		"quotas.json"))
+	if err != nil {
+		return nil, err
+	}
 	topology.hostIpAddresses = commonState.ipAddresses
 	if err := topology.readVariables(params.VariablesDir, ""); err != nil {
 		return nil, err
@@ -75,6 +81,22 @@ func load(params Params) (*Topology, error) {
 	return topology, nil
 }
 
+func loadFlavours(filename string) (map[string]*proto.Flavour, error) {
+	var flavours map[string]*proto.Flavour
+	if err := json.ReadFromFile(filename, &flavours); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading: %s: %s", filename, err)
+	}
+	for name, flavour := range flavours {
+		if flavour == nil {
+			return nil, fmt.Errorf("%s: empty flavour: %s", filename, name)
+		}
+	}
+	return flavours, nil
+}
+
 func loadInstallConfig(filename string) (*InstallConfig, error) {
 	var installConfig InstallConfig
 	if err := json.ReadFromFile(filename, &installConfig); err != nil {
@@ -83,6 +105,12 @@ func loadInstallConfig(filename string) (*InstallConfig, error) {
 		}
 		return nil, fmt.Errorf("error reading: %s: %s", filename, err)
 	}
+	if installConfig.StorageLayout != nil {
+		if err := installConfig.StorageLayout.Check(); err != nil {
+			return nil, fmt.Errorf("invalid StorageLayout in: %s: %s",
+				filename, err)
+		}
+	}
 	return &installConfig, nil
 }
 
@@ -134,6 +162,17 @@ func loadOwners(filename string) (*ownersType, error) {
 	return &owners, nil
 }
 
+func loadQuotas(filename string) (*proto.Quotas, error) {
+	var quotas proto.Quotas
+	if err := json.ReadFromFile(filename, &quotas); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading: %s: %s", filename, err)
+	}
+	return &quotas, nil
+}
+
 func loadSubnets(filename string) ([]*Subnet, error) {
 	var subnets []*Subnet
 	if err := json.ReadFromFile(filename, &subnets); err != nil {
@@ -145,6 +184,9 @@ func loadSubnets(filename string) ([]*Subnet, error) {
 	gatewayIPs := make(map[string]struct{}, len(subnets))
 	for _, subnet := range subnets {
 		subnet.Shrink()
+		if err := subnet.CheckIpv6(); err != nil {
+			return nil, fmt.Errorf("subnet: %s: %s", subnet.Id, err)
+		}
 		gatewayIp := subnet.IpGateway.String()
 		if _, ok := gatewayIPs[gatewayIp]; ok {
 			return nil, fmt.Errorf("duplicate gateway IP: %s", gatewayIp)
@@ -269,6 +311,7 @@ func (cState *commonStateType) addNetworkEntry(entry proto.NetworkEntry,
 
 func newInheritingState() *inheritingState {
 	return &inheritingState{
+		flavours:  make(map[string]*proto.Flavour),
 		owners:    &ownersType{},
 		subnetIds: cloneSet(nil),
 		tags:      make(tags.Tags),
@@ -276,7 +319,12 @@ func newInheritingState() *inheritingState {
 }
 
 func (iState *inheritingState) copy() *inheritingState {
+	flavours := make(map[string]*proto.Flavour, len(iState.flavours))
+	for name, flavour := range iState.flavours {
+		flavours[name] = flavour
+	}
 	return &inheritingState{
+		flavours:      flavours,
 		installConfig: iState.installConfig,
 		owners:        iState.owners.copy(),
 		subnetIds:     cloneSet(iState.subnetIds),
@@ -308,6 +356,9 @@ func (t *Topology) readDirectory(topDir, dirname string,
 	}
 	dirpath := filepath.Join(topDir, dirname)
 	t.logger.Debugf(1, "T.readDirectory(%s)\n", dirpath)
+	if err := directory.loadFlavours(dirpath, iState.flavours); err != nil {
+		return nil, err
+	}
 	if err := directory.loadInstallConfig(dirpath, iState); err != nil {
 		return nil, err
 	}
@@ -353,6 +404,21 @@ func (t *Topology) readDirectory(topDir, dirname string,
 	return directory, nil
 }
 
+func (directory *Directory) loadFlavours(dirname string,
+	parentFlavours map[string]*proto.Flavour) error {
+	flavours, err := loadFlavours(filepath.Join(dirname, "flavours.json"))
+	if err != nil {
+		return err
+	}
+	for name, flavour := range flavours {
+		parentFlavours[name] = flavour
+	}
+	if len(parentFlavours) > 0 {
+		directory.Flavours = parentFlavours
+	}
+	return nil
+}
+
 func (directory *Directory) loadInstallConfig(dirname string,
 	iState *inheritingState) error {
 	installConfig, err := loadInstallConfig(filepath.Join(dirname,
@@ -0,0 +1,62 @@
+package topology
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	installer_proto "github.com/Cloud-Foundations/Dominator/proto/installer"
+)
+
+func writeInstallConfig(t *testing.T, data string) string {
+	filename := filepath.Join(t.TempDir(), "install-config.json")
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadInstallConfig(t *testing.T) {
+	installConfig, err := loadInstallConfig(writeInstallConfig(t, `{
+		"StorageLayout": {
+			"BootDriveLayout": [
+				{"MountPoint": "/boot", "MinimumFreeBytes": 268435456},
+				{"MountPoint": "/", "FileSystemType": "xfs"},
+				{"MountPoint": "/data", "Encrypt": true}
+			],
+			"KeyServerUrl": "http://keys.example.com/",
+			"RaidLevel": "raid1"
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout := installConfig.StorageLayout
+	if layout == nil {
+		t.Fatal("no StorageLayout")
+	}
+	if layout.RaidLevel != installer_proto.RaidLevel1 {
+		t.Errorf("RaidLevel: %s", layout.RaidLevel)
+	}
+	if layout.BootDriveLayout[1].FileSystemType !=
+		installer_proto.FileSystemTypeXfs {
+		t.Errorf("root FileSystemType: %s",
+			layout.BootDriveLayout[1].FileSystemType)
+	}
+	installConfig, err = loadInstallConfig(writeInstallConfig(t, `{
+		"StorageLayout": {
+			"BootDriveLayout": [{"MountPoint": "/", "Encrypt": true}]
+		}
+	}`))
+	if err == nil {
+		t.Error("invalid StorageLayout loaded")
+	}
+	installConfig, err = loadInstallConfig(
+		filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installConfig != nil {
+		t.Error("InstallConfig loaded from missing file")
+	}
+}
@@ -8,14 +8,15 @@ require (
 	github.com/d2g/dhcp4 v0.0.0-20170904100407-a1d1b6c41b1c
 	github.com/d2g/dhcp4client v1.0.0
 	github.com/fsnotify/fsnotify v1.5.1
+	github.com/klauspost/compress v1.18.0
 	github.com/krolaw/dhcp4 v0.0.0-20190909130307-a50d88189771
 	github.com/pin/tftp v2.1.0+incompatible
 	golang.org/x/crypto v0.30.0
 	golang.org/x/net v0.21.0
+	golang.org/x/sys v0.28.0
 )
 
 require (
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/term v0.27.0 // indirect
 )
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	"github.com/Cloud-Foundations/Dominator/lib/tags"
@@ -33,6 +34,11 @@ func AddVmVolumes(client srpc.ClientI, ipAddress net.IP, sizes []uint64) error {
 	return addVmVolumes(client, ipAddress, sizes)
 }
 
+func BackupVm(client srpc.ClientI, request proto.BackupVmRequest,
+	logger log.DebugLogger) (hash.Hash, error) {
+	return backupVm(client, request, logger)
+}
+
 func BecomePrimaryVmOwner(client srpc.ClientI, ipAddress net.IP) error {
 	return becomePrimaryVmOwner(client, ipAddress)
 }
@@ -57,6 +63,11 @@ func ChangeVmHostname(client srpc.ClientI, ipAddress net.IP,
 	return changeVmHostname(client, ipAddress, hostname)
 }
 
+func ChangeVmIoLimits(client srpc.ClientI,
+	request proto.ChangeVmIoLimitsRequest) error {
+	return changeVmIoLimits(client, request)
+}
+
 func ChangeVmMachineType(client srpc.ClientI, ipAddress net.IP,
 	machineType proto.MachineType) error {
 	return changeVmMachineType(client, ipAddress, machineType)
@@ -212,6 +223,11 @@ func GetVmLastPatchLog(client srpc.ClientI, ipAddress net.IP) (
 	return getVmLastPatchLog(client, ipAddress)
 }
 
+func GetVmStats(client srpc.ClientI,
+	request proto.GetVmStatsRequest) ([]proto.VmStats, error) {
+	return getVmStats(client, request)
+}
+
 func GetVmUserData(client srpc.ClientI, ipAddress net.IP,
 	accessToken []byte) (io.ReadCloser, uint64, error) {
 	return getVmUserData(client, ipAddress, accessToken)
@@ -340,10 +356,26 @@ func ScanVmRoot(client srpc.ClientI, ipAddress net.IP,
 	return scanVmRoot(client, ipAddress, scanFilter)
 }
 
+// SendVmLiveMigration will ask the source Hypervisor to live migrate the
+// running VM to the destination URIs in request. The progressFunc is called for
+// each progress message. The commitFunc is called once the source VM has been
+// paused and the destination has all of its state. If commitFunc returns true
+// the source VM is stopped, else it is resumed.
+func SendVmLiveMigration(client srpc.ClientI,
+	request proto.SendVmLiveMigrationRequest, progressFunc func(string),
+	commitFunc func() bool) error {
+	return sendVmLiveMigration(client, request, progressFunc, commitFunc)
+}
+
 func SetDisabledState(client srpc.ClientI, disable bool) error {
 	return setDisabledState(client, disable)
 }
 
+func SetVmSnapshotPolicy(client srpc.ClientI,
+	request proto.SetVmSnapshotPolicyRequest) error {
+	return setVmSnapshotPolicy(client, request)
+}
+
 func SnapshotVm(client srpc.ClientI,
 	request proto.SnapshotVmRequest) error {
 	return snapshotVm(client, request)
@@ -15,6 +15,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
 	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/rsync"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
@@ -41,6 +42,36 @@ func addVmVolumes(client srpc.ClientI, ipAddress net.IP, sizes []uint64) error {
 	return errors.New(reply.Error)
 }
 
+func backupVm(client srpc.ClientI, request proto.BackupVmRequest,
+	logger log.DebugLogger) (hash.Hash, error) {
+	conn, err := client.Call("Hypervisor.BackupVm")
+	if err != nil {
+		return hash.Hash{}, err
+	}
+	defer conn.Close()
+	if err := conn.Encode(request); err != nil {
+		return hash.Hash{}, err
+	}
+	if err := conn.Flush(); err != nil {
+		return hash.Hash{}, err
+	}
+	for {
+		var reply proto.BackupVmResponse
+		if err := conn.Decode(&reply); err != nil {
+			return hash.Hash{}, err
+		}
+		if reply.Error != "" {
+			return hash.Hash{}, errors.New(reply.Error)
+		}
+		if reply.ProgressMessage != "" {
+			logger.Debugln(0, reply.ProgressMessage)
+		}
+		if reply.Final {
+			return reply.ManifestHash, nil
+		}
+	}
+}
+
 func becomePrimaryVmOwner(client srpc.ClientI, ipAddress net.IP) error {
 	request := proto.BecomePrimaryVmOwnerRequest{ipAddress}
 	var reply proto.BecomePrimaryVmOwnerResponse
@@ -108,6 +139,16 @@ func changeVmHostname(client srpc.ClientI, ipAddress net.IP,
 	return errors.New(reply.Error)
 }
 
+func changeVmIoLimits(client srpc.ClientI,
+	request proto.ChangeVmIoLimitsRequest) error {
+	var reply proto.ChangeVmIoLimitsResponse
+	err := client.RequestReply("Hypervisor.ChangeVmIoLimits", request, &reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
+
 func changeVmMachineType(client srpc.ClientI, ipAddress net.IP,
 	consoleType proto.MachineType) error {
 	request := proto.ChangeVmMachineTypeRequest{
@@ -686,6 +727,19 @@ func getVmLastPatchLog(client srpc.ClientI, ipAddr net.IP) (
 	return buffer.Bytes(), response.PatchTime, nil
 }
 
+func getVmStats(client srpc.ClientI,
+	request proto.GetVmStatsRequest) ([]proto.VmStats, error) {
+	var reply proto.GetVmStatsResponse
+	err := client.RequestReply("Hypervisor.GetVmStats", request, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.VmStats, nil
+}
+
 func getVmUserData(client srpc.ClientI, ipAddress net.IP,
 	accessToken []byte) (io.ReadCloser, uint64, error) {
 	conn, err := client.Call("Hypervisor.GetVmUserData")
@@ -741,6 +795,9 @@ func getVmVolume(client srpc.ClientI, request proto.GetVmVolumeRequest,
 	if err := errors.New(response.Error); err != nil {
 		return proto.GetVmVolumeResponse{}, err
 	}
+	if request.ExtraFilesOnly {
+		return response, nil
+	}
 	startTime := time.Now()
 	stats, err := rsync.GetBlocks(conn, conn, conn, reader, writer,
 		size, initialFileSize)
@@ -1172,6 +1229,49 @@ func sendUpdateRequests(conn *srpc.Conn,
 	}
 }
 
+func sendVmLiveMigration(client srpc.ClientI,
+	request proto.SendVmLiveMigrationRequest, progressFunc func(string),
+	commitFunc func() bool) error {
+	conn, err := client.Call("Hypervisor.SendVmLiveMigration")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.Encode(request); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	for {
+		var reply proto.SendVmLiveMigrationResponse
+		if err := conn.Decode(&reply); err != nil {
+			return err
+		}
+		if reply.Error != "" {
+			return errors.New(reply.Error)
+		}
+		if reply.ProgressMessage != "" {
+			progressFunc(reply.ProgressMessage)
+		}
+		if reply.RequestCommit {
+			commitResponse := proto.SendVmLiveMigrationResponseResponse{
+				Commit: commitFunc(),
+			}
+			if err := conn.Encode(commitResponse); err != nil {
+				return err
+			}
+			if err := conn.Flush(); err != nil {
+				return err
+			}
+		}
+		if reply.Final {
+			break
+		}
+	}
+	return nil
+}
+
 func setDisabledState(client srpc.ClientI, disable bool) error {
 	request := proto.SetDisabledStateRequest{Disable: disable}
 	var reply proto.SetDisabledStateResponse
@@ -1182,6 +1282,17 @@ func setDisabledState(client srpc.ClientI, disable bool) error {
 	return errors.New(reply.Error)
 }
 
+func setVmSnapshotPolicy(client srpc.ClientI,
+	request proto.SetVmSnapshotPolicyRequest) error {
+	var reply proto.SetVmSnapshotPolicyResponse
+	err := client.RequestReply("Hypervisor.SetVmSnapshotPolicy", request,
+		&reply)
+	if err != nil {
+		return err
+	}
+	return errors.New(reply.Error)
+}
+
 func snapshotVm(client srpc.ClientI,
 	request proto.SnapshotVmRequest) error {
 	var reply proto.SnapshotVmResponse
@@ -9,22 +9,26 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/net/util"
 	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+	"golang.org/x/net/ipv6"
 )
 
 type DhcpServer struct {
+	dhcp6ServerId     []byte // DUID.
 	dynamicLeasesFile string
 	logger            log.DebugLogger
 	cleanupTrigger    chan<- struct{}
 	interfaceIPs      map[string][]net.IP // Key: interface name.
+	interfaceIPv6s    map[string][]net.IP // Key: interface name.
 	myIPs             []net.IP
 	networkBootImage  string
 	requestInterface  string
 	routeTable        map[string]*util.RouteEntry // Key: interface name.
-	mutex             sync.RWMutex                // Protect everything below.
-	ackChannels       map[string]chan struct{}    // Key: IPaddr.
-	dynamicLeases     map[string]*leaseType       // Key: MACaddr.
-	interfaceSubnets  map[string][]*subnetType    // Key: interface name.
-	ipAddrToMacAddr   map[string]string           // Key: IPaddr, V: MACaddr.
+	routerAdvertConn  *ipv6.PacketConn
+	mutex             sync.RWMutex             // Protect everything below.
+	ackChannels       map[string]chan struct{} // Key: IPaddr.
+	dynamicLeases     map[string]*leaseType    // Key: MACaddr.
+	interfaceSubnets  map[string][]*subnetType // Key: interface name.
+	ipAddrToMacAddr   map[string]string        // Key: IPaddr, V: MACaddr.
 	packetWatchers    map[<-chan proto.WatchDhcpResponse]chan<- proto.WatchDhcpResponse
 	requestChannels   map[string]chan net.IP // Key: MACaddr.
 	staticLeases      map[string]leaseType   // Key: MACaddr.
@@ -42,6 +46,7 @@ type leaseType struct {
 
 type subnetType struct {
 	amGateway     bool
+	ipv6Interface string // Where Router Advertisements are sent.
 	myIP          net.IP
 	nextDynamicIP net.IP
 	proto.Subnet
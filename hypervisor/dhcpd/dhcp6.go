@@ -0,0 +1,349 @@
+package dhcpd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	dhcp6ServerPort = 547
+
+	dhcp6MessageSolicit            = 1
+	dhcp6MessageAdvertise          = 2
+	dhcp6MessageRequest            = 3
+	dhcp6MessageConfirm            = 4
+	dhcp6MessageRenew              = 5
+	dhcp6MessageRebind             = 6
+	dhcp6MessageReply              = 7
+	dhcp6MessageRelease            = 8
+	dhcp6MessageDecline            = 9
+	dhcp6MessageInformationRequest = 11
+
+	dhcp6OptionClientId    = 1
+	dhcp6OptionServerId    = 2
+	dhcp6OptionIaNa        = 3
+	dhcp6OptionIaAddr      = 5
+	dhcp6OptionStatusCode  = 13
+	dhcp6OptionRapidCommit = 14
+	dhcp6OptionDnsServers  = 23
+	dhcp6OptionDomainList  = 24
+
+	dhcp6StatusSuccess = 0
+
+	duidTypeLinkLayerTime = 1
+	duidTypeLinkLayer     = 3
+	hardwareTypeEthernet  = 1
+)
+
+var dhcp6AllServersAddr = net.ParseIP("ff02::1:2")
+
+type dhcp6Message struct {
+	messageType   byte
+	transactionId [3]byte
+	options       []dhcp6Option
+}
+
+type dhcp6Option struct {
+	code uint16
+	data []byte
+}
+
+// encodeDomainName encodes a domain name in the DNS wire format, as used by
+// the DHCPv6 Domain List and Router Advertisement DNSSL options.
+func encodeDomainName(name string) []byte {
+	var buffer []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		buffer = append(buffer, byte(len(label)))
+		buffer = append(buffer, label...)
+	}
+	return append(buffer, 0)
+}
+
+// getDhcp6ClientMacs returns the candidate MAC addresses for a DHCPv6 client,
+// most specific first. The source link-local address identifies the interface
+// the client is configuring, whereas the DUID may be for any interface.
+func getDhcp6ClientMacs(clientId []byte, srcIP net.IP) []string {
+	var macAddrs []string
+	if macAddr := util.GetEui64MacAddress(srcIP); macAddr != nil {
+		macAddrs = append(macAddrs, macAddr.String())
+	}
+	if len(clientId) < 4 ||
+		binary.BigEndian.Uint16(clientId[2:4]) != hardwareTypeEthernet {
+		return macAddrs
+	}
+	switch binary.BigEndian.Uint16(clientId[:2]) {
+	case duidTypeLinkLayerTime:
+		if len(clientId) == 14 {
+			macAddrs = append(macAddrs,
+				net.HardwareAddr(clientId[8:]).String())
+		}
+	case duidTypeLinkLayer:
+		if len(clientId) == 10 {
+			macAddrs = append(macAddrs,
+				net.HardwareAddr(clientId[4:]).String())
+		}
+	}
+	return macAddrs
+}
+
+// makeDhcp6ServerId makes a DUID-LL from the first Ethernet interface.
+func makeDhcp6ServerId(ifIndices map[int]string) []byte {
+	indices := make([]int, 0, len(ifIndices))
+	for index := range ifIndices {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		duid := make([]byte, 4, 10)
+		binary.BigEndian.PutUint16(duid[:2], duidTypeLinkLayer)
+		binary.BigEndian.PutUint16(duid[2:4], hardwareTypeEthernet)
+		return append(duid, iface.HardwareAddr...)
+	}
+	return nil
+}
+
+func makeDhcp6IaNa(iaid []byte, ipAddr net.IP) []byte {
+	validTime := uint32(staticLeaseTime.Seconds())
+	iaAddr := make([]byte, 24)
+	copy(iaAddr, ipAddr.To16())
+	binary.BigEndian.PutUint32(iaAddr[16:20], validTime) // Preferred.
+	binary.BigEndian.PutUint32(iaAddr[20:24], validTime) // Valid.
+	iaNa := make([]byte, 12, 12+4+len(iaAddr))
+	copy(iaNa, iaid)
+	binary.BigEndian.PutUint32(iaNa[4:8], validTime/2)    // T1.
+	binary.BigEndian.PutUint32(iaNa[8:12], validTime/5*4) // T2.
+	return append(iaNa, marshalDhcp6Option(dhcp6OptionIaAddr, iaAddr)...)
+}
+
+func makeDhcp6StatusCode(code uint16, message string) []byte {
+	data := make([]byte, 2, 2+len(message))
+	binary.BigEndian.PutUint16(data, code)
+	return append(data, message...)
+}
+
+func marshalDhcp6Option(code uint16, data []byte) []byte {
+	buffer := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(buffer[:2], code)
+	binary.BigEndian.PutUint16(buffer[2:4], uint16(len(data)))
+	return append(buffer, data...)
+}
+
+func parseDhcp6Message(data []byte) (*dhcp6Message, error) {
+	if len(data) < 4 {
+		return nil, errors.New("short DHCPv6 message")
+	}
+	msg := &dhcp6Message{messageType: data[0]}
+	copy(msg.transactionId[:], data[1:4])
+	for data = data[4:]; len(data) > 0; {
+		if len(data) < 4 {
+			return nil, errors.New("truncated DHCPv6 option header")
+		}
+		code := binary.BigEndian.Uint16(data[:2])
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if len(data) < 4+length {
+			return nil, fmt.Errorf("truncated DHCPv6 option: %d", code)
+		}
+		msg.options = append(msg.options, dhcp6Option{code, data[4 : 4+length]})
+		data = data[4+length:]
+	}
+	return msg, nil
+}
+
+func (msg *dhcp6Message) addOption(code uint16, data []byte) {
+	msg.options = append(msg.options, dhcp6Option{code, data})
+}
+
+func (msg *dhcp6Message) getOption(code uint16) ([]byte, bool) {
+	for _, option := range msg.options {
+		if option.code == code {
+			return option.data, true
+		}
+	}
+	return nil, false
+}
+
+func (msg *dhcp6Message) marshal() []byte {
+	buffer := make([]byte, 4, 512)
+	buffer[0] = msg.messageType
+	copy(buffer[1:4], msg.transactionId[:])
+	for _, option := range msg.options {
+		buffer = append(buffer, marshalDhcp6Option(option.code, option.data)...)
+	}
+	return buffer
+}
+
+// This must be called with the lock held.
+func (s *DhcpServer) findDhcp6Lease(clientId []byte, srcIP net.IP) (
+	*leaseType, *subnetType) {
+	for _, macAddr := range getDhcp6ClientMacs(clientId, srcIP) {
+		lease, subnet := s.findStaticLease(macAddr)
+		if lease != nil && len(lease.Ipv6Address) > 0 {
+			return lease, subnet
+		}
+	}
+	return nil, nil
+}
+
+// makeDhcp6Reply makes the reply for a DHCPv6 request. If no reply should be
+// sent, nil is returned. Only static leases with an IPv6 address are served.
+func (s *DhcpServer) makeDhcp6Reply(request *dhcp6Message, srcIP net.IP,
+	interfaceName string) *dhcp6Message {
+	clientId, _ := request.getOption(dhcp6OptionClientId)
+	serverId, haveServerId := request.getOption(dhcp6OptionServerId)
+	if haveServerId && !bytes.Equal(serverId, s.dhcp6ServerId) {
+		return nil // Message not for this DHCP server.
+	}
+	reply := &dhcp6Message{
+		messageType:   dhcp6MessageReply,
+		transactionId: request.transactionId,
+	}
+	switch request.messageType {
+	case dhcp6MessageSolicit:
+		if _, ok := request.getOption(dhcp6OptionRapidCommit); ok {
+			reply.addOption(dhcp6OptionRapidCommit, nil)
+		} else {
+			reply.messageType = dhcp6MessageAdvertise
+		}
+	case dhcp6MessageRequest, dhcp6MessageRenew:
+		if !haveServerId {
+			return nil
+		}
+	case dhcp6MessageConfirm, dhcp6MessageRebind, dhcp6MessageRelease,
+		dhcp6MessageDecline, dhcp6MessageInformationRequest:
+	default:
+		s.logger.Debugf(0, "Unsupported DHCPv6 message type: %d on: %s\n",
+			request.messageType, interfaceName)
+		return nil
+	}
+	if len(clientId) < 1 {
+		return nil
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	lease, subnet := s.findDhcp6Lease(clientId, srcIP)
+	if lease == nil {
+		s.logger.Debugf(1, "No IPv6 lease found for: %s on: %s\n",
+			srcIP, interfaceName)
+		return nil
+	}
+	s.logger.Debugf(0, "DHCPv6 reply type: %d for: %s to: %s on: %s\n",
+		reply.messageType, lease.Ipv6Address, lease.MacAddress,
+		interfaceName)
+	reply.addOption(dhcp6OptionServerId, s.dhcp6ServerId)
+	reply.addOption(dhcp6OptionClientId, clientId)
+	switch request.messageType {
+	case dhcp6MessageConfirm, dhcp6MessageRelease, dhcp6MessageDecline:
+		reply.addOption(dhcp6OptionStatusCode,
+			makeDhcp6StatusCode(dhcp6StatusSuccess, "OK"))
+		return reply
+	case dhcp6MessageInformationRequest:
+	default:
+		iaNa, ok := request.getOption(dhcp6OptionIaNa)
+		if ok && len(iaNa) >= 4 {
+			reply.addOption(dhcp6OptionIaNa,
+				makeDhcp6IaNa(iaNa[:4], lease.Ipv6Address))
+		}
+	}
+	if subnet == nil {
+		return reply
+	}
+	var dnsServers []byte
+	for _, dnsServer := range subnet.DomainNameServers {
+		if dnsServer.To4() == nil {
+			dnsServers = append(dnsServers, dnsServer.To16()...)
+		}
+	}
+	if len(dnsServers) > 0 {
+		reply.addOption(dhcp6OptionDnsServers, dnsServers)
+	}
+	if subnet.DomainName != "" {
+		reply.addOption(dhcp6OptionDomainList,
+			encodeDomainName(subnet.DomainName))
+	}
+	return reply
+}
+
+func (s *DhcpServer) serveDhcp6(conn *ipv6.PacketConn,
+	ifIndices map[int]string) {
+	buffer := make([]byte, 1500)
+	for {
+		nRead, cm, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			s.logger.Println(err)
+			return
+		}
+		if cm == nil {
+			continue
+		}
+		interfaceName, ok := ifIndices[cm.IfIndex]
+		if !ok {
+			continue
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		request, err := parseDhcp6Message(buffer[:nRead])
+		if err != nil {
+			s.logger.Debugf(0, "error parsing DHCPv6 message from: %s: %s\n",
+				udpAddr.IP, err)
+			continue
+		}
+		reply := s.makeDhcp6Reply(request, udpAddr.IP, interfaceName)
+		if reply == nil {
+			continue
+		}
+		_, err = conn.WriteTo(reply.marshal(),
+			&ipv6.ControlMessage{IfIndex: cm.IfIndex}, udpAddr)
+		if err != nil {
+			s.logger.Printf("error sending DHCPv6 reply to: %s: %s\n",
+				udpAddr, err)
+		}
+	}
+}
+
+func (s *DhcpServer) startDhcp6(ifIndices map[int]string) error {
+	s.dhcp6ServerId = makeDhcp6ServerId(ifIndices)
+	if len(s.dhcp6ServerId) < 1 {
+		return errors.New("no Ethernet interface for DHCPv6 server ID")
+	}
+	listener, err := net.ListenPacket("udp6",
+		fmt.Sprintf(":%d", dhcp6ServerPort))
+	if err != nil {
+		return err
+	}
+	pktConn := ipv6.NewPacketConn(listener)
+	if err := pktConn.SetControlMessage(ipv6.FlagInterface, true); err != nil {
+		listener.Close()
+		return err
+	}
+	for index, name := range ifIndices {
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		err = pktConn.JoinGroup(iface, &net.UDPAddr{IP: dhcp6AllServersAddr})
+		if err != nil {
+			s.logger.Printf("error joining DHCPv6 group on: %s: %s\n",
+				name, err)
+		}
+	}
+	go s.serveDhcp6(pktConn, ifIndices)
+	return nil
+}
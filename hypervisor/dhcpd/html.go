@@ -42,9 +42,10 @@ func (s *DhcpServer) writeDashboard(writer io.Writer) {
 	defer s.mutex.RUnlock()
 	fmt.Fprintln(writer, "<b>Interfaces</b><br>")
 	fmt.Fprintln(writer, `<table border="1">`)
-	tw, _ := html.NewTableWriter(writer, true, "Interface", "IPs")
+	tw, _ := html.NewTableWriter(writer, true, "Interface", "IPs", "IPv6s")
 	for interfaceName, IPs := range s.interfaceIPs {
-		tw.WriteRow("", "", interfaceName, fmt.Sprintf("%v", IPs))
+		tw.WriteRow("", "", interfaceName, fmt.Sprintf("%v", IPs),
+			fmt.Sprintf("%v", s.interfaceIPv6s[interfaceName]))
 	}
 	tw.Close()
 	fmt.Fprintln(writer, "<br>")
@@ -65,7 +66,7 @@ func (s *DhcpServer) writeDashboard(writer io.Writer) {
 	fmt.Fprintln(writer, "<b>Static leases</b><br>")
 	fmt.Fprintln(writer, `<table border="1">`)
 	tw, _ = html.NewTableWriter(writer, true,
-		"MAC", "IP", "Hostname", "SubnetID")
+		"MAC", "IP", "IPv6", "Hostname", "SubnetID")
 	staticLeases := make([]leaseType, 0, len(s.staticLeases))
 	for _, lease := range s.staticLeases {
 		staticLeases = append(staticLeases, lease)
@@ -75,8 +76,12 @@ func (s *DhcpServer) writeDashboard(writer io.Writer) {
 			staticLeases[j].Address.IpAddress.String())
 	})
 	for _, lease := range staticLeases {
+		var ipv6Address string
+		if len(lease.Ipv6Address) > 0 {
+			ipv6Address = lease.Ipv6Address.String()
+		}
 		tw.WriteRow("", "", lease.MacAddress, lease.IpAddress.String(),
-			lease.hostname, lease.subnet.Id)
+			ipv6Address, lease.hostname, lease.subnet.Id)
 	}
 	tw.Close()
 	fmt.Fprintln(writer, "<br>")
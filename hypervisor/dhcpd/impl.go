@@ -114,6 +114,11 @@ func newServer(interfaceNames []string, dynamicLeasesFile string,
 		dhcpServer.interfaceIPs = interfaceIPs
 		dhcpServer.myIPs = myIPs
 	}
+	if interfaceIPv6s, err := listMyIPv6s(); err != nil {
+		return nil, err
+	} else {
+		dhcpServer.interfaceIPv6s = interfaceIPv6s
+	}
 	routeTable, err := util.GetRouteTable()
 	if err != nil {
 		return nil, err
@@ -172,6 +177,12 @@ func newServer(interfaceNames []string, dynamicLeasesFile string,
 		}
 	}()
 	go dhcpServer.cleanupDynamicLeasesLoop(cleanupTriggerChannel)
+	if err := dhcpServer.startDhcp6(serveConn.ifIndices); err != nil {
+		logger.Printf("error starting DHCPv6 server: %s\n", err)
+	}
+	if err := dhcpServer.startRouterAdverts(serveConn.ifIndices); err != nil {
+		logger.Printf("error starting Router Advertisements: %s\n", err)
+	}
 	html.HandleFunc("/showDhcpStatus", dhcpServer.showDhcpStatusHandler)
 	return dhcpServer, nil
 }
@@ -266,13 +277,32 @@ func (s *DhcpServer) addSubnet(protoSubnet proto.Subnet) {
 			break
 		}
 	}
+	if len(protoSubnet.Ipv6Gateway) > 0 {
+		for name, ips := range s.interfaceIPv6s {
+			for _, ip := range ips {
+				if protoSubnet.Ipv6Gateway.Equal(ip) {
+					subnet.ipv6Interface = name
+					s.logger.Printf(
+						"attaching subnet IPv6 GW: %s to interface: %s\n",
+						ip, name)
+					break
+				}
+			}
+			if subnet.ipv6Interface != "" {
+				break
+			}
+		}
+	}
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	if ifaceName != "" {
 		s.interfaceSubnets[ifaceName] = append(s.interfaceSubnets[ifaceName],
 			subnet)
 	}
 	s.subnets = append(s.subnets, subnet)
+	s.mutex.Unlock()
+	if subnet.ipv6Interface != "" && s.routerAdvertConn != nil {
+		s.sendRouterAdverts(subnet.ipv6Interface)
+	}
 }
 
 func (s *DhcpServer) checkRouteOnInterface(addr net.IP,
@@ -710,7 +740,10 @@ func (s *DhcpServer) ServeDHCP(req dhcp.Packet, msgType dhcp.MessageType,
 				"did not request an IP, using: %s", reqIP.String()))
 		}
 		reqIP = util.ShrinkIP(reqIP)
-		s.notifyRequest(proto.Address{reqIP, macAddr})
+		s.notifyRequest(proto.Address{
+			IpAddress:  reqIP,
+			MacAddress: macAddr,
+		})
 		server, ok := options[dhcp.OptionServerIdentifier]
 		if ok {
 			serverIP := net.IP(server)
@@ -0,0 +1,235 @@
+package dhcpd
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	routerAdvertInterval = 200 * time.Second
+	routerLifetime       = 30 * time.Minute
+
+	raFlagManaged      = 0x80 // Addresses are available using DHCPv6.
+	raFlagOther        = 0x40 // Other configuration is available by DHCPv6.
+	raOptionSourceLL   = 1
+	raOptionPrefixInfo = 3
+	raOptionRdnss      = 25
+	raOptionDnssl      = 31
+	raPrefixOnLink     = 0x80
+	raPrefixAutonomous = 0x40 // SLAAC may be used.
+)
+
+var (
+	allNodesAddr   = net.ParseIP("ff02::1")
+	allRoutersAddr = net.ParseIP("ff02::2")
+)
+
+func listMyIPv6s() (map[string][]net.IP, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	ifMap := make(map[string][]net.IP)
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		if iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		interfaceAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range interfaceAddrs {
+			IP, _, err := net.ParseCIDR(addr.String())
+			if err != nil {
+				return nil, err
+			}
+			if IP.To4() != nil {
+				continue
+			}
+			ifMap[iface.Name] = append(ifMap[iface.Name], IP)
+		}
+	}
+	return ifMap, nil
+}
+
+// makeRouterAdvert makes the body of a Router Advertisement message which
+// advertises the prefixes and DNS configuration of the subnets.
+func makeRouterAdvert(subnets []*subnetType,
+	macAddr net.HardwareAddr) []byte {
+	lifetime := uint32(routerLifetime.Seconds())
+	body := make([]byte, 12)
+	body[0] = 64 // Current hop limit.
+	body[1] = raFlagManaged | raFlagOther
+	binary.BigEndian.PutUint16(body[2:4], uint16(lifetime))
+	// Leave the reachable time and retransmit timer unspecified.
+	if len(macAddr) == 6 {
+		body = append(body, raOptionSourceLL, 1)
+		body = append(body, macAddr...)
+	}
+	var dnsServers []net.IP
+	var domainNames []byte
+	seenDnsServers := make(map[string]struct{})
+	seenDomainNames := make(map[string]struct{})
+	for _, subnet := range subnets {
+		option := make([]byte, 32)
+		option[0] = raOptionPrefixInfo
+		option[1] = 4 // Length in units of 8 bytes.
+		option[2] = byte(subnet.Ipv6PrefixLength)
+		option[3] = raPrefixOnLink | raPrefixAutonomous
+		validTime := uint32(staticLeaseTime.Seconds())
+		binary.BigEndian.PutUint32(option[4:8], validTime)  // Valid.
+		binary.BigEndian.PutUint32(option[8:12], validTime) // Preferred.
+		copy(option[16:], subnet.Ipv6Prefix.To16())
+		body = append(body, option...)
+		for _, dnsServer := range subnet.DomainNameServers {
+			if dnsServer.To4() != nil {
+				continue
+			}
+			if _, ok := seenDnsServers[dnsServer.String()]; !ok {
+				seenDnsServers[dnsServer.String()] = struct{}{}
+				dnsServers = append(dnsServers, dnsServer)
+			}
+		}
+		if subnet.DomainName != "" {
+			if _, ok := seenDomainNames[subnet.DomainName]; !ok {
+				seenDomainNames[subnet.DomainName] = struct{}{}
+				domainNames = append(domainNames,
+					encodeDomainName(subnet.DomainName)...)
+			}
+		}
+	}
+	if len(dnsServers) > 0 {
+		option := make([]byte, 8, 8+16*len(dnsServers))
+		option[0] = raOptionRdnss
+		option[1] = byte(1 + 2*len(dnsServers))
+		binary.BigEndian.PutUint32(option[4:8], lifetime)
+		for _, dnsServer := range dnsServers {
+			option = append(option, dnsServer.To16()...)
+		}
+		body = append(body, option...)
+	}
+	if len(domainNames) > 0 {
+		length := (8 + len(domainNames) + 7) / 8
+		option := make([]byte, length*8)
+		option[0] = raOptionDnssl
+		option[1] = byte(length)
+		binary.BigEndian.PutUint32(option[4:8], lifetime)
+		copy(option[8:], domainNames)
+		body = append(body, option...)
+	}
+	return body
+}
+
+func (s *DhcpServer) receiveRouterSolicitations(conn *ipv6.PacketConn,
+	ifIndices map[int]string) {
+	buffer := make([]byte, 1500)
+	for {
+		_, cm, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			s.logger.Println(err)
+			return
+		}
+		if cm == nil {
+			continue
+		}
+		if interfaceName, ok := ifIndices[cm.IfIndex]; ok {
+			s.sendRouterAdverts(interfaceName)
+		}
+	}
+}
+
+func (s *DhcpServer) sendRouterAdvert(interfaceName string,
+	subnets []*subnetType) error {
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return err
+	}
+	msg := icmp.Message{
+		Type: ipv6.ICMPTypeRouterAdvertisement,
+		Body: &icmp.RawBody{
+			Data: makeRouterAdvert(subnets, iface.HardwareAddr),
+		},
+	}
+	// The kernel computes the checksum for ICMPv6.
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.routerAdvertConn.WriteTo(data,
+		&ipv6.ControlMessage{HopLimit: 255, IfIndex: iface.Index},
+		&net.IPAddr{IP: allNodesAddr, Zone: iface.Name})
+	return err
+}
+
+// sendRouterAdverts sends Router Advertisements for the subnets for which
+// this machine is the IPv6 gateway. If interfaceName is not empty, they are
+// only sent on that interface.
+func (s *DhcpServer) sendRouterAdverts(interfaceName string) {
+	interfaceSubnets := make(map[string][]*subnetType)
+	s.mutex.RLock()
+	for _, subnet := range s.subnets {
+		if subnet.ipv6Interface == "" {
+			continue
+		}
+		if interfaceName != "" && subnet.ipv6Interface != interfaceName {
+			continue
+		}
+		interfaceSubnets[subnet.ipv6Interface] = append(
+			interfaceSubnets[subnet.ipv6Interface], subnet)
+	}
+	s.mutex.RUnlock()
+	for name, subnets := range interfaceSubnets {
+		if err := s.sendRouterAdvert(name, subnets); err != nil {
+			s.logger.Printf("error sending router advert on: %s: %s\n",
+				name, err)
+		}
+	}
+}
+
+func (s *DhcpServer) sendRouterAdvertsLoop() {
+	for ; ; time.Sleep(routerAdvertInterval) {
+		s.sendRouterAdverts("")
+	}
+}
+
+func (s *DhcpServer) startRouterAdverts(ifIndices map[int]string) error {
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return err
+	}
+	pktConn := conn.IPv6PacketConn()
+	if err := pktConn.SetControlMessage(ipv6.FlagInterface, true); err != nil {
+		conn.Close()
+		return err
+	}
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeRouterSolicitation)
+	if err := pktConn.SetICMPFilter(&filter); err != nil {
+		conn.Close()
+		return err
+	}
+	for index, name := range ifIndices {
+		iface, err := net.InterfaceByIndex(index)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		err = pktConn.JoinGroup(iface, &net.IPAddr{IP: allRoutersAddr})
+		if err != nil {
+			s.logger.Printf("error joining all-routers group on: %s: %s\n",
+				name, err)
+		}
+	}
+	s.routerAdvertConn = pktConn
+	go s.receiveRouterSolicitations(pktConn, ifIndices)
+	go s.sendRouterAdvertsLoop()
+	return nil
+}
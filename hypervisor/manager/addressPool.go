@@ -163,6 +163,14 @@ func (m *Manager) getFreeAddress(ipAddr net.IP, subnetId string,
 					fmt.Errorf("address: %s not found in free pool", ipAddr)
 			}
 		}
+		address := m.addressPool.Free[foundPos]
+		if len(address.Ipv6Address) < 1 {
+			address.Ipv6Address, err = subnet.MakeIpv6Address(
+				address.MacAddress)
+			if err != nil {
+				return proto.Address{}, "", err
+			}
+		}
 		addressPool := addressPoolType{
 			Free:       make([]proto.Address, 0, len(m.addressPool.Free)-1),
 			Registered: m.addressPool.Registered,
@@ -176,7 +184,6 @@ func (m *Manager) getFreeAddress(ipAddr net.IP, subnetId string,
 		if err := m.writeAddressPoolWithLock(addressPool, false); err != nil {
 			return proto.Address{}, "", err
 		}
-		address := m.addressPool.Free[foundPos]
 		m.addressPool = addressPool
 		return address, subnet.Id, nil
 	}
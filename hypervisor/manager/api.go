@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"crypto/x509"
 	"io"
 	"net"
 	"net/http"
@@ -48,6 +49,7 @@ type Manager struct {
 	StartOptions
 	healthStatusMutex sync.RWMutex
 	healthStatus      string
+	imageBasesMutex   sync.Mutex // Serialise creating and deleting image bases.
 	lockWatcher       *lockwatcher.LockWatcher
 	memTotalInMiB     uint64
 	notifiersMutex    sync.Mutex
@@ -58,11 +60,17 @@ type Manager struct {
 	privateKeyPEM     []byte
 	publicKeyDER      []byte
 	publicKeyPEM      []byte
+	quotasMutex       sync.Mutex
+	ownerQuotas       proto.UpdateOwnerQuotasRequest
+	quotaReservations map[*quotaReservation]struct{}
+	vmUsage           map[string]vmUsageType // Key: IP address.
 	rootCookie        []byte
 	serialNumber      string
 	shuttingDown      bool
 	summaryMutex      sync.RWMutex
 	summary           *summaryData
+	vmStatsMutex      sync.Mutex
+	vmStats           map[string]*vmStatsType // Key: IP address.
 	volumeDirectories []string
 	volumeInfos       map[string]VolumeInfo // Key: volumeDirectory.
 	mutex             sync.RWMutex          // Lock everything below (those can change).
@@ -90,6 +98,7 @@ type StartOptions struct {
 	ObjectCacheBytes     uint64
 	ShowVgaConsole       bool
 	StateDir             string
+	TrustedImageSigners  *x509.CertPool // If nil, signatures are not checked.
 	Username             string
 	VlanIdToBridge       map[uint]string // Key: VLAN ID, value: bridge interface.
 	VolumeDirectories    []string
@@ -121,6 +130,7 @@ type vmInfoType struct {
 	hasHealthAgent             bool
 	identityProviderNotifier   chan<- time.Time
 	identityProviderTransport  *http.Transport
+	incomingMigration          bool
 	ipAddress                  string
 	logger                     log.DebugLogger
 	manager                    *Manager
@@ -128,6 +138,8 @@ type vmInfoType struct {
 	monitorSockname            string
 	blockMutations             bool
 	ownerUsers                 map[string]struct{}
+	qmpNextId                  uint64
+	qmpWaiters                 map[uint64]chan<- monitorMessageType
 	serialInput                io.Writer
 	serialOutput               chan<- byte
 	stoppedNotifier            chan<- struct{}
@@ -157,6 +169,10 @@ func (m *Manager) AddVmVolumes(ipAddr net.IP,
 	return m.addVmVolumes(ipAddr, authInfo, volumeSizes)
 }
 
+func (m *Manager) BackupVm(conn *srpc.Conn) error {
+	return m.backupVm(conn)
+}
+
 func (m *Manager) BecomePrimaryVmOwner(ipAddr net.IP,
 	authInfo *srpc.AuthInformation) error {
 	return m.becomePrimaryVmOwner(ipAddr, authInfo)
@@ -186,6 +202,11 @@ func (m *Manager) ChangeVmHostname(ipAddr net.IP,
 	return m.changeVmHostname(ipAddr, authInfo, hostname)
 }
 
+func (m *Manager) ChangeVmIoLimits(authInfo *srpc.AuthInformation,
+	request proto.ChangeVmIoLimitsRequest) error {
+	return m.changeVmIoLimits(authInfo, request)
+}
+
 func (m *Manager) ChangeVmMachineType(ipAddr net.IP,
 	authInfo *srpc.AuthInformation, machineType proto.MachineType) error {
 	return m.changeVmMachineType(ipAddr, authInfo, machineType)
@@ -391,6 +412,12 @@ func (m *Manager) GetVmInfos(request proto.GetVmInfosRequest) (
 	return m.getVmInfos(request)
 }
 
+// GetVmIpv4Address returns the primary IP address of the VM which owns the
+// specified IPv6 address.
+func (m *Manager) GetVmIpv4Address(ipAddr net.IP) (net.IP, error) {
+	return m.getVmIpv4Address(ipAddr)
+}
+
 func (m *Manager) GetVmLastPatchLog(ipAddr net.IP) (
 	io.ReadCloser, uint64, time.Time, error) {
 	return m.getVmLastPatchLog(ipAddr)
@@ -401,6 +428,11 @@ func (m *Manager) GetVmLockWatcher(ipAddr net.IP) (
 	return m.getVmLockWatcher(ipAddr)
 }
 
+func (m *Manager) GetVmStats(request proto.GetVmStatsRequest) (
+	[]proto.VmStats, error) {
+	return m.getVmStats(request)
+}
+
 func (m *Manager) GetVmUserData(ipAddr net.IP) (io.ReadCloser, error) {
 	rc, _, err := m.getVmFileReader(ipAddr,
 		&srpc.AuthInformation{HaveMethodAccess: true},
@@ -562,10 +594,19 @@ func (m *Manager) ScanVmRoot(ipAddr net.IP, authInfo *srpc.AuthInformation,
 	return m.scanVmRoot(ipAddr, authInfo, scanFilter)
 }
 
+func (m *Manager) SendVmLiveMigration(conn *srpc.Conn) error {
+	return m.sendVmLiveMigration(conn)
+}
+
 func (m *Manager) SetDisabledState(disable bool) error {
 	return m.setDisabledState(disable)
 }
 
+func (m *Manager) SetVmSnapshotPolicy(authInfo *srpc.AuthInformation,
+	request proto.SetVmSnapshotPolicyRequest) error {
+	return m.setVmSnapshotPolicy(authInfo, request)
+}
+
 func (m *Manager) ShutdownVMsAndExit() {
 	m.shutdownVMsAndExit()
 }
@@ -587,6 +628,11 @@ func (m *Manager) StopVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
 	return m.stopVm(ipAddr, authInfo, accessToken)
 }
 
+func (m *Manager) UpdateOwnerQuotas(
+	request proto.UpdateOwnerQuotasRequest) error {
+	return m.updateOwnerQuotas(request)
+}
+
 func (m *Manager) UpdateSubnets(request proto.UpdateSubnetsRequest) error {
 	return m.updateSubnets(request)
 }
@@ -0,0 +1,418 @@
+package manager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	objclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	backupCheckBatchSize   = 16
+	backupDefaultChunkSize = 4 << 20
+	backupMaxChunkSize     = 64 << 20
+	lastBackupFilename     = "last-backup"
+)
+
+type backupChunkWriter struct {
+	objChecker    objectserver.ObjectsChecker
+	objQ          backupObjectAdder
+	pending       []pendingBackupChunk
+	bytesUploaded uint64
+	numSkipped    uint64
+	numUploaded   uint64
+}
+
+type backupObjectAdder interface {
+	AddData(data []byte, hashVal hash.Hash) error
+}
+
+type backupObjectServer interface {
+	objectserver.ObjectGetter
+	objectserver.ObjectsChecker
+}
+
+type pendingBackupChunk struct {
+	data    []byte
+	hashVal hash.Hash
+}
+
+func hashData(data []byte) hash.Hash {
+	var hashVal hash.Hash
+	hasher := sha512.New()
+	hasher.Write(data)
+	copy(hashVal[:], hasher.Sum(nil))
+	return hashVal
+}
+
+func isZeroData(data []byte) bool {
+	for _, value := range data {
+		if value != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add queues compressed chunk data for upload. Chunks which the object server
+// already has are skipped.
+func (w *backupChunkWriter) add(data []byte, hashVal hash.Hash) error {
+	w.pending = append(w.pending, pendingBackupChunk{data, hashVal})
+	if len(w.pending) < backupCheckBatchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *backupChunkWriter) flush() error {
+	if len(w.pending) < 1 {
+		return nil
+	}
+	hashes := make([]hash.Hash, 0, len(w.pending))
+	for _, chunk := range w.pending {
+		hashes = append(hashes, chunk.hashVal)
+	}
+	sizes, err := w.objChecker.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	for index, chunk := range w.pending {
+		if sizes[index] > 0 {
+			w.numSkipped++
+			continue
+		}
+		if err := w.objQ.AddData(chunk.data, chunk.hashVal); err != nil {
+			return err
+		}
+		w.bytesUploaded += uint64(len(chunk.data))
+		w.numUploaded++
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// backupVolume writes the chunks of a volume which are not in the previous
+// backup. Chunks with the same uncompressed hash as a chunk in the previous
+// backup are not compressed or uploaded again.
+func backupVolume(filename string, size uint64, chunkSize uint64,
+	previousChunks map[hash.Hash]hash.Hash,
+	writer *backupChunkWriter) (proto.VmBackupVolume, error) {
+	volume := proto.VmBackupVolume{
+		Chunks: make([]*proto.VmBackupChunk, 0,
+			(size+chunkSize-1)/chunkSize),
+		Size: size,
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return volume, err
+	}
+	defer file.Close()
+	reader := io.LimitReader(file, int64(size))
+	buffer := make([]byte, chunkSize)
+	compressedBuffer := &bytes.Buffer{}
+	for offset := uint64(0); offset < size; offset += chunkSize {
+		nRead, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return volume, err
+		}
+		data := buffer[:nRead]
+		if isZeroData(data) {
+			volume.Chunks = append(volume.Chunks, nil)
+			continue
+		}
+		chunk := &proto.VmBackupChunk{Hash: hashData(data)}
+		volume.Chunks = append(volume.Chunks, chunk)
+		if compressedHash, ok := previousChunks[chunk.Hash]; ok {
+			chunk.CompressedHash = compressedHash
+			writer.numSkipped++
+			continue
+		}
+		compressedBuffer.Reset()
+		compressor, err := gzip.NewWriterLevel(compressedBuffer,
+			gzip.BestSpeed)
+		if err != nil {
+			return volume, err
+		}
+		if _, err := compressor.Write(data); err != nil {
+			return volume, err
+		}
+		if err := compressor.Close(); err != nil {
+			return volume, err
+		}
+		compressedData := make([]byte, compressedBuffer.Len())
+		copy(compressedData, compressedBuffer.Bytes())
+		chunk.CompressedHash = hashData(compressedData)
+		previousChunks[chunk.Hash] = chunk.CompressedHash
+		if err := writer.add(compressedData, chunk.CompressedHash); err != nil {
+			return volume, err
+		}
+	}
+	return volume, nil
+}
+
+// backupVolume writes the chunks of a volume. QCOW2 volumes (including
+// overlays on an image base) are first converted to a temporary RAW file, and
+// are recorded as RAW volumes in the manifest.
+func (m *Manager) backupVolume(volumeLocation proto.LocalVolume,
+	volume *proto.Volume, chunkSize uint64,
+	previousChunks map[hash.Hash]hash.Hash,
+	writer *backupChunkWriter) (proto.VmBackupVolume, error) {
+	if volume.Format == proto.VolumeFormatRaw {
+		return backupVolume(volumeLocation.Filename, volume.Size, chunkSize,
+			previousChunks, writer)
+	}
+	err := m.checkFreeSpaceForVolume(volumeLocation, nil, volume.Size)
+	if err != nil {
+		return proto.VmBackupVolume{}, err
+	}
+	filename, size, err := makeRawVolumeForBackup(volumeLocation.Filename)
+	if err != nil {
+		return proto.VmBackupVolume{}, err
+	}
+	defer os.Remove(filename)
+	volume.Format = proto.VolumeFormatRaw
+	volume.Size = size
+	return backupVolume(filename, size, chunkSize, previousChunks, writer)
+}
+
+// makeRawVolumeForBackup writes the guest view of a QCOW2 volume to a
+// temporary RAW file. The filename and size of the RAW file are returned. The
+// caller must remove the file.
+func makeRawVolumeForBackup(filename string) (string, uint64, error) {
+	rawFilename := filename + ".backup"
+	if err := flattenQcow2(filename, rawFilename); err != nil {
+		return "", 0, err
+	}
+	fi, err := os.Stat(rawFilename)
+	if err != nil {
+		os.Remove(rawFilename)
+		return "", 0, err
+	}
+	return rawFilename, uint64(fi.Size()), nil
+}
+
+// readPreviousBackup returns a table of chunk hashes to compressed chunk
+// hashes for the previous backup of the VM, if available. Chunks which are
+// missing from the object server are excluded, so that they are uploaded
+// again.
+func readPreviousBackup(dirname string,
+	objSrv backupObjectServer) (*hash.Hash, map[hash.Hash]hash.Hash) {
+	previousChunks := make(map[hash.Hash]hash.Hash)
+	text, err := os.ReadFile(filepath.Join(dirname, lastBackupFilename))
+	if err != nil {
+		return nil, previousChunks
+	}
+	var manifestHash hash.Hash
+	if err := manifestHash.UnmarshalText(bytes.TrimSpace(text)); err != nil {
+		return nil, previousChunks
+	}
+	_, reader, err := objSrv.GetObject(manifestHash)
+	if err != nil {
+		return nil, previousChunks
+	}
+	defer reader.Close()
+	var manifest proto.VmBackupManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, previousChunks
+	}
+	for _, volume := range manifest.Volumes {
+		for _, chunk := range volume.Chunks {
+			if chunk != nil {
+				previousChunks[chunk.Hash] = chunk.CompressedHash
+			}
+		}
+	}
+	if err := verifyPreviousChunks(previousChunks, objSrv); err != nil {
+		return nil, make(map[hash.Hash]hash.Hash)
+	}
+	return &manifestHash, previousChunks
+}
+
+// verifyPreviousChunks removes chunks which the object server does not have.
+func verifyPreviousChunks(previousChunks map[hash.Hash]hash.Hash,
+	objChecker objectserver.ObjectsChecker) error {
+	if len(previousChunks) < 1 {
+		return nil
+	}
+	hashes := make([]hash.Hash, 0, len(previousChunks))
+	for _, compressedHash := range previousChunks {
+		hashes = append(hashes, compressedHash)
+	}
+	sizes, err := objChecker.CheckObjects(hashes)
+	if err != nil {
+		return err
+	}
+	missing := make(map[hash.Hash]struct{})
+	for index, size := range sizes {
+		if size < 1 {
+			missing[hashes[index]] = struct{}{}
+		}
+	}
+	for chunkHash, compressedHash := range previousChunks {
+		if _, ok := missing[compressedHash]; ok {
+			delete(previousChunks, chunkHash)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) backupVm(conn *srpc.Conn) error {
+	var request proto.BackupVmRequest
+	if err := conn.Decode(&request); err != nil {
+		return err
+	}
+	manifestHash, err := m.backupVmWithProgress(request,
+		conn.GetAuthInformation(),
+		func(message string) error {
+			response := proto.BackupVmResponse{ProgressMessage: message}
+			if err := conn.Encode(response); err != nil {
+				return err
+			}
+			return conn.Flush()
+		})
+	if err != nil {
+		return conn.Encode(proto.BackupVmResponse{Error: err.Error()})
+	}
+	m.Logger.Printf("BackupVm(%s): backed up VM: %s to: %x\n",
+		conn.Username(), request.IpAddress, manifestHash)
+	return conn.Encode(proto.BackupVmResponse{
+		Final:        true,
+		ManifestHash: manifestHash,
+	})
+}
+
+func (m *Manager) backupVmWithProgress(request proto.BackupVmRequest,
+	authInfo *srpc.AuthInformation,
+	progress func(message string) error) (hash.Hash, error) {
+	var manifestHash hash.Hash
+	if request.ObjectServerAddress == "" {
+		return manifestHash, errors.New("no object server specified")
+	}
+	chunkSize := request.ChunkSize
+	if chunkSize < 1 {
+		chunkSize = backupDefaultChunkSize
+	} else if chunkSize > backupMaxChunkSize {
+		return manifestHash, fmt.Errorf("chunk size: %s exceeds maximum: %s",
+			format.FormatBytes(chunkSize),
+			format.FormatBytes(backupMaxChunkSize))
+	}
+	vm, err := m.getVmLockAndAuth(request.IpAddress, true, authInfo, nil)
+	if err != nil {
+		return manifestHash, err
+	}
+	vm.blockMutations = true
+	vmInfo := vm.VmInfo
+	volumeLocations := vm.VolumeLocations
+	vm.mutex.Unlock()
+	defer vm.allowMutationsAndUnlock(false)
+	if vmInfo.State != proto.StateStopped && !request.ForceIfNotStopped {
+		return manifestHash, errors.New("VM is not stopped")
+	}
+	// Copy the volumes so that the manifest may be changed.
+	vmInfo.Volumes = append([]proto.Volume(nil), vmInfo.Volumes...)
+	client, err := srpc.DialHTTP("tcp", request.ObjectServerAddress,
+		time.Second*15)
+	if err != nil {
+		return manifestHash, err
+	}
+	defer client.Close()
+	objClient := objclient.AttachObjectClient(client)
+	defer objClient.Close()
+	previousBackup, previousChunks := readPreviousBackup(vm.dirname,
+		objClient)
+	// The adder queue holds its connection open, so it needs its own client.
+	queueClient, err := srpc.DialHTTP("tcp", request.ObjectServerAddress,
+		time.Second*15)
+	if err != nil {
+		return manifestHash, err
+	}
+	defer queueClient.Close()
+	objQ, err := objclient.NewObjectAdderQueue(queueClient)
+	if err != nil {
+		return manifestHash, err
+	}
+	writer := &backupChunkWriter{objChecker: objClient, objQ: objQ}
+	manifest := proto.VmBackupManifest{
+		ChunkSize:      chunkSize,
+		CreatedOn:      time.Now(),
+		PreviousBackup: previousBackup,
+		VmInfo:         vmInfo,
+		Volumes:        make([]proto.VmBackupVolume, 0, len(vmInfo.Volumes)),
+	}
+	startTime := time.Now()
+	for index, volume := range vmInfo.Volumes {
+		err := progress(fmt.Sprintf("backing up volume: %d (%s)",
+			index, format.FormatBytes(volume.Size)))
+		if err != nil {
+			objQ.Close()
+			return manifestHash, err
+		}
+		backupVolume, err := m.backupVolume(volumeLocations[index],
+			&manifest.VmInfo.Volumes[index], chunkSize, previousChunks,
+			writer)
+		if err != nil {
+			objQ.Close()
+			return manifestHash, err
+		}
+		manifest.Volumes = append(manifest.Volumes, backupVolume)
+	}
+	userData, err := os.ReadFile(filepath.Join(vm.dirname, UserDataFile))
+	if err != nil && !os.IsNotExist(err) {
+		objQ.Close()
+		return manifestHash, err
+	}
+	if len(userData) > 0 {
+		userDataHash := hashData(userData)
+		if err := writer.add(userData, userDataHash); err != nil {
+			objQ.Close()
+			return manifestHash, err
+		}
+		manifest.UserData = &userDataHash
+		manifest.UserDataSize = uint64(len(userData))
+	}
+	if err := writer.flush(); err != nil {
+		objQ.Close()
+		return manifestHash, err
+	}
+	if err := objQ.Close(); err != nil {
+		return manifestHash, err
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return manifestHash, err
+	}
+	manifestHash, _, err = objClient.AddObject(bytes.NewReader(manifestData),
+		uint64(len(manifestData)), nil)
+	if err != nil {
+		return manifestHash, err
+	}
+	if text, err := manifestHash.MarshalText(); err != nil {
+		return manifestHash, err
+	} else {
+		text = append(text, '\n')
+		err := fsutil.CopyToFile(filepath.Join(vm.dirname, lastBackupFilename),
+			fsutil.PublicFilePerms, bytes.NewReader(text), uint64(len(text)))
+		if err != nil {
+			return manifestHash, err
+		}
+	}
+	err = progress(fmt.Sprintf(
+		"uploaded: %d chunks (%s), skipped: %d unchanged chunks in %s",
+		writer.numUploaded, format.FormatBytes(writer.bytesUploaded),
+		writer.numSkipped, format.Duration(time.Since(startTime))))
+	return manifestHash, err
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/memory"
+)
+
+const testChunkSize = 4096
+
+type testObjectAdder struct {
+	objSrv *memory.ObjectServer
+}
+
+func (adder *testObjectAdder) AddData(data []byte, hashVal hash.Hash) error {
+	_, _, err := adder.objSrv.AddObject(bytes.NewReader(data),
+		uint64(len(data)), &hashVal)
+	return err
+}
+
+func makeTestBackupWriter(objSrv *memory.ObjectServer) *backupChunkWriter {
+	return &backupChunkWriter{
+		objChecker: objSrv,
+		objQ:       &testObjectAdder{objSrv},
+	}
+}
+
+// writeTestVolume writes a volume with two identical chunks, a chunk of zeros
+// and a partial chunk.
+func writeTestVolume(t *testing.T, filename string) uint64 {
+	data := make([]byte, 3*testChunkSize+100)
+	for index := 0; index < testChunkSize; index++ {
+		data[index] = byte(index)
+		data[testChunkSize+index] = byte(index)
+	}
+	for index := 3 * testChunkSize; index < len(data); index++ {
+		data[index] = 1
+	}
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return uint64(len(data))
+}
+
+func TestBackupVolume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "root")
+	size := writeTestVolume(t, filename)
+	objSrv := memory.NewObjectServer()
+	writer := makeTestBackupWriter(objSrv)
+	previousChunks := make(map[hash.Hash]hash.Hash)
+	volume, err := backupVolume(filename, size, testChunkSize, previousChunks,
+		writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(volume.Chunks) != 4 {
+		t.Fatalf("number of chunks: %d", len(volume.Chunks))
+	}
+	if volume.Chunks[2] != nil {
+		t.Error("chunk of zeros stored")
+	}
+	if *volume.Chunks[0] != *volume.Chunks[1] {
+		t.Error("identical chunks differ")
+	}
+	if writer.numUploaded != 2 {
+		t.Errorf("uploaded: %d chunks, expected: 2", writer.numUploaded)
+	}
+	// A second backup of an unchanged volume uploads nothing.
+	writer = makeTestBackupWriter(objSrv)
+	if _, err := backupVolume(filename, size, testChunkSize, previousChunks,
+		writer); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if writer.numUploaded != 0 {
+		t.Errorf("uploaded: %d unchanged chunks", writer.numUploaded)
+	}
+}
+
+func TestBackupWriterSkipsExistingObjects(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	data := []byte("chunk")
+	hashVal := hashData(data)
+	if err := (&testObjectAdder{objSrv}).AddData(data, hashVal); err != nil {
+		t.Fatal(err)
+	}
+	writer := makeTestBackupWriter(objSrv)
+	if err := writer.add(data, hashVal); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if writer.numSkipped != 1 || writer.numUploaded != 0 {
+		t.Errorf("skipped: %d, uploaded: %d",
+			writer.numSkipped, writer.numUploaded)
+	}
+}
+
+func TestVerifyPreviousChunks(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	present := []byte("present")
+	presentHash := hashData(present)
+	if err := (&testObjectAdder{objSrv}).AddData(present,
+		presentHash); err != nil {
+		t.Fatal(err)
+	}
+	missingHash := hashData([]byte("missing"))
+	previousChunks := map[hash.Hash]hash.Hash{
+		hashData([]byte("a")): presentHash,
+		hashData([]byte("b")): missingHash,
+	}
+	if err := verifyPreviousChunks(previousChunks, objSrv); err != nil {
+		t.Fatal(err)
+	}
+	if len(previousChunks) != 1 {
+		t.Fatalf("previous chunks: %d, expected: 1", len(previousChunks))
+	}
+	for _, compressedHash := range previousChunks {
+		if compressedHash != presentHash {
+			t.Error("missing chunk not removed")
+		}
+	}
+}
+
+func TestMakeRawVolumeForBackup(t *testing.T) {
+	if _, err := exec.LookPath(*qemuImgCommand); err != nil {
+		t.Skipf("%s not available", *qemuImgCommand)
+	}
+	dirname := t.TempDir()
+	baseFilename := filepath.Join(dirname, "base")
+	size := writeTestVolume(t, baseFilename)
+	overlayFilename := filepath.Join(dirname, "root")
+	if err := createQcow2Overlay(overlayFilename, baseFilename); err != nil {
+		t.Fatal(err)
+	}
+	filename, rawSize, err := makeRawVolumeForBackup(overlayFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	if rawSize != size {
+		t.Errorf("RAW size: %d, expected: %d", rawSize, size)
+	}
+	expected, err := os.ReadFile(baseFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, expected) {
+		t.Error("RAW volume differs from overlay")
+	}
+}
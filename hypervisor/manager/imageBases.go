@@ -0,0 +1,452 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/backoffdelay"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem/util"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	libjson "github.com/Cloud-Foundations/Dominator/lib/json"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	objclient "github.com/Cloud-Foundations/Dominator/lib/objectserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/lib/wsyscall"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	imageBaseFilePerms   = 0400
+	imageBaseMinimumAge  = time.Hour
+	imageBasesCheckDelay = time.Hour
+	imageBasesDirname    = ".image-bases"
+)
+
+var (
+	qemuImgCommand = flag.String("qemuImgCommand", "qemu-img",
+		"QEMU disk image utility command")
+	qemuNbdCommand = flag.String("qemuNbdCommand", "qemu-nbd",
+		"QEMU Network Block Device utility command")
+
+	nbdMutex sync.Mutex
+)
+
+// imageBaseKey contains all the parameters which affect the contents of an
+// image base. VMs may only share a base if these are the same.
+type imageBaseKey struct {
+	ExtraKernelOptions string             `json:",omitempty"`
+	FirmwareType       proto.FirmwareType `json:",omitempty"`
+	ImageName          string
+	MinimumFreeBytes   uint64 `json:",omitempty"`
+	RoundupPower       uint64 `json:",omitempty"`
+}
+
+type qcow2InfoType struct {
+	BackingFilename string `json:"backing-filename"`
+	Format          string `json:"format"`
+	VirtualSize     uint64 `json:"virtual-size"`
+}
+
+// canSendBackingFile returns true if the RAW backing file for a layered volume
+// has the size of the volume, so that it may be sent in place of the volume
+// when the changes will be sent later.
+func canSendBackingFile(volume proto.LocalVolume, size uint64) bool {
+	if fi, err := os.Stat(volume.BackingFile); err != nil {
+		return false
+	} else {
+		return uint64(fi.Size()) == size
+	}
+}
+
+// checkLayeredRootRequest returns an error if the root volume for the VM
+// cannot be created as an overlay on a shared image base.
+func checkLayeredRootRequest(request proto.CreateVmRequest) error {
+	if len(request.OverlayDirectories) > 0 || len(request.OverlayFiles) > 0 {
+		return errors.New(
+			"cannot add overlay directories or files to QCOW2 root volume")
+	}
+	if len(request.Volumes) > 0 &&
+		request.Volumes[0].Type == proto.VolumeTypeMemory {
+		return errors.New("cannot create QCOW2 root volume in memory")
+	}
+	return nil
+}
+
+// createQcow2Overlay creates a QCOW2 file which stores only the changes made
+// on top of a RAW backing file.
+func createQcow2Overlay(filename, backingFile string) error {
+	cmd := exec.Command(*qemuImgCommand, "create", "-q", "-f", "qcow2",
+		"-F", "raw", "-b", backingFile, filename)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error creating overlay: %s: %s: %s",
+			filename, err, strings.TrimSpace(string(output)))
+	}
+	return os.Chmod(filename, fsutil.PrivateFilePerms)
+}
+
+// flattenQcow2 writes the guest view of a (possibly layered) QCOW2 file to a
+// RAW file. The source may be in use.
+func flattenQcow2(source, destination string) error {
+	cmd := exec.Command(*qemuImgCommand, "convert", "-U", "-f", "qcow2",
+		"-O", "raw", source, destination)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(destination)
+		return fmt.Errorf("error flattening: %s: %s: %s",
+			source, err, strings.TrimSpace(string(output)))
+	}
+	return os.Chmod(destination, fsutil.PrivateFilePerms)
+}
+
+// flattenQcow2InPlace replaces a layered QCOW2 file with a RAW file.
+func flattenQcow2InPlace(filename string) error {
+	tmpFilename := filename + ".flat"
+	if err := flattenQcow2(filename, tmpFilename); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return nil
+}
+
+// connectQcow2 connects a QCOW2 file to a free Network Block Device and waits
+// for the partition to appear. It returns the device name.
+func connectQcow2(filename, partition string,
+	timeout time.Duration) (string, error) {
+	nbdMutex.Lock()
+	defer nbdMutex.Unlock()
+	cmd := exec.Command("modprobe", "nbd", "max_part=16")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("error loading nbd module: %s: %s",
+			err, strings.TrimSpace(string(output)))
+	}
+	device, err := findFreeNbdDevice()
+	if err != nil {
+		return "", err
+	}
+	cmd = exec.Command(*qemuNbdCommand, "--connect="+device,
+		"--format=qcow2", filename)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("error connecting: %s to: %s: %s: %s",
+			filename, device, err, strings.TrimSpace(string(output)))
+	}
+	sleeper := backoffdelay.NewExponential(time.Millisecond,
+		100*time.Millisecond, 2)
+	for stopTime := time.Now().Add(timeout); ; sleeper.Sleep() {
+		if _, err := os.Stat(device + partition); err == nil {
+			return device, nil
+		}
+		if time.Until(stopTime) < 0 {
+			disconnectQcow2(device)
+			return "", fmt.Errorf("timed out waiting for partition: %s",
+				device+partition)
+		}
+	}
+}
+
+// disconnectQcow2 disconnects a Network Block Device.
+func disconnectQcow2(device string) error {
+	cmd := exec.Command(*qemuNbdCommand, "--disconnect", device)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error disconnecting: %s: %s: %s",
+			device, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// findFreeNbdDevice returns the name of a Network Block Device which is not
+// connected. The caller must hold nbdMutex.
+func findFreeNbdDevice() (string, error) {
+	names, err := fsutil.ReadDirnames(sysClassBlock, true)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasPrefix(name, "nbd") {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(sysClassBlock, name, "pid"))
+		if os.IsNotExist(err) {
+			return filepath.Join("/dev", name), nil
+		}
+	}
+	return "", errors.New("no free nbd device")
+}
+
+func getQcow2Info(filename string) (*qcow2InfoType, error) {
+	cmd := exec.Command(*qemuImgCommand, "info", "-U", "--output=json",
+		filename)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error getting info for: %s: %s", filename, err)
+	}
+	var info qcow2InfoType
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// imageBaseRootLabel returns the file-system label for a base. The label is
+// shared by all the VMs using the base, so it cannot contain a VM IP address.
+func imageBaseRootLabel(name string) string {
+	return "rootfs@" + name[:8] // 15 characters: below the limit of 16.
+}
+
+// relabelRootOverlay changes the label of the root file-system in a QCOW2
+// overlay, including the references in fstab and the GRUB configuration. The
+// changes are stored in the overlay, leaving the base unchanged.
+func relabelRootOverlay(filename, partition, oldLabel, newLabel string,
+	logger log.DebugLogger) error {
+	device, err := connectQcow2(filename, partition, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := disconnectQcow2(device); err != nil {
+			logger.Println(err)
+		}
+	}()
+	partitionDevice := device + partition
+	if err := e2setLabel(partitionDevice, newLabel); err != nil {
+		return fmt.Errorf("error setting label on: %s: %s",
+			partitionDevice, err)
+	}
+	rootDir, err := os.MkdirTemp(filepath.Dir(filename), "root")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(rootDir)
+	logger.Debugf(0, "mounting: %s onto: %s\n", partitionDevice, rootDir)
+	err = wsyscall.Mount(partitionDevice, rootDir, "ext4", 0, "")
+	if err != nil {
+		return err
+	}
+	err = replaceRootLabel(rootDir, oldLabel, newLabel)
+	if err2 := syscall.Unmount(rootDir, 0); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// replaceRootLabel replaces references to the root file-system label in the
+// files which boot and mount the root file-system.
+func replaceRootLabel(rootDir, oldLabel, newLabel string) error {
+	oldData := []byte("LABEL=" + oldLabel)
+	newData := []byte("LABEL=" + newLabel)
+	for _, pathname := range []string{
+		"etc/fstab",
+		"boot/grub/grub.cfg",
+		"boot/grub2/grub.cfg",
+	} {
+		pathname = filepath.Join(rootDir, pathname)
+		fi, err := os.Stat(pathname)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		data, err := os.ReadFile(pathname)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(data, oldData) {
+			continue
+		}
+		data = bytes.ReplaceAll(data, oldData, newData)
+		if err := os.WriteFile(pathname, data, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (key imageBaseKey) name() (string, error) {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// createVmRootOverlay creates the root volume for a VM as a QCOW2 overlay
+// on top of a shared, read-only base for the image, creating the base if
+// needed. The root file-system in the overlay is relabelled, so that VMs
+// sharing a base do not share a label. The VM volumes must have been set up.
+func (m *Manager) createVmRootOverlay(vm *vmInfoType, client *srpc.Client,
+	fs *filesystem.FileSystem, key imageBaseKey,
+	skipBootloader bool) error {
+	name, err := key.name()
+	if err != nil {
+		return err
+	}
+	rootLabel := imageBaseRootLabel(name)
+	baseFilename, err := m.getImageBase(
+		filepath.Dir(vm.VolumeLocations[0].DirectoryToCleanup), name,
+		rootLabel, client, fs, key)
+	if err != nil {
+		return err
+	}
+	if skipBootloader {
+		bootInfo, err := util.GetBootInfo(fs, rootLabel, "")
+		if err != nil {
+			return err
+		}
+		var objectsGetter objectserver.ObjectsGetter
+		if m.objectCache == nil {
+			objectClient := objclient.AttachObjectClient(client)
+			defer objectClient.Close()
+			objectsGetter = objectClient
+		} else {
+			objectsGetter = m.objectCache
+		}
+		err = extractKernel(vm.VolumeLocations[0], "", objectsGetter, fs,
+			bootInfo)
+		if err != nil {
+			return err
+		}
+	}
+	err = createQcow2Overlay(vm.VolumeLocations[0].Filename, baseFilename)
+	if err != nil {
+		return err
+	}
+	partition := "p1"
+	if key.FirmwareType == proto.FirmwareUEFI {
+		partition = "p2"
+	}
+	err = relabelRootOverlay(vm.VolumeLocations[0].Filename, partition,
+		rootLabel, vm.rootLabel(false), vm.logger)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(baseFilename)
+	if err != nil {
+		return err
+	}
+	vm.RootFileSystemLabel = "" // Default (per VM) label.
+	vm.VolumeLocations[0].BackingFile = baseFilename
+	vm.Volumes = []proto.Volume{{
+		Format: proto.VolumeFormatQCOW2,
+		Size:   uint64(fi.Size()),
+	}}
+	return nil
+}
+
+// garbageCollectImageBases deletes image bases which are not used by any VM.
+// Recently used bases are kept, as they may be about to be used.
+func (m *Manager) garbageCollectImageBases() {
+	m.imageBasesMutex.Lock()
+	defer m.imageBasesMutex.Unlock()
+	inUse := make(map[string]struct{})
+	m.mutex.RLock()
+	for _, vm := range m.vms {
+		vm.mutex.RLock()
+		for _, volume := range vm.VolumeLocations {
+			if volume.BackingFile != "" {
+				inUse[volume.BackingFile] = struct{}{}
+			}
+		}
+		vm.mutex.RUnlock()
+	}
+	m.mutex.RUnlock()
+	for _, volumeDirectory := range m.volumeDirectories {
+		dirname := filepath.Join(volumeDirectory, imageBasesDirname)
+		names, err := fsutil.ReadDirnames(dirname, true)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			if strings.HasSuffix(name, ".json") {
+				continue
+			}
+			filename := filepath.Join(dirname, name)
+			if _, ok := inUse[filename]; ok {
+				continue
+			}
+			if fi, err := os.Stat(filename); err != nil {
+				continue
+			} else if time.Since(fi.ModTime()) < imageBaseMinimumAge {
+				continue
+			}
+			if err := os.Remove(filename); err != nil {
+				m.Logger.Println(err)
+				continue
+			}
+			os.Remove(filename + ".json")
+			m.Logger.Printf("deleted unused image base: %s\n", filename)
+		}
+	}
+}
+
+// getImageBase returns the filename of the base for an image in the specified
+// volume directory, creating it if needed.
+func (m *Manager) getImageBase(volumeDirectory, name, rootLabel string,
+	client *srpc.Client, fs *filesystem.FileSystem,
+	key imageBaseKey) (string, error) {
+	m.imageBasesMutex.Lock()
+	defer m.imageBasesMutex.Unlock()
+	dirname := filepath.Join(volumeDirectory, imageBasesDirname)
+	filename := filepath.Join(dirname, name)
+	if _, err := os.Stat(filename); err == nil {
+		now := time.Now()
+		// Mark as recently used, to protect from garbage collection.
+		if err := os.Chtimes(filename, now, now); err != nil {
+			return "", err
+		}
+		return filename, nil
+	}
+	if err := os.MkdirAll(dirname, fsutil.DirPerms); err != nil {
+		return "", err
+	}
+	m.Logger.Printf("creating base for image: %s in: %s\n",
+		key.ImageName, dirname)
+	writeRawOptions := util.WriteRawOptions{
+		ExtraKernelOptions: key.ExtraKernelOptions,
+		InitialImageName:   key.ImageName,
+		MinimumFreeBytes:   key.MinimumFreeBytes,
+		RootLabel:          rootLabel,
+		RoundupPower:       key.RoundupPower,
+	}
+	tmpFilename := filename + ".tmp"
+	defer os.Remove(tmpFilename)
+	err := m.writeRaw(proto.LocalVolume{Filename: filename}, ".tmp", client,
+		fs, key.FirmwareType, writeRawOptions, false)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmpFilename, imageBaseFilePerms); err != nil {
+		return "", err
+	}
+	err = libjson.WriteToFile(filename+".json", fsutil.PublicFilePerms,
+		"    ", key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+func (m *Manager) loopGarbageCollectImageBases() {
+	for ; ; time.Sleep(imageBasesCheckDelay) {
+		m.garbageCollectImageBases()
+	}
+}
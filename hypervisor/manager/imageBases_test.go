@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestCanSendBackingFile(t *testing.T) {
+	dirname := t.TempDir()
+	volume := proto.LocalVolume{
+		BackingFile: filepath.Join(dirname, "base"),
+		Filename:    filepath.Join(dirname, "root"),
+	}
+	if canSendBackingFile(volume, 4096) {
+		t.Error("missing backing file can be sent")
+	}
+	err := os.WriteFile(volume.BackingFile, make([]byte, 4096), 0400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canSendBackingFile(volume, 4096) {
+		t.Error("backing file cannot be sent")
+	}
+	// A grown volume has data beyond the end of the backing file.
+	if canSendBackingFile(volume, 8192) {
+		t.Error("backing file can be sent for grown volume")
+	}
+}
+
+func TestReplaceRootLabel(t *testing.T) {
+	rootDir := t.TempDir()
+	files := map[string]string{
+		"etc/fstab": "LABEL=rootfs@12345678 / ext4 defaults 0 1\n" +
+			"LABEL=data /data ext4 defaults 0 2\n",
+		"boot/grub/grub.cfg": "linux /vmlinuz root=LABEL=rootfs@12345678 ro\n",
+		"etc/hostname":       "LABEL=rootfs@12345678\n",
+	}
+	for name, data := range files {
+		pathname := filepath.Join(rootDir, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pathname, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := replaceRootLabel(rootDir, "rootfs@12345678", "rootfs@0a000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"etc/fstab": "LABEL=rootfs@0a000001 / ext4 defaults 0 1\n" +
+			"LABEL=data /data ext4 defaults 0 2\n",
+		"boot/grub/grub.cfg": "linux /vmlinuz root=LABEL=rootfs@0a000001 ro\n",
+		"etc/hostname":       "LABEL=rootfs@12345678\n",
+	}
+	for name, data := range expected {
+		if got, err := os.ReadFile(filepath.Join(rootDir, name)); err != nil {
+			t.Fatal(err)
+		} else if string(got) != data {
+			t.Errorf("%s: %q, expected: %q", name, got, data)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package manager
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const minimumNetworkBurst = 16 << 10
+
+func getIoLimits(limits *proto.IoLimits) proto.IoLimits {
+	if limits == nil {
+		return proto.IoLimits{}
+	}
+	return *limits
+}
+
+// readTapName returns the network interface name from a fdinfo file for a tun
+// or tap file descriptor, else it returns an empty string.
+func readTapName(filename string) string {
+	file, err := os.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 &&
+			fields[0] == "iff:" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+func runTc(args ...string) error {
+	cmd := exec.Command("tc", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running tc %s: %s: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// setNetworkRateLimit applies a network rate limit to each tap device for a VM.
+func setNetworkRateLimit(tapNames []string, bytesPerSecond uint64) error {
+	for _, tapName := range tapNames {
+		if err := setTapRateLimit(tapName, bytesPerSecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTapRateLimit limits the traffic in each direction for a tap device. If
+// bytesPerSecond is zero, limits are removed. Traffic sent to the VM is shaped
+// and traffic sent by the VM is policed.
+func setTapRateLimit(tapName string, bytesPerSecond uint64) error {
+	if bytesPerSecond < 1 {
+		exec.Command("tc", "qdisc", "del", "dev", tapName, "root").Run()
+		exec.Command("tc", "qdisc", "del", "dev", tapName, "ingress").Run()
+		return nil
+	}
+	rate := fmt.Sprintf("%dbit", bytesPerSecond<<3)
+	burstBytes := bytesPerSecond / 10
+	if burstBytes < minimumNetworkBurst {
+		burstBytes = minimumNetworkBurst
+	}
+	burst := fmt.Sprintf("%d", burstBytes)
+	err := runTc("qdisc", "replace", "dev", tapName, "root", "tbf",
+		"rate", rate, "burst", burst, "latency", "50ms")
+	if err != nil {
+		return err
+	}
+	exec.Command("tc", "qdisc", "del", "dev", tapName, "ingress").Run()
+	if err := runTc("qdisc", "add", "dev", tapName, "ingress"); err != nil {
+		return err
+	}
+	return runTc("filter", "add", "dev", tapName, "parent", "ffff:",
+		"protocol", "all", "u32", "match", "u32", "0", "0",
+		"police", "rate", rate, "burst", burst, "drop", "flowid", ":1")
+}
+
+func (m *Manager) changeVmIoLimits(authInfo *srpc.AuthInformation,
+	request proto.ChangeVmIoLimitsRequest) error {
+	vm, err := m.getVmLockAndAuth(request.IpAddress, true, authInfo, nil)
+	if err != nil {
+		return err
+	}
+	if len(request.VolumeIoLimits) > len(vm.Volumes) {
+		vm.mutex.Unlock()
+		return fmt.Errorf("number of volume limits: %d > volumes: %d",
+			len(request.VolumeIoLimits), len(vm.Volumes))
+	}
+	var modifyProcess bool
+	switch vm.State {
+	case proto.StateStarting:
+		err = errors.New("VM is starting")
+	case proto.StateRunning, proto.StateDebugging:
+		modifyProcess = true
+	case proto.StateStopping:
+		err = errors.New("VM is stopping")
+	case proto.StateStopped, proto.StateFailedToStart, proto.StateMigrating,
+		proto.StateExporting, proto.StateCrashed:
+	case proto.StateDestroying:
+		err = errors.New("VM is already destroying")
+	default:
+		err = errors.New("unknown state: " + vm.State.String())
+	}
+	if err != nil {
+		vm.mutex.Unlock()
+		return err
+	}
+	// The QEMU monitor commands take the VM lock, so release it.
+	vm.blockMutations = true
+	vm.mutex.Unlock()
+	var haveLock bool
+	defer func() {
+		vm.allowMutationsAndUnlock(haveLock)
+	}()
+	volumeIoLimits := make([]proto.IoLimits, len(vm.Volumes))
+	copy(volumeIoLimits, request.VolumeIoLimits)
+	if modifyProcess {
+		nodeNames := vm.getVolumeNodeNames()
+		for index, limits := range volumeIoLimits {
+			if limits == getIoLimits(vm.Volumes[index].IoLimits) {
+				continue
+			}
+			err := vm.setVolumeIoLimits(index, nodeNames[index], limits)
+			if err != nil {
+				return err
+			}
+		}
+		if request.NetworkBytesPerSecond != vm.NetworkBytesPerSecond {
+			tapNames, err := vm.getTapDevices()
+			if err != nil {
+				return err
+			}
+			err = setNetworkRateLimit(tapNames, request.NetworkBytesPerSecond)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	vm.mutex.Lock()
+	haveLock = true
+	for index, limits := range volumeIoLimits {
+		if limits == (proto.IoLimits{}) {
+			vm.Volumes[index].IoLimits = nil
+		} else {
+			limits := limits
+			vm.Volumes[index].IoLimits = &limits
+		}
+	}
+	vm.NetworkBytesPerSecond = request.NetworkBytesPerSecond
+	vm.writeAndSendInfo()
+	return nil
+}
+
+// getTapDevices returns the names of the tap devices used by the running VM,
+// by looking for the tap file descriptors in the QEMU process.
+func (vm *vmInfoType) getTapDevices() ([]string, error) {
+	pid, err := vm.readPid()
+	if err != nil {
+		return nil, err
+	}
+	dirname := fmt.Sprintf("/proc/%d/fdinfo", pid)
+	file, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	names, err := file.Readdirnames(-1)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	var tapNames []string
+	for _, name := range names {
+		if tapName := readTapName(filepath.Join(dirname, name)); tapName != "" {
+			tapNames = append(tapNames, tapName)
+		}
+	}
+	return tapNames, nil
+}
+
+// setVolumeIoLimits changes the I/O limits for a volume of a running VM. The
+// throttle group for the volume is updated, which fails for a volume which was
+// started without limits.
+func (vm *vmInfoType) setVolumeIoLimits(index int, nodeName string,
+	limits proto.IoLimits) error {
+	switch vm.getVolumeInterface(index) {
+	case proto.VolumeInterfaceVirtIO, proto.VolumeInterfaceIDE:
+		return vm.qmpCommand("block_set_io_throttle", map[string]interface{}{
+			"device":  nodeName,
+			"group":   fmt.Sprintf("throttle%d", index),
+			"bps":     limits.BytesPerSecond,
+			"bps_rd":  0,
+			"bps_wr":  0,
+			"iops":    limits.OperationsPerSecond,
+			"iops_rd": 0,
+			"iops_wr": 0,
+		}, nil)
+	}
+	err := vm.qmpCommand("qom-set", map[string]interface{}{
+		"path":     fmt.Sprintf("/objects/throttle%d", index),
+		"property": "limits",
+		"value": map[string]uint64{
+			"bps-total":  limits.BytesPerSecond,
+			"iops-total": limits.OperationsPerSecond,
+		},
+	}, nil)
+	if err != nil {
+		// There is no throttle group if the VM was started without limits.
+		return fmt.Errorf(
+			"error changing limits for volume: %d (stop VM to add limits): %s",
+			index, err)
+	}
+	return nil
+}
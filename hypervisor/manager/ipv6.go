@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
+)
+
+// getVmIpv4Address returns the primary IP address of the VM which owns the
+// specified IPv6 address. Link-local addresses are matched using the MAC
+// address encoded in the interface identifier. An IPv4 address is returned
+// unchanged.
+func (m *Manager) getVmIpv4Address(ipAddr net.IP) (net.IP, error) {
+	if ip4 := ipAddr.To4(); ip4 != nil {
+		return ip4, nil
+	}
+	var macAddr string
+	if ipAddr.IsLinkLocalUnicast() {
+		if hwAddr := util.GetEui64MacAddress(ipAddr); hwAddr != nil {
+			macAddr = hwAddr.String()
+		}
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, vm := range m.vms {
+		if ipAddr.Equal(vm.Address.Ipv6Address) ||
+			(macAddr != "" && macAddr == vm.Address.MacAddress) {
+			return vm.Address.IpAddress, nil
+		}
+	}
+	return nil, fmt.Errorf("no VM with IPv6 address: %s", ipAddr)
+}
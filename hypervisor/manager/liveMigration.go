@@ -0,0 +1,550 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	hyperclient "github.com/Cloud-Foundations/Dominator/hypervisor/client"
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	defaultLiveConvergenceTimeout = 10 * time.Minute
+	defaultLiveMaxDowntime        = 300 * time.Millisecond
+	liveProgressInterval          = 5 * time.Second
+)
+
+// migrationSource is the VM on the source Hypervisor of a migration.
+type migrationSource interface {
+	destroyVm() error
+	prepareVmForMigration(enable bool) error
+	startVm() error
+}
+
+type hypervisorMigrationSource struct {
+	accessToken []byte
+	client      *srpc.Client
+	ipAddress   net.IP
+}
+
+type qmpBlockJobType struct {
+	Device string `json:"device"`
+	Len    uint64 `json:"len"`
+	Offset uint64 `json:"offset"`
+	Ready  bool   `json:"ready"`
+}
+
+type qmpMigrationRamType struct {
+	DirtyPagesRate uint64 `json:"dirty-pages-rate"`
+	Remaining      uint64 `json:"remaining"`
+	Total          uint64 `json:"total"`
+	Transferred    uint64 `json:"transferred"`
+}
+
+type qmpMigrationType struct {
+	ErrorDescription string               `json:"error-desc"`
+	Ram              *qmpMigrationRamType `json:"ram"`
+	Status           string               `json:"status"`
+}
+
+type qmpStatusType struct {
+	Running bool   `json:"running"`
+	Status  string `json:"status"`
+}
+
+// abandonMigration cleans up after an incoming migration which failed before
+// it was committed. Once a VM has been live migrated it is running here and
+// the source VM is stopped with stale volumes, so it must not be restarted:
+// keep is called to keep the VM here. Otherwise cleanup is called and the
+// source VM is restored.
+func abandonMigration(source migrationSource, liveMigrated bool,
+	restartSource bool, keep func() error, cleanup func(),
+	logger log.Logger) {
+	if liveMigrated {
+		logger.Println(
+			"migration failed after live migration, keeping VM on this Hypervisor")
+		if err := keep(); err != nil {
+			logger.Printf("error keeping live migrated VM: %s\n", err)
+		}
+		return
+	}
+	cleanup()
+	source.prepareVmForMigration(false)
+	if restartSource {
+		source.startVm()
+	}
+}
+
+func getFreePort(ipAddr string) (string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(ipAddr, "0"))
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), nil
+}
+
+// getLocalAddressTowards returns the local IP address which would be used to
+// reach the specified address. No packets are sent.
+func getLocalAddressTowards(address string) (string, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+func sendVmLiveMigrationMessage(conn *srpc.Conn, message string) error {
+	request := proto.SendVmLiveMigrationResponse{ProgressMessage: message}
+	if err := conn.Encode(request); err != nil {
+		return err
+	}
+	return conn.Flush()
+}
+
+// migrateVmLive will attempt to live migrate a running VM from the source
+// Hypervisor. Empty volumes must already have been created, since the volume
+// data are mirrored during the migration. It returns true if the VM is running
+// on this Hypervisor. If the live migration failed but the source VM is still
+// running, false and a nil error are returned so that the caller can fall back
+// to a cold migration.
+func (m *Manager) migrateVmLive(conn *srpc.Conn, hypervisor *srpc.Client,
+	vm *vmInfoType, request proto.MigrateVmRequest) (bool, error) {
+	var connErr error
+	sendMessage := func(message string) {
+		if connErr == nil {
+			connErr = sendVmMigrationMessage(conn, message)
+		}
+	}
+	migrated, err := m.migrateVmLiveAttempt(hypervisor, vm, request,
+		sendMessage)
+	if connErr != nil {
+		if migrated {
+			vm.logger.Printf("error sending live migration message: %s\n",
+				connErr)
+		} else {
+			vm.stopIncomingMigration()
+			return false, connErr
+		}
+	}
+	if migrated {
+		if err != nil {
+			vm.logger.Printf("error completing live migration: %s\n", err)
+		}
+		return true, nil
+	}
+	vm.logger.Printf("live migration failed: %s\n", err)
+	vm.stopIncomingMigration()
+	err = sendVmMigrationMessage(conn, fmt.Sprintf(
+		"live migration failed: %s, falling back to cold migration", err))
+	return false, err
+}
+
+func (m *Manager) migrateVmLiveAttempt(hypervisor *srpc.Client,
+	vm *vmInfoType, request proto.MigrateVmRequest,
+	sendMessage func(string)) (bool, error) {
+	localAddr, err := getLocalAddressTowards(request.SourceHypervisor)
+	if err != nil {
+		return false, err
+	}
+	migrationPort, err := getFreePort(localAddr)
+	if err != nil {
+		return false, err
+	}
+	nbdPort, err := getFreePort(localAddr)
+	if err != nil {
+		return false, err
+	}
+	sendMessage("starting VM for incoming live migration")
+	vm.incomingMigration = true
+	vm.State = proto.StateStarting
+	m.mutex.Lock()
+	m.vms[vm.ipAddress] = vm
+	m.mutex.Unlock()
+	if _, err := vm.startManaging(0, false, false); err != nil {
+		return false, err
+	}
+	err = vm.qmpCommand("nbd-server-start", map[string]interface{}{
+		"addr": map[string]interface{}{
+			"type": "inet",
+			"data": map[string]string{"host": localAddr, "port": nbdPort},
+		},
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	var volumeTargets []string
+	for _, nodeName := range vm.getVolumeNodeNames() {
+		err := vm.qmpCommand("nbd-server-add",
+			map[string]interface{}{"device": nodeName, "writable": true}, nil)
+		if err != nil {
+			return false, err
+		}
+		volumeTargets = append(volumeTargets,
+			fmt.Sprintf("nbd:%s:%s:exportname=%s", localAddr, nbdPort, nodeName))
+	}
+	migrationURI := "tcp:" + net.JoinHostPort(localAddr, migrationPort)
+	err = vm.qmpCommand("migrate-incoming",
+		map[string]string{"uri": migrationURI}, nil)
+	if err != nil {
+		return false, err
+	}
+	convergenceTimeout := request.LiveConvergenceTimeout
+	if convergenceTimeout <= 0 {
+		convergenceTimeout = defaultLiveConvergenceTimeout
+	}
+	maxDowntime := request.LiveMaxDowntime
+	if maxDowntime <= 0 {
+		maxDowntime = defaultLiveMaxDowntime
+	}
+	var committed bool
+	var commitErr error
+	err = hyperclient.SendVmLiveMigration(hypervisor,
+		proto.SendVmLiveMigrationRequest{
+			AccessToken:        request.AccessToken,
+			ConvergenceTimeout: convergenceTimeout,
+			IpAddress:          request.IpAddress,
+			MaxDowntime:        maxDowntime,
+			MigrationURI:       migrationURI,
+			VolumeTargets:      volumeTargets,
+		},
+		sendMessage,
+		func() bool {
+			if commitErr = vm.resumeIncomingMigration(); commitErr != nil {
+				return false
+			}
+			committed = true
+			return true
+		})
+	if committed {
+		sendMessage("live migration completed")
+		return true, err
+	}
+	if commitErr != nil {
+		return false, commitErr
+	}
+	return false, err
+}
+
+// resumeIncomingMigration waits for the incoming migration state to be loaded
+// and then lets the VM run.
+// discardLiveMigrationVolumes removes the empty volumes created for a live
+// migration and restores the volume formats, so that the volumes will be
+// copied as they are.
+func (vm *vmInfoType) discardLiveMigrationVolumes(
+	formats []proto.VolumeFormat) error {
+	for index, volume := range vm.VolumeLocations {
+		err := os.Remove(volume.Filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		vm.Volumes[index].Format = formats[index]
+	}
+	return nil
+}
+
+func (source *hypervisorMigrationSource) destroyVm() error {
+	return hyperclient.DestroyVm(source.client, source.ipAddress,
+		source.accessToken)
+}
+
+func (source *hypervisorMigrationSource) prepareVmForMigration(
+	enable bool) error {
+	return hyperclient.PrepareVmForMigration(source.client, source.ipAddress,
+		source.accessToken, enable)
+}
+
+func (source *hypervisorMigrationSource) startVm() error {
+	return hyperclient.StartVm(source.client, source.ipAddress,
+		source.accessToken)
+}
+
+func (vm *vmInfoType) resumeIncomingMigration() error {
+	stopTime := time.Now().Add(30 * time.Second)
+	for {
+		var status qmpStatusType
+		if err := vm.qmpCommand("query-status", nil, &status); err != nil {
+			return err
+		}
+		if status.Status == "paused" || status.Status == "prelaunch" {
+			break
+		}
+		if status.Status != "inmigrate" {
+			return fmt.Errorf("unexpected VM status: %s", status.Status)
+		}
+		if time.Now().After(stopTime) {
+			return errors.New("timed out waiting for incoming migration")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := vm.qmpCommand("nbd-server-stop", nil, nil); err != nil {
+		return err
+	}
+	if err := vm.qmpCommand("cont", nil, nil); err != nil {
+		return err
+	}
+	vm.mutex.Lock()
+	vm.incomingMigration = false
+	vm.mutex.Unlock()
+	return nil
+}
+
+// stopIncomingMigration kills the QEMU process waiting for an incoming
+// migration and forgets the VM, so that it can be started again.
+func (vm *vmInfoType) stopIncomingMigration() {
+	vm.mutex.Lock()
+	vm.incomingMigration = false
+	commandInput := vm.commandInput
+	var stoppedNotifier chan struct{}
+	if commandInput != nil {
+		stoppedNotifier = make(chan struct{}, 1)
+		vm.stoppedNotifier = stoppedNotifier
+		vm.setState(proto.StateStopping)
+		commandInput <- "quit"
+	} else {
+		vm.setState(proto.StateStopped)
+	}
+	vm.mutex.Unlock()
+	if stoppedNotifier != nil {
+		timer := time.NewTimer(time.Minute)
+		select {
+		case <-stoppedNotifier:
+			timer.Stop()
+		case <-timer.C:
+			vm.logger.Println("timed out stopping incoming migration")
+		}
+	}
+	vm.manager.mutex.Lock()
+	delete(vm.manager.vms, vm.ipAddress)
+	vm.manager.mutex.Unlock()
+}
+
+func (m *Manager) sendVmLiveMigration(conn *srpc.Conn) error {
+	var request proto.SendVmLiveMigrationRequest
+	if err := conn.Decode(&request); err != nil {
+		return err
+	}
+	authInfo := *conn.GetAuthInformation()
+	authInfo.HaveMethodAccess = false // Require VM ownership or token.
+	vm, err := m.getVmLockAndAuth(request.IpAddress, true, &authInfo,
+		request.AccessToken)
+	if err != nil {
+		return err
+	}
+	if vm.Uncommitted {
+		vm.mutex.Unlock()
+		return errors.New("VM is uncommitted")
+	}
+	if vm.State != proto.StateRunning {
+		vm.mutex.Unlock()
+		return errors.New("VM is not running")
+	}
+	if len(request.VolumeTargets) != len(vm.VolumeLocations) {
+		vm.mutex.Unlock()
+		return fmt.Errorf("number of volume targets: %d != volumes: %d",
+			len(request.VolumeTargets), len(vm.VolumeLocations))
+	}
+	vm.blockMutations = true
+	vm.mutex.Unlock()
+	defer vm.allowMutationsAndUnlock(false)
+	var jobIds []string
+	var paused, stopped bool
+	defer func() {
+		if !stopped {
+			vm.cancelLiveMigration(jobIds, paused)
+		}
+	}()
+	for index, nodeName := range vm.getVolumeNodeNames() {
+		jobId := "migrate-" + nodeName
+		err := vm.qmpCommand("drive-mirror", map[string]interface{}{
+			"device": nodeName,
+			"format": "raw", // The NBD export presents the guest view.
+			"job-id": jobId,
+			"mode":   "existing",
+			"sync":   "full", // The destination volumes start empty.
+			"target": request.VolumeTargets[index],
+		}, nil)
+		if err != nil {
+			return err
+		}
+		jobIds = append(jobIds, jobId)
+	}
+	stopTime := time.Now().Add(request.ConvergenceTimeout)
+	if err := vm.waitForMirrorJobs(conn, jobIds, stopTime); err != nil {
+		return err
+	}
+	err = vm.qmpCommand("migrate-set-capabilities", map[string]interface{}{
+		"capabilities": []map[string]interface{}{
+			{"capability": "auto-converge", "state": true},
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	err = vm.qmpCommand("migrate-set-parameters", map[string]interface{}{
+		"downtime-limit": request.MaxDowntime.Milliseconds(),
+	}, nil)
+	if err != nil {
+		return err
+	}
+	err = vm.qmpCommand("migrate",
+		map[string]string{"uri": request.MigrationURI}, nil)
+	if err != nil {
+		return err
+	}
+	if err := vm.waitForMigration(conn, stopTime); err != nil {
+		return err
+	}
+	paused = true
+	// The VM is paused, so the mirrors are in sync. Cancelling a ready mirror
+	// job completes it without pivoting to the target.
+	for _, jobId := range jobIds {
+		err := vm.qmpCommand("block-job-cancel",
+			map[string]string{"device": jobId}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	jobIds = nil
+	err = conn.Encode(proto.SendVmLiveMigrationResponse{RequestCommit: true})
+	if err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	var reply proto.SendVmLiveMigrationResponseResponse
+	if err := conn.Decode(&reply); err != nil {
+		return err
+	}
+	if !reply.Commit {
+		return errors.New("live migration abandoned by destination")
+	}
+	vm.stopAfterLiveMigration()
+	stopped = true
+	return nil
+}
+
+// cancelLiveMigration cancels any outgoing migration and mirror jobs and
+// resumes the VM if it was paused. Errors are logged.
+func (vm *vmInfoType) cancelLiveMigration(jobIds []string, paused bool) {
+	if err := vm.qmpCommand("migrate_cancel", nil, nil); err != nil {
+		vm.logger.Println(err)
+	}
+	for _, jobId := range jobIds {
+		err := vm.qmpCommand("block-job-cancel",
+			map[string]interface{}{"device": jobId, "force": true}, nil)
+		if err != nil {
+			vm.logger.Println(err)
+		}
+	}
+	if paused {
+		if err := vm.qmpCommand("cont", nil, nil); err != nil {
+			vm.logger.Println(err)
+		}
+	}
+}
+
+// stopAfterLiveMigration kills the (paused) QEMU process once the destination
+// has taken over the VM.
+func (vm *vmInfoType) stopAfterLiveMigration() {
+	vm.mutex.Lock()
+	if vm.commandInput == nil {
+		vm.setState(proto.StateStopped)
+		vm.mutex.Unlock()
+		return
+	}
+	stoppedNotifier := make(chan struct{}, 1)
+	vm.stoppedNotifier = stoppedNotifier
+	vm.setState(proto.StateStopping)
+	vm.commandInput <- "quit"
+	vm.mutex.Unlock()
+	<-stoppedNotifier
+	vm.logger.Println("stopped after live migration")
+}
+
+func (vm *vmInfoType) waitForMigration(conn *srpc.Conn,
+	stopTime time.Time) error {
+	var lastMessageTime time.Time
+	for {
+		var migration qmpMigrationType
+		if err := vm.qmpCommand("query-migrate", nil, &migration); err != nil {
+			return err
+		}
+		switch migration.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("migration %s: %s",
+				migration.Status, migration.ErrorDescription)
+		}
+		if time.Now().After(stopTime) {
+			return errors.New("memory migration did not converge")
+		}
+		if ram := migration.Ram; ram != nil &&
+			time.Since(lastMessageTime) >= liveProgressInterval {
+			err := sendVmLiveMigrationMessage(conn, fmt.Sprintf(
+				"memory: %s transferred, %s/%s remaining, %d dirty pages/s",
+				format.FormatBytes(ram.Transferred),
+				format.FormatBytes(ram.Remaining),
+				format.FormatBytes(ram.Total), ram.DirtyPagesRate))
+			if err != nil {
+				return err
+			}
+			lastMessageTime = time.Now()
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (vm *vmInfoType) waitForMirrorJobs(conn *srpc.Conn, jobIds []string,
+	stopTime time.Time) error {
+	var lastMessageTime time.Time
+	for {
+		var jobs []qmpBlockJobType
+		if err := vm.qmpCommand("query-block-jobs", nil, &jobs); err != nil {
+			return err
+		}
+		jobsMap := make(map[string]qmpBlockJobType, len(jobs))
+		for _, job := range jobs {
+			jobsMap[job.Device] = job
+		}
+		var copied, total uint64
+		numReady := 0
+		for _, jobId := range jobIds {
+			job, ok := jobsMap[jobId]
+			if !ok {
+				return fmt.Errorf("mirror job: %s failed", jobId)
+			}
+			copied += job.Offset
+			total += job.Len
+			if job.Ready {
+				numReady++
+			}
+		}
+		if numReady == len(jobIds) {
+			return nil
+		}
+		if time.Now().After(stopTime) {
+			return errors.New("volume mirroring did not converge")
+		}
+		if time.Since(lastMessageTime) >= liveProgressInterval {
+			err := sendVmLiveMigrationMessage(conn, fmt.Sprintf(
+				"volumes: %s/%s mirrored",
+				format.FormatBytes(copied), format.FormatBytes(total)))
+			if err != nil {
+				return err
+			}
+			lastMessageTime = time.Now()
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type testMigrationSource struct {
+	destroyed bool
+	prepared  []bool
+	started   bool
+}
+
+func (source *testMigrationSource) destroyVm() error {
+	source.destroyed = true
+	return nil
+}
+
+func (source *testMigrationSource) prepareVmForMigration(enable bool) error {
+	source.prepared = append(source.prepared, enable)
+	return nil
+}
+
+func (source *testMigrationSource) startVm() error {
+	source.started = true
+	return nil
+}
+
+func testAbandonMigration(t *testing.T, liveMigrated, restartSource bool,
+	keepErr error) (*testMigrationSource, bool, bool) {
+	source := &testMigrationSource{}
+	var cleanedUp, kept bool
+	abandonMigration(source, liveMigrated, restartSource,
+		func() error {
+			kept = true
+			return keepErr
+		},
+		func() { cleanedUp = true },
+		testlogger.New(t))
+	return source, kept, cleanedUp
+}
+
+func TestAbandonLiveMigration(t *testing.T) {
+	for _, keepErr := range []error{nil, errors.New("failed")} {
+		source, kept, cleanedUp := testAbandonMigration(t, true, true, keepErr)
+		if !kept {
+			t.Error("live migrated VM not kept")
+		}
+		if cleanedUp {
+			t.Error("live migrated VM cleaned up")
+		}
+		if source.started {
+			t.Error("stale source VM restarted")
+		}
+		if len(source.prepared) > 0 {
+			t.Error("source VM migration state changed")
+		}
+	}
+}
+
+func TestAbandonColdMigration(t *testing.T) {
+	for _, restartSource := range []bool{false, true} {
+		source, kept, cleanedUp := testAbandonMigration(t, false,
+			restartSource, nil)
+		if kept {
+			t.Error("VM kept")
+		}
+		if !cleanedUp {
+			t.Error("VM not cleaned up")
+		}
+		if len(source.prepared) != 1 || source.prepared[0] {
+			t.Errorf("source VM migration state changes: %v", source.prepared)
+		}
+		if source.started != restartSource {
+			t.Errorf("source VM started: %v, expected: %v",
+				source.started, restartSource)
+		}
+		if source.destroyed {
+			t.Error("source VM destroyed")
+		}
+	}
+}
+
+func TestDiscardLiveMigrationVolumes(t *testing.T) {
+	dirname := t.TempDir()
+	vm := &vmInfoType{
+		LocalVmInfo: proto.LocalVmInfo{
+			VmInfo: proto.VmInfo{
+				Volumes: []proto.Volume{
+					{Format: proto.VolumeFormatRaw, Size: 1 << 20},
+					{Format: proto.VolumeFormatRaw, Size: 1 << 20},
+				},
+			},
+			VolumeLocations: []proto.LocalVolume{
+				{Filename: filepath.Join(dirname, "root")},
+				{Filename: filepath.Join(dirname, "secondary-volume.0")},
+			},
+		},
+	}
+	// Only the first volume was created before the live migration failed.
+	err := os.WriteFile(vm.VolumeLocations[0].Filename, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formats := []proto.VolumeFormat{
+		proto.VolumeFormatQCOW2,
+		proto.VolumeFormatRaw,
+	}
+	if err := vm.discardLiveMigrationVolumes(formats); err != nil {
+		t.Fatal(err)
+	}
+	for index, volume := range vm.VolumeLocations {
+		if _, err := os.Stat(volume.Filename); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", volume.Filename)
+		}
+		if vm.Volumes[index].Format != formats[index] {
+			t.Errorf("volume %d format: %s, expected: %s",
+				index, vm.Volumes[index].Format, formats[index])
+		}
+	}
+}
@@ -3,11 +3,13 @@ package manager
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
@@ -19,7 +21,10 @@ type copyingReader struct {
 
 type monitorMessageType struct {
 	Data      json.RawMessage      `json:data",omitempty"`
+	Error     *qmpErrorType        `json:"error,omitempty"`
 	Event     string               `json:event",omitempty"`
+	Id        *uint64              `json:"id,omitempty"`
+	Return    json.RawMessage      `json:"return,omitempty"`
 	Timestamp monitorTimestampType `json:timestamp",omitempty"`
 }
 
@@ -28,6 +33,17 @@ type monitorTimestampType struct {
 	Seconds      int64 `json:seconds",omitempty"`
 }
 
+type qmpCommandType struct {
+	Arguments interface{} `json:"arguments,omitempty"`
+	Execute   string      `json:"execute"`
+	Id        uint64      `json:"id"`
+}
+
+type qmpErrorType struct {
+	Class       string `json:"class"`
+	Description string `json:"desc"`
+}
+
 type shutdownDataType struct {
 	Guest  bool   `json:guest",omitempty"`
 	Reason string `json:reason",omitempty"`
@@ -76,6 +92,10 @@ func (vm *vmInfoType) processMonitorResponses(monitorSock net.Conn,
 		} else {
 			lastDecodeFailed = false
 		}
+		if message.Id != nil {
+			vm.deliverQmpResponse(*message.Id, message)
+			continue
+		}
 		switch message.Event {
 		case "SHUTDOWN":
 			var shutdownData shutdownDataType
@@ -110,6 +130,10 @@ func (vm *vmInfoType) processMonitorResponses(monitorSock net.Conn,
 	close(vm.commandInput)
 	vm.commandInput = nil
 	vm.commandOutput = nil
+	for _, waiter := range vm.qmpWaiters {
+		close(waiter)
+	}
+	vm.qmpWaiters = nil
 	os.Remove(filepath.Join(vm.dirname, "pidfile"))
 	switch vm.State {
 	case proto.StateStarting:
@@ -167,3 +191,65 @@ func (vm *vmInfoType) processMonitorResponses(monitorSock net.Conn,
 		vm.logger.Println("unknown state: " + vm.State.String())
 	}
 }
+
+func (vm *vmInfoType) deliverQmpResponse(id uint64,
+	message monitorMessageType) {
+	vm.mutex.Lock()
+	defer vm.mutex.Unlock()
+	if waiter, ok := vm.qmpWaiters[id]; ok {
+		delete(vm.qmpWaiters, id)
+		waiter <- message
+		close(waiter)
+	}
+}
+
+// qmpCommand will send a QMP command with optional arguments to the monitor and
+// will wait for the response. If reply is not nil, the returned data are
+// decoded into it. The VM lock must not be held.
+func (vm *vmInfoType) qmpCommand(command string, arguments interface{},
+	reply interface{}) error {
+	responseChannel := make(chan monitorMessageType, 1)
+	vm.mutex.Lock()
+	if vm.commandInput == nil {
+		vm.mutex.Unlock()
+		return errors.New("no monitor connection for VM")
+	}
+	vm.qmpNextId++
+	id := vm.qmpNextId
+	data, err := json.Marshal(qmpCommandType{
+		Arguments: arguments,
+		Execute:   command,
+		Id:        id,
+	})
+	if err != nil {
+		vm.mutex.Unlock()
+		return err
+	}
+	if vm.qmpWaiters == nil {
+		vm.qmpWaiters = make(map[uint64]chan<- monitorMessageType)
+	}
+	vm.qmpWaiters[id] = responseChannel
+	vm.commandInput <- "\\" + string(data)
+	vm.mutex.Unlock()
+	timer := time.NewTimer(time.Minute)
+	select {
+	case message, ok := <-responseChannel:
+		timer.Stop()
+		if !ok {
+			return fmt.Errorf("monitor closed while waiting for: %s", command)
+		}
+		if message.Error != nil {
+			return fmt.Errorf("%s: %s: %s",
+				command, message.Error.Class, message.Error.Description)
+		}
+		if reply == nil || len(message.Return) < 1 {
+			return nil
+		}
+		return json.Unmarshal(message.Return, reply)
+	case <-timer.C:
+		vm.mutex.Lock()
+		delete(vm.qmpWaiters, id)
+		vm.mutex.Unlock()
+		return fmt.Errorf("timed out waiting for: %s", command)
+	}
+}
@@ -45,6 +45,68 @@ func getQemuCpuModelFlags() (map[string]struct{}, error) {
 	return modelFlags, nil
 }
 
+// getVolumeInterface returns the interface used to present the specified
+// volume to the VM.
+func (vm *vmInfoType) getVolumeInterface(index int) proto.VolumeInterface {
+	var volumeInterface proto.VolumeInterface
+	if index < len(vm.Volumes) {
+		volumeInterface = vm.Volumes[index].Interface
+	}
+	if vm.DisableVirtIO && volumeInterface == proto.VolumeInterfaceVirtIO {
+		volumeInterface = proto.VolumeInterfaceIDE
+	}
+	return volumeInterface
+}
+
+// getVolumeNodeNames returns the QEMU block device names for the volumes, in
+// the order of vm.VolumeLocations. Old-style -drive options do not specify an
+// ID so QEMU assigns one based on the interface type and unit number.
+// getBlockdevArgs returns the QEMU arguments for the block device for a
+// volume. A throttle layer is only added if there are limits, since it
+// slows I/O, so limits cannot be added later without a restart.
+func getBlockdevArgs(index int, filename string, format proto.VolumeFormat,
+	limits proto.IoLimits) []string {
+	if limits == (proto.IoLimits{}) {
+		return []string{
+			"-blockdev", fmt.Sprintf(
+				"driver=%s,node-name=blk%d,file.driver=file,file.filename=%s",
+				format, index, filename),
+		}
+	}
+	return []string{
+		"-object", fmt.Sprintf(
+			"throttle-group,id=throttle%d,x-bps-total=%d,x-iops-total=%d",
+			index, limits.BytesPerSecond, limits.OperationsPerSecond),
+		"-blockdev", fmt.Sprintf(
+			"driver=throttle,node-name=blk%d,throttle-group=throttle%d,"+
+				"file.driver=%s,file.file.driver=file,file.file.filename=%s",
+			index, index, format, filename),
+	}
+}
+
+func (vm *vmInfoType) getVolumeNodeNames() []string {
+	var numIDE, numVirtIO uint
+	idePerBus := uint(2)
+	if vm.MachineType == proto.MachineTypeQ35 {
+		idePerBus = 1 // AHCI: one unit per bus.
+	}
+	nodeNames := make([]string, 0, len(vm.VolumeLocations))
+	for index := range vm.VolumeLocations {
+		switch vm.getVolumeInterface(index) {
+		case proto.VolumeInterfaceVirtIO:
+			nodeNames = append(nodeNames, fmt.Sprintf("virtio%d", numVirtIO))
+			numVirtIO++
+		case proto.VolumeInterfaceIDE:
+			nodeNames = append(nodeNames, fmt.Sprintf("ide%d-hd%d",
+				numIDE/idePerBus, numIDE%idePerBus))
+			numIDE++
+		default:
+			nodeNames = append(nodeNames, fmt.Sprintf("blk%d", index))
+		}
+	}
+	return nodeNames
+}
+
 func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 	pidfile string, nCpus uint, netOptions []string,
 	tapFiles []*os.File) error {
@@ -128,29 +190,31 @@ func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 		}
 	}
 	for index, volume := range vm.VolumeLocations {
+		var ioLimits proto.IoLimits
 		var volumeFormat proto.VolumeFormat
-		var volumeInterface proto.VolumeInterface
 		if index < len(vm.Volumes) {
+			ioLimits = getIoLimits(vm.Volumes[index].IoLimits)
 			volumeFormat = vm.Volumes[index].Format
-			volumeInterface = vm.Volumes[index].Interface
-		}
-		if vm.DisableVirtIO && volumeInterface == proto.VolumeInterfaceVirtIO {
-			volumeInterface = proto.VolumeInterfaceIDE
 		}
+		volumeInterface := vm.getVolumeInterface(index)
 		// For the simple cases (VirtIO and IDE), use old-style flags to
 		// maintain compatibility with old versions of QEMU (like 2.0.0).
 		switch volumeInterface {
 		case proto.VolumeInterfaceVirtIO, proto.VolumeInterfaceIDE:
-			cmd.Args = append(cmd.Args,
-				"-drive", fmt.Sprintf(
-					"file=%s,format=%s,discard=off,if=%s",
-					volume.Filename, volumeFormat, volumeInterface))
+			driveOptions := fmt.Sprintf("file=%s,format=%s,discard=off,if=%s",
+				volume.Filename, volumeFormat, volumeInterface)
+			if ioLimits != (proto.IoLimits{}) {
+				driveOptions += fmt.Sprintf(
+					",throttling.group=throttle%d"+
+						",throttling.bps-total=%d,throttling.iops-total=%d",
+					index, ioLimits.BytesPerSecond,
+					ioLimits.OperationsPerSecond)
+			}
+			cmd.Args = append(cmd.Args, "-drive", driveOptions)
 			continue
 		}
-		cmd.Args = append(cmd.Args,
-			"-blockdev", fmt.Sprintf(
-				"driver=%s,node-name=blk%d,file.driver=file,file.filename=%s",
-				volumeFormat, index, volume.Filename))
+		cmd.Args = append(cmd.Args, getBlockdevArgs(index, volume.Filename,
+			volumeFormat, ioLimits)...)
 		switch volumeInterface {
 		case proto.VolumeInterfaceVirtIO:
 			cmd.Args = append(cmd.Args,
@@ -182,6 +246,10 @@ func (vm *vmInfoType) startQemuVm(enableNetboot, haveManagerLock bool,
 			"-watchdog-action", vm.WatchdogAction.String(),
 			"-device", vm.WatchdogModel.String())
 	}
+	if vm.incomingMigration {
+		// Stay paused after the incoming migration completes.
+		cmd.Args = append(cmd.Args, "-incoming", "defer", "-S")
+	}
 	os.Remove(filepath.Join(vm.dirname, "bootlog"))
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, "VM_HOSTNAME="+vm.Hostname)
@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestGetBlockdevArgs(t *testing.T) {
+	args := getBlockdevArgs(1, "/vm/root", proto.VolumeFormatRaw,
+		proto.IoLimits{})
+	if len(args) != 2 || args[0] != "-blockdev" {
+		t.Fatalf("unlimited volume args: %v", args)
+	}
+	if strings.Contains(args[1], "throttle") {
+		t.Errorf("throttle layer added for unlimited volume: %s", args[1])
+	}
+	if !strings.Contains(args[1], "node-name=blk1,") {
+		t.Errorf("missing node name: %s", args[1])
+	}
+	args = getBlockdevArgs(1, "/vm/root", proto.VolumeFormatRaw,
+		proto.IoLimits{BytesPerSecond: 1 << 20})
+	if len(args) != 4 || args[0] != "-object" || args[2] != "-blockdev" {
+		t.Fatalf("limited volume args: %v", args)
+	}
+	if !strings.Contains(args[1], "id=throttle1,x-bps-total=1048576,") {
+		t.Errorf("bad throttle group: %s", args[1])
+	}
+	if !strings.HasPrefix(args[3], "driver=throttle,node-name=blk1,") {
+		t.Errorf("missing throttle layer: %s", args[3])
+	}
+}
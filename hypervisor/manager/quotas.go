@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"fmt"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+type vmUsageType struct {
+	ownerGroups  []string
+	primaryOwner string
+	resources    proto.OwnerResources
+}
+
+func makeVmUsage(vm *proto.VmInfo) vmUsageType {
+	usage := vmUsageType{ownerGroups: vm.OwnerGroups}
+	if len(vm.OwnerUsers) > 0 {
+		usage.primaryOwner = vm.OwnerUsers[0]
+	}
+	usage.resources.AddVm(vm)
+	return usage
+}
+
+// quotaReservation records the resources for a VM change which has passed
+// the quota checks but is not yet reflected in the VM usage.
+type quotaReservation struct {
+	ipAddress string // Empty for a new VM.
+	usage     vmUsageType
+}
+
+// reserveQuota checks if changing the VM with the specified IP address to the
+// new VM information would exceed the quota of any of the owners and if not,
+// reserves the resources so that concurrent changes are checked against them.
+// An empty IP address is used for a new VM. The returned function releases
+// the reservation and must be called once the VM usage has been updated or
+// the change has failed. Only the quotas mutex is grabbed, so the VM lock may
+// be held.
+func (m *Manager) reserveQuota(ipAddress string,
+	newVm proto.VmInfo) (func(), error) {
+	newUsage := makeVmUsage(&newVm)
+	m.quotasMutex.Lock()
+	defer m.quotasMutex.Unlock()
+	if err := m.checkQuotaWithLock(ipAddress, newUsage); err != nil {
+		return nil, err
+	}
+	reservation := &quotaReservation{ipAddress: ipAddress, usage: newUsage}
+	if m.quotaReservations == nil {
+		m.quotaReservations = make(map[*quotaReservation]struct{})
+	}
+	m.quotaReservations[reservation] = struct{}{}
+	return func() {
+		m.quotasMutex.Lock()
+		defer m.quotasMutex.Unlock()
+		delete(m.quotaReservations, reservation)
+	}, nil
+}
+
+func (m *Manager) checkQuotaWithLock(ipAddress string,
+	newUsage vmUsageType) error {
+	if len(m.ownerQuotas.OwnerGroups) < 1 && len(m.ownerQuotas.OwnerUsers) < 1 {
+		return nil
+	}
+	oldUsage := m.vmUsage[ipAddress]
+	if quota, ok := m.ownerQuotas.OwnerUsers[newUsage.primaryOwner]; ok {
+		err := m.checkOwnerQuotaWithLock(quota, oldUsage, newUsage,
+			func(usage vmUsageType) bool {
+				return usage.primaryOwner == newUsage.primaryOwner
+			})
+		if err != nil {
+			return fmt.Errorf("quota for user: %s: %s",
+				newUsage.primaryOwner, err)
+		}
+	}
+	for _, group := range newUsage.ownerGroups {
+		quota, ok := m.ownerQuotas.OwnerGroups[group]
+		if !ok {
+			continue
+		}
+		err := m.checkOwnerQuotaWithLock(quota, oldUsage, newUsage,
+			func(usage vmUsageType) bool {
+				for _, ownerGroup := range usage.ownerGroups {
+					if ownerGroup == group {
+						return true
+					}
+				}
+				return false
+			})
+		if err != nil {
+			return fmt.Errorf("quota for group: %s: %s", group, err)
+		}
+	}
+	return nil
+}
+
+// checkOwnerQuotaWithLock checks a single quota. The owner selects the VMs
+// which are charged to the quota. Reserved changes are counted as if they had
+// been made.
+func (m *Manager) checkOwnerQuotaWithLock(quota proto.OwnerQuota,
+	oldUsage, newUsage vmUsageType, owner func(vmUsageType) bool) error {
+	total := quota.UsedElsewhere
+	for _, usage := range m.vmUsage {
+		if owner(usage) {
+			total.Add(usage.resources)
+		}
+	}
+	for reservation := range m.quotaReservations {
+		if reservation.ipAddress != "" {
+			if usage := m.vmUsage[reservation.ipAddress]; owner(usage) {
+				total.Subtract(usage.resources)
+			}
+		}
+		if owner(reservation.usage) {
+			total.Add(reservation.usage.resources)
+		}
+	}
+	previous := total
+	if owner(oldUsage) {
+		total.Subtract(oldUsage.resources)
+	}
+	total.Add(newUsage.resources)
+	return total.CheckLimit(quota.Limit, previous)
+}
+
+// updateOwnerQuotas replaces the quotas.
+func (m *Manager) updateOwnerQuotas(
+	request proto.UpdateOwnerQuotasRequest) error {
+	m.quotasMutex.Lock()
+	defer m.quotasMutex.Unlock()
+	m.ownerQuotas = request
+	return nil
+}
+
+// updateVmUsage records the resources used by a VM, for quota checks. A nil
+// VM means the VM has been removed.
+func (m *Manager) updateVmUsage(ipAddress string, vm *proto.VmInfo) {
+	m.quotasMutex.Lock()
+	defer m.quotasMutex.Unlock()
+	if vm == nil {
+		delete(m.vmUsage, ipAddress)
+	} else {
+		m.vmUsage[ipAddress] = makeVmUsage(vm)
+	}
+}
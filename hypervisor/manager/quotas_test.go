@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"testing"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func makeQuotaTestManager() *Manager {
+	return &Manager{
+		ownerQuotas: proto.UpdateOwnerQuotasRequest{
+			OwnerUsers: map[string]proto.OwnerQuota{
+				"alice": {Limit: proto.OwnerResources{MemoryInMiB: 1024}},
+			},
+		},
+		vmUsage: make(map[string]vmUsageType),
+	}
+}
+
+func makeQuotaTestVm(memoryInMiB uint64) proto.VmInfo {
+	return proto.VmInfo{MemoryInMiB: memoryInMiB, OwnerUsers: []string{"alice"}}
+}
+
+func TestReserveQuotaForNewVMs(t *testing.T) {
+	m := makeQuotaTestManager()
+	release, err := m.reserveQuota("", makeQuotaTestVm(768))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A concurrent creation must see the first reservation.
+	if _, err := m.reserveQuota("", makeQuotaTestVm(512)); err == nil {
+		t.Fatal("concurrent creation exceeded quota")
+	}
+	release()
+	if len(m.quotaReservations) > 0 {
+		t.Fatal("reservation not released")
+	}
+	release, err = m.reserveQuota("", makeQuotaTestVm(512))
+	if err != nil {
+		t.Fatalf("quota not available after release: %s", err)
+	}
+	release()
+}
+
+func TestReserveQuotaForVmChange(t *testing.T) {
+	m := makeQuotaTestManager()
+	vmInfo := makeQuotaTestVm(512)
+	m.updateVmUsage("10.0.0.1", &vmInfo)
+	// Growing the VM replaces its usage rather than adding to it.
+	release, err := m.reserveQuota("10.0.0.1", makeQuotaTestVm(768))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.reserveQuota("", makeQuotaTestVm(512)); err == nil {
+		t.Fatal("creation exceeded quota during VM change")
+	}
+	release()
+	release, err = m.reserveQuota("", makeQuotaTestVm(512))
+	if err != nil {
+		t.Fatalf("quota not available after release: %s", err)
+	}
+	release()
+	// Once the change is made, the VM usage is charged instead.
+	vmInfo.MemoryInMiB = 768
+	m.updateVmUsage("10.0.0.1", &vmInfo)
+	if _, err := m.reserveQuota("", makeQuotaTestVm(512)); err == nil {
+		t.Fatal("creation exceeded quota after VM change")
+	}
+}
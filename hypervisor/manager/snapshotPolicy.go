@@ -0,0 +1,199 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+const (
+	autoSnapshotPrefix          = "auto-"
+	autoSnapshotTimeFormat      = "20060102-150405"
+	minimumSnapshotInterval     = 10 * time.Minute
+	snapshotPolicyCheckInterval = time.Minute
+)
+
+func checkSnapshotPolicy(policy *proto.SnapshotPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.Interval < minimumSnapshotInterval {
+		return fmt.Errorf("snapshot interval: %s is less than minimum: %s",
+			policy.Interval, minimumSnapshotInterval)
+	}
+	if policy.NumToKeep < 1 {
+		return errors.New("must keep at least one snapshot")
+	}
+	return nil
+}
+
+// checkVmSupportsSnapshots returns an error if the VM cannot be snapshotted.
+func (vm *vmInfoType) checkVmSupportsSnapshots() error {
+	if vm.getActiveInitrdPath() != "" {
+		return errors.New("cannot snapshot root volume with separate initrd")
+	}
+	if vm.getActiveKernelPath() != "" {
+		return errors.New("cannot snapshot root volume with separate kernel")
+	}
+	return nil
+}
+
+// getAutoSnapshotNames returns the names of the snapshots taken according to
+// a snapshot policy, oldest first.
+func getAutoSnapshotNames(volume proto.Volume) []string {
+	var names []string
+	for name := range volume.Snapshots {
+		if _, ok := parseAutoSnapshotName(name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names) // The time format sorts chronologically.
+	return names
+}
+
+func makeAutoSnapshotName(snapshotTime time.Time) string {
+	return autoSnapshotPrefix + snapshotTime.UTC().Format(autoSnapshotTimeFormat)
+}
+
+func parseAutoSnapshotName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, autoSnapshotPrefix) {
+		return time.Time{}, false
+	}
+	snapshotTime, err := time.Parse(autoSnapshotTimeFormat,
+		name[len(autoSnapshotPrefix):])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return snapshotTime, true
+}
+
+// applySnapshotPolicy takes a snapshot of the VM if one is due according to
+// its snapshot policy and the volumes have changed since the last one, and
+// then discards the oldest snapshots beyond the number to keep. No locks
+// should be held.
+func (m *Manager) applySnapshotPolicy(vm *vmInfoType) error {
+	vm.mutex.RLock()
+	if vm.SnapshotPolicy == nil || len(vm.Volumes) < 1 {
+		vm.mutex.RUnlock()
+		return nil
+	}
+	if err := vm.checkVmSupportsSnapshots(); err != nil {
+		vm.mutex.RUnlock()
+		// The VM may have been given a separate kernel after the policy was
+		// set. Ignore the policy rather than failing every time.
+		vm.logger.Debugf(1, "ignoring snapshot policy: %s\n", err)
+		return nil
+	}
+	policy := *vm.SnapshotPolicy
+	ipAddr := net.ParseIP(vm.ipAddress)
+	names := getAutoSnapshotNames(vm.Volumes[0])
+	state := vm.State
+	volumeLocations := make([]proto.LocalVolume, len(vm.VolumeLocations))
+	copy(volumeLocations, vm.VolumeLocations)
+	vm.mutex.RUnlock()
+	authInfo := &srpc.AuthInformation{HaveMethodAccess: true}
+	var takeSnapshot bool
+	switch state {
+	case proto.StateStopped:
+		takeSnapshot = true
+	case proto.StateRunning:
+		takeSnapshot = policy.SnapshotRunning
+	}
+	if takeSnapshot && len(names) > 0 {
+		lastTime, _ := parseAutoSnapshotName(names[len(names)-1])
+		if time.Since(lastTime) < policy.Interval {
+			takeSnapshot = false
+		} else if !volumesChangedSince(volumeLocations, policy.RootOnly,
+			lastTime) {
+			// Another snapshot would be identical to the last one and would
+			// push an older, different snapshot out.
+			vm.logger.Debugf(1, "skipping snapshot of unchanged volumes\n")
+			takeSnapshot = false
+		}
+	}
+	if takeSnapshot {
+		name := makeAutoSnapshotName(time.Now())
+		vm.logger.Debugf(0, "taking scheduled snapshot: %s\n", name)
+		err := m.snapshotVm(ipAddr, authInfo, policy.SnapshotRunning,
+			policy.RootOnly, name)
+		if err != nil {
+			return fmt.Errorf("error taking snapshot: %s", err)
+		}
+		names = append(names, name)
+	}
+	for len(names) > int(policy.NumToKeep) {
+		vm.logger.Debugf(0, "discarding scheduled snapshot: %s\n", names[0])
+		if err := m.discardVmSnapshot(ipAddr, authInfo, names[0]); err != nil {
+			return fmt.Errorf("error discarding snapshot: %s", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// volumesChangedSince returns true if any of the volumes (only the root
+// volume if rootOnly is true) may have been modified since the specified time.
+func volumesChangedSince(volumes []proto.LocalVolume, rootOnly bool,
+	sinceTime time.Time) bool {
+	for index, volume := range volumes {
+		if index > 0 && rootOnly {
+			break
+		}
+		if fi, err := os.Stat(volume.Filename); err != nil {
+			return true
+		} else if !fi.ModTime().Before(sinceTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) checkSnapshotPolicies() {
+	m.mutex.RLock()
+	vms := make([]*vmInfoType, 0, len(m.vms))
+	for _, vm := range m.vms {
+		vms = append(vms, vm)
+	}
+	m.mutex.RUnlock()
+	for _, vm := range vms {
+		if err := m.applySnapshotPolicy(vm); err != nil {
+			vm.logger.Println(err)
+		}
+	}
+}
+
+func (m *Manager) loopCheckSnapshotPolicies() {
+	for ; ; time.Sleep(snapshotPolicyCheckInterval) {
+		m.checkSnapshotPolicies()
+	}
+}
+
+func (m *Manager) setVmSnapshotPolicy(authInfo *srpc.AuthInformation,
+	request proto.SetVmSnapshotPolicyRequest) error {
+	if err := checkSnapshotPolicy(request.SnapshotPolicy); err != nil {
+		return err
+	}
+	vm, err := m.getVmLockAndAuth(request.IpAddress, true, authInfo, nil)
+	if err != nil {
+		return err
+	}
+	defer vm.mutex.Unlock()
+	if request.SnapshotPolicy == nil {
+		vm.SnapshotPolicy = nil
+	} else {
+		if err := vm.checkVmSupportsSnapshots(); err != nil {
+			return err
+		}
+		policy := *request.SnapshotPolicy
+		vm.SnapshotPolicy = &policy
+	}
+	vm.writeAndSendInfo()
+	return nil
+}
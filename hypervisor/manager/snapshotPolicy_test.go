@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func TestVolumesChangedSince(t *testing.T) {
+	dirname := t.TempDir()
+	volumes := []proto.LocalVolume{
+		{Filename: filepath.Join(dirname, "root")},
+		{Filename: filepath.Join(dirname, "secondary-volume.0")},
+	}
+	snapshotTime := time.Now().Add(-time.Hour)
+	oldTime := snapshotTime.Add(-time.Hour)
+	for _, volume := range volumes {
+		if err := os.WriteFile(volume.Filename, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(volume.Filename, oldTime, oldTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if volumesChangedSince(volumes, false, snapshotTime) {
+		t.Error("unchanged volumes reported as changed")
+	}
+	// Modify the secondary volume after the snapshot.
+	if err := os.WriteFile(volumes[1].Filename, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !volumesChangedSince(volumes, false, snapshotTime) {
+		t.Error("changed secondary volume not detected")
+	}
+	if volumesChangedSince(volumes, true, snapshotTime) {
+		t.Error("secondary volume checked for root only policy")
+	}
+	if !volumesChangedSince([]proto.LocalVolume{{Filename: "missing"}}, false,
+		snapshotTime) {
+		t.Error("missing volume reported as unchanged")
+	}
+}
@@ -78,6 +78,7 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		numCPUs:       uint(runtime.NumCPU()),
 		serialNumber:  firmware.ReadSystemSerial(),
 		vms:           make(map[string]*vmInfoType),
+		vmUsage:       make(map[string]vmUsageType),
 		uuid:          uuid,
 	}
 	err = fsutil.CopyToFile(manager.GetRootCookiePath(),
@@ -144,6 +145,9 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		vmInfo.logger = prefixlogger.New(ipAddr+": ", manager.Logger)
 		vmInfo.metadataChannels = make(map[chan<- string]struct{})
 		manager.vms[ipAddr] = &vmInfo
+		if ipAddr != "0.0.0.0" {
+			manager.updateVmUsage(ipAddr, &vmInfo.VmInfo)
+		}
 		vmInfo.setupLockWatcher()
 		if err := vmInfo.loadIdentityRequestorCert(); err != nil {
 			vmInfo.logger.Printf(
@@ -220,6 +224,9 @@ func newManager(startOptions StartOptions) (*Manager, error) {
 		manager.writeAddressPoolWithLock(manager.addressPool, false)
 	}
 	go manager.loopCheckHealthStatus()
+	go manager.loopCheckSnapshotPolicies()
+	go manager.loopGarbageCollectImageBases()
+	go manager.loopSampleVmStats()
 	lockCheckInterval := startOptions.LockCheckInterval
 	if lockCheckInterval > time.Second {
 		// Leveraged for dashboard, so keep it fresh.
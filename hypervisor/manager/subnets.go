@@ -211,12 +211,18 @@ func (m *Manager) updateSubnets(request proto.UpdateSubnetsRequest) error {
 		if subnet.Id == "hypervisor" {
 			return fmt.Errorf("cannot add hypervisor subnet")
 		}
+		if err := subnet.CheckIpv6(); err != nil {
+			return fmt.Errorf("subnet: %s: %s", subnet.Id, err)
+		}
 		request.Add[index].Shrink()
 	}
 	for index, subnet := range request.Change {
 		if subnet.Id == "hypervisor" {
 			return fmt.Errorf("cannot change hypervisor subnet")
 		}
+		if err := subnet.CheckIpv6(); err != nil {
+			return fmt.Errorf("subnet: %s: %s", subnet.Id, err)
+		}
 		request.Change[index].Shrink()
 	}
 	for _, subnetId := range request.Delete {
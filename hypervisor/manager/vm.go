@@ -358,6 +358,15 @@ func (m *Manager) addVmVolumes(ipAddr net.IP, authInfo *srpc.AuthInformation,
 	for _, size := range volumeSizes {
 		volumes = append(volumes, proto.Volume{Size: size})
 	}
+	quotaVmInfo := vm.VmInfo
+	quotaVmInfo.Volumes = make([]proto.Volume, 0, len(vm.Volumes)+len(volumes))
+	quotaVmInfo.Volumes = append(quotaVmInfo.Volumes, vm.Volumes...)
+	quotaVmInfo.Volumes = append(quotaVmInfo.Volumes, volumes...)
+	releaseQuota, err := m.reserveQuota(vm.ipAddress, quotaVmInfo)
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	volumeDirectories, err := vm.manager.getVolumeDirectories(0, 0, volumes,
 		vm.SpreadVolumes, nil)
 	if err != nil {
@@ -432,6 +441,9 @@ func (m *Manager) allocateVm(req proto.CreateVmRequest,
 	if req.VirtualCPUs > 0 && req.VirtualCPUs < minimumCPUs {
 		return nil, fmt.Errorf("VirtualCPUs must be at least %d", minimumCPUs)
 	}
+	if err := checkSnapshotPolicy(req.SnapshotPolicy); err != nil {
+		return nil, err
+	}
 	if err := req.WatchdogAction.CheckValid(); err != nil {
 		return nil, err
 	}
@@ -497,31 +509,34 @@ func (m *Manager) allocateVm(req proto.CreateVmRequest,
 	vm := &vmInfoType{
 		LocalVmInfo: proto.LocalVmInfo{
 			VmInfo: proto.VmInfo{
-				Address:            address,
-				CreatedOn:          time.Now(),
-				ConsoleType:        req.ConsoleType,
-				CpuPriority:        req.CpuPriority,
-				DestroyOnPowerdown: req.DestroyOnPowerdown,
-				DestroyProtection:  req.DestroyProtection,
-				DisableVirtIO:      req.DisableVirtIO,
-				ExtraKernelOptions: req.ExtraKernelOptions,
-				FirmwareType:       req.FirmwareType,
-				Hostname:           req.Hostname,
-				ImageName:          req.ImageName,
-				ImageURL:           req.ImageURL,
-				MachineType:        req.MachineType,
-				MemoryInMiB:        req.MemoryInMiB,
-				MilliCPUs:          req.MilliCPUs,
-				OwnerGroups:        req.OwnerGroups,
-				SpreadVolumes:      req.SpreadVolumes,
-				SecondaryAddresses: secondaryAddresses,
-				SecondarySubnetIDs: req.SecondarySubnetIDs,
-				State:              proto.StateStarting,
-				SubnetId:           subnetId,
-				Tags:               req.Tags,
-				VirtualCPUs:        req.VirtualCPUs,
-				WatchdogAction:     req.WatchdogAction,
-				WatchdogModel:      req.WatchdogModel,
+				Address:               address,
+				CreatedOn:             time.Now(),
+				ConsoleType:           req.ConsoleType,
+				CpuPriority:           req.CpuPriority,
+				DestroyOnPowerdown:    req.DestroyOnPowerdown,
+				DestroyProtection:     req.DestroyProtection,
+				DisableVirtIO:         req.DisableVirtIO,
+				ExtraKernelOptions:    req.ExtraKernelOptions,
+				FirmwareType:          req.FirmwareType,
+				Flavour:               req.Flavour,
+				Hostname:              req.Hostname,
+				ImageName:             req.ImageName,
+				ImageURL:              req.ImageURL,
+				MachineType:           req.MachineType,
+				MemoryInMiB:           req.MemoryInMiB,
+				MilliCPUs:             req.MilliCPUs,
+				NetworkBytesPerSecond: req.NetworkBytesPerSecond,
+				OwnerGroups:           req.OwnerGroups,
+				SnapshotPolicy:        req.SnapshotPolicy,
+				SpreadVolumes:         req.SpreadVolumes,
+				SecondaryAddresses:    secondaryAddresses,
+				SecondarySubnetIDs:    req.SecondarySubnetIDs,
+				State:                 proto.StateStarting,
+				SubnetId:              subnetId,
+				Tags:                  req.Tags,
+				VirtualCPUs:           req.VirtualCPUs,
+				WatchdogAction:        req.WatchdogAction,
+				WatchdogModel:         req.WatchdogModel,
 			},
 		},
 		manager:          m,
@@ -766,6 +781,18 @@ func (m *Manager) changeVmSize(authInfo *srpc.AuthInformation,
 		return err
 	}
 	defer vm.mutex.Unlock()
+	quotaVmInfo := vm.VmInfo
+	if req.MemoryInMiB > 0 {
+		quotaVmInfo.MemoryInMiB = req.MemoryInMiB
+	}
+	if req.MilliCPUs > 0 {
+		quotaVmInfo.MilliCPUs = req.MilliCPUs
+	}
+	releaseQuota, err := m.reserveQuota(vm.ipAddress, quotaVmInfo)
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	changed := false
 	if req.MemoryInMiB > 0 {
 		if _changed, e := m.changeVmMemory(vm, req.MemoryInMiB); e != nil {
@@ -1156,6 +1183,13 @@ func (m *Manager) copyVm(conn *srpc.Conn, request proto.CopyVmRequest) error {
 	vmInfo := request.VmInfo
 	vmInfo.Uncommitted = false
 	vmInfo.Volumes = getInfoReply.VmInfo.Volumes
+	quotaVmInfo := vmInfo
+	quotaVmInfo.OwnerUsers = ownerUsers
+	releaseQuota, err := m.reserveQuota("", quotaVmInfo)
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	vm, err := m.allocateVm(proto.CreateVmRequest{VmInfo: vmInfo},
 		conn.GetAuthInformation())
 	if err != nil {
@@ -1190,7 +1224,8 @@ func (m *Manager) copyVm(conn *srpc.Conn, request proto.CopyVmRequest) error {
 	if err != nil {
 		return err
 	}
-	err = vm.migrateVmVolumes(hypervisor, request.IpAddress, accessToken, true)
+	err = vm.migrateVmVolumes(hypervisor, request.IpAddress, accessToken, true,
+		getInfoReply.VmInfo.State != proto.StateStopped)
 	if err != nil {
 		return err
 	}
@@ -1210,7 +1245,7 @@ func (m *Manager) copyVm(conn *srpc.Conn, request proto.CopyVmRequest) error {
 			return err
 		}
 		err = vm.migrateVmVolumes(hypervisor, request.IpAddress, accessToken,
-			false)
+			false, false)
 		if err != nil {
 			return err
 		}
@@ -1284,7 +1319,34 @@ func (m *Manager) createVm(conn *srpc.Conn) error {
 		}
 		return sendError(conn, errors.New("no authentication data"))
 	}
+	if request.PrimaryOwner != "" {
+		// Trusted services (such as the Fleet Manager) may create VMs on
+		// behalf of another user.
+		if !conn.GetAuthInformation().HaveMethodAccess {
+			if err := maybeDrainAll(conn, request); err != nil {
+				return err
+			}
+			return sendError(conn,
+				errors.New("no permission to specify primary owner"))
+		}
+		ownerUsers[0] = request.PrimaryOwner
+	}
 	ownerUsers = append(ownerUsers, request.OwnerUsers...)
+	// The size of the root volume is not yet known, so only the minimum free
+	// space is counted. The actual size is counted once the VM is created.
+	quotaVmInfo := request.VmInfo
+	quotaVmInfo.OwnerUsers = ownerUsers
+	quotaVmInfo.Volumes = append(
+		[]proto.Volume{{Size: request.MinimumFreeBytes}},
+		request.SecondaryVolumes...)
+	releaseQuota, err := m.reserveQuota("", quotaVmInfo)
+	if err != nil {
+		if err := maybeDrainAll(conn, request); err != nil {
+			return err
+		}
+		return sendError(conn, err)
+	}
+	defer releaseQuota()
 	var identityExpires time.Time
 	var identityName string
 	if len(request.IdentityCertificate) > 0 && len(request.IdentityKey) > 0 {
@@ -1332,14 +1394,21 @@ func (m *Manager) createVm(conn *srpc.Conn) error {
 		}
 		return sendError(conn, err)
 	}
+	var rootVolumeFormat proto.VolumeFormat
 	var rootVolumeType proto.VolumeType
 	if len(request.Volumes) > 0 {
+		rootVolumeFormat = request.Volumes[0].Format
 		rootVolumeType = request.Volumes[0].Type
 	}
 	if request.ImageName != "" {
 		if err := maybeDrainImage(conn, request.ImageDataSize); err != nil {
 			return err
 		}
+		if rootVolumeFormat == proto.VolumeFormatQCOW2 {
+			if err := checkLayeredRootRequest(request); err != nil {
+				return sendError(conn, err)
+			}
+		}
 		if err := sendUpdate(conn, "getting image"); err != nil {
 			return err
 		}
@@ -1358,27 +1427,45 @@ func (m *Manager) createVm(conn *srpc.Conn) error {
 		if err != nil {
 			return sendError(conn, err)
 		}
-		if err := sendUpdate(conn, "unpacking image: "+imageName); err != nil {
-			return err
-		}
-		writeRawOptions := util.WriteRawOptions{
-			ExtraKernelOptions: request.ExtraKernelOptions,
-			InitialImageName:   imageName,
-			MinimumFreeBytes:   request.MinimumFreeBytes,
-			OverlayDirectories: request.OverlayDirectories,
-			OverlayFiles:       request.OverlayFiles,
-			RootLabel:          vm.rootLabel(false),
-			RoundupPower:       request.RoundupPower,
-		}
-		err = m.writeRaw(vm.VolumeLocations[0], "", client, fs,
-			request.FirmwareType, writeRawOptions, request.SkipBootloader)
-		if err != nil {
-			return sendError(conn, err)
-		}
-		if fi, err := os.Stat(vm.VolumeLocations[0].Filename); err != nil {
-			return sendError(conn, err)
+		if rootVolumeFormat == proto.VolumeFormatQCOW2 {
+			err := sendUpdate(conn, "creating overlay on image: "+imageName)
+			if err != nil {
+				return err
+			}
+			err = m.createVmRootOverlay(vm, client, fs, imageBaseKey{
+				ExtraKernelOptions: request.ExtraKernelOptions,
+				FirmwareType:       request.FirmwareType,
+				ImageName:          imageName,
+				MinimumFreeBytes:   request.MinimumFreeBytes,
+				RoundupPower:       request.RoundupPower,
+			}, request.SkipBootloader)
+			if err != nil {
+				return sendError(conn, err)
+			}
 		} else {
-			vm.Volumes = []proto.Volume{{Size: uint64(fi.Size())}}
+			err := sendUpdate(conn, "unpacking image: "+imageName)
+			if err != nil {
+				return err
+			}
+			writeRawOptions := util.WriteRawOptions{
+				ExtraKernelOptions: request.ExtraKernelOptions,
+				InitialImageName:   imageName,
+				MinimumFreeBytes:   request.MinimumFreeBytes,
+				OverlayDirectories: request.OverlayDirectories,
+				OverlayFiles:       request.OverlayFiles,
+				RootLabel:          vm.rootLabel(false),
+				RoundupPower:       request.RoundupPower,
+			}
+			err = m.writeRaw(vm.VolumeLocations[0], "", client, fs,
+				request.FirmwareType, writeRawOptions, request.SkipBootloader)
+			if err != nil {
+				return sendError(conn, err)
+			}
+			if fi, err := os.Stat(vm.VolumeLocations[0].Filename); err != nil {
+				return sendError(conn, err)
+			} else {
+				vm.Volumes = []proto.Volume{{Size: uint64(fi.Size())}}
+			}
 		}
 	} else if request.ImageDataSize > 0 {
 		err := vm.copyRootVolume(request, conn, request.ImageDataSize,
@@ -1418,6 +1505,7 @@ func (m *Manager) createVm(conn *srpc.Conn) error {
 	}
 	if len(request.Volumes) > 0 {
 		vm.Volumes[0].Interface = request.Volumes[0].Interface
+		vm.Volumes[0].IoLimits = request.Volumes[0].IoLimits
 	}
 	vm.Volumes[0].Type = rootVolumeType
 	if request.UserDataSize > 0 {
@@ -1803,10 +1891,32 @@ func (m *Manager) exportLocalVm(authInfo *srpc.AuthInformation,
 	if err != nil {
 		return nil, err
 	}
-	defer vm.mutex.Unlock()
 	if vm.State != proto.StateStopped {
+		vm.mutex.Unlock()
 		return nil, errors.New("VM is not stopped")
 	}
+	// The importer will not have the shared image bases. Flattening may take
+	// a while, so do it without holding the lock.
+	vm.blockMutations = true
+	volumeLocations := append([]proto.LocalVolume(nil), vm.VolumeLocations...)
+	volumes := append([]proto.Volume(nil), vm.Volumes...)
+	vm.mutex.Unlock()
+	for index, volume := range volumeLocations {
+		if volume.BackingFile == "" {
+			continue
+		}
+		startTime := time.Now()
+		err := m.flattenVolumeFiles(volume, volumes[index].Size)
+		if err != nil {
+			vm.allowMutationsAndUnlock(false)
+			return nil, err
+		}
+		vm.mutex.Lock()
+		vm.setVolumeFlattened(index, startTime)
+		vm.mutex.Unlock()
+	}
+	vm.mutex.Lock()
+	defer vm.allowMutationsAndUnlock(true)
 	bridges, _, err := vm.getBridgesAndOptions(false)
 	if err != nil {
 		return nil, err
@@ -1849,6 +1959,9 @@ func (m *Manager) getImage(searchName string, imageTimeout time.Duration) (
 			return nil, nil, "", err
 		}
 		img.FileSystem.RebuildInodePointers()
+		if err := m.verifyImageSignature(img, imageName); err != nil {
+			return nil, nil, "", err
+		}
 		doClose = false
 		return client, img, imageName, nil
 	}
@@ -1862,6 +1975,9 @@ func (m *Manager) getImage(searchName string, imageTimeout time.Duration) (
 	if err := img.FileSystem.RebuildInodePointers(); err != nil {
 		return nil, nil, "", err
 	}
+	if err := m.verifyImageSignature(img, searchName); err != nil {
+		return nil, nil, "", err
+	}
 	doClose = false
 	return client, img, searchName, nil
 }
@@ -2096,6 +2212,7 @@ func (m *Manager) getVmVolume(conn *srpc.Conn) error {
 		return conn.Encode(proto.GetVmVolumeResponse{Error: err.Error()})
 	}
 	vm.blockMutations = true
+	vmIsStopped := vm.State == proto.StateStopped
 	vm.mutex.Unlock()
 	defer vm.allowMutationsAndUnlock(false)
 	var initrd, kernel []byte
@@ -2137,7 +2254,35 @@ func (m *Manager) getVmVolume(conn *srpc.Conn) error {
 		return conn.Encode(proto.GetVmVolumeResponse{
 			Error: "index too large"})
 	}
-	file, err := os.Open(vm.VolumeLocations[request.VolumeIndex].Filename)
+	if request.ExtraFilesOnly {
+		return conn.Encode(response)
+	}
+	volume := vm.VolumeLocations[request.VolumeIndex]
+	filename := volume.Filename
+	if volume.BackingFile != "" {
+		// Send the guest view of layered volumes, since the receiver will not
+		// have the backing file. The initial copy of a running VM is updated
+		// after the VM is stopped, so send the base to avoid flattening twice.
+		size := vm.Volumes[request.VolumeIndex].Size
+		if request.InitialCopy && !vmIsStopped &&
+			canSendBackingFile(volume, size) {
+			filename = volume.BackingFile
+		} else {
+			err := m.checkFreeSpaceForVolume(volume, nil, size)
+			if err != nil {
+				return conn.Encode(
+					proto.GetVmVolumeResponse{Error: err.Error()})
+			}
+			filename += ".flat"
+			if err := flattenQcow2(volume.Filename, filename); err != nil {
+				return conn.Encode(
+					proto.GetVmVolumeResponse{Error: err.Error()})
+			}
+			defer os.Remove(filename)
+		}
+		response.Flattened = true
+	}
+	file, err := os.Open(filename)
 	if err != nil {
 		return conn.Encode(proto.GetVmVolumeResponse{Error: err.Error()})
 	}
@@ -2313,7 +2458,9 @@ func (m *Manager) importLocalVm(authInfo *srpc.AuthInformation,
 			return err
 		}
 		vm.VolumeLocations = append(vm.VolumeLocations, proto.LocalVolume{
-			dirname, destFilename})
+			DirectoryToCleanup: dirname,
+			Filename:           destFilename,
+		})
 	}
 	m.vms[ipAddress] = vm
 	if _, err := vm.startManaging(0, false, true); err != nil {
@@ -2446,13 +2593,20 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 		metadataChannels: make(map[chan<- string]struct{}),
 	}
 	vm.Uncommitted = true
+	source := &hypervisorMigrationSource{
+		accessToken: accessToken,
+		client:      hypervisor,
+		ipAddress:   request.IpAddress,
+	}
+	var liveMigrated bool
 	defer func() { // Evaluate vm at return time, not defer time.
-		vm.cleanup()
-		hyperclient.PrepareVmForMigration(hypervisor, request.IpAddress,
-			accessToken, false)
-		if vmInfo.State == proto.StateRunning {
-			hyperclient.StartVm(hypervisor, request.IpAddress, accessToken)
+		if vm == nil {
+			return
 		}
+		abandonMigration(source, liveMigrated,
+			vmInfo.State == proto.StateRunning,
+			func() error { return m.commitMigratedVm(vm, source, true) },
+			vm.cleanup, vm.logger)
 	}()
 	vm.ownerUsers = stringutil.ConvertListToMap(vm.OwnerUsers, false)
 	if err := os.MkdirAll(vm.dirname, fsutil.DirPerms); err != nil {
@@ -2475,17 +2629,56 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 			return err
 		}
 	}
-	// Begin copying over the volumes.
-	err = sendVmMigrationMessage(conn, "initial volume(s) copy")
-	if err != nil {
-		return err
-	}
-	err = vm.migrateVmVolumes(hypervisor, vm.Address.IpAddress, accessToken,
-		true)
-	if err != nil {
-		return err
+	if request.Live && vmInfo.State == proto.StateRunning {
+		// The volumes are mirrored during the live migration, so only create
+		// empty volumes rather than copying the data twice.
+		formats := make([]proto.VolumeFormat, 0, len(vm.Volumes))
+		for _, volume := range vm.Volumes {
+			formats = append(formats, volume.Format)
+		}
+		err := vm.createVolumesForLiveMigration(hypervisor, accessToken)
+		if err != nil {
+			return err
+		}
+		liveMigrated, err = m.migrateVmLive(conn, hypervisor, vm, request)
+		if err != nil {
+			return err
+		}
+		if !liveMigrated {
+			// Fall back to a cold migration. Discard the empty volumes so
+			// that the initial copy is done while the source VM is running.
+			if err := vm.discardLiveMigrationVolumes(formats); err != nil {
+				return err
+			}
+			err = sendVmMigrationMessage(conn, "initial volume(s) copy")
+			if err != nil {
+				return err
+			}
+			err = vm.migrateVmVolumes(hypervisor, vm.Address.IpAddress,
+				accessToken, false, true)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		// Begin copying over the volumes.
+		err = sendVmMigrationMessage(conn, "initial volume(s) copy")
+		if err != nil {
+			return err
+		}
+		err = vm.migrateVmVolumes(hypervisor, vm.Address.IpAddress,
+			accessToken, true, vmInfo.State != proto.StateStopped)
+		if err != nil {
+			return err
+		}
 	}
-	if vmInfo.State != proto.StateStopped {
+	if liveMigrated {
+		err := hyperclient.PrepareVmForMigration(hypervisor, request.IpAddress,
+			request.AccessToken, true)
+		if err != nil {
+			return err
+		}
+	} else if vmInfo.State != proto.StateStopped {
 		err = sendVmMigrationMessage(conn, "stopping VM")
 		if err != nil {
 			return err
@@ -2505,7 +2698,7 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 			return err
 		}
 		err = vm.migrateVmVolumes(hypervisor, vm.Address.IpAddress, accessToken,
-			false)
+			false, false)
 		if err != nil {
 			return err
 		}
@@ -2516,19 +2709,22 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 	if err != nil {
 		return err
 	}
-	if err := sendVmMigrationMessage(conn, "starting VM"); err != nil {
-		return err
-	}
-	vm.State = proto.StateStarting
-	m.mutex.Lock()
-	m.vms[ipAddress] = vm
-	m.mutex.Unlock()
-	dhcpTimedOut, err := vm.startManaging(request.DhcpTimeout, false, false)
-	if err != nil {
-		return err
-	}
-	if dhcpTimedOut {
-		return fmt.Errorf("DHCP timed out")
+	if !liveMigrated {
+		if err := sendVmMigrationMessage(conn, "starting VM"); err != nil {
+			return err
+		}
+		vm.State = proto.StateStarting
+		m.mutex.Lock()
+		m.vms[ipAddress] = vm
+		m.mutex.Unlock()
+		dhcpTimedOut, err := vm.startManaging(request.DhcpTimeout, false,
+			false)
+		if err != nil {
+			return err
+		}
+		if dhcpTimedOut {
+			return fmt.Errorf("DHCP timed out")
+		}
 	}
 	err = conn.Encode(proto.MigrateVmResponse{RequestCommit: true})
 	if err != nil {
@@ -2542,25 +2738,41 @@ func (m *Manager) migrateVm(conn *srpc.Conn) error {
 		return err
 	}
 	if !reply.Commit {
+		if liveMigrated {
+			return errors.New(
+				"VM migration abandoned after live migration: keeping VM")
+		}
 		return fmt.Errorf("VM migration abandoned")
 	}
-	if err := m.registerAddress(vm.Address); err != nil {
+	if err := m.commitMigratedVm(vm, source, false); err != nil {
 		return err
 	}
-	for _, address := range vm.SecondaryAddresses {
+	vm = nil // Cancel cleanup.
+	return nil
+}
+
+// commitMigratedVm will register the addresses of a migrated VM, save and
+// publish the VM and destroy the VM on the source Hypervisor. If force is
+// true, errors registering the addresses are logged rather than returned.
+func (m *Manager) commitMigratedVm(vm *vmInfoType, source migrationSource,
+	force bool) error {
+	addresses := append([]proto.Address{vm.Address}, vm.SecondaryAddresses...)
+	for _, address := range addresses {
 		if err := m.registerAddress(address); err != nil {
-			return err
+			if !force {
+				return err
+			}
+			vm.logger.Println(err)
 		}
 	}
 	vm.doNotWriteOrSend = false
 	vm.Uncommitted = false
 	vm.writeAndSendInfo()
-	err = hyperclient.DestroyVm(hypervisor, request.IpAddress, accessToken)
-	if err != nil {
-		m.Logger.Printf("error cleaning up old migrated VM: %s\n", ipAddress)
+	if err := source.destroyVm(); err != nil {
+		m.Logger.Printf("error cleaning up old migrated VM: %s\n",
+			vm.ipAddress)
 	}
 	vm.setupLockWatcher()
-	vm = nil // Cancel cleanup.
 	return nil
 }
 
@@ -2662,49 +2874,93 @@ func (vm *vmInfoType) makeExtraLogger(filename string) (
 		})
 }
 
+// createVolumesForLiveMigration will create empty (sparse) RAW volumes which
+// the source Hypervisor will mirror the volumes into, and will copy any extra
+// files such as the kernel and initrd.
+func (vm *vmInfoType) createVolumesForLiveMigration(hypervisor *srpc.Client,
+	accessToken []byte) error {
+	for index, volume := range vm.VolumeLocations {
+		file, err := os.OpenFile(volume.Filename,
+			os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fsutil.PrivateFilePerms)
+		if err != nil {
+			return err
+		}
+		err = file.Truncate(int64(vm.Volumes[index].Size))
+		file.Close()
+		if err != nil {
+			return err
+		}
+		vm.Volumes[index].Format = proto.VolumeFormatRaw
+	}
+	if len(vm.VolumeLocations) < 1 {
+		return nil
+	}
+	response, err := hyperclient.GetVmVolume(hypervisor,
+		proto.GetVmVolumeRequest{
+			AccessToken:    accessToken,
+			ExtraFilesOnly: true,
+			GetExtraFiles:  true,
+			IpAddress:      vm.Address.IpAddress,
+		},
+		nil, nil, 0, 0, vm.logger)
+	if err != nil {
+		return err
+	}
+	return writeExtraFiles(vm.VolumeLocations[0].DirectoryToCleanup,
+		response.ExtraFiles)
+}
+
+// migrateVmVolumes fetches the VM volumes. If initialCopy is true, the
+// volumes will be fetched again after the source VM is stopped.
 func (vm *vmInfoType) migrateVmVolumes(hypervisor *srpc.Client,
-	sourceIpAddr net.IP, accessToken []byte, getExtraFiles bool) error {
+	sourceIpAddr net.IP, accessToken []byte,
+	getExtraFiles, initialCopy bool) error {
 	for index, volume := range vm.VolumeLocations {
-		err := migrateVmVolume(hypervisor, volume.DirectoryToCleanup,
-			volume.Filename, uint(index), vm.Volumes[index].Size, sourceIpAddr,
-			accessToken, getExtraFiles, vm.logger)
+		flattened, err := migrateVmVolume(hypervisor,
+			volume.DirectoryToCleanup, volume.Filename, uint(index),
+			vm.Volumes[index].Size, sourceIpAddr, accessToken, getExtraFiles,
+			initialCopy, vm.logger)
 		if err != nil {
 			return err
 		}
+		if flattened {
+			vm.Volumes[index].Format = proto.VolumeFormatRaw
+		}
 	}
 	return nil
 }
 
 func migrateVmVolume(hypervisor *srpc.Client, directory, filename string,
 	volumeIndex uint, size uint64, ipAddr net.IP, accessToken []byte,
-	getExtraFiles bool, logger log.DebugLogger) error {
+	getExtraFiles, initialCopy bool, logger log.DebugLogger) (bool, error) {
 	var initialFileSize uint64
 	reader, err := os.OpenFile(filename, os.O_RDONLY, 0)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return err
+			return false, err
 		}
 	} else {
 		defer reader.Close()
 		if fi, err := reader.Stat(); err != nil {
-			return err
+			return false, err
 		} else {
 			initialFileSize = uint64(fi.Size())
 			if initialFileSize > size {
-				return errors.New("file larger than volume")
+				return false, errors.New("file larger than volume")
 			}
 		}
 	}
 	writer, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE,
 		fsutil.PrivateFilePerms)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer writer.Close()
 	request := proto.GetVmVolumeRequest{
 		AccessToken:      accessToken,
 		GetExtraFiles:    getExtraFiles,
 		IgnoreExtraFiles: !getExtraFiles,
+		InitialCopy:      initialCopy,
 		IpAddress:        ipAddr,
 		VolumeIndex:      volumeIndex,
 	}
@@ -2714,12 +2970,19 @@ func migrateVmVolume(hypervisor *srpc.Client, directory, filename string,
 		if reader == nil {
 			os.Remove(filename)
 		}
-		return err
+		return false, err
 	}
 	if !getExtraFiles {
-		return nil
+		return response.Flattened, nil
 	}
-	for name, data := range response.ExtraFiles {
+	if err := writeExtraFiles(directory, response.ExtraFiles); err != nil {
+		return false, err
+	}
+	return response.Flattened, nil
+}
+
+func writeExtraFiles(directory string, extraFiles map[string][]byte) error {
+	for name, data := range extraFiles {
 		if name != "initrd" && name != "kernel" {
 			return fmt.Errorf("received unsupported extra file: %s", name)
 		}
@@ -2833,6 +3096,9 @@ func (m *Manager) patchVmImage(conn *srpc.Conn,
 	default:
 		return errors.New("VM is not running or stopped")
 	}
+	if err := vm.flattenVolume(0); err != nil {
+		return err
+	}
 	vm.mutex.Unlock()
 	haveLock = false
 	rootFilename := vm.VolumeLocations[0].Filename
@@ -3309,6 +3575,9 @@ func (m *Manager) replaceVmImage(conn *srpc.Conn,
 	default:
 		return sendError(conn, errors.New("VM is not running or stopped"))
 	}
+	if err := vm.flattenVolume(0); err != nil {
+		return sendError(conn, err)
+	}
 	rootFilename := vm.VolumeLocations[0].Filename
 	if request.SkipBackup {
 		if err := os.Rename(tmpRootFilename, rootFilename); err != nil {
@@ -3554,6 +3823,9 @@ func (vm *vmInfoType) scanVmRoot(scanFilter *filter.Filter) (
 	if vm.State != proto.StateStopped {
 		return nil, errors.New("VM is not stopped")
 	}
+	if vm.Volumes[0].Format != proto.VolumeFormatRaw {
+		return nil, errors.New("cannot scan non-RAW root volume")
+	}
 	rootDir, err := ioutil.TempDir(vm.dirname, "root")
 	if err != nil {
 		return nil, err
@@ -3583,6 +3855,7 @@ func (vm *vmInfoType) scanVmRoot(scanFilter *filter.Filter) (
 
 func (m *Manager) sendVmInfo(ipAddress string, vm *proto.VmInfo) {
 	if ipAddress != "0.0.0.0" {
+		m.updateVmUsage(ipAddress, vm)
 		if vm == nil { // GOB cannot encode a nil value in a map.
 			vm = new(proto.VmInfo)
 		}
@@ -3606,11 +3879,8 @@ func (m *Manager) snapshotVm(ipAddr net.IP, authInfo *srpc.AuthInformation,
 	vm.blockMutations = true
 	vm.mutex.Unlock()
 	defer vm.allowMutationsAndUnlock(false)
-	if vm.getActiveInitrdPath() != "" {
-		return errors.New("cannot snapshot root volume with separate initrd")
-	}
-	if vm.getActiveKernelPath() != "" {
-		return errors.New("cannot snapshot root volume with separate kernel")
+	if err := vm.checkVmSupportsSnapshots(); err != nil {
+		return err
 	}
 	if vm.State != proto.StateStopped {
 		if !forceIfNotStopped {
@@ -3799,6 +4069,21 @@ func (m *Manager) unregisterVmMetadataNotifier(ipAddr net.IP,
 	return nil
 }
 
+// verifyImageSignature checks that the image was signed by a trusted signer,
+// if trusted signers were specified.
+func (m *Manager) verifyImageSignature(img *image.Image,
+	imageName string) error {
+	if m.TrustedImageSigners == nil {
+		return nil
+	}
+	signer, err := img.VerifySignature(m.TrustedImageSigners)
+	if err != nil {
+		return fmt.Errorf("image: %s failed verification: %s", imageName, err)
+	}
+	m.Logger.Debugf(0, "image: %s signed by: %s\n", imageName, signer)
+	return nil
+}
+
 func (m *Manager) writeRaw(volume proto.LocalVolume, extension string,
 	client *srpc.Client, fs *filesystem.FileSystem,
 	firmwareType proto.FirmwareType, writeRawOptions util.WriteRawOptions,
@@ -3864,6 +4149,7 @@ func (vm *vmInfoType) changeIpAddress(ipAddress string) error {
 			return err
 		}
 		vm.VolumeLocations[index] = proto.LocalVolume{
+			BackingFile:        volume.BackingFile,
 			DirectoryToCleanup: dirname,
 			Filename: filepath.Join(dirname,
 				filepath.Base(volume.Filename)),
@@ -4474,6 +4760,12 @@ func (vm *vmInfoType) startVm(enableNetboot, haveManagerLock bool) error {
 			return err
 		}
 	}
+	if vm.NetworkBytesPerSecond > 0 {
+		err := setNetworkRateLimit(tapNames, vm.NetworkBytesPerSecond)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
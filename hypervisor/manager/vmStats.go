@@ -0,0 +1,406 @@
+package manager
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+	"github.com/Cloud-Foundations/tricorder/go/tricorder"
+	"github.com/Cloud-Foundations/tricorder/go/tricorder/units"
+)
+
+const (
+	clockTicksPerSecond = 100 // USER_HZ on all supported platforms.
+	cgroupDirectory     = "/sys/fs/cgroup"
+)
+
+var (
+	vmStatsInterval = flag.Duration("vmStatsInterval", 30*time.Second,
+		"Interval between samples of VM resource usage")
+)
+
+type blockStatsType struct {
+	Device   string `json:"device"`
+	NodeName string `json:"node-name"`
+	Stats    struct {
+		RdBytes      uint64 `json:"rd_bytes"`
+		RdOperations uint64 `json:"rd_operations"`
+		WrBytes      uint64 `json:"wr_bytes"`
+		WrOperations uint64 `json:"wr_operations"`
+	} `json:"stats"`
+}
+
+// vmMetricsType holds the values exported as metrics. It is only accessed by
+// the metrics group update function and the metrics system.
+type vmMetricsType struct {
+	cpuTime               time.Duration
+	memoryRSS             uint64
+	networkRxBytes        uint64
+	networkTxBytes        uint64
+	volumeReadBytes       uint64
+	volumeReadOperations  uint64
+	volumeWriteBytes      uint64
+	volumeWriteOperations uint64
+}
+
+type vmStatsType struct {
+	directory *tricorder.DirectorySpec
+	metrics   vmMetricsType
+	mutex     sync.RWMutex // Protect everything below.
+	stats     proto.VmStats
+}
+
+// getCgroupDirectory returns the cgroup directory containing the CPU
+// accounting data for a process and whether it is a version 2 cgroup. If the
+// process is not the only member of the cgroup, an empty string is returned.
+func getCgroupDirectory(pid int) (string, bool) {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+	var dirname string
+	var isV2 bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			dirname = filepath.Join(cgroupDirectory, fields[2])
+			isV2 = true
+			break
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpuacct" {
+				dirname = filepath.Join(cgroupDirectory, fields[1], fields[2])
+			}
+		}
+	}
+	if dirname == "" {
+		return "", false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dirname, "cgroup.procs"))
+	if err != nil {
+		return "", false
+	}
+	if strings.TrimSpace(string(data)) != strconv.Itoa(pid) {
+		return "", false // Shared with other processes.
+	}
+	return dirname, isV2
+}
+
+// readCpuTime returns the CPU time consumed by a process. If the process has
+// its own cgroup, the cgroup accounting data are used, otherwise the data for
+// the process are used.
+func readCpuTime(pid int) (time.Duration, error) {
+	if dirname, isV2 := getCgroupDirectory(pid); dirname != "" {
+		if isV2 {
+			value, err := readKeyedValue(filepath.Join(dirname, "cpu.stat"),
+				"usage_usec")
+			if err == nil {
+				return time.Duration(value) * time.Microsecond, nil
+			}
+		} else {
+			value, err := readUint64(filepath.Join(dirname, "cpuacct.usage"))
+			if err == nil {
+				return time.Duration(value), nil
+			}
+		}
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// Skip past the command name, which may contain spaces.
+	index := strings.LastIndexByte(string(data), ')')
+	if index < 0 {
+		return 0, errors.New("malformed stat file")
+	}
+	fields := strings.Fields(string(data[index+1:]))
+	if len(fields) < 13 {
+		return 0, errors.New("short stat file")
+	}
+	var ticks uint64
+	for _, field := range fields[11:13] { // utime and stime.
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		ticks += value
+	}
+	return time.Duration(ticks) * time.Second / clockTicksPerSecond, nil
+}
+
+// readKeyedValue reads a value from a file with lines of the form "key value"
+// or "key: value unit".
+func readKeyedValue(filename, key string) (uint64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.TrimSuffix(fields[0], ":") != key {
+			continue
+		}
+		return strconv.ParseUint(fields[1], 10, 64)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s not found in: %s", key, filename)
+}
+
+func readMemoryRSS(pid int) (uint64, error) {
+	value, err := readKeyedValue(fmt.Sprintf("/proc/%d/status", pid), "VmRSS")
+	if err != nil {
+		return 0, err
+	}
+	return value << 10, nil // Value is in KiB.
+}
+
+// readTapCounters returns the number of bytes received and transmitted by a
+// VM over its tap devices. These are the reverse of the tap counters.
+func readTapCounters(tapNames []string) (uint64, uint64, error) {
+	var rxBytes, txBytes uint64
+	for _, tapName := range tapNames {
+		dirname := filepath.Join("/sys/class/net", tapName, "statistics")
+		value, err := readUint64(filepath.Join(dirname, "tx_bytes"))
+		if err != nil {
+			return 0, 0, err
+		}
+		rxBytes += value
+		value, err = readUint64(filepath.Join(dirname, "rx_bytes"))
+		if err != nil {
+			return 0, 0, err
+		}
+		txBytes += value
+	}
+	return rxBytes, txBytes, nil
+}
+
+func readUint64(filename string) (uint64, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func (m *Manager) getVmStats(request proto.GetVmStatsRequest) (
+	[]proto.VmStats, error) {
+	m.vmStatsMutex.Lock()
+	defer m.vmStatsMutex.Unlock()
+	var statsList []*vmStatsType
+	if len(request.IpAddresses) < 1 {
+		statsList = make([]*vmStatsType, 0, len(m.vmStats))
+		for _, vmStats := range m.vmStats {
+			statsList = append(statsList, vmStats)
+		}
+	} else {
+		statsList = make([]*vmStatsType, 0, len(request.IpAddresses))
+		for _, ipAddr := range request.IpAddresses {
+			if vmStats, ok := m.vmStats[ipAddr.String()]; !ok {
+				return nil, fmt.Errorf("no stats for VM: %s", ipAddr)
+			} else {
+				statsList = append(statsList, vmStats)
+			}
+		}
+	}
+	vmStatsList := make([]proto.VmStats, 0, len(statsList))
+	for _, vmStats := range statsList {
+		vmStats.mutex.RLock()
+		vmStatsList = append(vmStatsList, vmStats.stats)
+		vmStats.mutex.RUnlock()
+	}
+	return vmStatsList, nil
+}
+
+func (m *Manager) loopSampleVmStats() {
+	for ; ; time.Sleep(*vmStatsInterval) {
+		m.sampleVmStats()
+	}
+}
+
+// registerVmStatsMetrics registers the metrics for a VM in a directory named
+// after the IP address of the VM.
+func (m *Manager) registerVmStatsMetrics(ipAddr string,
+	vmStats *vmStatsType) error {
+	dir, err := tricorder.RegisterDirectory(filepath.Join("/vms", ipAddr))
+	if err != nil {
+		return err
+	}
+	vmStats.directory = dir
+	group := tricorder.NewGroup()
+	group.RegisterUpdateFunc(func() time.Time {
+		vmStats.mutex.RLock()
+		defer vmStats.mutex.RUnlock()
+		stats := vmStats.stats
+		vmStats.metrics = vmMetricsType{
+			cpuTime:        stats.CpuTime,
+			memoryRSS:      stats.MemoryRSS,
+			networkRxBytes: stats.NetworkRxBytes,
+			networkTxBytes: stats.NetworkTxBytes,
+		}
+		for _, volumeStats := range stats.VolumeStats {
+			vmStats.metrics.volumeReadBytes += volumeStats.ReadBytes
+			vmStats.metrics.volumeReadOperations += volumeStats.ReadOperations
+			vmStats.metrics.volumeWriteBytes += volumeStats.WriteBytes
+			vmStats.metrics.volumeWriteOperations +=
+				volumeStats.WriteOperations
+		}
+		return stats.SampleTime
+	})
+	metrics := &vmStats.metrics
+	for _, metric := range []struct {
+		name        string
+		value       interface{}
+		unit        units.Unit
+		description string
+	}{
+		{"cpu-time", &metrics.cpuTime, units.Second, "CPU time"},
+		{"memory-rss", &metrics.memoryRSS, units.Byte, "resident memory"},
+		{"network-rx-bytes", &metrics.networkRxBytes, units.Byte,
+			"bytes received by VM"},
+		{"network-tx-bytes", &metrics.networkTxBytes, units.Byte,
+			"bytes transmitted by VM"},
+		{"volume-read-bytes", &metrics.volumeReadBytes, units.Byte,
+			"bytes read from all volumes"},
+		{"volume-read-operations", &metrics.volumeReadOperations,
+			units.None, "read operations for all volumes"},
+		{"volume-write-bytes", &metrics.volumeWriteBytes, units.Byte,
+			"bytes written to all volumes"},
+		{"volume-write-operations", &metrics.volumeWriteOperations,
+			units.None, "write operations for all volumes"},
+	} {
+		err := dir.RegisterMetricInGroup(metric.name, metric.value, group,
+			metric.unit, metric.description)
+		if err != nil {
+			dir.UnregisterDirectory()
+			return err
+		}
+	}
+	return nil
+}
+
+// sampleVmStats samples the resource usage of all running VMs. Stats for VMs
+// which are no longer running are removed.
+func (m *Manager) sampleVmStats() {
+	m.mutex.RLock()
+	vms := make([]*vmInfoType, 0, len(m.vms))
+	for _, vm := range m.vms {
+		vms = append(vms, vm)
+	}
+	m.mutex.RUnlock()
+	sampled := make(map[string]proto.VmStats, len(vms))
+	for _, vm := range vms {
+		if stats, err := vm.sampleStats(); err != nil {
+			vm.logger.Debugf(1, "error sampling stats: %s\n", err)
+		} else if stats != nil {
+			sampled[stats.IpAddress.String()] = *stats
+		}
+	}
+	m.vmStatsMutex.Lock()
+	defer m.vmStatsMutex.Unlock()
+	if m.vmStats == nil {
+		m.vmStats = make(map[string]*vmStatsType)
+	}
+	for ipAddr, vmStats := range m.vmStats {
+		if _, ok := sampled[ipAddr]; !ok {
+			if vmStats.directory != nil {
+				vmStats.directory.UnregisterDirectory()
+			}
+			delete(m.vmStats, ipAddr)
+		}
+	}
+	for ipAddr, stats := range sampled {
+		vmStats := m.vmStats[ipAddr]
+		if vmStats == nil {
+			vmStats = &vmStatsType{stats: stats}
+			m.vmStats[ipAddr] = vmStats
+			if err := m.registerVmStatsMetrics(ipAddr, vmStats); err != nil {
+				m.Logger.Printf("error registering metrics for VM: %s: %s\n",
+					ipAddr, err)
+			}
+			continue
+		}
+		vmStats.mutex.Lock()
+		vmStats.stats = stats
+		vmStats.mutex.Unlock()
+	}
+}
+
+// sampleStats samples the resource usage of the VM. If the VM is not running,
+// nil is returned. No locks should be held.
+func (vm *vmInfoType) sampleStats() (*proto.VmStats, error) {
+	vm.mutex.RLock()
+	switch vm.State {
+	case proto.StateRunning, proto.StateDebugging:
+	default:
+		vm.mutex.RUnlock()
+		return nil, nil
+	}
+	ipAddr := net.ParseIP(vm.ipAddress)
+	nodeNames := vm.getVolumeNodeNames()
+	vm.mutex.RUnlock()
+	if ipAddr == nil {
+		return nil, nil // Externally managed lease.
+	}
+	pid, err := vm.readPid()
+	if err != nil {
+		return nil, err
+	}
+	stats := proto.VmStats{
+		IpAddress:   ipAddr,
+		SampleTime:  time.Now(),
+		VolumeStats: make([]proto.VolumeStats, len(nodeNames)),
+	}
+	if stats.CpuTime, err = readCpuTime(pid); err != nil {
+		return nil, err
+	}
+	if stats.MemoryRSS, err = readMemoryRSS(pid); err != nil {
+		return nil, err
+	}
+	tapNames, err := vm.getTapDevices()
+	if err != nil {
+		return nil, err
+	}
+	stats.NetworkRxBytes, stats.NetworkTxBytes, err = readTapCounters(
+		tapNames)
+	if err != nil {
+		return nil, err
+	}
+	var blockStats []blockStatsType
+	if err := vm.qmpCommand("query-blockstats", nil, &blockStats); err != nil {
+		return nil, err
+	}
+	for index, nodeName := range nodeNames {
+		for _, device := range blockStats {
+			if device.Device != nodeName && device.NodeName != nodeName {
+				continue
+			}
+			stats.VolumeStats[index] = proto.VolumeStats{
+				ReadBytes:       device.Stats.RdBytes,
+				ReadOperations:  device.Stats.RdOperations,
+				WriteBytes:      device.Stats.WrBytes,
+				WriteOperations: device.Stats.WrOperations,
+			}
+			break
+		}
+	}
+	return &stats, nil
+}
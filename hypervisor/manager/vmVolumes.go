@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
@@ -22,6 +23,18 @@ func (vm *vmInfoType) checkVolumes(grabLock bool) error {
 	}
 	for index, volume := range vm.VolumeLocations {
 		expectedSize := vm.Volumes[index].Size
+		if volume.BackingFile != "" {
+			info, err := getQcow2Info(volume.Filename)
+			if err != nil {
+				return fmt.Errorf("error checking volume[%d]: %s", index, err)
+			}
+			if info.VirtualSize != expectedSize {
+				return fmt.Errorf("volume[%d] size expected: %s, found: %s",
+					index, format.FormatBytes(expectedSize),
+					format.FormatBytes(info.VirtualSize))
+			}
+			continue
+		}
 		if fi, err := os.Stat(volume.Filename); err != nil {
 			return fmt.Errorf("error stating volume[%d]: %s", index, err)
 		} else if foundSize := uint64(fi.Size()); foundSize != expectedSize {
@@ -37,6 +50,63 @@ func (vm *vmInfoType) checkVolumes(grabLock bool) error {
 	return nil
 }
 
+// flattenVolume will merge a layered volume with its (shared) backing file,
+// converting the volume and any snapshots or saved copies of it to RAW. The
+// VM must be stopped and the caller must hold the VM write lock.
+func (vm *vmInfoType) flattenVolume(index int) error {
+	volume := vm.VolumeLocations[index]
+	if volume.BackingFile == "" {
+		return nil
+	}
+	startTime := time.Now()
+	err := vm.manager.flattenVolumeFiles(volume, vm.Volumes[index].Size)
+	if err != nil {
+		return err
+	}
+	vm.setVolumeFlattened(index, startTime)
+	return nil
+}
+
+// flattenVolumeFiles will convert the volume and any snapshots or saved copies
+// of it which have a backing file to RAW. No locks are required, but the
+// caller must prevent the VM from starting or mutating.
+func (m *Manager) flattenVolumeFiles(volume proto.LocalVolume,
+	size uint64) error {
+	basename := filepath.Base(volume.Filename)
+	filenames, err := fsutil.ReadDirnames(volume.DirectoryToCleanup, false)
+	if err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		if filename != basename && !strings.HasPrefix(filename, basename+".") {
+			continue
+		}
+		pathname := filepath.Join(volume.DirectoryToCleanup, filename)
+		if info, err := getQcow2Info(pathname); err != nil {
+			return err
+		} else if info.BackingFilename == "" {
+			continue
+		}
+		if err := m.checkFreeSpaceForVolume(volume, nil, size); err != nil {
+			return err
+		}
+		if err := flattenQcow2InPlace(pathname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setVolumeFlattened records that a volume has been flattened. The caller
+// must hold the VM write lock.
+func (vm *vmInfoType) setVolumeFlattened(index int, startTime time.Time) {
+	vm.VolumeLocations[index].BackingFile = ""
+	vm.Volumes[index].Format = proto.VolumeFormatRaw
+	vm.writeAndSendInfo()
+	vm.logger.Printf("flattened volume[%d] in %s\n",
+		index, format.Duration(time.Since(startTime)))
+}
+
 func (vm *vmInfoType) scanSnapshots() error {
 	// Build a map of all filenames in VM volume directories.
 	dirnameToFilenames := make(map[string]map[string]struct{})
@@ -109,8 +179,10 @@ func (vm *vmInfoType) setupVolumes(rootSize uint64,
 		return err
 	}
 	filename := filepath.Join(volumeDirectory, "root")
-	vm.VolumeLocations = append(vm.VolumeLocations,
-		proto.LocalVolume{volumeDirectory, filename})
+	vm.VolumeLocations = append(vm.VolumeLocations, proto.LocalVolume{
+		DirectoryToCleanup: volumeDirectory,
+		Filename:           filename,
+	})
 	for index := range secondaryVolumes {
 		volumeDirectory := filepath.Join(volumeDirectories[index+1],
 			vm.ipAddress)
@@ -119,8 +191,10 @@ func (vm *vmInfoType) setupVolumes(rootSize uint64,
 			return err
 		}
 		filename := filepath.Join(volumeDirectory, indexToName(index+1))
-		vm.VolumeLocations = append(vm.VolumeLocations,
-			proto.LocalVolume{volumeDirectory, filename})
+		vm.VolumeLocations = append(vm.VolumeLocations, proto.LocalVolume{
+			DirectoryToCleanup: volumeDirectory,
+			Filename:           filename,
+		})
 	}
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/constants"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
 	libnet "github.com/Cloud-Foundations/Dominator/lib/net"
@@ -16,6 +17,9 @@ import (
 	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
+// The solicited-node multicast address for the IPv6 metadata address.
+const ipv6MetadataSolicitedNode = "ff02::1:fffe:a9fe"
+
 type statusType struct {
 	namespaceFd int
 	threadId    int
@@ -51,6 +55,30 @@ func blockMetadataOnInterface(ifName string) error {
 		return fmt.Errorf("error running ebtables: %s: %s",
 			err, string(output))
 	}
+	return blockIpv6MetadataOnInterface(ifName)
+}
+
+// blockIpv6MetadataOnInterface blocks traffic to and from the IPv6 link-local
+// metadata address, including Neighbour Discovery sent to its solicited-node
+// multicast address.
+func blockIpv6MetadataOnInterface(ifName string) error {
+	for _, ipAddr := range []string{
+		constants.Ipv6LinklocalAddress, ipv6MetadataSolicitedNode} {
+		for _, args := range [][]string{
+			{"INPUT", "-i", ifName, "--ip6-src", ipAddr},
+			{"INPUT", "-i", ifName, "--ip6-dst", ipAddr},
+			{"FORWARD", "-i", ifName, "--ip6-src", ipAddr},
+			{"FORWARD", "-o", ifName, "--ip6-dst", ipAddr},
+			{"OUTPUT", "-o", ifName, "--ip6-dst", ipAddr},
+		} {
+			cmd := exec.Command("ebtables", "-t", "filter", "-A", args[0],
+				args[1], args[2], "-p", "ip6", args[3], args[4], "-j", "DROP")
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("error running ebtables: %s: %s",
+					err, string(output))
+			}
+		}
+	}
 	return nil
 }
 
@@ -163,6 +191,15 @@ func (s *server) createNamespace(startChannel <-chan struct{},
 		statusChannel <- statusType{err: err}
 		return
 	}
+	cmd = exec.Command("ip", "-6", "addr", "add",
+		constants.Ipv6LinklocalAddress+"/64", "dev", "eth0", "nodad")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		statusChannel <- statusType{
+			err: fmt.Errorf("error adding IPv6 address: %s: %s",
+				err, string(output)),
+		}
+		return
+	}
 	hypervisorListener, err := net.Listen("tcp",
 		fmt.Sprintf("169.254.169.254:%d", s.hypervisorPortNum))
 	if err != nil {
@@ -174,9 +211,24 @@ func (s *server) createNamespace(startChannel <-chan struct{},
 		statusChannel <- statusType{err: err}
 		return
 	}
+	ipv6HypervisorListener, err := net.Listen("tcp",
+		fmt.Sprintf("[%s%%eth0]:%d", constants.Ipv6LinklocalAddress,
+			s.hypervisorPortNum))
+	if err != nil {
+		statusChannel <- statusType{err: err}
+		return
+	}
+	ipv6MetadataListener, err := net.Listen("tcp",
+		fmt.Sprintf("[%s%%eth0]:80", constants.Ipv6LinklocalAddress))
+	if err != nil {
+		statusChannel <- statusType{err: err}
+		return
+	}
 	statusChannel <- statusType{namespaceFd: namespaceFd, threadId: threadId}
 	logger.Printf("starting metadata server in thread: %d\n", threadId)
 	go httpServe(hypervisorListener, nil, time.Second*5)
+	go httpServe(ipv6HypervisorListener, nil, time.Second*5)
+	go httpServe(ipv6MetadataListener, s, time.Second*5)
 	httpServe(metadataListener, s, time.Second*5)
 }
 
@@ -225,6 +277,15 @@ func createInterface(bridge net.Interface, threadId int,
 			"error adding ebtables dnat to: %s to bridge: %s: %s: %s",
 			hwAddr, bridge.Name, err, output)
 	}
+	cmd = exec.Command("ebtables", "-t", "nat", "-A", "PREROUTING",
+		"--logical-in", bridge.Name, "-p", "ip6",
+		"--ip6-dst", constants.Ipv6LinklocalAddress, "-j", "dnat",
+		"--to-destination", hwAddr)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf(
+			"error adding ebtables IPv6 dnat to: %s to bridge: %s: %s: %s",
+			hwAddr, bridge.Name, err, output)
+	}
 	logger.Printf("created veth, remote addr: %s\n", hwAddr)
 	return nil
 }
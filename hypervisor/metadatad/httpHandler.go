@@ -33,7 +33,18 @@ func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		fmt.Fprintln(w, err)
 		return
 	}
+	if index := strings.IndexByte(hostname, '%'); index >= 0 {
+		hostname = hostname[:index] // Strip the IPv6 zone.
+	}
 	ipAddr := net.ParseIP(hostname)
+	if ipAddr.To4() == nil {
+		// Requests over IPv6 are identified by the primary IP address.
+		if ipAddr, err = s.manager.GetVmIpv4Address(ipAddr); err != nil {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
 	s.manager.NotifyVmMetadataRequest(ipAddr, req.URL.Path)
 	vmInfo, err := s.manager.GetVmInfo(ipAddr)
 	if err != nil {
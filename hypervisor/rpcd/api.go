@@ -62,11 +62,13 @@ func Setup(manager *manager.Manager, dhcpServer DhcpServer,
 		PublicMethods: []string{
 			"AcknowledgeVm",
 			"AddVmVolumes",
+			"BackupVm",
 			"BecomePrimaryVmOwner",
 			"ChangeVmConsoleType",
 			"ChangeVmCpuPriority",
 			"ChangeVmDestroyProtection",
 			"ChangeVmHostname",
+			"ChangeVmIoLimits",
 			"ChangeVmMachineType",
 			"ChangeVmOwnerGroups",
 			"ChangeVmOwnerUsers",
@@ -98,6 +100,7 @@ func Setup(manager *manager.Manager, dhcpServer DhcpServer,
 			"GetVmInfo",
 			"GetVmInfos",
 			"GetVmLastPatchLog",
+			"GetVmStats",
 			"GetVmUserData",
 			"GetVmVolume",
 			"ImportLocalVm",
@@ -117,6 +120,7 @@ func Setup(manager *manager.Manager, dhcpServer DhcpServer,
 			"RestoreVmUserData",
 			"ReorderVmVolumes",
 			"ScanVmRoot",
+			"SetVmSnapshotPolicy",
 			"SnapshotVm",
 			"StartVm",
 			"StopVm",
@@ -0,0 +1,9 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+func (t *srpcType) BackupVm(conn *srpc.Conn) error {
+	return t.manager.BackupVm(conn)
+}
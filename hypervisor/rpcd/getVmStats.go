@@ -0,0 +1,18 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) GetVmStats(conn *srpc.Conn,
+	request hypervisor.GetVmStatsRequest,
+	reply *hypervisor.GetVmStatsResponse) error {
+	vmStats, err := t.manager.GetVmStats(request)
+	*reply = hypervisor.GetVmStatsResponse{
+		Error:   errors.ErrorToString(err),
+		VmStats: vmStats,
+	}
+	return nil
+}
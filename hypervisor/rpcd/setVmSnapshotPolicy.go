@@ -0,0 +1,17 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) SetVmSnapshotPolicy(conn *srpc.Conn,
+	request hypervisor.SetVmSnapshotPolicyRequest,
+	reply *hypervisor.SetVmSnapshotPolicyResponse) error {
+	err := t.manager.SetVmSnapshotPolicy(conn.GetAuthInformation(), request)
+	*reply = hypervisor.SetVmSnapshotPolicyResponse{
+		Error: errors.ErrorToString(err),
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/hypervisor"
+)
+
+func (t *srpcType) UpdateOwnerQuotas(conn *srpc.Conn,
+	request hypervisor.UpdateOwnerQuotasRequest,
+	reply *hypervisor.UpdateOwnerQuotasResponse) error {
+	*reply = hypervisor.UpdateOwnerQuotasResponse{
+		Error: errors.ErrorToString(t.manager.UpdateOwnerQuotas(request))}
+	return nil
+}
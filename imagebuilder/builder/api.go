@@ -54,6 +54,8 @@ type bootstrapStream struct {
 	imageTags        tags.Tags
 	imageTriggers    *triggers.Triggers
 	ImageTriggersUrl string
+	OciLayout        string
+	OciReference     string
 	PackagerType     string
 }
 
@@ -219,6 +221,8 @@ type Builder struct {
 	stateDir                    string
 	imageRebuildInterval        time.Duration
 	imageServerAddress          string
+	imageSigningCertFile        string
+	imageSigningKeyFile         string
 	linksImageServerAddress     string
 	logger                      log.DebugLogger
 	imageStreamsPublicUrl       string // No variable expansion applied.
@@ -252,6 +256,8 @@ type BuilderOptions struct {
 	CreateSlaveTimeout                  time.Duration
 	ImageRebuildInterval                time.Duration
 	ImageServerAddress                  string
+	ImageSigningCertFile                string
+	ImageSigningKeyFile                 string
 	MaximumBuildDuration                time.Duration // Default/max: 24 hours.
 	MaximumExpirationDuration           time.Duration // Default: 1 day.
 	MaximumExpirationDurationPrivileged time.Duration // Default: 1 month.
@@ -20,6 +20,7 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/format"
 	"github.com/Cloud-Foundations/Dominator/lib/goroutine"
 	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/oci"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 	proto "github.com/Cloud-Foundations/Dominator/proto/imaginator"
 )
@@ -95,7 +96,6 @@ func (stream *bootstrapStream) build(b *Builder, client srpc.ClientI,
 	request proto.BuildImageRequest,
 	buildLog buildLogger) (*image.Image, error) {
 	startTime := time.Now()
-	args := make([]string, 0, len(stream.BootstrapCommand))
 	rootDir, err := makeTempDirectory("",
 		strings.Replace(request.StreamName, "/", "_", -1))
 	if err != nil {
@@ -106,16 +106,6 @@ func (stream *bootstrapStream) build(b *Builder, client srpc.ClientI,
 	vg := variablesGetter(request.Variables).copy()
 	vg.add("dir", rootDir)
 	request.Variables = vg
-	for _, exp := range stream.BootstrapCommand {
-		arg := expand.Expression(exp, func(name string) string {
-			return vg[name]
-		})
-		args = append(args, arg)
-	}
-	fmt.Fprintf(buildLog, "Running command: %s with args:\n", args[0])
-	for _, arg := range args[1:] {
-		fmt.Fprintf(buildLog, "    %s\n", arg)
-	}
 	g, err := newNamespaceTarget()
 	if err != nil {
 		return nil, err
@@ -124,28 +114,71 @@ func (stream *bootstrapStream) build(b *Builder, client srpc.ClientI,
 	ctx, cancel := makeContext2(b.maximumBuildDuration,
 		request.MaximumBuildDuration)
 	defer cancel()
-	err = runInTarget(ctx, g, nil, buildLog, buildLog, "", nil,
-		args[0], args[1:]...)
+	if stream.OciLayout != "" {
+		err = stream.extractOciLayout(rootDir, vg, buildLog)
+	} else {
+		err = stream.runBootstrapCommand(ctx, g, vg, buildLog)
+	}
 	if err != nil {
 		return nil, err
-	} else {
-		packager := b.packagerTypes[stream.PackagerType]
-		if err := packager.writePackageInstaller(rootDir); err != nil {
-			return nil, err
-		}
-		if err := clearResolvConf(ctx, g, buildLog, rootDir); err != nil {
-			return nil, err
-		}
-		buildDuration := time.Since(startTime)
-		fmt.Fprintf(buildLog, "\nBuild time: %s\n",
-			format.Duration(buildDuration))
-		if err := cleanPackages(ctx, g, rootDir, buildLog); err != nil {
-			return nil, err
-		}
-		return packImage(ctx, g, client, request, rootDir,
-			stream.Filter, nil, nil, stream.imageFilter, stream.imageTags,
-			stream.imageTriggers, b.mtimesCopyFilter, buildLog, b.logger)
 	}
+	packager := b.packagerTypes[stream.PackagerType]
+	if err := packager.writePackageInstaller(rootDir); err != nil {
+		return nil, err
+	}
+	if err := clearResolvConf(ctx, g, buildLog, rootDir); err != nil {
+		return nil, err
+	}
+	buildDuration := time.Since(startTime)
+	fmt.Fprintf(buildLog, "\nBuild time: %s\n",
+		format.Duration(buildDuration))
+	if err := cleanPackages(ctx, g, rootDir, buildLog); err != nil {
+		return nil, err
+	}
+	return packImage(ctx, g, client, request, rootDir,
+		stream.Filter, nil, nil, stream.imageFilter, stream.imageTags,
+		stream.imageTriggers, b.mtimesCopyFilter, buildLog, b.logger)
+}
+
+func (stream *bootstrapStream) extractOciLayout(rootDir string,
+	vg variablesGetter, buildLog io.Writer) error {
+	layout := expand.Expression(stream.OciLayout, func(name string) string {
+		return vg[name]
+	})
+	reference := expand.Expression(stream.OciReference,
+		func(name string) string {
+			return vg[name]
+		})
+	fmt.Fprintf(buildLog, "Extracting OCI image from: %s\n", layout)
+	startTime := time.Now()
+	img, err := oci.Open(layout, oci.OpenOptions{Reference: reference})
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	if err := img.Extract(rootDir); err != nil {
+		return err
+	}
+	fmt.Fprintf(buildLog, "Extracted %d layers in %s\n",
+		len(img.Manifest.Layers), format.Duration(time.Since(startTime)))
+	return nil
+}
+
+func (stream *bootstrapStream) runBootstrapCommand(ctx context.Context,
+	g *goroutine.Goroutine, vg variablesGetter, buildLog io.Writer) error {
+	args := make([]string, 0, len(stream.BootstrapCommand))
+	for _, exp := range stream.BootstrapCommand {
+		arg := expand.Expression(exp, func(name string) string {
+			return vg[name]
+		})
+		args = append(args, arg)
+	}
+	fmt.Fprintf(buildLog, "Running command: %s with args:\n", args[0])
+	for _, arg := range args[1:] {
+		fmt.Fprintf(buildLog, "    %s\n", arg)
+	}
+	return runInTarget(ctx, g, nil, buildLog, buildLog, "", nil,
+		args[0], args[1:]...)
 }
 
 func (packager *packagerType) writePackageInstaller(rootDir string) error {
@@ -2,6 +2,7 @@ package builder
 
 import (
 	"bytes"
+	"crypto/tls"
 	stderrors "errors"
 	"fmt"
 	"io"
@@ -338,6 +339,10 @@ func (b *Builder) buildWithLogger(builder imageBuilder, client srpc.ClientI,
 	if authInfo != nil {
 		img.CreatedFor = authInfo.Username
 	}
+	if err := b.signImage(img, buildLog); err != nil {
+		fmt.Fprintln(buildLog, err)
+		return nil, "", err
+	}
 	uploadStartTime := time.Now()
 	if name, err := addImage(client, request, img); err != nil {
 		fmt.Fprintln(buildLog, err)
@@ -541,6 +546,26 @@ func (b *Builder) rebuildImages(minInterval time.Duration) {
 	}
 }
 
+// signImage will sign the image if a signing certificate is configured. The
+// certificate and key are loaded for each image so that they may be rotated.
+func (b *Builder) signImage(img *image.Image, buildLog io.Writer) error {
+	if b.imageSigningCertFile == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(b.imageSigningCertFile,
+		b.imageSigningKeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading image signing certificate: %s", err)
+	}
+	startTime := time.Now()
+	if err := img.Sign(&cert); err != nil {
+		return fmt.Errorf("error signing image: %s", err)
+	}
+	fmt.Fprintf(buildLog, "Signed image in %s\n",
+		format.Duration(time.Since(startTime)))
+	return nil
+}
+
 func (bl *dualBuildLogger) Bytes() []byte {
 	return bl.buffer.Bytes()
 }
@@ -41,8 +41,17 @@ func writeFilter(writer io.Writer, prefix string, filt *filter.Filter) {
 }
 
 func (stream *bootstrapStream) WriteHtml(writer io.Writer) {
-	fmt.Fprintf(writer, "Bootstrap command: <code>%s</code><br>\n",
-		strings.Join(stream.BootstrapCommand, " "))
+	if stream.OciLayout != "" {
+		fmt.Fprintf(writer, "OCI layout: <code>%s</code>", stream.OciLayout)
+		if stream.OciReference != "" {
+			fmt.Fprintf(writer, " reference: <code>%s</code>",
+				stream.OciReference)
+		}
+		fmt.Fprintln(writer, "<br>")
+	} else {
+		fmt.Fprintf(writer, "Bootstrap command: <code>%s</code><br>\n",
+			strings.Join(stream.BootstrapCommand, " "))
+	}
 	writeFilter(writer, "", stream.Filter)
 	packager := stream.builder.packagerTypes[stream.PackagerType]
 	packager.WriteHtml(writer)
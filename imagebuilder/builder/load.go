@@ -135,6 +135,8 @@ func load(options BuilderOptions, params BuilderParams) (*Builder, error) {
 		stateDir:                    options.StateDirectory,
 		imageRebuildInterval:        options.ImageRebuildInterval,
 		imageServerAddress:          options.ImageServerAddress,
+		imageSigningCertFile:        options.ImageSigningCertFile,
+		imageSigningKeyFile:         options.ImageSigningKeyFile,
 		linksImageServerAddress:     options.PresentationImageServerAddress,
 		logger:                      params.Logger,
 		imageStreamsPublicUrl:       masterConfiguration.ImageStreamsUrl,
@@ -215,11 +217,16 @@ func loadMasterConfiguration(url string, logger log.DebugLogger) (
 	if err != nil {
 		return nil, err
 	}
-	for _, stream := range configuration.BootstrapStreams {
+	for name, stream := range configuration.BootstrapStreams {
 		if _, ok := configuration.PackagerTypes[stream.PackagerType]; !ok {
 			return nil, fmt.Errorf("packager type: \"%s\" unknown",
 				stream.PackagerType)
 		}
+		if stream.OciLayout != "" && len(stream.BootstrapCommand) > 0 {
+			return nil, fmt.Errorf(
+				"bootstrap stream: %s has both BootstrapCommand and OciLayout",
+				name)
+		}
 		if err := stream.loadFiles(); err != nil {
 			return nil, err
 		}
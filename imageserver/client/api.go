@@ -70,15 +70,30 @@ func GetImageExpiration(client srpc.ClientI, name string) (time.Time, error) {
 	return getImageExpiration(client, name)
 }
 
+// GetImageVersion returns the version (creation time and content digest) of
+// the specified image. If the image does not exist, nil is returned.
+func GetImageVersion(client srpc.ClientI, name string) (
+	*proto.ImageVersion, error) {
+	return getImageVersion(client, name)
+}
+
 func GetImageArchive(client srpc.ClientI, name string) (
 	proto.GetImageArchiveResponse, error) {
 	return getImageArchive(client, name)
 }
 
+// GetReplicationMaster is deprecated: use GetReplicationMembership instead.
 func GetReplicationMaster(client srpc.ClientI) (string, error) {
 	return getReplicationMaster(client)
 }
 
+// GetReplicationMembership will return the view of the replication group that
+// the imageserver has. Changes may be sent to any writable member.
+func GetReplicationMembership(client srpc.ClientI) (
+	proto.ReplicationMembership, error) {
+	return getReplicationMembership(client)
+}
+
 func GetImageWithTimeout(client srpc.ClientI, name string,
 	timeout time.Duration) (*image.Image, error) {
 	return getImage(client, name, timeout)
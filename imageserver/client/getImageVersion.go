@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func getImageVersion(client srpc.ClientI, name string) (
+	*imageserver.ImageVersion, error) {
+	request := imageserver.GetImageVersionRequest{ImageName: name}
+	var reply imageserver.GetImageVersionResponse
+	err := client.RequestReply("ImageServer.GetImageVersion", request,
+		&reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return nil, err
+	}
+	return reply.Version, nil
+}
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func getReplicationMembership(client srpc.ClientI) (
+	imageserver.ReplicationMembership, error) {
+	request := imageserver.GetReplicationMembershipRequest{}
+	var reply imageserver.GetReplicationMembershipResponse
+	err := client.RequestReply("ImageServer.GetReplicationMembership", request,
+		&reply)
+	if err != nil {
+		return imageserver.ReplicationMembership{}, err
+	}
+	if err := errors.New(reply.Error); err != nil {
+		return imageserver.ReplicationMembership{}, err
+	}
+	return reply.Membership, nil
+}
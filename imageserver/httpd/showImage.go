@@ -2,6 +2,7 @@ package httpd
 
 import (
 	"bufio"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
@@ -75,6 +76,16 @@ func (s state) showImageHandler(w http.ResponseWriter, req *http.Request) {
 			img.CreatedOn.In(time.Local).Format(timeFormat),
 			format.Duration(time.Since(img.CreatedOn)))
 	}
+	if signature := img.Signature; signature != nil &&
+		len(signature.Certificates) > 0 {
+		signer := "unknown"
+		cert, err := x509.ParseCertificate(signature.Certificates[0])
+		if err == nil {
+			signer = cert.Subject.CommonName
+		}
+		fmt.Fprintf(writer, "Signed by: %s on: %s\n<br>", signer,
+			signature.SignedOn.In(time.Local).Format(timeFormat))
+	}
 	if len(img.BuildGitUrl) > 0 {
 		fmt.Fprintf(writer,
 			"Built from Git repository: %s on branch: %s at commit: %s<br>\n",
@@ -24,12 +24,31 @@ var (
 		"Filename containing filter to include images for replication (default include all)")
 )
 
+// Config specifies how the imageserver replicates. If ReplicationMaster is
+// specified, images are replicated from the master and changes are forwarded
+// to it. If ReplicationPeers is specified, images are replicated between all
+// the peers and changes may be made on any peer. ReplicationSelf is the address
+// of this imageserver, which is excluded from ReplicationPeers.
+type Config struct {
+	ReplicationMaster string
+	ReplicationPeers  []string
+	ReplicationSelf   string
+}
+
+type Params struct {
+	ImageDataBase *scanner.ImageDataBase
+	Logger        log.DebugLogger
+	ObjectServer  objectserver.FullObjectServer
+}
+
 type srpcType struct {
 	imageDataBase             *scanner.ImageDataBase
 	excludeFilter             *filter.Filter
 	finishedReplication       <-chan struct{} // Closed when finished.
 	includeFilter             *filter.Filter
 	replicationMaster         string
+	replicationPeers          []*peerType
+	replicationSelf           string
 	imageserverResource       *srpc.ClientResource
 	objSrv                    objectserver.FullObjectServer
 	archiveMode               bool
@@ -38,6 +57,8 @@ type srpcType struct {
 	numReplicationClients     uint
 	imagesBeingInjectedLock   sync.Mutex // Protect imagesBeingInjected.
 	imagesBeingInjected       map[string]struct{}
+	conflictsLock             sync.Mutex // Protect conflicts.
+	conflicts                 map[string]conflictType
 }
 
 type htmlWriter srpcType
@@ -52,19 +73,39 @@ var replicationMessage = "cannot make changes while under replication control" +
 func Setup(imdb *scanner.ImageDataBase, replicationMaster string,
 	objSrv objectserver.FullObjectServer,
 	logger log.DebugLogger) (*htmlWriter, error) {
+	return SetupWithConfigAndParams(
+		Config{ReplicationMaster: replicationMaster},
+		Params{
+			ImageDataBase: imdb,
+			Logger:        logger,
+			ObjectServer:  objSrv,
+		})
+}
+
+func SetupWithConfigAndParams(config Config,
+	params Params) (*htmlWriter, error) {
+	replicationMaster := config.ReplicationMaster
 	if *archiveMode && replicationMaster == "" {
 		return nil, errors.New("replication master required in archive mode")
 	}
+	if replicationMaster != "" && len(config.ReplicationPeers) > 0 {
+		return nil, errors.New(
+			"cannot have both a replication master and replication peers")
+	}
 	finishedReplication := make(chan struct{})
 	srpcObj := &srpcType{
-		imageDataBase:       imdb,
+		imageDataBase:       params.ImageDataBase,
 		finishedReplication: finishedReplication,
 		replicationMaster:   replicationMaster,
+		replicationPeers: newPeers(config.ReplicationPeers,
+			config.ReplicationSelf),
+		replicationSelf:     config.ReplicationSelf,
 		imageserverResource: srpc.NewClientResource("tcp", replicationMaster),
-		objSrv:              objSrv,
-		logger:              logger,
+		objSrv:              params.ObjectServer,
+		logger:              params.Logger,
 		archiveMode:         *archiveMode,
 		imagesBeingInjected: make(map[string]struct{}),
+		conflicts:           make(map[string]conflictType),
 	}
 	var err error
 	if *replicationExcludeFilter != "" {
@@ -93,7 +134,9 @@ func Setup(imdb *scanner.ImageDataBase, replicationMaster string,
 			"GetImageComputedFiles",
 			"GetImageExpiration",
 			"GetImageUpdates",
+			"GetImageVersion",
 			"GetReplicationMaster",
+			"GetReplicationMembership",
 			"ListDirectories",
 			"ListImages",
 			"ListSelectedImages",
@@ -101,7 +144,11 @@ func Setup(imdb *scanner.ImageDataBase, replicationMaster string,
 	if replicationMaster != "" {
 		go srpcObj.replicator(finishedReplication)
 	} else {
+		// Peers must not wait for each other before serving updates.
 		close(finishedReplication)
+		for _, peer := range srpcObj.replicationPeers {
+			go srpcObj.peerReplicator(peer)
+		}
 	}
 	return (*htmlWriter)(srpcObj), nil
 }
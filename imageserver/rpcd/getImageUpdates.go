@@ -61,12 +61,20 @@ func (t *srpcType) getImageUpdates(conn *srpc.Conn,
 		if t.checkIgnoreImage(request.IgnoreExpiring, imageName) {
 			continue
 		}
-		imageUpdate := imageserver.ImageUpdate{Name: imageName}
-		if err := conn.Encode(imageUpdate); err != nil {
+		if err := t.sendAddImage(conn, imageName, request); err != nil {
 			t.logger.Println(err)
 			return err
 		}
 	}
+	if request.IncludeDeleted {
+		for _, imageName := range t.imageDataBase.ListDeletedImages() {
+			if err := sendUpdate(conn, imageName,
+				imageserver.OperationDeleteImage); err != nil {
+				t.logger.Println(err)
+				return err
+			}
+		}
+	}
 	// Signal end of initial image list.
 	if err := conn.Encode(imageserver.ImageUpdate{}); err != nil {
 		t.logger.Println(err)
@@ -86,8 +94,7 @@ func (t *srpcType) getImageUpdates(conn *srpc.Conn,
 			if t.checkIgnoreImage(request.IgnoreExpiring, imageName) {
 				break
 			}
-			if err := sendUpdate(conn, imageName,
-				imageserver.OperationAddImage); err != nil {
+			if err := t.sendAddImage(conn, imageName, request); err != nil {
 				t.logger.Println(err)
 				return err
 			}
@@ -142,6 +149,24 @@ func (t *srpcType) incrementNumReplicationClients(increment bool) {
 	}
 }
 
+// sendAddImage will send an add update for an image, including the image
+// version if requested.
+func (t *srpcType) sendAddImage(encoder srpc.Encoder, name string,
+	request imageserver.GetFilteredImageUpdatesRequest) error {
+	imageUpdate := imageserver.ImageUpdate{
+		Name:      name,
+		Operation: imageserver.OperationAddImage,
+	}
+	if request.IncludeVersions {
+		version, err := t.imageDataBase.GetImageVersion(name)
+		if err != nil {
+			return err
+		}
+		imageUpdate.Version = version
+	}
+	return encoder.Encode(imageUpdate)
+}
+
 func sendUpdate(encoder srpc.Encoder, name string, operation uint) error {
 	imageUpdate := imageserver.ImageUpdate{Name: name, Operation: operation}
 	return encoder.Encode(imageUpdate)
@@ -0,0 +1,16 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/errors"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) GetImageVersion(conn *srpc.Conn,
+	request imageserver.GetImageVersionRequest,
+	reply *imageserver.GetImageVersionResponse) error {
+	version, err := t.imageDataBase.GetImageVersion(request.ImageName)
+	reply.Error = errors.ErrorToString(err)
+	reply.Version = version
+	return nil
+}
@@ -0,0 +1,13 @@
+package rpcd
+
+import (
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+func (t *srpcType) GetReplicationMembership(conn *srpc.Conn,
+	request imageserver.GetReplicationMembershipRequest,
+	reply *imageserver.GetReplicationMembershipResponse) error {
+	reply.Membership = t.getReplicationMembership()
+	return nil
+}
@@ -3,6 +3,10 @@ package rpcd
 import (
 	"fmt"
 	"io"
+	"sort"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
 )
 
 func (hw *htmlWriter) writeHtml(writer io.Writer) {
@@ -12,6 +16,32 @@ func (hw *htmlWriter) writeHtml(writer io.Writer) {
 	}
 	fmt.Fprintf(writer, "Replication clients: %d<br>\n",
 		hw.getNumReplicationClients())
+	if len(hw.replicationPeers) > 0 {
+		fmt.Fprintln(writer, "Replication peers:")
+		for _, peer := range hw.replicationPeers {
+			member := peer.getMember()
+			state := `<font color="red">disconnected</font>`
+			if member.Connected {
+				state = "connected"
+			}
+			fmt.Fprintf(writer, ` <a href="http://%s/">%s</a> (%s`,
+				member.Address, member.Address, state)
+			if !member.LastUpdate.IsZero() {
+				fmt.Fprintf(writer, ", last update %s ago",
+					format.Duration(time.Since(member.LastUpdate)))
+			}
+			fmt.Fprint(writer, ")")
+		}
+		fmt.Fprintln(writer, "<br>")
+		hw.writeConflicts(writer)
+	}
+}
+
+func shortDigest(digest []byte) []byte {
+	if len(digest) > 8 {
+		return digest[:8]
+	}
+	return digest
 }
 
 func (hw *htmlWriter) getNumReplicationClients() uint {
@@ -19,3 +49,30 @@ func (hw *htmlWriter) getNumReplicationClients() uint {
 	defer hw.numReplicationClientsLock.RUnlock()
 	return hw.numReplicationClients
 }
+
+func (hw *htmlWriter) writeConflicts(writer io.Writer) {
+	hw.conflictsLock.Lock()
+	defer hw.conflictsLock.Unlock()
+	if len(hw.conflicts) < 1 {
+		return
+	}
+	names := make([]string, 0, len(hw.conflicts))
+	for name := range hw.conflicts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(writer,
+		`<font color="red">Image name conflicts: %d</font><br>`+"\n",
+		len(names))
+	for _, name := range names {
+		conflict := hw.conflicts[name]
+		fmt.Fprintf(writer,
+			"&nbsp;&nbsp;%s: with %s %s ago (local: %s %x, remote: %s %x)<br>\n",
+			name, conflict.peer,
+			format.Duration(time.Since(conflict.detectedAt)),
+			conflict.localVersion.CreatedOn.Format(format.TimeFormatSeconds),
+			shortDigest(conflict.localVersion.Digest),
+			conflict.remoteVersion.CreatedOn.Format(format.TimeFormatSeconds),
+			shortDigest(conflict.remoteVersion.Digest))
+	}
+}
@@ -0,0 +1,325 @@
+package rpcd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+type conflictType struct {
+	detectedAt    time.Time
+	localVersion  imageserver.ImageVersion
+	peer          string
+	remoteVersion imageserver.ImageVersion
+}
+
+type peerType struct {
+	address    string
+	resource   *srpc.ClientResource
+	lock       sync.Mutex // Protect the following fields.
+	connected  bool
+	lastUpdate time.Time
+}
+
+// isSelfAddress returns true if address refers to this imageserver, which is
+// listening on the port in self. Addresses are resolved, since the hostname
+// of this machine may not be the name used in the list of peers.
+func isSelfAddress(address, self string) bool {
+	if address == self {
+		return true
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if _, selfPort, err := net.SplitHostPort(self); err != nil ||
+		port != selfPort {
+		return false
+	}
+	addrs, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+	localAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if addr.IsLoopback() {
+			return true
+		}
+		for _, localAddr := range localAddrs {
+			if ipNet, ok := localAddr.(*net.IPNet); ok && ipNet.IP.Equal(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newPeers(addresses []string, self string) []*peerType {
+	var peers []*peerType
+	seen := make(map[string]struct{})
+	for _, address := range addresses {
+		if address == "" || isSelfAddress(address, self) {
+			continue
+		}
+		if _, ok := seen[address]; ok {
+			continue
+		}
+		seen[address] = struct{}{}
+		peers = append(peers, &peerType{
+			address:  address,
+			resource: srpc.NewClientResource("tcp", address),
+		})
+	}
+	return peers
+}
+
+// versionWins returns true if version a wins over version b. The earliest
+// created image wins, with ties broken by the lowest digest, so that all peers
+// independently choose the same winner.
+func versionWins(a, b *imageserver.ImageVersion) bool {
+	if !a.CreatedOn.Equal(b.CreatedOn) {
+		return a.CreatedOn.Before(b.CreatedOn)
+	}
+	return bytes.Compare(a.Digest, b.Digest) < 0
+}
+
+func (peer *peerType) getMember() imageserver.ReplicationMember {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+	return imageserver.ReplicationMember{
+		Address:    peer.address,
+		Connected:  peer.connected,
+		LastUpdate: peer.lastUpdate,
+		Writable:   true,
+	}
+}
+
+func (peer *peerType) setConnected(connected bool) {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+	peer.connected = connected
+}
+
+func (peer *peerType) recordUpdate() {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+	peer.lastUpdate = time.Now()
+}
+
+func (t *srpcType) peerReplicator(peer *peerType) {
+	initialTimeout := time.Second * 15
+	timeout := initialTimeout
+	var nextSleepStopTime time.Time
+	request := imageserver.GetFilteredImageUpdatesRequest{
+		IncludeDeleted:  true,
+		IncludeVersions: true,
+	}
+	for {
+		nextSleepStopTime = time.Now().Add(timeout)
+		if client, err := srpc.DialHTTP("tcp", peer.address,
+			timeout); err != nil {
+			t.logger.Printf("Error dialing: %s %s\n", peer.address, err)
+		} else {
+			if conn, err := client.Call(
+				"ImageServer.GetFilteredImageUpdates"); err != nil {
+				t.logger.Println(err)
+			} else {
+				if err := t.getPeerUpdates(conn, peer, request); err != nil {
+					if err == io.EOF {
+						t.logger.Printf(
+							"Connection to image replication peer: %s closed\n",
+							peer.address)
+						if nextSleepStopTime.Sub(time.Now()) < 1 {
+							timeout = initialTimeout
+						}
+					} else {
+						t.logger.Println(err)
+					}
+				}
+				conn.Close()
+			}
+			client.Close()
+		}
+		time.Sleep(nextSleepStopTime.Sub(time.Now()))
+		if timeout < time.Minute {
+			timeout *= 2
+		}
+	}
+}
+
+func (t *srpcType) getPeerUpdates(conn *srpc.Conn, peer *peerType,
+	request imageserver.GetFilteredImageUpdatesRequest) error {
+	t.logger.Printf("Image replicator: connected to peer: %s\n", peer.address)
+	peer.setConnected(true)
+	defer peer.setConnected(false)
+	replicationStartTime := time.Now()
+	if err := conn.Encode(request); err != nil {
+		return err
+	}
+	if err := conn.Flush(); err != nil {
+		return err
+	}
+	initialList := true
+	for {
+		var imageUpdate imageserver.ImageUpdate
+		if err := conn.Decode(&imageUpdate); err != nil {
+			if err == io.EOF {
+				return err
+			}
+			return errors.New("decode err: " + err.Error())
+		}
+		peer.recordUpdate()
+		switch imageUpdate.Operation {
+		case imageserver.OperationAddImage:
+			if imageUpdate.Name == "" { // Initial list has been sent.
+				if initialList {
+					t.logger.Printf("Replicated images from peer: %s in %s\n",
+						peer.address,
+						format.Duration(time.Since(replicationStartTime)))
+					initialList = false
+					t.pruneConflicts()
+				}
+				continue
+			}
+			if t.checkExcludeImage(imageUpdate.Name) {
+				continue
+			}
+			err := t.addPeerImage(peer, imageUpdate.Name, imageUpdate.Version)
+			if err != nil {
+				t.logger.Printf("error adding image: %s from: %s: %s\n",
+					imageUpdate.Name, peer.address, err)
+			}
+		case imageserver.OperationDeleteImage:
+			if err := t.deletePeerImage(peer, imageUpdate.Name); err != nil {
+				t.logger.Printf("error deleting image: %s from: %s: %s\n",
+					imageUpdate.Name, peer.address, err)
+			}
+		case imageserver.OperationMakeDirectory:
+			directory := imageUpdate.Directory
+			if directory == nil {
+				return errors.New("nil imageUpdate.Directory")
+			}
+			if err := t.imageDataBase.UpdateDirectory(*directory); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addPeerImage will add an image from a peer if it is not present. If a
+// different version of the image is present, the conflict is recorded and the
+// image from the peer replaces the local image if it wins.
+func (t *srpcType) addPeerImage(peer *peerType, name string,
+	version *imageserver.ImageVersion) error {
+	logger := prefixlogger.New(fmt.Sprintf("Replicator(%s): ", name), t.logger)
+	if t.imageDataBase.IsImageDeleted(name) {
+		logger.Debugf(0, "ignoring previously deleted image from: %s\n",
+			peer.address)
+		return nil
+	}
+	localVersion, err := t.imageDataBase.GetImageVersion(name)
+	if err != nil {
+		return err
+	}
+	if localVersion == nil {
+		logger.Printf("add image from: %s\n", peer.address)
+		return t.fetchAndAddImage(peer.resource, name, false, nil, logger)
+	}
+	if version == nil || bytes.Equal(version.Digest, localVersion.Digest) {
+		if version != nil {
+			t.clearConflict(name)
+		}
+		if img := t.imageDataBase.GetImage(name); img != nil {
+			t.checkExtendImageExpiration(peer.resource, name, img, logger)
+		}
+		return nil
+	}
+	t.recordConflict(name, peer.address, *localVersion, *version)
+	if !versionWins(version, localVersion) {
+		logger.Printf("name conflict with: %s, keeping local image\n",
+			peer.address)
+		return nil
+	}
+	logger.Printf("name conflict with: %s, replacing local image\n",
+		peer.address)
+	return t.fetchAndAddImage(peer.resource, name, true, localVersion,
+		logger)
+}
+
+// deletePeerImage will delete an image which was deleted by a peer. If the
+// image is not present, the deletion is recorded so that the image will not be
+// added from another peer later.
+func (t *srpcType) deletePeerImage(peer *peerType, name string) error {
+	t.clearConflict(name)
+	if !t.imageDataBase.CheckImage(name) {
+		return t.imageDataBase.RecordDeletedImage(name)
+	}
+	t.logger.Printf("Replicator(%s): delete image from: %s\n",
+		name, peer.address)
+	return t.imageDataBase.DeleteImage(name,
+		&srpc.AuthInformation{HaveMethodAccess: true})
+}
+
+func (t *srpcType) clearConflict(name string) {
+	t.conflictsLock.Lock()
+	defer t.conflictsLock.Unlock()
+	delete(t.conflicts, name)
+}
+
+func (t *srpcType) getReplicationMembership() imageserver.ReplicationMembership {
+	membership := imageserver.ReplicationMembership{
+		Master: t.replicationMaster,
+		Members: []imageserver.ReplicationMember{{
+			Address:  t.replicationSelf,
+			Self:     true,
+			Writable: t.replicationMaster == "",
+		}},
+	}
+	if t.replicationMaster != "" {
+		membership.Members = append(membership.Members,
+			imageserver.ReplicationMember{
+				Address:  t.replicationMaster,
+				Writable: true,
+			})
+	}
+	for _, peer := range t.replicationPeers {
+		membership.Members = append(membership.Members, peer.getMember())
+	}
+	return membership
+}
+
+func (t *srpcType) recordConflict(name, peer string,
+	localVersion, remoteVersion imageserver.ImageVersion) {
+	t.conflictsLock.Lock()
+	defer t.conflictsLock.Unlock()
+	t.conflicts[name] = conflictType{
+		detectedAt:    time.Now(),
+		localVersion:  localVersion,
+		peer:          peer,
+		remoteVersion: remoteVersion,
+	}
+}
+
+// pruneConflicts will remove conflicts for images which no longer exist, such
+// as expired images.
+func (t *srpcType) pruneConflicts() {
+	t.conflictsLock.Lock()
+	defer t.conflictsLock.Unlock()
+	for name := range t.conflicts {
+		if !t.imageDataBase.CheckImage(name) {
+			delete(t.conflicts, name)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package rpcd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/imageserver/scanner"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	objectserver "github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/imageserver"
+)
+
+var authInfo = &srpc.AuthInformation{HaveMethodAccess: true}
+
+func makeTestImage(symlink string, createdOn time.Time) *image.Image {
+	fs := &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			1: &filesystem.SymlinkInode{Symlink: symlink},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{
+					Name:        "link",
+					InodeNumber: 1,
+				},
+			},
+		},
+	}
+	fs.RebuildInodePointers()
+	return &image.Image{CreatedOn: createdOn, FileSystem: fs}
+}
+
+func makeTestServer(t *testing.T) *srpcType {
+	logger := testlogger.New(t)
+	baseDir := t.TempDir()
+	imageDir := filepath.Join(baseDir, "images")
+	objectDir := filepath.Join(baseDir, "objects")
+	for _, dirname := range []string{imageDir, objectDir} {
+		if err := os.MkdirAll(dirname, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objSrv, err := objectserver.NewObjectServer(objectDir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imdb, err := scanner.Load(scanner.Config{BaseDirectory: imageDir},
+		scanner.Params{Logger: logger, ObjectServer: objSrv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &srpcType{
+		imageDataBase: imdb,
+		objSrv:        objSrv,
+		logger:        logger,
+		conflicts:     make(map[string]conflictType),
+	}
+}
+
+// makeTestPeer returns a peer which cannot be connected to, so that any
+// attempt to fetch an image from it fails.
+func makeTestPeer() *peerType {
+	return newPeers([]string{"localhost:1"}, "")[0]
+}
+
+func TestVersionWins(t *testing.T) {
+	now := time.Now()
+	version := func(createdOn time.Time,
+		digest ...byte) imageserver.ImageVersion {
+		return imageserver.ImageVersion{CreatedOn: createdOn, Digest: digest}
+	}
+	otherZone := time.FixedZone("other", 3600)
+	tests := []struct {
+		name     string
+		a        imageserver.ImageVersion
+		b        imageserver.ImageVersion
+		expected bool
+	}{
+		{"earlier", version(now, 2), version(now.Add(time.Second), 1), true},
+		{"later", version(now.Add(time.Second), 1), version(now, 2), false},
+		{"tie-lower-digest", version(now, 1, 2), version(now, 1, 3), true},
+		{"tie-higher-digest", version(now, 1, 3), version(now, 1, 2), false},
+		{"tie-same-digest", version(now, 1), version(now, 1), false},
+		{"tie-other-zone", version(now, 1), version(now.In(otherZone), 2),
+			true},
+	}
+	for _, test := range tests {
+		if result := versionWins(&test.a, &test.b); result != test.expected {
+			t.Errorf("%s: versionWins()=%v, expected: %v",
+				test.name, result, test.expected)
+		}
+	}
+}
+
+func TestIsSelfAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		self     string
+		expected bool
+	}{
+		{"host0:6971", "host0:6971", true},
+		{"localhost:6971", "host0:6971", true},
+		{"127.0.0.1:6971", "host0:6971", true},
+		{"localhost:6972", "host0:6971", false},
+		{"localhost", "host0:6971", false},
+		{"localhost:6971", "", false},
+	}
+	for _, test := range tests {
+		result := isSelfAddress(test.address, test.self)
+		if result != test.expected {
+			t.Errorf("isSelfAddress(%s, %s)=%v, expected: %v",
+				test.address, test.self, result, test.expected)
+		}
+	}
+}
+
+func TestAddPeerImageConflict(t *testing.T) {
+	server := makeTestServer(t)
+	peer := makeTestPeer()
+	now := time.Now()
+	localImage := makeTestImage("/tmp", now)
+	err := server.imageDataBase.AddImage(localImage, "image0", authInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	localVersion, err := server.imageDataBase.GetImageVersion("image0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A later image from a peer loses: the local image is kept.
+	laterVersion := &imageserver.ImageVersion{
+		CreatedOn: now.Add(time.Second),
+		Digest:    []byte{0},
+	}
+	if err := server.addPeerImage(peer, "image0", laterVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.conflicts["image0"]; !ok {
+		t.Error("conflict not recorded")
+	}
+	if server.imageDataBase.GetImage("image0") != localImage {
+		t.Error("local image replaced by losing image")
+	}
+	// An earlier image from a peer wins, so it must be fetched to replace the
+	// local image. This peer cannot be reached, so the local image is kept.
+	earlierVersion := &imageserver.ImageVersion{
+		CreatedOn: now.Add(-time.Second),
+		Digest:    []byte{0},
+	}
+	if err := server.addPeerImage(peer, "image0", earlierVersion); err == nil {
+		t.Error("winning image not fetched from peer")
+	}
+	if server.imageDataBase.GetImage("image0") != localImage {
+		t.Error("local image replaced by unavailable image")
+	}
+	// Once the peers agree the conflict is cleared.
+	if err := server.addPeerImage(peer, "image0", localVersion); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.conflicts["image0"]; ok {
+		t.Error("conflict not cleared")
+	}
+}
+
+func TestDeletePeerImage(t *testing.T) {
+	server := makeTestServer(t)
+	peer := makeTestPeer()
+	imdb := server.imageDataBase
+	if err := imdb.AddImage(makeTestImage("/tmp", time.Now()), "image0",
+		authInfo); err != nil {
+		t.Fatal(err)
+	}
+	server.recordConflict("image0", peer.address,
+		imageserver.ImageVersion{}, imageserver.ImageVersion{})
+	// A deletion from a peer deletes the local image, and a deletion of a
+	// missing image is recorded.
+	for _, name := range []string{"image0", "image1"} {
+		if err := server.deletePeerImage(peer, name); err != nil {
+			t.Fatal(err)
+		}
+		if imdb.CheckImage(name) {
+			t.Errorf("%s not deleted", name)
+		}
+		if !imdb.IsImageDeleted(name) {
+			t.Errorf("%s not recorded as deleted", name)
+		}
+	}
+	if _, ok := server.conflicts["image0"]; ok {
+		t.Error("conflict not cleared by deletion")
+	}
+	// Deleted images must not be resurrected by a peer which has a copy.
+	version := &imageserver.ImageVersion{CreatedOn: time.Now()}
+	for _, name := range []string{"image0", "image1"} {
+		if err := server.addPeerImage(peer, name, version); err != nil {
+			t.Fatal(err)
+		}
+		if imdb.CheckImage(name) {
+			t.Errorf("deleted %s resurrected", name)
+		}
+	}
+}
+
+func TestPruneConflicts(t *testing.T) {
+	server := makeTestServer(t)
+	err := server.imageDataBase.AddImage(makeTestImage("/tmp", time.Now()),
+		"image0", authInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"image0", "image1"} {
+		server.recordConflict(name, "peer",
+			imageserver.ImageVersion{}, imageserver.ImageVersion{})
+	}
+	server.pruneConflicts()
+	if _, ok := server.conflicts["image0"]; !ok {
+		t.Error("conflict for existing image0 pruned")
+	}
+	if _, ok := server.conflicts["image1"]; ok {
+		t.Error("conflict for missing image1 not pruned")
+	}
+}
@@ -1,6 +1,7 @@
 package rpcd
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -20,13 +21,10 @@ func (t *srpcType) replicator(finishedReplication chan<- struct{}) {
 	initialTimeout := time.Second * 15
 	timeout := initialTimeout
 	var nextSleepStopTime time.Time
-	method := "ImageServer.GetImageUpdates"
-	var request *imageserver.GetFilteredImageUpdatesRequest
-	if t.archiveMode && !*archiveExpiringImages {
-		method = "ImageServer.GetFilteredImageUpdates"
-		request = &imageserver.GetFilteredImageUpdatesRequest{
-			IgnoreExpiring: true,
-		}
+	// Versions are needed to detect images replaced on the master.
+	request := &imageserver.GetFilteredImageUpdatesRequest{
+		IgnoreExpiring:  t.archiveMode && !*archiveExpiringImages,
+		IncludeVersions: true,
 	}
 	for {
 		nextSleepStopTime = time.Now().Add(timeout)
@@ -34,7 +32,8 @@ func (t *srpcType) replicator(finishedReplication chan<- struct{}) {
 			timeout); err != nil {
 			t.logger.Printf("Error dialing: %s %s\n", t.replicationMaster, err)
 		} else {
-			if conn, err := client.Call(method); err != nil {
+			if conn, err := client.Call(
+				"ImageServer.GetFilteredImageUpdates"); err != nil {
 				t.logger.Println(err)
 			} else {
 				err := t.getUpdates(conn, &finishedReplication, request)
@@ -106,22 +105,14 @@ func (t *srpcType) getUpdates(conn *srpc.Conn,
 					format.Duration(time.Since(replicationStartTime)))
 				continue
 			}
-			if t.excludeFilter != nil &&
-				t.excludeFilter.Match(imageUpdate.Name) {
-				t.logger.Debugf(0, "Excluding %s from replication\n",
-					imageUpdate.Name)
-				continue
-			}
-			if t.includeFilter != nil &&
-				!t.includeFilter.Match(imageUpdate.Name) {
-				t.logger.Debugf(0, "Not including %s in replication\n",
-					imageUpdate.Name)
+			if t.checkExcludeImage(imageUpdate.Name) {
 				continue
 			}
 			if initialImages != nil {
 				initialImages[imageUpdate.Name] = struct{}{}
 			}
-			if err := t.addImage(imageUpdate.Name); err != nil {
+			err := t.addImage(imageUpdate.Name, imageUpdate.Version)
+			if err != nil {
 				t.logger.Printf("error adding image: %s: %s\n",
 					imageUpdate.Name, err)
 				someImagesFailed = true
@@ -165,10 +156,10 @@ func (t *srpcType) deleteMissingImages(imagesToKeep map[string]struct{}) {
 	}
 }
 
-func (t *srpcType) extendImageExpiration(name string,
-	img *image.Image) (bool, error) {
+func (t *srpcType) extendImageExpiration(resource *srpc.ClientResource,
+	name string, img *image.Image) (bool, error) {
 	timeout := time.Second * 60
-	client, err := t.imageserverResource.GetHTTP(nil, timeout)
+	client, err := resource.GetHTTP(nil, timeout)
 	if err != nil {
 		return false, err
 	}
@@ -184,25 +175,73 @@ func (t *srpcType) extendImageExpiration(name string,
 		&srpc.AuthInformation{HaveMethodAccess: true})
 }
 
-func (t *srpcType) addImage(name string) error {
-	timeout := time.Second * 60
+// addImage will add an image from the replication master if it is not present.
+// If version is not nil and a different version is present (the image was
+// replaced on the master to resolve a conflict between its peers), the image
+// is replaced.
+func (t *srpcType) addImage(name string,
+	version *imageserver.ImageVersion) error {
 	if t.checkImageBeingInjected(name) {
 		return nil
 	}
 	logger := prefixlogger.New(fmt.Sprintf("Replicator(%s): ", name), t.logger)
 	if img := t.imageDataBase.GetImage(name); img != nil {
-		if img.ExpiresAt.IsZero() {
-			return nil
-		}
-		if changed, err := t.extendImageExpiration(name, img); err != nil {
-			logger.Println(err)
-		} else if changed {
-			logger.Println("extended expiration time")
+		if version != nil {
+			localVersion, err := t.imageDataBase.GetImageVersion(name)
+			if err != nil {
+				return err
+			}
+			if localVersion != nil &&
+				!bytes.Equal(version.Digest, localVersion.Digest) {
+				logger.Println("image changed on master, replacing")
+				return t.fetchAndAddImage(t.imageserverResource, name, true,
+					nil, logger)
+			}
 		}
+		t.checkExtendImageExpiration(t.imageserverResource, name, img, logger)
 		return nil
 	}
 	logger.Println("add image")
-	client, err := t.imageserverResource.GetHTTP(nil, timeout)
+	return t.fetchAndAddImage(t.imageserverResource, name, false, nil, logger)
+}
+
+// checkExtendImageExpiration will extend the expiration time of an expiring
+// image to match the image on the server.
+func (t *srpcType) checkExtendImageExpiration(resource *srpc.ClientResource,
+	name string, img *image.Image, logger log.DebugLogger) {
+	if img.ExpiresAt.IsZero() {
+		return
+	}
+	if changed, err := t.extendImageExpiration(resource, name,
+		img); err != nil {
+		logger.Println(err)
+	} else if changed {
+		logger.Println("extended expiration time")
+	}
+}
+
+// checkExcludeImage returns true if the image should not be replicated.
+func (t *srpcType) checkExcludeImage(name string) bool {
+	if t.excludeFilter != nil && t.excludeFilter.Match(name) {
+		t.logger.Debugf(0, "Excluding %s from replication\n", name)
+		return true
+	}
+	if t.includeFilter != nil && !t.includeFilter.Match(name) {
+		t.logger.Debugf(0, "Not including %s in replication\n", name)
+		return true
+	}
+	return false
+}
+
+// fetchAndAddImage will fetch an image and any missing objects from the server
+// and add it. If replace is true, the existing image is replaced. If
+// replaceVersion is also not nil, the existing image is only replaced if the
+// fetched image wins over replaceVersion.
+func (t *srpcType) fetchAndAddImage(resource *srpc.ClientResource,
+	name string, replace bool, replaceVersion *imageserver.ImageVersion,
+	logger log.DebugLogger) error {
+	timeout := time.Second * 60
+	client, err := resource.GetHTTP(nil, timeout)
 	if err != nil {
 		return err
 	}
@@ -229,23 +268,40 @@ func (t *srpcType) addImage(name string) error {
 		logger.Println("ignoring expiring image in archiver mode")
 		return nil
 	}
+	if replaceVersion != nil {
+		digest, err := img.Digest()
+		if err != nil {
+			return err
+		}
+		version := &imageserver.ImageVersion{
+			CreatedOn: img.CreatedOn,
+			Digest:    digest,
+		}
+		if !versionWins(version, replaceVersion) {
+			logger.Println("downloaded image does not win, not replacing")
+			return nil
+		}
+	}
 	img.FileSystem.RebuildInodePointers()
 	err = t.imageDataBase.DoWithPendingImage(img, func() error {
 		if err := t.getMissingObjects(img, client, logger); err != nil {
 			client.Close()
 			return err
 		}
-		err := t.imageDataBase.AddImage(img, name,
-			&srpc.AuthInformation{HaveMethodAccess: true})
-		if err != nil {
-			return err
+		authInfo := &srpc.AuthInformation{HaveMethodAccess: true}
+		if replace {
+			return t.imageDataBase.ReplaceImage(img, name, authInfo)
 		}
-		return nil
+		return t.imageDataBase.AddImage(img, name, authInfo)
 	})
 	if err != nil {
 		return err
 	}
-	logger.Println("added image")
+	if replace {
+		logger.Println("replaced image")
+	} else {
+		logger.Println("added image")
+	}
 	return nil
 }
 
@@ -27,6 +27,7 @@ type Config struct {
 	MaximumExpirationDuration           time.Duration // Default: 1 day.
 	MaximumExpirationDurationPrivileged time.Duration // Default: 1 month.
 	ReplicationMaster                   string
+	ReplicationPeers                    []string
 }
 
 type notifiers map[<-chan string]chan<- string
@@ -40,6 +41,7 @@ type ImageDataBase struct {
 	secret      []byte
 	sync.RWMutex
 	// Protected by main lock.
+	deletedImages   map[string]struct{} // Truncated image files.
 	directoryMap    map[string]image.DirectoryMetadata
 	imageMap        map[string]*imageType // nil: write in progress.
 	addNotifiers    notifiers
@@ -52,6 +54,7 @@ type ImageDataBase struct {
 
 type imageType struct {
 	computedFiles []filesystem.ComputedFile
+	digest        []byte // Computed on demand.
 	fileChecksum  []byte
 	image         *image.Image
 	modifying     bool
@@ -155,10 +158,29 @@ func (imdb *ImageDataBase) GetImageComputedFiles(name string) (
 	return imdb.getImageComputedFiles(name)
 }
 
+// GetImageVersion returns the version (creation time and content digest) of
+// the specified image, or nil if the image does not exist.
+func (imdb *ImageDataBase) GetImageVersion(name string) (
+	*proto.ImageVersion, error) {
+	return imdb.getImageVersion(name)
+}
+
 func (imdb *ImageDataBase) GetUnreferencedObjectsStatistics() (uint64, uint64) {
 	return 0, 0
 }
 
+// IsImageDeleted returns true if the specified image was previously deleted.
+// Deleted image names may not be re-used.
+func (imdb *ImageDataBase) IsImageDeleted(name string) bool {
+	return imdb.isImageDeleted(name)
+}
+
+// ListDeletedImages returns the names of all images which were previously
+// deleted.
+func (imdb *ImageDataBase) ListDeletedImages() []string {
+	return imdb.listDeletedImages()
+}
+
 func (imdb *ImageDataBase) ListDirectories() []image.Directory {
 	return imdb.listDirectories()
 }
@@ -195,6 +217,12 @@ func (imdb *ImageDataBase) ObjectServer() objectserver.ObjectServer {
 	return imdb.Params.ObjectServer
 }
 
+// RecordDeletedImage will record that an image which does not exist was
+// deleted elsewhere, so that it will not be added later.
+func (imdb *ImageDataBase) RecordDeletedImage(name string) error {
+	return imdb.recordDeletedImage(name)
+}
+
 func (imdb *ImageDataBase) RegisterAddNotifier() <-chan string {
 	return imdb.registerAddNotifier()
 }
@@ -207,6 +235,14 @@ func (imdb *ImageDataBase) RegisterMakeDirectoryNotifier() <-chan image.Director
 	return imdb.registerMakeDirectoryNotifier()
 }
 
+// ReplaceImage will replace an existing image with a different image of the
+// same name. This is used to resolve conflicts between replication peers. An
+// add notification is sent.
+func (imdb *ImageDataBase) ReplaceImage(img *image.Image, name string,
+	authInfo *srpc.AuthInformation) error {
+	return imdb.replaceImage(img, name, authInfo)
+}
+
 func (imdb *ImageDataBase) RestoreImageFromArchive(
 	request proto.RestoreImageFromArchiveRequest,
 	authInfo *srpc.AuthInformation) error {
@@ -25,13 +25,26 @@ func (imdb *ImageDataBase) expireImage(img *image.Image, name string) {
 		time.AfterFunc(duration, func() { imdb.expireImage(img, name) })
 		return
 	}
-	imdb.Logger.Printf("Auto expiring (deleting) image: %s\n", name)
 	pathname := path.Join(imdb.BaseDirectory, name)
 	// Only rename file while lock is held, because removing can be slow.
 	imdb.Lock()
+	if current, _ := imdb.getImageWithLock(name); current != nil &&
+		current != img {
+		imdb.Unlock() // Image was replaced.
+		return
+	}
+	imdb.Logger.Printf("Auto expiring (deleting) image: %s\n", name)
 	if err := os.Rename(pathname, pathname+"~"); err != nil {
 		imdb.Logger.Println(err)
 	}
+	// With replication peers, leave an empty file behind, like deleteImage, so
+	// that the name is not re-used and peers do not add the image back.
+	if len(imdb.ReplicationPeers) > 0 {
+		if err := writeTombstone(pathname); err != nil {
+			imdb.Logger.Println(err)
+		}
+		imdb.deletedImages[name] = struct{}{}
+	}
 	imdb.deleteImageAndUpdateUnreferencedObjectsList(name)
 	imdb.Unlock()
 	if err := os.Remove(pathname + "~"); err != nil {
@@ -75,6 +75,17 @@ func writeImage(filename string, img *image.Image, exclusive bool) (
 	return fileChecksum, nil
 }
 
+// writeTombstone will write an empty file, recording that the image was
+// deleted.
+func writeTombstone(filename string) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+		fsutil.PublicFilePerms)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
 func (imdb *ImageDataBase) addImage(img *image.Image, name string,
 	authInfo *srpc.AuthInformation) error {
 	if err := img.Verify(); err != nil {
@@ -378,6 +389,7 @@ func (imdb *ImageDataBase) deleteImage(name string,
 		if err := os.Truncate(filename, 0); err != nil {
 			return err
 		}
+		imdb.deletedImages[name] = struct{}{}
 		imdb.deleteImageAndUpdateUnreferencedObjectsList(name)
 		imdb.deleteNotifiers.sendPlain(name, "delete", imdb.Logger)
 		return nil
@@ -506,6 +518,32 @@ func (imdb *ImageDataBase) getImageComputedFiles(name string) (
 	return img.computedFiles, true
 }
 
+func (imdb *ImageDataBase) getImageVersion(name string) (
+	*proto.ImageVersion, error) {
+	imdb.RLock()
+	imgType, _ := imdb.getImageTypeWithLock(name)
+	var digest []byte
+	var img *image.Image
+	if imgType != nil {
+		digest = imgType.digest
+		img = imgType.image
+	}
+	imdb.RUnlock()
+	if img == nil {
+		return nil, nil
+	}
+	if digest == nil {
+		var err error
+		if digest, err = img.Digest(); err != nil {
+			return nil, err
+		}
+		imdb.Lock()
+		imgType.digest = digest
+		imdb.Unlock()
+	}
+	return &proto.ImageVersion{CreatedOn: img.CreatedOn, Digest: digest}, nil
+}
+
 func (imdb *ImageDataBase) getSecret() ([]byte, error) {
 	imdb.secretLock.Lock()
 	defer imdb.secretLock.Unlock()
@@ -533,6 +571,23 @@ func (imdb *ImageDataBase) getSecret() ([]byte, error) {
 	return imdb.secret, nil
 }
 
+func (imdb *ImageDataBase) isImageDeleted(name string) bool {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	_, ok := imdb.deletedImages[name]
+	return ok
+}
+
+func (imdb *ImageDataBase) listDeletedImages() []string {
+	imdb.RLock()
+	defer imdb.RUnlock()
+	names := make([]string, 0, len(imdb.deletedImages))
+	for name := range imdb.deletedImages {
+		names = append(names, name)
+	}
+	return names
+}
+
 func (imdb *ImageDataBase) listDirectories() []image.Directory {
 	imdb.RLock()
 	defer imdb.RUnlock()
@@ -633,6 +688,23 @@ func (imdb *ImageDataBase) makeDirectoryWithLock(directory image.Directory,
 	return imdb.updateDirectoryMetadata(directory)
 }
 
+func (imdb *ImageDataBase) recordDeletedImage(name string) error {
+	imdb.Lock()
+	defer imdb.Unlock()
+	if _, ok := imdb.deletedImages[name]; ok {
+		return nil
+	}
+	if _, ok := imdb.imageMap[name]; ok {
+		return errors.New("image: " + name + " exists")
+	}
+	if err := writeTombstone(filepath.Join(imdb.BaseDirectory,
+		name)); err != nil {
+		return err
+	}
+	imdb.deletedImages[name] = struct{}{}
+	return nil
+}
+
 func (imdb *ImageDataBase) registerAddNotifier() <-chan string {
 	channel := make(chan string, 1)
 	imdb.Lock()
@@ -657,6 +729,45 @@ func (imdb *ImageDataBase) registerMakeDirectoryNotifier() <-chan image.Director
 	return channel
 }
 
+func (imdb *ImageDataBase) replaceImage(img *image.Image, name string,
+	authInfo *srpc.AuthInformation) error {
+	if err := img.Verify(); err != nil {
+		return err
+	}
+	if imageIsExpired(img) {
+		imdb.Logger.Printf("Ignoring already expired image: %s\n", name)
+		return nil
+	}
+	imdb.Lock()
+	oldImgType, _ := imdb.getImageTypeWithLock(name)
+	if oldImgType == nil || oldImgType.image == nil {
+		imdb.Unlock()
+		return errors.New("image: " + name + " does not exist")
+	}
+	if oldImgType.modifying {
+		imdb.Unlock()
+		return errors.New("image being modified")
+	}
+	if err := imdb.checkPermissions(name, oldImgType.image,
+		authInfo); err != nil {
+		imdb.Unlock()
+		return err
+	}
+	oldImgType.modifying = true
+	imdb.Unlock()
+	defer func() {
+		imdb.Lock()
+		oldImgType.modifying = false
+		imdb.Unlock()
+	}()
+	if err := imdb.writeImage(name, img, false); err != nil {
+		return err
+	}
+	// Release the old references after the new ones are taken, so that shared
+	// objects do not become unreferenced.
+	return imdb.Params.ObjectServer.AdjustRefcounts(false, oldImgType.image)
+}
+
 func (imdb *ImageDataBase) restoreImageFromArchive(
 	req proto.RestoreImageFromArchiveRequest,
 	authInfo *srpc.AuthInformation) error {
@@ -759,6 +870,7 @@ func (imdb *ImageDataBase) writeImage(name string, img *image.Image,
 	}
 	imdb.scheduleExpiration(img, name)
 	imdb.Lock()
+	delete(imdb.deletedImages, name) // Replicas may re-use deleted names.
 	imdb.imageMap[name] = &imageType{
 		computedFiles: computedFiles,
 		fileChecksum:  fileChecksum,
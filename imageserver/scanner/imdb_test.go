@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	objectserver "github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+)
+
+var authInfo = &srpc.AuthInformation{HaveMethodAccess: true}
+
+func makeTestImage(symlink string, createdOn time.Time) *image.Image {
+	fs := &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			1: &filesystem.SymlinkInode{Symlink: symlink},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{
+					Name:        "link",
+					InodeNumber: 1,
+				},
+			},
+		},
+	}
+	fs.RebuildInodePointers()
+	return &image.Image{CreatedOn: createdOn, FileSystem: fs}
+}
+
+func loadTestDataBase(t *testing.T, baseDir string) *ImageDataBase {
+	logger := testlogger.New(t)
+	imageDir := filepath.Join(baseDir, "images")
+	objectDir := filepath.Join(baseDir, "objects")
+	for _, dirname := range []string{imageDir, objectDir} {
+		if err := os.MkdirAll(dirname, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objSrv, err := objectserver.NewObjectServer(objectDir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imdb, err := Load(Config{BaseDirectory: imageDir},
+		Params{Logger: logger, ObjectServer: objSrv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return imdb
+}
+
+func TestDeletedImages(t *testing.T) {
+	baseDir := t.TempDir()
+	imdb := loadTestDataBase(t, baseDir)
+	img := makeTestImage("/tmp", time.Now())
+	if err := imdb.AddImage(img, "image0", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	if imdb.IsImageDeleted("image0") {
+		t.Fatal("image0 deleted before deletion")
+	}
+	if err := imdb.DeleteImage("image0", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	if err := imdb.RecordDeletedImage("image1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := imdb.AddImage(img, "image0", authInfo); err == nil {
+		t.Error("deleted image0 was added again")
+	}
+	if err := imdb.AddImage(img, "image1", authInfo); err == nil {
+		t.Error("deleted image1 was added")
+	}
+	if err := imdb.AddImage(img, "image2", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	if err := imdb.RecordDeletedImage("image2"); err == nil {
+		t.Error("existing image2 was recorded as deleted")
+	}
+	// Deleted images must be remembered after a restart.
+	imdb = loadTestDataBase(t, baseDir)
+	for _, name := range []string{"image0", "image1"} {
+		if !imdb.IsImageDeleted(name) {
+			t.Errorf("%s not deleted after reload", name)
+		}
+	}
+	if imdb.IsImageDeleted("image2") {
+		t.Error("image2 deleted after reload")
+	}
+	if deleted := imdb.ListDeletedImages(); len(deleted) != 2 {
+		t.Errorf("deleted images: %v", deleted)
+	}
+}
+
+func TestExpiredImageIsDeleted(t *testing.T) {
+	imdb := loadTestDataBase(t, t.TempDir())
+	imdb.ReplicationPeers = []string{"peer:6971"}
+	img := makeTestImage("/tmp", time.Now())
+	img.ExpiresAt = time.Now().Add(100 * time.Millisecond)
+	if err := imdb.AddImage(img, "image0", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	stopTime := time.Now().Add(5 * time.Second)
+	for imdb.CheckImage("image0") && time.Now().Before(stopTime) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if imdb.CheckImage("image0") {
+		t.Fatal("image0 not expired")
+	}
+	if !imdb.IsImageDeleted("image0") {
+		t.Error("expired image0 not recorded as deleted")
+	}
+	img = makeTestImage("/tmp", time.Now())
+	if err := imdb.AddImage(img, "image0", authInfo); err == nil {
+		t.Error("expired image0 was added again")
+	}
+}
+
+func TestExpiredImageMayBeReAddedWithoutPeers(t *testing.T) {
+	imdb := loadTestDataBase(t, t.TempDir())
+	img := makeTestImage("/tmp", time.Now())
+	img.ExpiresAt = time.Now().Add(100 * time.Millisecond)
+	if err := imdb.AddImage(img, "image0", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	stopTime := time.Now().Add(5 * time.Second)
+	for imdb.CheckImage("image0") && time.Now().Before(stopTime) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if imdb.CheckImage("image0") {
+		t.Fatal("image0 not expired")
+	}
+	if imdb.IsImageDeleted("image0") {
+		t.Error("expired image0 recorded as deleted")
+	}
+	img = makeTestImage("/tmp", time.Now())
+	if err := imdb.AddImage(img, "image0", authInfo); err != nil {
+		t.Errorf("expired image0 not added again: %s", err)
+	}
+}
+
+func TestReplaceImage(t *testing.T) {
+	imdb := loadTestDataBase(t, t.TempDir())
+	oldImage := makeTestImage("/tmp", time.Now())
+	if err := imdb.ReplaceImage(oldImage, "image0", authInfo); err == nil {
+		t.Error("missing image0 was replaced")
+	}
+	if err := imdb.AddImage(oldImage, "image0", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	oldVersion, err := imdb.GetImageVersion("image0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addChannel := imdb.RegisterAddNotifier()
+	defer imdb.UnregisterAddNotifier(addChannel)
+	newImage := makeTestImage("/var", time.Now().Add(-time.Hour))
+	if err := imdb.ReplaceImage(newImage, "image0", authInfo); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-addChannel:
+		if name != "image0" {
+			t.Errorf("add notification for: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("no add notification for replaced image")
+	}
+	if imdb.GetImage("image0") != newImage {
+		t.Error("image0 not replaced")
+	}
+	newVersion, err := imdb.GetImageVersion("image0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(newVersion.Digest, oldVersion.Digest) {
+		t.Error("digest not changed by replacement")
+	}
+	if !newVersion.CreatedOn.Equal(newImage.CreatedOn) {
+		t.Errorf("CreatedOn: %s != %s",
+			newVersion.CreatedOn, newImage.CreatedOn)
+	}
+}
@@ -45,6 +45,7 @@ func loadImageDataBase(config Config, params Params) (*ImageDataBase, error) {
 		Config:          config,
 		Params:          params,
 		directoryMap:    make(map[string]image.DirectoryMetadata),
+		deletedImages:   make(map[string]struct{}),
 		imageMap:        make(map[string]*imageType),
 		addNotifiers:    make(notifiers),
 		deleteNotifiers: make(notifiers),
@@ -114,10 +115,16 @@ func (imdb *ImageDataBase) scanDirectory(dirname string,
 		}
 		if stat.Mode&syscall.S_IFMT == syscall.S_IFDIR {
 			err = imdb.scanDirectory(filename, state)
-		} else if stat.Mode&syscall.S_IFMT == syscall.S_IFREG && stat.Size > 0 {
-			err = state.GoRun(func() error {
-				return imdb.loadFile(filename)
-			})
+		} else if stat.Mode&syscall.S_IFMT == syscall.S_IFREG {
+			if stat.Size > 0 {
+				err = state.GoRun(func() error {
+					return imdb.loadFile(filename)
+				})
+			} else if name[len(name)-1] != '~' {
+				imdb.Lock()
+				imdb.deletedImages[filename] = struct{}{}
+				imdb.Unlock()
+			}
 		}
 		if err != nil {
 			if err == syscall.ENOENT {
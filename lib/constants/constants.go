@@ -27,8 +27,9 @@ const (
 	PatchedImageNameFile = "/var/lib/patched-image"
 
 	// Metadata service.
-	LinklocalAddress = "169.254.169.254"
-	MetadataUrl      = "http://" + LinklocalAddress
+	LinklocalAddress     = "169.254.169.254"
+	Ipv6LinklocalAddress = "fe80::a9fe:a9fe"
+	MetadataUrl          = "http://" + LinklocalAddress
 
 	// Common endpoints.
 	MetadataUserData = "/latest/user-data"
@@ -145,6 +145,7 @@ type DirectoryInode struct {
 	Mode          FileMode
 	Uid           uint32
 	Gid           uint32
+	Xattrs        map[string][]byte
 }
 
 func (directory *DirectoryInode) BuildEntryMap() {
@@ -215,6 +216,7 @@ type RegularInode struct {
 	MtimeSeconds     int64
 	Size             uint64
 	Hash             hash.Hash
+	Xattrs           map[string][]byte
 }
 
 func (inode *RegularInode) GetGid() uint32 {
@@ -280,6 +282,7 @@ type SymlinkInode struct {
 	Uid     uint32
 	Gid     uint32
 	Symlink string
+	Xattrs  map[string][]byte
 }
 
 func (inode *SymlinkInode) GetGid() uint32 {
@@ -319,6 +322,7 @@ type SpecialInode struct {
 	MtimeNanoSeconds int32
 	MtimeSeconds     int64
 	Rdev             uint64
+	Xattrs           map[string][]byte
 }
 
 func (inode *SpecialInode) GetGid() uint32 {
@@ -423,6 +427,32 @@ func CompareSpecialInodesData(left, right *SpecialInode,
 	return compareSpecialInodesData(left, right, logWriter)
 }
 
+// CompareXattrs returns true if the extended attributes are the same.
+func CompareXattrs(left, right map[string][]byte, logWriter io.Writer) bool {
+	return compareXattrs(left, right, logWriter)
+}
+
 func ForceWriteMetadata(inode GenericInode, name string) error {
 	return forceWriteMetadata(inode, name)
 }
+
+// GetXattrs returns the managed extended attributes of the named file (see
+// IsManagedXattr). Symlinks are not followed. If extended attributes are not
+// supported, nil is returned.
+func GetXattrs(name string) (map[string][]byte, error) {
+	return getXattrs(name)
+}
+
+// IsManagedXattr returns true if the named extended attribute is managed.
+// Only user.*, file capabilities and POSIX ACLs are managed. Others, such as
+// security.selinux, security.ima and trusted.* are left alone.
+func IsManagedXattr(name string) bool {
+	return isManagedXattr(name)
+}
+
+// WriteXattrs sets the managed extended attributes of the named file and
+// removes any other managed extended attributes. Unmanaged extended attributes
+// are ignored. Symlinks are not followed.
+func WriteXattrs(name string, xattrs map[string][]byte) error {
+	return writeXattrs(name, xattrs)
+}
@@ -71,7 +71,7 @@ func compareDirectoriesMetadata(left, right *DirectoryInode,
 		}
 		return false
 	}
-	return true
+	return compareXattrs(left.Xattrs, right.Xattrs, logWriter)
 }
 
 func compareDirectoryEntries(left, right *DirectoryEntry,
@@ -205,7 +205,7 @@ func compareRegularInodesMetadata(left, right *RegularInode,
 		}
 		return false
 	}
-	return true
+	return compareXattrs(left.Xattrs, right.Xattrs, logWriter)
 }
 
 func compareRegularInodesData(left, right *RegularInode,
@@ -311,7 +311,7 @@ func compareSymlinkInodesMetadata(left, right *SymlinkInode,
 		}
 		return false
 	}
-	return true
+	return compareXattrs(left.Xattrs, right.Xattrs, logWriter)
 }
 
 func compareSymlinkInodesData(left, right *SymlinkInode,
@@ -374,7 +374,7 @@ func compareSpecialInodesMetadata(left, right *SpecialInode,
 		}
 		return false
 	}
-	return true
+	return compareXattrs(left.Xattrs, right.Xattrs, logWriter)
 }
 
 func compareSpecialInodesData(left, right *SpecialInode,
@@ -49,6 +49,9 @@ type Params struct {
 	CheckScanDisableRequest func() bool
 	Hasher                  Hasher
 	OldFS                   *FileSystem
+	// If IsDirty is not nil, pathnames for which it returns false are copied
+	// from OldFS (without reading file data) if they appear unchanged.
+	IsDirty func(pathname string) bool
 }
 
 func MakeRegularInode(stat *wsyscall.Stat_t) *filesystem.RegularInode {
@@ -76,6 +76,11 @@ func scanFileSystem(params Params) (*FileSystem, error) {
 	fileSystem.Mode = filesystem.FileMode(stat.Mode)
 	fileSystem.Uid = stat.Uid
 	fileSystem.Gid = stat.Gid
+	xattrs, err := filesystem.GetXattrs(params.RootDirectoryName)
+	if err != nil {
+		return nil, err
+	}
+	fileSystem.Xattrs = xattrs
 	fileSystem.DirectoryCount++
 	var tmpInode filesystem.RegularInode
 	if sha512.New().Size() != len(tmpInode.Hash) {
@@ -85,7 +90,7 @@ func scanFileSystem(params Params) (*FileSystem, error) {
 	if params.OldFS != nil && params.OldFS.InodeTable != nil {
 		oldDirectory = &params.OldFS.DirectoryInode
 	}
-	err, _ := fileSystem.scanDirectory(&fileSystem.FileSystem.DirectoryInode,
+	err, _ = fileSystem.scanDirectory(&fileSystem.FileSystem.DirectoryInode,
 		oldDirectory, "/")
 	params.OldFS = nil // Indicate early garbage collection.
 	if err != nil {
@@ -114,6 +119,14 @@ func (fs *FileSystem) scanDirectory(directory *filesystem.DirectoryInode,
 		return err, false
 	}
 	sort.Strings(names)
+	var oldEntries map[string]*filesystem.DirectoryEntry
+	if oldDirectory != nil && fs.params.IsDirty != nil {
+		oldEntries = make(map[string]*filesystem.DirectoryEntry,
+			len(oldDirectory.EntryList))
+		for _, entry := range oldDirectory.EntryList {
+			oldEntries[entry.Name] = entry
+		}
+	}
 	entryList := make([]*filesystem.DirectoryEntry, 0, len(names))
 	var copiedDirents int
 	for _, name := range names {
@@ -150,6 +163,16 @@ func (fs *FileSystem) scanDirectory(directory *filesystem.DirectoryInode,
 			if len(oldDirectory.EntryList) > index &&
 				oldDirectory.EntryList[index].Name == name {
 				oldDirent = oldDirectory.EntryList[index]
+			} else if oldEntries != nil {
+				oldDirent = oldEntries[name]
+			}
+		}
+		if oldDirent != nil && fs.params.IsDirty != nil &&
+			!fs.params.IsDirty(filename) {
+			if fs.copyOldEntry(oldDirent, &stat) {
+				entryList = append(entryList, oldDirent)
+				copiedDirents++
+				continue
 			}
 		}
 		if stat.Mode&syscall.S_IFMT == syscall.S_IFDIR {
@@ -161,7 +184,7 @@ func (fs *FileSystem) scanDirectory(directory *filesystem.DirectoryInode,
 		} else if stat.Mode&syscall.S_IFMT == syscall.S_IFSOCK {
 			continue
 		} else {
-			err = fs.addSpecialFile(dirent, &stat)
+			err = fs.addSpecialFile(dirent, myPathName, &stat)
 		}
 		if err != nil {
 			if err == syscall.ENOENT {
@@ -204,6 +227,12 @@ func (fs *FileSystem) addDirectory(dirent *filesystem.DirectoryEntry,
 	inode.Mode = filesystem.FileMode(stat.Mode)
 	inode.Uid = stat.Uid
 	inode.Gid = stat.Gid
+	xattrs, err := filesystem.GetXattrs(path.Join(fs.params.RootDirectoryName,
+		myPathName))
+	if err != nil {
+		return err
+	}
+	inode.Xattrs = xattrs
 	var oldInode *filesystem.DirectoryInode
 	if oldDirent != nil {
 		if oi, ok := oldDirent.Inode().(*filesystem.DirectoryInode); ok {
@@ -224,6 +253,56 @@ func (fs *FileSystem) addDirectory(dirent *filesystem.DirectoryEntry,
 	return nil
 }
 
+// addOldInode adds an inode (and for directories, all the inodes below) from
+// the old file-system to the inode table. If any of the inodes are already in
+// the table with a different value (such as a hard link which was scanned via
+// a dirty path) nothing is added and false is returned.
+func (fs *FileSystem) addOldInode(inodeNumber uint64,
+	inode filesystem.GenericInode) bool {
+	fs.fsLock.Lock()
+	defer fs.fsLock.Unlock()
+	if !fs.canAddOldInode(inodeNumber, inode) {
+		return false
+	}
+	fs.addOldInodeWithLock(inodeNumber, inode)
+	return true
+}
+
+func (fs *FileSystem) addOldInodeWithLock(inodeNumber uint64,
+	inode filesystem.GenericInode) {
+	if _, ok := fs.InodeTable[inodeNumber]; ok {
+		return
+	}
+	fs.InodeTable[inodeNumber] = inode
+	if inode, ok := inode.(*filesystem.DirectoryInode); ok {
+		fs.DirectoryCount++
+		for _, dirent := range inode.EntryList {
+			fs.addOldInodeWithLock(dirent.InodeNumber, dirent.Inode())
+		}
+	}
+}
+
+// canAddOldInode returns true if the inode (and for directories, all the
+// inodes below) are either not in the inode table or are the same inode.
+// Inodes which are being hashed cannot be added. The lock must be held.
+func (fs *FileSystem) canAddOldInode(inodeNumber uint64,
+	inode filesystem.GenericInode) bool {
+	if tableInode, ok := fs.InodeTable[inodeNumber]; ok {
+		return tableInode == inode
+	}
+	if _, ok := fs.hashWaiters[inodeNumber]; ok {
+		return false
+	}
+	if inode, ok := inode.(*filesystem.DirectoryInode); ok {
+		for _, dirent := range inode.EntryList {
+			if !fs.canAddOldInode(dirent.InodeNumber, dirent.Inode()) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (fs *FileSystem) addRegularFile(dirent *filesystem.DirectoryEntry,
 	directoryPathName string, stat *wsyscall.Stat_t) error {
 	fs.fsLock.Lock()
@@ -246,12 +325,18 @@ func (fs *FileSystem) addRegularFile(dirent *filesystem.DirectoryEntry,
 	fs.fsLock.Unlock()
 	pathName := path.Join(fs.params.RootDirectoryName, directoryPathName,
 		dirent.Name)
+	xattrs, err := filesystem.GetXattrs(pathName)
+	if err != nil {
+		close(channel)
+		return err
+	}
 	file, err := os.Open(pathName)
 	if err != nil {
 		close(channel)
 		return err
 	}
 	inode := makeRegularInode(stat)
+	inode.Xattrs = xattrs
 	err = fs.params.Runner.GoRun(func() (uint64, error) {
 		defer close(channel)
 		defer file.Close()
@@ -262,7 +347,8 @@ func (fs *FileSystem) addRegularFile(dirent *filesystem.DirectoryEntry,
 			}
 		}
 		if fs.params.OldFS != nil && fs.params.OldFS.InodeTable != nil {
-			if oldInode, found := fs.InodeTable[stat.Ino]; found {
+			// Share unchanged inodes, since other links may be copied.
+			if oldInode, found := fs.params.OldFS.InodeTable[stat.Ino]; found {
 				if oldInode, ok := oldInode.(*filesystem.RegularInode); ok {
 					if filesystem.CompareRegularInodes(inode, oldInode, nil) {
 						inode = oldInode
@@ -314,7 +400,7 @@ func (fs *FileSystem) addSymlink(dirent *filesystem.DirectoryEntry,
 }
 
 func (fs *FileSystem) addSpecialFile(dirent *filesystem.DirectoryEntry,
-	stat *wsyscall.Stat_t) error {
+	directoryPathName string, stat *wsyscall.Stat_t) error {
 	fs.fsLock.Lock()
 	if inode, ok := fs.InodeTable[stat.Ino]; ok {
 		if inode, ok := inode.(*filesystem.SpecialInode); ok {
@@ -327,6 +413,12 @@ func (fs *FileSystem) addSpecialFile(dirent *filesystem.DirectoryEntry,
 	}
 	fs.fsLock.Unlock()
 	inode := makeSpecialInode(stat)
+	xattrs, err := filesystem.GetXattrs(path.Join(fs.params.RootDirectoryName,
+		directoryPathName, dirent.Name))
+	if err != nil {
+		return err
+	}
+	inode.Xattrs = xattrs
 	if fs.params.OldFS != nil && fs.params.OldFS.InodeTable != nil {
 		if oldInode, found := fs.params.OldFS.InodeTable[stat.Ino]; found {
 			if oldInode, ok := oldInode.(*filesystem.SpecialInode); ok {
@@ -343,6 +435,43 @@ func (fs *FileSystem) addSpecialFile(dirent *filesystem.DirectoryEntry,
 	return nil
 }
 
+// copyOldEntry will copy an entry from the old file-system if the inode
+// metadata are unchanged. It returns true if the entry was copied.
+func (fs *FileSystem) copyOldEntry(oldDirent *filesystem.DirectoryEntry,
+	stat *wsyscall.Stat_t) bool {
+	if oldDirent.InodeNumber != stat.Ino {
+		return false
+	}
+	switch oldInode := oldDirent.Inode().(type) {
+	case *filesystem.DirectoryInode:
+		if filesystem.FileMode(stat.Mode) != oldInode.Mode ||
+			stat.Uid != oldInode.Uid || stat.Gid != oldInode.Gid {
+			return false
+		}
+	case *filesystem.RegularInode:
+		inode := makeRegularInode(stat)
+		inode.Hash = oldInode.Hash
+		inode.Xattrs = oldInode.Xattrs
+		if !filesystem.CompareRegularInodes(inode, oldInode, nil) {
+			return false
+		}
+	case *filesystem.SymlinkInode:
+		if stat.Mode&syscall.S_IFMT != syscall.S_IFLNK ||
+			stat.Uid != oldInode.Uid || stat.Gid != oldInode.Gid {
+			return false
+		}
+	case *filesystem.SpecialInode:
+		inode := makeSpecialInode(stat)
+		inode.Xattrs = oldInode.Xattrs
+		if !filesystem.CompareSpecialInodes(inode, oldInode, nil) {
+			return false
+		}
+	default:
+		return false
+	}
+	return fs.addOldInode(oldDirent.InodeNumber, oldDirent.Inode())
+}
+
 func (h simpleHasher) hash(reader io.Reader, length uint64) (hash.Hash, error) {
 	hasher := sha512.New()
 	var hashVal hash.Hash
@@ -393,13 +522,14 @@ func (fs *FileSystem) scanRegularInode(inode *filesystem.RegularInode,
 
 func (fs *FileSystem) scanSymlinkInode(inode *filesystem.SymlinkInode,
 	myPathName string) error {
-	target, err := os.Readlink(path.Join(fs.params.RootDirectoryName,
-		myPathName))
+	pathName := path.Join(fs.params.RootDirectoryName, myPathName)
+	target, err := os.Readlink(pathName)
 	if err != nil {
 		return err
 	}
 	inode.Symlink = target
-	return nil
+	inode.Xattrs, err = filesystem.GetXattrs(pathName)
+	return err
 }
 
 func (l nilLocker) Lock() {}
@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+)
+
+func makeDirtyChecker(dirtyPath string) func(pathname string) bool {
+	return func(pathname string) bool {
+		return pathname == "/" || pathname == dirtyPath ||
+			strings.HasPrefix(pathname, dirtyPath+"/")
+	}
+}
+
+func scanAndCheck(t *testing.T, rootDir string, oldFS *FileSystem,
+	dirtyPath string) *FileSystem {
+	params := Params{
+		OldFS:             oldFS,
+		RootDirectoryName: rootDir,
+	}
+	if dirtyPath != "" {
+		params.IsDirty = makeDirtyChecker(dirtyPath)
+	}
+	fs, err := ScanFileSystemWithParams(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	freshFS, err := ScanFileSystem(rootDir, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filesystem.CompareFileSystems(&fs.FileSystem, &freshFS.FileSystem,
+		nil) {
+		t.Errorf("scan with dirty path: %s differs from fresh scan",
+			dirtyPath)
+	}
+	return fs
+}
+
+func writeFile(t *testing.T, pathname, data string) {
+	if err := os.WriteFile(pathname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHardLinksWithDirtyPaths(t *testing.T) {
+	rootDir := t.TempDir()
+	for _, dirname := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(rootDir, dirname), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(rootDir, "a", "file"), "linked")
+	err := os.Link(filepath.Join(rootDir, "a", "file"),
+		filepath.Join(rootDir, "b", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := scanAndCheck(t, rootDir, nil, "")
+	// The first link is scanned and the second link is copied.
+	writeFile(t, filepath.Join(rootDir, "a", "new"), "new")
+	fs = scanAndCheck(t, rootDir, fs, "/a")
+	// The first link is copied and the second link is scanned.
+	writeFile(t, filepath.Join(rootDir, "b", "new"), "new")
+	fs = scanAndCheck(t, rootDir, fs, "/b")
+	// The linked file is changed via the scanned path.
+	writeFile(t, filepath.Join(rootDir, "a", "file"), "changed")
+	scanAndCheck(t, rootDir, fs, "/a")
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
 )
 
+// The PAX record prefix used by GNU tar and others for extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
 func encode(tarWriter *tar.Writer, fileSystem *filesystem.FileSystem,
 	objectsGetter objectserver.ObjectsGetter) error {
 	hashList := getOrderedObjectsList(fileSystem)
@@ -47,16 +50,28 @@ func listObjects(inode *filesystem.DirectoryInode, hashList *[]hash.Hash,
 	}
 }
 
+func makePaxRecords(xattrs map[string][]byte) map[string]string {
+	if len(xattrs) < 1 {
+		return nil
+	}
+	paxRecords := make(map[string]string, len(xattrs))
+	for name, value := range xattrs {
+		paxRecords[paxXattrPrefix+name] = string(value)
+	}
+	return paxRecords
+}
+
 func writeDirectory(tarWriter *tar.Writer, fileSystem *filesystem.FileSystem,
 	inode *filesystem.DirectoryInode, dirname string,
 	objectsReader objectserver.ObjectsReader,
 	inodeTable map[uint64]struct{}) error {
 	header := tar.Header{
-		Name:     dirname + "/",
-		Mode:     int64(inode.Mode),
-		Uid:      int(inode.Uid),
-		Gid:      int(inode.Gid),
-		Typeflag: tar.TypeDir,
+		Name:       dirname + "/",
+		Mode:       int64(inode.Mode),
+		Uid:        int(inode.Uid),
+		Gid:        int(inode.Gid),
+		Typeflag:   tar.TypeDir,
+		PAXRecords: makePaxRecords(inode.Xattrs),
 	}
 	if err := tarWriter.WriteHeader(&header); err != nil {
 		return err
@@ -77,13 +92,14 @@ func writeRegularFile(tarWriter *tar.Writer, fileSystem *filesystem.FileSystem,
 	objectsReader objectserver.ObjectsReader,
 	inodeTable map[uint64]struct{}) error {
 	header := tar.Header{
-		Name:     name,
-		Mode:     int64(inode.Mode),
-		Uid:      int(inode.Uid),
-		Gid:      int(inode.Gid),
-		Size:     int64(inode.Size),
-		ModTime:  time.Unix(inode.MtimeSeconds, int64(inode.MtimeNanoSeconds)),
-		Typeflag: tar.TypeReg,
+		Name:       name,
+		Mode:       int64(inode.Mode),
+		Uid:        int(inode.Uid),
+		Gid:        int(inode.Gid),
+		Size:       int64(inode.Size),
+		ModTime:    time.Unix(inode.MtimeSeconds, int64(inode.MtimeNanoSeconds)),
+		Typeflag:   tar.TypeReg,
+		PAXRecords: makePaxRecords(inode.Xattrs),
 	}
 	err := writeHeader(tarWriter, fileSystem, &header, inodeNumber,
 		inodeTable)
@@ -115,6 +131,7 @@ func writeHeader(tarWriter *tar.Writer, fileSystem *filesystem.FileSystem,
 	header *tar.Header, inum uint64, inodeTable map[uint64]struct{}) error {
 	if _, ok := inodeTable[inum]; ok {
 		header.Linkname = "." + fileSystem.InodeToFilenamesTable()[inum][0]
+		header.PAXRecords = nil
 		header.Size = 0
 		header.Typeflag = tar.TypeLink
 	} else {
@@ -154,13 +171,14 @@ func writeSpecial(tarWriter *tar.Writer, fileSystem *filesystem.FileSystem,
 	inode *filesystem.SpecialInode, name string, inodeNumber uint64,
 	inodeTable map[uint64]struct{}) error {
 	header := tar.Header{
-		Name:     name,
-		Mode:     int64(inode.Mode),
-		Uid:      int(inode.Uid),
-		Gid:      int(inode.Gid),
-		ModTime:  time.Unix(inode.MtimeSeconds, int64(inode.MtimeNanoSeconds)),
-		Devmajor: int64(inode.Rdev >> 8),
-		Devminor: int64(inode.Rdev & 0xff),
+		Name:       name,
+		Mode:       int64(inode.Mode),
+		Uid:        int(inode.Uid),
+		Gid:        int(inode.Gid),
+		ModTime:    time.Unix(inode.MtimeSeconds, int64(inode.MtimeNanoSeconds)),
+		Devmajor:   int64(inode.Rdev >> 8),
+		Devminor:   int64(inode.Rdev & 0xff),
+		PAXRecords: makePaxRecords(inode.Xattrs),
 	}
 	if inode.Mode&syscall.S_IFMT == syscall.S_IFCHR {
 		header.Typeflag = tar.TypeChar
@@ -178,12 +196,13 @@ func writeSymlink(tarWriter *tar.Writer, fileSystem *filesystem.FileSystem,
 	inode *filesystem.SymlinkInode, name string, inodeNumber uint64,
 	inodeTable map[uint64]struct{}) error {
 	header := tar.Header{
-		Name:     name,
-		Mode:     0777,
-		Uid:      int(inode.Uid),
-		Gid:      int(inode.Gid),
-		Typeflag: tar.TypeSymlink,
-		Linkname: inode.Symlink,
+		Name:       name,
+		Mode:       0777,
+		Uid:        int(inode.Uid),
+		Gid:        int(inode.Gid),
+		Typeflag:   tar.TypeSymlink,
+		Linkname:   inode.Symlink,
+		PAXRecords: makePaxRecords(inode.Xattrs),
 	}
 	return writeHeader(tarWriter, fileSystem, &header, inodeNumber, inodeTable)
 }
@@ -9,6 +9,11 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
 )
 
+const (
+	WhiteoutOpaque = ".wh..wh..opq" // Removes lower entries in a directory.
+	WhiteoutPrefix = ".wh."         // Prefix for a name to remove.
+)
+
 type Hasher interface {
 	Hash(reader io.Reader, length uint64) (hash.Hash, error)
 }
@@ -17,3 +22,20 @@ func Decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 	*filesystem.FileSystem, error) {
 	return decode(tarReader, hasher, filter)
 }
+
+// GetXattrs returns the extended attributes in the PAX records of a tar header
+// which are managed (see filesystem.IsManagedXattr).
+func GetXattrs(header *tar.Header) map[string][]byte {
+	return getXattrs(header)
+}
+
+// DecodeLayers will decode a sequence of layer tarfiles (such as the layers of
+// an OCI or Docker image) into a single file-system. The nextLayer function is
+// called to get each layer in turn, lowest layer first, and should return
+// io.EOF after the last layer. Later layers replace entries in earlier layers
+// and whiteout files (.wh.name and .wh..wh..opq) remove entries from earlier
+// layers.
+func DecodeLayers(nextLayer func() (*tar.Reader, error), hasher Hasher,
+	filter *filter.Filter) (*filesystem.FileSystem, error) {
+	return decodeLayers(nextLayer, hasher, filter)
+}
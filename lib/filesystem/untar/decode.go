@@ -13,7 +13,12 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/wsyscall"
 )
 
+// The PAX record prefix used by GNU tar and others for extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
 type decoderData struct {
+	entryLayers     map[string]int // Only set when decoding layers.
+	layerIndex      int
 	nextInodeNumber uint64
 	fileSystem      filesystem.FileSystem
 	inodeTable      map[string]uint64
@@ -22,6 +27,14 @@ type decoderData struct {
 
 func decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 	*filesystem.FileSystem, error) {
+	decoderData := newDecoderData()
+	if err := decoderData.decodeTar(tarReader, hasher, filter); err != nil {
+		return nil, err
+	}
+	return decoderData.finish(), nil
+}
+
+func newDecoderData() *decoderData {
 	var decoderData decoderData
 	decoderData.inodeTable = make(map[string]uint64)
 	decoderData.directoryTable = make(map[string]*filesystem.DirectoryInode)
@@ -33,13 +46,18 @@ func decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 		wsyscall.S_IRGRP | wsyscall.S_IXGRP | wsyscall.S_IROTH |
 		wsyscall.S_IXOTH
 	decoderData.directoryTable["/"] = &fileSystem.DirectoryInode
+	return &decoderData
+}
+
+func (decoderData *decoderData) decodeTar(tarReader *tar.Reader,
+	hasher Hasher, filter *filter.Filter) error {
 	for {
 		header, err := tarReader.Next()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		header.Name = normaliseFilename(header.Name)
 		if header.Name == "/.subd" ||
@@ -49,16 +67,43 @@ func decode(tarReader *tar.Reader, hasher Hasher, filter *filter.Filter) (
 		if filter != nil && filter.Match(header.Name) {
 			continue
 		}
+		if decoderData.entryLayers != nil {
+			if decoderData.prepareLayerEntry(header) {
+				continue
+			}
+		}
 		err = decoderData.addHeader(tarReader, hasher, header)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+}
+
+func (decoderData *decoderData) finish() *filesystem.FileSystem {
+	fileSystem := &decoderData.fileSystem
 	delete(fileSystem.InodeTable, 0)
 	fileSystem.DirectoryCount = uint64(len(decoderData.directoryTable))
 	fileSystem.ComputeTotalDataBytes()
 	sortDirectory(&fileSystem.DirectoryInode)
-	return fileSystem, nil
+	return fileSystem
+}
+
+func getXattrs(header *tar.Header) map[string][]byte {
+	var xattrs map[string][]byte
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		name := key[len(paxXattrPrefix):]
+		if !filesystem.IsManagedXattr(name) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string][]byte)
+		}
+		xattrs[name] = []byte(value)
+	}
+	return xattrs
 }
 
 func normaliseFilename(filename string) string {
@@ -112,6 +157,7 @@ func (decoderData *decoderData) addRegularFile(tarReader *tar.Reader,
 	newInode.MtimeNanoSeconds = int32(header.ModTime.Nanosecond())
 	newInode.MtimeSeconds = header.ModTime.Unix()
 	newInode.Size = uint64(header.Size)
+	newInode.Xattrs = getXattrs(header)
 	if header.Size > 0 {
 		var err error
 		newInode.Hash, err = hasher.Hash(tarReader, uint64(header.Size))
@@ -130,8 +176,12 @@ func (decoderData *decoderData) addDirectory(header *tar.Header,
 		syscall.S_IFDIR)
 	newInode.Uid = uint32(header.Uid)
 	newInode.Gid = uint32(header.Gid)
-	if header.Name == "/" {
-		*decoderData.directoryTable[header.Name] = newInode
+	newInode.Xattrs = getXattrs(header)
+	if oldInode, ok := decoderData.directoryTable[header.Name]; ok &&
+		(header.Name == "/" || decoderData.entryLayers != nil) {
+		// Update the existing directory, keeping the entries.
+		newInode.EntryList = oldInode.EntryList
+		*oldInode = newInode
 		return nil
 	}
 	decoderData.addEntry(parent, header.Name, name, &newInode)
@@ -147,6 +197,7 @@ func (decoderData *decoderData) addHardlink(header *tar.Header,
 		newEntry.Name = name
 		newEntry.InodeNumber = inum
 		parent.EntryList = append(parent.EntryList, &newEntry)
+		decoderData.inodeTable[header.Name] = inum
 	} else {
 		return fmt.Errorf("missing hardlink target: %s", header.Linkname)
 	}
@@ -159,6 +210,7 @@ func (decoderData *decoderData) addSymlink(header *tar.Header,
 	newInode.Uid = uint32(header.Uid)
 	newInode.Gid = uint32(header.Gid)
 	newInode.Symlink = header.Linkname
+	newInode.Xattrs = getXattrs(header)
 	decoderData.addEntry(parent, header.Name, name, &newInode)
 	return nil
 }
@@ -187,6 +239,7 @@ func (decoderData *decoderData) addSpecialFile(header *tar.Header,
 			header.Devminor)
 	}
 	newInode.Rdev = uint64(header.Devmajor<<8 | header.Devminor)
+	newInode.Xattrs = getXattrs(header)
 	decoderData.addEntry(parent, header.Name, name, &newInode)
 	return nil
 }
@@ -0,0 +1,128 @@
+package untar
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+)
+
+func decodeLayers(nextLayer func() (*tar.Reader, error), hasher Hasher,
+	filter *filter.Filter) (*filesystem.FileSystem, error) {
+	decoderData := newDecoderData()
+	decoderData.entryLayers = make(map[string]int)
+	for ; ; decoderData.layerIndex++ {
+		tarReader, err := nextLayer()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := decoderData.decodeTar(tarReader, hasher, filter); err != nil {
+			return nil, err
+		}
+	}
+	decoderData.pruneInodeTable()
+	return decoderData.finish(), nil
+}
+
+// forgetPath will forget the pathname and everything below it.
+func (decoderData *decoderData) forgetPath(name string,
+	inode filesystem.GenericInode) {
+	delete(decoderData.entryLayers, name)
+	delete(decoderData.inodeTable, name)
+	if dirInode, ok := inode.(*filesystem.DirectoryInode); ok {
+		delete(decoderData.directoryTable, name)
+		for _, entry := range dirInode.EntryList {
+			decoderData.forgetPath(path.Join(name, entry.Name), entry.Inode())
+		}
+	}
+}
+
+// prepareLayerEntry will apply whiteouts and remove an existing entry which
+// will be replaced by the entry for header. It returns true if the header is a
+// whiteout, which should not be added.
+func (decoderData *decoderData) prepareLayerEntry(header *tar.Header) bool {
+	dirname := path.Dir(header.Name)
+	leafName := path.Base(header.Name)
+	if leafName == WhiteoutOpaque {
+		decoderData.removeLowerEntries(dirname)
+		return true
+	}
+	if strings.HasPrefix(leafName, WhiteoutPrefix) {
+		decoderData.removeEntry(
+			path.Join(dirname, leafName[len(WhiteoutPrefix):]))
+		return true
+	}
+	if _, ok := decoderData.inodeTable[header.Name]; ok {
+		_, isDir := decoderData.directoryTable[header.Name]
+		if !isDir || header.Typeflag != tar.TypeDir {
+			decoderData.removeEntry(header.Name)
+		}
+	}
+	decoderData.entryLayers[header.Name] = decoderData.layerIndex
+	return false
+}
+
+// pruneInodeTable will remove inodes which are no longer referenced.
+func (decoderData *decoderData) pruneInodeTable() {
+	referenced := make(map[uint64]struct{})
+	var walk func(dirInode *filesystem.DirectoryInode)
+	walk = func(dirInode *filesystem.DirectoryInode) {
+		for _, entry := range dirInode.EntryList {
+			referenced[entry.InodeNumber] = struct{}{}
+			if inode, ok := entry.Inode().(*filesystem.DirectoryInode); ok {
+				walk(inode)
+			}
+		}
+	}
+	walk(&decoderData.fileSystem.DirectoryInode)
+	for inum := range decoderData.fileSystem.InodeTable {
+		if _, ok := referenced[inum]; !ok && inum != 0 {
+			delete(decoderData.fileSystem.InodeTable, inum)
+		}
+	}
+}
+
+// removeEntry will remove the entry for the pathname and everything below it.
+func (decoderData *decoderData) removeEntry(name string) {
+	parent, ok := decoderData.directoryTable[path.Dir(name)]
+	if !ok {
+		return
+	}
+	leafName := path.Base(name)
+	for index, entry := range parent.EntryList {
+		if entry.Name == leafName {
+			parent.EntryList = append(parent.EntryList[:index],
+				parent.EntryList[index+1:]...)
+			decoderData.forgetPath(name, entry.Inode())
+			return
+		}
+	}
+}
+
+// removeLowerEntries will remove all entries below the directory which were
+// added by lower layers.
+func (decoderData *decoderData) removeLowerEntries(dirname string) {
+	dirInode, ok := decoderData.directoryTable[dirname]
+	if !ok {
+		return
+	}
+	entryList := make([]*filesystem.DirectoryEntry, 0, len(dirInode.EntryList))
+	for _, entry := range dirInode.EntryList {
+		name := path.Join(dirname, entry.Name)
+		if decoderData.entryLayers[name] < decoderData.layerIndex {
+			decoderData.forgetPath(name, entry.Inode())
+			continue
+		}
+		entryList = append(entryList, entry)
+		if _, ok := entry.Inode().(*filesystem.DirectoryInode); ok {
+			decoderData.removeLowerEntries(name)
+		}
+	}
+	dirInode.EntryList = entryList
+}
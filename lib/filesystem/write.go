@@ -48,7 +48,10 @@ func (inode *DirectoryInode) writeMetadata(name string) error {
 	if err := os.Lchown(name, int(inode.Uid), int(inode.Gid)); err != nil {
 		return err
 	}
-	return syscall.Chmod(name, uint32(inode.Mode))
+	if err := syscall.Chmod(name, uint32(inode.Mode)); err != nil {
+		return err
+	}
+	return writeXattrs(name, inode.Xattrs)
 }
 
 func (inode *RegularInode) writeMetadata(name string) error {
@@ -58,6 +61,10 @@ func (inode *RegularInode) writeMetadata(name string) error {
 	if err := syscall.Chmod(name, uint32(inode.Mode)); err != nil {
 		return err
 	}
+	// Must be after changing ownership, which clears file capabilities.
+	if err := writeXattrs(name, inode.Xattrs); err != nil {
+		return err
+	}
 	t := time.Unix(inode.MtimeSeconds, int64(inode.MtimeNanoSeconds))
 	return os.Chtimes(name, t, t)
 }
@@ -77,7 +84,10 @@ func (inode *SymlinkInode) make(name string) error {
 }
 
 func (inode *SymlinkInode) writeMetadata(name string) error {
-	return os.Lchown(name, int(inode.Uid), int(inode.Gid))
+	if err := os.Lchown(name, int(inode.Uid), int(inode.Gid)); err != nil {
+		return err
+	}
+	return writeXattrs(name, inode.Xattrs)
 }
 
 func (inode *SpecialInode) write(name string) error {
@@ -107,6 +117,9 @@ func (inode *SpecialInode) writeMetadata(name string) error {
 	if err := syscall.Chmod(name, uint32(inode.Mode)); err != nil {
 		return err
 	}
+	if err := writeXattrs(name, inode.Xattrs); err != nil {
+		return err
+	}
 	t := time.Unix(inode.MtimeSeconds, int64(inode.MtimeNanoSeconds))
 	return os.Chtimes(name, t, t)
 }
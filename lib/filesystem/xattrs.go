@@ -0,0 +1,130 @@
+package filesystem
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/Cloud-Foundations/Dominator/lib/wsyscall"
+)
+
+// Extended attributes outside these namespaces (such as SELinux labels, IMA
+// and EVM signatures and trusted.*) are managed by the host and are ignored.
+var managedXattrNames = map[string]struct{}{
+	"security.capability":      {},
+	"system.posix_acl_access":  {},
+	"system.posix_acl_default": {},
+}
+
+const managedXattrPrefix = "user."
+
+func compareXattrs(left, right map[string][]byte, logWriter io.Writer) bool {
+	if len(left) != len(right) {
+		if logWriter != nil {
+			fmt.Fprintf(logWriter, "Xattrs: left vs. right: %v vs. %v\n",
+				getXattrNames(left), getXattrNames(right))
+		}
+		return false
+	}
+	for name, leftValue := range left {
+		if rightValue, ok := right[name]; !ok {
+			if logWriter != nil {
+				fmt.Fprintf(logWriter, "Xattr: %s: missing from right\n", name)
+			}
+			return false
+		} else if !bytes.Equal(leftValue, rightValue) {
+			if logWriter != nil {
+				fmt.Fprintf(logWriter, "Xattr: %s: left vs. right: %x vs. %x\n",
+					name, leftValue, rightValue)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func getXattrNames(xattrs map[string][]byte) []string {
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getXattrs(name string) (map[string][]byte, error) {
+	size, err := wsyscall.Llistxattr(name, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size < 1 {
+		return nil, nil
+	}
+	buffer := make([]byte, size)
+	size, err = wsyscall.Llistxattr(name, buffer)
+	if err != nil {
+		return nil, err
+	}
+	xattrs := make(map[string][]byte)
+	for _, attr := range strings.Split(string(buffer[:size]), "\x00") {
+		if !isManagedXattr(attr) {
+			continue
+		}
+		size, err := wsyscall.Lgetxattr(name, attr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error getting xattr: %s: %s", attr, err)
+		}
+		value := make([]byte, size)
+		if size > 0 {
+			size, err = wsyscall.Lgetxattr(name, attr, value)
+			if err != nil {
+				return nil, fmt.Errorf("error getting xattr: %s: %s", attr, err)
+			}
+		}
+		xattrs[attr] = value[:size]
+	}
+	if len(xattrs) < 1 {
+		return nil, nil
+	}
+	return xattrs, nil
+}
+
+func isManagedXattr(name string) bool {
+	if strings.HasPrefix(name, managedXattrPrefix) {
+		return true
+	}
+	_, ok := managedXattrNames[name]
+	return ok
+}
+
+func writeXattrs(name string, xattrs map[string][]byte) error {
+	oldXattrs, err := getXattrs(name)
+	if err != nil {
+		return err
+	}
+	for attr := range oldXattrs {
+		if _, ok := xattrs[attr]; !ok {
+			if err := wsyscall.Lremovexattr(name, attr); err != nil {
+				return fmt.Errorf("error removing xattr: %s: %s", attr, err)
+			}
+		}
+	}
+	for attr, value := range xattrs {
+		if !isManagedXattr(attr) {
+			continue
+		}
+		if oldValue, ok := oldXattrs[attr]; ok && bytes.Equal(value, oldValue) {
+			continue
+		}
+		if err := wsyscall.Lsetxattr(name, attr, value, 0); err != nil {
+			return fmt.Errorf("error setting xattr: %s: %s", attr, err)
+		}
+	}
+	return nil
+}
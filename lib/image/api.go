@@ -1,6 +1,8 @@
 package image
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
@@ -40,16 +42,36 @@ type Image struct {
 	CreatedOn     time.Time
 	ExpiresAt     time.Time
 	Packages      []Package
+	Signature     *Signature
 	SourceImage   string // Name of source image.
 	Tags          tags.Tags
 }
 
+// LoadTrustedSigners will load the PEM encoded certificates of the trusted
+// image signers (or the CAs which issued their certificates) from a file.
+func LoadTrustedSigners(filename string) (*x509.CertPool, error) {
+	return loadTrustedSigners(filename)
+}
+
 type Package struct {
 	Name    string
 	Size    uint64 // Bytes.
 	Version string
 }
 
+type Signature struct {
+	Certificates [][]byte // DER encoded. The first is for the signer.
+	SignedOn     time.Time
+	Value        []byte
+}
+
+// Digest returns the SHA-512 digest of the file-system, triggers, filter and
+// tags for the image. Images with the same content have the same digest,
+// irrespective of how they were encoded or where they were stored.
+func (image *Image) Digest() ([]byte, error) {
+	return image.computeDigest()
+}
+
 // ForEachObject will call objectFunc for all objects (including those for
 // annotations) for the image. If objectFunc returns a non-nil error, processing
 // stops and the error is returned.
@@ -84,12 +106,30 @@ func (image *Image) ReplaceStrings(replaceFunc func(string) string) {
 	image.replaceStrings(replaceFunc)
 }
 
+// Sign will sign the file-system, filter, triggers and tags for the image using
+// the private key for the certificate. The certificate chain is included in the
+// signature.
+func (image *Image) Sign(certificate *tls.Certificate) error {
+	return image.sign(certificate)
+}
+
 // Verify will perform some self-consistency checks on the image. If a problem
 // is found, an error is returned.
 func (image *Image) Verify() error {
 	return image.verify()
 }
 
+// VerifySignature will verify that the image was signed by a certificate
+// issued by one of the trusted signers which was valid when the image was
+// signed and that the file-system, filter, triggers and tags have not been
+// modified since. Images remain valid after the signer certificate expires,
+// so a compromised signer must be removed from the trusted signers. It returns
+// the common name of the signer on success, else an error.
+func (image *Image) VerifySignature(trustedSigners *x509.CertPool) (
+	string, error) {
+	return image.verifySignature(trustedSigners)
+}
+
 func (image *Image) VerifyObjects(checker objectserver.ObjectsChecker) error {
 	return image.verifyObjects(checker)
 }
@@ -0,0 +1,303 @@
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/x509util"
+)
+
+type digestWriter struct {
+	io.Writer
+}
+
+func getSignatureAlgorithm(publicKey crypto.PublicKey) (
+	x509.SignatureAlgorithm, error) {
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return x509.ECDSAWithSHA512, nil
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	case *rsa.PublicKey:
+		return x509.SHA512WithRSA, nil
+	}
+	return x509.UnknownSignatureAlgorithm,
+		fmt.Errorf("unsupported public key type: %T", publicKey)
+}
+
+func loadTrustedSigners(filename string) (*x509.CertPool, error) {
+	certs, _, err := x509util.LoadCertificatePEMs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) < 1 {
+		return nil, errors.New("no certificates in: " + filename)
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// computeDigest returns the SHA-512 digest of the file-system, triggers, filter
+// and tags for the image. The digest does not depend on how the image was
+// encoded or on any computed (cached) data.
+func (image *Image) computeDigest() ([]byte, error) {
+	if image.FileSystem == nil {
+		return nil, errors.New("no file-system")
+	}
+	hasher := sha512.New()
+	writer := &digestWriter{hasher}
+	writer.writeString("filesystem")
+	err := writer.writeDirectory(image.FileSystem,
+		&image.FileSystem.DirectoryInode)
+	if err != nil {
+		return nil, err
+	}
+	writer.writeString("filter")
+	if image.Filter != nil {
+		writer.writeStrings(image.Filter.FilterLines)
+	} else {
+		writer.writeStrings(nil)
+	}
+	writer.writeString("triggers")
+	if image.Triggers != nil {
+		writer.writeUint(uint64(len(image.Triggers.Triggers)))
+		for _, trigger := range image.Triggers.Triggers {
+			writer.writeStrings(trigger.MatchLines)
+			writer.writeString(trigger.Service)
+			writer.writeString(trigger.SortName)
+			writer.writeBool(trigger.DoReboot)
+			writer.writeBool(trigger.HighImpact)
+		}
+	} else {
+		writer.writeUint(0)
+	}
+	writer.writeString("tags")
+	writer.writeTags(image.Tags)
+	return hasher.Sum(nil), nil
+}
+
+// makeSignedData returns the data which are signed: the image digest followed
+// by the signing time.
+func (image *Image) makeSignedData(signedOn time.Time) ([]byte, error) {
+	digest, err := image.computeDigest()
+	if err != nil {
+		return nil, err
+	}
+	return binary.BigEndian.AppendUint64(digest, uint64(signedOn.UnixNano())),
+		nil
+}
+
+func (image *Image) sign(certificate *tls.Certificate) error {
+	return image.signAt(certificate, time.Now())
+}
+
+func (image *Image) signAt(certificate *tls.Certificate,
+	signedOn time.Time) error {
+	if len(certificate.Certificate) < 1 {
+		return errors.New("no certificate")
+	}
+	signer, ok := certificate.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("private key cannot sign")
+	}
+	algorithm, err := getSignatureAlgorithm(signer.Public())
+	if err != nil {
+		return err
+	}
+	data, err := image.makeSignedData(signedOn)
+	if err != nil {
+		return err
+	}
+	var opts crypto.SignerOpts = crypto.SHA512
+	if algorithm == x509.PureEd25519 {
+		opts = crypto.Hash(0)
+	} else {
+		digest := sha512.Sum512(data)
+		data = digest[:]
+	}
+	value, err := signer.Sign(rand.Reader, data, opts)
+	if err != nil {
+		return err
+	}
+	image.Signature = &Signature{
+		Certificates: certificate.Certificate,
+		SignedOn:     signedOn,
+		Value:        value,
+	}
+	return nil
+}
+
+func (image *Image) verifySignature(trustedSigners *x509.CertPool) (
+	string, error) {
+	signature := image.Signature
+	if signature == nil || len(signature.Certificates) < 1 {
+		return "", errors.New("image is not signed")
+	}
+	cert, err := x509.ParseCertificate(signature.Certificates[0])
+	if err != nil {
+		return "", err
+	}
+	intermediates := x509.NewCertPool()
+	for _, derCert := range signature.Certificates[1:] {
+		if intermediate, err := x509.ParseCertificate(derCert); err != nil {
+			return "", err
+		} else {
+			intermediates.AddCert(intermediate)
+		}
+	}
+	// Verify at the signing time (which is covered by the signature), so that
+	// images remain valid after the signer certificate expires.
+	_, err = cert.Verify(x509.VerifyOptions{
+		CurrentTime:   signature.SignedOn,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		Roots:         trustedSigners,
+	})
+	if err != nil {
+		return "", fmt.Errorf("untrusted signer: %s: %s",
+			cert.Subject.CommonName, err)
+	}
+	algorithm, err := getSignatureAlgorithm(cert.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	data, err := image.makeSignedData(signature.SignedOn)
+	if err != nil {
+		return "", err
+	}
+	err = cert.CheckSignature(algorithm, data, signature.Value)
+	if err != nil {
+		return "", fmt.Errorf("bad signature from: %s: %s",
+			cert.Subject.CommonName, err)
+	}
+	return cert.Subject.CommonName, nil
+}
+
+func (w *digestWriter) writeBool(value bool) {
+	if value {
+		w.writeUint(1)
+	} else {
+		w.writeUint(0)
+	}
+}
+
+func (w *digestWriter) writeBytes(value []byte) {
+	w.writeUint(uint64(len(value)))
+	w.Write(value)
+}
+
+func (w *digestWriter) writeDirectory(fs *filesystem.FileSystem,
+	directory *filesystem.DirectoryInode) error {
+	w.writeUint(uint64(directory.Mode))
+	w.writeUint(uint64(directory.Uid))
+	w.writeUint(uint64(directory.Gid))
+	w.writeXattrs(directory.Xattrs)
+	w.writeUint(uint64(len(directory.EntryList)))
+	for _, dirent := range directory.EntryList {
+		w.writeString(dirent.Name)
+		w.writeUint(dirent.InodeNumber)
+		switch inode := fs.InodeTable[dirent.InodeNumber].(type) {
+		case *filesystem.ComputedRegularInode:
+			w.writeString("computed")
+			w.writeUint(uint64(inode.Mode))
+			w.writeUint(uint64(inode.Uid))
+			w.writeUint(uint64(inode.Gid))
+			w.writeString(inode.Source)
+		case *filesystem.DirectoryInode:
+			w.writeString("directory")
+			if err := w.writeDirectory(fs, inode); err != nil {
+				return err
+			}
+		case *filesystem.RegularInode:
+			w.writeString("regular")
+			w.writeUint(uint64(inode.Mode))
+			w.writeUint(uint64(inode.Uid))
+			w.writeUint(uint64(inode.Gid))
+			w.writeUint(uint64(inode.MtimeSeconds))
+			w.writeUint(uint64(inode.MtimeNanoSeconds))
+			w.writeUint(inode.Size)
+			w.Write(inode.Hash[:])
+			w.writeXattrs(inode.Xattrs)
+		case *filesystem.SpecialInode:
+			w.writeString("special")
+			w.writeUint(uint64(inode.Mode))
+			w.writeUint(uint64(inode.Uid))
+			w.writeUint(uint64(inode.Gid))
+			w.writeUint(uint64(inode.MtimeSeconds))
+			w.writeUint(uint64(inode.MtimeNanoSeconds))
+			w.writeUint(inode.Rdev)
+			w.writeXattrs(inode.Xattrs)
+		case *filesystem.SymlinkInode:
+			w.writeString("symlink")
+			w.writeUint(uint64(inode.Uid))
+			w.writeUint(uint64(inode.Gid))
+			w.writeString(inode.Symlink)
+			w.writeXattrs(inode.Xattrs)
+		default:
+			return fmt.Errorf("unsupported inode type: %T for: %s",
+				inode, dirent.Name)
+		}
+	}
+	return nil
+}
+
+func (w *digestWriter) writeString(value string) {
+	w.writeUint(uint64(len(value)))
+	io.WriteString(w, value)
+}
+
+func (w *digestWriter) writeStrings(values []string) {
+	w.writeUint(uint64(len(values)))
+	for _, value := range values {
+		w.writeString(value)
+	}
+}
+
+func (w *digestWriter) writeUint(value uint64) {
+	var buffer [8]byte
+	binary.BigEndian.PutUint64(buffer[:], value)
+	w.Write(buffer[:])
+}
+
+func (w *digestWriter) writeTags(tgs tags.Tags) {
+	names := make([]string, 0, len(tgs))
+	for name := range tgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.writeUint(uint64(len(names)))
+	for _, name := range names {
+		w.writeString(name)
+		w.writeString(tgs[name])
+	}
+}
+
+func (w *digestWriter) writeXattrs(xattrs map[string][]byte) {
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.writeUint(uint64(len(names)))
+	for _, name := range names {
+		w.writeString(name)
+		w.writeBytes(xattrs[name])
+	}
+}
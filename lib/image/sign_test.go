@@ -0,0 +1,211 @@
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+)
+
+type keyGenerator func() (crypto.Signer, error)
+
+func generateEcdsaKey() (crypto.Signer, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func generateEd25519Key() (crypto.Signer, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	return privateKey, err
+}
+
+func generateRsaKey() (crypto.Signer, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+func makeTestSigner(t *testing.T) (*tls.Certificate, *x509.CertPool) {
+	return makeTestSignerWithKey(t, generateEd25519Key,
+		time.Now().Add(time.Hour))
+}
+
+func makeTestSignerWithKey(t *testing.T, generateKey keyGenerator,
+	notAfter time.Time) (*tls.Certificate, *x509.CertPool) {
+	privateKey, err := generateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		NotAfter:              notAfter,
+		NotBefore:             notAfter.Add(-2 * time.Hour),
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "image-signer"},
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, template,
+		privateKey.Public(), privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Certificate{
+		Certificate: [][]byte{derBytes},
+		PrivateKey:  privateKey,
+	}, pool
+}
+
+func makeTestImage() *Image {
+	fs := &filesystem.FileSystem{
+		InodeTable: filesystem.InodeTable{
+			1: &filesystem.DirectoryInode{},
+			2: &filesystem.SymlinkInode{Symlink: "/tmp"},
+		},
+		DirectoryInode: filesystem.DirectoryInode{
+			EntryList: []*filesystem.DirectoryEntry{
+				{
+					Name:        "dir0",
+					InodeNumber: 1,
+				},
+				{
+					Name:        "link0",
+					InodeNumber: 2,
+				},
+			},
+		},
+	}
+	fs.RebuildInodePointers()
+	return &Image{FileSystem: fs}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	cert, pool := makeTestSigner(t)
+	img := makeTestImage()
+	if _, err := img.VerifySignature(pool); err == nil {
+		t.Fatal("unsigned image verified")
+	}
+	if err := img.Sign(cert); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := img.VerifySignature(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != "image-signer" {
+		t.Errorf("signer: %s != image-signer", signer)
+	}
+	img.FileSystem.InodeTable[2].(*filesystem.SymlinkInode).Symlink = "/var"
+	if _, err := img.VerifySignature(pool); err == nil {
+		t.Error("modified image verified")
+	}
+	_, untrustedPool := makeTestSigner(t)
+	img = makeTestImage()
+	if err := img.Sign(cert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := img.VerifySignature(untrustedPool); err == nil {
+		t.Error("image verified with untrusted signer")
+	}
+}
+
+func TestSignAndVerifyKeyTypes(t *testing.T) {
+	keyGenerators := map[string]keyGenerator{
+		"ECDSA":   generateEcdsaKey,
+		"Ed25519": generateEd25519Key,
+		"RSA":     generateRsaKey,
+	}
+	for name, generateKey := range keyGenerators {
+		cert, pool := makeTestSignerWithKey(t, generateKey,
+			time.Now().Add(time.Hour))
+		img := makeTestImage()
+		if err := img.Sign(cert); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, err := img.VerifySignature(pool); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		img.FileSystem.InodeTable[2].(*filesystem.SymlinkInode).Symlink = "/var"
+		if _, err := img.VerifySignature(pool); err == nil {
+			t.Errorf("%s: modified image verified", name)
+		}
+	}
+}
+
+func TestVerifyExpiredSigner(t *testing.T) {
+	cert, pool := makeTestSignerWithKey(t, generateEd25519Key,
+		time.Now().Add(-time.Hour))
+	img := makeTestImage()
+	if err := img.Sign(cert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := img.VerifySignature(pool); err == nil {
+		t.Error("image verified with expired signer")
+	}
+}
+
+func TestVerifyAfterSignerExpired(t *testing.T) {
+	cert, pool := makeTestSignerWithKey(t, generateEd25519Key,
+		time.Now().Add(-time.Hour))
+	img := makeTestImage()
+	// Signed while the signer was valid.
+	if err := img.signAt(cert, time.Now().Add(-90*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := img.VerifySignature(pool); err != nil {
+		t.Errorf("image signed before signer expired not verified: %s", err)
+	}
+}
+
+func TestVerifyTamperedImage(t *testing.T) {
+	cert, pool := makeTestSigner(t)
+	tamperers := map[string]func(img *Image){
+		"file-system": func(img *Image) {
+			img.FileSystem.InodeTable[1].(*filesystem.DirectoryInode).Mode = 0777
+		},
+		"signed-on": func(img *Image) {
+			img.Signature.SignedOn = img.Signature.SignedOn.Add(-time.Second)
+		},
+		"tags": func(img *Image) {
+			img.Tags["HealthCheckCommand"] = "/bin/false"
+		},
+		"triggers": func(img *Image) {
+			img.Triggers.Triggers[0].DoReboot = true
+		},
+	}
+	for name, tamper := range tamperers {
+		img := makeTestImage()
+		img.Tags = tags.Tags{"HealthCheckCommand": "/bin/true"}
+		img.Triggers = &triggers.Triggers{
+			Triggers: []*triggers.Trigger{{
+				MatchLines: []string{"/etc/ssh/.*"},
+				Service:    "sshd",
+			}},
+		}
+		if err := img.Sign(cert); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := img.VerifySignature(pool); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		tamper(img)
+		if _, err := img.VerifySignature(pool); err == nil {
+			t.Errorf("image with modified %s verified", name)
+		}
+	}
+}
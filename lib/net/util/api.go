@@ -52,6 +52,13 @@ func GetDefaultRoute() (*DefaultRouteInfo, error) {
 	return getDefaultRoute()
 }
 
+// GetEui64MacAddress returns the MAC address encoded in the interface
+// identifier of an IPv6 address which was generated using the modified EUI-64
+// format. If the address does not contain a MAC address, nil is returned.
+func GetEui64MacAddress(ip net.IP) net.HardwareAddr {
+	return getEui64MacAddress(ip)
+}
+
 func GetMyIP() (net.IP, error) {
 	return getMyIP()
 }
@@ -72,6 +79,14 @@ func InvertIP(input net.IP) {
 	invertIP(input)
 }
 
+// MakeEui64Address returns the IPv6 address in the /64 prefix with the
+// interface identifier generated from the MAC address using the modified
+// EUI-64 format, as used for stateless address autoconfiguration (SLAAC).
+func MakeEui64Address(prefix net.IP, macAddr net.HardwareAddr) (
+	net.IP, error) {
+	return makeEui64Address(prefix, macAddr)
+}
+
 func ShrinkIP(netIP net.IP) net.IP {
 	return shrinkIP(netIP)
 }
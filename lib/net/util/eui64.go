@@ -0,0 +1,37 @@
+package util
+
+import (
+	"errors"
+	"net"
+)
+
+func getEui64MacAddress(ip net.IP) net.HardwareAddr {
+	if len(ip) != net.IPv6len || ip.To4() != nil {
+		return nil
+	}
+	if ip[11] != 0xff || ip[12] != 0xfe {
+		return nil
+	}
+	return net.HardwareAddr{ip[8] ^ 0x02, ip[9], ip[10], ip[13], ip[14], ip[15]}
+}
+
+func makeEui64Address(prefix net.IP, macAddr net.HardwareAddr) (
+	net.IP, error) {
+	if len(macAddr) != 6 {
+		return nil, errors.New("MAC address is not EUI-48")
+	}
+	if len(prefix) != net.IPv6len || prefix.To4() != nil {
+		return nil, errors.New("prefix is not IPv6")
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix[:8])
+	ip[8] = macAddr[0] ^ 0x02 // Flip the universal/local bit.
+	ip[9] = macAddr[1]
+	ip[10] = macAddr[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = macAddr[3]
+	ip[14] = macAddr[4]
+	ip[15] = macAddr[5]
+	return ip, nil
+}
@@ -56,6 +56,17 @@ type ObjectsRefcounter interface {
 	ListUnreferenced() map[hash.Hash]uint64
 }
 
+// CompressedObjectsReader is an optional interface for an ObjectsReader which
+// can yield objects which are stored compressed without decompressing them.
+// If the next object is stored compressed with the specified method, the
+// complete compressed stream is yielded and the boolean is true, else the
+// uncompressed object data are yielded. The object size is always the
+// uncompressed size.
+type CompressedObjectsReader interface {
+	ObjectsReader
+	NextCompressedObject(method string) (uint64, io.ReadCloser, bool, error)
+}
+
 type FullObjectsReader interface {
 	ObjectsReader
 	ObjectSizes() []uint64
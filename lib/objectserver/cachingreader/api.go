@@ -42,6 +42,10 @@ type Params struct {
 	MaximumCachedBytes  uint64               // Default: 1GiB.
 	ObjectClient        *client.ObjectClient // Exclusive of ObjectServerAddress
 	ObjectServerAddress string               // Exclusive of ObjectClient.
+	// ObjectsGetter is an alternative upstream source of objects, exclusive of
+	// ObjectClient and ObjectServerAddress. The ObjectsReader it returns must
+	// implement objectserver.FullObjectsReader.
+	ObjectsGetter objectserver.ObjectsGetter
 }
 
 type Stats struct {
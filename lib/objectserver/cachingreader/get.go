@@ -109,12 +109,17 @@ func (objSrv *ObjectServer) getObjects(hashes []hash.Hash) (
 	if len(hashesToFetch) < 1 {
 		return &or, nil
 	}
-	objectClient := objSrv.params.ObjectClient
-	if objectClient == nil {
-		objectClient = client.NewObjectClient(objSrv.params.ObjectServerAddress)
-		or.objectClient = objectClient
+	var objectsGetter objectserver.ObjectsGetter
+	if objSrv.params.ObjectsGetter != nil {
+		objectsGetter = objSrv.params.ObjectsGetter
+	} else if objSrv.params.ObjectClient != nil {
+		objectsGetter = objSrv.params.ObjectClient
+	} else {
+		or.objectClient = client.NewObjectClient(
+			objSrv.params.ObjectServerAddress)
+		objectsGetter = or.objectClient
 	}
-	if realOR, err := objectClient.GetObjects(hashesToFetch); err != nil {
+	if realOR, err := objectsGetter.GetObjects(hashesToFetch); err != nil {
 		or.Close()
 		return nil, err
 	} else {
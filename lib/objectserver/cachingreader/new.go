@@ -17,6 +17,10 @@ func newObjectServer(params Params) (*ObjectServer, error) {
 	if params.ObjectClient != nil && params.ObjectServerAddress != "" {
 		return nil, errors.New("cannot specify object client and address")
 	}
+	if params.ObjectsGetter != nil &&
+		(params.ObjectClient != nil || params.ObjectServerAddress != "") {
+		return nil, errors.New("cannot specify objects getter and client")
+	}
 	startTime := time.Now()
 	var rusageStart, rusageStop syscall.Rusage
 	syscall.Getrusage(syscall.RUSAGE_SELF, &rusageStart)
@@ -5,21 +5,29 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/compression"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
 )
 
 type ObjectClient struct {
 	address      string
 	client       srpc.ClientI
+	compressions []string
 	exclusiveGet bool
 }
 
 func NewObjectClient(address string) *ObjectClient {
-	return &ObjectClient{address: address}
+	return &ObjectClient{
+		address:      address,
+		compressions: compression.SupportedMethods(),
+	}
 }
 
 func AttachObjectClient(client srpc.ClientI) *ObjectClient {
-	return &ObjectClient{client: client}
+	return &ObjectClient{
+		client:       client,
+		compressions: compression.SupportedMethods(),
+	}
 }
 
 func (objClient *ObjectClient) AddObject(reader io.Reader, length uint64,
@@ -46,15 +54,24 @@ func (objClient *ObjectClient) GetObjects(hashes []hash.Hash) (
 	return objClient.getObjects(hashes)
 }
 
+// SetCompressions sets the compression methods which will be accepted by
+// GetObjects, in order of preference. The default is all supported methods. If
+// methods is empty, objects will be transferred uncompressed.
+func (objClient *ObjectClient) SetCompressions(methods []string) {
+	objClient.compressions = methods
+}
+
 func (objClient *ObjectClient) SetExclusiveGetObjects(exclusive bool) {
 	objClient.exclusiveGet = exclusive
 }
 
 type ObjectsReader struct {
-	sizes     []uint64
-	client    *ObjectClient
-	reader    *srpc.Conn
-	nextIndex int64
+	sizes          []uint64
+	client         *ObjectClient
+	compression    string
+	previousObject io.Closer
+	reader         *srpc.Conn
+	nextIndex      int64
 }
 
 func (or *ObjectsReader) Close() error {
@@ -7,9 +7,21 @@ import (
 	"io/ioutil"
 
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/compression"
 	"github.com/Cloud-Foundations/Dominator/proto/objectserver"
 )
 
+type compressedReader struct {
+	chunkReader   *compression.ChunkReader
+	closed        bool
+	decompressor  io.ReadCloser
+	limitedReader io.LimitedReader
+}
+
+type uncompressedReader struct {
+	io.LimitedReader
+}
+
 func (objClient *ObjectClient) getObjects(hashes []hash.Hash) (
 	*ObjectsReader, error) {
 	client, err := objClient.getClient()
@@ -22,6 +34,7 @@ func (objClient *ObjectClient) getObjects(hashes []hash.Hash) (
 	}
 	var request objectserver.GetObjectsRequest
 	var reply objectserver.GetObjectsResponse
+	request.Compressions = objClient.compressions
 	request.Exclusive = objClient.exclusiveGet
 	request.Hashes = hashes
 	conn.Encode(request)
@@ -36,6 +49,7 @@ func (objClient *ObjectClient) getObjects(hashes []hash.Hash) (
 	if reply.ResponseString != "" {
 		return nil, errors.New(reply.ResponseString)
 	}
+	objectsReader.compression = reply.Compression
 	objectsReader.nextIndex = -1
 	objectsReader.sizes = reply.ObjectSizes
 	return &objectsReader, nil
@@ -51,6 +65,66 @@ func (or *ObjectsReader) nextObject() (uint64, io.ReadCloser, error) {
 		return 0, nil, errors.New("all objects have been consumed")
 	}
 	size := or.sizes[or.nextIndex]
-	return size,
-		ioutil.NopCloser(&io.LimitedReader{R: or.reader, N: int64(size)}), nil
+	if or.compression == "" {
+		return size,
+			ioutil.NopCloser(&io.LimitedReader{R: or.reader, N: int64(size)}),
+			nil
+	}
+	// Objects are framed: consume the remainder of the previous object.
+	if or.previousObject != nil {
+		err := or.previousObject.Close()
+		or.previousObject = nil
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	flag, err := or.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch flag {
+	case objectserver.GetObjectsFlagUncompressed:
+		reader := &uncompressedReader{
+			LimitedReader: io.LimitedReader{R: or.reader, N: int64(size)},
+		}
+		or.previousObject = reader
+		return size, reader, nil
+	case objectserver.GetObjectsFlagCompressed:
+		chunkReader := compression.NewChunkReader(or.reader)
+		decompressor, err := compression.NewReader(or.compression, chunkReader)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader := &compressedReader{
+			chunkReader:  chunkReader,
+			decompressor: decompressor,
+			limitedReader: io.LimitedReader{
+				R: decompressor,
+				N: int64(size),
+			},
+		}
+		or.previousObject = reader
+		return size, reader, nil
+	}
+	return 0, nil, fmt.Errorf("unknown object flag: %d", flag)
+}
+
+// Close will release the decompressor and discard unread data.
+func (r *compressedReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.decompressor.Close()
+	return r.chunkReader.Discard()
+}
+
+func (r *compressedReader) Read(p []byte) (int, error) {
+	return r.limitedReader.Read(p)
+}
+
+// Close will discard unread data.
+func (r *uncompressedReader) Close() error {
+	_, err := io.Copy(ioutil.Discard, &r.LimitedReader)
+	return err
 }
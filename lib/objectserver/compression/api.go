@@ -0,0 +1,88 @@
+package compression
+
+import (
+	"io"
+)
+
+// Supported compression methods.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// ChunkReader reads a stream of chunks written by a ChunkWriter. It yields the
+// concatenated chunk data and returns io.EOF when the terminating chunk is
+// read. It never reads beyond the terminating chunk.
+type ChunkReader struct {
+	reader    io.Reader
+	remaining uint32
+	done      bool
+}
+
+// NewChunkReader creates a ChunkReader which reads chunks from reader.
+func NewChunkReader(reader io.Reader) *ChunkReader {
+	return &ChunkReader{reader: reader}
+}
+
+// Discard will read and discard any remaining data up to and including the
+// terminating chunk.
+func (r *ChunkReader) Discard() error {
+	return r.discard()
+}
+
+func (r *ChunkReader) Read(p []byte) (int, error) {
+	return r.read(p)
+}
+
+// ChunkWriter writes data as a stream of length-prefixed chunks, so that a
+// self-delimiting stream may be embedded in a connection shared with other
+// data. Close must be called to write the terminating chunk. It does not close
+// the underlying writer.
+type ChunkWriter struct {
+	writer io.Writer
+}
+
+// NewChunkWriter creates a ChunkWriter which writes chunks to writer.
+func NewChunkWriter(writer io.Writer) *ChunkWriter {
+	return &ChunkWriter{writer: writer}
+}
+
+func (w *ChunkWriter) Close() error {
+	return w.close()
+}
+
+func (w *ChunkWriter) Write(p []byte) (int, error) {
+	return w.write(p)
+}
+
+// Compress returns data compressed as a complete stream using the specified
+// method. It favours compression ratio over speed and is intended for data
+// which are stored.
+func Compress(method string, data []byte) ([]byte, error) {
+	return compress(method, data)
+}
+
+// IsSupported returns true if the specified compression method is supported.
+func IsSupported(method string) bool {
+	return isSupported(method)
+}
+
+// NewReader returns a reader which decompresses a stream read from reader
+// using the specified method. The reader must be closed to release resources.
+func NewReader(method string, reader io.Reader) (io.ReadCloser, error) {
+	return newReader(method, reader)
+}
+
+// NewWriter returns a writer which compresses a stream to writer using the
+// specified method. It favours speed over compression ratio and is intended
+// for compressing data on the fly. The writer must be closed to flush the
+// stream and release resources. It does not close the underlying writer.
+func NewWriter(method string, writer io.Writer) (io.WriteCloser, error) {
+	return newWriter(method, writer)
+}
+
+// SupportedMethods returns the supported compression methods, in order of
+// preference.
+func SupportedMethods() []string {
+	return []string{Zstd, Gzip}
+}
@@ -0,0 +1,70 @@
+package compression
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const maxChunkSize = 1 << 20
+
+func (r *ChunkReader) discard() error {
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func (r *ChunkReader) read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	if r.remaining < 1 {
+		var header [4]byte
+		if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		r.remaining = binary.BigEndian.Uint32(header[:])
+		if r.remaining < 1 {
+			r.done = true
+			return 0, io.EOF
+		}
+	}
+	if uint32(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	nRead, err := r.reader.Read(p)
+	r.remaining -= uint32(nRead)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nRead, err
+}
+
+func (w *ChunkWriter) close() error {
+	var header [4]byte
+	_, err := w.writer.Write(header[:])
+	return err
+}
+
+func (w *ChunkWriter) write(p []byte) (int, error) {
+	var nWritten int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxChunkSize {
+			chunk = chunk[:maxChunkSize]
+		}
+		var header [4]byte
+		binary.BigEndian.PutUint32(header[:], uint32(len(chunk)))
+		if _, err := w.writer.Write(header[:]); err != nil {
+			return nWritten, err
+		}
+		nChunk, err := w.writer.Write(chunk)
+		nWritten += nChunk
+		if err != nil {
+			return nWritten, err
+		}
+		p = p[len(chunk):]
+	}
+	return nWritten, nil
+}
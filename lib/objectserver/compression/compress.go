@@ -0,0 +1,150 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipWriterPool  sync.Pool
+	zstdDecoderPool sync.Pool
+	zstdEncoderPool sync.Pool
+
+	zstdStoreEncoder     *zstd.Encoder
+	zstdStoreEncoderErr  error
+	zstdStoreEncoderOnce sync.Once
+)
+
+type gzipWriter struct {
+	*gzip.Writer
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+}
+
+func compress(method string, data []byte) ([]byte, error) {
+	switch method {
+	case Gzip:
+		buffer := &bytes.Buffer{}
+		writer, err := gzip.NewWriterLevel(buffer, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case Zstd:
+		zstdStoreEncoderOnce.Do(func() {
+			zstdStoreEncoder, zstdStoreEncoderErr = zstd.NewWriter(nil,
+				zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+		})
+		if zstdStoreEncoderErr != nil {
+			return nil, zstdStoreEncoderErr
+		}
+		return zstdStoreEncoder.EncodeAll(data, nil), nil
+	}
+	return nil, unsupportedError(method)
+}
+
+func isSupported(method string) bool {
+	switch method {
+	case Gzip, Zstd:
+		return true
+	}
+	return false
+}
+
+func newReader(method string, reader io.Reader) (io.ReadCloser, error) {
+	switch method {
+	case Gzip:
+		return gzip.NewReader(reader)
+	case Zstd:
+		if decoder, ok := zstdDecoderPool.Get().(*zstd.Decoder); ok {
+			if err := decoder.Reset(reader); err != nil {
+				decoder.Close()
+				return nil, err
+			}
+			return &zstdReader{decoder}, nil
+		}
+		decoder, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{decoder}, nil
+	}
+	return nil, unsupportedError(method)
+}
+
+func newWriter(method string, writer io.Writer) (io.WriteCloser, error) {
+	switch method {
+	case Gzip:
+		if compressor, ok := gzipWriterPool.Get().(*gzip.Writer); ok {
+			compressor.Reset(writer)
+			return &gzipWriter{compressor}, nil
+		}
+		compressor, err := gzip.NewWriterLevel(writer, gzip.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		return &gzipWriter{compressor}, nil
+	case Zstd:
+		if encoder, ok := zstdEncoderPool.Get().(*zstd.Encoder); ok {
+			encoder.Reset(writer)
+			return &zstdWriter{encoder}, nil
+		}
+		encoder, err := zstd.NewWriter(writer,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdWriter{encoder}, nil
+	}
+	return nil, unsupportedError(method)
+}
+
+func unsupportedError(method string) error {
+	return fmt.Errorf("unsupported compression method: \"%s\"", method)
+}
+
+func (w *gzipWriter) Close() error {
+	err := w.Writer.Close()
+	if err == nil {
+		gzipWriterPool.Put(w.Writer)
+	}
+	w.Writer = nil
+	return err
+}
+
+func (r *zstdReader) Close() error {
+	if err := r.Decoder.Reset(nil); err != nil {
+		r.Decoder.Close()
+	} else {
+		zstdDecoderPool.Put(r.Decoder)
+	}
+	r.Decoder = nil
+	return nil
+}
+
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	if err == nil {
+		zstdEncoderPool.Put(w.Encoder)
+	}
+	w.Encoder = nil
+	return err
+}
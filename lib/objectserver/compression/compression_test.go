@@ -0,0 +1,85 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestChunkedCompressedStreams(t *testing.T) {
+	objects := [][]byte{
+		bytes.Repeat([]byte("first object "), 10000),
+		[]byte("second object"),
+		make([]byte, 3*maxChunkSize),
+	}
+	for _, method := range SupportedMethods() {
+		buffer := &bytes.Buffer{}
+		for _, object := range objects {
+			chunkWriter := NewChunkWriter(buffer)
+			writer, err := NewWriter(method, chunkWriter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := writer.Write(object); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := chunkWriter.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		buffer.WriteString("trailer")
+		for index, object := range objects {
+			chunkReader := NewChunkReader(buffer)
+			reader, err := NewReader(method, chunkReader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := make([]byte, len(object))
+			if _, err := io.ReadFull(reader, data); err != nil {
+				t.Fatalf("%s: object: %d: %s", method, index, err)
+			}
+			reader.Close()
+			if err := chunkReader.Discard(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, object) {
+				t.Errorf("%s: object: %d: content mismatch", method, index)
+			}
+		}
+		if buffer.String() != "trailer" {
+			t.Errorf("%s: stream not delimited: %d bytes remaining",
+				method, buffer.Len())
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("stored object "), 1000)
+	for _, method := range SupportedMethods() {
+		compressedData, err := Compress(method, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compressedData) >= len(data) {
+			t.Errorf("%s: not compressed", method)
+		}
+		reader, err := NewReader(method, bytes.NewReader(compressedData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(result, data) {
+			t.Errorf("%s: content mismatch", method)
+		}
+	}
+	if _, err := Compress("bogus", data); err == nil {
+		t.Error("no error for unsupported method")
+	}
+}
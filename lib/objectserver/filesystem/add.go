@@ -92,7 +92,7 @@ func (objSrv *ObjectServer) addOrCompareOnce(hashVal hash.Hash, data []byte,
 		if !fi.Mode().IsRegular() {
 			return false, errors.New("existing non-file: " + filename)
 		}
-		if err := collisionCheck(data, filename, fi.Size()); err != nil {
+		if err := objSrv.collisionCheck(data, filename); err != nil {
 			return false, errors.New("collision detected: " + err.Error())
 		}
 		// No collision and no error: it's the same object. Go home early.
@@ -106,21 +106,29 @@ func (objSrv *ObjectServer) addOrCompareOnce(hashVal hash.Hash, data []byte,
 	if err != nil {
 		return false, err
 	}
+	storedData := data
+	if objSrv.haveHeaders {
+		storedData, err = encodeObject(data, objSrv.compressionMethod,
+			objSrv.Compression)
+		if err != nil {
+			return false, err
+		}
+	}
 	err = fsutil.CopyToFileExclusive(filename, fsutil.PrivateFilePerms,
-		bytes.NewReader(data), uint64(len(data)))
+		bytes.NewReader(storedData), uint64(len(storedData)))
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-func collisionCheck(data []byte, filename string, size int64) error {
-	file, err := os.Open(filename)
+func (objSrv *ObjectServer) collisionCheck(data []byte, filename string) error {
+	size, file, err := objSrv.openObjectFile(filename)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	if int64(len(data)) != size {
+	if uint64(len(data)) != size {
 		return fmt.Errorf("length mismatch. Data=%d, existing object=%d",
 			len(data), size)
 	}
@@ -132,7 +140,7 @@ func collisionCheck(data []byte, filename string, size int64) error {
 			numToRead = cap(buffer)
 		}
 		buf := buffer[:numToRead]
-		nread, err := reader.Read(buf)
+		nread, err := io.ReadFull(reader, buf)
 		if err != nil {
 			return err
 		}
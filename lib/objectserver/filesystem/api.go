@@ -22,8 +22,9 @@ var (
 		90, "")
 	objectServerCleanupStopSize flagutil.Size
 
-	// Interface check.
-	_ objectserver.FullObjectServer = (*ObjectServer)(nil)
+	// Interface checks.
+	_ objectserver.CompressedObjectsReader = (*ObjectsReader)(nil)
+	_ objectserver.FullObjectServer        = (*ObjectServer)(nil)
 )
 
 func init() {
@@ -39,8 +40,19 @@ type objectType struct {
 	size              uint64
 }
 
+// CompressionConfig specifies how objects are compressed when written to the
+// store. Objects smaller than MinimumSize (default 4 KiB) are stored raw, as
+// are objects where the compressed size is more than MaximumRatio (default 0.9)
+// of the uncompressed size.
+type CompressionConfig struct {
+	Method       string // "" or "none", "gzip" or "zstd".
+	MaximumRatio float64
+	MinimumSize  uint64
+}
+
 type Config struct {
 	BaseDirectory     string
+	Compression       CompressionConfig
 	LockCheckInterval time.Duration
 	LockLogTimeout    time.Duration
 }
@@ -48,8 +60,10 @@ type Config struct {
 type ObjectServer struct {
 	addCallback objectserver.AddCallback
 	Config
-	gc          objectserver.GarbageCollector
-	lockWatcher *lockwatcher.LockWatcher
+	compressionMethod uint8
+	gc                objectserver.GarbageCollector
+	haveHeaders       bool // True if objects may have headers.
+	lockWatcher       *lockwatcher.LockWatcher
 	Params
 	rwLock                sync.RWMutex // Protect the following fields.
 	duplicatedBytes       uint64       // Sum of refcount*size for all objects.
@@ -70,6 +84,15 @@ type Params struct {
 	Logger log.DebugLogger
 }
 
+// ConvertStore will convert all the objects in the store at baseDir to use the
+// specified compression configuration. Objects are decompressed and verified
+// before being re-encoded, and files are replaced atomically, so the conversion
+// may be safely interrupted and restarted. The store must not be in use.
+func ConvertStore(baseDir string, config CompressionConfig,
+	logger log.DebugLogger) error {
+	return convertStore(baseDir, config, logger)
+}
+
 func NewObjectServer(baseDir string, logger log.Logger) (
 	*ObjectServer, error) {
 	return newObjectServer(
@@ -206,6 +229,11 @@ func (or *ObjectsReader) NextObject() (uint64, io.ReadCloser, error) {
 	return or.nextObject()
 }
 
+func (or *ObjectsReader) NextCompressedObject(method string) (
+	uint64, io.ReadCloser, bool, error) {
+	return or.nextCompressedObject(method)
+}
+
 func (or *ObjectsReader) ObjectSizes() []uint64 {
 	return or.sizes
 }
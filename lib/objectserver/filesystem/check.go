@@ -38,7 +38,7 @@ func (objSrv *ObjectServer) checkObject(hashVal hash.Hash) (uint64, error) {
 		if fi.Size() < 1 {
 			return 0, fmt.Errorf("zero length file: %s", filename)
 		}
-		return uint64(fi.Size()), nil
+		return objSrv.readObjectSize(filename, uint64(fi.Size()))
 	}
 	return 0, nil
 }
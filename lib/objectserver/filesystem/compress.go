@@ -0,0 +1,344 @@
+package filesystem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/compression"
+)
+
+// Objects may be stored with a header, which has the following layout:
+//
+//	magic number (8 bytes)
+//	compression method (1 byte)
+//	uncompressed size (8 bytes, little endian)
+//
+// Headers are only recognised if the store contains the marker file, so stores
+// which have never had compression enabled are read exactly as before. Once
+// the marker exists, raw objects which start with the magic number are written
+// with a header (and compressionNone), so that they cannot be misinterpreted.
+const (
+	compressionHeaderSize = 17
+	compressionMarkerFile = ".compressed"
+
+	compressionNone = 0
+	compressionGzip = 1
+	compressionZstd = 2
+
+	defaultCompressionMaximumRatio = 0.9
+	defaultCompressionMinimumSize  = 4096
+)
+
+var compressionMagic = []byte{0xfd, 'D', 'o', 'm', 'O', 'b', 'j', 0x1a}
+
+type compressedReaderType struct {
+	decompressor io.ReadCloser
+	file         *os.File
+}
+
+func compressData(method uint8, data []byte) ([]byte, error) {
+	return compression.Compress(compressionMethodToString(method), data)
+}
+
+func compressionMethodToString(method uint8) string {
+	switch method {
+	case compressionNone:
+		return "none"
+	case compressionGzip:
+		return "gzip"
+	case compressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("unknown(%d)", method)
+}
+
+// decodeHeader returns the compression method and uncompressed size if header
+// is a valid object header, else ok is false.
+func decodeHeader(header []byte) (uint8, uint64, bool) {
+	if len(header) < compressionHeaderSize {
+		return 0, 0, false
+	}
+	if !bytes.Equal(header[:len(compressionMagic)], compressionMagic) {
+		return 0, 0, false
+	}
+	method := header[len(compressionMagic)]
+	switch method {
+	case compressionNone, compressionGzip, compressionZstd:
+	default:
+		return 0, 0, false
+	}
+	return method, binary.LittleEndian.Uint64(header[len(compressionMagic)+1:]),
+		true
+}
+
+func encodeHeader(method uint8, size uint64) []byte {
+	header := make([]byte, compressionHeaderSize)
+	copy(header, compressionMagic)
+	header[len(compressionMagic)] = method
+	binary.LittleEndian.PutUint64(header[len(compressionMagic)+1:], size)
+	return header
+}
+
+// encodeObject returns the data to write to the file for an object, given the
+// compression method and heuristics.
+func encodeObject(data []byte, method uint8,
+	config CompressionConfig) ([]byte, error) {
+	minimumSize := config.MinimumSize
+	if minimumSize < 1 {
+		minimumSize = defaultCompressionMinimumSize
+	}
+	maximumRatio := config.MaximumRatio
+	if maximumRatio <= 0 {
+		maximumRatio = defaultCompressionMaximumRatio
+	}
+	if method != compressionNone && uint64(len(data)) >= minimumSize {
+		compressedData, err := compressData(method, data)
+		if err != nil {
+			return nil, err
+		}
+		storedSize := len(compressedData) + compressionHeaderSize
+		if float64(storedSize) <= maximumRatio*float64(len(data)) {
+			header := encodeHeader(method, uint64(len(data)))
+			return append(header, compressedData...), nil
+		}
+	}
+	if bytes.HasPrefix(data, compressionMagic) {
+		header := encodeHeader(compressionNone, uint64(len(data)))
+		return append(header, data...), nil
+	}
+	return data, nil
+}
+
+// isEscapedObject returns true if header is for an uncompressed object with a
+// header and the file size is consistent with that.
+func isEscapedObject(header []byte, fileSize uint64) bool {
+	method, size, ok := decodeHeader(header)
+	return ok && method == compressionNone &&
+		size+compressionHeaderSize == fileSize
+}
+
+func markerExists(baseDir string) bool {
+	_, err := os.Stat(path.Join(baseDir, compressionMarkerFile))
+	return err == nil
+}
+
+// decodeObject returns the uncompressed data for the stored object data.
+func decodeObject(storedData []byte) ([]byte, error) {
+	method, size, ok := decodeHeader(storedData)
+	if !ok {
+		return storedData, nil
+	}
+	storedData = storedData[compressionHeaderSize:]
+	if method == compressionNone {
+		if uint64(len(storedData)) != size {
+			return nil, fmt.Errorf("length mismatch: header=%d, data=%d",
+				size, len(storedData))
+		}
+		return storedData, nil
+	}
+	decompressor, err := newDecompressor(method, bytes.NewReader(storedData))
+	if err != nil {
+		return nil, err
+	}
+	defer decompressor.Close()
+	data := make([]byte, size)
+	if _, err := io.ReadFull(decompressor, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func newDecompressor(method uint8, reader io.Reader) (io.ReadCloser, error) {
+	return compression.NewReader(compressionMethodToString(method), reader)
+}
+
+// openObjectFile opens an object file and returns the uncompressed size and a
+// reader. If the object is stored compressed with rawMethod, the compressed
+// stream is yielded and the boolean is true, else the object data are yielded.
+func openObjectFile(filename string, haveHeaders bool, rawMethod string) (
+	uint64, io.ReadCloser, bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return 0, nil, false, err
+	}
+	if !haveHeaders {
+		return uint64(fi.Size()), file, false, nil
+	}
+	header := make([]byte, compressionHeaderSize)
+	nRead, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		file.Close()
+		return 0, nil, false, err
+	}
+	method, size, ok := decodeHeader(header[:nRead])
+	if !ok {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return 0, nil, false, err
+		}
+		return uint64(fi.Size()), file, false, nil
+	}
+	if method == compressionNone {
+		return size, file, false, nil
+	}
+	if compressionMethodToString(method) == rawMethod {
+		return size, file, true, nil
+	}
+	decompressor, err := newDecompressor(method, file)
+	if err != nil {
+		file.Close()
+		return 0, nil, false, err
+	}
+	return size, &compressedReaderType{decompressor, file}, false, nil
+}
+
+func parseCompressionMethod(name string) (uint8, error) {
+	switch name {
+	case "", "none":
+		return compressionNone, nil
+	case "gzip":
+		return compressionGzip, nil
+	case "zstd":
+		return compressionZstd, nil
+	}
+	return 0, errors.New("unknown compression method: " + name)
+}
+
+// prepareForHeaders will ensure that the store at baseDir may contain objects
+// with headers, by adding headers to raw objects which start with the magic
+// number and then creating the marker file.
+func prepareForHeaders(baseDir string, logger log.Logger) error {
+	if markerExists(baseDir) {
+		return nil
+	}
+	var mutex sync.Mutex
+	var numEscaped uint
+	err := scanObjectFiles(baseDir, func(filename string, fileSize uint64) (
+		uint64, error) {
+		escaped, err := escapeObject(filename, fileSize)
+		if err != nil {
+			return 0, err
+		}
+		if escaped {
+			mutex.Lock()
+			numEscaped++
+			mutex.Unlock()
+		}
+		return fileSize, nil
+	})
+	if err != nil {
+		return err
+	}
+	if numEscaped > 0 {
+		logger.Printf("Added headers to %d objects\n", numEscaped)
+	}
+	file, err := os.OpenFile(path.Join(baseDir, compressionMarkerFile),
+		os.O_CREATE|os.O_WRONLY, fsutil.PrivateFilePerms)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// escapeObject will add a header to a raw object file if it starts with the
+// magic number. It returns true if a header was added.
+func escapeObject(filename string, fileSize uint64) (bool, error) {
+	if fileSize < uint64(len(compressionMagic)) {
+		return false, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.HasPrefix(data, compressionMagic) {
+		return false, nil
+	}
+	if isEscapedObject(data, uint64(len(data))) {
+		return false, nil // Previously escaped but the marker was not written.
+	}
+	header := encodeHeader(compressionNone, uint64(len(data)))
+	return true, replaceObjectFile(filename, append(header, data...))
+}
+
+func readObjectSize(filename string, fileSize uint64) (uint64, error) {
+	if fileSize < compressionHeaderSize {
+		return fileSize, nil
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	header := make([]byte, compressionHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, err
+	}
+	if _, size, ok := decodeHeader(header); ok {
+		return size, nil
+	}
+	return fileSize, nil
+}
+
+// replaceObjectFile will atomically replace the content of an object file. The
+// temporary file has a trailing '~' so that it is cleaned up by the scanner if
+// interrupted.
+func replaceObjectFile(filename string, data []byte) error {
+	tmpFilename := filename + "~"
+	err := fsutil.CopyToFileExclusive(tmpFilename, fsutil.PrivateFilePerms,
+		bytes.NewReader(data), uint64(len(data)))
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return nil
+}
+
+func (r *compressedReaderType) Close() error {
+	err := r.decompressor.Close()
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	return err
+}
+
+func (r *compressedReaderType) Read(p []byte) (int, error) {
+	return r.decompressor.Read(p)
+}
+
+func (objSrv *ObjectServer) openObjectFile(filename string) (
+	uint64, io.ReadCloser, error) {
+	size, reader, _, err := openObjectFile(filename, objSrv.haveHeaders, "")
+	return size, reader, err
+}
+
+// openCompressedObjectFile is like openObjectFile, except that if the object is
+// stored compressed with the specified method, the compressed stream is
+// yielded and the boolean is true.
+func (objSrv *ObjectServer) openCompressedObjectFile(filename string,
+	method string) (uint64, io.ReadCloser, bool, error) {
+	return openObjectFile(filename, objSrv.haveHeaders, method)
+}
+
+func (objSrv *ObjectServer) readObjectSize(filename string,
+	fileSize uint64) (uint64, error) {
+	if !objSrv.haveHeaders {
+		return fileSize, nil
+	}
+	return readObjectSize(filename, fileSize)
+}
@@ -0,0 +1,147 @@
+package filesystem
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/objectcache"
+)
+
+func makeTestObjects() [][]byte {
+	compressible := bytes.Repeat([]byte("compress me please "), 1000)
+	incompressible := make([]byte, 8192)
+	for index := range incompressible {
+		incompressible[index] = byte(index*7919 + index>>3*104729)
+	}
+	magicObject := append(append([]byte{}, compressionMagic...),
+		bytes.Repeat([]byte{0}, 10)...)
+	return [][]byte{compressible, incompressible, magicObject, []byte("tiny")}
+}
+
+func addTestObjects(t *testing.T, objSrv *ObjectServer) []hash.Hash {
+	var hashes []hash.Hash
+	for _, data := range makeTestObjects() {
+		hashVal, _, err := objSrv.AddObject(bytes.NewReader(data),
+			uint64(len(data)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hashVal)
+	}
+	return hashes
+}
+
+func checkTestObjects(t *testing.T, objSrv *ObjectServer,
+	hashes []hash.Hash) {
+	objects := makeTestObjects()
+	for index, hashVal := range hashes {
+		size, reader, err := objSrv.GetObject(hashVal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != uint64(len(objects[index])) {
+			t.Errorf("object: %d size: %d != %d",
+				index, size, len(objects[index]))
+		}
+		if !bytes.Equal(data, objects[index]) {
+			t.Errorf("object: %d content mismatch", index)
+		}
+	}
+}
+
+func testCompression(t *testing.T, method string) {
+	baseDir := t.TempDir()
+	logger := testlogger.New(t)
+	config := Config{
+		BaseDirectory: baseDir,
+		Compression:   CompressionConfig{Method: method},
+	}
+	objSrv, err := newObjectServer(config, Params{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := addTestObjects(t, objSrv)
+	checkTestObjects(t, objSrv, hashes)
+	filename := filepath.Join(baseDir, objectcache.HashToFilename(hashes[0]))
+	if fi, err := os.Stat(filename); err != nil {
+		t.Fatal(err)
+	} else if uint64(fi.Size()) >= uint64(len(makeTestObjects()[0])) {
+		t.Errorf("object not compressed: %d bytes", fi.Size())
+	}
+	// Adding again must compare against the uncompressed data.
+	addTestObjects(t, objSrv)
+	// Reload from disk with compression disabled.
+	objSrv, err = newObjectServer(Config{BaseDirectory: baseDir},
+		Params{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes, err := objSrv.CheckObjects(hashes); err != nil {
+		t.Fatal(err)
+	} else {
+		for index, data := range makeTestObjects() {
+			if sizes[index] != uint64(len(data)) {
+				t.Errorf("object: %d size: %d != %d",
+					index, sizes[index], len(data))
+			}
+		}
+	}
+	checkTestObjects(t, objSrv, hashes)
+}
+
+func TestCompressionGzip(t *testing.T) {
+	testCompression(t, "gzip")
+}
+
+func TestCompressionZstd(t *testing.T) {
+	testCompression(t, "zstd")
+}
+
+func TestConvertStore(t *testing.T) {
+	baseDir := t.TempDir()
+	logger := testlogger.New(t)
+	objSrv, err := newObjectServer(Config{BaseDirectory: baseDir},
+		Params{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := addTestObjects(t, objSrv)
+	if markerExists(baseDir) {
+		t.Fatal("marker created without compression")
+	}
+	err = ConvertStore(baseDir, CompressionConfig{Method: "zstd"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Converting again must be idempotent.
+	err = ConvertStore(baseDir, CompressionConfig{Method: "zstd"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objSrv, err = newObjectServer(Config{BaseDirectory: baseDir},
+		Params{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestObjects(t, objSrv, hashes)
+	err = ConvertStore(baseDir, CompressionConfig{Method: "none"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objSrv, err = newObjectServer(Config{BaseDirectory: baseDir},
+		Params{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestObjects(t, objSrv, hashes)
+}
@@ -0,0 +1,108 @@
+package filesystem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/Cloud-Foundations/Dominator/lib/objectcache"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem/scan"
+)
+
+type convertStatsType struct {
+	sync.Mutex
+	newBytes      uint64
+	numConverted  uint64
+	numObjects    uint64
+	oldBytes      uint64
+	originalBytes uint64
+}
+
+func convertStore(baseDir string, config CompressionConfig,
+	logger log.DebugLogger) error {
+	method, err := parseCompressionMethod(config.Method)
+	if err != nil {
+		return err
+	}
+	if err := prepareForHeaders(baseDir, logger); err != nil {
+		return err
+	}
+	var stats convertStatsType
+	err = scanObjectFiles(baseDir, func(filename string, fileSize uint64) (
+		uint64, error) {
+		return convertObject(baseDir, filename, method, config, &stats, logger)
+	})
+	if err != nil {
+		return err
+	}
+	logger.Printf(
+		"Converted %d of %d objects to %s: %s -> %s (%s uncompressed)\n",
+		stats.numConverted, stats.numObjects,
+		compressionMethodToString(method),
+		format.FormatBytes(stats.oldBytes), format.FormatBytes(stats.newBytes),
+		format.FormatBytes(stats.originalBytes))
+	return nil
+}
+
+// convertObject will re-encode an object file, verifying its hash first. The
+// uncompressed size is returned.
+func convertObject(baseDir, filename string, method uint8,
+	config CompressionConfig, stats *convertStatsType,
+	logger log.DebugLogger) (uint64, error) {
+	relativeName, err := filepath.Rel(baseDir, filename)
+	if err != nil {
+		return 0, err
+	}
+	hashVal, err := objectcache.FilenameToHash(relativeName)
+	if err != nil {
+		return 0, err
+	}
+	storedData, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	data, err := decodeObject(storedData)
+	if err != nil {
+		return 0, err
+	}
+	_, _, err = objectcache.ReadObject(bytes.NewReader(data),
+		uint64(len(data)), &hashVal)
+	if err != nil {
+		logger.Printf("skipping: %s: %s\n", filename, err)
+		return uint64(len(data)), nil
+	}
+	newData, err := encodeObject(data, method, config)
+	if err != nil {
+		return 0, err
+	}
+	converted := !bytes.Equal(newData, storedData)
+	if converted {
+		if err := replaceObjectFile(filename, newData); err != nil {
+			return 0, err
+		}
+		logger.Debugf(1, "converted: %s: %d -> %d\n",
+			filename, len(storedData), len(newData))
+	}
+	stats.Lock()
+	defer stats.Unlock()
+	stats.newBytes += uint64(len(newData))
+	stats.numObjects++
+	stats.oldBytes += uint64(len(storedData))
+	stats.originalBytes += uint64(len(data))
+	if converted {
+		stats.numConverted++
+	}
+	return uint64(len(data)), nil
+}
+
+// scanObjectFiles will call fileFunc for each object file in the store at
+// baseDir. Multiple calls to fileFunc may be called concurrently.
+func scanObjectFiles(baseDir string,
+	fileFunc func(filename string, fileSize uint64) (uint64, error)) error {
+	return scan.ScanTreeWithSizeFunc(baseDir, fileFunc,
+		func(hash.Hash, uint64) {})
+}
@@ -3,7 +3,6 @@ package filesystem
 import (
 	"errors"
 	"io"
-	"os"
 	"path"
 
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
@@ -33,21 +32,28 @@ func (objSrv *ObjectServer) getObjects(hashes []hash.Hash) (
 	return &objectsReader, nil
 }
 
-func (or *ObjectsReader) nextObject() (uint64, io.ReadCloser, error) {
+func (or *ObjectsReader) nextCompressedObject(method string) (
+	uint64, io.ReadCloser, bool, error) {
+	filename, err := or.nextFilename()
+	if err != nil {
+		return 0, nil, false, err
+	}
+	return or.objectServer.openCompressedObjectFile(filename, method)
+}
+
+func (or *ObjectsReader) nextFilename() (string, error) {
 	or.nextIndex++
 	if or.nextIndex >= int64(len(or.hashes)) {
-		return 0, nil, errors.New("all objects have been consumed")
+		return "", errors.New("all objects have been consumed")
 	}
-	filename := path.Join(or.objectServer.BaseDirectory,
-		objectcache.HashToFilename(or.hashes[or.nextIndex]))
-	file, err := os.Open(filename)
-	if err != nil {
-		return 0, nil, err
-	}
-	fi, err := file.Stat()
+	return path.Join(or.objectServer.BaseDirectory,
+		objectcache.HashToFilename(or.hashes[or.nextIndex])), nil
+}
+
+func (or *ObjectsReader) nextObject() (uint64, io.ReadCloser, error) {
+	filename, err := or.nextFilename()
 	if err != nil {
-		file.Close()
 		return 0, nil, err
 	}
-	return uint64(fi.Size()), file, nil
+	return or.objectServer.openObjectFile(filename)
 }
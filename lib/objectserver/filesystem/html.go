@@ -69,6 +69,10 @@ func (objSrv *ObjectServer) writeHtml(writer io.Writer) {
 			format.FormatBytes(referencedBytes+unreferencedBytes),
 			format.FormatBytes(totalBytes))
 	}
+	if objSrv.compressionMethod != compressionNone {
+		fmt.Fprintf(writer, "Compression for new objects: %s<br>\n",
+			compressionMethodToString(objSrv.compressionMethod))
+	}
 	writeHtmlBarAvailable(writer, referencedBytes, unreferencedBytes, capacity)
 }
 
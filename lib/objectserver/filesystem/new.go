@@ -17,15 +17,28 @@ func newObjectServer(config Config, params Params) (*ObjectServer, error) {
 		lastGarbageCollection: time.Now(),
 		objects:               make(map[hash.Hash]*objectType),
 	}
+	var err error
+	objSrv.compressionMethod, err = parseCompressionMethod(
+		config.Compression.Method)
+	if err != nil {
+		return nil, err
+	}
+	if objSrv.compressionMethod != compressionNone {
+		err := prepareForHeaders(config.BaseDirectory, params.Logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	objSrv.haveHeaders = markerExists(config.BaseDirectory)
 	startTime := time.Now()
 	var rusageStart, rusageStop wsyscall.Rusage
 	wsyscall.Getrusage(wsyscall.RUSAGE_SELF, &rusageStart)
-	err := scan.ScanTree(config.BaseDirectory, func(hashVal hash.Hash,
-		size uint64) {
-		objSrv.rwLock.Lock()
-		objSrv.add(&objectType{hash: hashVal, size: size})
-		objSrv.rwLock.Unlock()
-	})
+	err = scan.ScanTreeWithSizeFunc(config.BaseDirectory, objSrv.readObjectSize,
+		func(hashVal hash.Hash, size uint64) {
+			objSrv.rwLock.Lock()
+			objSrv.add(&objectType{hash: hashVal, size: size})
+			objSrv.rwLock.Unlock()
+		})
 	if err != nil {
 		return nil, err
 	}
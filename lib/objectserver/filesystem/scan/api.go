@@ -7,5 +7,15 @@ import (
 // ScanTree will scan a directory tree for objects and will call registerFunc
 // for each object. Multiple calls to registerFunc may be called concurrently.
 func ScanTree(baseDir string, registerFunc func(hash.Hash, uint64)) error {
-	return scanTree(baseDir, registerFunc)
+	return scanTree(baseDir, nil, registerFunc)
+}
+
+// ScanTreeWithSizeFunc is like ScanTree, except that sizeFunc is called to
+// compute the size of each object from the pathname and size of the file
+// containing it. This is used for stores where objects may have headers or may
+// be compressed. Multiple calls to sizeFunc may be called concurrently.
+func ScanTreeWithSizeFunc(baseDir string,
+	sizeFunc func(pathname string, fileSize uint64) (uint64, error),
+	registerFunc func(hash.Hash, uint64)) error {
+	return scanTree(baseDir, sizeFunc, registerFunc)
 }
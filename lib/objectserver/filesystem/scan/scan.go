@@ -10,7 +10,10 @@ import (
 	"github.com/Cloud-Foundations/Dominator/lib/objectcache"
 )
 
-func scanTree(baseDir string, registerFunc func(hash.Hash, uint64)) error {
+type sizeFuncType func(pathname string, fileSize uint64) (uint64, error)
+
+func scanTree(baseDir string, sizeFunc sizeFuncType,
+	registerFunc func(hash.Hash, uint64)) error {
 	if fi, err := os.Stat(baseDir); err != nil {
 		return fmt.Errorf("cannot stat: %s: %s\n", baseDir, err)
 	} else {
@@ -19,7 +22,8 @@ func scanTree(baseDir string, registerFunc func(hash.Hash, uint64)) error {
 		}
 	}
 	state := concurrent.NewState(0)
-	if err := scanDirectory(baseDir, "", state, registerFunc); err != nil {
+	if err := scanDirectory(baseDir, "", state, sizeFunc,
+		registerFunc); err != nil {
 		return err
 	}
 	if err := state.Reap(); err != nil {
@@ -29,7 +33,7 @@ func scanTree(baseDir string, registerFunc func(hash.Hash, uint64)) error {
 }
 
 func scanDirectory(baseDir string, subpath string, state *concurrent.State,
-	registerFunc func(hash.Hash, uint64)) error {
+	sizeFunc sizeFuncType, registerFunc func(hash.Hash, uint64)) error {
 	myPathName := filepath.Join(baseDir, subpath)
 	file, err := os.Open(myPathName)
 	if err != nil {
@@ -52,7 +56,8 @@ func scanDirectory(baseDir string, subpath string, state *concurrent.State,
 		filename := filepath.Join(subpath, name)
 		if fi.IsDir() {
 			if state == nil {
-				err := scanDirectory(baseDir, filename, nil, registerFunc)
+				err := scanDirectory(baseDir, filename, nil, sizeFunc,
+					registerFunc)
 				if err != nil {
 					return err
 				}
@@ -60,7 +65,8 @@ func scanDirectory(baseDir string, subpath string, state *concurrent.State,
 				// GoRun() cannot be used recursively, so limit concurrency to
 				// the top level. It's also more efficient this way.
 				if err := state.GoRun(func() error {
-					return scanDirectory(baseDir, filename, nil, registerFunc)
+					return scanDirectory(baseDir, filename, nil, sizeFunc,
+						registerFunc)
 				}); err != nil {
 					return err
 				}
@@ -80,7 +86,14 @@ func scanDirectory(baseDir string, subpath string, state *concurrent.State,
 			if err != nil {
 				return err
 			}
-			registerFunc(hashVal, uint64(fi.Size()))
+			size := uint64(fi.Size())
+			if sizeFunc != nil {
+				size, err = sizeFunc(fullPathName, size)
+				if err != nil {
+					return err
+				}
+			}
+			registerFunc(hashVal, size)
 		}
 	}
 	return nil
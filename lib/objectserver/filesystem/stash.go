@@ -28,6 +28,10 @@ func (objSrv *ObjectServer) commitObject(hashVal hash.Hash) error {
 		fsutil.ForceRemove(stashFilename)
 		return errors.New("existing non-file: " + stashFilename)
 	}
+	size, err := objSrv.readObjectSize(stashFilename, uint64(fi.Size()))
+	if err != nil {
+		return err
+	}
 	err = os.MkdirAll(path.Dir(filename), fsutil.PrivateDirPerms)
 	if err != nil {
 		return err
@@ -37,13 +41,13 @@ func (objSrv *ObjectServer) commitObject(hashVal hash.Hash) error {
 	if _, ok := objSrv.objects[hashVal]; ok {
 		fsutil.ForceRemove(stashFilename)
 		// Run in a goroutine to keep outside of the lock.
-		go objSrv.addCallback(hashVal, uint64(fi.Size()), false)
+		go objSrv.addCallback(hashVal, size, false)
 		return nil
 	} else {
-		objSrv.add(&objectType{hash: hashVal, size: uint64(fi.Size())})
+		objSrv.add(&objectType{hash: hashVal, size: size})
 		if objSrv.addCallback != nil {
 			// Run in a goroutine to keep outside of the lock.
-			go objSrv.addCallback(hashVal, uint64(fi.Size()), true)
+			go objSrv.addCallback(hashVal, size, true)
 		}
 		return os.Rename(stashFilename, filename)
 	}
@@ -67,7 +71,7 @@ func (objSrv *ObjectServer) stashOrVerifyObject(reader io.Reader,
 	if length, err := objSrv.checkObject(hashVal); err != nil {
 		return hashVal, nil, err
 	} else if length > 0 {
-		if err := collisionCheck(data, filename, int64(length)); err != nil {
+		if err := objSrv.collisionCheck(data, filename); err != nil {
 			return hashVal, nil, err
 		}
 		return hashVal, nil, nil
@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectcache"
+)
+
+// This must be called with the lock held. The object must not already exist.
+func (objSrv *ObjectServer) add(object *objectType) {
+	objSrv.objects[object.hash] = object
+	objSrv.addUnreferenced(object)
+	objSrv.lastMutationTime = time.Now()
+	objSrv.totalBytes += object.size
+}
+
+func (objSrv *ObjectServer) addObject(reader io.Reader, length uint64,
+	expectedHash *hash.Hash) (hash.Hash, bool, error) {
+	hashVal, data, err := objectcache.ReadObject(reader, length, expectedHash)
+	if err != nil {
+		return hashVal, false, err
+	}
+	isNew, err := objSrv.addOrCompare(hashVal, data)
+	if err != nil {
+		return hashVal, false, err
+	}
+	if objSrv.addCallback != nil {
+		objSrv.addCallback(hashVal, uint64(len(data)), isNew)
+	}
+	return hashVal, isNew, nil
+}
+
+// addOrCompare will upload the object if it is not known, else it will check
+// for a collision with the existing object. It returns true if the object is
+// new.
+func (objSrv *ObjectServer) addOrCompare(hashVal hash.Hash,
+	data []byte) (bool, error) {
+	objSrv.rwLock.RLock()
+	_, ok := objSrv.objects[hashVal]
+	objSrv.rwLock.RUnlock()
+	if ok {
+		if err := objSrv.collisionCheck(hashVal, data); err != nil {
+			return false, errors.New("collision detected: " + err.Error())
+		}
+		return false, nil
+	}
+	if err := objSrv.putBucketObject(hashVal, data); err != nil {
+		return false, err
+	}
+	objSrv.rwLock.Lock()
+	defer objSrv.rwLock.Unlock()
+	if _, ok := objSrv.objects[hashVal]; ok {
+		return false, nil // Lost a race with a concurrent upload.
+	}
+	objSrv.add(&objectType{hash: hashVal, size: uint64(len(data))})
+	return true, nil
+}
+
+// collisionCheck will compare data with an existing object, which is read
+// through the cache.
+func (objSrv *ObjectServer) collisionCheck(hashVal hash.Hash,
+	data []byte) error {
+	objectsReader, err := objSrv.cache.GetObjects([]hash.Hash{hashVal})
+	if err != nil {
+		return err
+	}
+	defer objectsReader.Close()
+	size, reader, err := objectsReader.NextObject()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if uint64(len(data)) != size {
+		return fmt.Errorf("length mismatch. Data=%d, existing object=%d",
+			len(data), size)
+	}
+	existingData := make([]byte, size)
+	if _, err := io.ReadFull(reader, existingData); err != nil {
+		return err
+	}
+	if !bytes.Equal(data, existingData) {
+		return errors.New("content mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectcache"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	"github.com/aws/aws-sdk-go/aws"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+// bucketObjectsGetter is the upstream source of objects for the cache.
+type bucketObjectsGetter struct {
+	objSrv *ObjectServer
+}
+
+type bucketObjectsReader struct {
+	hashes    []hash.Hash
+	nextIndex int
+	objSrv    *ObjectServer
+	sizes     []uint64
+}
+
+var _ objectserver.FullObjectsReader = (*bucketObjectsReader)(nil)
+
+func (objSrv *ObjectServer) deleteBucketObject(hashVal hash.Hash) error {
+	_, err := objSrv.client.DeleteObject(&awss3.DeleteObjectInput{
+		Bucket: aws.String(objSrv.Bucket),
+		Key:    aws.String(objSrv.hashToKey(hashVal)),
+	})
+	return err
+}
+
+func (objSrv *ObjectServer) getBucketObject(hashVal hash.Hash) (
+	io.ReadCloser, error) {
+	output, err := objSrv.client.GetObject(&awss3.GetObjectInput{
+		Bucket: aws.String(objSrv.Bucket),
+		Key:    aws.String(objSrv.hashToKey(hashVal)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (objSrv *ObjectServer) hashToKey(hashVal hash.Hash) string {
+	return path.Join(objSrv.Prefix, objectcache.HashToFilename(hashVal))
+}
+
+// keyToHash returns the hash for an object key. Keys outside the prefix or
+// with hidden components are ignored.
+func (objSrv *ObjectServer) keyToHash(key string) (hash.Hash, bool) {
+	if objSrv.Prefix != "" {
+		if !strings.HasPrefix(key, objSrv.Prefix+"/") {
+			return hash.Hash{}, false
+		}
+		key = key[len(objSrv.Prefix)+1:]
+	}
+	if strings.HasPrefix(key, ".") || strings.Contains(key, "/.") {
+		return hash.Hash{}, false
+	}
+	hashVal, err := objectcache.FilenameToHash(key)
+	if err != nil {
+		return hash.Hash{}, false
+	}
+	return hashVal, true
+}
+
+// listBucketObjects will call objectFunc for each object in the bucket.
+func (objSrv *ObjectServer) listBucketObjects(
+	objectFunc func(hash.Hash, uint64)) error {
+	input := &awss3.ListObjectsV2Input{Bucket: aws.String(objSrv.Bucket)}
+	if objSrv.Prefix != "" {
+		input.Prefix = aws.String(objSrv.Prefix + "/")
+	}
+	var numIgnored uint
+	err := objSrv.client.ListObjectsV2Pages(input,
+		func(output *awss3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range output.Contents {
+				if hashVal, ok := objSrv.keyToHash(
+					aws.StringValue(object.Key)); !ok {
+					numIgnored++
+				} else if size := aws.Int64Value(object.Size); size > 0 {
+					objectFunc(hashVal, uint64(size))
+				} else {
+					numIgnored++
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return err
+	}
+	if numIgnored > 0 {
+		objSrv.Logger.Printf("Ignored %d keys in bucket: %s\n",
+			numIgnored, objSrv.Bucket)
+	}
+	return nil
+}
+
+func (objSrv *ObjectServer) putBucketObject(hashVal hash.Hash,
+	data []byte) error {
+	_, err := objSrv.client.PutObject(&awss3.PutObjectInput{
+		Body:          bytes.NewReader(data),
+		Bucket:        aws.String(objSrv.Bucket),
+		ContentLength: aws.Int64(int64(len(data))),
+		Key:           aws.String(objSrv.hashToKey(hashVal)),
+	})
+	return err
+}
+
+func (getter *bucketObjectsGetter) GetObjects(hashes []hash.Hash) (
+	objectserver.ObjectsReader, error) {
+	sizes, err := getter.objSrv.checkObjects(hashes)
+	if err != nil {
+		return nil, err
+	}
+	for index, size := range sizes {
+		if size < 1 {
+			return nil, fmt.Errorf("unknown object: %x", hashes[index])
+		}
+	}
+	return &bucketObjectsReader{
+		hashes: hashes,
+		objSrv: getter.objSrv,
+		sizes:  sizes,
+	}, nil
+}
+
+func (or *bucketObjectsReader) Close() error {
+	return nil
+}
+
+func (or *bucketObjectsReader) NextObject() (uint64, io.ReadCloser, error) {
+	if or.nextIndex >= len(or.hashes) {
+		return 0, nil, errors.New("all objects have been consumed")
+	}
+	hashVal := or.hashes[or.nextIndex]
+	size := or.sizes[or.nextIndex]
+	or.nextIndex++
+	reader, err := or.objSrv.getBucketObject(hashVal)
+	if err != nil {
+		return 0, nil, err
+	}
+	return size, reader, nil
+}
+
+func (or *bucketObjectsReader) ObjectSizes() []uint64 {
+	return or.sizes
+}
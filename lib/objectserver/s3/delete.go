@@ -0,0 +1,40 @@
+package s3
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+)
+
+// deleteObject will delete the specified object. If haveLock is false, the
+// lock is grabbed. In either case, the lock will be released.
+func (objSrv *ObjectServer) deleteObject(hashVal hash.Hash,
+	haveLock bool) error {
+	var refcount uint64
+	if !haveLock {
+		objSrv.rwLock.Lock()
+	}
+	if object := objSrv.objects[hashVal]; object == nil {
+		objSrv.rwLock.Unlock()
+		return fmt.Errorf("deleteObject(%x): object unknown", hashVal)
+	} else {
+		refcount = object.refcount
+		delete(objSrv.objects, hashVal)
+		objSrv.duplicatedBytes -= object.size * object.refcount
+		objSrv.lastMutationTime = time.Now()
+		objSrv.numDuplicated -= object.refcount
+		if object.refcount > 0 {
+			objSrv.numReferenced--
+			objSrv.referencedBytes -= object.size
+		}
+		objSrv.removeUnreferenced(object)
+		objSrv.totalBytes -= object.size
+	}
+	objSrv.rwLock.Unlock()
+	if refcount > 0 {
+		objSrv.Logger.Printf("deleteObject(%x): refcount: %d\n",
+			hashVal, refcount)
+	}
+	return objSrv.deleteBucketObject(hashVal)
+}
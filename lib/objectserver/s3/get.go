@@ -0,0 +1,34 @@
+package s3
+
+import (
+	"fmt"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+func (objSrv *ObjectServer) checkObjects(hashes []hash.Hash) ([]uint64, error) {
+	sizesList := make([]uint64, len(hashes))
+	objSrv.rwLock.RLock()
+	defer objSrv.rwLock.RUnlock()
+	for index, hashVal := range hashes {
+		if object, ok := objSrv.objects[hashVal]; ok {
+			sizesList[index] = object.size
+		}
+	}
+	return sizesList, nil
+}
+
+func (objSrv *ObjectServer) getObjects(hashes []hash.Hash) (
+	objectserver.ObjectsReader, error) {
+	sizes, err := objSrv.checkObjects(hashes)
+	if err != nil {
+		return nil, err
+	}
+	for index, size := range sizes {
+		if size < 1 {
+			return nil, fmt.Errorf("missing object: %x", hashes[index])
+		}
+	}
+	return objSrv.cache.GetObjects(hashes)
+}
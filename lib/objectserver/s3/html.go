@@ -0,0 +1,49 @@
+package s3
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+)
+
+func (objSrv *ObjectServer) writeHtml(writer io.Writer) {
+	objSrv.lockWatcher.WriteHtml(writer, "ObjectServer: ")
+	objSrv.rwLock.RLock()
+	duplicatedBytes := objSrv.duplicatedBytes
+	numObjects := uint64(len(objSrv.objects))
+	numDuplicated := objSrv.numDuplicated
+	numReferenced := objSrv.numReferenced
+	numUnreferenced := objSrv.numUnreferenced
+	referencedBytes := objSrv.referencedBytes
+	totalBytes := objSrv.totalBytes
+	unreferencedBytes := objSrv.unreferencedBytes
+	objSrv.rwLock.RUnlock()
+	unreferencedObjectsPercent := 0.0
+	if numObjects > 0 {
+		unreferencedObjectsPercent =
+			100.0 * float64(numUnreferenced) / float64(numObjects)
+	}
+	unreferencedBytesPercent := 0.0
+	if totalBytes > 0 {
+		unreferencedBytesPercent =
+			100.0 * float64(unreferencedBytes) / float64(totalBytes)
+	}
+	fmt.Fprintf(writer,
+		"Number of objects in bucket %s: %d, consuming %s<br>\n",
+		objSrv.Bucket, numObjects, format.FormatBytes(totalBytes))
+	if numDuplicated > 0 {
+		fmt.Fprintf(writer,
+			"Number of referenced objects: %d (%d duplicates, %.3g*), consuming %s (%s dups, %.3g*)<br>\n",
+			numReferenced, numDuplicated,
+			float64(numDuplicated)/float64(numReferenced),
+			format.FormatBytes(referencedBytes),
+			format.FormatBytes(duplicatedBytes),
+			float64(duplicatedBytes)/float64(referencedBytes))
+	}
+	fmt.Fprintf(writer,
+		"Number of unreferenced objects: %d (%.1f%%), consuming %s (%.1f%%)<br>\n",
+		numUnreferenced, unreferencedObjectsPercent,
+		format.FormatBytes(unreferencedBytes), unreferencedBytesPercent)
+	objSrv.cache.WriteHtml(writer)
+}
@@ -0,0 +1,88 @@
+package s3
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/lockwatcher"
+	"github.com/Cloud-Foundations/Dominator/lib/log/prefixlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/cachingreader"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+)
+
+func newObjectServer(config Config, params Params) (*ObjectServer, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("no bucket specified")
+	}
+	if config.CacheDirectory == "" {
+		return nil, errors.New("no cache directory specified")
+	}
+	awsSession := params.Session
+	if awsSession == nil {
+		var err error
+		awsSession, err = session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	awsConfig := &aws.Config{}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+	if config.ForcePathStyle {
+		awsConfig.S3ForcePathStyle = aws.Bool(true)
+	}
+	if config.Region != "" {
+		awsConfig.Region = aws.String(config.Region)
+	}
+	err := os.MkdirAll(config.CacheDirectory, fsutil.PrivateDirPerms)
+	if err != nil {
+		return nil, err
+	}
+	objSrv := &ObjectServer{
+		client:  awss3.New(awsSession, awsConfig),
+		Config:  config,
+		Params:  params,
+		objects: make(map[hash.Hash]*objectType),
+	}
+	startTime := time.Now()
+	err = objSrv.listBucketObjects(func(hashVal hash.Hash, size uint64) {
+		if _, ok := objSrv.objects[hashVal]; !ok {
+			objSrv.add(&objectType{hash: hashVal, size: size})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	plural := ""
+	if len(objSrv.objects) != 1 {
+		plural = "s"
+	}
+	params.Logger.Printf("Listed %d object%s (%s) in bucket: %s in %s\n",
+		len(objSrv.objects), plural, format.FormatBytes(objSrv.totalBytes),
+		config.Bucket, format.Duration(time.Since(startTime)))
+	objSrv.cache, err = cachingreader.New(cachingreader.Params{
+		BaseDirectory:      config.CacheDirectory,
+		Logger:             prefixlogger.New("cache: ", params.Logger),
+		MaximumCachedBytes: config.MaximumCachedBytes,
+		ObjectsGetter:      &bucketObjectsGetter{objSrv},
+	})
+	if err != nil {
+		return nil, err
+	}
+	objSrv.lockWatcher = lockwatcher.New(&objSrv.rwLock,
+		lockwatcher.LockWatcherOptions{
+			CheckInterval: config.LockCheckInterval,
+			Logger:        prefixlogger.New("ObjectServer: ", params.Logger),
+			LogTimeout:    config.LockLogTimeout,
+		})
+	return objSrv, nil
+}
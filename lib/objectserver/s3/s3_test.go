@@ -0,0 +1,322 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const testBucket = "objects"
+
+// fakeS3 is a minimal local stand-in for an S3-compatible object store, using
+// path-style addressing for a single bucket.
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+type hashList []hash.Hash
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Contents              []listContents
+	IsTruncated           bool
+	KeyCount              int
+	Name                  string
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+type listContents struct {
+	Key  string
+	Size int
+}
+
+func (hashes hashList) ForEachObject(objectFunc func(hash.Hash) error) error {
+	for _, hashVal := range hashes {
+		if err := objectFunc(hashVal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	splitPath := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+	if splitPath[0] != testBucket {
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if len(splitPath) < 2 || splitPath[1] == "" {
+		if req.Method == http.MethodGet {
+			s.list(w, req)
+		} else {
+			s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		}
+		return
+	}
+	key := splitPath[1]
+	switch req.Method {
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet, http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodPut:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = data
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", len(data)))
+		w.WriteHeader(http.StatusOK)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list implements ListObjectsV2, returning pages of two keys to exercise
+// pagination.
+func (s *fakeS3) list(w http.ResponseWriter, req *http.Request) {
+	prefix := req.URL.Query().Get("prefix")
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	startIndex, _ := strconv.Atoi(req.URL.Query().Get("continuation-token"))
+	result := listBucketResult{Name: testBucket}
+	for index := startIndex; index < len(keys); index++ {
+		if len(result.Contents) >= 2 {
+			result.IsTruncated = true
+			result.NextContinuationToken = strconv.Itoa(index)
+			break
+		}
+		result.Contents = append(result.Contents,
+			listContents{Key: keys[index], Size: len(s.objects[keys[index]])})
+	}
+	result.KeyCount = len(result.Contents)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (s *fakeS3) numObjects() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.objects)
+}
+
+func (s *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>",
+		code, code)
+}
+
+func makeTestServer(t *testing.T, fake *fakeS3, cacheDir string) *ObjectServer {
+	httpServer := httptest.NewServer(fake)
+	t.Cleanup(httpServer.Close)
+	awsSession, err := session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Region:      aws.String("us-east-1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	objSrv, err := New(
+		Config{
+			Bucket:         testBucket,
+			CacheDirectory: cacheDir,
+			Endpoint:       httpServer.URL,
+			ForcePathStyle: true,
+			Prefix:         "prefix",
+		},
+		Params{Logger: testlogger.New(t), Session: awsSession})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return objSrv
+}
+
+func addObject(t *testing.T, objSrv *ObjectServer, data []byte,
+	expectNew bool) hash.Hash {
+	hashVal, isNew, err := objSrv.AddObject(bytes.NewReader(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNew != expectNew {
+		t.Fatalf("isNew: %v, expected: %v", isNew, expectNew)
+	}
+	return hashVal
+}
+
+func checkObject(t *testing.T, objSrv *ObjectServer, hashVal hash.Hash,
+	expectedData []byte) {
+	size, reader, err := objSrv.GetObject(hashVal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(expectedData)) || !bytes.Equal(data, expectedData) {
+		t.Fatalf("object: %x data mismatch", hashVal)
+	}
+}
+
+func TestAddGetAndReload(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{"unrelated": []byte("x")}}
+	cacheDir := t.TempDir()
+	objSrv := makeTestServer(t, fake, cacheDir)
+	objects := [][]byte{[]byte("object 0"), []byte("object 1"),
+		[]byte("object 2")}
+	var hashes []hash.Hash
+	for _, data := range objects {
+		hashes = append(hashes, addObject(t, objSrv, data, true))
+	}
+	addObject(t, objSrv, objects[0], false)
+	if fake.numObjects() != len(objects)+1 {
+		t.Fatalf("bucket has %d objects", fake.numObjects())
+	}
+	for index, hashVal := range hashes {
+		checkObject(t, objSrv, hashVal, objects[index])
+	}
+	// Reload from the bucket with an empty cache.
+	objSrv = makeTestServer(t, fake, t.TempDir())
+	if objSrv.NumObjects() != uint64(len(objects)) {
+		t.Fatalf("reloaded %d objects", objSrv.NumObjects())
+	}
+	sizes, err := objSrv.CheckObjects(append(hashes, hash.Hash{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, data := range objects {
+		if sizes[index] != uint64(len(data)) {
+			t.Errorf("object: %d size: %d", index, sizes[index])
+		}
+	}
+	if sizes[len(objects)] != 0 {
+		t.Error("unknown object has non-zero size")
+	}
+	for index, hashVal := range hashes {
+		checkObject(t, objSrv, hashVal, objects[index])
+	}
+	if _, err := objSrv.GetObjects([]hash.Hash{{}}); err == nil {
+		t.Error("no error getting unknown object")
+	}
+}
+
+func TestRefcountsAndDeleteUnreferenced(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	objSrv := makeTestServer(t, fake, t.TempDir())
+	referenced := addObject(t, objSrv, []byte("referenced"), true)
+	addObject(t, objSrv, []byte("unreferenced 0"), true)
+	addObject(t, objSrv, []byte("unreferenced 1"), true)
+	err := objSrv.AdjustRefcounts(true, hashList{referenced})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := objSrv.AdjustRefcounts(true, hashList{{}}); err == nil {
+		t.Error("no error adjusting refcount for unknown object")
+	}
+	if unreferenced := objSrv.ListUnreferenced(); len(unreferenced) != 2 {
+		t.Fatalf("%d unreferenced objects", len(unreferenced))
+	} else if _, ok := unreferenced[referenced]; ok {
+		t.Fatal("referenced object is unreferenced")
+	}
+	_, numDeleted, err := objSrv.DeleteUnreferenced(100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numDeleted != 2 {
+		t.Errorf("deleted %d objects", numDeleted)
+	}
+	if fake.numObjects() != 1 || objSrv.NumObjects() != 1 {
+		t.Errorf("bucket has %d objects, server has %d objects",
+			fake.numObjects(), objSrv.NumObjects())
+	}
+	checkObject(t, objSrv, referenced, []byte("referenced"))
+}
+
+func TestStashAndCommit(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	objSrv := makeTestServer(t, fake, t.TempDir())
+	data := []byte("stashed object")
+	hashVal, stashedData, err := objSrv.StashOrVerifyObject(
+		bytes.NewReader(data), uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stashedData, data) {
+		t.Fatal("stashed data mismatch")
+	}
+	if sizes, _ := objSrv.CheckObjects([]hash.Hash{hashVal}); sizes[0] != 0 {
+		t.Fatal("stashed object visible before commit")
+	}
+	if fake.numObjects() != 0 {
+		t.Fatal("stashed object uploaded before commit")
+	}
+	if err := objSrv.CommitObject(hashVal); err != nil {
+		t.Fatal(err)
+	}
+	if err := objSrv.CommitObject(hashVal); err != nil {
+		t.Fatalf("second commit: %s", err)
+	}
+	if fake.numObjects() != 1 {
+		t.Fatal("committed object not uploaded")
+	}
+	checkObject(t, objSrv, hashVal, data)
+	// Verify an existing object.
+	_, stashedData, err = objSrv.StashOrVerifyObject(bytes.NewReader(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stashedData != nil {
+		t.Fatal("existing object stashed")
+	}
+	// Stash then discard.
+	data = []byte("discarded object")
+	hashVal, _, err = objSrv.StashOrVerifyObject(bytes.NewReader(data),
+		uint64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := objSrv.DeleteStashedObject(hashVal); err != nil {
+		t.Fatal(err)
+	}
+	if err := objSrv.CommitObject(hashVal); err == nil {
+		t.Fatal("no error committing deleted stashed object")
+	}
+}
@@ -0,0 +1,81 @@
+package s3
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectcache"
+)
+
+// Stashed objects are kept in a hidden directory so that the cache does not
+// find them.
+const stashDirectory = ".stash"
+
+func (objSrv *ObjectServer) commitObject(hashVal hash.Hash) error {
+	stashFilename := objSrv.stashFilename(hashVal)
+	data, err := os.ReadFile(stashFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			objSrv.rwLock.RLock()
+			_, ok := objSrv.objects[hashVal]
+			objSrv.rwLock.RUnlock()
+			if ok {
+				return nil // Previously committed: return success.
+			}
+		}
+		return err
+	}
+	isNew, err := objSrv.addOrCompare(hashVal, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(stashFilename); err != nil {
+		return err
+	}
+	if objSrv.addCallback != nil {
+		objSrv.addCallback(hashVal, uint64(len(data)), isNew)
+	}
+	return nil
+}
+
+func (objSrv *ObjectServer) deleteStashedObject(hashVal hash.Hash) error {
+	return os.Remove(objSrv.stashFilename(hashVal))
+}
+
+func (objSrv *ObjectServer) stashFilename(hashVal hash.Hash) string {
+	return filepath.Join(objSrv.CacheDirectory, stashDirectory,
+		objectcache.HashToFilename(hashVal))
+}
+
+func (objSrv *ObjectServer) stashOrVerifyObject(reader io.Reader,
+	length uint64, expectedHash *hash.Hash) (hash.Hash, []byte, error) {
+	hashVal, data, err := objectcache.ReadObject(reader, length, expectedHash)
+	if err != nil {
+		return hashVal, nil, err
+	}
+	// Check for existing object and collision.
+	objSrv.rwLock.RLock()
+	_, ok := objSrv.objects[hashVal]
+	objSrv.rwLock.RUnlock()
+	if ok {
+		if err := objSrv.collisionCheck(hashVal, data); err != nil {
+			return hashVal, nil, err
+		}
+		return hashVal, nil, nil
+	}
+	filename := objSrv.stashFilename(hashVal)
+	err = os.MkdirAll(filepath.Dir(filename), fsutil.PrivateDirPerms)
+	if err != nil {
+		return hashVal, nil, err
+	}
+	err = fsutil.CopyToFile(filename, fsutil.PrivateFilePerms,
+		bytes.NewReader(data), uint64(len(data)))
+	if err != nil {
+		return hashVal, nil, err
+	}
+	return hashVal, data, nil
+}
@@ -0,0 +1,138 @@
+package oci
+
+import (
+	"archive/tar"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem/untar"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+const (
+	AnnotationRefName = "org.opencontainers.image.ref.name"
+
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeImageConfig        = "application/vnd.oci.image.config.v1+json"
+	MediaTypeImageIndex         = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageLayer         = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeImageLayerGzip     = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeImageManifest      = "application/vnd.oci.image.manifest.v1+json"
+)
+
+type ContainerConfig struct {
+	Cmd        []string          `json:",omitempty"`
+	Entrypoint []string          `json:",omitempty"`
+	Env        []string          `json:",omitempty"`
+	Labels     map[string]string `json:",omitempty"`
+	User       string            `json:",omitempty"`
+	WorkingDir string            `json:",omitempty"`
+}
+
+type Descriptor struct {
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Digest      string            `json:"digest"`
+	MediaType   string            `json:"mediaType"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Size        int64             `json:"size"`
+}
+
+// Image is an opened OCI image layout or Docker archive.
+type Image struct {
+	Config   ImageConfig
+	Manifest Manifest
+	layers   []layerType
+	tmpDir   string // If not empty, removed by Close.
+}
+
+type ImageConfig struct {
+	Architecture string          `json:"architecture"`
+	Config       ContainerConfig `json:"config"`
+	Created      *time.Time      `json:"created,omitempty"`
+	OS           string          `json:"os"`
+	RootFS       RootFS          `json:"rootfs"`
+}
+
+type Index struct {
+	Manifests     []Descriptor `json:"manifests"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	SchemaVersion int          `json:"schemaVersion"`
+}
+
+type Manifest struct {
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	SchemaVersion int               `json:"schemaVersion"`
+}
+
+// OpenOptions specify which image to select when a layout contains several
+// images. Reference is matched against the ref.name annotation (for OCI
+// layouts) or the repository tags (for Docker archives). Platform is of the
+// form os/architecture and defaults to the running system.
+type OpenOptions struct {
+	Platform  string
+	Reference string
+}
+
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type RootFS struct {
+	DiffIDs []string `json:"diff_ids"`
+	Type    string   `json:"type"`
+}
+
+// WriteOptions specify the metadata written with an image. If Architecture is
+// empty, the architecture of the running system is used.
+type WriteOptions struct {
+	Architecture string
+	Created      time.Time
+	Labels       map[string]string
+	Reference    string
+}
+
+// Open will open an OCI image layout or a Docker archive (as produced by
+// docker save). The pathname may be a directory or a tarfile, which is
+// unpacked into a temporary directory. The Close method must be called to
+// release resources.
+func Open(pathname string, options OpenOptions) (*Image, error) {
+	return open(pathname, options)
+}
+
+// Write will write the file-system as a single layer OCI image layout. If
+// pathname ends in ".tar" a tarfile is written, else a directory is created.
+func Write(pathname string, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter, options WriteOptions) error {
+	return write(pathname, fs, objectsGetter, options)
+}
+
+func (img *Image) Close() error {
+	return img.close()
+}
+
+// Decode will flatten the layers of the image into a file-system, applying
+// whiteouts. File data are passed to hasher.
+func (img *Image) Decode(hasher untar.Hasher, filter *filter.Filter) (
+	*filesystem.FileSystem, error) {
+	return img.decode(hasher, filter)
+}
+
+// Extract will flatten the layers of the image into the directory, applying
+// whiteouts. Ownership, permissions and device nodes are preserved, so this
+// generally requires root privileges.
+func (img *Image) Extract(dirname string) error {
+	return img.extract(dirname)
+}
+
+// ForEachLayer will call layerFunc for each layer, lowest layer first. Layer
+// digests are verified.
+func (img *Image) ForEachLayer(layerFunc func(*tar.Reader) error) error {
+	return img.forEachLayer(layerFunc)
+}
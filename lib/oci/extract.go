@@ -0,0 +1,212 @@
+package oci
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem/untar"
+	"github.com/Cloud-Foundations/Dominator/lib/fsutil"
+)
+
+type layerExtractor struct {
+	added   map[string]struct{} // Entries added by the current layer.
+	dirname string
+}
+
+func (img *Image) extract(dirname string) error {
+	return img.forEachLayer(func(tarReader *tar.Reader) error {
+		le := &layerExtractor{
+			added:   make(map[string]struct{}),
+			dirname: dirname,
+		}
+		return le.extractLayer(tarReader)
+	})
+}
+
+// checkParents will return an error if any of the parent directories of name
+// are not directories, which prevents writing outside of the tree through
+// symbolic links.
+func (le *layerExtractor) checkParents(name string) error {
+	dirname := path.Dir(name)
+	if dirname == "/" {
+		return nil
+	}
+	if err := le.checkParents(dirname); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(le.pathname(dirname))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("parent: %s is not a directory", dirname)
+	}
+	return nil
+}
+
+func (le *layerExtractor) extractLayer(tarReader *tar.Reader) error {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)
+		leafName := path.Base(name)
+		if err := le.checkParents(name); err != nil {
+			if os.IsNotExist(err) &&
+				strings.HasPrefix(leafName, untar.WhiteoutPrefix) {
+				continue // Nothing to remove.
+			}
+			return err
+		}
+		if leafName == untar.WhiteoutOpaque {
+			if err := le.removeLowerEntries(path.Dir(name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(leafName, untar.WhiteoutPrefix) {
+			removeName := leafName[len(untar.WhiteoutPrefix):]
+			err := fsutil.ForceRemoveAll(le.pathname(
+				path.Join(path.Dir(name), removeName)))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := le.writeEntry(tarReader, header, name); err != nil {
+			return fmt.Errorf("error extracting: %s: %s", name, err)
+		}
+		le.added[name] = struct{}{}
+	}
+}
+
+func (le *layerExtractor) pathname(name string) string {
+	return filepath.Join(le.dirname, name)
+}
+
+// removeLowerEntries will remove all entries below the directory which were
+// not added by the current layer.
+func (le *layerExtractor) removeLowerEntries(name string) error {
+	dirPathname := le.pathname(name)
+	names, err := fsutil.ReadDirnames(dirPathname, true)
+	if err != nil {
+		return err
+	}
+	for _, leafName := range names {
+		childName := path.Join(name, leafName)
+		if _, ok := le.added[childName]; !ok {
+			err := fsutil.ForceRemoveAll(filepath.Join(dirPathname, leafName))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fi, err := os.Lstat(le.pathname(childName))
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if err := le.removeLowerEntries(childName); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (le *layerExtractor) writeEntry(reader io.Reader, header *tar.Header,
+	name string) error {
+	pathname := le.pathname(name)
+	mode := filesystem.FileMode(header.Mode & ^syscall.S_IFMT)
+	uid := uint32(header.Uid)
+	gid := uint32(header.Gid)
+	xattrs := untar.GetXattrs(header)
+	switch header.Typeflag {
+	case tar.TypeDir:
+		inode := &filesystem.DirectoryInode{
+			Gid:    gid,
+			Mode:   mode | syscall.S_IFDIR,
+			Uid:    uid,
+			Xattrs: xattrs,
+		}
+		return inode.Write(pathname)
+	case tar.TypeReg, tar.TypeRegA:
+		inode := &filesystem.RegularInode{
+			Gid:              gid,
+			Mode:             mode | syscall.S_IFREG,
+			MtimeNanoSeconds: int32(header.ModTime.Nanosecond()),
+			MtimeSeconds:     header.ModTime.Unix(),
+			Size:             uint64(header.Size),
+			Uid:              uid,
+			Xattrs:           xattrs,
+		}
+		if err := fsutil.ForceRemoveAll(pathname); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(pathname,
+			os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return inode.WriteMetadata(pathname)
+	case tar.TypeLink:
+		target := path.Clean("/" + header.Linkname)
+		if err := le.checkParents(target); err != nil {
+			return err
+		}
+		if err := fsutil.ForceRemoveAll(pathname); err != nil {
+			return err
+		}
+		return os.Link(le.pathname(target), pathname)
+	case tar.TypeSymlink:
+		inode := &filesystem.SymlinkInode{
+			Gid:     gid,
+			Symlink: header.Linkname,
+			Uid:     uid,
+			Xattrs:  xattrs,
+		}
+		return inode.Write(pathname)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		if header.Devminor > 255 {
+			return fmt.Errorf("minor device number: %d too large",
+				header.Devminor)
+		}
+		inode := &filesystem.SpecialInode{
+			Gid:              gid,
+			Mode:             mode,
+			MtimeNanoSeconds: int32(header.ModTime.Nanosecond()),
+			MtimeSeconds:     header.ModTime.Unix(),
+			Rdev:             uint64(header.Devmajor<<8 | header.Devminor),
+			Uid:              uid,
+			Xattrs:           xattrs,
+		}
+		switch header.Typeflag {
+		case tar.TypeChar:
+			inode.Mode |= syscall.S_IFCHR
+		case tar.TypeBlock:
+			inode.Mode |= syscall.S_IFBLK
+		case tar.TypeFifo:
+			inode.Mode |= syscall.S_IFIFO
+		}
+		return inode.Write(pathname)
+	}
+	return fmt.Errorf("unsupported file type: %v", header.Typeflag)
+}
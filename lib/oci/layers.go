@@ -0,0 +1,160 @@
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem/untar"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+type layerReader struct {
+	closer       func()
+	digest       string
+	digestReader *bufio.Reader // Reads compressed data through hasher.
+	file         *os.File
+	hasher       hash.Hash
+	reader       io.Reader // Reads uncompressed data.
+}
+
+func newDigestHasher(digest string) (hash.Hash, error) {
+	algorithm, _, _ := strings.Cut(digest, ":")
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm: \"%s\"", algorithm)
+}
+
+func openLayer(layer layerType) (*layerReader, error) {
+	lr := &layerReader{digest: layer.digest}
+	var reader io.Reader
+	if layer.digest != "" {
+		var err error
+		if lr.hasher, err = newDigestHasher(layer.digest); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.Open(layer.pathname)
+	if err != nil {
+		return nil, err
+	}
+	lr.file = file
+	reader = file
+	if lr.hasher != nil {
+		reader = io.TeeReader(file, lr.hasher)
+	}
+	lr.digestReader = bufio.NewReader(reader)
+	magic, _ := lr.digestReader.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, gzipMagic) {
+		gzipReader, err := gzip.NewReader(lr.digestReader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		lr.closer = func() { gzipReader.Close() }
+		lr.reader = gzipReader
+	} else if bytes.HasPrefix(magic, zstdMagic) {
+		zstdReader, err := zstd.NewReader(lr.digestReader)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		lr.closer = zstdReader.Close
+		lr.reader = zstdReader
+	} else {
+		lr.reader = lr.digestReader
+	}
+	return lr, nil
+}
+
+func (lr *layerReader) close() {
+	if lr.closer != nil {
+		lr.closer()
+	}
+	lr.file.Close()
+}
+
+// closeAndVerify will read any remaining data, close the layer and verify the
+// digest.
+func (lr *layerReader) closeAndVerify() error {
+	defer lr.close()
+	if lr.hasher == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, lr.digestReader); err != nil {
+		return err
+	}
+	_, encoded, _ := strings.Cut(lr.digest, ":")
+	if computed := hex.EncodeToString(lr.hasher.Sum(nil)); computed != encoded {
+		return fmt.Errorf("layer: %s has digest: %s", lr.digest, computed)
+	}
+	return nil
+}
+
+func (img *Image) decode(hasher untar.Hasher, filter *filter.Filter) (
+	*filesystem.FileSystem, error) {
+	var current *layerReader
+	defer func() {
+		if current != nil {
+			current.close()
+		}
+	}()
+	index := 0
+	nextLayer := func() (*tar.Reader, error) {
+		if current != nil {
+			err := current.closeAndVerify()
+			current = nil
+			if err != nil {
+				return nil, err
+			}
+		}
+		if index >= len(img.layers) {
+			return nil, io.EOF
+		}
+		lr, err := openLayer(img.layers[index])
+		if err != nil {
+			return nil, err
+		}
+		current = lr
+		index++
+		return tar.NewReader(lr.reader), nil
+	}
+	return untar.DecodeLayers(nextLayer, hasher, filter)
+}
+
+func (img *Image) forEachLayer(layerFunc func(*tar.Reader) error) error {
+	for _, layer := range img.layers {
+		lr, err := openLayer(layer)
+		if err != nil {
+			return err
+		}
+		if err := layerFunc(tar.NewReader(lr.reader)); err != nil {
+			lr.close()
+			return err
+		}
+		if err := lr.closeAndVerify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/memory"
+)
+
+type testEntry struct {
+	name string
+	data string // Directory if name ends in "/".
+	link string // Symbolic link if not empty.
+}
+
+type testHasher struct {
+	objSrv *memory.ObjectServer
+}
+
+func (h testHasher) Hash(reader io.Reader, length uint64) (hash.Hash, error) {
+	hashVal, _, err := h.objSrv.AddObject(reader, length, nil)
+	return hashVal, err
+}
+
+func makeLayer(t *testing.T, entries []testEntry, compress bool) []byte {
+	buffer := &bytes.Buffer{}
+	var writer io.Writer = buffer
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(buffer)
+		writer = gzipWriter
+	}
+	tarWriter := tar.NewWriter(writer)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644}
+		if entry.link != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.link
+		} else if entry.name[len(entry.name)-1] == '/' {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = int64(len(entry.data))
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func makeLayout(t *testing.T, dirname string, layers [][]testEntry) {
+	err := os.MkdirAll(filepath.Join(dirname, "blobs", "sha256"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	manifest.SchemaVersion = 2
+	for index, entries := range layers {
+		data := makeLayer(t, entries, index%2 == 0)
+		descriptor, err := writeBlob(dirname, MediaTypeImageLayerGzip, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Layers = append(manifest.Layers, descriptor)
+	}
+	manifest.Config, err = writeJsonBlob(dirname, MediaTypeImageConfig,
+		ImageConfig{Architecture: "amd64", OS: "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor, err := writeJsonBlob(dirname, MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(Index{
+		Manifests:     []Descriptor{descriptor},
+		SchemaVersion: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dirname, "index.json"), data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listFileSystem returns a map of pathnames to file contents. Directories
+// have an empty content.
+func listFileSystem(t *testing.T, fs *filesystem.FileSystem,
+	objSrv *memory.ObjectServer) map[string]string {
+	result := make(map[string]string)
+	var walk func(dirname string, inode *filesystem.DirectoryInode)
+	walk = func(dirname string, inode *filesystem.DirectoryInode) {
+		for _, entry := range inode.EntryList {
+			name := path.Join(dirname, entry.Name)
+			switch inode := entry.Inode().(type) {
+			case *filesystem.DirectoryInode:
+				result[name+"/"] = ""
+				walk(name, inode)
+			case *filesystem.RegularInode:
+				if inode.Size < 1 {
+					result[name] = ""
+					continue
+				}
+				_, reader, err := objSrv.GetObject(inode.Hash)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := io.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				result[name] = string(data)
+			}
+		}
+	}
+	walk("/", &fs.DirectoryInode)
+	return result
+}
+
+func openAndDecode(t *testing.T, pathname string,
+	objSrv *memory.ObjectServer) map[string]string {
+	img, err := Open(pathname, OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Close()
+	fs, err := img.Decode(testHasher{objSrv}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listFileSystem(t, fs, objSrv)
+}
+
+func checkContents(t *testing.T, got, expected map[string]string) {
+	if len(got) != len(expected) {
+		t.Errorf("got: %v, expected: %v", got, expected)
+		return
+	}
+	for name, data := range expected {
+		if gotData, ok := got[name]; !ok {
+			t.Errorf("missing: %s", name)
+		} else if gotData != data {
+			t.Errorf("%s: got: \"%s\", expected: \"%s\"", name, gotData, data)
+		}
+	}
+}
+
+var testLayers = [][]testEntry{
+	{
+		{name: "etc/"},
+		{name: "etc/a", data: "one"},
+		{name: "etc/b", data: "two"},
+		{name: "var/"},
+		{name: "var/lib/"},
+		{name: "var/lib/x", data: "old"},
+	},
+	{
+		{name: "etc/.wh.a"},
+		{name: "etc/b", data: "two-v2"},
+		{name: "var/.wh..wh..opq"},
+		{name: "var/y", data: "new"},
+	},
+}
+
+var testExpected = map[string]string{
+	"/etc/":  "",
+	"/etc/b": "two-v2",
+	"/var/":  "",
+	"/var/y": "new",
+}
+
+func TestDecodeWhiteouts(t *testing.T) {
+	dirname := t.TempDir()
+	makeLayout(t, dirname, testLayers)
+	checkContents(t,
+		openAndDecode(t, dirname, memory.NewObjectServer()), testExpected)
+}
+
+func TestCorruptLayer(t *testing.T) {
+	dirname := t.TempDir()
+	makeLayout(t, dirname, testLayers)
+	img, err := Open(dirname, OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Close()
+	file, err := os.OpenFile(img.layers[1].pathname, os.O_WRONLY|os.O_APPEND,
+		0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("garbage"))
+	file.Close()
+	_, err = img.Decode(testHasher{memory.NewObjectServer()}, nil)
+	if err == nil {
+		t.Fatal("corrupt layer not detected")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("requires root")
+	}
+	dirname := t.TempDir()
+	makeLayout(t, dirname, testLayers)
+	img, err := Open(dirname, OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer img.Close()
+	rootDir := t.TempDir()
+	if err := img.Extract(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	err = filepath.Walk(rootDir,
+		func(pathname string, fi os.FileInfo, err error) error {
+			if err != nil || pathname == rootDir {
+				return err
+			}
+			name := pathname[len(rootDir):]
+			if fi.IsDir() {
+				got[name+"/"] = ""
+				return nil
+			}
+			data, err := os.ReadFile(pathname)
+			got[name] = string(data)
+			return err
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkContents(t, got, testExpected)
+}
+
+func TestWriteAndOpen(t *testing.T) {
+	dirname := t.TempDir()
+	makeLayout(t, dirname, testLayers)
+	objSrv := memory.NewObjectServer()
+	img, err := Open(dirname, OpenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := img.Decode(testHasher{objSrv}, nil)
+	img.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	for _, name := range []string{"layout", "layout.tar"} {
+		pathname := filepath.Join(outputDir, name)
+		err := Write(pathname, fs, objSrv, WriteOptions{Reference: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkContents(t, openAndDecode(t, pathname, objSrv), testExpected)
+	}
+}
+
+func unpackTestTarfile(t *testing.T, dirname string,
+	entries []testEntry) error {
+	filename := filepath.Join(t.TempDir(), "archive.tar")
+	err := os.WriteFile(filename, makeLayer(t, entries, false), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unpackTarfile(filename, dirname)
+}
+
+func TestUnpackTarfileLinks(t *testing.T) {
+	dirname := t.TempDir()
+	err := unpackTestTarfile(t, dirname, []testEntry{
+		{name: "layer0/layer.tar", data: "layer"},
+		{name: "layer1/layer.tar", link: "../layer2/layer.tar"},
+		{name: "layer2/layer.tar", link: "../layer0/layer.tar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"layer1/layer.tar", "layer2/layer.tar"} {
+		pathname := filepath.Join(dirname, name)
+		if fi, err := os.Lstat(pathname); err != nil {
+			t.Fatal(err)
+		} else if !fi.Mode().IsRegular() {
+			t.Errorf("%s is not a regular file", name)
+		}
+		if data, err := os.ReadFile(pathname); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "layer" {
+			t.Errorf("%s: \"%s\" != \"layer\"", name, string(data))
+		}
+	}
+}
+
+func TestUnpackTarfileTraversal(t *testing.T) {
+	tests := map[string][]testEntry{
+		"absolute": {
+			{name: "link", link: "/etc/passwd"},
+		},
+		"chained": {
+			{name: "a/b", link: ".."},
+			{name: "a/b/c", link: ".."},
+			{name: "a/b/c/x", data: "escaped"},
+		},
+		"directory": {
+			{name: "a/", data: ""},
+			{name: "link", link: "a"},
+			{name: "link/x", data: "escaped"},
+		},
+		"parent": {
+			{name: "a/link", link: "../../x"},
+		},
+	}
+	for name, entries := range tests {
+		topDir := t.TempDir()
+		dirname := filepath.Join(topDir, "unpack")
+		if err := os.Mkdir(dirname, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := unpackTestTarfile(t, dirname, entries); err == nil {
+			t.Errorf("%s: unsafe tarfile unpacked", name)
+		}
+		for _, leafName := range []string{"c", "x"} {
+			if _, err := os.Lstat(filepath.Join(topDir, leafName)); err == nil {
+				t.Errorf("%s: wrote outside of directory: %s", name, leafName)
+			}
+		}
+		err := filepath.Walk(dirname,
+			func(pathname string, fi os.FileInfo, err error) error {
+				if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+					t.Errorf("%s: symlink created: %s", name, pathname)
+				}
+				return err
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
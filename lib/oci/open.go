@@ -0,0 +1,370 @@
+package oci
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+const annotationContainerdName = "io.containerd.image.name"
+
+type dockerManifest struct {
+	Config   string
+	Layers   []string
+	RepoTags []string
+}
+
+type layerType struct {
+	digest   string // Empty if unknown.
+	pathname string
+}
+
+func open(pathname string, options OpenOptions) (*Image, error) {
+	fi, err := os.Stat(pathname)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return openDirectory(pathname, options)
+	}
+	tmpDir, err := os.MkdirTemp("", "oci-image")
+	if err != nil {
+		return nil, err
+	}
+	if err := unpackTarfile(pathname, tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	img, err := openDirectory(tmpDir, options)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, err
+	}
+	img.tmpDir = tmpDir
+	return img, nil
+}
+
+func blobPathname(dirname, digest string) (string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || encoded == "" ||
+		strings.ContainsAny(algorithm+encoded, "/.") {
+		return "", fmt.Errorf("invalid digest: \"%s\"", digest)
+	}
+	return filepath.Join(dirname, "blobs", algorithm, encoded), nil
+}
+
+func matchPlatform(platform *Platform, wanted string) bool {
+	if platform == nil {
+		return false
+	}
+	name := platform.OS + "/" + platform.Architecture
+	if name == wanted {
+		return true
+	}
+	return platform.Variant != "" && name+"/"+platform.Variant == wanted
+}
+
+func openDirectory(dirname string, options OpenOptions) (*Image, error) {
+	if options.Platform == "" {
+		options.Platform = "linux/" + runtime.GOARCH
+	}
+	var index Index
+	err := readJson(filepath.Join(dirname, "index.json"), &index)
+	if err == nil {
+		return openLayout(dirname, index, options)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	var manifests []dockerManifest
+	err = readJson(filepath.Join(dirname, "manifest.json"), &manifests)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New(
+				"no index.json or manifest.json: not an OCI layout or Docker archive")
+		}
+		return nil, err
+	}
+	return openDockerArchive(dirname, manifests, options)
+}
+
+func openDockerArchive(dirname string, manifests []dockerManifest,
+	options OpenOptions) (*Image, error) {
+	var selected *dockerManifest
+	for index, manifest := range manifests {
+		if options.Reference == "" {
+			if selected != nil {
+				return nil, errors.New(
+					"multiple images in archive: specify a reference")
+			}
+			selected = &manifests[index]
+			continue
+		}
+		for _, tag := range manifest.RepoTags {
+			if tag == options.Reference {
+				selected = &manifests[index]
+			}
+		}
+	}
+	if selected == nil {
+		return nil, fmt.Errorf("image: \"%s\" not found in archive",
+			options.Reference)
+	}
+	img := &Image{}
+	configPathname, err := safeJoin(dirname, selected.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := readJson(configPathname, &img.Config); err != nil {
+		return nil, err
+	}
+	diffIDs := img.Config.RootFS.DiffIDs
+	if len(diffIDs) != len(selected.Layers) {
+		diffIDs = nil
+	}
+	for index, layer := range selected.Layers {
+		pathname, err := safeJoin(dirname, layer)
+		if err != nil {
+			return nil, err
+		}
+		newLayer := layerType{pathname: pathname}
+		if diffIDs != nil {
+			// Layers in a Docker archive are not compressed.
+			newLayer.digest = diffIDs[index]
+		}
+		img.layers = append(img.layers, newLayer)
+		img.Manifest.Layers = append(img.Manifest.Layers, Descriptor{
+			Digest:    newLayer.digest,
+			MediaType: MediaTypeImageLayer,
+		})
+	}
+	return img, nil
+}
+
+func openLayout(dirname string, index Index, options OpenOptions) (
+	*Image, error) {
+	descriptor, err := selectManifest(dirname, index, options, true)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{}
+	if err := readBlobJson(dirname, descriptor, &img.Manifest); err != nil {
+		return nil, err
+	}
+	err = readBlobJson(dirname, img.Manifest.Config, &img.Config)
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range img.Manifest.Layers {
+		pathname, err := blobPathname(dirname, layer.Digest)
+		if err != nil {
+			return nil, err
+		}
+		img.layers = append(img.layers,
+			layerType{digest: layer.Digest, pathname: pathname})
+	}
+	return img, nil
+}
+
+func readBlobJson(dirname string, descriptor Descriptor,
+	value interface{}) error {
+	pathname, err := blobPathname(dirname, descriptor.Digest)
+	if err != nil {
+		return err
+	}
+	return readJson(pathname, value)
+}
+
+func readJson(pathname string, value interface{}) error {
+	file, err := os.Open(pathname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(value); err != nil {
+		return fmt.Errorf("error decoding: %s: %s", pathname, err)
+	}
+	return nil
+}
+
+func safeJoin(dirname, name string) (string, error) {
+	for _, component := range strings.Split(name, "/") {
+		if component == ".." {
+			return "", fmt.Errorf("unsafe pathname: \"%s\"", name)
+		}
+	}
+	return filepath.Join(dirname, name), nil
+}
+
+// selectManifest will select a manifest from an index, descending into nested
+// indices. References are only matched at the top level.
+func selectManifest(dirname string, index Index, options OpenOptions,
+	topLevel bool) (Descriptor, error) {
+	var candidates []Descriptor
+	for _, descriptor := range index.Manifests {
+		if topLevel && options.Reference != "" {
+			name := descriptor.Annotations[AnnotationRefName]
+			fullName := descriptor.Annotations[annotationContainerdName]
+			if name != options.Reference && fullName != options.Reference {
+				continue
+			}
+		}
+		candidates = append(candidates, descriptor)
+	}
+	if len(candidates) < 1 {
+		if options.Reference != "" && topLevel {
+			return Descriptor{}, fmt.Errorf("image: \"%s\" not found in index",
+				options.Reference)
+		}
+		return Descriptor{}, errors.New("no manifests in index")
+	}
+	if len(candidates) > 1 {
+		var matched []Descriptor
+		for _, descriptor := range candidates {
+			if matchPlatform(descriptor.Platform, options.Platform) {
+				matched = append(matched, descriptor)
+			}
+		}
+		if len(matched) != 1 {
+			return Descriptor{}, fmt.Errorf(
+				"%d images match platform: %s, specify a reference",
+				len(matched), options.Platform)
+		}
+		candidates = matched
+	}
+	descriptor := candidates[0]
+	switch descriptor.MediaType {
+	case MediaTypeImageIndex, MediaTypeDockerManifestList:
+		var subIndex Index
+		if err := readBlobJson(dirname, descriptor, &subIndex); err != nil {
+			return Descriptor{}, err
+		}
+		return selectManifest(dirname, subIndex, options, false)
+	}
+	return descriptor, nil
+}
+
+// resolveSymlink returns the name of the entry which the symbolic link name
+// refers to, following other symbolic links in links. Names are relative to the
+// top of the tree. Links which are absolute or refer to entries outside of the
+// tree are rejected.
+func resolveSymlink(links map[string]string, name string) (string, error) {
+	for count := 0; count < 16; count++ {
+		linkname, ok := links[name]
+		if !ok {
+			return name, nil
+		}
+		target := path.Join(path.Dir(name), linkname)
+		if path.IsAbs(linkname) || target == ".." ||
+			strings.HasPrefix(target, "../") {
+			return "", fmt.Errorf("unsafe symlink: \"%s\" -> \"%s\"",
+				name, linkname)
+		}
+		name = target
+	}
+	return "", fmt.Errorf("too many levels of symlinks: \"%s\"", name)
+}
+
+// unpackTarfile will unpack the directories and regular files in a tarfile
+// into a directory. Entries with unsafe pathnames are rejected. Symbolic links
+// are not created, since they could be used to write or read outside of the
+// directory. Instead, links to regular files (Docker archives may link to
+// duplicate layers) are resolved by name and replaced with hard links.
+func unpackTarfile(filename, dirname string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	links := make(map[string]string)
+	tarReader := tar.NewReader(file)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pathname, err := safeJoin(dirname, header.Name)
+		if err != nil {
+			return err
+		}
+		name := path.Clean("/" + header.Name)[1:]
+		switch header.Typeflag {
+		case tar.TypeDir:
+			delete(links, name)
+			if err := os.MkdirAll(pathname, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			delete(links, name)
+			if err := unpackFile(tarReader, pathname); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if name == "" {
+				return errors.New("symlink for top-level directory")
+			}
+			links[name] = header.Linkname
+		}
+	}
+	for name := range links {
+		target, err := resolveSymlink(links, name)
+		if err != nil {
+			return err
+		}
+		targetPathname := filepath.Join(dirname, target)
+		// There are no symbolic links in the tree, so this is not followed.
+		if fi, err := os.Lstat(targetPathname); err != nil {
+			return err
+		} else if !fi.Mode().IsRegular() {
+			return fmt.Errorf("symlink: \"%s\" to: \"%s\" is not a file",
+				name, target)
+		}
+		pathname := filepath.Join(dirname, name)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			return err
+		}
+		if err := os.Remove(pathname); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Link(targetPathname, pathname); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unpackFile(reader io.Reader, pathname string) error {
+	if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(pathname,
+		os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (img *Image) close() error {
+	if img.tmpDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(img.tmpDir)
+	img.tmpDir = ""
+	return err
+}
@@ -0,0 +1,238 @@
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	fstar "github.com/Cloud-Foundations/Dominator/lib/filesystem/tar"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+)
+
+const imageLayoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+
+type countingWriter struct {
+	count  int64
+	writer io.Writer
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	nWritten, err := w.writer.Write(p)
+	w.count += int64(nWritten)
+	return nWritten, err
+}
+
+func digestString(hasher hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil))
+}
+
+func write(pathname string, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter, options WriteOptions) error {
+	if !strings.HasSuffix(pathname, ".tar") {
+		return writeLayout(pathname, fs, objectsGetter, options)
+	}
+	tmpDir, err := os.MkdirTemp("", "oci-image")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := writeLayout(tmpDir, fs, objectsGetter, options); err != nil {
+		return err
+	}
+	return writeTarfile(pathname, tmpDir)
+}
+
+func writeBlob(dirname, mediaType string, data []byte) (Descriptor, error) {
+	hasher := sha256.New()
+	hasher.Write(data)
+	descriptor := Descriptor{
+		Digest:    digestString(hasher),
+		MediaType: mediaType,
+		Size:      int64(len(data)),
+	}
+	pathname, err := blobPathname(dirname, descriptor.Digest)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return descriptor, os.WriteFile(pathname, data, 0644)
+}
+
+func writeJsonBlob(dirname, mediaType string, value interface{}) (
+	Descriptor, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return writeBlob(dirname, mediaType, data)
+}
+
+// writeLayer will write the file-system as a gzip compressed layer. The
+// descriptor and the digest of the uncompressed data (the diff ID) are
+// returned.
+func writeLayer(dirname string, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter) (Descriptor, string, error) {
+	blobDir := filepath.Join(dirname, "blobs", "sha256")
+	file, err := os.CreateTemp(blobDir, ".layer")
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	defer os.Remove(file.Name())
+	digestHasher := sha256.New()
+	diffIdHasher := sha256.New()
+	counter := &countingWriter{writer: io.MultiWriter(file, digestHasher)}
+	gzipWriter := gzip.NewWriter(counter)
+	err = fstar.Write(io.MultiWriter(gzipWriter, diffIdHasher), fs,
+		objectsGetter)
+	if err != nil {
+		file.Close()
+		return Descriptor{}, "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		file.Close()
+		return Descriptor{}, "", err
+	}
+	if err := file.Close(); err != nil {
+		return Descriptor{}, "", err
+	}
+	descriptor := Descriptor{
+		Digest:    digestString(digestHasher),
+		MediaType: MediaTypeImageLayerGzip,
+		Size:      counter.count,
+	}
+	pathname, err := blobPathname(dirname, descriptor.Digest)
+	if err != nil {
+		return Descriptor{}, "", err
+	}
+	if err := os.Rename(file.Name(), pathname); err != nil {
+		return Descriptor{}, "", err
+	}
+	return descriptor, digestString(diffIdHasher), nil
+}
+
+func writeLayout(dirname string, fs *filesystem.FileSystem,
+	objectsGetter objectserver.ObjectsGetter, options WriteOptions) error {
+	if options.Architecture == "" {
+		options.Architecture = runtime.GOARCH
+	}
+	err := os.MkdirAll(filepath.Join(dirname, "blobs", "sha256"), 0755)
+	if err != nil {
+		return err
+	}
+	layer, diffId, err := writeLayer(dirname, fs, objectsGetter)
+	if err != nil {
+		return err
+	}
+	config := ImageConfig{
+		Architecture: options.Architecture,
+		Config:       ContainerConfig{Labels: options.Labels},
+		OS:           "linux",
+		RootFS: RootFS{
+			DiffIDs: []string{diffId},
+			Type:    "layers",
+		},
+	}
+	if !options.Created.IsZero() {
+		created := options.Created.UTC()
+		config.Created = &created
+	}
+	configDescriptor, err := writeJsonBlob(dirname, MediaTypeImageConfig,
+		config)
+	if err != nil {
+		return err
+	}
+	manifestDescriptor, err := writeJsonBlob(dirname, MediaTypeImageManifest,
+		Manifest{
+			Config:        configDescriptor,
+			Layers:        []Descriptor{layer},
+			MediaType:     MediaTypeImageManifest,
+			SchemaVersion: 2,
+		})
+	if err != nil {
+		return err
+	}
+	manifestDescriptor.Platform = &Platform{
+		Architecture: options.Architecture,
+		OS:           "linux",
+	}
+	if options.Reference != "" {
+		manifestDescriptor.Annotations = map[string]string{
+			AnnotationRefName: options.Reference,
+		}
+	}
+	data, err := json.Marshal(Index{
+		Manifests:     []Descriptor{manifestDescriptor},
+		MediaType:     MediaTypeImageIndex,
+		SchemaVersion: 2,
+	})
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dirname, "index.json"), data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dirname, "oci-layout"),
+		[]byte(imageLayoutVersion), 0644)
+}
+
+// writeTarfile will write the contents of a directory to a tarfile.
+func writeTarfile(filename, dirname string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	tarWriter := tar.NewWriter(file)
+	err = filepath.Walk(dirname,
+		func(pathname string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(dirname, pathname)
+			if err != nil {
+				return err
+			}
+			if name == "." {
+				return nil
+			}
+			header, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(name)
+			if fi.IsDir() {
+				header.Name += "/"
+			}
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			source, err := os.Open(pathname)
+			if err != nil {
+				return err
+			}
+			defer source.Close()
+			_, err = io.Copy(tarWriter, source)
+			return err
+		})
+	if err != nil {
+		tarWriter.Close()
+		file.Close()
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -109,6 +109,31 @@ func Ioctl(fd int, request, argp uintptr) error {
 	return ioctl(fd, request, argp)
 }
 
+// Lgetxattr reads the value of the named extended attribute of path, without
+// following symlinks. If dest is empty the size of the value is returned.
+func Lgetxattr(path, attr string, dest []byte) (int, error) {
+	return lgetxattr(path, attr, dest)
+}
+
+// Llistxattr reads the list of NUL-terminated extended attribute names of path
+// into dest, without following symlinks. If dest is empty the size of the list
+// is returned.
+func Llistxattr(path string, dest []byte) (int, error) {
+	return llistxattr(path, dest)
+}
+
+// Lremovexattr removes the named extended attribute of path, without following
+// symlinks.
+func Lremovexattr(path, attr string) error {
+	return lremovexattr(path, attr)
+}
+
+// Lsetxattr sets the value of the named extended attribute of path, without
+// following symlinks.
+func Lsetxattr(path, attr string, data []byte, flags int) error {
+	return lsetxattr(path, attr, data, flags)
+}
+
 func Lstat(path string, statbuf *Stat_t) error {
 	return lstat(path, statbuf)
 }
@@ -16,6 +16,8 @@ import (
 	"strconv"
 	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -186,6 +188,22 @@ func ioctl(fd int, request, argp uintptr) error {
 	return nil
 }
 
+func lgetxattr(path, attr string, dest []byte) (int, error) {
+	return unix.Lgetxattr(path, attr, dest)
+}
+
+func llistxattr(path string, dest []byte) (int, error) {
+	return unix.Llistxattr(path, dest)
+}
+
+func lremovexattr(path, attr string) error {
+	return unix.Lremovexattr(path, attr)
+}
+
+func lsetxattr(path, attr string, data []byte, flags int) error {
+	return unix.Lsetxattr(path, attr, data, flags)
+}
+
 func lstat(path string, statbuf *Stat_t) error {
 	var rawStatbuf syscall.Stat_t
 	if err := syscall.Lstat(path, &rawStatbuf); err != nil {
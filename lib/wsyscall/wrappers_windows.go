@@ -70,6 +70,22 @@ func ioctl(fd int, request, argp uintptr) error {
 	return syscall.ENOTSUP
 }
 
+func lgetxattr(path, attr string, dest []byte) (int, error) {
+	return 0, syscall.ENOTSUP
+}
+
+func llistxattr(path string, dest []byte) (int, error) {
+	return 0, syscall.ENOTSUP
+}
+
+func lremovexattr(path, attr string) error {
+	return syscall.ENOTSUP
+}
+
+func lsetxattr(path, attr string, data []byte, flags int) error {
+	return syscall.ENOTSUP
+}
+
 func lstat(path string, statbuf *Stat_t) error {
 	return syscall.ENOTSUP
 }
@@ -2,6 +2,7 @@ package rpcd
 
 import (
 	"io"
+	"sync/atomic"
 
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
@@ -14,6 +15,7 @@ type Config struct {
 	AllowPublicAddObjects   bool
 	AllowPublicCheckObjects bool
 	AllowPublicGetObjects   bool
+	CompressGetObjects      bool // Compress on the fly if client accepts.
 	ReplicationMaster       string
 }
 
@@ -22,15 +24,23 @@ type Params struct {
 	ObjectServer objectserver.StashingObjectServer
 }
 
+type getStatsType struct {
+	logicalBytesSent uint64 // Uncompressed object bytes.
+	wireBytesSent    uint64 // Object bytes including framing.
+}
+
 type srpcType struct {
-	objectServer      objectserver.StashingObjectServer
-	replicationMaster string
-	getSemaphore      chan bool
-	logger            log.DebugLogger
+	compressGetObjects bool
+	objectServer       objectserver.StashingObjectServer
+	replicationMaster  string
+	getSemaphore       chan bool
+	logger             log.DebugLogger
+	stats              *getStatsType
 }
 
 type htmlWriter struct {
 	getSemaphore chan bool
+	stats        *getStatsType
 }
 
 func (hw *htmlWriter) WriteHtml(writer io.Writer) {
@@ -39,11 +49,14 @@ func (hw *htmlWriter) WriteHtml(writer io.Writer) {
 
 func Setup(config Config, params Params) *htmlWriter {
 	getSemaphore := make(chan bool, 100)
+	stats := &getStatsType{}
 	srpcObj := &srpcType{
-		objectServer:      params.ObjectServer,
-		replicationMaster: config.ReplicationMaster,
-		getSemaphore:      getSemaphore,
-		logger:            params.Logger,
+		compressGetObjects: config.CompressGetObjects,
+		objectServer:       params.ObjectServer,
+		replicationMaster:  config.ReplicationMaster,
+		getSemaphore:       getSemaphore,
+		logger:             params.Logger,
+		stats:              stats,
 	}
 	var publicMethods []string
 	if config.AllowPublicAddObjects {
@@ -60,5 +73,11 @@ func Setup(config Config, params Params) *htmlWriter {
 	tricorder.RegisterMetric("/get-requests",
 		func() uint { return uint(len(getSemaphore)) },
 		units.None, "number of GetObjects() requests in progress")
-	return &htmlWriter{getSemaphore}
+	tricorder.RegisterMetric("/get-objects-logical-bytes",
+		func() uint64 { return atomic.LoadUint64(&stats.logicalBytesSent) },
+		units.Byte, "uncompressed object bytes sent by GetObjects()")
+	tricorder.RegisterMetric("/get-objects-wire-bytes",
+		func() uint64 { return atomic.LoadUint64(&stats.wireBytesSent) },
+		units.Byte, "object bytes sent on the wire by GetObjects()")
+	return &htmlWriter{getSemaphore, stats}
 }
@@ -1,22 +1,32 @@
 package rpcd
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/compression"
 	"github.com/Cloud-Foundations/Dominator/lib/srpc"
-	"github.com/Cloud-Foundations/Dominator/proto/objectserver"
+	proto "github.com/Cloud-Foundations/Dominator/proto/objectserver"
 )
 
+// Objects smaller than this are not worth compressing on the fly.
+const minimumCompressSize = 512
+
 var exclusive sync.RWMutex
 
+type countingWriter struct {
+	count  uint64
+	writer io.Writer
+}
+
 func (objSrv *srpcType) GetObjects(conn *srpc.Conn) error {
 	defer conn.Flush()
-	var request objectserver.GetObjectsRequest
-	var response objectserver.GetObjectsResponse
+	var request proto.GetObjectsRequest
+	var response proto.GetObjectsResponse
 	if request.Exclusive {
 		exclusive.Lock()
 		defer exclusive.Unlock()
@@ -62,35 +72,127 @@ func (objSrv *srpcType) GetObjects(conn *srpc.Conn) error {
 		return conn.Encode(response)
 	}
 	defer objectsReader.Close()
+	response.Compression = objSrv.selectCompression(request.Compressions,
+		objectsReader)
 	if err := conn.Encode(response); err != nil {
 		return err
 	}
 	conn.Flush()
 	buffer := make([]byte, 32<<10)
+	writer := &countingWriter{writer: conn}
 	for _, hashVal := range request.Hashes {
-		length, reader, err := objectsReader.NextObject()
-		if err != nil {
-			objSrv.logger.Println(err)
-			return err
-		}
-		nCopied, err := io.CopyBuffer(conn, reader, buffer)
-		reader.Close()
+		length, err := objSrv.sendObject(writer, objectsReader,
+			response.Compression, buffer)
 		if err != nil {
-			objSrv.logger.Printf("Error copying: %s\n", err)
+			objSrv.logger.Printf("Error sending: %x: %s\n", hashVal, err)
 			return err
 		}
-		if nCopied != int64(length) {
-			txt := fmt.Sprintf("Expected length: %d, got: %d for: %x",
-				length, nCopied, hashVal)
-			objSrv.logger.Printf(txt)
-			return errors.New(txt)
-		}
+		atomic.AddUint64(&objSrv.stats.logicalBytesSent, length)
+		atomic.AddUint64(&objSrv.stats.wireBytesSent, writer.count)
+		writer.count = 0
 	}
 	objSrv.logger.Debugf(0, "GetObjects() sent: %d objects\n",
 		len(request.Hashes))
 	return nil
 }
 
+func copyObject(writer io.Writer, reader io.Reader, length uint64,
+	buffer []byte) error {
+	nCopied, err := io.CopyBuffer(writer, reader, buffer)
+	if err != nil {
+		return err
+	}
+	if nCopied != int64(length) {
+		return fmt.Errorf("expected length: %d, got: %d", length, nCopied)
+	}
+	return nil
+}
+
 func releaseSemaphore(semaphore <-chan bool) {
 	<-semaphore
 }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	nWritten, err := w.writer.Write(p)
+	w.count += uint64(nWritten)
+	return nWritten, err
+}
+
+// selectCompression returns the first of the compression methods accepted by
+// the client which is supported, or "" if objects should not be compressed.
+// Unless compressing on the fly is enabled, compression is only selected if
+// objects may be sent pre-compressed.
+func (objSrv *srpcType) selectCompression(methods []string,
+	objectsReader objectserver.ObjectsReader) string {
+	if !objSrv.compressGetObjects {
+		if _, ok := objectsReader.(objectserver.CompressedObjectsReader); !ok {
+			return ""
+		}
+	}
+	for _, method := range methods {
+		if compression.IsSupported(method) {
+			return method
+		}
+	}
+	return ""
+}
+
+// sendObject will send the next object yielded by objectsReader, compressing
+// it if method is not empty. The object length is returned.
+func (objSrv *srpcType) sendObject(writer io.Writer,
+	objectsReader objectserver.ObjectsReader, method string,
+	buffer []byte) (uint64, error) {
+	if method == "" {
+		length, reader, err := objectsReader.NextObject()
+		if err != nil {
+			return 0, err
+		}
+		defer reader.Close()
+		return length, copyObject(writer, reader, length, buffer)
+	}
+	var length uint64
+	var reader io.ReadCloser
+	var preCompressed bool
+	var err error
+	if cor, ok := objectsReader.(objectserver.CompressedObjectsReader); ok {
+		length, reader, preCompressed, err = cor.NextCompressedObject(method)
+	} else {
+		length, reader, err = objectsReader.NextObject()
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	if !preCompressed &&
+		(!objSrv.compressGetObjects || length < minimumCompressSize) {
+		_, err := writer.Write([]byte{proto.GetObjectsFlagUncompressed})
+		if err != nil {
+			return 0, err
+		}
+		return length, copyObject(writer, reader, length, buffer)
+	}
+	_, err = writer.Write([]byte{proto.GetObjectsFlagCompressed})
+	if err != nil {
+		return 0, err
+	}
+	chunkWriter := compression.NewChunkWriter(writer)
+	if preCompressed {
+		if _, err := io.CopyBuffer(chunkWriter, reader, buffer); err != nil {
+			return 0, err
+		}
+	} else {
+		compressor, err := compression.NewWriter(method, chunkWriter)
+		if err != nil {
+			return 0, err
+		}
+		err = copyObject(compressor, reader, length, buffer)
+		if err != nil {
+			compressor.Close()
+			return 0, err
+		}
+		if err := compressor.Close(); err != nil {
+			return 0, err
+		}
+	}
+	return length, chunkWriter.Close()
+}
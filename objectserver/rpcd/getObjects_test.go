@@ -0,0 +1,145 @@
+package rpcd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/log/testlogger"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/compression"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/objectserver/memory"
+	proto "github.com/Cloud-Foundations/Dominator/proto/objectserver"
+)
+
+var testObjects = [][]byte{
+	bytes.Repeat([]byte("a compressible object "), 1000),
+	[]byte("tiny"),
+}
+
+func addTestObjects(t *testing.T,
+	objSrv objectserver.ObjectServer) []hash.Hash {
+	var hashes []hash.Hash
+	for _, data := range testObjects {
+		hashVal, _, err := objSrv.AddObject(bytes.NewReader(data),
+			uint64(len(data)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hashVal)
+	}
+	return hashes
+}
+
+// receiveObject decodes an object sent with a flag byte, returning the data and
+// true if it was compressed.
+func receiveObject(t *testing.T, reader *bytes.Reader, method string,
+	length uint64) ([]byte, bool) {
+	flag, err := reader.ReadByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, length)
+	switch flag {
+	case proto.GetObjectsFlagUncompressed:
+		if _, err := io.ReadFull(reader, data); err != nil {
+			t.Fatal(err)
+		}
+		return data, false
+	case proto.GetObjectsFlagCompressed:
+		chunkReader := compression.NewChunkReader(reader)
+		decompressor, err := compression.NewReader(method, chunkReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decompressor.Close()
+		if _, err := io.ReadFull(decompressor, data); err != nil {
+			t.Fatal(err)
+		}
+		if err := chunkReader.Discard(); err != nil {
+			t.Fatal(err)
+		}
+		return data, true
+	}
+	t.Fatalf("unknown flag: %d", flag)
+	return nil, false
+}
+
+func testSendObjects(t *testing.T, srpcObj *srpcType,
+	objSrv objectserver.ObjectServer, hashes []hash.Hash) {
+	objectsReader, err := objSrv.GetObjects(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer objectsReader.Close()
+	method := srpcObj.selectCompression([]string{"bogus", compression.Zstd},
+		objectsReader)
+	if method != compression.Zstd {
+		t.Fatalf("selected compression: \"%s\"", method)
+	}
+	buffer := &bytes.Buffer{}
+	for index := range hashes {
+		length, err := srpcObj.sendObject(buffer, objectsReader, method,
+			make([]byte, 4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length != uint64(len(testObjects[index])) {
+			t.Fatalf("object: %d length: %d", index, length)
+		}
+	}
+	reader := bytes.NewReader(buffer.Bytes())
+	for index, object := range testObjects {
+		data, compressed := receiveObject(t, reader, method,
+			uint64(len(object)))
+		if !bytes.Equal(data, object) {
+			t.Errorf("object: %d content mismatch", index)
+		}
+		if compressed != (index == 0) {
+			t.Errorf("object: %d compressed: %v", index, compressed)
+		}
+	}
+	if reader.Len() > 0 {
+		t.Errorf("%d bytes remaining", reader.Len())
+	}
+}
+
+func TestSendObjectsCompressOnTheFly(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	hashes := addTestObjects(t, objSrv)
+	srpcObj := &srpcType{compressGetObjects: true, stats: &getStatsType{}}
+	testSendObjects(t, srpcObj, objSrv, hashes)
+}
+
+func TestSendObjectsPreCompressed(t *testing.T) {
+	objSrv, err := filesystem.NewObjectServerWithConfigAndParams(
+		filesystem.Config{
+			BaseDirectory: t.TempDir(),
+			Compression:   filesystem.CompressionConfig{Method: "zstd"},
+		},
+		filesystem.Params{Logger: testlogger.New(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := addTestObjects(t, objSrv)
+	srpcObj := &srpcType{stats: &getStatsType{}}
+	testSendObjects(t, srpcObj, objSrv, hashes)
+}
+
+func TestSelectCompressionNotSupported(t *testing.T) {
+	objSrv := memory.NewObjectServer()
+	hashes := addTestObjects(t, objSrv)
+	objectsReader, err := objSrv.GetObjects(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer objectsReader.Close()
+	srpcObj := &srpcType{stats: &getStatsType{}}
+	if method := srpcObj.selectCompression(compression.SupportedMethods(),
+		objectsReader); method != "" {
+		t.Errorf("selected compression: \"%s\" without on the fly support",
+			method)
+	}
+}
@@ -3,9 +3,20 @@ package rpcd
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
 )
 
 func (hw *htmlWriter) writeHtml(writer io.Writer) {
 	fmt.Fprintf(writer, "GetObjects() RPC slots: %d out of %d<br>\n",
 		len(hw.getSemaphore), cap(hw.getSemaphore))
+	logicalBytes := atomic.LoadUint64(&hw.stats.logicalBytesSent)
+	wireBytes := atomic.LoadUint64(&hw.stats.wireBytesSent)
+	if logicalBytes > 0 {
+		fmt.Fprintf(writer,
+			"GetObjects() sent: %s, on the wire: %s (%.1f%%)<br>\n",
+			format.FormatBytes(logicalBytes), format.FormatBytes(wireBytes),
+			float64(wireBytes)*100/float64(logicalBytes))
+	}
 }
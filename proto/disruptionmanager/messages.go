@@ -1,6 +1,8 @@
 package disruptionmanager
 
 import (
+	"time"
+
 	"github.com/Cloud-Foundations/Dominator/lib/mdb"
 	"github.com/Cloud-Foundations/Dominator/proto/sub"
 )
@@ -23,8 +25,9 @@ type DisruptionCheckRequest struct {
 
 // DisruptionCheck RPC response.
 type DisruptionCheckResponse struct {
-	Error    string
-	Response sub.DisruptionState
+	Error      string
+	NextWindow time.Time // Set if denied due to a maintenance window.
+	Response   sub.DisruptionState
 }
 
 // REST endpoint request.
@@ -35,7 +38,8 @@ type DisruptionRequest struct {
 
 // REST endpoint response.
 type DisruptionResponse struct {
-	Response sub.DisruptionState
+	NextWindow time.Time `json:",omitempty"` // Set if outside window.
+	Response   sub.DisruptionState
 }
 
 // DisruptionCheck RPC request.
@@ -45,8 +49,9 @@ type DisruptionRequestRequest struct {
 
 // DisruptionRequest RPC response.
 type DisruptionRequestResponse struct {
-	Error    string
-	Response sub.DisruptionState
+	Error      string
+	NextWindow time.Time // Set if denied due to a maintenance window.
+	Response   sub.DisruptionState
 }
 
 type RequestType uint
@@ -8,6 +8,18 @@ import (
 	"github.com/Cloud-Foundations/Dominator/proto/sub"
 )
 
+type AbortRolloutRequest struct {
+	ImageName string // The image being rolled out.
+}
+
+type AbortRolloutResponse struct{}
+
+type ClearBadImageRequest struct {
+	ImageName string
+}
+
+type ClearBadImageResponse struct{}
+
 type ClearSafetyShutoffRequest struct {
 	Hostname string
 }
@@ -74,6 +86,12 @@ type GetInfoForSubsResponse struct {
 	Subs  []SubInfo
 }
 
+type ListRolloutsRequest struct{}
+
+type ListRolloutsResponse struct {
+	Rollouts []RolloutState
+}
+
 type ListSubsRequest struct {
 	Hostnames        []string            // Empty: match all hostnames.
 	LocationsToMatch []string            // Empty: match all locations.
@@ -86,12 +104,73 @@ type ListSubsResponse struct {
 	Hostnames []string
 }
 
+type PauseRolloutRequest struct {
+	ImageName string // The image being rolled out.
+}
+
+type PauseRolloutResponse struct{}
+
+type PlanUpdateRequest struct {
+	Hostnames        []string       // Empty: match all hostnames.
+	ImageName        string         // Empty: use the required image.
+	LocationsToMatch []string       // Empty: match all locations.
+	StatusesToMatch  []string       // Empty: match all statuses.
+	TagsToMatch      tags.MatchTags // Empty: match all tags.
+}
+
+type PlanUpdateResponse struct {
+	Error string
+	Plans []UpdatePlan
+}
+
+type ResumeRolloutRequest struct {
+	ImageName string // The image being rolled out.
+}
+
+type ResumeRolloutResponse struct{}
+
+// RolloutPolicy describes how subs are moved from one image to another. Subs
+// with ToImage as their RequiredImage are kept on FromImage until they are
+// admitted to the rollout. The canary hosts are admitted first, followed by
+// waves which each admit up to a percentage of the subs. A final wave of 100%
+// is implied.
+type RolloutPolicy struct {
+	CanaryHosts     []string `json:",omitempty"`
+	FromImage       string
+	ToImage         string
+	WavePause       time.Duration `json:",omitempty"` // Pause between waves.
+	WavePercentages []uint        `json:",omitempty"`
+}
+
+type RolloutState struct {
+	RolloutPolicy
+	AdmittedHosts     []string `json:",omitempty"`
+	Aborted           bool     `json:",omitempty"`
+	FailedHosts       []string `json:",omitempty"` // Hosts which halted.
+	HaltReason        string   `json:",omitempty"`
+	NumSubs           uint     `json:",omitempty"`
+	Paused            bool     `json:",omitempty"`
+	PausedBy          string   `json:",omitempty"`
+	StartTime         time.Time
+	StartedBy         string    `json:",omitempty"`
+	UpdatedHosts      []string  `json:",omitempty"`
+	Wave              uint      // Zero for the canary hosts.
+	WaveCompletedTime time.Time `json:",omitempty"`
+	WaveStartTime     time.Time `json:",omitempty"` // Last admission.
+}
+
 type SetDefaultImageRequest struct {
 	ImageName string
 }
 
 type SetDefaultImageResponse struct{}
 
+type StartRolloutRequest struct {
+	RolloutPolicy
+}
+
+type StartRolloutResponse struct{}
+
 type SubInfo struct {
 	mdb.Machine
 	LastAddress         string              `json:",omitempty"`
@@ -105,3 +184,18 @@ type SubInfo struct {
 	Status              string
 	SystemUptime        *time.Duration `json:",omitempty"`
 }
+
+// UpdatePlan describes the changes an update would make to a sub.
+type UpdatePlan struct {
+	Hostname       string
+	Error          string   `json:",omitempty"`
+	ImageName      string   `json:",omitempty"`
+	BytesToFetch   uint64   `json:",omitempty"`
+	ObjectsToFetch uint     `json:",omitempty"`
+	PathsToAdd     []string `json:",omitempty"`
+	PathsToChange  []string `json:",omitempty"`
+	PathsToDelete  []string `json:",omitempty"`
+	Triggers       []string `json:",omitempty"` // Services to be restarted.
+	HighImpact     bool     `json:",omitempty"`
+	Reboot         bool     `json:",omitempty"`
+}
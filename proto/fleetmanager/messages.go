@@ -2,11 +2,16 @@ package fleetmanager
 
 import (
 	"net"
+	"time"
 
 	"github.com/Cloud-Foundations/Dominator/lib/tags"
 	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
+// VMs with the same value for this tag are placed on different Hypervisors and
+// are spread across topology directories.
+const AntiAffinityTagKey = "AntiAffinity"
+
 type ChangeMachineTagsRequest struct {
 	Hostname string
 	Tags     tags.Tags
@@ -16,6 +21,73 @@ type ChangeMachineTagsResponse struct {
 	Error string
 }
 
+// The CreateVmInLocation() RPC places a VM on a Hypervisor and forwards the
+// CreateVm() RPC to it. The client sends a single CreateVmInLocationRequest
+// message, followed by the data that the CreateVm() RPC requires. The server
+// sends a stream of CreateVmInLocationResponse messages.
+
+type CreateVmInLocationRequest struct {
+	HypervisorTagsToMatch tags.MatchTags // Empty: match all tags.
+	Location              string
+	proto.CreateVmRequest
+}
+
+type CreateVmInLocationResponse struct { // Multiple responses are sent.
+	HypervisorAddress string // host:port. Set once the VM is placed.
+	proto.CreateVmResponse
+}
+
+type DrainHypervisorRequest struct {
+	Hostname                string
+	Live                    bool          // Try live migration first.
+	Location                string        // Default: location of Hypervisor.
+	MaxConcurrentMigrations uint          // Default: 1.
+	MigrateProtectedVMs     bool          // Include VMs with DestroyProtection.
+	Timeout                 time.Duration // Default: 24 hours.
+}
+
+type DrainHypervisorResponse struct { // Multiple responses are sent.
+	Error           string
+	Final           bool // If true, this is the final response.
+	ProgressMessage string
+}
+
+// DrainState records the progress of draining a Hypervisor, so that the
+// drain may be resumed if the Fleet Manager is restarted.
+type DrainState struct {
+	DrainHypervisorRequest
+	AttemptedVMs map[string]struct{} `json:",omitempty"` // Key: IP.
+	FailedVMs    map[string]string   `json:",omitempty"` // Key: IP, value: error.
+	NumMigrated  uint
+	StartTime    time.Time
+	Username     string
+}
+
+// Flavour is a named set of VM parameters defined in the topology. Fields
+// with zero values are not applied.
+type Flavour struct {
+	ConsoleType          proto.ConsoleType    `json:",omitempty"`
+	FirmwareType         proto.FirmwareType   `json:",omitempty"`
+	MachineType          proto.MachineType    `json:",omitempty"`
+	MemoryInMiB          uint64               `json:",omitempty"`
+	MilliCPUs            uint                 `json:",omitempty"`
+	MinimumFreeBytes     uint64               `json:",omitempty"`
+	SecondaryVolumeSizes []uint64             `json:",omitempty"`
+	VirtualCPUs          uint                 `json:",omitempty"`
+	WatchdogAction       proto.WatchdogAction `json:",omitempty"`
+	WatchdogModel        proto.WatchdogModel  `json:",omitempty"`
+}
+
+type GetFlavourRequest struct {
+	Location string
+	Name     string
+}
+
+type GetFlavourResponse struct {
+	Error   string
+	Flavour Flavour
+}
+
 type GetHypervisorForVMRequest struct {
 	IpAddress net.IP
 }
@@ -78,6 +150,27 @@ type GetUpdatesRequest struct {
 	MaxUpdates             uint64 // Zero means infinite.
 }
 
+// Quotas contains the resource limits for the VMs of owners. Each VM is charged
+// to its primary owner and to each of its owner groups. Zero values mean no
+// limit.
+type Quotas struct {
+	OwnerGroups map[string]proto.OwnerResources `json:",omitempty"`
+	OwnerUsers  map[string]proto.OwnerResources `json:",omitempty"`
+}
+
+// ResourceUsage contains the sum of the stats for a set of VMs.
+type ResourceUsage struct {
+	CpuTime               time.Duration
+	MemoryRSS             uint64
+	NetworkRxBytes        uint64
+	NetworkTxBytes        uint64
+	NumVMs                uint
+	VolumeReadBytes       uint64
+	VolumeReadOperations  uint64
+	VolumeWriteBytes      uint64
+	VolumeWriteOperations uint64
+}
+
 type Update struct {
 	ChangedMachines []*Machine               `json:",omitempty"`
 	ChangedVMs      map[string]*proto.VmInfo `json:",omitempty"` // Key: IPaddr
@@ -87,6 +180,26 @@ type Update struct {
 	VmToHypervisor  map[string]string        `json:",omitempty"` // IP:hostname
 }
 
+// The GetVmStatsInLocation() RPC collects resource usage stats for the
+// running VMs from the connected Hypervisors and aggregates them.
+
+type GetVmStatsInLocationRequest struct {
+	HypervisorTagsToMatch tags.MatchTags // Empty: match all tags.
+	Location              string
+	OwnerGroups           []string
+	OwnerUsers            []string
+	VmTagsToMatch         tags.MatchTags // Empty: match all tags.
+}
+
+type GetVmStatsInLocationResponse struct {
+	Error              string
+	FailedHypervisors  []string                 `json:",omitempty"`
+	FlavourTotals      map[string]ResourceUsage `json:",omitempty"`
+	PrimaryOwnerTotals map[string]ResourceUsage `json:",omitempty"`
+	Totals             ResourceUsage
+	VmStats            []VmStats `json:",omitempty"`
+}
+
 type HardwareAddr net.HardwareAddr
 
 type ListHypervisorLocationsRequest struct {
@@ -158,6 +271,18 @@ type NetworkEntry struct {
 	VlanTrunk      bool         `json:",omitempty"`
 }
 
+type PlaceVmRequest struct {
+	HypervisorTagsToMatch tags.MatchTags // Empty: match all tags.
+	Location              string
+	VmInfo                proto.VmInfo
+}
+
+type PlaceVmResponse struct {
+	Error             string
+	HypervisorAddress string // host:port
+	ReservationId     uint64 // Pass to ReleaseVmPlacement once VM is created.
+}
+
 type PowerOnMachineRequest struct {
 	Hostname string
 }
@@ -165,3 +290,18 @@ type PowerOnMachineRequest struct {
 type PowerOnMachineResponse struct {
 	Error string
 }
+
+type ReleaseVmPlacementRequest struct {
+	ReservationId uint64
+}
+
+type ReleaseVmPlacementResponse struct {
+	Error string
+}
+
+type VmStats struct {
+	HypervisorHostname string
+	OwnerGroups        []string `json:",omitempty"`
+	OwnerUsers         []string `json:",omitempty"`
+	proto.VmStats
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"errors"
 	"net"
+
+	proto "github.com/Cloud-Foundations/Dominator/proto/hypervisor"
 )
 
 func listsEqual(left, right []string) bool {
@@ -47,6 +49,105 @@ func parseMAC(text []byte) (HardwareAddr, error) {
 	return addr, nil
 }
 
+func resourceMapsEqual(left, right map[string]proto.OwnerResources) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for owner, leftResources := range left {
+		if rightResources, ok := right[owner]; !ok {
+			return false
+		} else if leftResources != rightResources {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply sets the fields of the request which have not been specified to the
+// values from the flavour. The flavour name is recorded in the VmInfo.
+func (flavour *Flavour) Apply(request *proto.CreateVmRequest, name string) {
+	vmInfo := &request.VmInfo
+	vmInfo.Flavour = name
+	if vmInfo.ConsoleType == proto.ConsoleNone {
+		vmInfo.ConsoleType = flavour.ConsoleType
+	}
+	if vmInfo.FirmwareType == proto.FirmwareDefault {
+		vmInfo.FirmwareType = flavour.FirmwareType
+	}
+	if vmInfo.MachineType == proto.MachineTypeGenericPC {
+		vmInfo.MachineType = flavour.MachineType
+	}
+	if vmInfo.MemoryInMiB < 1 {
+		vmInfo.MemoryInMiB = flavour.MemoryInMiB
+	}
+	if vmInfo.MilliCPUs < 1 {
+		vmInfo.MilliCPUs = flavour.MilliCPUs
+	}
+	if request.MinimumFreeBytes < 1 {
+		request.MinimumFreeBytes = flavour.MinimumFreeBytes
+	}
+	if len(request.SecondaryVolumes) < 1 && !request.SecondaryVolumesData {
+		for _, size := range flavour.SecondaryVolumeSizes {
+			request.SecondaryVolumes = append(request.SecondaryVolumes,
+				proto.Volume{Size: size})
+		}
+	}
+	if vmInfo.VirtualCPUs < 1 {
+		vmInfo.VirtualCPUs = flavour.VirtualCPUs
+	}
+	if vmInfo.WatchdogAction == proto.WatchdogActionNone {
+		vmInfo.WatchdogAction = flavour.WatchdogAction
+	}
+	if vmInfo.WatchdogModel == proto.WatchdogModelNone {
+		vmInfo.WatchdogModel = flavour.WatchdogModel
+	}
+}
+
+func (left *Flavour) Equal(right *Flavour) bool {
+	if left == right {
+		return true
+	}
+	if left == nil || right == nil {
+		return false
+	}
+	if left.ConsoleType != right.ConsoleType {
+		return false
+	}
+	if left.FirmwareType != right.FirmwareType {
+		return false
+	}
+	if left.MachineType != right.MachineType {
+		return false
+	}
+	if left.MemoryInMiB != right.MemoryInMiB {
+		return false
+	}
+	if left.MilliCPUs != right.MilliCPUs {
+		return false
+	}
+	if left.MinimumFreeBytes != right.MinimumFreeBytes {
+		return false
+	}
+	if len(left.SecondaryVolumeSizes) != len(right.SecondaryVolumeSizes) {
+		return false
+	}
+	for index, size := range left.SecondaryVolumeSizes {
+		if size != right.SecondaryVolumeSizes[index] {
+			return false
+		}
+	}
+	if left.VirtualCPUs != right.VirtualCPUs {
+		return false
+	}
+	if left.WatchdogAction != right.WatchdogAction {
+		return false
+	}
+	if left.WatchdogModel != right.WatchdogModel {
+		return false
+	}
+	return true
+}
+
 func (left *Machine) Equal(right *Machine) bool {
 	if left.GatewaySubnetId != right.GatewaySubnetId {
 		return false
@@ -129,3 +230,31 @@ func (addr *HardwareAddr) UnmarshalText(text []byte) error {
 		return nil
 	}
 }
+
+func (left *Quotas) Equal(right *Quotas) bool {
+	if left == right {
+		return true
+	}
+	if left == nil || right == nil {
+		return false
+	}
+	if !resourceMapsEqual(left.OwnerGroups, right.OwnerGroups) {
+		return false
+	}
+	return resourceMapsEqual(left.OwnerUsers, right.OwnerUsers)
+}
+
+// Add adds the stats for a VM to the usage.
+func (usage *ResourceUsage) Add(stats proto.VmStats) {
+	usage.CpuTime += stats.CpuTime
+	usage.MemoryRSS += stats.MemoryRSS
+	usage.NetworkRxBytes += stats.NetworkRxBytes
+	usage.NetworkTxBytes += stats.NetworkTxBytes
+	usage.NumVMs++
+	for _, volumeStats := range stats.VolumeStats {
+		usage.VolumeReadBytes += volumeStats.ReadBytes
+		usage.VolumeReadOperations += volumeStats.ReadOperations
+		usage.VolumeWriteBytes += volumeStats.WriteBytes
+		usage.VolumeWriteOperations += volumeStats.WriteOperations
+	}
+}
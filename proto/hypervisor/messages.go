@@ -6,6 +6,7 @@ import (
 
 	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
 	"github.com/Cloud-Foundations/Dominator/lib/tags"
 )
 
@@ -61,8 +62,9 @@ type AcknowledgeVmResponse struct {
 }
 
 type Address struct {
-	IpAddress  net.IP `json:",omitempty"`
-	MacAddress string
+	IpAddress   net.IP `json:",omitempty"`
+	Ipv6Address net.IP `json:",omitempty"`
+	MacAddress  string
 }
 
 type AddressList []Address
@@ -76,6 +78,23 @@ type AddVmVolumesResponse struct {
 	Error string
 }
 
+// The BackupVm() RPC is streamed. The client sends a single BackupVmRequest
+// message and the server sends BackupVmResponse messages until the final
+// response or an error.
+type BackupVmRequest struct {
+	ChunkSize           uint64 // Default: 4 MiB.
+	ForceIfNotStopped   bool
+	IpAddress           net.IP
+	ObjectServerAddress string
+}
+
+type BackupVmResponse struct { // Multiple responses are sent.
+	Error           string
+	Final           bool      // If true, this is the final response.
+	ManifestHash    hash.Hash // Valid in the final response.
+	ProgressMessage string
+}
+
 type BecomePrimaryVmOwnerRequest struct {
 	IpAddress net.IP
 }
@@ -139,6 +158,16 @@ type ChangeVmHostnameResponse struct {
 	Error string
 }
 
+type ChangeVmIoLimitsRequest struct {
+	IpAddress             net.IP
+	NetworkBytesPerSecond uint64     // Zero: unlimited.
+	VolumeIoLimits        []IoLimits // Missing entries: unlimited.
+}
+
+type ChangeVmIoLimitsResponse struct {
+	Error string
+}
+
 type ChangeVmMachineTypeRequest struct {
 	MachineType MachineType
 	IpAddress   net.IP
@@ -286,6 +315,7 @@ type CreateVmRequest struct {
 	MinimumFreeBytes     uint64                     `json:",omitempty"`
 	OverlayDirectories   []string                   `json:",omitempty"`
 	OverlayFiles         map[string][]byte          `json:",omitempty"`
+	PrimaryOwner         string                     `json:",omitempty"` // Requires method access.
 	RoundupPower         uint64                     `json:",omitempty"`
 	SecondaryVolumes     []Volume                   `json:",omitempty"`
 	SecondaryVolumesData bool                       `json:",omitempty"` // Exclusive of SecondaryVolumesInit.
@@ -503,6 +533,15 @@ type GetVmLastPatchLogResponse struct {
 	PatchTime time.Time
 } // Data (length=Length) are streamed afterwards.
 
+type GetVmStatsRequest struct {
+	IpAddresses []net.IP // Empty: all running VMs.
+}
+
+type GetVmStatsResponse struct {
+	Error   string
+	VmStats []VmStats
+}
+
 type GetVmUserDataRequest struct {
 	AccessToken []byte
 	IpAddress   net.IP
@@ -517,8 +556,10 @@ type GetVmUserDataResponse struct {
 
 type GetVmVolumeRequest struct {
 	AccessToken      []byte
+	ExtraFilesOnly   bool // If true, the volume data are not sent.
 	GetExtraFiles    bool
 	IgnoreExtraFiles bool
+	InitialCopy      bool // If true, the volume will be fetched again later.
 	IpAddress        net.IP
 	VolumeIndex      uint
 }
@@ -526,6 +567,7 @@ type GetVmVolumeRequest struct {
 type GetVmVolumeResponse struct {
 	Error      string
 	ExtraFiles map[string][]byte // May contain "kernel", "initrd" and such.
+	Flattened  bool              // If true, a layered volume is sent as RAW.
 }
 
 type HoldLockRequest struct {
@@ -556,6 +598,11 @@ type ListSubnetsResponse struct {
 	Subnets []Subnet `json:",omitempty"`
 }
 
+type IoLimits struct {
+	BytesPerSecond      uint64 `json:",omitempty"` // Zero: unlimited.
+	OperationsPerSecond uint64 `json:",omitempty"` // Zero: unlimited.
+}
+
 type ImportLocalVmRequest struct {
 	SkipMemoryCheck    bool
 	VerificationCookie []byte `json:",omitempty"`
@@ -587,6 +634,7 @@ type ListVolumeDirectoriesResponse struct {
 }
 
 type LocalVolume struct {
+	BackingFile        string `json:",omitempty"` // Shared image base.
 	DirectoryToCleanup string
 	Filename           string
 }
@@ -599,11 +647,14 @@ type LocalVmInfo struct {
 type MachineType uint
 
 type MigrateVmRequest struct {
-	AccessToken      []byte
-	DhcpTimeout      time.Duration
-	IpAddress        net.IP
-	SkipMemoryCheck  bool
-	SourceHypervisor string
+	AccessToken            []byte
+	DhcpTimeout            time.Duration
+	IpAddress              net.IP
+	Live                   bool          // Fall back to cold if this fails.
+	LiveConvergenceTimeout time.Duration // Default: 10 minutes.
+	LiveMaxDowntime        time.Duration // Default: 300 milliseconds.
+	SkipMemoryCheck        bool
+	SourceHypervisor       string
 }
 
 type MigrateVmResponse struct { // Multiple responses are sent.
@@ -632,6 +683,22 @@ type NetbootMachineResponse struct {
 	Error string
 }
 
+// OwnerQuota contains the resource limit for an owner and the resources used
+// by the VMs of the owner on other Hypervisors.
+type OwnerQuota struct {
+	Limit         OwnerResources
+	UsedElsewhere OwnerResources
+}
+
+// OwnerResources contains the resources used by (or available to) the VMs of
+// an owner. A zero value in a limit means no limit.
+type OwnerResources struct {
+	MemoryInMiB uint64 `json:",omitempty"`
+	MilliCPUs   uint64 `json:",omitempty"`
+	NumVMs      uint64 `json:",omitempty"`
+	VolumeBytes uint64 `json:",omitempty"`
+}
+
 type PatchVmImageRequest struct {
 	ImageName    string
 	ImageTimeout time.Duration
@@ -789,6 +856,26 @@ type ScanVmRootResponse struct {
 	FileSystem *filesystem.FileSystem
 }
 
+type SendVmLiveMigrationRequest struct {
+	AccessToken        []byte
+	ConvergenceTimeout time.Duration
+	IpAddress          net.IP
+	MaxDowntime        time.Duration
+	MigrationURI       string   // Where the destination QEMU is listening.
+	VolumeTargets      []string // NBD URIs, one per volume.
+}
+
+type SendVmLiveMigrationResponse struct { // Multiple responses are sent.
+	Error           string
+	Final           bool // If true, this is the final response.
+	ProgressMessage string
+	RequestCommit   bool // If true, the source VM is paused and waiting.
+}
+
+type SendVmLiveMigrationResponseResponse struct {
+	Commit bool
+}
+
 type SetDisabledStateRequest struct {
 	Disable bool
 }
@@ -797,6 +884,24 @@ type SetDisabledStateResponse struct {
 	Error string
 }
 
+type SetVmSnapshotPolicyRequest struct {
+	IpAddress      net.IP
+	SnapshotPolicy *SnapshotPolicy // nil: remove the policy.
+}
+
+type SetVmSnapshotPolicyResponse struct {
+	Error string
+}
+
+// SnapshotPolicy specifies when snapshots of a VM are taken and how many are
+// kept. Only snapshots taken according to the policy are discarded.
+type SnapshotPolicy struct {
+	Interval        time.Duration
+	NumToKeep       uint
+	RootOnly        bool `json:",omitempty"`
+	SnapshotRunning bool `json:",omitempty"` // If false, wait until stopped.
+}
+
 type SnapshotVmRequest struct {
 	IpAddress         net.IP
 	ForceIfNotStopped bool
@@ -834,6 +939,9 @@ type Subnet struct {
 	Id                string
 	IpGateway         net.IP
 	IpMask            net.IP // net.IPMask can't be JSON {en,de}coded.
+	Ipv6Gateway       net.IP `json:",omitempty"` // Sends Router Adverts.
+	Ipv6Prefix        net.IP `json:",omitempty"`
+	Ipv6PrefixLength  uint   `json:",omitempty"` // Must be 64 if non-zero.
 	DomainName        string `json:",omitempty"`
 	DomainNameServers []net.IP
 	DisableMetadata   bool      `json:",omitempty"`
@@ -854,6 +962,17 @@ type TraceVmMetadataResponse struct {
 	Error string
 } // A stream of strings (trace paths) follow.
 
+// The UpdateOwnerQuotas() RPC is used by the Fleet Manager to distribute
+// quotas. The quotas replace any previous quotas.
+type UpdateOwnerQuotasRequest struct {
+	OwnerGroups map[string]OwnerQuota `json:",omitempty"`
+	OwnerUsers  map[string]OwnerQuota `json:",omitempty"`
+}
+
+type UpdateOwnerQuotasResponse struct {
+	Error string
+}
+
 type UpdateSubnetsRequest struct {
 	Add    []Subnet
 	Change []Subnet
@@ -864,44 +983,84 @@ type UpdateSubnetsResponse struct {
 	Error string
 }
 
+// VmBackupChunk describes a chunk of a volume in a backup. The chunk is stored
+// as a gzip-compressed object.
+type VmBackupChunk struct {
+	CompressedHash hash.Hash // Hash of the stored object.
+	Hash           hash.Hash // Hash of the uncompressed data.
+}
+
+// VmBackupManifest describes a VM backup. It is stored as a JSON encoded
+// object, and the hash of that object identifies the backup.
+type VmBackupManifest struct {
+	ChunkSize      uint64
+	CreatedOn      time.Time
+	PreviousBackup *hash.Hash `json:",omitempty"`
+	UserData       *hash.Hash `json:",omitempty"` // Uncompressed.
+	UserDataSize   uint64     `json:",omitempty"`
+	VmInfo         VmInfo
+	Volumes        []VmBackupVolume
+}
+
+type VmBackupVolume struct {
+	Chunks []*VmBackupChunk // A nil entry is a chunk of zeros.
+	Size   uint64
+}
+
 type VmInfo struct {
-	Address             Address
-	ChangedStateOn      time.Time    `json:",omitempty"`
-	ConsoleType         ConsoleType  `json:",omitempty"`
-	CreatedOn           time.Time    `json:",omitempty"`
-	CpuPriority         int          `json:",omitempty"`
-	DestroyOnPowerdown  bool         `json:",omitempty"`
-	DestroyProtection   bool         `json:",omitempty"`
-	DisableVirtIO       bool         `json:",omitempty"`
-	ExtraKernelOptions  string       `json:",omitempty"`
-	FirmwareType        FirmwareType `json:",omitempty"`
-	Hostname            string       `json:",omitempty"`
-	IdentityExpires     time.Time    `json:",omitempty"`
-	IdentityName        string       `json:",omitempty"`
-	ImageName           string       `json:",omitempty"`
-	ImageURL            string       `json:",omitempty"`
-	MachineType         MachineType  `json:",omitempty"`
-	MemoryInMiB         uint64
-	MilliCPUs           uint
-	OwnerGroups         []string `json:",omitempty"`
-	OwnerUsers          []string `json:",omitempty"`
-	RootFileSystemLabel string   `json:",omitempty"`
-	SpreadVolumes       bool     `json:",omitempty"`
-	State               State
-	SecondaryAddresses  []Address      `json:",omitempty"`
-	SecondarySubnetIDs  []string       `json:",omitempty"`
-	SubnetId            string         `json:",omitempty"`
-	Tags                tags.Tags      `json:",omitempty"`
-	Uncommitted         bool           `json:",omitempty"`
-	VirtualCPUs         uint           `json:",omitempty"`
-	Volumes             []Volume       `json:",omitempty"`
-	WatchdogAction      WatchdogAction `json:",omitempty"`
-	WatchdogModel       WatchdogModel  `json:",omitempty"`
+	Address               Address
+	ChangedStateOn        time.Time    `json:",omitempty"`
+	ConsoleType           ConsoleType  `json:",omitempty"`
+	CreatedOn             time.Time    `json:",omitempty"`
+	CpuPriority           int          `json:",omitempty"`
+	DestroyOnPowerdown    bool         `json:",omitempty"`
+	DestroyProtection     bool         `json:",omitempty"`
+	DisableVirtIO         bool         `json:",omitempty"`
+	ExtraKernelOptions    string       `json:",omitempty"`
+	FirmwareType          FirmwareType `json:",omitempty"`
+	Flavour               string       `json:",omitempty"`
+	Hostname              string       `json:",omitempty"`
+	IdentityExpires       time.Time    `json:",omitempty"`
+	IdentityName          string       `json:",omitempty"`
+	ImageName             string       `json:",omitempty"`
+	ImageURL              string       `json:",omitempty"`
+	MachineType           MachineType  `json:",omitempty"`
+	MemoryInMiB           uint64
+	MilliCPUs             uint
+	NetworkBytesPerSecond uint64          `json:",omitempty"`
+	OwnerGroups           []string        `json:",omitempty"`
+	OwnerUsers            []string        `json:",omitempty"`
+	RootFileSystemLabel   string          `json:",omitempty"`
+	SnapshotPolicy        *SnapshotPolicy `json:",omitempty"`
+	SpreadVolumes         bool            `json:",omitempty"`
+	State                 State
+	SecondaryAddresses    []Address      `json:",omitempty"`
+	SecondarySubnetIDs    []string       `json:",omitempty"`
+	SubnetId              string         `json:",omitempty"`
+	Tags                  tags.Tags      `json:",omitempty"`
+	Uncommitted           bool           `json:",omitempty"`
+	VirtualCPUs           uint           `json:",omitempty"`
+	Volumes               []Volume       `json:",omitempty"`
+	WatchdogAction        WatchdogAction `json:",omitempty"`
+	WatchdogModel         WatchdogModel  `json:",omitempty"`
+}
+
+// VmStats contains resource usage counters for a running VM. The counters are
+// cumulative since the VM was last started.
+type VmStats struct {
+	CpuTime        time.Duration
+	IpAddress      net.IP
+	MemoryRSS      uint64 // Bytes.
+	NetworkRxBytes uint64 // Received by the VM.
+	NetworkTxBytes uint64 // Transmitted by the VM.
+	SampleTime     time.Time
+	VolumeStats    []VolumeStats
 }
 
 type Volume struct {
 	Format    VolumeFormat      `json:",omitempty"`
 	Interface VolumeInterface   `json:",omitempty"`
+	IoLimits  *IoLimits         `json:",omitempty"`
 	Size      uint64            `json:",omitempty"`
 	Snapshots map[string]uint64 `json:",omitempty"`
 	Type      VolumeType        `json:",omitempty"`
@@ -917,6 +1076,13 @@ type VolumeInitialisationInfo struct {
 	ReservedBlocksPercentage uint16
 }
 
+type VolumeStats struct {
+	ReadBytes       uint64
+	ReadOperations  uint64
+	WriteBytes      uint64
+	WriteOperations uint64
+}
+
 type VolumeType uint
 
 // The WatchDhcp() RPC is fully streamed.
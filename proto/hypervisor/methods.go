@@ -3,8 +3,11 @@ package hypervisor
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net"
 	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/net/util"
 )
 
 const (
@@ -163,6 +166,9 @@ func (left *Address) Equal(right *Address) bool {
 	if !CompareIPs(left.IpAddress, right.IpAddress) {
 		return false
 	}
+	if !CompareIPs(left.Ipv6Address, right.Ipv6Address) {
+		return false
+	}
 	if left.MacAddress != right.MacAddress {
 		return false
 	}
@@ -219,6 +225,13 @@ func (al *AddressList) Set(value string) error {
 	return nil
 }
 
+func subtractUint64(left, right uint64) uint64 {
+	if right >= left {
+		return 0
+	}
+	return left - right
+}
+
 func stringSlicesEqual(left, right []string) bool {
 	if len(left) != len(right) {
 		return false
@@ -317,6 +330,19 @@ func (firmwareType *FirmwareType) UnmarshalText(text []byte) error {
 	}
 }
 
+// Equal returns true if the limits are the same. A nil pointer is the same as
+// no limits.
+func (left *IoLimits) Equal(right *IoLimits) bool {
+	var leftLimits, rightLimits IoLimits
+	if left != nil {
+		leftLimits = *left
+	}
+	if right != nil {
+		rightLimits = *right
+	}
+	return leftLimits == rightLimits
+}
+
 func (machineType *MachineType) CheckValid() error {
 	if _, ok := machineTypeToText[*machineType]; !ok {
 		return errors.New(machineTypeUnknown)
@@ -360,6 +386,67 @@ func (machineType *MachineType) UnmarshalText(text []byte) error {
 	}
 }
 
+// Equal returns true if both policies are nil or have the same values.
+// Add adds other resources.
+func (resources *OwnerResources) Add(other OwnerResources) {
+	resources.MemoryInMiB += other.MemoryInMiB
+	resources.MilliCPUs += other.MilliCPUs
+	resources.NumVMs += other.NumVMs
+	resources.VolumeBytes += other.VolumeBytes
+}
+
+// AddVm adds the resources used by a VM.
+func (resources *OwnerResources) AddVm(vm *VmInfo) {
+	resources.MemoryInMiB += vm.MemoryInMiB
+	resources.MilliCPUs += uint64(vm.MilliCPUs)
+	resources.NumVMs++
+	resources.VolumeBytes += vm.TotalStorage()
+}
+
+// CheckLimit returns an error if any resource exceeds the corresponding
+// non-zero limit and has grown compared to the previous resources.
+func (resources OwnerResources) CheckLimit(limit,
+	previous OwnerResources) error {
+	if limit.MemoryInMiB > 0 && resources.MemoryInMiB > limit.MemoryInMiB &&
+		resources.MemoryInMiB > previous.MemoryInMiB {
+		return fmt.Errorf("memory: %d MiB exceeds quota: %d MiB",
+			resources.MemoryInMiB, limit.MemoryInMiB)
+	}
+	if limit.MilliCPUs > 0 && resources.MilliCPUs > limit.MilliCPUs &&
+		resources.MilliCPUs > previous.MilliCPUs {
+		return fmt.Errorf("MilliCPUs: %d exceeds quota: %d",
+			resources.MilliCPUs, limit.MilliCPUs)
+	}
+	if limit.NumVMs > 0 && resources.NumVMs > limit.NumVMs &&
+		resources.NumVMs > previous.NumVMs {
+		return fmt.Errorf("number of VMs: %d exceeds quota: %d",
+			resources.NumVMs, limit.NumVMs)
+	}
+	if limit.VolumeBytes > 0 && resources.VolumeBytes > limit.VolumeBytes &&
+		resources.VolumeBytes > previous.VolumeBytes {
+		return fmt.Errorf("volume bytes: %d exceeds quota: %d",
+			resources.VolumeBytes, limit.VolumeBytes)
+	}
+	return nil
+}
+
+// Subtract subtracts other resources, stopping at zero.
+func (resources *OwnerResources) Subtract(other OwnerResources) {
+	resources.MemoryInMiB = subtractUint64(resources.MemoryInMiB,
+		other.MemoryInMiB)
+	resources.MilliCPUs = subtractUint64(resources.MilliCPUs, other.MilliCPUs)
+	resources.NumVMs = subtractUint64(resources.NumVMs, other.NumVMs)
+	resources.VolumeBytes = subtractUint64(resources.VolumeBytes,
+		other.VolumeBytes)
+}
+
+func (left *SnapshotPolicy) Equal(right *SnapshotPolicy) bool {
+	if left == nil || right == nil {
+		return left == right
+	}
+	return *left == *right
+}
+
 func (state State) MarshalText() ([]byte, error) {
 	if text := state.String(); text == stateUnknown {
 		return nil, errors.New(text)
@@ -386,6 +473,34 @@ func (state *State) UnmarshalText(text []byte) error {
 	}
 }
 
+// CheckIpv6 checks that the IPv6 configuration of the subnet is consistent.
+func (subnet *Subnet) CheckIpv6() error {
+	if len(subnet.Ipv6Prefix) < 1 {
+		if len(subnet.Ipv6Gateway) > 0 {
+			return errors.New("IPv6 gateway specified without a prefix")
+		}
+		return nil
+	}
+	if subnet.Ipv6Prefix.To4() != nil {
+		return errors.New("IPv6 prefix is not an IPv6 address: " +
+			subnet.Ipv6Prefix.String())
+	}
+	if subnet.Ipv6PrefixLength != 64 {
+		return fmt.Errorf("IPv6 prefix length: %d is not 64",
+			subnet.Ipv6PrefixLength)
+	}
+	prefixMask := net.CIDRMask(int(subnet.Ipv6PrefixLength), 128)
+	if !subnet.Ipv6Prefix.Mask(prefixMask).Equal(subnet.Ipv6Prefix) {
+		return errors.New("IPv6 prefix has host bits set: " +
+			subnet.Ipv6Prefix.String())
+	}
+	if len(subnet.Ipv6Gateway) > 0 && subnet.Ipv6Gateway.To4() != nil {
+		return errors.New("IPv6 gateway is not an IPv6 address: " +
+			subnet.Ipv6Gateway.String())
+	}
+	return nil
+}
+
 func (left *Subnet) Equal(right *Subnet) bool {
 	if left.Id != right.Id {
 		return false
@@ -396,6 +511,15 @@ func (left *Subnet) Equal(right *Subnet) bool {
 	if !CompareIPs(left.IpMask, right.IpMask) {
 		return false
 	}
+	if !CompareIPs(left.Ipv6Gateway, right.Ipv6Gateway) {
+		return false
+	}
+	if !CompareIPs(left.Ipv6Prefix, right.Ipv6Prefix) {
+		return false
+	}
+	if left.Ipv6PrefixLength != right.Ipv6PrefixLength {
+		return false
+	}
 	if left.DomainName != right.DomainName {
 		return false
 	}
@@ -426,6 +550,30 @@ func (left *Subnet) Equal(right *Subnet) bool {
 	return true
 }
 
+// MakeIpv6Address returns the IPv6 address for the specified MAC address,
+// generated from the IPv6 prefix of the subnet. This is the same address which
+// SLAAC would generate. If the subnet has no IPv6 prefix, nil is returned.
+func (subnet *Subnet) MakeIpv6Address(macAddress string) (net.IP, error) {
+	if len(subnet.Ipv6Prefix) < 1 {
+		return nil, nil
+	}
+	macAddr, err := net.ParseMAC(macAddress)
+	if err != nil {
+		return nil, err
+	}
+	return util.MakeEui64Address(subnet.Ipv6Prefix, macAddr)
+}
+
+// MatchesIpv6 returns true if the IPv6 address is within the IPv6 prefix of
+// the subnet.
+func (subnet *Subnet) MatchesIpv6(ipAddr net.IP) bool {
+	if len(subnet.Ipv6Prefix) < 1 || ipAddr.To4() != nil {
+		return false
+	}
+	prefixMask := net.CIDRMask(int(subnet.Ipv6PrefixLength), 128)
+	return ipAddr.Mask(prefixMask).Equal(subnet.Ipv6Prefix)
+}
+
 func IpListsEqual(left, right []net.IP) bool {
 	if len(left) != len(right) {
 		return false
@@ -477,6 +625,9 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 	if left.FirmwareType != right.FirmwareType {
 		return false
 	}
+	if left.Flavour != right.Flavour {
+		return false
+	}
 	if left.Hostname != right.Hostname {
 		return false
 	}
@@ -501,6 +652,9 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 	if left.MilliCPUs != right.MilliCPUs {
 		return false
 	}
+	if left.NetworkBytesPerSecond != right.NetworkBytesPerSecond {
+		return false
+	}
 	if !stringSlicesEqual(left.OwnerGroups, right.OwnerGroups) {
 		return false
 	}
@@ -513,6 +667,9 @@ func (left *VmInfo) Equal(right *VmInfo) bool {
 	if left.RootFileSystemLabel != right.RootFileSystemLabel {
 		return false
 	}
+	if !left.SnapshotPolicy.Equal(right.SnapshotPolicy) {
+		return false
+	}
 	if left.State != right.State {
 		return false
 	}
@@ -571,6 +728,9 @@ func (left *Volume) Equal(right *Volume) bool {
 	if left.Interface != right.Interface {
 		return false
 	}
+	if !left.IoLimits.Equal(right.IoLimits) {
+		return false
+	}
 	if left.Size != right.Size {
 		return false
 	}
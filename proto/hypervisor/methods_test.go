@@ -1,6 +1,7 @@
 package hypervisor
 
 import (
+	"net"
 	"reflect"
 	"strings"
 	"testing"
@@ -70,14 +71,16 @@ func makeVmInfo(t *testing.T, nonZeroFill bool, invertIndex int,
 				sliceValue.Index(1).SetString(strings.ToLower(fieldName))
 			case "SecondaryAddresses":
 				addresses := []Address{{
-					[]byte{1, 2, 3, 4},
-					"01:02:03",
+					IpAddress:   []byte{1, 2, 3, 4},
+					Ipv6Address: net.ParseIP("2001:db8::1"),
+					MacAddress:  "01:02:03",
 				}}
 				fieldValue.Set(reflect.ValueOf(addresses))
 			case "Volumes":
 				volumes := []Volume{{
 					VolumeFormat(base) + 1,
 					VolumeInterface(base) + 2,
+					&IoLimits{uint64(base) + 7, uint64(base) + 8},
 					uint64(base) + 3,
 					map[string]uint64{
 						"":    uint64(subBase) + 4,
@@ -93,8 +96,9 @@ func makeVmInfo(t *testing.T, nonZeroFill bool, invertIndex int,
 			switch fieldName {
 			case "Address":
 				address := Address{
-					[]byte{1, 2, 3, 4},
-					"01:02:03",
+					IpAddress:   []byte{1, 2, 3, 4},
+					Ipv6Address: net.ParseIP("2001:db8::1"),
+					MacAddress:  "01:02:03",
 				}
 				fieldValue.Set(reflect.ValueOf(address))
 			case "ChangedStateOn", "CreatedOn", "IdentityExpires":
@@ -91,6 +91,15 @@ type GetImageExpirationResponse struct {
 	ExpiresAt time.Time
 }
 
+type GetImageVersionRequest struct {
+	ImageName string
+}
+
+type GetImageVersionResponse struct {
+	Error   string
+	Version *ImageVersion // nil if image not found.
+}
+
 type GetImageArchiveRequest struct {
 	ImageName string
 }
@@ -125,17 +134,32 @@ const (
 // The GetFilteredImageUpdates() RPC is fully streamed.
 // The client sends a GetFilteredImageUpdatesRequest message to the server.
 // The server sends a stream of ImageUpdate messages.
+// If IncludeDeleted is true, the initial list is followed by delete operations
+// for all images which were previously deleted, before the end of the initial
+// list is signalled. This is used for replication between peers.
 
 type GetFilteredImageUpdatesRequest struct {
-	IgnoreExpiring bool
+	IgnoreExpiring  bool
+	IncludeDeleted  bool
+	IncludeVersions bool // If true, send Version for added images.
 }
 
 type ImageUpdate struct {
 	Name      string // "" signifies initial list is sent, changes to follow.
 	Directory *image.Directory
 	Operation uint
+	Version   *ImageVersion
+}
+
+// ImageVersion identifies the content of an image, so that peers can detect
+// when the same image name was added with different content. The version with
+// the earliest CreatedOn time wins, with ties broken by the lowest Digest.
+type ImageVersion struct {
+	CreatedOn time.Time
+	Digest    []byte
 }
 
+// GetReplicationMaster is deprecated: use GetReplicationMembership instead.
 type GetReplicationMasterRequest struct{}
 
 type GetReplicationMasterResponse struct {
@@ -143,6 +167,29 @@ type GetReplicationMasterResponse struct {
 	ReplicationMaster string
 }
 
+type GetReplicationMembershipRequest struct{}
+
+type GetReplicationMembershipResponse struct {
+	Error      string
+	Membership ReplicationMembership
+}
+
+// ReplicationMembership is the view of the replication group that an
+// imageserver has. Clients may send changes to any Writable member, failing
+// over to another Writable member if one is unavailable.
+type ReplicationMembership struct {
+	Master  string // If not empty, the server replicates from this master.
+	Members []ReplicationMember
+}
+
+type ReplicationMember struct {
+	Address    string
+	Connected  bool      // Only valid for peers.
+	LastUpdate time.Time // Last update received from a peer.
+	Self       bool
+	Writable   bool
+}
+
 type ImageArchive struct {
 	ImageName string
 	image.Image
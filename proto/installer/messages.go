@@ -3,11 +3,17 @@ package installer
 const (
 	FileSystemTypeExt4 = 0
 	FileSystemTypeVfat = 1
+	FileSystemTypeXfs  = 2
+
+	RaidLevelNone = 0
+	RaidLevel1    = 1
+	RaidLevel10   = 10
 )
 
 type FileSystemType uint
 
 type Partition struct {
+	Encrypt          bool           `json:",omitempty"`
 	FileSystemLabel  string         `json:",omitempty"`
 	FileSystemType   FileSystemType `json:",omitempty"`
 	MountPoint       string         `json:",omitempty"`
@@ -15,9 +21,16 @@ type Partition struct {
 	MinimumFreeBytes uint64         `json:",omitempty"`
 }
 
+type RaidLevel uint
+
 type StorageLayout struct {
-	BootDriveLayout          []Partition `json:",omitempty"`
-	ExtraMountPointsBasename string      `json:",omitempty"`
-	Encrypt                  bool        `json:",omitempty"`
-	UseKexec                 bool        `json:",omitempty"`
+	BootDriveLayout          []Partition    `json:",omitempty"`
+	ExtraFileSystemType      FileSystemType `json:",omitempty"`
+	ExtraMountPointsBasename string         `json:",omitempty"`
+	Encrypt                  bool           `json:",omitempty"`
+	KeyServerUrl             string         `json:",omitempty"`
+	NumRaidDrives            uint           `json:",omitempty"` // 0: all.
+	PreserveData             bool           `json:",omitempty"`
+	RaidLevel                RaidLevel      `json:",omitempty"`
+	UseKexec                 bool           `json:",omitempty"`
 }
@@ -2,18 +2,29 @@ package installer
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 )
 
 const (
 	fileSystemTypeUnknown = "UNKNOWN FileSystemType"
+	raidLevelUnknown      = "UNKNOWN RaidLevel"
 )
 
 var (
 	fileSystemTypeToText = map[FileSystemType]string{
 		FileSystemTypeExt4: "ext4",
 		FileSystemTypeVfat: "vfat",
+		FileSystemTypeXfs:  "xfs",
 	}
 	textToFileSystemType map[string]FileSystemType
+
+	raidLevelToText = map[RaidLevel]string{
+		RaidLevelNone: "none",
+		RaidLevel1:    "raid1",
+		RaidLevel10:   "raid10",
+	}
+	textToRaidLevel map[string]RaidLevel
 )
 
 func init() {
@@ -22,6 +33,10 @@ func init() {
 	for fileSystemType, text := range fileSystemTypeToText {
 		textToFileSystemType[text] = fileSystemType
 	}
+	textToRaidLevel = make(map[string]RaidLevel, len(raidLevelToText))
+	for raidLevel, text := range raidLevelToText {
+		textToRaidLevel[text] = raidLevel
+	}
 }
 
 func (fileSystemType FileSystemType) MarshalText() ([]byte, error) {
@@ -53,10 +68,88 @@ func (fileSystemType *FileSystemType) UnmarshalText(text []byte) error {
 	return fileSystemType.Set(string(text))
 }
 
+func (raidLevel RaidLevel) MarshalText() ([]byte, error) {
+	if text := raidLevel.String(); text == raidLevelUnknown {
+		return nil, errors.New(text)
+	} else {
+		return []byte(text), nil
+	}
+}
+
+func (raidLevel *RaidLevel) Set(value string) error {
+	if val, ok := textToRaidLevel[value]; !ok {
+		return errors.New(raidLevelUnknown)
+	} else {
+		*raidLevel = val
+		return nil
+	}
+}
+
+func (raidLevel RaidLevel) String() string {
+	if str, ok := raidLevelToText[raidLevel]; !ok {
+		return raidLevelUnknown
+	} else {
+		return str
+	}
+}
+
+func (raidLevel *RaidLevel) UnmarshalText(text []byte) error {
+	return raidLevel.Set(string(text))
+}
+
 func (left *Partition) Equal(right *Partition) bool {
 	return *left == *right
 }
 
+// Check returns an error if the layout is not valid.
+func (layout *StorageLayout) Check() error {
+	var haveRoot bool
+	for _, partition := range layout.BootDriveLayout {
+		if partition.FileSystemType.String() == fileSystemTypeUnknown {
+			return fmt.Errorf("%s: %s",
+				partition.MountPoint, fileSystemTypeUnknown)
+		}
+		switch partition.MountPoint {
+		case "/":
+			haveRoot = true
+			fallthrough
+		case "/boot":
+			if partition.Encrypt {
+				return fmt.Errorf("cannot encrypt: %s", partition.MountPoint)
+			}
+		}
+	}
+	if !haveRoot {
+		return errors.New("no root partition specified in layout")
+	}
+	if layout.ExtraFileSystemType.String() == fileSystemTypeUnknown {
+		return errors.New(fileSystemTypeUnknown)
+	}
+	if layout.KeyServerUrl != "" {
+		parsedUrl, err := url.Parse(layout.KeyServerUrl)
+		if err != nil {
+			return err
+		}
+		if parsedUrl.Scheme != "https" {
+			return fmt.Errorf("KeyServerUrl scheme: %s is not https",
+				parsedUrl.Scheme)
+		}
+	}
+	switch layout.RaidLevel {
+	case RaidLevelNone:
+		if layout.NumRaidDrives > 0 {
+			return errors.New("NumRaidDrives specified without RaidLevel")
+		}
+	case RaidLevel1, RaidLevel10:
+		if layout.NumRaidDrives == 1 {
+			return fmt.Errorf("%s needs at least 2 drives", layout.RaidLevel)
+		}
+	default:
+		return errors.New(raidLevelUnknown)
+	}
+	return nil
+}
+
 func (left *StorageLayout) Equal(right *StorageLayout) bool {
 	if left == right {
 		return true
@@ -72,12 +165,27 @@ func (left *StorageLayout) Equal(right *StorageLayout) bool {
 			return false
 		}
 	}
+	if left.ExtraFileSystemType != right.ExtraFileSystemType {
+		return false
+	}
 	if left.ExtraMountPointsBasename != right.ExtraMountPointsBasename {
 		return false
 	}
 	if left.Encrypt != right.Encrypt {
 		return false
 	}
+	if left.KeyServerUrl != right.KeyServerUrl {
+		return false
+	}
+	if left.NumRaidDrives != right.NumRaidDrives {
+		return false
+	}
+	if left.PreserveData != right.PreserveData {
+		return false
+	}
+	if left.RaidLevel != right.RaidLevel {
+		return false
+	}
 	if left.UseKexec != right.UseKexec {
 		return false
 	}
@@ -0,0 +1,104 @@
+package installer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeStorageLayout(t *testing.T) {
+	var layout StorageLayout
+	err := json.Unmarshal([]byte(`{
+		"BootDriveLayout": [
+			{"MountPoint": "/", "MinimumFreeBytes": 1073741824},
+			{"MountPoint": "/data", "FileSystemType": "xfs", "Encrypt": true}
+		],
+		"ExtraFileSystemType": "xfs",
+		"KeyServerUrl": "https://keys.example.com/key",
+		"NumRaidDrives": 2,
+		"PreserveData": true,
+		"RaidLevel": "raid10"
+	}`), &layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := layout.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(layout.BootDriveLayout) != 2 {
+		t.Fatalf("number of partitions: %d != 2", len(layout.BootDriveLayout))
+	}
+	partition := layout.BootDriveLayout[1]
+	if partition.FileSystemType != FileSystemTypeXfs || !partition.Encrypt {
+		t.Errorf("partition not decoded: %+v", partition)
+	}
+	if layout.ExtraFileSystemType != FileSystemTypeXfs {
+		t.Errorf("ExtraFileSystemType: %s", layout.ExtraFileSystemType)
+	}
+	if layout.RaidLevel != RaidLevel10 {
+		t.Errorf("RaidLevel: %s", layout.RaidLevel)
+	}
+	err = json.Unmarshal([]byte(`{"RaidLevel": "raid5"}`), &layout)
+	if err == nil {
+		t.Error("unsupported RaidLevel decoded")
+	}
+}
+
+func TestCheckStorageLayout(t *testing.T) {
+	root := Partition{MountPoint: "/"}
+	tests := []struct {
+		name   string
+		layout StorageLayout
+		valid  bool
+	}{
+		{"simple", StorageLayout{BootDriveLayout: []Partition{root}}, true},
+		{"no root", StorageLayout{}, false},
+		{"encrypt root", StorageLayout{
+			BootDriveLayout: []Partition{{MountPoint: "/", Encrypt: true}},
+		}, false},
+		{"encrypt boot", StorageLayout{
+			BootDriveLayout: []Partition{
+				{MountPoint: "/boot", Encrypt: true}, root},
+		}, false},
+		{"bad file-system type", StorageLayout{
+			BootDriveLayout: []Partition{{MountPoint: "/",
+				FileSystemType: 99}},
+		}, false},
+		{"bad key server", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			KeyServerUrl:    "file:///etc/key",
+		}, false},
+		{"insecure key server", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			KeyServerUrl:    "http://keys.example.com/key",
+		}, false},
+		{"key server", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			KeyServerUrl:    "https://keys.example.com/key",
+		}, true},
+		{"RAID drives without RAID", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			NumRaidDrives:   2,
+		}, false},
+		{"RAID with one drive", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			NumRaidDrives:   1,
+			RaidLevel:       RaidLevel1,
+		}, false},
+		{"RAID with all drives", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			RaidLevel:       RaidLevel1,
+		}, true},
+		{"bad RAID level", StorageLayout{
+			BootDriveLayout: []Partition{root},
+			RaidLevel:       5,
+		}, false},
+	}
+	for _, test := range tests {
+		err := test.layout.Check()
+		if test.valid && err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
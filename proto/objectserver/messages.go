@@ -5,6 +5,11 @@ import (
 	"time"
 )
 
+const (
+	GetObjectsFlagUncompressed = 0
+	GetObjectsFlagCompressed   = 1
+)
+
 // The AddObjects() RPC requires the client to send a stream of AddObjectRequest
 // objects in Gob format. To signify the end of the stream, the client should
 // send an AddObjectRequest object with .Length == 0.
@@ -30,12 +35,25 @@ type CheckObjectsResponse struct {
 }
 
 // This is used in the special GetObjects streaming HTTP/RPC protocol.
+// The client may list the compression methods it accepts in Compressions, in
+// order of preference. If the server selects one, it is returned in
+// GetObjectsResponse.Compression and each object is preceded by a flag byte:
+//
+//	GetObjectsFlagUncompressed: the object data follow (ObjectSizes[i] bytes)
+//	GetObjectsFlagCompressed: a compressed stream of the object data follows,
+//	  sent as a sequence of chunks. Each chunk is a big-endian uint32 length
+//	  followed by that many bytes. A zero-length chunk ends the stream.
+//
+// If Compression is empty, the object data are streamed uncompressed without
+// flag bytes, which is compatible with older clients and servers.
 type GetObjectsRequest struct {
-	Exclusive bool // For initial performance benchmarking only.
-	Hashes    []hash.Hash
+	Compressions []string
+	Exclusive    bool // For initial performance benchmarking only.
+	Hashes       []hash.Hash
 }
 
 type GetObjectsResponse struct {
+	Compression    string
 	ResponseString string
 	ObjectSizes    []uint64
 } // Object datas are streamed afterwards.
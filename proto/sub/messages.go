@@ -68,6 +68,15 @@ type GetFileResponse struct {
 	Size  uint64
 } // File data are streamed afterwards.
 
+// HealthCheck describes a check run by the sub after the triggers for an
+// update have run. The check is retried until it succeeds or the grace period
+// expires. If both Command and Url are specified, both must succeed.
+type HealthCheck struct {
+	Command     string        // Run with /bin/sh -c, must exit with status 0.
+	GracePeriod time.Duration // Zero: use the sub default.
+	Url         string        // GET must return status 200.
+}
+
 type PollRequest struct {
 	HaveGeneration uint64
 	LockFor        time.Duration
@@ -83,6 +92,7 @@ type PollResponse struct {
 	LastFetchError               string
 	LastNote                     string // Updated after successful Update().
 	LastSuccessfulImageName      string
+	LastHealthCheckError         string // Image not marked successful.
 	LastUpdateError              string
 	LastUpdateHadTriggerFailures bool
 	LastWriteError               string
@@ -95,6 +105,7 @@ type PollResponse struct {
 	DurationOfLastScan           time.Duration
 	GenerationCount              uint64
 	SystemUptime                 *time.Duration
+	DisruptionNextWindow         time.Time // Zero if not known.
 	DisruptionState              DisruptionState
 	FileSystemFollows            bool
 	FileSystem                   *filesystem.FileSystem  // Streamed separately.
@@ -107,6 +118,7 @@ type SetConfigurationResponse struct{}
 
 type UpdateRequest struct {
 	ForceDisruption bool
+	HealthCheck     *HealthCheck
 	ImageName       string
 	SparseImage     bool
 	Wait            bool
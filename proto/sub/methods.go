@@ -3,6 +3,11 @@ package sub
 import (
 	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
 )
 
 const (
@@ -83,6 +88,50 @@ func (disruptionRequest *DisruptionRequest) UnmarshalText(text []byte) error {
 	}
 }
 
+// DisruptionManagerExitCode returns the exit code a DisruptionManager uses to
+// report the disruption state.
+func (state DisruptionState) DisruptionManagerExitCode() (int, error) {
+	switch state {
+	case DisruptionStateAnytime, DisruptionStatePermitted:
+		return 0, nil
+	case DisruptionStateRequested:
+		return 1, nil
+	case DisruptionStateDenied:
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid DisruptionState: %d", state)
+}
+
+// ParseDisruptionManagerNextWindow returns the start of the next maintenance
+// window from the output of a DisruptionManager, which is the last line in
+// RFC 3339 format. The zero time is returned if there is none.
+func ParseDisruptionManagerNextWindow(output string) time.Time {
+	output = strings.TrimSpace(output)
+	if index := strings.LastIndexByte(output, '\n'); index >= 0 {
+		output = output[index+1:]
+	}
+	nextWindow, err := time.Parse(time.RFC3339, strings.TrimSpace(output))
+	if err != nil {
+		return time.Time{}
+	}
+	return nextWindow
+}
+
+// WriteDisruptionManagerOutput writes the disruption state in the format
+// expected from a DisruptionManager. If the state is denied and nextWindow is
+// not zero, the last line is the start of the next window in RFC 3339 format.
+func WriteDisruptionManagerOutput(writer io.Writer, state DisruptionState,
+	nextWindow time.Time) error {
+	if state != DisruptionStateDenied || nextWindow.IsZero() {
+		_, err := fmt.Fprintln(writer, state)
+		return err
+	}
+	_, err := fmt.Fprintf(writer, "%s (next window in %s)\n%s\n",
+		state, format.Duration(time.Until(nextWindow)),
+		nextWindow.Format(time.RFC3339))
+	return err
+}
+
 func VerifyDisruptionState(state DisruptionState) bool {
 	_, ok := disruptionStateToText[state]
 	return ok
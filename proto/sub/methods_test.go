@@ -0,0 +1,48 @@
+package sub
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDisruptionManagerOutput(t *testing.T) {
+	nextWindow := time.Now().Add(time.Hour).Truncate(time.Second)
+	tests := []struct {
+		state      DisruptionState
+		nextWindow time.Time
+		exitCode   int
+		expected   time.Time
+	}{
+		{DisruptionStatePermitted, time.Time{}, 0, time.Time{}},
+		{DisruptionStateRequested, time.Time{}, 1, time.Time{}},
+		{DisruptionStateDenied, time.Time{}, 2, time.Time{}},
+		{DisruptionStateDenied, nextWindow, 2, nextWindow},
+		{DisruptionStatePermitted, nextWindow, 0, time.Time{}},
+	}
+	for _, test := range tests {
+		exitCode, err := test.state.DisruptionManagerExitCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exitCode != test.exitCode {
+			t.Errorf("%s: exit code: %d, expected: %d",
+				test.state, exitCode, test.exitCode)
+		}
+		buffer := &bytes.Buffer{}
+		err = WriteDisruptionManagerOutput(buffer, test.state,
+			test.nextWindow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := buffer.String()
+		got := ParseDisruptionManagerNextWindow(output)
+		if !got.Equal(test.expected) {
+			t.Errorf("%s: parsed next window: %s from: %q, expected: %s",
+				test.state, got, output, test.expected)
+		}
+	}
+	if _, err := DisruptionState(99).DisruptionManagerExitCode(); err == nil {
+		t.Error("no error for invalid DisruptionState")
+	}
+}
@@ -3,7 +3,9 @@ package lib
 import (
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
 	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 	"github.com/Cloud-Foundations/Dominator/lib/triggers"
 	"github.com/Cloud-Foundations/Dominator/proto/sub"
@@ -39,6 +41,21 @@ func CheckImpact(triggerList []*triggers.Trigger) (highImpact, reboot bool) {
 	return checkImpact(triggerList)
 }
 
+// CheckUpdateMatchesImage will return an error if the update request would
+// apply content, triggers or a health check which are not specified by the
+// image. Files copied to the object cache and existing files which are linked
+// to are checked against the file-system for the sub.
+func CheckUpdateMatchesImage(request sub.UpdateRequest, img *image.Image,
+	subFS *filesystem.FileSystem) error {
+	return checkUpdateMatchesImage(request, img, subFS)
+}
+
+// GetHealthCheck returns the health check specified by the image tags, or nil
+// if there is none.
+func GetHealthCheck(img *image.Image) *sub.HealthCheck {
+	return getHealthCheck(img)
+}
+
 // MatchTriggersInUpdate will return a list of triggers in an update request
 // that match the list of changes. Since there is no file-system to compare to,
 // potential mtime-only changes will also match.
@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/proto/sub"
+)
+
+const (
+	healthCheckCommandTag     = "HealthCheckCommand"
+	healthCheckGracePeriodTag = "HealthCheckGracePeriod"
+	healthCheckUrlTag         = "HealthCheckUrl"
+)
+
+func getHealthCheck(img *image.Image) *sub.HealthCheck {
+	if img == nil {
+		return nil
+	}
+	healthCheck := sub.HealthCheck{
+		Command: img.Tags[healthCheckCommandTag],
+		Url:     img.Tags[healthCheckUrlTag],
+	}
+	if healthCheck.Command == "" && healthCheck.Url == "" {
+		return nil
+	}
+	if value := img.Tags[healthCheckGracePeriodTag]; value != "" {
+		if gracePeriod, err := time.ParseDuration(value); err == nil {
+			healthCheck.GracePeriod = gracePeriod
+		}
+	}
+	return &healthCheck
+}
@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+)
+
+func TestGetHealthCheck(t *testing.T) {
+	if GetHealthCheck(nil) != nil {
+		t.Error("health check for nil image")
+	}
+	img := &image.Image{Tags: tags.Tags{"Other": "value"}}
+	if GetHealthCheck(img) != nil {
+		t.Error("health check for image without health check tags")
+	}
+	img.Tags[healthCheckCommandTag] = "true"
+	img.Tags[healthCheckGracePeriodTag] = "2m"
+	healthCheck := GetHealthCheck(img)
+	if healthCheck == nil {
+		t.Fatal("no health check")
+	}
+	if healthCheck.Command != "true" {
+		t.Errorf("command: \"%s\", expected: \"true\"", healthCheck.Command)
+	}
+	if healthCheck.GracePeriod != 2*time.Minute {
+		t.Errorf("grace period: %s, expected: 2m", healthCheck.GracePeriod)
+	}
+	img.Tags[healthCheckGracePeriodTag] = "bad"
+	if healthCheck := GetHealthCheck(img); healthCheck.GracePeriod != 0 {
+		t.Errorf("bad grace period parsed: %s", healthCheck.GracePeriod)
+	}
+}
@@ -365,7 +365,12 @@ func checkNonMtimeChange(filename string, inode filesystem.GenericInode) bool {
 			oldInode.Hash = inode.Hash
 			oldInode.MtimeNanoSeconds = inode.MtimeNanoSeconds
 			oldInode.MtimeSeconds = inode.MtimeSeconds
-			if *oldInode == *inode {
+			xattrs, err := filesystem.GetXattrs(filename)
+			if err != nil {
+				return true
+			}
+			oldInode.Xattrs = xattrs
+			if filesystem.CompareRegularInodes(oldInode, inode, nil) {
 				return false
 			}
 		}
@@ -379,7 +384,12 @@ func checkNonMtimeChange(filename string, inode filesystem.GenericInode) bool {
 			oldInode := scanner.MakeSpecialInode(&stat)
 			oldInode.MtimeNanoSeconds = inode.MtimeNanoSeconds
 			oldInode.MtimeSeconds = inode.MtimeSeconds
-			if *oldInode == *inode {
+			xattrs, err := filesystem.GetXattrs(filename)
+			if err != nil {
+				return true
+			}
+			oldInode.Xattrs = xattrs
+			if filesystem.CompareSpecialInodes(oldInode, inode, nil) {
 				return false
 			}
 		}
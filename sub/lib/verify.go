@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+	"github.com/Cloud-Foundations/Dominator/proto/sub"
+)
+
+// lookupPath returns the inode and inode number for the pathname, walking the
+// directory entries rather than building (and caching) lookup tables.
+func lookupPath(fs *filesystem.FileSystem, pathname string) (
+	filesystem.GenericInode, uint64, bool) {
+	if pathname == "/" {
+		return &fs.DirectoryInode, 0, true
+	}
+	directory := &fs.DirectoryInode
+	var inode filesystem.GenericInode
+	var inodeNumber uint64
+	for _, name := range strings.Split(strings.Trim(pathname, "/"), "/") {
+		if directory == nil {
+			return nil, 0, false
+		}
+		var dirent *filesystem.DirectoryEntry
+		for _, entry := range directory.EntryList {
+			if entry.Name == name {
+				dirent = entry
+				break
+			}
+		}
+		if dirent == nil {
+			return nil, 0, false
+		}
+		inode = dirent.Inode()
+		inodeNumber = dirent.InodeNumber
+		directory, _ = inode.(*filesystem.DirectoryInode)
+	}
+	return inode, inodeNumber, true
+}
+
+func checkInode(name string, inode filesystem.GenericInode,
+	img *image.Image) error {
+	imageInode, _, ok := lookupPath(img.FileSystem, name)
+	if !ok {
+		return fmt.Errorf("%s: not in image", name)
+	}
+	if computed, ok := imageInode.(*filesystem.ComputedRegularInode); ok {
+		inode, ok := inode.(*filesystem.RegularInode)
+		if !ok || inode.Mode != computed.Mode || inode.Uid != computed.Uid ||
+			inode.Gid != computed.Gid {
+			return fmt.Errorf("%s: does not match computed file in image",
+				name)
+		}
+		return nil
+	}
+	sameType, sameMetadata, sameData := filesystem.CompareInodes(inode,
+		imageInode, nil)
+	if _, ok := imageInode.(*filesystem.DirectoryInode); ok {
+		sameData = true
+	}
+	if !sameType || !sameMetadata || !sameData {
+		return fmt.Errorf("%s: does not match image", name)
+	}
+	return nil
+}
+
+func checkTriggers(requested, required *triggers.Triggers) error {
+	var requestedList, requiredList []*triggers.Trigger
+	if requested != nil {
+		requestedList = requested.Triggers
+	}
+	if required != nil {
+		requiredList = required.Triggers
+	}
+	if len(requestedList) != len(requiredList) {
+		return errors.New("triggers do not match image")
+	}
+	for index, left := range requestedList {
+		right := requiredList[index]
+		if left.Service != right.Service ||
+			left.SortName != right.SortName ||
+			left.DoReboot != right.DoReboot ||
+			left.HighImpact != right.HighImpact ||
+			strings.Join(left.MatchLines, "\n") !=
+				strings.Join(right.MatchLines, "\n") {
+			return fmt.Errorf("trigger: %s does not match image", left.Service)
+		}
+	}
+	return nil
+}
+
+func checkUpdateMatchesImage(request sub.UpdateRequest, img *image.Image,
+	subFS *filesystem.FileSystem) error {
+	if err := checkTriggers(request.Triggers, img.Triggers); err != nil {
+		return err
+	}
+	healthCheck := getHealthCheck(img)
+	if (request.HealthCheck == nil) != (healthCheck == nil) ||
+		(healthCheck != nil && *request.HealthCheck != *healthCheck) {
+		return errors.New("health check does not match image")
+	}
+	for _, fileToCopy := range request.FilesToCopyToCache {
+		inode, _, ok := lookupPath(subFS, fileToCopy.Name)
+		if !ok {
+			return fmt.Errorf("%s: not found", fileToCopy.Name)
+		}
+		if inode, ok := inode.(*filesystem.RegularInode); !ok ||
+			inode.Hash != fileToCopy.Hash {
+			return fmt.Errorf("%s: does not match hash: %x",
+				fileToCopy.Name, fileToCopy.Hash)
+		}
+	}
+	for _, inode := range request.DirectoriesToMake {
+		if err := checkInode(inode.Name, inode.GenericInode, img); err != nil {
+			return err
+		}
+	}
+	for _, inode := range request.InodesToMake {
+		if err := checkInode(inode.Name, inode.GenericInode, img); err != nil {
+			return err
+		}
+	}
+	for _, hardlink := range request.HardlinksToMake {
+		imageInode, inodeNumber, ok := lookupPath(img.FileSystem,
+			hardlink.NewLink)
+		if !ok {
+			return fmt.Errorf("%s: not in image", hardlink.NewLink)
+		}
+		_, targetNumber, ok := lookupPath(img.FileSystem, hardlink.Target)
+		if ok && targetNumber == inodeNumber {
+			continue
+		}
+		// The target may be an existing file which has the same data.
+		inode, _, ok := lookupPath(subFS, hardlink.Target)
+		if !ok {
+			return fmt.Errorf("%s: not found", hardlink.Target)
+		}
+		switch imageInode.(type) {
+		case *filesystem.ComputedRegularInode:
+			if _, ok := inode.(*filesystem.RegularInode); !ok {
+				return fmt.Errorf("%s: not a regular file", hardlink.Target)
+			}
+		case *filesystem.DirectoryInode:
+			return fmt.Errorf("%s: cannot link to a directory",
+				hardlink.NewLink)
+		default:
+			sameType, _, sameData := filesystem.CompareInodes(inode,
+				imageInode, nil)
+			if !sameType || !sameData {
+				return fmt.Errorf("%s: link to: %s does not match image",
+					hardlink.NewLink, hardlink.Target)
+			}
+		}
+	}
+	for _, pathname := range request.PathsToDelete {
+		if inode, _, ok := lookupPath(img.FileSystem, pathname); ok {
+			// Missing computed files may be deleted.
+			if _, ok := inode.(*filesystem.ComputedRegularInode); !ok {
+				return fmt.Errorf("%s: cannot delete, in image", pathname)
+			}
+			continue
+		}
+		if img.Filter == nil {
+			return fmt.Errorf("%s: cannot delete for sparse image", pathname)
+		}
+		if img.Filter.Match(pathname) {
+			return fmt.Errorf("%s: cannot delete, filtered by image",
+				pathname)
+		}
+	}
+	for _, inode := range request.InodesToChange {
+		if err := checkInode(inode.Name, inode.GenericInode, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
+	"github.com/Cloud-Foundations/Dominator/lib/hash"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/tags"
+	"github.com/Cloud-Foundations/Dominator/lib/triggers"
+	"github.com/Cloud-Foundations/Dominator/proto/sub"
+)
+
+var (
+	hash1 = hash.Hash{1}
+	hash2 = hash.Hash{2}
+)
+
+// makeFileSystem makes a file-system with entries in the root directory and
+// dirEntries in the directory with inode number 1.
+func makeFileSystem(t *testing.T, inodeTable filesystem.InodeTable,
+	entries, dirEntries map[string]uint64) *filesystem.FileSystem {
+	fs := &filesystem.FileSystem{InodeTable: inodeTable}
+	for name, inum := range entries {
+		fs.EntryList = append(fs.EntryList,
+			&filesystem.DirectoryEntry{Name: name, InodeNumber: inum})
+	}
+	for name, inum := range dirEntries {
+		directory := inodeTable[1].(*filesystem.DirectoryInode)
+		directory.EntryList = append(directory.EntryList,
+			&filesystem.DirectoryEntry{Name: name, InodeNumber: inum})
+	}
+	if err := fs.RebuildInodePointers(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func makeTestImage(t *testing.T) *image.Image {
+	imageFilter, err := filter.New([]string{"/var/log/.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageTriggers := triggers.New()
+	imageTriggers.Triggers = []*triggers.Trigger{
+		{MatchLines: []string{"/etc/.*"}, Service: "sshd"},
+	}
+	return &image.Image{
+		FileSystem: makeFileSystem(t,
+			filesystem.InodeTable{
+				1: &filesystem.DirectoryInode{Mode: 040755},
+				2: &filesystem.RegularInode{Mode: 0100644, Size: 1,
+					Hash: hash1},
+				3: &filesystem.ComputedRegularInode{Mode: 0100600, Uid: 1,
+					Source: "filegen"},
+			},
+			map[string]uint64{"etc": 1},
+			map[string]uint64{"passwd": 2, "link": 2, "computed": 3}),
+		Filter:   imageFilter,
+		Tags:     tags.Tags{healthCheckCommandTag: "true"},
+		Triggers: imageTriggers,
+	}
+}
+
+func makeTestRequest(img *image.Image) sub.UpdateRequest {
+	fs := img.FileSystem
+	return sub.UpdateRequest{
+		HealthCheck: GetHealthCheck(img),
+		ImageName:   "test/image",
+		FilesToCopyToCache: []sub.FileToCopyToCache{
+			{Name: "/old", Hash: hash1},
+		},
+		DirectoriesToMake: []sub.Inode{
+			{Name: "/etc", GenericInode: fs.InodeTable[1]},
+		},
+		InodesToMake: []sub.Inode{
+			{Name: "/etc/passwd", GenericInode: fs.InodeTable[2]},
+			{Name: "/etc/computed", GenericInode: &filesystem.RegularInode{
+				Mode: 0100600, Uid: 1, Size: 1, Hash: hash2}},
+		},
+		HardlinksToMake: []sub.Hardlink{
+			{NewLink: "/etc/link", Target: "/etc/passwd"},
+		},
+		PathsToDelete: []string{"/junk"},
+		Triggers:      img.Triggers,
+	}
+}
+
+func TestCheckUpdateMatchesImage(t *testing.T) {
+	img := makeTestImage(t)
+	subFS := makeFileSystem(t,
+		filesystem.InodeTable{
+			1: &filesystem.DirectoryInode{Mode: 040755},
+			2: &filesystem.RegularInode{Mode: 0100644, Size: 1, Hash: hash1},
+			3: &filesystem.RegularInode{Mode: 0100600, Size: 1, Hash: hash2},
+		},
+		map[string]uint64{"data": 1, "old": 2, "secret": 3},
+		nil)
+	request := makeTestRequest(img)
+	if err := CheckUpdateMatchesImage(request, img, subFS); err != nil {
+		t.Fatal(err)
+	}
+	// Relink an existing file with the same data.
+	request.HardlinksToMake[0].Target = "/old"
+	if err := CheckUpdateMatchesImage(request, img, subFS); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func(request *sub.UpdateRequest)
+	}{
+		{"changed file", func(request *sub.UpdateRequest) {
+			request.InodesToMake[0].GenericInode = &filesystem.RegularInode{
+				Mode: 0100644, Size: 1, Hash: hash2}
+		}},
+		{"extra file", func(request *sub.UpdateRequest) {
+			request.InodesToMake[0].Name = "/etc/shadow"
+		}},
+		{"changed computed file", func(request *sub.UpdateRequest) {
+			request.InodesToMake[1].GenericInode = &filesystem.RegularInode{
+				Mode: 0104755, Uid: 1, Size: 1, Hash: hash2}
+		}},
+		{"changed directory", func(request *sub.UpdateRequest) {
+			request.InodesToChange = []sub.Inode{{Name: "/etc",
+				GenericInode: &filesystem.DirectoryInode{Mode: 040777}}}
+		}},
+		{"bad copy to cache", func(request *sub.UpdateRequest) {
+			request.FilesToCopyToCache[0].Name = "/secret"
+		}},
+		{"bad link", func(request *sub.UpdateRequest) {
+			request.HardlinksToMake[0].Target = "/secret"
+		}},
+		{"delete image file", func(request *sub.UpdateRequest) {
+			request.PathsToDelete = []string{"/etc/passwd"}
+		}},
+		{"delete filtered file", func(request *sub.UpdateRequest) {
+			request.PathsToDelete = []string{"/var/log/messages"}
+		}},
+		{"missing triggers", func(request *sub.UpdateRequest) {
+			request.Triggers = nil
+		}},
+		{"changed trigger", func(request *sub.UpdateRequest) {
+			request.Triggers = triggers.New()
+			request.Triggers.Triggers = []*triggers.Trigger{
+				{MatchLines: []string{"/.*"}, Service: "sshd"},
+			}
+		}},
+		{"changed health check", func(request *sub.UpdateRequest) {
+			request.HealthCheck = &sub.HealthCheck{Command: "rm -rf /"}
+		}},
+		{"missing health check", func(request *sub.UpdateRequest) {
+			request.HealthCheck = nil
+		}},
+	}
+	for _, test := range tests {
+		request := makeTestRequest(img)
+		test.modify(&request)
+		if err := CheckUpdateMatchesImage(request, img, subFS); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+	// Deletions are not permitted for sparse images.
+	img.Filter = nil
+	request = makeTestRequest(img)
+	if err := CheckUpdateMatchesImage(request, img, subFS); err == nil {
+		t.Error("deletion for sparse image: no error")
+	}
+}
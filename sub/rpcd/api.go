@@ -1,6 +1,7 @@
 package rpcd
 
 import (
+	"crypto/x509"
 	"io"
 	"sync"
 	"time"
@@ -25,12 +26,14 @@ const (
 
 type Config struct {
 	DisruptionManager        string
+	ImageServerAddress       string
 	NetworkBenchmarkFilename string
 	NoteGeneratorCommand     string
 	ObjectsDirectoryName     string
 	OldTriggersFilename      string
 	RootDirectoryName        string
 	SubConfiguration         proto.Configuration
+	TrustedImageSigners      *x509.CertPool // If nil, images are not verified.
 }
 
 type Params struct {
@@ -51,15 +54,20 @@ type rpcType struct {
 	*serverutil.PerUserMethodLimiter
 	disruptionManagerControl     chan<- bool // True: request; false: cancel.
 	ownerUsers                   map[string]struct{}
+	verifiedImageLock            sync.Mutex
+	verifiedImage                *verifiedImageType
 	rwLock                       sync.RWMutex // Protect everything below.
+	disruptionNextWindow         time.Time
 	disruptionState              proto.DisruptionState
 	getFilesLock                 sync.Mutex
 	fetchInProgress              bool // Fetch() & Update() mutually exclusive.
 	updateInProgress             bool
+	healthCheckInProgress        bool
 	startTimeNanoSeconds         int32 // For Fetch() or Update().
 	startTimeSeconds             int64
 	initialImageName             string
 	lastFetchError               error
+	lastHealthCheckError         error
 	lastNote                     string
 	lastSuccessfulImageName      string
 	lastUpdateError              error
@@ -77,6 +85,7 @@ type addObjectsHandlerType struct {
 }
 
 type HtmlWriter struct {
+	disruptionNextWindow    *time.Time
 	lastNote                *string
 	lastSuccessfulImageName *string
 }
@@ -118,6 +127,7 @@ func Setup(config Config, params Params) *HtmlWriter {
 	}
 	go rpcObj.startWriteProber()
 	return &HtmlWriter{
+		disruptionNextWindow:    &rpcObj.disruptionNextWindow,
 		lastNote:                &rpcObj.lastNote,
 		lastSuccessfulImageName: &rpcObj.lastSuccessfulImageName,
 	}
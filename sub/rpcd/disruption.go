@@ -24,14 +24,16 @@ const (
 )
 
 type runInfoType struct {
-	command string
-	state   proto.DisruptionState
+	command    string
+	nextWindow time.Time
+	state      proto.DisruptionState
 }
 
 type runResultType struct {
-	command string
-	err     error
-	state   proto.DisruptionState
+	command    string
+	err        error
+	nextWindow time.Time
+	state      proto.DisruptionState
 }
 
 func clearTimer(timer *time.Timer) {
@@ -68,7 +70,7 @@ func (t *rpcType) disruptionRequest() proto.DisruptionState {
 }
 
 func (t *rpcType) runDisruptionManager(command string) (
-	proto.DisruptionState, error) {
+	proto.DisruptionState, time.Time, error) {
 	switch command {
 	case disruptionManagerCancel, disruptionManagerRequest:
 		t.params.Logger.Printf("Running: %s %s\n",
@@ -80,30 +82,32 @@ func (t *rpcType) runDisruptionManager(command string) (
 	_output, err := exec.Command(t.config.DisruptionManager,
 		command).CombinedOutput()
 	if err == nil {
-		return proto.DisruptionStatePermitted, nil
+		return proto.DisruptionStatePermitted, time.Time{}, nil
 	}
 	output := strings.TrimSpace(string(_output))
 	e, ok := err.(*exec.ExitError)
 	if !ok {
 		if len(output) > 0 {
-			return 0, fmt.Errorf("%s: %s", err, output)
+			return 0, time.Time{}, fmt.Errorf("%s: %s", err, output)
 		} else {
-			return 0, fmt.Errorf("%s", err)
+			return 0, time.Time{}, fmt.Errorf("%s", err)
 		}
 	}
 	switch e.ExitCode() {
 	case 0:
-		return proto.DisruptionStatePermitted, nil
+		return proto.DisruptionStatePermitted, time.Time{}, nil
 	case 1:
-		return proto.DisruptionStateRequested, nil
+		return proto.DisruptionStateRequested, time.Time{}, nil
 	case 2:
-		return proto.DisruptionStateDenied, nil
+		return proto.DisruptionStateDenied,
+			proto.ParseDisruptionManagerNextWindow(output), nil
 	default:
 		if len(output) > 0 {
-			return 0,
+			return 0, time.Time{},
 				fmt.Errorf("invalid exit code: %d: %s", e.ExitCode(), output)
 		} else {
-			return 0, fmt.Errorf("invalid exit code: %d", e.ExitCode())
+			return 0, time.Time{},
+				fmt.Errorf("invalid exit code: %d", e.ExitCode())
 		}
 	}
 }
@@ -159,6 +163,9 @@ func (t *rpcType) disruptionManagerLoop(controlChannel <-chan bool,
 				resetCheckInterval = true
 			}
 		case result := <-resultChannel:
+			t.rwLock.Lock()
+			t.disruptionNextWindow = result.nextWindow
+			t.rwLock.Unlock()
 			if result.state != currentState {
 				t.rwLock.Lock()
 				t.disruptionState = result.state
@@ -225,8 +232,9 @@ func (t *rpcType) disruptionManagerQueue(commandChannel <-chan string,
 			if !commandIsRunning && nextCommand != "" {
 				commandIsRunning = true
 				go func(command string) {
-					state, err := t.runDisruptionManager(command)
-					runResultChannel <- runResultType{command, err, state}
+					state, nextWindow, err := t.runDisruptionManager(command)
+					runResultChannel <- runResultType{
+						command, err, nextWindow, state}
 				}(nextCommand)
 				nextCommand = ""
 			}
@@ -258,7 +266,8 @@ func (t *rpcType) disruptionManagerQueue(commandChannel <-chan string,
 					lastMutatingCommand = runResult.command
 					lastMutatingCommandTime = lastCommandTime
 				}
-				resultChannel <- runInfoType{runResult.command, runResult.state}
+				resultChannel <- runInfoType{runResult.command,
+					runResult.nextWindow, runResult.state}
 			}
 		}
 	}
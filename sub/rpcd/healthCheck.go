@@ -0,0 +1,80 @@
+package rpcd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/proto/sub"
+)
+
+const healthCheckInterval = 5 * time.Second
+
+var (
+	healthCheckGracePeriod = flag.Duration("healthCheckGracePeriod",
+		5*time.Minute,
+		"Default time a post-update health check may take to succeed")
+)
+
+// checkHealth runs the health check once. The command or request is
+// abandoned when the context is done.
+func checkHealth(ctx context.Context, healthCheck sub.HealthCheck) error {
+	if healthCheck.Command != "" {
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", healthCheck.Command)
+		// Do not wait for children which hold the output open after the shell
+		// has been killed.
+		cmd.WaitDelay = time.Second
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("timed out: %s", bytes.TrimSpace(output))
+			}
+			return fmt.Errorf("%s: %s", err, bytes.TrimSpace(output))
+		}
+	}
+	if healthCheck.Url != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			healthCheck.Url, nil)
+		if err != nil {
+			return err
+		}
+		client := http.Client{Timeout: healthCheckInterval * 2}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s", healthCheck.Url, resp.Status)
+		}
+	}
+	return nil
+}
+
+// runHealthCheck runs the health check until it succeeds or the grace period
+// expires, returning the last error. A health check which hangs is killed at
+// the end of the grace period.
+func (t *rpcType) runHealthCheck(healthCheck sub.HealthCheck) error {
+	gracePeriod := healthCheck.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = *healthCheckGracePeriod
+	}
+	stopTime := time.Now().Add(gracePeriod)
+	ctx, cancel := context.WithDeadline(context.Background(), stopTime)
+	defer cancel()
+	for {
+		var err error
+		t.systemGoroutine.Run(func() { err = checkHealth(ctx, healthCheck) })
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(healthCheckInterval).After(stopTime) {
+			return err
+		}
+		t.params.Logger.Debugf(0, "Health check failed: %s, retrying\n", err)
+		time.Sleep(healthCheckInterval)
+	}
+}
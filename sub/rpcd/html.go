@@ -3,6 +3,9 @@ package rpcd
 import (
 	"fmt"
 	"io"
+	"time"
+
+	"github.com/Cloud-Foundations/Dominator/lib/format"
 )
 
 func (hw *HtmlWriter) writeHtml(writer io.Writer) {
@@ -12,4 +15,9 @@ func (hw *HtmlWriter) writeHtml(writer io.Writer) {
 		fmt.Fprintf(writer, "Note at last successful update: \"%s\"<br>\n",
 			*hw.lastNote)
 	}
+	if nextWindow := *hw.disruptionNextWindow; !nextWindow.IsZero() {
+		fmt.Fprintf(writer, "Next maintenance window: %s (in %s)<br>\n",
+			nextWindow.Local().Format(format.TimeFormatSeconds),
+			format.Duration(time.Until(nextWindow)))
+	}
 }
@@ -34,11 +34,14 @@ func (t *rpcType) Poll(conn *srpc.Conn) error {
 	response.CurrentConfiguration = t.getConfiguration()
 	t.rwLock.RLock()
 	response.FetchInProgress = t.fetchInProgress
-	response.UpdateInProgress = t.updateInProgress
+	response.UpdateInProgress = t.updateInProgress || t.healthCheckInProgress
 	if t.lastFetchError != nil {
 		response.LastFetchError = t.lastFetchError.Error()
 	}
-	if !t.updateInProgress {
+	if !response.UpdateInProgress {
+		if t.lastHealthCheckError != nil {
+			response.LastHealthCheckError = t.lastHealthCheckError.Error()
+		}
 		if t.lastUpdateError != nil {
 			response.LastUpdateError = t.lastUpdateError.Error()
 		}
@@ -52,6 +55,7 @@ func (t *rpcType) Poll(conn *srpc.Conn) error {
 		t.getClientLock(conn, request.LockFor) != nil
 	response.LockedUntil = t.lockedUntil
 	response.FreeSpace = t.getFreeSpace()
+	response.DisruptionNextWindow = t.disruptionNextWindow
 	response.DisruptionState = t.disruptionState
 	t.rwLock.RUnlock()
 	response.StartTime = startTime
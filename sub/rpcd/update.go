@@ -34,6 +34,10 @@ type flusher interface {
 
 func (t *rpcType) Update(conn *srpc.Conn, request sub.UpdateRequest,
 	reply *sub.UpdateResponse) error {
+	if err := t.verifyImage(request); err != nil {
+		t.params.Logger.Println(err)
+		return err
+	}
 	if err := t.getUpdateLock(conn); err != nil {
 		t.params.Logger.Println(err)
 		return err
@@ -67,18 +71,69 @@ func (t *rpcType) getUpdateLock(conn *srpc.Conn) error {
 	if t.updateInProgress {
 		return errors.New("Update() already in progress")
 	}
+	if t.healthCheckInProgress {
+		return errors.New("health check in progress")
+	}
 	t.updateInProgress = true
+	t.lastHealthCheckError = nil
 	t.lastUpdateError = nil
 	return nil
 }
 
 func (t *rpcType) updateAndUnlock(request sub.UpdateRequest,
 	rootDirectoryName string) error {
-	defer t.clearUpdateInProgress()
+	startTime := time.Now()
+	fsChangeDuration := t.update(request, rootDirectoryName)
+	var healthCheckError error
+	if t.lastUpdateError == nil && request.HealthCheck != nil {
+		// Release the Update lock while the health check runs, so that the
+		// sub may scan and fetch. Poll reports the update as in progress
+		// until the health check completes.
+		t.rwLock.Lock()
+		t.healthCheckInProgress = true
+		t.updateInProgress = false
+		t.rwLock.Unlock()
+		healthCheckError = t.runHealthCheck(*request.HealthCheck)
+	}
+	timeTaken := time.Since(startTime)
+	var note string
+	var noteError error
+	if t.lastUpdateError != nil {
+		t.params.Logger.Printf("Update(): last error: %s\n", t.lastUpdateError)
+	} else if healthCheckError != nil {
+		t.params.Logger.Printf("Update(): health check failed: %s\n",
+			healthCheckError)
+	} else {
+		note, noteError = t.generateNote()
+		if noteError != nil {
+			t.params.Logger.Println(noteError)
+		}
+	}
+	t.rwLock.Lock()
+	if t.lastUpdateError == nil && healthCheckError == nil {
+		if !request.SparseImage {
+			t.lastSuccessfulImageName = request.ImageName
+		}
+		if noteError == nil {
+			t.lastNote = note
+		}
+	}
+	t.lastHealthCheckError = healthCheckError
+	t.healthCheckInProgress = false
+	t.updateInProgress = false
+	t.rwLock.Unlock()
+	t.params.Logger.Printf("Update() completed in %s (change window: %s)\n",
+		timeTaken, fsChangeDuration)
+	return t.lastUpdateError
+}
+
+// update will apply the update with the scanner disabled, recording the
+// results. The time taken to change the file-system is returned.
+func (t *rpcType) update(request sub.UpdateRequest,
+	rootDirectoryName string) time.Duration {
 	defer t.params.ScannerConfiguration.BoostCpuLimit(t.params.Logger)
 	t.params.DisableScannerFunction(true)
 	defer t.params.DisableScannerFunction(false)
-	startTime := time.Now()
 	oldTriggers := &triggers.MergeableTriggers{}
 	file, err := os.Open(t.config.OldTriggersFilename)
 	if err == nil {
@@ -129,32 +184,7 @@ func (t *rpcType) updateAndUnlock(request sub.UpdateRequest,
 	})
 	t.lastUpdateHadTriggerFailures = hadTriggerFailures
 	t.lastUpdateError = lastUpdateError
-	timeTaken := time.Since(startTime)
-	if t.lastUpdateError != nil {
-		t.params.Logger.Printf("Update(): last error: %s\n", t.lastUpdateError)
-	} else {
-		note, err := t.generateNote()
-		if err != nil {
-			t.params.Logger.Println(err)
-		}
-		t.rwLock.Lock()
-		if !request.SparseImage {
-			t.lastSuccessfulImageName = request.ImageName
-		}
-		if err == nil {
-			t.lastNote = note
-		}
-		t.rwLock.Unlock()
-	}
-	t.params.Logger.Printf("Update() completed in %s (change window: %s)\n",
-		timeTaken, fsChangeDuration)
-	return t.lastUpdateError
-}
-
-func (t *rpcType) clearUpdateInProgress() {
-	t.rwLock.Lock()
-	defer t.rwLock.Unlock()
-	t.updateInProgress = false
+	return fsChangeDuration
 }
 
 // Returns true if there were failures.
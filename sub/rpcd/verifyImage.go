@@ -0,0 +1,107 @@
+package rpcd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	imclient "github.com/Cloud-Foundations/Dominator/imageserver/client"
+	"github.com/Cloud-Foundations/Dominator/lib/image"
+	"github.com/Cloud-Foundations/Dominator/lib/srpc"
+	"github.com/Cloud-Foundations/Dominator/proto/sub"
+	"github.com/Cloud-Foundations/Dominator/sub/lib"
+)
+
+type verifiedImageType struct {
+	digest []byte
+	image  *image.Image
+	name   string
+}
+
+// verifyImage fetches the image from the image server and checks that it was
+// signed by a trusted signer and that the update request matches the image.
+// Nothing is checked if trusted signers were not specified. Requests which do
+// not name an image (such as ad-hoc updates) are rejected if trusted signers
+// were specified.
+func (t *rpcType) verifyImage(request sub.UpdateRequest) error {
+	if t.config.TrustedImageSigners == nil {
+		return nil
+	}
+	imageName := request.ImageName
+	if imageName == "" {
+		return errors.New(
+			"Update() rejected, no image name and signed images are required")
+	}
+	fs := t.params.FileSystemHistory.FileSystem()
+	if fs == nil {
+		return errors.New("no file-system history yet")
+	}
+	img, err := t.getVerifiedImage(imageName)
+	if err != nil {
+		return err
+	}
+	err = lib.CheckUpdateMatchesImage(request, img, &fs.FileSystem.FileSystem)
+	if err != nil {
+		return fmt.Errorf("Update() rejected, request does not match image: %s",
+			err)
+	}
+	return nil
+}
+
+// getVerifiedImage returns the named image after verifying its signature. The
+// last verified image is cached and is used if the image server reports the
+// same digest for the name, so that the image is not fetched and verified
+// again for every update.
+func (t *rpcType) getVerifiedImage(imageName string) (*image.Image, error) {
+	client, err := srpc.DialHTTP("tcp", t.config.ImageServerAddress, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to image server: %s: %s",
+			t.config.ImageServerAddress, err)
+	}
+	defer client.Close()
+	version, err := imclient.GetImageVersion(client, imageName)
+	if err != nil {
+		// Older image servers do not support GetImageVersion: always fetch.
+		t.params.Logger.Debugf(0, "error getting image version: %s: %s\n",
+			imageName, err)
+	} else if version == nil {
+		return nil, errors.New("image not found: " + imageName)
+	} else {
+		t.verifiedImageLock.Lock()
+		verifiedImage := t.verifiedImage
+		t.verifiedImageLock.Unlock()
+		if verifiedImage != nil && verifiedImage.name == imageName &&
+			bytes.Equal(verifiedImage.digest, version.Digest) {
+			return verifiedImage.image, nil
+		}
+	}
+	img, err := imclient.GetImage(client, imageName)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		return nil, errors.New("image not found: " + imageName)
+	}
+	if err := img.FileSystem.RebuildInodePointers(); err != nil {
+		return nil, err
+	}
+	signer, err := img.VerifySignature(t.config.TrustedImageSigners)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Update() rejected, image: %s failed verification: %s",
+			imageName, err)
+	}
+	t.params.Logger.Printf("Image: %s signed by: %s\n", imageName, signer)
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, err
+	}
+	t.verifiedImageLock.Lock()
+	t.verifiedImage = &verifiedImageType{
+		digest: digest,
+		image:  img,
+		name:   imageName,
+	}
+	t.verifiedImageLock.Unlock()
+	return img, nil
+}
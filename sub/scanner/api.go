@@ -21,8 +21,10 @@ type Configuration struct {
 	CpuLimiter           *cpulimiter.CpuLimiter
 	DefaultCpuPercent    uint
 	FsScanContext        *fsrateio.ReaderContext
+	FullScanInterval     time.Duration // Only used if WatchFileSystem is true.
 	NetworkReaderContext *rateio.ReaderContext
 	ScanFilter           *filter.Filter
+	WatchFileSystem      bool // Only rescan changed paths between full scans.
 }
 
 func (configuration *Configuration) BoostCpuLimit(logger log.Logger) {
@@ -58,6 +60,7 @@ type FileSystemHistory struct {
 	timeOfLastScan     time.Time
 	durationOfLastScan time.Duration
 	timeOfLastChange   time.Time
+	timeOfLastFullScan time.Time
 }
 
 func (fsh *FileSystemHistory) DurationOfLastScan() time.Duration {
@@ -110,6 +113,7 @@ type FileSystem struct {
 	scanner.FileSystem
 	cacheDirectoryName string
 	objectcache.ObjectCache
+	partialScan bool
 }
 
 func ScanFileSystem(rootDirectoryName string, cacheDirectoryName string,
@@ -17,6 +17,10 @@ func (fsh *FileSystemHistory) writeHtml(writer io.Writer) {
 		fmt.Fprintf(writer, "Last scan completed: %s<br>\n", fsh.timeOfLastScan)
 		fmt.Fprintf(writer, "Duration of last scan: %s<br>\n",
 			fsh.durationOfLastScan)
+		if fsh.timeOfLastFullScan != fsh.timeOfLastScan {
+			fmt.Fprintf(writer, "Last full scan completed: %s<br>\n",
+				fsh.timeOfLastFullScan)
+		}
 		fsh.fileSystem.WriteHtml(writer)
 		tmp := format.FormatBytes(uint64(float64(
 			fsh.fileSystem.TotalDataBytes) / fsh.durationOfLastScan.Seconds()))
@@ -5,6 +5,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Cloud-Foundations/Dominator/lib/filter"
 	"github.com/Cloud-Foundations/Dominator/lib/html"
 	"github.com/Cloud-Foundations/Dominator/lib/log"
 )
@@ -40,13 +41,38 @@ func scannerDaemon(rootDirectoryName string, cacheDirectoryName string,
 	logger log.Logger) {
 	runtime.LockOSThread()
 	loweredPriority := false
+	var watcher *watcherType
+	if configuration.WatchFileSystem {
+		var err error
+		watcher, err = newWatcher(rootDirectoryName, logger)
+		if err != nil {
+			logger.Printf("Error creating watcher, using full scans: %s\n",
+				err)
+		}
+	}
+	var lastFullScan time.Time
+	var lastScanFilter *filter.Filter
 	var oldFS FileSystem
 	var sleepUntil time.Time
 	for ; ; time.Sleep(time.Until(sleepUntil)) {
 		sleepUntil = time.Now().Add(time.Second)
-		fs, err := scanFileSystem(rootDirectoryName, cacheDirectoryName,
-			configuration, &oldFS)
+		var dirtyPaths *dirtyPathsType
+		if watcher != nil {
+			dirtyPaths = watcher.getDirtyPaths()
+			if time.Since(lastFullScan) >= configuration.FullScanInterval ||
+				configuration.ScanFilter != lastScanFilter {
+				dirtyPaths = nil
+			}
+		}
+		startTime := time.Now()
+		scanFilter := configuration.ScanFilter
+		fs, err := scanFileSystemWithDirtyPaths(rootDirectoryName,
+			cacheDirectoryName, configuration, &oldFS, dirtyPaths)
 		if err != nil {
+			if watcher != nil {
+				// Changes may have been lost, so start over.
+				watcher.requestFullScan()
+			}
 			if err.Error() == "DisableScan" {
 				disableScanAcknowledge <- true
 				<-disableScanAcknowledge
@@ -56,6 +82,13 @@ func scannerDaemon(rootDirectoryName string, cacheDirectoryName string,
 		} else {
 			oldFS.InodeTable = fs.InodeTable
 			oldFS.DirectoryInode = fs.DirectoryInode
+			if watcher != nil {
+				if dirtyPaths == nil {
+					lastFullScan = startTime
+					lastScanFilter = scanFilter
+				}
+				watcher.addWatches(&fs.FileSystem.FileSystem)
+			}
 			fsChannel <- fs
 			runtime.GC()
 			if !loweredPriority {
@@ -22,6 +22,9 @@ func (fsh *FileSystemHistory) update(newFS *FileSystem) {
 	scanTimeDistribution.Add(fsh.durationOfLastScan)
 	fsh.scanCount++
 	fsh.timeOfLastScan = now
+	if !newFS.partialScan {
+		fsh.timeOfLastFullScan = now
+	}
 	if fsh.fileSystem == nil {
 		fsh.fileSystem = newFS
 		fsh.generationCount = 1
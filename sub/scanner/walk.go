@@ -7,6 +7,15 @@ import (
 
 func scanFileSystem(rootDirectoryName string, cacheDirectoryName string,
 	configuration *Configuration, oldFS *FileSystem) (*FileSystem, error) {
+	return scanFileSystemWithDirtyPaths(rootDirectoryName, cacheDirectoryName,
+		configuration, oldFS, nil)
+}
+
+// scanFileSystemWithDirtyPaths scans the file-system. If dirtyPaths is not nil,
+// only the dirty pathnames are scanned and the rest are copied from oldFS.
+func scanFileSystemWithDirtyPaths(rootDirectoryName string,
+	cacheDirectoryName string, configuration *Configuration, oldFS *FileSystem,
+	dirtyPaths *dirtyPathsType) (*FileSystem, error) {
 	var fileSystem FileSystem
 	fileSystem.configuration = configuration
 	fileSystem.rootDirectoryName = rootDirectoryName
@@ -15,9 +24,19 @@ func scanFileSystem(rootDirectoryName string, cacheDirectoryName string,
 	if configuration.CpuLimiter != nil {
 		hasher = scanner.NewCpuLimitedHasher(configuration.CpuLimiter, hasher)
 	}
-	fs, err := scanner.ScanFileSystem(rootDirectoryName,
-		configuration.FsScanContext, configuration.ScanFilter,
-		checkScanDisableRequest, hasher, &oldFS.FileSystem)
+	params := scanner.Params{
+		FsScanContext:           configuration.FsScanContext,
+		RootDirectoryName:       rootDirectoryName,
+		ScanFilter:              configuration.ScanFilter,
+		CheckScanDisableRequest: checkScanDisableRequest,
+		Hasher:                  hasher,
+		OldFS:                   &oldFS.FileSystem,
+	}
+	if dirtyPaths != nil {
+		params.IsDirty = dirtyPaths.isDirty
+		fileSystem.partialScan = true
+	}
+	fs, err := scanner.ScanFileSystemWithParams(params)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,181 @@
+package scanner
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Cloud-Foundations/Dominator/lib/filesystem"
+	"github.com/Cloud-Foundations/Dominator/lib/log"
+	"github.com/fsnotify/fsnotify"
+)
+
+// dirtyPathsType records the pathnames which have changed. A changed pathname
+// marks the whole subtree below it as dirty, and its ancestors need to be
+// rescanned to find it.
+type dirtyPathsType struct {
+	ancestors map[string]struct{}
+	subtrees  map[string]struct{}
+}
+
+type watcherType struct {
+	fsWatcher         *fsnotify.Watcher
+	logger            log.Logger
+	rootDirectoryName string
+	mutex             sync.Mutex // Protect everything below.
+	dirtyPaths        *dirtyPathsType
+	fullScanNeeded    bool
+	loggedWatchError  bool
+	watchedPaths      map[string]struct{}
+}
+
+func newDirtyPaths() *dirtyPathsType {
+	return &dirtyPathsType{
+		ancestors: make(map[string]struct{}),
+		subtrees:  make(map[string]struct{}),
+	}
+}
+
+func newWatcher(rootDirectoryName string,
+	logger log.Logger) (*watcherType, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	watcher := &watcherType{
+		fsWatcher:         fsWatcher,
+		logger:            logger,
+		rootDirectoryName: rootDirectoryName,
+		dirtyPaths:        newDirtyPaths(),
+		fullScanNeeded:    true,
+		watchedPaths:      make(map[string]struct{}),
+	}
+	go watcher.processEvents()
+	return watcher, nil
+}
+
+func (dirtyPaths *dirtyPathsType) add(pathname string) {
+	dirtyPaths.subtrees[pathname] = struct{}{}
+	for pathname != "/" {
+		pathname = path.Dir(pathname)
+		if _, ok := dirtyPaths.ancestors[pathname]; ok {
+			return
+		}
+		dirtyPaths.ancestors[pathname] = struct{}{}
+	}
+}
+
+func (dirtyPaths *dirtyPathsType) isDirty(pathname string) bool {
+	if _, ok := dirtyPaths.ancestors[pathname]; ok {
+		return true
+	}
+	for {
+		if _, ok := dirtyPaths.subtrees[pathname]; ok {
+			return true
+		}
+		if pathname == "/" {
+			return false
+		}
+		pathname = path.Dir(pathname)
+	}
+}
+
+// addWatches adds watches for the directories in the file-system which are
+// not yet being watched. Newly watched directories are marked dirty, since
+// changes may have been missed before the watch was added.
+func (w *watcherType) addWatches(fs *filesystem.FileSystem) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.addWatchesWithLock(&fs.DirectoryInode, "/")
+}
+
+// This must be called with the lock held.
+func (w *watcherType) addWatchesWithLock(directory *filesystem.DirectoryInode,
+	pathname string) {
+	if _, ok := w.watchedPaths[pathname]; !ok {
+		err := w.fsWatcher.Add(path.Join(w.rootDirectoryName, pathname))
+		if err != nil {
+			// Changes in this directory would be missed, so keep scanning.
+			w.fullScanNeeded = true
+			if !w.loggedWatchError {
+				w.logger.Printf(
+					"Error watching: %s: %s, falling back to full scans\n",
+					pathname, err)
+				w.loggedWatchError = true
+			}
+			return
+		}
+		w.watchedPaths[pathname] = struct{}{}
+		w.dirtyPaths.add(pathname)
+	}
+	for _, dirent := range directory.EntryList {
+		if inode, ok := dirent.Inode().(*filesystem.DirectoryInode); ok {
+			w.addWatchesWithLock(inode, path.Join(pathname, dirent.Name))
+		}
+	}
+}
+
+// getDirtyPaths returns the pathnames which have changed since the last call
+// and resets them. If a full scan is needed, nil is returned.
+func (w *watcherType) getDirtyPaths() *dirtyPathsType {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	dirtyPaths := w.dirtyPaths
+	w.dirtyPaths = newDirtyPaths()
+	if w.fullScanNeeded {
+		w.fullScanNeeded = false
+		return nil
+	}
+	return dirtyPaths
+}
+
+func (w *watcherType) processEvent(event fsnotify.Event) {
+	pathname := "/" + strings.TrimPrefix(
+		strings.TrimPrefix(event.Name, w.rootDirectoryName), "/")
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.dirtyPaths.add(pathname)
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) == 0 {
+		return
+	}
+	if _, ok := w.watchedPaths[pathname]; !ok {
+		return
+	}
+	// A watched directory went away. Drop the watches for the subtree, they
+	// will be added again when the new location is scanned.
+	prefix := pathname + "/"
+	for watchedPath := range w.watchedPaths {
+		if watchedPath == pathname || strings.HasPrefix(watchedPath, prefix) {
+			w.fsWatcher.Remove(path.Join(w.rootDirectoryName, watchedPath))
+			delete(w.watchedPaths, watchedPath)
+		}
+	}
+}
+
+func (w *watcherType) processEvents() {
+	for {
+		select {
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+			w.processEvent(event)
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			if err == fsnotify.ErrEventOverflow {
+				w.logger.Println("Watch queue overflowed, performing full scan")
+			} else {
+				w.logger.Printf("Error watching file-system: %s\n", err)
+			}
+			w.requestFullScan()
+		}
+	}
+}
+
+func (w *watcherType) requestFullScan() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.fullScanNeeded = true
+}
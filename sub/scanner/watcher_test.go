@@ -0,0 +1,24 @@
+package scanner
+
+import (
+	"testing"
+)
+
+func TestDirtyPaths(t *testing.T) {
+	dirtyPaths := newDirtyPaths()
+	if dirtyPaths.isDirty("/") {
+		t.Error("empty dirty paths has dirty root")
+	}
+	dirtyPaths.add("/etc/ssh")
+	for _, pathname := range []string{"/", "/etc", "/etc/ssh",
+		"/etc/ssh/sshd_config"} {
+		if !dirtyPaths.isDirty(pathname) {
+			t.Errorf("%s is not dirty", pathname)
+		}
+	}
+	for _, pathname := range []string{"/bin", "/etc/passwd", "/etc/sshd"} {
+		if dirtyPaths.isDirty(pathname) {
+			t.Errorf("%s is dirty", pathname)
+		}
+	}
+}